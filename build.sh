@@ -16,6 +16,7 @@ BENCHCMP="no"
 BUILDALL="no"
 BENCHALL="no"
 FASTHTTP="no"
+HHBATCH="no"
 QA="no"
 GOSTATUS="no"
 VALIDATE="no"
@@ -57,10 +58,11 @@ show_usage() {
     echo -e "`printf %-18s ` [-r] enable data race detection"
     echo -e "`printf %-18s ` [-s] gostatus checks dependent pkg status"
     echo -e "`printf %-18s ` [-v] validate"
+    echo -e "`printf %-18s ` [-w] enable experimental hinted handoff batched write"
     echo -e "`printf %-18s ` -t <target> `ls -Cm cmd`"
 }
 
-args=`getopt abcvqfgrhislt:p: $*`
+args=`getopt abcvqfgrhislwt:p: $*`
 [ $? != 0 ] && echo "hs" && show_usage && exit 1
 
 set -- $args
@@ -103,6 +105,9 @@ do
       -v)
           VALIDATE="yes"; shift
           ;;
+      -w)
+          HHBATCH="yes"; shift
+          ;;
       -p)
           PREFIX=$2; shift 2
           ;;
@@ -113,6 +118,7 @@ do
 done
 
 BUILD_FLAGS=''
+BUILD_TAGS=''
 if [ $RACE == "yes" ]; then
     BUILD_FLAGS="$BUILD_FLAGS -race"
 fi
@@ -120,7 +126,10 @@ if [ $GCDEBUG == "yes" ]; then
     BUILD_FLAGS="$BUILD_FLAGS -gcflags '-m=1'"
 fi
 if [ $FASTHTTP == "yes" ]; then
-    BUILD_FLAGS="$BUILD_FLAGS -tags fasthttp"
+    BUILD_TAGS="$BUILD_TAGS fasthttp"
+fi
+if [ $HHBATCH == "yes" ]; then
+    BUILD_TAGS="$BUILD_TAGS hhbatch"
 fi
 if [ $VALIDATE == "yes" ]; then
     validate
@@ -164,9 +173,9 @@ fi
 go generate ./...
 
 if [ $GOVER -gt 4 ]; then
-    go build $BUILD_FLAGS -ldflags "-X github.com/funkygao/gafka.BuiltAt=$BUILD_TIME -X github.com/funkygao/gafka.Version=$VER -X github.com/funkygao/gafka.BuildId=${GIT_ID}${GIT_DIRTY} -w"
+    go build $BUILD_FLAGS -tags "$BUILD_TAGS" -ldflags "-X github.com/funkygao/gafka.BuiltAt=$BUILD_TIME -X github.com/funkygao/gafka.Version=$VER -X github.com/funkygao/gafka.BuildId=${GIT_ID}${GIT_DIRTY} -w"
 else
-    go build $BUILD_FLAGS -ldflags "-X github.com/funkygao/gafka.BuiltAt $BUILD_TIME -X github.com/funkygao/gafka.Version $VER -X github.com/funkygao/gafka.BuildId ${GIT_ID}${GIT_DIRTY} -w"
+    go build $BUILD_FLAGS -tags "$BUILD_TAGS" -ldflags "-X github.com/funkygao/gafka.BuiltAt $BUILD_TIME -X github.com/funkygao/gafka.Version $VER -X github.com/funkygao/gafka.BuildId ${GIT_ID}${GIT_DIRTY} -w"
 fi
 
 if [ $INSTALL == "yes" ]; then
@@ -7,14 +7,19 @@ import (
 	golog "log"
 	"os"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/funkygao/fae/config"
 	"github.com/funkygao/gafka"
 	"github.com/funkygao/gafka/cmd/actord/controller"
+	"github.com/funkygao/gafka/cmd/actord/executor"
 	"github.com/funkygao/gafka/cmd/kateway/hh"
 	"github.com/funkygao/gafka/cmd/kateway/hh/disk"
+	"github.com/funkygao/gafka/cmd/kateway/job"
+	jobmysql "github.com/funkygao/gafka/cmd/kateway/job/mysql"
 	"github.com/funkygao/gafka/cmd/kateway/meta"
 	"github.com/funkygao/gafka/cmd/kateway/meta/zkmeta"
 	"github.com/funkygao/gafka/cmd/kateway/store"
@@ -40,6 +45,12 @@ func init() {
 	flag.StringVar(&Options.InfluxDbname, "influxdb", "", "influxdb db name")
 	flag.StringVar(&Options.ListenAddr, "addr", ":9065", "monitor http server addr")
 	flag.StringVar(&Options.HintedHandoffDir, "hhdirs", "hh", "hinted handoff dirs seperated by comma")
+	flag.IntVar(&Options.FiringConcurrency, "firing", 10, "max concurrent job firings of each topic")
+	flag.StringVar(&Options.TopicFiringConcurrency, "topicfiring", "", "max concurrent job firings of specific topics, e,g. topic1:2,topic2:20")
+	flag.IntVar(&Options.JobWorkerId, "jobid", -1, "job id generator worker id unique among actord and kateway instances, required by webhook retry chains")
+	flag.IntVar(&Options.PubPoolCapcity, "pubpool", 100, "pub connection pool capacity")
+	flag.IntVar(&Options.KafkaClients, "kafkaclients", 2, "kafka clients per cluster shared by pub producers of each ack kind")
+	flag.DurationVar(&Options.KafkaMetaRefresh, "kafkameta", time.Minute*10, "kafka client metadata refresh interval")
 	flag.Parse()
 
 	if Options.ShowVersion {
@@ -97,12 +108,44 @@ func Main() {
 		log.Warn("empty influx flag, telemetry disabled")
 	}
 
-	store.DefaultPubStore = kafka.NewPubStore(100, 0, false, false, false)
+	store.DefaultPubStore = kafka.NewPubStore(kafka.PoolConfigs{
+		Default: kafka.PoolConfig{
+			Producers:   Options.PubPoolCapcity,
+			Clients:     Options.KafkaClients,
+			MetaRefresh: Options.KafkaMetaRefresh,
+		},
+	}, 0, false, false, false)
 	if err = store.DefaultPubStore.Start(); err != nil {
 		panic(err)
 	}
 	log.Trace("pub store[%s] started", store.DefaultPubStore.Name())
 
+	if Options.JobWorkerId >= 0 {
+		// webhook executors schedule failed pushes into retry topics
+		var mcc = &config.ConfigMysql{}
+		b, err := zkzone.KatewayJobClusterConfig()
+		if err != nil {
+			panic(err)
+		}
+		if err = mcc.From(b); err != nil {
+			panic(err)
+		}
+		if job.Default, err = jobmysql.New(strconv.Itoa(Options.JobWorkerId), mcc); err != nil {
+			panic(err)
+		}
+		if err = job.Default.Start(); err != nil {
+			panic(err)
+		}
+		log.Trace("job store[%s] started", job.Default.Name())
+	} else {
+		log.Warn("empty jobid flag, webhook retry chains disabled")
+	}
+
+	executor.FiringConcurrency = Options.FiringConcurrency
+	if executor.TopicFiringConcurrency, err = executor.ParseTopicFiringConcurrency(Options.TopicFiringConcurrency); err != nil {
+		panic(err)
+	}
+
 	c := controller.New(zkzone, Options.ListenAddr, Options.ManagerType)
 
 	cfg := disk.DefaultConfig()
@@ -129,6 +172,11 @@ func Main() {
 		panic(err)
 	}
 
+	if job.Default != nil {
+		job.Default.Stop()
+		log.Trace("job store[%s] stopped", job.Default.Name())
+	}
+
 	log.Trace("pub store[%s] stopping", store.DefaultPubStore.Name())
 	store.DefaultPubStore.Stop()
 
@@ -1,14 +1,24 @@
 package bootstrap
 
+import (
+	"time"
+)
+
 var Options struct {
-	Zone             string
-	ShowVersion      bool
-	LogFile          string
-	LogLevel         string
-	LogRotateSize    int
-	InfluxAddr       string
-	InfluxDbname     string
-	ListenAddr       string
-	ManagerType      string
-	HintedHandoffDir string
+	Zone                   string
+	ShowVersion            bool
+	LogFile                string
+	LogLevel               string
+	LogRotateSize          int
+	InfluxAddr             string
+	InfluxDbname           string
+	ListenAddr             string
+	ManagerType            string
+	HintedHandoffDir       string
+	FiringConcurrency      int
+	TopicFiringConcurrency string
+	JobWorkerId            int
+	PubPoolCapcity         int
+	KafkaClients           int
+	KafkaMetaRefresh       time.Duration
 }
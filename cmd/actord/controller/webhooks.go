@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/funkygao/gafka/cmd/actord/executor"
+	"github.com/funkygao/gafka/sla"
 	"github.com/funkygao/gafka/zk"
 	log "github.com/funkygao/log4go"
 	zklib "github.com/samuel/go-zookeeper/zk"
@@ -154,6 +155,13 @@ func (this *controller) invokeWebhookExecutor(topic string, wg *sync.WaitGroup,
 		log.Info("de-claimed owner of %s", topic)
 	}(topic)
 
-	exe := executor.NewWebhookExecutor(this.shortId, hook.Cluster, topic, hook.Endpoints, stopper, this.auditor)
+	var chain sla.RetryChain
+	if hook.RetryChain != "" {
+		if chain, err = sla.ParseRetryChain(hook.RetryChain); err != nil {
+			log.Error("%s retry chain %s: %s", topic, hook.RetryChain, err)
+		}
+	}
+
+	exe := executor.NewWebhookExecutor(this.shortId, hook.Cluster, topic, hook.Endpoints, chain, stopper, this.auditor)
 	exe.Run()
 }
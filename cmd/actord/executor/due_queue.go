@@ -0,0 +1,107 @@
+package executor
+
+import (
+	"container/heap"
+	"sync"
+
+	"github.com/funkygao/gafka/cmd/kateway/job"
+)
+
+// dueQueue is a blocking priority queue of due jobs: higher priority first, then earlier
+// due time, so that a flood of low priority jobs can't delay the urgent ones.
+//
+// A job stays known to the queue from push until done, so that the same job fetched
+// again by the next poll won't be fired twice concurrently.
+type dueQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	jobs   dueJobHeap
+	known  map[int64]struct{}
+	closed bool
+}
+
+func newDueQueue() *dueQueue {
+	this := &dueQueue{known: make(map[int64]struct{})}
+	this.cond = sync.NewCond(&this.mu)
+	return this
+}
+
+// push returns false if the job is already queued or being fired.
+func (this *dueQueue) push(item job.JobItem) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if _, present := this.known[item.JobId]; present || this.closed {
+		return false
+	}
+
+	this.known[item.JobId] = struct{}{}
+	heap.Push(&this.jobs, item)
+	this.cond.Signal()
+	return true
+}
+
+// pop blocks until a job is available, ok is false if the queue is closed.
+func (this *dueQueue) pop() (item job.JobItem, ok bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for len(this.jobs) == 0 && !this.closed {
+		this.cond.Wait()
+	}
+
+	if this.closed {
+		return
+	}
+
+	return heap.Pop(&this.jobs).(job.JobItem), true
+}
+
+// done must be called after a popped job is handled.
+func (this *dueQueue) done(item job.JobItem) {
+	this.mu.Lock()
+	delete(this.known, item.JobId)
+	this.mu.Unlock()
+}
+
+func (this *dueQueue) len() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return len(this.jobs)
+}
+
+// close wakes up all the blocking pop, jobs left in queue are still in db and will be
+// fetched by the next owner.
+func (this *dueQueue) close() {
+	this.mu.Lock()
+	this.closed = true
+	this.cond.Broadcast()
+	this.mu.Unlock()
+}
+
+type dueJobHeap []job.JobItem
+
+func (h dueJobHeap) Len() int      { return len(h) }
+func (h dueJobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h dueJobHeap) Less(i, j int) bool {
+	if h[i].Priority != h[j].Priority {
+		return h[i].Priority > h[j].Priority
+	}
+	if h[i].DueTime != h[j].DueTime {
+		return h[i].DueTime < h[j].DueTime
+	}
+	return h[i].JobId < h[j].JobId
+}
+
+func (h *dueJobHeap) Push(x interface{}) {
+	*h = append(*h, x.(job.JobItem))
+}
+
+func (h *dueJobHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
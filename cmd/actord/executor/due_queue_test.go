@@ -0,0 +1,65 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/job"
+)
+
+func TestDueQueuePriority(t *testing.T) {
+	q := newDueQueue()
+	q.push(job.JobItem{JobId: 1, DueTime: 100})
+	q.push(job.JobItem{JobId: 2, DueTime: 100, Priority: 9})
+	q.push(job.JobItem{JobId: 3, DueTime: 99})
+	q.push(job.JobItem{JobId: 4, DueTime: 101, Priority: 9})
+	assert.Equal(t, 4, q.len())
+
+	var ids []int64
+	for i := 0; i < 4; i++ {
+		item, ok := q.pop()
+		assert.Equal(t, true, ok)
+		ids = append(ids, item.JobId)
+	}
+	assert.Equal(t, []int64{2, 4, 3, 1}, ids)
+}
+
+func TestDueQueueDedup(t *testing.T) {
+	q := newDueQueue()
+	assert.Equal(t, true, q.push(job.JobItem{JobId: 1}))
+	assert.Equal(t, false, q.push(job.JobItem{JobId: 1}))
+
+	item, _ := q.pop()
+	assert.Equal(t, false, q.push(item)) // being fired
+	q.done(item)
+	assert.Equal(t, true, q.push(item))
+}
+
+func TestDueQueueClose(t *testing.T) {
+	q := newDueQueue()
+	done := make(chan bool)
+	go func() {
+		_, ok := q.pop()
+		done <- ok
+	}()
+
+	q.close()
+	assert.Equal(t, false, <-done)
+	assert.Equal(t, false, q.push(job.JobItem{JobId: 1}))
+}
+
+func TestParseTopicFiringConcurrency(t *testing.T) {
+	r, err := ParseTopicFiringConcurrency("")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(r))
+
+	r, err = ParseTopicFiringConcurrency("a:2,b:20")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, r["a"])
+	assert.Equal(t, 20, r["b"])
+
+	for _, s := range []string{"a", "a:0", "a:x", ":1"} {
+		_, err = ParseTopicFiringConcurrency(s)
+		assert.NotEqual(t, nil, err)
+	}
+}
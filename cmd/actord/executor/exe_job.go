@@ -2,6 +2,8 @@ package executor
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,17 +17,52 @@ import (
 )
 
 const (
-	LagWarnThreshold   = 3  // in sec
-	HandlerConcurrentN = 10 // FIXME breaks the delivery order guarantee
+	LagWarnThreshold = 3   // in sec
+	DueJobsBatch     = 200 // max due jobs fetched per poll
 )
 
+var (
+	// FiringConcurrency is the default max concurrent firings of a job queue.
+	FiringConcurrency = 10 // FIXME breaks the delivery order guarantee
+
+	// TopicFiringConcurrency overrides FiringConcurrency for specific topics, e,g.
+	// limit the low priority reminder jobs so that they won't exhaust the shared
+	// mysql and kafka capacity.
+	TopicFiringConcurrency = make(map[string]int)
+)
+
+// ParseTopicFiringConcurrency parses per topic firing concurrency in the form of
+// topic1:2,topic2:20.
+func ParseTopicFiringConcurrency(s string) (map[string]int, error) {
+	r := make(map[string]int)
+	if s == "" {
+		return r, nil
+	}
+
+	for _, tuple := range strings.Split(s, ",") {
+		p := strings.SplitN(tuple, ":", 2)
+		if len(p) != 2 || p[0] == "" {
+			return nil, fmt.Errorf("invalid topic firing concurrency: %s", tuple)
+		}
+
+		n, err := strconv.Atoi(p[1])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid topic firing concurrency: %s", tuple)
+		}
+
+		r[p[0]] = n
+	}
+
+	return r, nil
+}
+
 // JobExecutor polls a single JobQueue and handle each Job.
 type JobExecutor struct {
 	parentId       string // controller short id
 	cluster, topic string
 	mc             *mysql.MysqlCluster
 	stopper        <-chan struct{}
-	dueJobs        chan job.JobItem
+	dueJobs        *dueQueue
 	auditor        log.Logger
 
 	// cached values
@@ -43,14 +80,22 @@ func NewJobExecutor(parentId, cluster, topic string, mc *mysql.MysqlCluster,
 		topic:    topic,
 		mc:       mc,
 		stopper:  stopper,
-		dueJobs:  make(chan job.JobItem, 200),
+		dueJobs:  newDueQueue(),
 		auditor:  auditor,
 	}
 
 	return this
 }
 
-// poll mysql for due jobs and send to kafka.
+func (this *JobExecutor) concurrency() int {
+	if n, present := TopicFiringConcurrency[this.topic]; present {
+		return n
+	}
+
+	return FiringConcurrency
+}
+
+// poll mysql for due jobs and send to kafka, higher priority first.
 func (this *JobExecutor) Run() {
 	this.appid = manager.Default.TopicAppid(this.topic)
 	if this.appid == "" {
@@ -67,10 +112,14 @@ func (this *JobExecutor) Run() {
 		wg   sync.WaitGroup
 		item job.JobItem
 		tick = time.NewTicker(time.Second)
-		sql  = fmt.Sprintf("SELECT job_id,payload,ctime,due_time FROM %s WHERE due_time<=?", this.table)
+		sql  = fmt.Sprintf("SELECT job_id,payload,ctime,due_time,priority FROM %s WHERE due_time<=? ORDER BY priority DESC,due_time ASC LIMIT %d",
+			this.table, DueJobsBatch)
+		concurrency = this.concurrency()
 	)
 
-	for i := 0; i < HandlerConcurrentN; i++ {
+	log.Trace("%s firing concurrency %d", this.ident, concurrency)
+
+	for i := 0; i < concurrency; i++ {
 		wg.Add(1)
 		go this.handleDueJobs(&wg)
 	}
@@ -79,10 +128,17 @@ func (this *JobExecutor) Run() {
 		select {
 		case <-this.stopper:
 			log.Debug("%s stopping", this.ident)
+			this.dueJobs.close()
 			wg.Wait()
 			return
 
 		case now := <-tick.C:
+			if this.dueJobs.len() >= DueJobsBatch {
+				// handlers are too slow, the queued jobs are enough
+				log.Warn("%s %d jobs queued", this.ident, this.dueJobs.len())
+				continue
+			}
+
 			rows, err := this.mc.Query(jm.AppPool, this.topic, this.aid, sql, now.Unix())
 			if err != nil {
 				log.Error("%s: %v", this.ident, err)
@@ -90,14 +146,18 @@ func (this *JobExecutor) Run() {
 			}
 
 			for rows.Next() {
-				err = rows.Scan(&item.JobId, &item.Payload, &item.Ctime, &item.DueTime)
+				item = job.JobItem{}
+				err = rows.Scan(&item.JobId, &item.Payload, &item.Ctime, &item.DueTime, &item.Priority)
 				if err == nil {
+					if !this.dueJobs.push(item) {
+						// still being fired
+						continue
+					}
+
 					log.Debug("%s due %s", this.ident, item)
 					if lag := now.Unix() - item.DueTime; lag > LagWarnThreshold {
 						log.Warn("%s lag %ds %s", this.ident, lag, item)
 					}
-
-					this.dueJobs <- item
 				} else {
 					log.Error("%s: %s", this.ident, err)
 				}
@@ -124,53 +184,54 @@ func (this *JobExecutor) handleDueJobs(wg *sync.WaitGroup) {
 
 		sqlInsertArchive = fmt.Sprintf("INSERT INTO %s(job_id,payload,ctime,due_time,etime,actor_id) VALUES(?,?,?,?,?,?)",
 			jm.HistoryTable(this.topic))
-		sqlReinject = fmt.Sprintf("INSERT INTO %s(job_id, payload, ctime, due_time) VALUES(?,?,?,?)", this.table)
+		sqlReinject = fmt.Sprintf("INSERT INTO %s(job_id, payload, ctime, due_time, priority) VALUES(?,?,?,?,?)", this.table)
 	)
 	for {
-		select {
-		case <-this.stopper:
+		item, ok := this.dueJobs.pop()
+		if !ok {
 			return
+		}
 
-		case item := <-this.dueJobs:
-			now := time.Now()
-			affectedRows, _, err := this.mc.Exec(jm.AppPool, this.table, this.aid, sqlDeleteJob, item.JobId)
-			if err != nil {
-				log.Error("%s: %s", this.ident, err)
-				continue
-			}
-			if affectedRows == 0 {
-				// 2 possibilities:
-				// - client Cancel job wins
-				// - this handler is too slow and the job fetched twice in tick
-				continue
-			}
+		this.fire(item, sqlDeleteJob, sqlInsertArchive, sqlReinject)
+		this.dueJobs.done(item)
+	}
+}
 
-			log.Debug("%s land %s", this.ident, item)
-			_, _, err = store.DefaultPubStore.SyncPub(this.cluster, this.topic, nil, item.Payload)
-			if err != nil {
-				err = hh.Default.Append(this.cluster, this.topic, nil, item.Payload)
-			}
-			if err != nil {
-				// pub fails and hinted handoff also fails: reinject job back to mysql
-				log.Error("%s: %s", this.ident, err)
-				this.mc.Exec(jm.AppPool, this.table, this.aid, sqlReinject,
-					item.JobId, item.Payload, item.Ctime, item.DueTime)
-				continue
-			}
+func (this *JobExecutor) fire(item job.JobItem, sqlDeleteJob, sqlInsertArchive, sqlReinject string) {
+	now := time.Now()
+	affectedRows, _, err := this.mc.Exec(jm.AppPool, this.table, this.aid, sqlDeleteJob, item.JobId)
+	if err != nil {
+		log.Error("%s: %s", this.ident, err)
+		return
+	}
+	if affectedRows == 0 {
+		// client Cancel job wins
+		return
+	}
 
-			log.Debug("%s fired %s", this.ident, item)
-			this.auditor.Trace(item.String())
+	log.Debug("%s land %s", this.ident, item)
+	_, _, err = store.DefaultPubStore.SyncPub(this.cluster, this.topic, nil, item.Payload)
+	if err != nil {
+		err = hh.Default.Append(this.cluster, this.topic, nil, item.Payload)
+	}
+	if err != nil {
+		// pub fails and hinted handoff also fails: reinject job back to mysql
+		log.Error("%s: %s", this.ident, err)
+		this.mc.Exec(jm.AppPool, this.table, this.aid, sqlReinject,
+			item.JobId, item.Payload, item.Ctime, item.DueTime, item.Priority)
+		return
+	}
 
-			// mv job to archive table
-			_, _, err = this.mc.Exec(jm.AppPool, this.table, this.aid, sqlInsertArchive,
-				item.JobId, item.Payload, item.Ctime, item.DueTime, now.Unix(), this.parentId)
-			if err != nil {
-				log.Error("%s: %s", this.ident, err)
-			} else {
-				log.Debug("%s archived %s", this.ident, item)
-			}
+	log.Debug("%s fired %s", this.ident, item)
+	this.auditor.Trace(item.String())
 
-		}
+	// mv job to archive table
+	_, _, err = this.mc.Exec(jm.AppPool, this.table, this.aid, sqlInsertArchive,
+		item.JobId, item.Payload, item.Ctime, item.DueTime, now.Unix(), this.parentId)
+	if err != nil {
+		log.Error("%s: %s", this.ident, err)
+	} else {
+		log.Debug("%s archived %s", this.ident, item)
 	}
 }
 
@@ -13,9 +13,13 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/funkygao/gafka"
 	"github.com/funkygao/gafka/cmd/kateway/gateway"
+	"github.com/funkygao/gafka/cmd/kateway/hh"
+	"github.com/funkygao/gafka/cmd/kateway/job"
 	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/cmd/kateway/meta"
+	"github.com/funkygao/gafka/cmd/kateway/store"
 	"github.com/funkygao/gafka/mpool"
+	"github.com/funkygao/gafka/sla"
 	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/golib/breaker"
 	"github.com/funkygao/kafka-cg/consumergroup"
@@ -30,6 +34,8 @@ type WebhookExecutor struct {
 	parentId       string // controller short id
 	cluster, topic string
 	endpoints      []string
+	retryChain     sla.RetryChain
+	stages         map[string]int // topic:stage of the retry chain
 	stopper        <-chan struct{}
 	auditor        log.Logger
 
@@ -41,18 +47,22 @@ type WebhookExecutor struct {
 	httpClient *http.Client // it has builtin pooling
 }
 
-func NewWebhookExecutor(parentId, cluster, topic string, endpoints []string,
+// NewWebhookExecutor creates a webhook executor, messages failed to push are dropped unless
+// it has a retry chain.
+func NewWebhookExecutor(parentId, cluster, topic string, endpoints []string, retryChain sla.RetryChain,
 	stopper <-chan struct{}, auditor log.Logger) *WebhookExecutor {
 	this := &WebhookExecutor{
-		parentId:  parentId,
-		cluster:   cluster,
-		topic:     topic,
-		stopper:   stopper,
-		endpoints: endpoints,
-		auditor:   auditor,
-		userAgent: fmt.Sprintf("actor.%s", gafka.BuildId),
-		msgCh:     make(chan *sarama.ConsumerMessage, 20),
-		circuits:  make(map[string]*breaker.Consecutive, len(endpoints)),
+		parentId:   parentId,
+		cluster:    cluster,
+		topic:      topic,
+		stopper:    stopper,
+		endpoints:  endpoints,
+		retryChain: retryChain,
+		stages:     map[string]int{topic: 0},
+		auditor:    auditor,
+		userAgent:  fmt.Sprintf("actor.%s", gafka.BuildId),
+		msgCh:      make(chan *sarama.ConsumerMessage, 20),
+		circuits:   make(map[string]*breaker.Consecutive, len(endpoints)),
 		httpClient: &http.Client{
 			Timeout: time.Second * 4,
 			Transport: &http.Transport{
@@ -108,7 +118,18 @@ func (this *WebhookExecutor) Run() {
 	cf.Offsets.ProcessingTimeout = time.Second
 	cf.Offsets.ResetOffsets = false
 	cf.Offsets.Initial = sarama.OffsetOldest
-	cg, err := consumergroup.JoinConsumerGroup(groupName, []string{this.topic}, meta.Default.ZkAddrs(), cf)
+
+	if this.retryChain != nil && job.Default == nil {
+		log.Warn("%s retry chain %s disabled: no job store", this.topic, this.retryChain)
+		this.retryChain = nil
+	}
+	topics := []string{this.topic}
+	for i, t := range this.retryChain.Topics(this.topic) {
+		this.stages[t] = i + 1
+		topics = append(topics, t)
+	}
+
+	cg, err := consumergroup.JoinConsumerGroup(groupName, topics, meta.Default.ZkAddrs(), cf)
 	if err != nil {
 		log.Error("%s stopped: %s", this.topic, err)
 		return
@@ -149,8 +170,15 @@ func (this *WebhookExecutor) pump(wg *sync.WaitGroup) {
 			return
 
 		case msg := <-this.msgCh:
+			ok := true
 			for _, ep := range this.endpoints {
-				this.pushToEndpoint(msg, ep)
+				if !this.pushToEndpoint(msg, ep) {
+					ok = false
+				}
+			}
+
+			if !ok && this.retryChain != nil {
+				this.retry(msg)
 			}
 
 			this.fetcher.CommitUpto(msg)
@@ -159,6 +187,34 @@ func (this *WebhookExecutor) pump(wg *sync.WaitGroup) {
 
 }
 
+// retry moves a message failed to push to the next retry topic, or the dead topic after the
+// last one. All the endpoints are pushed again on retry.
+func (this *WebhookExecutor) retry(msg *sarama.ConsumerMessage) {
+	next, delay, dead := this.retryChain.Next(this.stages[msg.Topic])
+	topic := this.topic + "." + next
+
+	var err error
+	if !dead {
+		// the job subsystem fires it into the retry topic after delay
+		_, err = job.Default.Add(this.appid, topic, msg.Value, time.Now().Add(delay).Unix(), job.MinPriority)
+	}
+	if dead || err != nil {
+		if err != nil {
+			log.Error("%s %s/%d %d -> %s: %s, retry without delay", this.topic, msg.Topic, msg.Partition, msg.Offset, topic, err)
+		}
+
+		if _, _, err = store.DefaultPubStore.SyncPub(this.cluster, topic, msg.Key, msg.Value); err != nil {
+			err = hh.Default.Append(this.cluster, topic, msg.Key, msg.Value)
+		}
+	}
+	if err != nil {
+		log.Error("%s %s/%d %d -> %s: %s", this.topic, msg.Topic, msg.Partition, msg.Offset, topic, err)
+		return
+	}
+
+	log.Warn("%s %s/%d %d -> %s", this.topic, msg.Topic, msg.Partition, msg.Offset, topic)
+}
+
 func (this *WebhookExecutor) pushToEndpoint(msg *sarama.ConsumerMessage, uri string) (ok bool) {
 	log.Debug("%s sending[%s] %s", this.topic, uri, string(msg.Value))
 
@@ -0,0 +1,49 @@
+package command
+
+import (
+	"time"
+
+	zkr "github.com/funkygao/gafka/registry/zk"
+	log "github.com/funkygao/log4go"
+)
+
+// watchBackupZone keeps track of the kateway instances of a secondary zone.
+func (this *Start) watchBackupZone(zone string) {
+	reg := zkr.New(this.backupZkzones[zone])
+	for {
+		instances, instancesChange, err := reg.WatchInstances()
+		if err != nil {
+			log.Error("backup zone[%s] %s", zone, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		log.Info("backup zone[%s] %d instances", zone, len(instances))
+
+		this.backupMu.Lock()
+		this.backupInstances[zone] = instances
+		this.backupMu.Unlock()
+
+		select {
+		case this.backupChange <- struct{}{}:
+		default:
+			// main loop will see the latest instances anyway
+		}
+
+		select {
+		case <-this.quitCh:
+			return
+
+		case <-instancesChange:
+		}
+	}
+}
+
+func (this *Start) backupInstanceN() (n int) {
+	this.backupMu.RLock()
+	for _, instances := range this.backupInstances {
+		n += len(instances)
+	}
+	this.backupMu.RUnlock()
+	return
+}
@@ -6,5 +6,11 @@ const (
 	configFile     = ".haproxy.cf"
 	haproxyPidFile = "haproxy.pid"
 
+	keepalivedConfigFile = "keepalived.conf"
+	keepalivedPidFile    = "keepalived.pid"
+
 	dashboardPortHead = 10910
+
+	// HTTP header of Pub requests replayed by the mirror tee to the production backends
+	headerMirrored = "X-Mirrored"
 )
@@ -70,6 +70,7 @@ func (this *Deploy) Run(args []string) (exitCode int) {
 	this.Ui.Info(fmt.Sprintf("compile haproxy to %s/sbin: make TARGET=linux26 USE_ZLIB=yes", this.root))
 	this.Ui.Info(fmt.Sprintf("cp %s /etc/init.d/ehaproxy", initPath))
 	this.Ui.Info(fmt.Sprintf("chkconfig --add ehaproxy"))
+	this.Ui.Info("for VIP failover: yum install -y keepalived && ehaproxy keepalived -vip $vip")
 
 	this.configKernal()
 
@@ -19,6 +19,12 @@ type BackendServers struct {
 	ManPort     int
 	ForwardFor  bool
 
+	MirrorPercent int // percentage of Pub traffic mirrored to staging, 0 means off
+	MirrorPort    int // tee sidecar port
+
+	SubBalance string // haproxy balance algorithm of Sub
+	SubSticky  bool   // Sub requests of a consumer stick to the same kateway
+
 	Pub       []Backend
 	Sub       []Backend
 	Man       []Backend
@@ -43,10 +49,12 @@ func (this *BackendServers) sort() {
 }
 
 type Backend struct {
-	Name string
-	Addr string
-	Cpu  string
-	Port string
+	Name   string
+	Addr   string
+	Cpu    string
+	Port   string
+	Zone   string // empty for the local zone
+	Backup bool   // haproxy backup server
 }
 
 func (this *Start) createConfigFile(servers BackendServers) error {
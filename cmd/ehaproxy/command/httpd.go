@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/funkygao/gafka"
@@ -18,6 +20,8 @@ import (
 func (this *Start) runMonitorServer(addr string) {
 	http.HandleFunc("/v1/ver", this.versionHandler)
 	http.HandleFunc("/v1/status", this.statusHandler)
+	http.HandleFunc("/v1/health", this.healthHandler)
+	http.HandleFunc("/v1/backends", this.backendsHandler)
 
 	log.Info("status web server on %s ready", addr)
 	if err := http.ListenAndServe(addr, nil); err != nil {
@@ -149,6 +153,49 @@ func fetchDashboardStats(statsUri string) (v map[string]map[string]int64) {
 	return
 }
 
+// healthHandler is probed by keepalived health check: healthy only when haproxy is
+// running with kateway backends loaded, and the backends are not all gone.
+func (this *Start) healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Server", "ehaproxy")
+
+	if atomic.LoadInt32(&this.healthy) == 0 || this.backendsGoneTooLong() || !haproxyRunning() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("unhealthy"))
+		return
+	}
+
+	w.Write([]byte("ok"))
+}
+
+// backendsHandler shows the kateway backends of the current haproxy config.
+func (this *Start) backendsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf8")
+	w.Header().Set("Server", "ehaproxy")
+
+	log.Info("%s backends", r.RemoteAddr)
+
+	this.serversMu.RLock()
+	v := map[string]interface{}{
+		"generated": this.reloadedAt.Unix(),
+		"pub":       backendAddrs(this.lastServers.Pub),
+		"sub":       backendAddrs(this.lastServers.Sub),
+		"man":       backendAddrs(this.lastServers.Man),
+	}
+	this.serversMu.RUnlock()
+
+	b, _ := json.Marshal(v)
+	w.Write(b)
+}
+
+func backendAddrs(backends []Backend) []string {
+	r := make([]string, 0, len(backends))
+	for _, be := range backends {
+		r = append(r, be.Addr)
+	}
+	sort.Strings(r)
+	return r
+}
+
 func (this *Start) versionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf8")
 	w.Header().Set("Server", "ehaproxy")
@@ -0,0 +1,46 @@
+package command
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestHealthHandlerBackendsGone(t *testing.T) {
+	// haproxy running: the pid file points to ourselves
+	dir, err := ioutil.TempDir("", "ehaproxy")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	os.Chdir(dir)
+	assert.Equal(t, nil, ioutil.WriteFile(haproxyPidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644))
+
+	this := &Start{goneGrace: time.Millisecond * 50}
+	probe := func() int {
+		rec := httptest.NewRecorder()
+		this.healthHandler(rec, httptest.NewRequest("GET", "/v1/health", nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, probe()) // haproxy not loaded yet
+	atomic.StoreInt32(&this.healthy, 1)
+	assert.Equal(t, http.StatusOK, probe())
+
+	// all kateway gone: tolerated within grace period for zk flap
+	this.backendsGone()
+	assert.Equal(t, http.StatusOK, probe())
+	time.Sleep(time.Millisecond * 60)
+	this.backendsGone() // still gone, since the 1st time
+	assert.Equal(t, http.StatusServiceUnavailable, probe())
+
+	this.backendsBack()
+	assert.Equal(t, http.StatusOK, probe())
+}
@@ -0,0 +1,303 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/locking"
+	"github.com/funkygao/golib/signal"
+	log "github.com/funkygao/log4go"
+)
+
+// Keepalived configures and supervises keepalived(VRRP) alongside haproxy so that
+// the VIP floats to the standby ehaproxy once the active one loses its kateway backends.
+type Keepalived struct {
+	Ui  cli.Ui
+	Cmd string
+
+	root      string
+	bin       string
+	checkMode bool
+	dryrun    bool
+	httpAddr  string
+
+	VIP             string
+	Interface       string
+	State           string
+	Priority        int
+	VirtualRouterId int
+	AuthPass        string
+	NoPreempt       bool
+	CheckScript     string
+	CheckInterval   int
+	CheckTimeout    int
+	Fall, Rise      int
+
+	quitCh chan struct{}
+}
+
+func (this *Keepalived) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("keepalived", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.root, "p", defaultPrefix, "")
+	cmdFlags.StringVar(&this.bin, "bin", "/usr/sbin/keepalived", "")
+	cmdFlags.BoolVar(&this.checkMode, "check", false, "")
+	cmdFlags.BoolVar(&this.dryrun, "dryrun", false, "")
+	cmdFlags.StringVar(&this.httpAddr, "addr", "127.0.0.1:10894", "")
+	cmdFlags.StringVar(&this.VIP, "vip", "", "")
+	cmdFlags.StringVar(&this.Interface, "i", "eth0", "")
+	cmdFlags.StringVar(&this.State, "state", "BACKUP", "")
+	cmdFlags.IntVar(&this.Priority, "priority", 100, "")
+	cmdFlags.IntVar(&this.VirtualRouterId, "vrid", 51, "")
+	cmdFlags.StringVar(&this.AuthPass, "auth", "ehaproxy", "")
+	cmdFlags.BoolVar(&this.NoPreempt, "nopreempt", false, "")
+	cmdFlags.IntVar(&this.CheckInterval, "interval", 2, "")
+	cmdFlags.IntVar(&this.Fall, "fall", 3, "")
+	cmdFlags.IntVar(&this.Rise, "rise", 2, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if this.checkMode {
+		return this.healthCheck()
+	}
+
+	if err := this.validate(); err != nil {
+		this.Ui.Error(err.Error())
+		return 2
+	}
+
+	if err := this.createConfigFile(); err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	if this.dryrun {
+		b, err := ioutil.ReadFile(this.configFile())
+		swalllow(err)
+		this.Ui.Output(string(b))
+		return
+	}
+
+	lockFilename := fmt.Sprintf("%s/.keepalived.lock", this.root)
+	if locking.InstanceLocked(lockFilename) {
+		panic(fmt.Sprintf("locked[%s] by another instance", lockFilename))
+	}
+
+	locking.LockInstance(lockFilename)
+	defer locking.UnlockInstance(lockFilename)
+
+	this.supervise()
+
+	return
+}
+
+func (this *Keepalived) validate() error {
+	this.State = strings.ToUpper(this.State)
+	switch {
+	case this.VIP == "":
+		return fmt.Errorf("-vip required")
+
+	case this.State != "MASTER" && this.State != "BACKUP":
+		return fmt.Errorf("invalid -state: %s", this.State)
+
+	case this.NoPreempt && this.State != "BACKUP":
+		// keepalived ignores nopreempt unless the initial state is BACKUP
+		return fmt.Errorf("-nopreempt requires -state BACKUP")
+
+	case this.Priority < 1 || this.Priority > 254:
+		return fmt.Errorf("-priority must be within [1, 254]")
+
+	case this.VirtualRouterId < 1 || this.VirtualRouterId > 255:
+		return fmt.Errorf("-vrid must be within [1, 255]")
+
+	case len(this.AuthPass) > 8:
+		// VRRP PASS authentication uses only the first 8 chars
+		return fmt.Errorf("-auth at most 8 chars")
+	}
+
+	return nil
+}
+
+func (this *Keepalived) configFile() string {
+	return fmt.Sprintf("%s/%s", this.root, keepalivedConfigFile)
+}
+
+func (this *Keepalived) createConfigFile() error {
+	self, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return err
+	}
+	if self, err = filepath.Abs(self); err != nil {
+		return err
+	}
+
+	// vrrp_script is ehaproxy itself probing the monitor server of 'ehaproxy start'
+	this.CheckScript = fmt.Sprintf("%s keepalived -check -addr %s", self, this.httpAddr)
+	this.CheckTimeout = this.CheckInterval
+
+	tmpFile := fmt.Sprintf("%s.tmp", this.configFile())
+	cfgFile, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+	defer cfgFile.Close()
+
+	b, _ := Asset("templates/keepalived.tpl")
+	t := template.Must(template.New("keepalived").Parse(string(b)))
+	if err = t.Execute(cfgFile, this); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, this.configFile())
+}
+
+// healthCheck is invoked by keepalived vrrp_script, exit code 0 means healthy.
+func (this *Keepalived) healthCheck() (exitCode int) {
+	client := http.Client{Timeout: time.Second * 2}
+	resp, err := client.Get(fmt.Sprintf("http://%s/v1/health", this.httpAddr))
+	if err != nil {
+		return 1
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 1
+	}
+
+	return 0
+}
+
+// supervise runs keepalived in foreground and restarts it on unexpected exit.
+func (this *Keepalived) supervise() {
+	this.quitCh = make(chan struct{})
+
+	var proc *os.Process
+	signal.RegisterHandler(func(sig os.Signal) {
+		log.Info("keepalived supervisor got signal: %s", strings.ToUpper(sig.String()))
+		close(this.quitCh)
+
+		if proc != nil {
+			// keepalived releases the VIP on SIGTERM so that the peer takes over at once
+			proc.Signal(syscall.SIGTERM)
+		}
+	}, syscall.SIGINT, syscall.SIGTERM)
+
+	backoff := time.Second
+	for {
+		cmd := exec.Command(this.bin, "-n", "-l", "-D",
+			"-f", this.configFile(),
+			"-p", fmt.Sprintf("%s/%s", this.root, keepalivedPidFile))
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		log.Info("keepalived starting: %s %s", this.VIP, this.State)
+		t0 := time.Now()
+		if err := cmd.Start(); err != nil {
+			log.Error("keepalived: %v", err)
+		} else {
+			proc = cmd.Process
+			if err = cmd.Wait(); err != nil {
+				log.Error("keepalived: %v", err)
+			}
+		}
+
+		select {
+		case <-this.quitCh:
+			log.Info("keepalived supervisor bye!")
+			return
+		default:
+		}
+
+		if time.Since(t0) > time.Minute {
+			// it ran long enough, reset backoff
+			backoff = time.Second
+		}
+
+		log.Warn("keepalived exited, restarting in %s", backoff)
+		select {
+		case <-this.quitCh:
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+func (this *Keepalived) Synopsis() string {
+	return "Supervise keepalived for VIP failover of active-standby ehaproxy"
+}
+
+func (this *Keepalived) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s keepalived [options]
+
+    %s
+
+    Runs alongside '%s start' on each load balancer host. The VRRP health check
+    is '%s keepalived -check', which is healthy only when local haproxy is
+    running with kateway backends, so the VIP moves to the standby host otherwise.
+
+Options:
+
+    -vip ip
+      Required. Virtual IP shared by active and standby ehaproxy.
+
+    -i interface
+      Network interface the VIP binds to. Default eth0.
+
+    -state MASTER|BACKUP
+      Initial VRRP state. Default BACKUP.
+
+    -priority n
+      VRRP priority, higher wins. Default 100.
+
+    -vrid id
+      Virtual router id, must be unique within the network segment. Default 51.
+
+    -auth password
+      VRRP authentication password, at most 8 chars.
+
+    -nopreempt
+      A recovered host will not grab the VIP back, requires -state BACKUP.
+
+    -interval seconds
+      Health check interval. Default 2.
+
+    -fall n
+      Consecutive failed checks before the host goes FAULT. Default 3.
+
+    -rise n
+      Consecutive successful checks before the host is healthy. Default 2.
+
+    -addr host:port
+      Monitor http server of '%s start'. Default 127.0.0.1:10894.
+
+    -bin path
+      Path of keepalived. Default /usr/sbin/keepalived.
+
+    -p directory prefix
+      Default %s
+
+    -dryrun
+      Generate and display keepalived config without starting keepalived.
+
+    -check
+      Run the health check once, used by keepalived vrrp_script.
+
+`, this.Cmd, this.Synopsis(), this.Cmd, this.Cmd, this.Cmd, defaultPrefix)
+	return strings.TrimSpace(help)
+}
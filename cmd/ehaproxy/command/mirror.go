@@ -0,0 +1,171 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/funkygao/go-metrics"
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	mirrorMaxBody  = 1 << 20 // larger Pub body will not be mirrored
+	mirrorQueueLen = 10000
+	mirrorWorkers  = 8
+)
+
+type mirrorRequest struct {
+	method string
+	uri    string
+	header http.Header
+	body   []byte
+}
+
+// pubMirror is the tee sidecar between haproxy and kateway for the sampled Pub requests.
+//
+// Each sampled request is replayed synchronously to the production kateway through
+// haproxy with X-Mirrored header, and its copy is sent fire-and-forget to the staging
+// kateway. Staging kateway never affects the production response.
+type pubMirror struct {
+	ctx *Start
+
+	staging string // staging kateway pub addr
+	prod    string // haproxy pub addr
+
+	queue  chan mirrorRequest
+	client *http.Client // to production
+	async  *http.Client // to staging
+
+	okN, failN, dropN metrics.Counter
+}
+
+func newPubMirror(ctx *Start) *pubMirror {
+	return &pubMirror{
+		ctx:     ctx,
+		staging: ctx.mirrorAddr,
+		prod:    fmt.Sprintf("127.0.0.1:%d", ctx.pubPort),
+		queue:   make(chan mirrorRequest, mirrorQueueLen),
+		client: &http.Client{
+			Timeout: time.Minute,
+		},
+		async: &http.Client{
+			Timeout: time.Second * 2,
+		},
+		okN:   metrics.NewRegisteredCounter("mirror.ok", metrics.DefaultRegistry),
+		failN: metrics.NewRegisteredCounter("mirror.fail", metrics.DefaultRegistry),
+		dropN: metrics.NewRegisteredCounter("mirror.drop", metrics.DefaultRegistry),
+	}
+}
+
+func (this *pubMirror) start(port int) {
+	for i := 0; i < mirrorWorkers; i++ {
+		go this.pump()
+	}
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	log.Info("pub mirror on %s -> %s %d%%", addr, this.staging, this.ctx.mirrorPercent)
+	if err := http.ListenAndServe(addr, this); err != nil {
+		log.Error("pub mirror: %s", err)
+	}
+}
+
+func (this *pubMirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, mirrorMaxBody+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mirrorable := len(body) <= mirrorMaxBody
+	if !mirrorable {
+		// too large to hold in memory, stream the rest to production
+		this.dropN.Inc(1)
+	}
+
+	req, err := http.NewRequest(r.Method, "http://"+this.prod+r.RequestURI,
+		io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Header = cloneHeader(r.Header)
+	req.Header.Set(headerMirrored, "1")
+	req.ContentLength = r.ContentLength
+	req.Host = r.Host
+
+	resp, err := this.client.Do(req)
+	if err != nil {
+		log.Error("pub mirror prod %s: %v", r.RequestURI, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+
+	if !mirrorable {
+		return
+	}
+
+	select {
+	case this.queue <- mirrorRequest{method: r.Method, uri: r.RequestURI, header: req.Header, body: body}:
+	default:
+		// staging too slow, never block production
+		this.dropN.Inc(1)
+	}
+}
+
+func (this *pubMirror) pump() {
+	for {
+		select {
+		case <-this.ctx.quitCh:
+			return
+
+		case mr := <-this.queue:
+			this.send(mr)
+		}
+	}
+}
+
+func (this *pubMirror) send(mr mirrorRequest) {
+	req, err := http.NewRequest(mr.method, "http://"+this.staging+mr.uri, bytes.NewReader(mr.body))
+	if err != nil {
+		this.failN.Inc(1)
+		return
+	}
+	req.Header = mr.header
+
+	resp, err := this.async.Do(req)
+	if err != nil {
+		log.Debug("pub mirror staging %s: %v", mr.uri, err)
+		this.failN.Inc(1)
+		return
+	}
+
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		this.failN.Inc(1)
+	} else {
+		this.okN.Inc(1)
+	}
+}
+
+func cloneHeader(h http.Header) http.Header {
+	r := make(http.Header, len(h))
+	for k, vs := range h {
+		r[k] = append([]string(nil), vs...)
+	}
+	return r
+}
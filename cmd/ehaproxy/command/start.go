@@ -10,6 +10,8 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -47,13 +49,34 @@ type Start struct {
 	forwardFor bool
 	httpAddr   string
 
+	mirrorAddr    string
+	mirrorPercent int
+	mirrorPort    int
+
+	subSticky  string
+	subBalance string
+
+	// kateway of secondary zones as backup backends for cross-DC failover
+	backupZones     []string
+	backupWeight    int // 0 means haproxy backup servers, used only when all local backends are down
+	backupMu        sync.RWMutex
+	backupZkzones   map[string]*zk.ZkZone
+	backupInstances map[string][]string // zone: kateway instances
+	backupChange    chan struct{}
+
 	haproxyStatsUrl string
 	influxdbAddr    string
 	influxdbDbName  string
 
 	quitCh, closed chan struct{}
 	zkzone         *zk.ZkZone
-	lastServers    BackendServers
+	healthy        int32 // 1 after haproxy loaded with kateway backends
+	backendsGoneAt int64 // unix nano since when all local and backup kateway are gone, 0 if any alive
+	goneGrace      time.Duration
+
+	serversMu   sync.RWMutex
+	lastServers BackendServers
+	reloadedAt  time.Time // when haproxy config generated and reloaded
 }
 
 func (this *Start) Run(args []string) (exitCode int) {
@@ -71,10 +94,46 @@ func (this *Start) Run(args []string) (exitCode int) {
 	cmdFlags.StringVar(&this.influxdbAddr, "influxaddr", "", "")
 	cmdFlags.StringVar(&this.influxdbDbName, "influxdb", "", "")
 	cmdFlags.StringVar(&this.httpAddr, "addr", ":10894", "monitor http server addr")
+	cmdFlags.StringVar(&this.mirrorAddr, "mirror", "", "")
+	cmdFlags.IntVar(&this.mirrorPercent, "mirrorpct", 0, "")
+	cmdFlags.IntVar(&this.mirrorPort, "mirrorport", 10895, "")
+	backupZones := cmdFlags.String("backup", "", "")
+	cmdFlags.IntVar(&this.backupWeight, "backupweight", 0, "")
+	cmdFlags.StringVar(&this.subSticky, "substicky", "", "")
+	cmdFlags.DurationVar(&this.goneGrace, "gonegrace", time.Second*30, "")
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
+	if *backupZones != "" {
+		for _, zone := range strings.Split(*backupZones, ",") {
+			if zone == this.zone {
+				this.Ui.Error(fmt.Sprintf("-backup %s is the local zone", zone))
+				return 2
+			}
+
+			this.backupZones = append(this.backupZones, zone)
+		}
+	}
+	if this.backupWeight < 0 || this.backupWeight > 256 {
+		this.Ui.Error("-backupweight must be within [0, 256]")
+		return 2
+	}
+
+	var err error
+	if this.subBalance, err = subBalance(this.subSticky); err != nil {
+		this.Ui.Error(err.Error())
+		return 2
+	}
+
+	if this.mirrorPercent < 0 || this.mirrorPercent > 100 {
+		this.Ui.Error("-mirrorpct must be within [0, 100]")
+		return 2
+	}
+	if this.mirrorAddr == "" {
+		this.mirrorPercent = 0
+	}
+
 	lockFilename := fmt.Sprintf("%s/.lock", this.root)
 	if locking.InstanceLocked(lockFilename) {
 		panic(fmt.Sprintf("locked[%s] by another instance", lockFilename))
@@ -82,7 +141,7 @@ func (this *Start) Run(args []string) (exitCode int) {
 
 	locking.LockInstance(lockFilename)
 
-	err := os.Chdir(this.root)
+	err = os.Chdir(this.root)
 	swalllow(err)
 
 	this.command = fmt.Sprintf("%s/sbin/haproxy", this.root)
@@ -162,6 +221,17 @@ func (this *Start) main() {
 
 	log.Info("ehaproxy[%s] starting...", gafka.BuildId)
 	go this.runMonitorServer(this.httpAddr)
+	if this.mirrorPercent > 0 {
+		go newPubMirror(this).start(this.mirrorPort)
+	}
+
+	this.backupZkzones = make(map[string]*zk.ZkZone, len(this.backupZones))
+	this.backupInstances = make(map[string][]string, len(this.backupZones))
+	this.backupChange = make(chan struct{}, 1)
+	for _, zone := range this.backupZones {
+		this.backupZkzones[zone] = zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
+		go this.watchBackupZone(zone)
+	}
 
 	zkConnected := false
 	for {
@@ -175,9 +245,14 @@ func (this *Start) main() {
 		if zkConnected {
 			if len(instances) > 0 {
 				this.reload(instances)
+			} else if this.backupInstanceN() > 0 {
+				// all local kateway gone, fail over to the secondary zones
+				log.Warn("backend all shutdown, fail over to backup zones %+v", this.backupZones)
+				this.reload(instances)
 			} else {
 				// resilience to zk problem by local cache
 				log.Warn("backend all shutdown? skip this change")
+				this.backendsGone()
 				time.Sleep(time.Second)
 				continue
 			}
@@ -197,6 +272,9 @@ func (this *Start) main() {
 
 		case <-instancesChange:
 			log.Info("instances changed!!")
+
+		case <-this.backupChange:
+			log.Info("backup instances changed!!")
 		}
 	}
 
@@ -210,10 +288,68 @@ func (this *Start) reload(kwInstances []string) {
 		PubPort:     this.pubPort,
 		SubPort:     this.subPort,
 		ManPort:     this.manPort,
+
+		MirrorPercent: this.mirrorPercent,
+		MirrorPort:    this.mirrorPort,
+
+		SubBalance: this.subBalance,
+		SubSticky:  this.subSticky != "",
 	}
 	servers.reset()
+	this.addBackends(&servers, this.zkzone, kwInstances, "")
+
+	this.backupMu.RLock()
+	for _, zone := range this.backupZones {
+		this.addBackends(&servers, this.backupZkzones[zone], this.backupInstances[zone], zone)
+	}
+	this.backupMu.RUnlock()
+
+	for i := 0; i < ctx.NumCPU(); i++ {
+		servers.Dashboard = append(servers.Dashboard, Backend{
+			Port: fmt.Sprintf("%d", dashboardPortHead+i),
+			Name: fmt.Sprintf("%d", i+1), // process id starts from 1
+		})
+	}
+
+	if servers.empty() {
+		log.Warn("empty backend servers, all shutdown?")
+		this.backendsGone()
+		return
+	}
+	this.backendsBack()
+
+	this.serversMu.RLock()
+	unchanged := reflect.DeepEqual(this.lastServers, servers)
+	this.serversMu.RUnlock()
+	if unchanged {
+		log.Warn("backend servers stays unchanged")
+		return
+	}
+
+	this.serversMu.Lock()
+	this.lastServers = servers
+	this.serversMu.Unlock()
+	if err := this.createConfigFile(servers); err != nil {
+		log.Error(err)
+		return
+	}
+
+	if err := this.reloadHAproxy(); err != nil {
+		log.Error("reloading haproxy: %v", err)
+		panic(err)
+	}
+
+	this.serversMu.Lock()
+	this.reloadedAt = time.Now()
+	this.serversMu.Unlock()
+
+	atomic.StoreInt32(&this.healthy, 1)
+}
+
+// addBackends adds the kateway instances of a zone to servers, zone is empty for the local zone.
+func (this *Start) addBackends(servers *BackendServers, zkzone *zk.ZkZone, kwInstances []string, zone string) {
 	for _, kwNode := range kwInstances {
-		data, _, err := this.zkzone.Conn().Get(kwNode)
+		data, _, err := zkzone.Conn().Get(kwNode)
 		if err != nil {
 			log.Error("%s: %v", kwNode, err)
 			continue
@@ -234,7 +370,7 @@ func (this *Start) reload(kwInstances []string) {
 				Cpu:  info["cpu"],
 				Port: port,
 			}
-			servers.Pub = append(servers.Pub, be)
+			servers.Pub = append(servers.Pub, backupBackend(be, zone, this.backupWeight))
 		}
 
 		// sub
@@ -246,7 +382,7 @@ func (this *Start) reload(kwInstances []string) {
 				Cpu:  info["cpu"],
 				Port: port,
 			}
-			servers.Sub = append(servers.Sub, be)
+			servers.Sub = append(servers.Sub, backupBackend(be, zone, this.backupWeight))
 		}
 
 		// man
@@ -258,40 +394,33 @@ func (this *Start) reload(kwInstances []string) {
 				Cpu:  info["cpu"],
 				Port: port,
 			}
-			servers.Man = append(servers.Man, be)
+			servers.Man = append(servers.Man, backupBackend(be, zone, this.backupWeight))
 		}
 	}
 
-	for i := 0; i < ctx.NumCPU(); i++ {
-		servers.Dashboard = append(servers.Dashboard, Backend{
-			Port: fmt.Sprintf("%d", dashboardPortHead+i),
-			Name: fmt.Sprintf("%d", i+1), // process id starts from 1
-		})
-	}
-
-	if servers.empty() {
-		log.Warn("empty backend servers, all shutdown?")
-		return
-	}
+}
 
-	if reflect.DeepEqual(this.lastServers, servers) {
-		log.Warn("backend servers stays unchanged")
-		return
-	}
+// backendsGone marks that all local and backup kateway are gone. haproxy is kept running with
+// the last config for resilience to zk flap, but keepalived is told unhealthy after goneGrace
+// so that the VIP moves to a healthy ehaproxy.
+func (this *Start) backendsGone() {
+	atomic.CompareAndSwapInt64(&this.backendsGoneAt, 0, time.Now().UnixNano())
+}
 
-	this.lastServers = servers
-	if err := this.createConfigFile(servers); err != nil {
-		log.Error(err)
-		return
-	}
+func (this *Start) backendsBack() {
+	atomic.StoreInt64(&this.backendsGoneAt, 0)
+}
 
-	if err := this.reloadHAproxy(); err != nil {
-		log.Error("reloading haproxy: %v", err)
-		panic(err)
-	}
+// backendsGoneTooLong returns true if all kateway are gone longer than goneGrace.
+func (this *Start) backendsGoneTooLong() bool {
+	goneAt := atomic.LoadInt64(&this.backendsGoneAt)
+	return goneAt > 0 && time.Since(time.Unix(0, goneAt)) > this.goneGrace
 }
 
 func (this *Start) shutdown() {
+	// let keepalived failover VIP asap
+	atomic.StoreInt32(&this.healthy, 0)
+
 	// kill haproxy
 	log.Info("killling haproxy processes")
 
@@ -353,6 +482,40 @@ Options:
       Default false.
       If true, haproxy will add X-Forwarded-For http header.
 
+    -mirror staging kateway pub addr
+      e,g. 10.1.1.1:9191
+      Mirror sampled Pub traffic to the staging kateway to validate new release.
+      Staging responses are discarded and never affect production.
+
+    -mirrorpct percent
+      Default 0, within [0, 100].
+      Percentage of Pub requests to mirror.
+
+    -mirrorport port
+      Default 10895.
+      Local port of the mirror tee sidecar.
+
+    -backup zones
+      Comma separated secondary zones, e,g. sit,prod2
+      Kateway of these zones are added as haproxy backup servers, so that traffic
+      fails over across DC if all local kateway are down.
+
+    -backupweight weight
+      Default 0, within [0, 256].
+      If positive, kateway of the backup zones are active servers of this weight
+      instead of backup servers.
+
+    -substicky appid|group|hdr:<header>
+      Default empty, Sub is balanced by client source ip.
+      Sub requests of the same appid, consumer group or header value are routed
+      to the same kateway to improve prefetch cache hit rate and reduce rebalance.
+      Clients without the header or group are balanced in round robin.
+
+    -gonegrace duration
+      Default 30s.
+      Health check fails if all local and backup kateway are gone longer than this,
+      so that keepalived moves the VIP.
+
     -pub pub server listen port
 
     -sub sub server listen port
@@ -55,25 +55,41 @@ listen 127.0.0.1:{{.Port}}
 
 listen pub
     bind 0.0.0.0:{{.PubPort}}
+    # only route to kateway ready to serve, see kateway /ready
+    option httpchk GET /ready
     balance source
     #cookie PUB insert indirect # indirect means not sending cookie to backend
+{{if .MirrorPercent}}
+    # sampled Pub goes through the tee sidecar, which replays it here with X-Mirrored
+    use_backend pub_mirror if { rand(100) lt {{.MirrorPercent}} } !{ req.hdr(X-Mirrored) -m found }
+{{end}}
 {{range .Pub}}
-    server {{.Name}} {{.Addr}} weight {{.Cpu}}
+    server {{.Name}} {{.Addr}} weight {{.Cpu}} check{{if .Backup}} backup{{end}}
+{{end}}
+
+{{if .MirrorPercent}}
+backend pub_mirror
+    server tee 127.0.0.1:{{.MirrorPort}}
 {{end}}
 
 listen sub
     bind 0.0.0.0:{{.SubPort}}
-    balance source
-    #balance source # uri
+    # only route to kateway ready to serve, see kateway /ready
+    option httpchk GET /ready
+    balance {{.SubBalance}}
+{{if .SubSticky}}
+    # consistent hashing keeps most consumers on the same kateway when backends change
+    hash-type consistent
+{{end}}
     #compression algo gzip
     #compression type text/html text/plain application/json
     #cookie SUB insert indirect
 {{range .Sub}}
-    server {{.Name}} {{.Addr}} weight {{.Cpu}}
+    server {{.Name}} {{.Addr}} weight {{.Cpu}} check{{if .Backup}} backup{{end}}
 {{end}}
 
 listen man
     bind 0.0.0.0:{{.ManPort}}
 {{range .Man}}
-    server {{.Name}} {{.Addr}} weight {{.Cpu}}
+    server {{.Name}} {{.Addr}} weight {{.Cpu}}{{if .Backup}} backup{{end}}
 {{end}}
@@ -1,7 +1,15 @@
 package command
 
 import (
+	"bufio"
+	"fmt"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	gio "github.com/funkygao/golib/io"
 )
 
 func swalllow(err error) {
@@ -26,3 +34,72 @@ func sortBackendByName(all []Backend) []Backend {
 
 	return r
 }
+
+// backupBackend makes be a backend of the secondary zone: a haproxy backup server if
+// weight is 0, else an active server with the given low weight.
+func backupBackend(be Backend, zone string, weight int) Backend {
+	if zone == "" {
+		// local zone
+		return be
+	}
+
+	be.Name = be.Name + "-" + zone // kateway id is unique only within a zone
+	be.Zone = zone
+	if weight == 0 {
+		be.Backup = true
+	} else {
+		be.Cpu = strconv.Itoa(weight)
+	}
+	return be
+}
+
+// subBalance returns the haproxy balance algorithm of Sub for the stickiness option:
+// requests of the same appid or consumer group hit the same kateway for better prefetch
+// cache hit rate and less rebalance churn.
+func subBalance(sticky string) (algo string, err error) {
+	switch {
+	case sticky == "":
+		return "source", nil
+
+	case sticky == "appid":
+		return "hdr(Appid)", nil
+
+	case sticky == "group":
+		return "url_param group", nil
+
+	case strings.HasPrefix(sticky, "hdr:"):
+		header := strings.TrimPrefix(sticky, "hdr:")
+		if header != "" && !strings.ContainsAny(header, " ()") {
+			return fmt.Sprintf("hdr(%s)", header), nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid stickiness: %s", sticky)
+}
+
+// haproxyRunning checks if any haproxy process in pid file is alive.
+func haproxyRunning() bool {
+	f, err := os.Open(haproxyPidFile)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		l, err := gio.ReadLine(reader)
+		if err != nil {
+			// EOF
+			return false
+		}
+
+		pid, err := strconv.Atoi(string(l))
+		if err != nil {
+			continue
+		}
+
+		if syscall.Kill(pid, 0) == nil {
+			return true
+		}
+	}
+}
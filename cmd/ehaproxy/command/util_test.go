@@ -19,3 +19,36 @@ func TestSortBackendByName(t *testing.T) {
 	assert.Equal(t, "p2", r[1].Name)
 	assert.Equal(t, "p3", r[2].Name)
 }
+
+func TestBackupBackend(t *testing.T) {
+	be := Backend{Name: "p1", Addr: "10.1.1.1:9191", Cpu: "24"}
+	assert.Equal(t, be, backupBackend(be, "", 0))
+
+	b := backupBackend(be, "sit", 0)
+	assert.Equal(t, "p1-sit", b.Name)
+	assert.Equal(t, true, b.Backup)
+	assert.Equal(t, "24", b.Cpu)
+
+	b = backupBackend(be, "sit", 1)
+	assert.Equal(t, false, b.Backup)
+	assert.Equal(t, "1", b.Cpu)
+}
+
+func TestSubBalance(t *testing.T) {
+	fixtures := map[string]string{
+		"":           "source",
+		"appid":      "hdr(Appid)",
+		"group":      "url_param group",
+		"hdr:X-Sess": "hdr(X-Sess)",
+	}
+	for sticky, expected := range fixtures {
+		algo, err := subBalance(sticky)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, expected, algo)
+	}
+
+	for _, sticky := range []string{"ip", "hdr:", "hdr:X (a)"} {
+		_, err := subBalance(sticky)
+		assert.NotEqual(t, nil, err)
+	}
+}
@@ -37,6 +37,13 @@ func init() {
 			}, nil
 		},
 
+		"keepalived": func() (cli.Command, error) {
+			return &command.Keepalived{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"start": func() (cli.Command, error) {
 			return &command.Start{
 				Ui:  ui,
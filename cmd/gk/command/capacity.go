@@ -0,0 +1,305 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/funkygao/golib/gofmt"
+	"github.com/ryanuber/columnize"
+)
+
+type Capacity struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone, cluster string
+	addBrokers    int
+	growth        float64 // monthly traffic growth ratio
+	msgSize       int64   // avg message size in bytes
+	diskCapacity  int64   // per broker disk capacity in bytes
+	maxReplicas   int     // per broker partition replicas capacity
+	threshold     float64
+}
+
+// brokerLoad is the current load of a broker.
+type brokerLoad struct {
+	id       int32
+	host     string
+	replicas int
+	leaders  int
+	msgs     int64 // messages in stock of all hosted replicas
+}
+
+func (this *Capacity) Run(args []string) (exitCode int) {
+	var growth, threshold string
+	var diskGB int64
+	cmdFlags := flag.NewFlagSet("capacity", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.IntVar(&this.addBrokers, "add-broker", 0, "")
+	cmdFlags.StringVar(&growth, "growth", "0%", "")
+	cmdFlags.Int64Var(&this.msgSize, "msgsize", 1024, "")
+	cmdFlags.Int64Var(&diskGB, "disk", 4000, "")
+	cmdFlags.IntVar(&this.maxReplicas, "maxreplicas", 4000, "")
+	cmdFlags.StringVar(&threshold, "threshold", "80%", "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-c").
+		invalid(args) {
+		return 2
+	}
+
+	var err error
+	if this.growth, err = parsePercent(growth); err != nil {
+		this.Ui.Error(fmt.Sprintf("-growth: %v", err))
+		return 2
+	}
+	if this.threshold, err = parsePercent(threshold); err != nil || this.threshold <= 0 {
+		this.Ui.Error(fmt.Sprintf("-threshold: invalid %s", threshold))
+		return 2
+	}
+	if this.addBrokers < 0 || this.msgSize < 1 || diskGB < 1 || this.maxReplicas < 1 {
+		this.Ui.Error("-add-broker -msgsize -disk -maxreplicas must be positive")
+		return 2
+	}
+	this.diskCapacity = diskGB << 30
+
+	ensureZoneValid(this.zone)
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	defer zkzone.Close()
+
+	loads, err := this.collectLoads(zkzone.NewCluster(this.cluster))
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	this.displayCurrent(loads)
+	this.displayProjection(loads)
+	return
+}
+
+func (this *Capacity) collectLoads(zkcluster *zk.ZkCluster) ([]*brokerLoad, error) {
+	brokers := zkcluster.Brokers()
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("cluster[%s] has no live brokers", zkcluster.Name())
+	}
+
+	loads := make(map[int32]*brokerLoad, len(brokers))
+	for id, broker := range brokers {
+		brokerId, _ := strconv.Atoi(id)
+		loads[int32(brokerId)] = &brokerLoad{id: int32(brokerId), host: broker.Host}
+	}
+
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), sarama.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer kfk.Close()
+
+	topics, err := kfk.Topics()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, topic := range topics {
+		partitions, err := kfk.Partitions(topic)
+		if err != nil {
+			this.Ui.Warn(fmt.Sprintf("%s: %v", topic, err))
+			continue
+		}
+
+		for _, partitionId := range partitions {
+			latestOffset, err := kfk.GetOffset(topic, partitionId, sarama.OffsetNewest)
+			if err != nil {
+				this.Ui.Warn(fmt.Sprintf("%s#%d: %v", topic, partitionId, err))
+				continue
+			}
+			oldestOffset, err := kfk.GetOffset(topic, partitionId, sarama.OffsetOldest)
+			if err != nil {
+				this.Ui.Warn(fmt.Sprintf("%s#%d: %v", topic, partitionId, err))
+				continue
+			}
+
+			replicas, _ := kfk.Replicas(topic, partitionId)
+			for _, replica := range replicas {
+				if load, present := loads[replica]; present {
+					load.replicas++
+					load.msgs += latestOffset - oldestOffset
+				}
+			}
+
+			if leader, err := kfk.Leader(topic, partitionId); err == nil {
+				if load, present := loads[leader.ID()]; present {
+					load.leaders++
+				}
+			}
+		}
+	}
+
+	r := make([]*brokerLoad, 0, len(loads))
+	for _, load := range loads {
+		r = append(r, load)
+	}
+	sort.Sort(brokerLoads(r))
+	return r, nil
+}
+
+func (this *Capacity) diskUtil(msgs int64) float64 {
+	return float64(msgs*this.msgSize) / float64(this.diskCapacity)
+}
+
+func (this *Capacity) replicaUtil(replicas int) float64 {
+	return float64(replicas) / float64(this.maxReplicas)
+}
+
+func (this *Capacity) displayCurrent(loads []*brokerLoad) {
+	lines := []string{"Broker|Host|Replicas|Leaders|Msgs|Disk|Disk%|Replica%"}
+	for _, load := range loads {
+		lines = append(lines, fmt.Sprintf("%d|%s|%d|%d|%s|%s|%s|%s",
+			load.id, load.host, load.replicas, load.leaders,
+			gofmt.Comma(load.msgs), gofmt.ByteSize(load.msgs*this.msgSize),
+			this.colorUtil(this.diskUtil(load.msgs)), this.colorUtil(this.replicaUtil(load.replicas))))
+	}
+
+	this.Ui.Output(color.Blue("%s/%s current load, disk estimated with %dB/msg", this.zone, this.cluster, this.msgSize))
+	this.Ui.Output(columnize.SimpleFormat(lines))
+}
+
+func (this *Capacity) displayProjection(loads []*brokerLoad) {
+	var (
+		totalMsgs     int64
+		totalReplicas int
+		hottest       *brokerLoad
+	)
+	for _, load := range loads {
+		totalMsgs += load.msgs
+		totalReplicas += load.replicas
+		if hottest == nil || load.msgs > hottest.msgs {
+			hottest = load
+		}
+	}
+
+	// assume partitions are evenly spread across all brokers after reassignment
+	n := len(loads) + this.addBrokers
+	avgDisk := this.diskUtil(totalMsgs/int64(n)) * (1 + this.growth)
+	avgReplica := this.replicaUtil(totalReplicas / n)
+
+	this.Ui.Output("")
+	this.Ui.Output(color.Blue("projection: brokers %d+%d, traffic growth %.0f%%/month, threshold %.0f%%",
+		len(loads), this.addBrokers, this.growth*100, this.threshold*100))
+	lines := []string{"Scope|Disk%|Replica%|Disk crosses threshold"}
+	lines = append(lines, fmt.Sprintf("hottest broker %d now|%s|%s|%s",
+		hottest.id,
+		this.colorUtil(this.diskUtil(hottest.msgs)), this.colorUtil(this.replicaUtil(hottest.replicas)),
+		describeMonths(monthsToThreshold(this.diskUtil(hottest.msgs), this.threshold, this.growth))))
+	lines = append(lines, fmt.Sprintf("avg of %d brokers next month|%s|%s|%s",
+		n, this.colorUtil(avgDisk), this.colorUtil(avgReplica),
+		describeMonths(monthsToThreshold(avgDisk, this.threshold, this.growth))))
+	this.Ui.Output(columnize.SimpleFormat(lines))
+
+	if avgReplica >= this.threshold {
+		this.Ui.Warn(fmt.Sprintf("replicas per broker %d exceeds %.0f%% of %d, add more brokers",
+			totalReplicas/n, this.threshold*100, this.maxReplicas))
+	}
+}
+
+func (this *Capacity) colorUtil(util float64) string {
+	s := fmt.Sprintf("%.1f%%", util*100)
+	if util >= this.threshold {
+		return color.Red(s)
+	}
+	return s
+}
+
+func (*Capacity) Synopsis() string {
+	return "Capacity planning of a kafka cluster with what-if modeling"
+}
+
+func (this *Capacity) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s capacity -z zone -c cluster [options]
+
+    %s
+
+    Disk usage is estimated from messages in stock of all replicas hosted by a broker,
+    since disk grows in proportion to traffic with fixed retention.
+
+Options:
+
+    -add-broker n
+      Model adding n brokers with partitions reassigned evenly.
+
+    -growth percent
+      Monthly traffic growth, e,g. 20%%.
+
+    -msgsize bytes
+      Average message size on disk. Default 1024.
+
+    -disk GB
+      Disk capacity per broker. Default 4000.
+
+    -maxreplicas n
+      Partition replicas a broker can host. Default 4000.
+
+    -threshold percent
+      Utilization alarm threshold. Default 80%%.
+
+`, this.Cmd, this.Synopsis())
+	return strings.TrimSpace(help)
+}
+
+type brokerLoads []*brokerLoad
+
+func (b brokerLoads) Len() int           { return len(b) }
+func (b brokerLoads) Less(i, j int) bool { return b[i].id < b[j].id }
+func (b brokerLoads) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// parsePercent parses '20%' or '0.2' into 0.2.
+func parsePercent(s string) (float64, error) {
+	if strings.HasSuffix(s, "%") {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		return f / 100, err
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+// monthsToThreshold returns months before util grows beyond threshold at monthly growth rate,
+// 0 if already crossed and -1 if never.
+func monthsToThreshold(util, threshold, growth float64) float64 {
+	switch {
+	case util >= threshold:
+		return 0
+	case util <= 0 || growth <= 0:
+		return -1
+	}
+
+	return math.Log(threshold/util) / math.Log(1+growth)
+}
+
+func describeMonths(months float64) string {
+	switch {
+	case months == 0:
+		return color.Red("already")
+	case months < 0:
+		return "never"
+	case months < 3:
+		return color.Yellow("in %.1f months", months)
+	default:
+		return fmt.Sprintf("in %.1f months", months)
+	}
+}
@@ -0,0 +1,29 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestParsePercent(t *testing.T) {
+	f, err := parsePercent("20%")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0.2, f)
+
+	f, err = parsePercent("0.35")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0.35, f)
+
+	_, err = parsePercent("abc%")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestMonthsToThreshold(t *testing.T) {
+	assert.Equal(t, 0., monthsToThreshold(0.9, 0.8, 0.2))
+	assert.Equal(t, -1., monthsToThreshold(0.5, 0.8, 0))
+	assert.Equal(t, -1., monthsToThreshold(0, 0.8, 0.2))
+
+	// 0.4 doubles to 0.8 in exactly 1 month at 100% growth
+	assert.Equal(t, 1., monthsToThreshold(0.4, 0.8, 1))
+}
@@ -1,83 +1,221 @@
 package command
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/funkygao/gafka/ctx"
 	"github.com/funkygao/gocli"
 	"github.com/funkygao/golib/color"
+	"github.com/ryanuber/columnize"
+)
+
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
 )
 
 type Checkup struct {
 	Ui  cli.Ui
 	Cmd string
+
+	zone, cluster string
+	timeout       time.Duration
+}
+
+// checkItem is a sub-check of checkup, backed by another gk command.
+type checkItem struct {
+	name        string
+	cmd         func(ui cli.Ui) cli.Command
+	args        []string
+	withCluster bool // the command accepts '-c cluster'
+}
+
+type checkResult struct {
+	Name    string        `json:"name"`
+	Status  string        `json:"status"`
+	Reason  string        `json:"reason,omitempty"`
+	Elapsed time.Duration `json:"elapsed"`
+
+	output string
 }
 
 func (this *Checkup) Run(args []string) (exitCode int) {
-	var cmd cli.Command
-	if false {
-		this.Ui.Output(color.Cyan("checking zookeepeer\n%s", strings.Repeat("-", 80)))
-		cmd = &Zookeeper{
-			Ui:  this.Ui,
-			Cmd: this.Cmd,
-		}
-		cmd.Run(append(args, "-c", "srvr"))
-		this.Ui.Output("")
+	var (
+		jsonMode bool
+		quiet    bool
+	)
+	cmdFlags := flag.NewFlagSet("checkup", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.DurationVar(&this.timeout, "timeout", time.Minute*2, "")
+	cmdFlags.BoolVar(&jsonMode, "json", false, "")
+	cmdFlags.BoolVar(&quiet, "q", false, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
 	}
 
-	this.Ui.Output(color.Cyan("ping all brokers\n%s", strings.Repeat("-", 80)))
-	cmd = &Ping{
-		Ui:  this.Ui,
-		Cmd: this.Cmd,
+	items := []checkItem{
+		{
+			name:        "ping all brokers",
+			cmd:         func(ui cli.Ui) cli.Command { return &Ping{Ui: ui, Cmd: this.Cmd} },
+			args:        []string{"-p"},
+			withCluster: true,
+		},
+		{
+			name:        "registered brokers are alive",
+			cmd:         func(ui cli.Ui) cli.Command { return &Clusters{Ui: ui, Cmd: this.Cmd} },
+			args:        []string{"-verify"},
+			withCluster: true,
+		},
+		{
+			name:        "offline brokers",
+			cmd:         func(ui cli.Ui) cli.Command { return &Brokers{Ui: ui, Cmd: this.Cmd} },
+			args:        []string{"-stale"},
+			withCluster: true,
+		},
+		{
+			name:        "under replicated partitions",
+			cmd:         func(ui cli.Ui) cli.Command { return &UnderReplicated{Ui: ui, Cmd: this.Cmd} },
+			withCluster: true,
+		},
+		{
+			name: "kguard",
+			cmd:  func(ui cli.Ui) cli.Command { return &Kguard{Ui: ui, Cmd: this.Cmd} },
+		},
+		{
+			name:        "problematic lag consumers",
+			cmd:         func(ui cli.Ui) cli.Command { return &Lags{Ui: ui, Cmd: this.Cmd} },
+			args:        []string{"-p"},
+			withCluster: true,
+		},
 	}
-	cmd.Run(append(args, "-p"))
-	this.Ui.Output("")
 
-	this.Ui.Output(color.Cyan("checking registered brokers are alive\n%s", strings.Repeat("-", 80)))
-	cmd = &Clusters{
-		Ui:  this.Ui,
-		Cmd: this.Cmd,
+	results := make([]checkResult, len(items))
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item checkItem) {
+			defer wg.Done()
+			results[i] = this.runCheck(item)
+		}(i, item)
 	}
-	cmd.Run(append(args, "-verify"))
-	this.Ui.Output("")
+	wg.Wait()
 
-	this.Ui.Output(color.Cyan("checking offline brokers\n%s", strings.Repeat("-", 80)))
-	cmd = &Brokers{
-		Ui:  this.Ui,
-		Cmd: this.Cmd,
-	}
-	cmd.Run(append(args, "-stale"))
-	this.Ui.Output("")
+	if jsonMode {
+		b, _ := json.MarshalIndent(results, "", "    ")
+		this.Ui.Output(string(b))
+	} else {
+		if !quiet {
+			for _, r := range results {
+				this.Ui.Output(color.Cyan("%s\n%s", r.Name, strings.Repeat("-", 80)))
+				this.Ui.Output(r.output)
+				this.Ui.Output("")
+			}
+		}
 
-	this.Ui.Output(color.Cyan("checking under replicated brokers\n%s", strings.Repeat("-", 80)))
-	cmd = &UnderReplicated{
-		Ui:  this.Ui,
-		Cmd: this.Cmd,
+		this.printScoreboard(results)
 	}
-	cmd.Run(args)
-	this.Ui.Output("")
 
-	this.Ui.Output(color.Cyan("checking kguard\n%s", strings.Repeat("-", 80)))
-	cmd = &Kguard{
-		Ui:  this.Ui,
-		Cmd: this.Cmd,
+	for _, r := range results {
+		if r.Status == checkFail {
+			exitCode = 1
+		}
 	}
-	cmd.Run(args)
-	this.Ui.Output("")
 
-	this.Ui.Output(color.Cyan("checking problematic lag consumers\n%s", strings.Repeat("-", 80)))
-	cmd = &Lags{
-		Ui:  this.Ui,
-		Cmd: this.Cmd,
+	return
+}
+
+// runCheck runs a check item with timeout, the result status is derived from
+// the exit code and what the underlying command reports to Ui.
+func (this *Checkup) runCheck(item checkItem) (r checkResult) {
+	r.Name = item.name
+
+	args := append([]string{"-z", this.zone}, item.args...)
+	if item.withCluster && this.cluster != "" {
+		args = append(args, "-c", this.cluster)
 	}
-	cmd.Run(append(args, "-p"))
 
-	this.Ui.Output("")
-	this.Ui.Output("Did you find something wrong?")
+	ui := &recordingUi{}
+	done := make(chan int, 1)
+	t0 := time.Now()
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				ui.Error(fmt.Sprintf("panic: %v", err))
+				done <- 1
+			}
+		}()
+
+		done <- item.cmd(ui).Run(args)
+	}()
+
+	select {
+	case exitCode := <-done:
+		r.Elapsed = time.Since(t0)
+		switch {
+		case exitCode != 0:
+			r.Status = checkFail
+			r.Reason = fmt.Sprintf("exit code %d", exitCode)
+
+		case ui.errorN() > 0:
+			r.Status = checkFail
+			r.Reason = fmt.Sprintf("%d errors", ui.errorN())
+
+		case ui.warnN() > 0:
+			r.Status = checkWarn
+			r.Reason = fmt.Sprintf("%d warnings", ui.warnN())
+
+		default:
+			r.Status = checkPass
+		}
+
+	case <-time.After(this.timeout):
+		// the check goroutine is abandoned, it will die with the process
+		r.Elapsed = time.Since(t0)
+		r.Status = checkFail
+		r.Reason = fmt.Sprintf("timeout after %s", this.timeout)
+	}
 
+	r.output = ui.String()
 	return
 }
 
+func (this *Checkup) printScoreboard(results []checkResult) {
+	lines := []string{"Check|Status|Elapsed|Reason"}
+	var passN, warnN, failN int
+	for _, r := range results {
+		status := r.Status
+		switch r.Status {
+		case checkPass:
+			passN++
+			status = color.Green(r.Status)
+
+		case checkWarn:
+			warnN++
+			status = color.Yellow(r.Status)
+
+		case checkFail:
+			failN++
+			status = color.Red(r.Status)
+		}
+
+		lines = append(lines, fmt.Sprintf("%s|%s|%s|%s", r.Name, status,
+			r.Elapsed/time.Millisecond*time.Millisecond, r.Reason))
+	}
+
+	this.Ui.Output(columnize.SimpleFormat(lines))
+	this.Ui.Output(fmt.Sprintf("\n%s zone:%s PASS:%d WARN:%d FAIL:%d",
+		time.Now().Format("2006-01-02 15:04:05"), this.zone, passN, warnN, failN))
+}
+
 func (*Checkup) Synopsis() string {
 	return "Health checkup of kafka runtime"
 }
@@ -88,12 +226,89 @@ Usage: %s checkup [options]
 
     %s
 
+    All checks run concurrently, exit code is non-zero if any check fails,
+    so that it can be scheduled in crontab as zone health gate.
+
 Options:
 
     -z zone
 
     -c cluster name
 
+    -timeout duration
+      Timeout of each check, default 2m.
+      A check that times out is regarded as FAIL.
+
+    -json
+      Output machine-readable summary in json.
+
+    -q
+      Quiet mode, show only the final scoreboard.
+
 `, this.Cmd, this.Synopsis())
 	return strings.TrimSpace(help)
 }
+
+// recordingUi is a cli.Ui that buffers all output of a command and counts the
+// warnings and errors it reports.
+type recordingUi struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	warns  int
+	errors int
+}
+
+func (this *recordingUi) Ask(query string) (string, error) {
+	return "", fmt.Errorf("checkup is non-interactive: %s", query)
+}
+
+func (this *recordingUi) AskSecret(query string) (string, error) {
+	return this.Ask(query)
+}
+
+func (this *recordingUi) write(s string) {
+	this.buf.WriteString(s)
+	this.buf.WriteByte('\n')
+}
+
+func (this *recordingUi) Output(s string) {
+	this.mu.Lock()
+	this.write(s)
+	this.mu.Unlock()
+}
+
+func (this *recordingUi) Info(s string) {
+	this.Output(s)
+}
+
+func (this *recordingUi) Warn(s string) {
+	this.mu.Lock()
+	this.warns++
+	this.write(color.Yellow(s))
+	this.mu.Unlock()
+}
+
+func (this *recordingUi) Error(s string) {
+	this.mu.Lock()
+	this.errors++
+	this.write(color.Red(s))
+	this.mu.Unlock()
+}
+
+func (this *recordingUi) warnN() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.warns
+}
+
+func (this *recordingUi) errorN() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.errors
+}
+
+func (this *recordingUi) String() string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return strings.TrimRight(this.buf.String(), "\n")
+}
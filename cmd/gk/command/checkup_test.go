@@ -0,0 +1,49 @@
+package command
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gocli"
+)
+
+// checkFunc is a cli.Command that runs f.
+type checkFunc func(args []string) int
+
+func (f checkFunc) Run(args []string) int { return f(args) }
+func (checkFunc) Help() string            { return "" }
+func (checkFunc) Synopsis() string        { return "" }
+
+func TestCheckupRunCheck(t *testing.T) {
+	c := &Checkup{zone: "test", timeout: time.Second}
+
+	// a broker ping fails while the command exits 0
+	r := c.runCheck(checkItem{name: "ping", cmd: func(ui cli.Ui) cli.Command {
+		return checkFunc(func(args []string) int {
+			p := &Ping{Ui: ui, logfile: "stdout"}
+			p.report(nil, "10.1.1.1:9092", "k9092a.test.com:9092")
+			p.report(errors.New("connection refused"), "10.1.1.1:9092", "k9092a.test.com:9092")
+			return 0
+		})
+	}})
+	assert.Equal(t, checkFail, r.Status)
+	assert.Equal(t, "1 errors", r.Reason)
+
+	r = c.runCheck(checkItem{name: "ping", cmd: func(ui cli.Ui) cli.Command {
+		return checkFunc(func(args []string) int {
+			(&Ping{Ui: ui, logfile: "stdout"}).report(nil, "10.1.1.1:9092", "k9092a.test.com:9092")
+			return 0
+		})
+	}})
+	assert.Equal(t, checkPass, r.Status)
+
+	r = c.runCheck(checkItem{name: "slow", cmd: func(ui cli.Ui) cli.Command {
+		return checkFunc(func(args []string) int {
+			ui.Warn("lagging")
+			return 0
+		})
+	}})
+	assert.Equal(t, checkWarn, r.Status)
+}
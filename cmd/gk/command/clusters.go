@@ -47,6 +47,7 @@ func (this *Clusters) Run(args []string) (exitCode int) {
 		addBroker      string
 		nickname       string
 		delBroker      string
+		brokerRacks    string
 		summaryMode    bool
 	)
 	cmdFlags := flag.NewFlagSet("clusters", flag.ContinueOnError)
@@ -71,6 +72,7 @@ func (this *Clusters) Run(args []string) (exitCode int) {
 	cmdFlags.StringVar(&addBroker, "addbroker", "", "")
 	cmdFlags.StringVar(&nickname, "nickname", "", "")
 	cmdFlags.StringVar(&delBroker, "delbroker", "", "")
+	cmdFlags.StringVar(&brokerRacks, "rack", "", "")
 	cmdFlags.BoolVar(&this.registeredBrokers, "registered", false, "")
 	cmdFlags.BoolVar(&verifyMode, "verify", false, "")
 	if err := cmdFlags.Parse(args); err != nil {
@@ -176,6 +178,14 @@ func (this *Clusters) Run(args []string) (exitCode int) {
 			}
 			return
 
+		case brokerRacks != "":
+			racks, err := parseBrokerRacks(brokerRacks)
+			swallow(err)
+			for brokerId, rack := range racks {
+				swallow(zkcluster.SetBrokerRack(int(brokerId), rack))
+			}
+			return
+
 		default:
 			return
 		}
@@ -284,7 +294,7 @@ func (this *Clusters) verifyBrokers(zkzone *zk.ZkZone) {
 
 			if !foundInLive {
 				// the broker is dead
-				this.Ui.Output(strings.Repeat(" ", 4) +
+				this.Ui.Error(strings.Repeat(" ", 4) +
 					color.Red("cluster[%s] broker[%d] %s is dead", cluster, b.Id, b.Addr()))
 			}
 		}
@@ -611,6 +621,12 @@ Options:
       Delete a broker from a cluster.
       e,g. gk clusters -z prod -c foo -s -delbroker 5,6
 
+    -rack id:rack,id:rack
+      Tag rack or availability zone of brokers for rack aware replica placement.
+      Empty rack removes the tag.
+      Without tag, broker.rack of kafka, then racks ip ranges in ~/.gafka.cf is used.
+      e,g. gk clusters -z prod -c foo -s -rack 1:az1,2:az2,3:
+
     -registered
       Display registered permanent brokers info.
 
@@ -0,0 +1,319 @@
+package command
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+)
+
+type CompareZones struct {
+	Ui  cli.Ui
+	Cmd string
+
+	fromZone, toZone string
+	clusterPattern   string
+	topicPattern     string
+	skipLayout       bool
+	format           string
+}
+
+// clusterProfile is what of a cluster is compared across zones.
+type clusterProfile struct {
+	topics         map[string]topicProfile
+	brokerVersions map[int]int // registration version:brokers
+	racks          []int       // brokers of each rack, descending
+}
+
+type topicProfile struct {
+	partitions int
+	config     string // sorted k=v of non-default configs
+}
+
+// zoneDrift is a single difference of a cluster between 2 zones.
+type zoneDrift struct {
+	cluster   string
+	dimension string // cluster | topic | partitions | config | broker versions | racks
+	topic     string
+	from, to  string
+}
+
+func (this *CompareZones) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("compare-zones", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.fromZone, "from", "", "")
+	cmdFlags.StringVar(&this.toZone, "to", "", "")
+	cmdFlags.StringVar(&this.clusterPattern, "c", "", "")
+	cmdFlags.StringVar(&this.topicPattern, "t", "", "")
+	cmdFlags.BoolVar(&this.skipLayout, "nolayout", false, "")
+	cmdFlags.StringVar(&this.format, "format", diffSideBySide, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-from", "-to").
+		invalid(args) {
+		return 2
+	}
+
+	if this.fromZone == this.toZone {
+		this.Ui.Error("-from and -to are the same zone")
+		return 2
+	}
+
+	view, err := newDiffView(this.format, this.fromZone, this.toZone, "Cluster", "Dimension", "Topic")
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 2
+	}
+
+	ensureZoneValid(this.fromZone)
+	ensureZoneValid(this.toZone)
+
+	from := this.zoneProfile(this.fromZone)
+	to := this.zoneProfile(this.toZone)
+	drifts := compareZoneProfiles(from, to)
+
+	var entries []diffEntry
+	for _, d := range drifts {
+		if this.skipLayout && (d.dimension == "broker versions" || d.dimension == "racks") {
+			continue
+		}
+
+		entries = append(entries, newDiffEntry(d.from, d.to, d.cluster, d.dimension, d.topic))
+	}
+
+	if this.format == diffJson {
+		this.Ui.Output(view.Render(entries))
+		if len(entries) > 0 {
+			return 1
+		}
+		return
+	}
+
+	if len(entries) > 0 {
+		this.Ui.Output(view.Render(entries))
+		this.Ui.Output(fmt.Sprintf("%d drifts between %s and %s", len(entries), this.fromZone, this.toZone))
+		return 1
+	}
+
+	this.Ui.Info(fmt.Sprintf("no drift between %s and %s", this.fromZone, this.toZone))
+	return
+}
+
+// zoneProfile collects the profile of each matched cluster of the zone.
+func (this *CompareZones) zoneProfile(zone string) map[string]*clusterProfile {
+	zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
+	defer zkzone.Close()
+
+	r := make(map[string]*clusterProfile)
+	zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+		if !patternMatched(zkcluster.Name(), this.clusterPattern) {
+			return
+		}
+
+		p := &clusterProfile{
+			topics:         make(map[string]topicProfile),
+			brokerVersions: make(map[int]int),
+		}
+
+		topics, err := zkcluster.Topics()
+		swallow(err)
+		configs := zkcluster.ConfiggedTopics()
+		for _, topic := range topics {
+			if !patternMatched(topic, this.topicPattern) {
+				continue
+			}
+
+			p.topics[topic] = topicProfile{
+				partitions: len(zkcluster.Partitions(topic)),
+				config:     normalizedTopicConfig(configs[topic].Config),
+			}
+		}
+
+		for _, b := range zkcluster.Brokers() {
+			p.brokerVersions[b.Version]++
+		}
+
+		racks := make(map[string]int)
+		for _, rack := range zkcluster.BrokerRacks() {
+			racks[rack]++
+		}
+		for _, n := range racks {
+			p.racks = append(p.racks, n)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(p.racks)))
+
+		r[zkcluster.Name()] = p
+	})
+
+	return r
+}
+
+// normalizedTopicConfig returns the sorted k=v of topic config znode data, so that configs
+// are compared regardless of json key order.
+func normalizedTopicConfig(config string) string {
+	var v struct {
+		Config map[string]string `json:"config"`
+	}
+	if err := json.Unmarshal([]byte(config), &v); err != nil || len(v.Config) == 0 {
+		return ""
+	}
+
+	kvs := make([]string, 0, len(v.Config))
+	for k, val := range v.Config {
+		kvs = append(kvs, k+"="+val)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ",")
+}
+
+// compareZoneProfiles returns the drifts of clusters with the same name across zones, sorted by
+// cluster and topic. Rack names differ across zones, only the layout of brokers over racks counts.
+func compareZoneProfiles(from, to map[string]*clusterProfile) []zoneDrift {
+	clusters := make(map[string]struct{})
+	for c := range from {
+		clusters[c] = struct{}{}
+	}
+	for c := range to {
+		clusters[c] = struct{}{}
+	}
+	sortedClusters := make([]string, 0, len(clusters))
+	for c := range clusters {
+		sortedClusters = append(sortedClusters, c)
+	}
+	sort.Strings(sortedClusters)
+
+	var r []zoneDrift
+	for _, cluster := range sortedClusters {
+		fc, tc := from[cluster], to[cluster]
+		switch {
+		case fc == nil:
+			r = append(r, zoneDrift{cluster: cluster, dimension: "cluster", to: fmt.Sprintf("%d topics", len(tc.topics))})
+			continue
+
+		case tc == nil:
+			r = append(r, zoneDrift{cluster: cluster, dimension: "cluster", from: fmt.Sprintf("%d topics", len(fc.topics))})
+			continue
+		}
+
+		topics := make(map[string]struct{})
+		for t := range fc.topics {
+			topics[t] = struct{}{}
+		}
+		for t := range tc.topics {
+			topics[t] = struct{}{}
+		}
+		sortedTopics := make([]string, 0, len(topics))
+		for t := range topics {
+			sortedTopics = append(sortedTopics, t)
+		}
+		sort.Strings(sortedTopics)
+
+		for _, topic := range sortedTopics {
+			ft, fpresent := fc.topics[topic]
+			tt, tpresent := tc.topics[topic]
+			switch {
+			case !fpresent:
+				r = append(r, zoneDrift{cluster: cluster, dimension: "topic", topic: topic, to: fmt.Sprintf("partitions:%d", tt.partitions)})
+				continue
+
+			case !tpresent:
+				r = append(r, zoneDrift{cluster: cluster, dimension: "topic", topic: topic, from: fmt.Sprintf("partitions:%d", ft.partitions)})
+				continue
+			}
+
+			if ft.partitions != tt.partitions {
+				r = append(r, zoneDrift{cluster: cluster, dimension: "partitions", topic: topic,
+					from: strconv.Itoa(ft.partitions), to: strconv.Itoa(tt.partitions)})
+			}
+			if ft.config != tt.config {
+				r = append(r, zoneDrift{cluster: cluster, dimension: "config", topic: topic,
+					from: defaultIfEmpty(ft.config), to: defaultIfEmpty(tt.config)})
+			}
+		}
+
+		if fv, tv := brokerVersionsString(fc.brokerVersions), brokerVersionsString(tc.brokerVersions); fv != tv {
+			r = append(r, zoneDrift{cluster: cluster, dimension: "broker versions", from: fv, to: tv})
+		}
+		if fr, tr := racksString(fc.racks), racksString(tc.racks); fr != tr {
+			r = append(r, zoneDrift{cluster: cluster, dimension: "racks", from: fr, to: tr})
+		}
+	}
+
+	return r
+}
+
+func defaultIfEmpty(config string) string {
+	if config == "" {
+		return "default"
+	}
+	return config
+}
+
+// brokerVersionsString renders {version:brokers} as v1*2,v2*3.
+func brokerVersionsString(versions map[int]int) string {
+	sortedVersions := make([]int, 0, len(versions))
+	for v := range versions {
+		sortedVersions = append(sortedVersions, v)
+	}
+	sort.Ints(sortedVersions)
+
+	parts := make([]string, 0, len(sortedVersions))
+	for _, v := range sortedVersions {
+		parts = append(parts, fmt.Sprintf("v%d*%d", v, versions[v]))
+	}
+	if len(parts) == 0 {
+		return "no brokers"
+	}
+	return strings.Join(parts, ",")
+}
+
+// racksString renders brokers of each rack as 3 racks:2/2/1.
+func racksString(racks []int) string {
+	parts := make([]string, 0, len(racks))
+	for _, n := range racks {
+		parts = append(parts, strconv.Itoa(n))
+	}
+	return fmt.Sprintf("%d racks:%s", len(racks), strings.Join(parts, "/"))
+}
+
+func (*CompareZones) Synopsis() string {
+	return "Report configuration drift of clusters between 2 zones"
+}
+
+func (this *CompareZones) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s compare-zones -from zone -to zone [options]
+
+    %s
+
+    Clusters of the same name are compared on topic set, partition counts,
+    non-default topic configs, broker registration versions and the layout of
+    brokers over racks. Useful before/after DR sync exercises and when promoting
+    topology from one zone to another.
+
+    Exit code is 1 if any drift found.
+
+Options:
+
+    -c cluster pattern
+
+    -t topic pattern
+
+    -nolayout
+      Skip broker versions and racks, only compare topics.
+
+    -format side|unified|json
+      Output format of drifts, default side by side.
+
+`, this.Cmd, this.Synopsis())
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,50 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestNormalizedTopicConfig(t *testing.T) {
+	assert.Equal(t, "", normalizedTopicConfig(""))
+	assert.Equal(t, "", normalizedTopicConfig(`{"version":1,"config":{}}`))
+	assert.Equal(t, "retention.ms=3600000,segment.bytes=1024",
+		normalizedTopicConfig(`{"version":1,"config":{"segment.bytes":"1024","retention.ms":"3600000"}}`))
+}
+
+func TestCompareZoneProfiles(t *testing.T) {
+	from := map[string]*clusterProfile{
+		"me": {
+			topics: map[string]topicProfile{
+				"app1.foo.v1": {partitions: 3},
+				"app1.bar.v1": {partitions: 1, config: "retention.ms=3600000"},
+				"app1.sit.v1": {partitions: 1},
+			},
+			brokerVersions: map[int]int{2: 3},
+			racks:          []int{2, 1},
+		},
+		"sit": {},
+	}
+	to := map[string]*clusterProfile{
+		"me": {
+			topics: map[string]topicProfile{
+				"app1.foo.v1": {partitions: 6},
+				"app1.bar.v1": {partitions: 1},
+			},
+			brokerVersions: map[int]int{2: 1, 3: 2},
+			racks:          []int{1, 1, 1},
+		},
+	}
+
+	drifts := compareZoneProfiles(from, to)
+	assert.Equal(t, 6, len(drifts))
+	assert.Equal(t, zoneDrift{cluster: "me", dimension: "config", topic: "app1.bar.v1", from: "retention.ms=3600000", to: "default"}, drifts[0])
+	assert.Equal(t, zoneDrift{cluster: "me", dimension: "partitions", topic: "app1.foo.v1", from: "3", to: "6"}, drifts[1])
+	assert.Equal(t, zoneDrift{cluster: "me", dimension: "topic", topic: "app1.sit.v1", from: "partitions:1"}, drifts[2])
+	assert.Equal(t, zoneDrift{cluster: "me", dimension: "broker versions", from: "v2*3", to: "v2*1,v3*2"}, drifts[3])
+	assert.Equal(t, zoneDrift{cluster: "me", dimension: "racks", from: "2 racks:2/1", to: "3 racks:1/1/1"}, drifts[4])
+	assert.Equal(t, zoneDrift{cluster: "sit", dimension: "cluster", from: "0 topics"}, drifts[5])
+
+	assert.Equal(t, 0, len(compareZoneProfiles(to, to)))
+}
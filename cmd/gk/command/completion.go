@@ -0,0 +1,88 @@
+package command
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/funkygao/gocli"
+)
+
+// Completion scripts call back `gk ... --generate-bash-completion` for candidates,
+// so that -z/-c/-t are completed with live zones, clusters and topics.
+const (
+	bashCompletionScript = `# bash completion for %[1]s, install with:
+#   %[1]s completion bash > /etc/bash_completion.d/%[1]s
+_%[2]s_complete() {
+    local cur opts
+    COMPREPLY=()
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} --generate-bash-completion 2>/dev/null )
+    COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+    return 0
+}
+complete -F _%[2]s_complete %[1]s
+`
+
+	zshCompletionScript = `#compdef %[1]s
+# zsh completion for %[1]s, install with:
+#   %[1]s completion zsh > "${fpath[1]}/_%[1]s"
+_%[2]s_complete() {
+    local -a opts
+    opts=(${(f)"$("${(@)words[1,CURRENT-1]}" --generate-bash-completion 2>/dev/null)"})
+    compadd -a opts
+}
+compdef _%[2]s_complete %[1]s
+`
+)
+
+type Completion struct {
+	Ui  cli.Ui
+	Cmd string
+}
+
+func (this *Completion) Run(args []string) (exitCode int) {
+	if len(args) != 1 {
+		this.Ui.Output(this.Help())
+		return 2
+	}
+
+	prog := filepath.Base(this.Cmd)
+	fn := strings.NewReplacer("-", "_", ".", "_").Replace(prog)
+	switch args[0] {
+	case "bash":
+		this.Ui.Output(fmt.Sprintf(bashCompletionScript, prog, fn))
+
+	case "zsh":
+		this.Ui.Output(fmt.Sprintf(zshCompletionScript, prog, fn))
+
+	default:
+		this.Ui.Error(fmt.Sprintf("unsupported shell: %s", args[0]))
+		return 2
+	}
+
+	return
+}
+
+func (*Completion) Synopsis() string {
+	return "Generate shell completion script aware of zones and clusters"
+}
+
+func (this *Completion) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s completion bash|zsh
+
+    %s
+
+    Commands, zones(-z), clusters(-c) and topics(-t) are completed.
+    Clusters are cached for a while to keep completion snappy.
+
+    bash:
+      %s completion bash > /etc/bash_completion.d/gk
+
+    zsh:
+      %s completion zsh > "${fpath[1]}/_gk"
+
+`, this.Cmd, this.Synopsis(), this.Cmd, this.Cmd)
+	return strings.TrimSpace(help)
+}
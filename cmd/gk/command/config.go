@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/funkygao/gafka/ctx"
 	"github.com/funkygao/gocli"
 )
 
@@ -19,10 +20,12 @@ type Config struct {
 func (this *Config) Run(args []string) (exitCode int) {
 	var (
 		bashAutocomplete bool
+		effective        bool
 	)
 	cmdFlags := flag.NewFlagSet("config", flag.ContinueOnError)
 	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
 	cmdFlags.BoolVar(&bashAutocomplete, "auto", false, "")
+	cmdFlags.BoolVar(&effective, "effective", false, "")
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
@@ -37,6 +40,12 @@ func (this *Config) Run(args []string) (exitCode int) {
 		return
 	}
 
+	if effective {
+		this.Ui.Info("effective config merged with machine local overrides")
+		this.Ui.Output(ctx.DumpEffectiveConfig())
+		return
+	}
+
 	// display $HOME/.gafka.cf
 	usr, err := user.Current()
 	swallow(err)
@@ -63,6 +72,10 @@ Options:
     -auto
       Install gk bash autocomplete script.  
 
+    -effective
+      Display the effective config: $HOME/.gafka.cf with the machine local 
+      overrides $HOME/.gafka.local.cf layered over it.
+
 `, this.Cmd, this.Synopsis())
 	return strings.TrimSpace(help)
 }
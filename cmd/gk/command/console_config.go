@@ -0,0 +1,344 @@
+package command
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/go-ozzo/ozzo-dbx"
+)
+
+type ConsoleConfig struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone        string
+	appid       string
+	subAppid    string
+	topic, ver  string
+	group       string
+	lang        string
+	showSecret  bool
+	targetZones string
+}
+
+type consoleConfigEndpoint struct {
+	Zone     string
+	Pub, Sub string
+}
+
+type consoleConfigData struct {
+	Appid, AppName   string
+	Secret           string
+	SubAppid         string
+	SubSecret        string
+	Topic, Ver       string
+	Group            string
+	Endpoints        []consoleConfigEndpoint
+	Pub, Sub         string // 1st endpoint of the 1st zone used in code samples
+	PubTimeout       int    // in seconds
+	SubTimeout       int
+	SubServerTimeout int
+}
+
+func (this *ConsoleConfig) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("console-config", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.appid, "app", "", "")
+	cmdFlags.StringVar(&this.subAppid, "subapp", "", "")
+	cmdFlags.StringVar(&this.topic, "t", "", "")
+	cmdFlags.StringVar(&this.ver, "ver", "v1", "")
+	cmdFlags.StringVar(&this.group, "g", "group1", "")
+	cmdFlags.StringVar(&this.lang, "lang", "all", "")
+	cmdFlags.StringVar(&this.targetZones, "zones", "", "")
+	cmdFlags.BoolVar(&this.showSecret, "key", false, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-app", "-t").
+		invalid(args) {
+		return 2
+	}
+
+	ensureZoneValid(this.zone)
+
+	switch this.lang {
+	case "all", "curl", "go", "java":
+	default:
+		this.Ui.Error(fmt.Sprintf("unknown lang: %s", this.lang))
+		return 2
+	}
+
+	if this.subAppid == "" {
+		this.subAppid = this.appid
+	}
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	dsn, err := zkzone.KatewayMysqlDsn()
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	data, err := this.loadFromManager(dsn)
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	data.Endpoints = this.endpoints()
+	if len(data.Endpoints) == 0 {
+		this.Ui.Error("no kateway endpoints found in any zone")
+		return 1
+	}
+	data.Pub = strings.Split(data.Endpoints[0].Pub, ",")[0]
+	data.Sub = strings.Split(data.Endpoints[0].Sub, ",")[0]
+
+	this.Ui.Output(this.render(data))
+	return
+}
+
+func (this *ConsoleConfig) loadFromManager(dsn string) (*consoleConfigData, error) {
+	db, err := dbx.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	appInfo := func(appid string) (*WhoisAppInfo, error) {
+		var ai WhoisAppInfo
+		err := db.NewQuery("SELECT AppId,ApplicationName,ApplicationIntro,Cluster,CreateBy,CreateTime,Status,AppSecret,Raw FROM application WHERE AppId={:app}").
+			Bind(dbx.Params{"app": appid}).One(&ai)
+		if err != nil {
+			return nil, fmt.Errorf("app %s: %v", appid, err)
+		}
+		return &ai, nil
+	}
+
+	app, err := appInfo(this.appid)
+	if err != nil {
+		return nil, err
+	}
+	subApp, err := appInfo(this.subAppid)
+	if err != nil {
+		return nil, err
+	}
+
+	var ti WhoisTopicInfo
+	if err = db.NewQuery("SELECT AppId,TopicName,TopicIntro,CreateBy,CreateTime,Status FROM topics WHERE AppId={:app} AND TopicName={:topic}").
+		Bind(dbx.Params{"app": this.appid, "topic": this.topic}).One(&ti); err != nil {
+		return nil, fmt.Errorf("topic %s of app %s: %v", this.topic, this.appid, err)
+	}
+	if ti.Status != "1" {
+		this.Ui.Warn(fmt.Sprintf("topic %s of app %s is not enabled for Pub yet", this.topic, this.appid))
+	}
+
+	data := &consoleConfigData{
+		Appid:            app.AppId,
+		AppName:          app.ApplicationName,
+		Secret:           "<pubkey>",
+		SubAppid:         subApp.AppId,
+		SubSecret:        "<subkey>",
+		Topic:            this.topic,
+		Ver:              this.ver,
+		Group:            this.group,
+		PubTimeout:       10,
+		SubTimeout:       40, // longer than the long polling
+		SubServerTimeout: 30, // kateway -subtimeout
+	}
+	if this.showSecret {
+		data.Secret, data.SubSecret = app.AppSecret, subApp.AppSecret
+	}
+
+	return data, nil
+}
+
+// endpoints returns kateway Pub/Sub endpoints of each zone: the load balancer if configured
+// in ctx, else the registered kateway instances.
+func (this *ConsoleConfig) endpoints() []consoleConfigEndpoint {
+	targets := make(map[string]struct{})
+	if this.targetZones != "" {
+		for _, z := range strings.Split(this.targetZones, ",") {
+			targets[z] = struct{}{}
+		}
+	}
+
+	var r []consoleConfigEndpoint
+	forSortedZones(func(zkzone *zk.ZkZone) {
+		if _, present := targets[zkzone.Name()]; len(targets) > 0 && !present {
+			return
+		}
+
+		z := ctx.Zone(zkzone.Name())
+		if z.PubEndpoint != "" && z.SubEndpoint != "" {
+			r = append(r, consoleConfigEndpoint{Zone: z.Name, Pub: z.PubEndpoint, Sub: z.SubEndpoint})
+			return
+		}
+
+		kws, err := zkzone.KatewayInfos()
+		if err != nil || len(kws) == 0 {
+			return
+		}
+
+		var pubs, subs []string
+		for _, kw := range kws {
+			pubs = append(pubs, kw.PubAddr)
+			subs = append(subs, kw.SubAddr)
+		}
+		r = append(r, consoleConfigEndpoint{
+			Zone: z.Name,
+			Pub:  strings.Join(pubs, ","),
+			Sub:  strings.Join(subs, ","),
+		})
+	})
+
+	return r
+}
+
+func (this *ConsoleConfig) render(data *consoleConfigData) string {
+	sections := []string{consoleConfigCommonTpl}
+	switch this.lang {
+	case "curl":
+		sections = append(sections, consoleConfigCurlTpl)
+	case "go":
+		sections = append(sections, consoleConfigGoTpl)
+	case "java":
+		sections = append(sections, consoleConfigJavaTpl)
+	default:
+		sections = append(sections, consoleConfigCurlTpl, consoleConfigGoTpl, consoleConfigJavaTpl)
+	}
+
+	var buf bytes.Buffer
+	for _, s := range sections {
+		t := template.Must(template.New("console-config").
+			Funcs(template.FuncMap{"title": color.Cyan}).
+			Parse(s))
+		swallow(t.Execute(&buf, data))
+	}
+
+	return strings.TrimSpace(buf.String())
+}
+
+const consoleConfigCommonTpl = `
+{{title "# app"}}
+{{.Appid}} {{.AppName}}, topic: {{.Topic}} {{.Ver}}, consumer app: {{.SubAppid}}, group: {{.Group}}
+
+{{title "# kateway endpoints"}}
+{{range .Endpoints}}{{.Zone}}
+    pub: {{.Pub}}
+    sub: {{.Sub}}
+{{end}}
+{{title "# auth headers"}}
+Pub:
+    Appid: {{.Appid}}
+    Pubkey: {{.Secret}}
+Sub:
+    Appid: {{.SubAppid}}
+    Subkey: {{.SubSecret}}
+
+{{title "# recommended timeouts"}}
+Pub: connect 3s, request {{.PubTimeout}}s, retry with backoff on 5xx and timeout
+Sub: connect 3s, request {{.SubTimeout}}s, long polling returns 204 after {{.SubServerTimeout}}s without message, just sub again
+`
+
+const consoleConfigCurlTpl = `
+{{title "# curl"}}
+curl -i -XPOST -H "Appid: {{.Appid}}" -H "Pubkey: {{.Secret}}" -d 'hello world' http://{{.Pub}}/v1/msgs/{{.Topic}}/{{.Ver}}
+curl -i -H "Appid: {{.SubAppid}}" -H "Subkey: {{.SubSecret}}" "http://{{.Sub}}/v1/msgs/{{.Appid}}/{{.Topic}}/{{.Ver}}?group={{.Group}}"
+`
+
+const consoleConfigGoTpl = `
+{{title "# go: github.com/funkygao/gafka/cmd/kateway/api/v1"}}
+cf := api.DefaultConfig("{{.Appid}}", "{{.Secret}}")
+cf.Pub.Endpoint = "{{.Pub}}"
+cf.Timeout = time.Second * {{.PubTimeout}}
+pub := api.NewClient(cf)
+err := pub.Pub("", []byte("hello world"), api.PubOption{Topic: "{{.Topic}}", Ver: "{{.Ver}}"})
+
+cf = api.DefaultConfig("{{.SubAppid}}", "{{.SubSecret}}")
+cf.Sub.Endpoint = "{{.Sub}}"
+cf.Timeout = time.Second * {{.SubTimeout}}
+sub := api.NewClient(cf)
+err = sub.Sub(api.SubOption{AppId: "{{.Appid}}", Topic: "{{.Topic}}", Ver: "{{.Ver}}", Group: "{{.Group}}"},
+    func(statusCode int, msg []byte) error {
+        // return api.ErrSubStop to stop
+        return nil
+    })
+`
+
+const consoleConfigJavaTpl = `
+{{title "# java"}}
+URL url = new URL("http://{{.Pub}}/v1/msgs/{{.Topic}}/{{.Ver}}");
+HttpURLConnection conn = (HttpURLConnection) url.openConnection();
+conn.setConnectTimeout(3000);
+conn.setReadTimeout({{.PubTimeout}}000);
+conn.setRequestMethod("POST");
+conn.setRequestProperty("Appid", "{{.Appid}}");
+conn.setRequestProperty("Pubkey", "{{.Secret}}");
+conn.setDoOutput(true);
+conn.getOutputStream().write("hello world".getBytes("UTF-8"));
+int status = conn.getResponseCode(); // 201 on success
+
+url = new URL("http://{{.Sub}}/v1/msgs/{{.Appid}}/{{.Topic}}/{{.Ver}}?group={{.Group}}");
+conn = (HttpURLConnection) url.openConnection();
+conn.setConnectTimeout(3000);
+conn.setReadTimeout({{.SubTimeout}}000);
+conn.setRequestProperty("Appid", "{{.SubAppid}}");
+conn.setRequestProperty("Subkey", "{{.SubSecret}}");
+status = conn.getResponseCode(); // 200 with message, 204 no message yet
+`
+
+func (*ConsoleConfig) Synopsis() string {
+	return "Generate client config and sample code of an app topic for onboarding"
+}
+
+func (this *ConsoleConfig) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s console-config [options]
+
+    %s
+
+    Endpoints of all zones are pulled from ctx and kateway registry, app and topic
+    info from manager db of the zone.
+
+Options:
+
+    -z zone
+      Zone of the manager db.
+      Default %s
+
+    -app appid
+      Owner app of the topic.
+
+    -t topic
+
+    -ver version
+      Default v1
+
+    -subapp appid
+      The consumer app, defaults to -app.
+
+    -g group
+      Default group1
+
+    -zones zone1,zone2
+      Only emit endpoints of these zones.
+
+    -lang <all|curl|go|java>
+      Default all
+
+    -key
+      Show the real app secret instead of placeholder.
+
+`, this.Cmd, this.Synopsis(), ctx.ZkDefaultZone())
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,163 @@
+package command
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+)
+
+type Diff struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone, cluster string
+	since         string
+	export        string
+	withLeader    bool
+	format        string
+}
+
+func (this *Diff) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.StringVar(&this.since, "since", "", "")
+	cmdFlags.StringVar(&this.export, "export", "", "")
+	cmdFlags.BoolVar(&this.withLeader, "leader", false, "")
+	cmdFlags.StringVar(&this.format, "format", diffUnified, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if this.since == "" && this.export == "" {
+		this.Ui.Error("-since or -export required")
+		this.Ui.Output(this.Help())
+		return 2
+	}
+
+	if _, err := newDiffView(this.format, "", ""); err != nil {
+		this.Ui.Error(err.Error())
+		return 2
+	}
+
+	ensureZoneValid(this.zone)
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	defer zkzone.Close()
+
+	current, err := zkzone.ExportMeta()
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	if this.since != "" {
+		b, err := ioutil.ReadFile(this.since)
+		swallow(err)
+
+		var old zk.ZoneMeta
+		if err = json.Unmarshal(b, &old); err != nil {
+			this.Ui.Error(fmt.Sprintf("%s: %v", this.since, err))
+			return 1
+		}
+
+		if old.Zone != current.Zone {
+			this.Ui.Warn(fmt.Sprintf("comparing zone %s against %s", old.Zone, current.Zone))
+		}
+
+		this.printChanges(&old, current)
+	}
+
+	if this.export != "" {
+		b, _ := json.MarshalIndent(current, "", "    ")
+		swallow(ioutil.WriteFile(this.export, b, 0644))
+		this.Ui.Info(fmt.Sprintf("zone[%s] meta exported to %s", this.zone, this.export))
+	}
+
+	return
+}
+
+func (this *Diff) printChanges(old, current *zk.ZoneMeta) {
+	view, _ := newDiffView(this.format, old.Ctime.Format("2006-01-02 15:04:05"), "now", "Cluster", "Item", "Topic")
+
+	var entries []diffEntry
+	for _, c := range zk.DiffMeta(old, current) {
+		if !patternMatched(c.Cluster, this.cluster) {
+			continue
+		}
+
+		if !this.withLeader && (c.Item == "leader" || c.Item == "isr") {
+			// leadership and isr are volatile, ignored by default
+			continue
+		}
+
+		topic := c.Topic
+		if c.Partition != "" {
+			topic += "#" + c.Partition
+		}
+		e := diffEntry{Op: diffChanged, Path: []string{c.Cluster, c.Item, topic}, Left: c.Old, Right: c.New}
+		switch c.Op {
+		case zk.MetaAdded:
+			e.Op = diffAdded
+		case zk.MetaRemoved:
+			e.Op = diffRemoved
+		}
+		entries = append(entries, e)
+	}
+
+	if this.format == diffJson {
+		this.Ui.Output(view.Render(entries))
+		return
+	}
+
+	this.Ui.Output(fmt.Sprintf("zone[%s] changes since %s", this.zone, old.Ctime.Format("2006-01-02 15:04:05")))
+	if len(entries) > 0 {
+		this.Ui.Output(view.Render(entries))
+	}
+	this.Ui.Output(fmt.Sprintf("%d changes", len(entries)))
+}
+
+func (*Diff) Synopsis() string {
+	return "Display kafka metadata changes of a zone between 2 points in time"
+}
+
+func (this *Diff) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s diff [options]
+
+    %s
+
+    Take a snapshot:
+      %s diff -z prod -export meta.json
+
+    Later on, find out what changed since the snapshot:
+      %s diff -z prod -since meta.json
+
+Options:
+
+    -z zone
+
+    -c cluster pattern
+
+    -since file
+      Snapshot file exported before.
+
+    -export file
+      Export current snapshot of clusters/brokers/topics/partitions/replicas to file.
+
+    -leader
+      Also display leader and isr changes.
+
+    -format side|unified|json
+      Output format of changes, default unified.
+
+`, this.Cmd, this.Synopsis(), this.Cmd, this.Cmd)
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,126 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/funkygao/golib/color"
+	"github.com/ryanuber/columnize"
+)
+
+const (
+	diffAdded   = "added"
+	diffRemoved = "removed"
+	diffChanged = "changed"
+
+	diffSideBySide = "side"
+	diffUnified    = "unified"
+	diffJson       = "json"
+)
+
+// diffEntry is a single difference between the left and right side, located by the path,
+// e,g. cluster/topic/dimension. left is empty if added, right is empty if removed.
+type diffEntry struct {
+	Op    string   `json:"op"`
+	Path  []string `json:"path"`
+	Left  string   `json:"left,omitempty"`
+	Right string   `json:"right,omitempty"`
+}
+
+func newDiffEntry(left, right string, path ...string) diffEntry {
+	op := diffChanged
+	switch {
+	case left == "":
+		op = diffAdded
+	case right == "":
+		op = diffRemoved
+	}
+	return diffEntry{Op: op, Path: path, Left: left, Right: right}
+}
+
+// diffView renders differences for the verify/compare commands in one of the formats:
+//
+//	side     column aligned path and both sides, the default
+//	unified  -/+ lines as diff -u
+//	json     array of diffEntry for scripts
+type diffView struct {
+	format      string
+	left, right string   // titles of both sides, e,g. zone names
+	pathHeaders []string // column titles of path in side by side format
+}
+
+func newDiffView(format, left, right string, pathHeaders ...string) (*diffView, error) {
+	switch format {
+	case diffSideBySide, diffUnified, diffJson:
+	default:
+		return nil, fmt.Errorf("invalid diff format: %s", format)
+	}
+
+	return &diffView{format: format, left: left, right: right, pathHeaders: pathHeaders}, nil
+}
+
+func (this *diffView) Render(entries []diffEntry) string {
+	switch this.format {
+	case diffJson:
+		if entries == nil {
+			entries = []diffEntry{}
+		}
+		b, _ := json.MarshalIndent(entries, "", "    ")
+		return string(b)
+
+	case diffUnified:
+		return this.unified(entries)
+
+	default:
+		return this.sideBySide(entries)
+	}
+}
+
+func (this *diffView) sideBySide(entries []diffEntry) string {
+	lines := []string{strings.Join(append(append([]string{}, this.pathHeaders...), this.left, this.right), "|")}
+	for _, e := range entries {
+		cols := make([]string, len(this.pathHeaders), len(this.pathHeaders)+2)
+		copy(cols, e.Path)
+
+		left, right := e.Left, e.Right
+		switch e.Op {
+		case diffAdded:
+			left, right = color.Red("-"), color.Green("%s", right)
+		case diffRemoved:
+			left, right = color.Red("%s", left), color.Red("-")
+		default:
+			left, right = color.Yellow("%s", left), color.Yellow("%s", right)
+		}
+		lines = append(lines, strings.Join(append(cols, left, right), "|"))
+	}
+
+	return columnize.SimpleFormat(lines)
+}
+
+func (this *diffView) unified(entries []diffEntry) string {
+	lines := []string{color.Red("--- %s", this.left), color.Green("+++ %s", this.right)}
+	for _, e := range entries {
+		path := strings.Join(nonEmpty(e.Path), " ")
+		switch e.Op {
+		case diffAdded:
+			lines = append(lines, color.Green("+ %s: %s", path, e.Right))
+		case diffRemoved:
+			lines = append(lines, color.Red("- %s: %s", path, e.Left))
+		default:
+			lines = append(lines, color.Red("- %s: %s", path, e.Left), color.Green("+ %s: %s", path, e.Right))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func nonEmpty(s []string) []string {
+	r := make([]string, 0, len(s))
+	for _, v := range s {
+		if v != "" {
+			r = append(r, v)
+		}
+	}
+	return r
+}
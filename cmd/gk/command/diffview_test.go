@@ -0,0 +1,43 @@
+package command
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestNewDiffEntry(t *testing.T) {
+	assert.Equal(t, diffAdded, newDiffEntry("", "6", "trade", "partitions", "orders").Op)
+	assert.Equal(t, diffRemoved, newDiffEntry("6", "", "trade", "partitions", "orders").Op)
+	assert.Equal(t, diffChanged, newDiffEntry("6", "8", "trade", "partitions", "orders").Op)
+}
+
+func TestDiffViewRender(t *testing.T) {
+	_, err := newDiffView("html", "prod", "dr")
+	assert.NotEqual(t, nil, err)
+
+	entries := []diffEntry{
+		newDiffEntry("6", "8", "trade", "partitions", "orders"),
+		newDiffEntry("", "v1*3", "trade", "broker versions", ""),
+	}
+
+	view, err := newDiffView(diffJson, "prod", "dr")
+	assert.Equal(t, nil, err)
+	var decoded []diffEntry
+	assert.Equal(t, nil, json.Unmarshal([]byte(view.Render(entries)), &decoded))
+	assert.Equal(t, entries, decoded)
+	assert.Equal(t, "[]", view.Render(nil))
+
+	view, _ = newDiffView(diffUnified, "prod", "dr")
+	out := view.Render(entries)
+	assert.Equal(t, true, strings.Contains(out, "- trade partitions orders: 6"))
+	assert.Equal(t, true, strings.Contains(out, "+ trade partitions orders: 8"))
+	assert.Equal(t, true, strings.Contains(out, "+ trade broker versions: v1*3"))
+
+	view, _ = newDiffView(diffSideBySide, "prod", "dr", "Cluster", "Dimension", "Topic")
+	lines := strings.Split(view.Render(entries), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, []string{"Cluster", "Dimension", "Topic", "prod", "dr"}, strings.Fields(lines[0]))
+}
@@ -0,0 +1,313 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/ryanuber/columnize"
+	zklib "github.com/samuel/go-zookeeper/zk"
+)
+
+type DisableTopic struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone, cluster, topic string
+	grace, interval      time.Duration
+	force                bool
+}
+
+func (this *DisableTopic) Run(args []string) (exitCode int) {
+	var (
+		listMode bool
+		undo     bool
+	)
+	cmdFlags := flag.NewFlagSet("disable-topic", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.StringVar(&this.topic, "t", "", "")
+	cmdFlags.DurationVar(&this.grace, "grace", time.Hour*24, "")
+	cmdFlags.DurationVar(&this.interval, "i", time.Minute, "")
+	cmdFlags.BoolVar(&this.force, "force", false, "")
+	cmdFlags.BoolVar(&listMode, "l", false, "")
+	cmdFlags.BoolVar(&undo, "undo", false, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	if listMode {
+		this.listDisabledTopics(zkzone)
+		return
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-c", "-t").
+		requireAdminRights("-c").
+		invalid(args) {
+		return 2
+	}
+
+	dsn, err := zkzone.KatewayMysqlDsn()
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	db, err := dbx.Open("mysql", dsn)
+	swallow(err)
+	defer db.Close()
+
+	zkcluster := zkzone.NewCluster(this.cluster)
+	if undo {
+		swallow(this.setPubStatus(zkcluster, db, 1))
+		swallow(zkzone.EnableTopic(this.cluster, this.topic))
+		this.Ui.Info(fmt.Sprintf("%s/%s enabled again", this.cluster, this.topic))
+		return
+	}
+
+	if !this.topicExists(zkcluster) {
+		this.Ui.Error(fmt.Sprintf("%s/%s not found", this.cluster, this.topic))
+		return 1
+	}
+
+	meta, err := this.disable(zkcluster, db)
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	if err = this.waitDrainedAndDelete(zkcluster, meta); err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	return
+}
+
+// disable revokes Pub of the topic and marks it disabled in zk, resuming an earlier
+// disable if already marked.
+func (this *DisableTopic) disable(zkcluster *zk.ZkCluster, db *dbx.DB) (*zk.DisabledTopicMeta, error) {
+	zkzone := zkcluster.ZkZone()
+	meta, err := zkzone.DisabledTopic(this.cluster, this.topic)
+	if err != nil {
+		return nil, err
+	}
+	if meta != nil {
+		this.Ui.Info(fmt.Sprintf("%s/%s disabled by %s since %s, resumed",
+			this.cluster, this.topic, meta.By, meta.Since.Format(time.RFC3339)))
+		return meta, nil
+	}
+
+	if err = this.setPubStatus(zkcluster, db, 0); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	meta = &zk.DisabledTopicMeta{
+		Cluster:  this.cluster,
+		Topic:    this.topic,
+		Since:    now,
+		Deadline: now.Add(this.grace),
+		By:       ctx.CurrentUser(),
+	}
+	if err = zkzone.DisableTopic(*meta); err != nil && err != zklib.ErrNodeExists {
+		return nil, err
+	}
+
+	this.Ui.Info(fmt.Sprintf("%s/%s disabled, will be deleted after %s", this.cluster, this.topic,
+		meta.Deadline.Format(time.RFC3339)))
+	return meta, nil
+}
+
+// setPubStatus switches Pub permission of a PubSub topic in the manager db.
+func (this *DisableTopic) setPubStatus(zkcluster *zk.ZkCluster, db *dbx.DB, status int) error {
+	appid, topic, ok := parsePubsubTopic(this.topic)
+	if !ok {
+		this.Ui.Warn(fmt.Sprintf("%s is not a PubSub topic, Pub permission untouched", this.topic))
+		return nil
+	}
+
+	// manager authorizes Pub by appid and topic regardless of the version
+	if siblings := this.siblingVersions(zkcluster, appid, topic); len(siblings) > 0 {
+		this.Ui.Warn(fmt.Sprintf("Pub of other versions also affected: %+v", siblings))
+	}
+
+	_, err := db.Update("topic", dbx.Params{"Status": status}, dbx.HashExp{
+		"AppId":     appid,
+		"TopicName": topic,
+	}).Execute()
+	return err
+}
+
+func (this *DisableTopic) siblingVersions(zkcluster *zk.ZkCluster, appid, topic string) []string {
+	topics, err := zkcluster.Topics()
+	swallow(err)
+
+	var r []string
+	for _, t := range topics {
+		if a, tp, ok := parsePubsubTopic(t); ok && a == appid && tp == topic && t != this.topic {
+			r = append(r, t)
+		}
+	}
+	return r
+}
+
+func (this *DisableTopic) topicExists(zkcluster *zk.ZkCluster) bool {
+	topics, err := zkcluster.Topics()
+	swallow(err)
+
+	for _, t := range topics {
+		if t == this.topic {
+			return true
+		}
+	}
+	return false
+}
+
+// waitDrainedAndDelete deletes the topic once the grace period is over and all consumer
+// groups have drained it.
+func (this *DisableTopic) waitDrainedAndDelete(zkcluster *zk.ZkCluster, meta *zk.DisabledTopicMeta) error {
+	for {
+		lags, err := this.consumerLags(zkcluster)
+		if err != nil {
+			return err
+		}
+
+		remaining := meta.Deadline.Sub(time.Now())
+		if len(lags) == 0 {
+			this.Ui.Output(fmt.Sprintf("%s all consumers drained, grace left %s",
+				time.Now().Format("15:04:05"), this.graceLeft(remaining)))
+		} else {
+			this.Ui.Output(fmt.Sprintf("%s grace left %s, undrained groups: %s",
+				time.Now().Format("15:04:05"), this.graceLeft(remaining), color.Yellow("%+v", lags)))
+		}
+
+		if remaining <= 0 {
+			if len(lags) == 0 || this.force {
+				break
+			}
+
+			this.Ui.Warn("grace period is over but consumers not drained yet, use -force to delete anyway")
+		}
+
+		time.Sleep(this.interval)
+	}
+
+	this.Ui.Info(fmt.Sprintf("deleting kafka topic: %s", this.topic))
+	lines, err := zkcluster.DeleteTopic(this.topic)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		this.Ui.Output(color.Yellow(l))
+	}
+
+	return zkcluster.ZkZone().EnableTopic(this.cluster, this.topic)
+}
+
+// consumerLags returns {group: lag} of online consumer groups still lagging behind on the topic.
+// Offline groups are ignored: they might have been abandoned long ago.
+func (this *DisableTopic) consumerLags(zkcluster *zk.ZkCluster) (map[string]int64, error) {
+	consumers, err := zkcluster.ConsumerGroupsOfTopic(this.topic)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[string]int64)
+	for group, metas := range consumers {
+		for _, m := range metas {
+			if m.Online && m.Lag > 0 {
+				r[group] += m.Lag
+			}
+		}
+	}
+	return r, nil
+}
+
+func (this *DisableTopic) graceLeft(d time.Duration) string {
+	if d <= 0 {
+		return "0"
+	}
+
+	return d.String()
+}
+
+func (this *DisableTopic) listDisabledTopics(zkzone *zk.ZkZone) {
+	var lines []string
+	for _, m := range zkzone.DisabledTopics() {
+		lines = append(lines, fmt.Sprintf("%s|%s|%s|%s|%s", m.Deadline.Format(time.RFC3339),
+			m.Cluster, m.Topic, m.By, m.Since.Format(time.RFC3339)))
+	}
+	sort.Strings(lines) // by deadline
+
+	lines = append([]string{"Deadline|Cluster|Topic|By|Since"}, lines...)
+	this.Ui.Output(columnize.SimpleFormat(lines))
+}
+
+// parsePubsubTopic parses PubSub kafka topic of format appid.topic.ver[.suffix].
+func parsePubsubTopic(kafkaTopic string) (appid, topic string, ok bool) {
+	tuples := strings.SplitN(kafkaTopic, ".", 3)
+	if len(tuples) != 3 || tuples[1] == "" {
+		return
+	}
+
+	if _, err := strconv.ParseInt(tuples[0], 10, 64); err != nil {
+		return
+	}
+
+	return tuples[0], tuples[1], true
+}
+
+func (*DisableTopic) Synopsis() string {
+	return "Soft delete a kafka topic with grace period"
+}
+
+func (this *DisableTopic) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s disable-topic [options]
+
+    %s
+
+    Pub of the topic is revoked in manager db and the topic is marked disabled in zk,
+    after the grace period and all consumer groups drained it, the topic is deleted.
+    It is safe to interrupt and rerun: the grace period is resumed from the mark.
+
+Options:
+
+    -z zone
+      Default %s
+
+    -c cluster
+
+    -t topic
+
+    -grace duration
+      Default 24h
+
+    -i interval
+      Interval of checking consumer groups lag.
+      Default 1m
+
+    -force
+      Delete the topic when grace period is over even if consumers not drained.
+
+    -l
+      List disabled topics pending deletion.
+
+    -undo
+      Enable the disabled topic again before it is deleted.
+
+`, this.Cmd, this.Synopsis(), ctx.ZkDefaultZone())
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,146 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/funkygao/golib/signal"
+)
+
+type Events struct {
+	Ui  cli.Ui
+	Cmd string
+
+	cluster string
+}
+
+func (this *Events) Run(args []string) (exitCode int) {
+	var (
+		zone   string
+		follow bool
+		since  time.Duration
+	)
+	cmdFlags := flag.NewFlagSet("events", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.BoolVar(&follow, "f", false, "")
+	cmdFlags.DurationVar(&since, "since", time.Hour, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	ensureZoneValid(zone)
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
+	defer zkzone.Close()
+
+	if !follow {
+		var evts []zk.ClusterEvent
+		zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+			if patternMatched(zkcluster.Name(), this.cluster) {
+				evts = append(evts, zkcluster.RecentEvents(time.Now().Add(-since))...)
+			}
+		})
+
+		sort.Sort(zk.ClusterEventsByTime(evts))
+		for _, evt := range evts {
+			this.printEvent(evt)
+		}
+		return
+	}
+
+	var (
+		stopper = make(chan struct{})
+		merged  = make(chan zk.ClusterEvent, 100)
+		wg      sync.WaitGroup
+	)
+	zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+		if !patternMatched(zkcluster.Name(), this.cluster) {
+			return
+		}
+
+		wg.Add(1)
+		go func(evts <-chan zk.ClusterEvent) {
+			defer wg.Done()
+
+			for evt := range evts {
+				merged <- evt
+			}
+		}(zkcluster.WatchEvents(stopper))
+	})
+
+	var once sync.Once
+	signal.RegisterHandler(func(sig os.Signal) {
+		once.Do(func() {
+			close(stopper)
+		})
+	}, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	this.Ui.Info(fmt.Sprintf("watching zone[%s] events, Ctrl-C to quit...", zone))
+	for evt := range merged {
+		this.printEvent(evt)
+	}
+
+	return
+}
+
+func (this *Events) printEvent(evt zk.ClusterEvent) {
+	msg := evt.Message
+	for _, bad := range []string{" down", " gone", " shrunk", " offline"} {
+		if strings.Contains(msg, bad) {
+			msg = color.Red(msg)
+			break
+		}
+	}
+
+	this.Ui.Output(fmt.Sprintf("%s %-15s %-10s %s",
+		evt.Time.Format("2006-01-02 15:04:05"), evt.Cluster, evt.Kind, msg))
+}
+
+func (*Events) Synopsis() string {
+	return "Stream live broker/controller/topic/ISR change events of a zone"
+}
+
+func (this *Events) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s events [options]
+
+    %s
+
+    Without -f, the recent changes are reconstructed from znode timestamps:
+    only the latest change of each znode is known and brokers gone are missing.
+
+Options:
+
+    -z zone
+
+    -c cluster pattern
+
+    -f
+      Follow the changes by zookeeper watches until Ctrl-C.
+      e,g.
+      2017-03-01 10:02:03 trade      broker     broker 5 down 10.1.1.5:10005
+      2017-03-01 10:02:04 trade      leader     leader of trade-3 moved 2→7
+
+    -since duration
+      Without -f, print changes within this duration. Default 1h.
+
+`, this.Cmd, this.Synopsis())
+	return strings.TrimSpace(help)
+}
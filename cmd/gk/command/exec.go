@@ -0,0 +1,255 @@
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+)
+
+// execHost is a broker host of the cluster, which might run several brokers of the cluster.
+type execHost struct {
+	host    string
+	brokers []string // broker ids sorted
+}
+
+type execResult struct {
+	execHost
+	output  string // stdout and stderr
+	err     error
+	elapsed time.Duration
+}
+
+type Exec struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone, cluster string
+	sshUser       string
+	parallel      int
+	timeout       time.Duration
+}
+
+func (this *Exec) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("exec", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.StringVar(&this.sshUser, "user", "", "")
+	cmdFlags.IntVar(&this.parallel, "p", 20, "")
+	cmdFlags.DurationVar(&this.timeout, "timeout", time.Minute, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-c").
+		invalid(args) {
+		return 2
+	}
+
+	remote := strings.Join(cmdFlags.Args(), " ")
+	if strings.TrimSpace(remote) == "" {
+		this.Ui.Error("command required after --")
+		this.Ui.Output(this.Help())
+		return 2
+	}
+
+	ensureZoneValid(this.zone)
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	defer zkzone.Close()
+
+	hosts := brokerHosts(zkzone.NewCluster(this.cluster).Brokers())
+	if len(hosts) == 0 {
+		this.Ui.Error(fmt.Sprintf("%s: no live broker", this.cluster))
+		return 1
+	}
+
+	results := this.execAll(hosts, ctx.ZoneTunnel(this.zone), remote)
+	for _, r := range results {
+		status := color.Green("ok")
+		if r.err != nil {
+			status = color.Red("%s", execFailure(r.err))
+		}
+		this.Ui.Output(color.Cyan("%s broker:%s %s %s", r.host, strings.Join(r.brokers, ","),
+			status, r.elapsed/time.Millisecond*time.Millisecond))
+		if output := strings.TrimRight(r.output, "\n"); output != "" {
+			this.Ui.Output(output)
+		}
+		this.Ui.Output("")
+	}
+
+	if failed := execFailures(results); len(failed) > 0 {
+		this.Ui.Error(fmt.Sprintf("%d/%d hosts failed: %s", len(failed), len(results), strings.Join(failed, ", ")))
+		return 1
+	}
+
+	this.Ui.Info(fmt.Sprintf("%d hosts ok", len(results)))
+	return
+}
+
+// execAll runs the command on the hosts concurrently upto parallel, results are in the order of hosts.
+func (this *Exec) execAll(hosts []execHost, tunnel, remote string) []execResult {
+	var (
+		wg      sync.WaitGroup
+		tokens  = make(chan struct{}, this.parallel)
+		results = make([]execResult, len(hosts))
+	)
+	if this.parallel < 1 {
+		tokens = make(chan struct{}, 1)
+	}
+
+	for i, h := range hosts {
+		wg.Add(1)
+		go func(i int, h execHost) {
+			defer wg.Done()
+
+			tokens <- struct{}{}
+			defer func() { <-tokens }()
+
+			results[i] = this.execOn(h, tunnel, remote)
+		}(i, h)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (this *Exec) execOn(h execHost, tunnel, remote string) execResult {
+	c, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+
+	t0 := time.Now()
+	out, err := exec.CommandContext(c, "ssh", execSshArgs(tunnel, this.sshUser, h.host, remote)...).CombinedOutput()
+	if c.Err() == context.DeadlineExceeded {
+		err = c.Err()
+	}
+
+	return execResult{
+		execHost: h,
+		output:   string(out),
+		err:      err,
+		elapsed:  time.Since(t0),
+	}
+}
+
+// execSshArgs returns the ssh args to run the remote command on host, through the zone tunnel
+// as jump host if any.
+func execSshArgs(tunnel, user, host, remote string) []string {
+	args := []string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=5"}
+	if tunnel != "" {
+		args = append(args, "-J", tunnel)
+	}
+
+	target := host
+	if user != "" {
+		target = user + "@" + host
+	}
+	return append(args, target, remote)
+}
+
+// brokerHosts returns the hosts of the brokers ordered by the lowest broker id on each host.
+func brokerHosts(brokers map[string]*zk.BrokerZnode) []execHost {
+	ids := make([]int, 0, len(brokers))
+	for id := range brokers {
+		n, _ := strconv.Atoi(id)
+		ids = append(ids, n)
+	}
+	sort.Ints(ids)
+
+	var (
+		r     []execHost
+		index = make(map[string]int) // host: index in r
+	)
+	for _, n := range ids {
+		id := strconv.Itoa(n)
+		b, present := brokers[id]
+		if !present {
+			continue
+		}
+
+		if i, present := index[b.Host]; present {
+			r[i].brokers = append(r[i].brokers, id)
+			continue
+		}
+
+		index[b.Host] = len(r)
+		r = append(r, execHost{host: b.Host, brokers: []string{id}})
+	}
+	return r
+}
+
+func execFailure(err error) string {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Exited() {
+			// ssh exits 255 if it fails itself, else the exit code of the command
+			return fmt.Sprintf("exit %d", status.ExitStatus())
+		}
+	}
+
+	if err == context.DeadlineExceeded {
+		return "timeout"
+	}
+	return err.Error()
+}
+
+// execFailures returns the failure summary of each failed host.
+func execFailures(results []execResult) []string {
+	var r []string
+	for _, res := range results {
+		if res.err != nil {
+			r = append(r, fmt.Sprintf("%s(%s)", res.host, execFailure(res.err)))
+		}
+	}
+	return r
+}
+
+func (*Exec) Synopsis() string {
+	return "Run a command over ssh on every broker host of a cluster in parallel"
+}
+
+func (this *Exec) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s exec -c cluster [options] -- command
+
+    %s
+
+    The output of each host is displayed in the order of broker id, followed by the summary
+    of failed hosts. ssh requires key based login, and goes through the tunnel of the zone
+    in ctx as jump host if configured.
+    Exits 1 if the command fails on any host.
+
+    e,g.
+    %s exec -z prod -c trade -- "df -h /data"
+
+Options:
+
+    -z zone
+      Default %s
+
+    -c cluster
+
+    -user ssh user
+
+    -p n
+      Max hosts to run concurrently.
+      Default 20
+
+    -timeout duration
+      Per host timeout.
+      Default 1m
+
+`, this.Cmd, this.Synopsis(), this.Cmd, ctx.ZkDefaultZone())
+	return strings.TrimSpace(help)
+}
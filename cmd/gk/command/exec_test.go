@@ -0,0 +1,44 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/zk"
+)
+
+func TestExecSshArgs(t *testing.T) {
+	args := execSshArgs("", "", "10.1.1.1", "df -h /data")
+	assert.Equal(t, 6, len(args))
+	assert.Equal(t, "df -h /data", args[5]) // passed to the remote shell as is
+
+	args = execSshArgs("ops@jump.test.com", "kafka", "10.1.1.1", "uptime")
+	assert.Equal(t, "-o BatchMode=yes -o ConnectTimeout=5 -J ops@jump.test.com kafka@10.1.1.1 uptime",
+		strings.Join(args, " "))
+}
+
+func TestBrokerHosts(t *testing.T) {
+	hosts := brokerHosts(map[string]*zk.BrokerZnode{
+		"10": {Id: "10", Host: "h2"},
+		"2":  {Id: "2", Host: "h1"},
+		"9":  {Id: "9", Host: "h2"},
+		"1":  {Id: "1", Host: "h3"},
+	})
+	assert.Equal(t, 3, len(hosts))
+	assert.Equal(t, "h3", hosts[0].host)
+	assert.Equal(t, "h1", hosts[1].host)
+	assert.Equal(t, "h2", hosts[2].host)
+	assert.Equal(t, []string{"9", "10"}, hosts[2].brokers)
+}
+
+func TestExecFailures(t *testing.T) {
+	failed := execFailures([]execResult{
+		{execHost: execHost{host: "h1"}},
+		{execHost: execHost{host: "h2"}, err: context.DeadlineExceeded},
+		{execHost: execHost{host: "h3"}, err: errors.New("broken pipe")},
+	})
+	assert.Equal(t, []string{"h2(timeout)", "h3(broken pipe)"}, failed)
+}
@@ -0,0 +1,305 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/funkygao/golib/gofmt"
+)
+
+const grepFetchSize = 1 << 20
+
+type Grep struct {
+	Ui  cli.Ui
+	Cmd string
+
+	pattern  *regexp.Regexp
+	until    time.Time
+	limit    int64
+	matched  int64
+	scanned  int64
+	colorize bool
+
+	throttle <-chan time.Time // fetch requests of all partitions share this budget
+	quit     chan struct{}
+	once     sync.Once
+	uiLock   sync.Mutex
+}
+
+func (this *Grep) Run(args []string) (exitCode int) {
+	var (
+		zone     string
+		cluster  string
+		topic    string
+		pattern  string
+		since    string
+		until    string
+		qps      int
+		parallel int
+	)
+	cmdFlags := flag.NewFlagSet("grep", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&cluster, "c", "", "")
+	cmdFlags.StringVar(&topic, "t", "", "")
+	cmdFlags.StringVar(&pattern, "pattern", "", "")
+	cmdFlags.StringVar(&since, "since", "-1h", "")
+	cmdFlags.StringVar(&until, "until", "", "")
+	cmdFlags.Int64Var(&this.limit, "n", 0, "")
+	cmdFlags.IntVar(&qps, "qps", 20, "")
+	cmdFlags.IntVar(&parallel, "parallel", 8, "")
+	cmdFlags.BoolVar(&this.colorize, "color", true, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-c", "-t", "-pattern").
+		invalid(args) {
+		return 2
+	}
+
+	var err error
+	if this.pattern, err = regexp.Compile(pattern); err != nil {
+		this.Ui.Error(fmt.Sprintf("invalid -pattern: %v", err))
+		return 2
+	}
+
+	now := time.Now()
+	from, err := parseGrepTime(since, now)
+	if err != nil {
+		this.Ui.Error(fmt.Sprintf("invalid -since: %v", err))
+		return 2
+	}
+	this.until = now
+	if until != "" {
+		if this.until, err = parseGrepTime(until, now); err != nil {
+			this.Ui.Error(fmt.Sprintf("invalid -until: %v", err))
+			return 2
+		}
+	}
+	if !from.Before(this.until) {
+		this.Ui.Error("-since must be before -until")
+		return 2
+	}
+	if qps <= 0 || parallel <= 0 {
+		this.Ui.Error("-qps and -parallel must be positive")
+		return 2
+	}
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
+	defer zkzone.Close()
+	zkcluster := zkzone.NewCluster(cluster)
+
+	offsets, err := findOffsetsByTime(zkcluster, topic, from)
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), saramaConfig())
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+	defer kfk.Close()
+
+	ticker := time.NewTicker(time.Second / time.Duration(qps))
+	defer ticker.Stop()
+	this.throttle = ticker.C
+	this.quit = make(chan struct{})
+
+	var (
+		wg     sync.WaitGroup
+		errN   int32
+		tokens = make(chan struct{}, parallel)
+	)
+	for _, o := range offsets {
+		if o.offset >= o.newest {
+			continue
+		}
+
+		wg.Add(1)
+		go func(o partitionTimeOffset) {
+			defer wg.Done()
+
+			tokens <- struct{}{}
+			defer func() { <-tokens }()
+
+			if err := this.grepPartition(kfk, topic, o); err != nil {
+				atomic.AddInt32(&errN, 1)
+				this.output(color.Red("%s/%d: %v", topic, o.partition, err))
+			}
+		}(o)
+	}
+	wg.Wait()
+
+	this.Ui.Output(fmt.Sprintf("%s matched in %s scanned messages within [%s, %s), %s",
+		gofmt.Comma(atomic.LoadInt64(&this.matched)), gofmt.Comma(atomic.LoadInt64(&this.scanned)),
+		from.Format(offsetFindTimeLayout), this.until.Format(offsetFindTimeLayout), time.Since(now)))
+	if errN > 0 {
+		return 1
+	}
+
+	return
+}
+
+// grepPartition scans a partition from the offset till the newest offset or the first message
+// produced after until.
+func (this *Grep) grepPartition(kfk sarama.Client, topic string, o partitionTimeOffset) error {
+	leader, err := kfk.Leader(topic, o.partition)
+	if err != nil {
+		return err
+	}
+
+	for offset := o.offset; offset < o.newest; {
+		select {
+		case <-this.quit:
+			return nil
+		case <-this.throttle:
+		}
+
+		req := &sarama.FetchRequest{MaxWaitTime: 1000, MinBytes: 1}
+		req.AddBlock(topic, o.partition, offset, grepFetchSize)
+		resp, err := leader.Fetch(req)
+		if err != nil {
+			return err
+		}
+
+		block := resp.GetBlock(topic, o.partition)
+		if block == nil {
+			return fmt.Errorf("empty fetch response")
+		}
+		if block.Err != sarama.ErrNoError {
+			return block.Err
+		}
+
+		msgs := flattenMessageSet(block.MsgSet.Messages)
+		if len(msgs) == 0 {
+			return fmt.Errorf("offset %d: message larger than %s", offset, gofmt.ByteSize(grepFetchSize))
+		}
+
+		for _, mb := range msgs {
+			if mb.Offset < offset {
+				// compressed message set starts before the offset
+				continue
+			}
+			if mb.Offset >= o.newest {
+				return nil
+			}
+			if mb.Msg.Version >= 1 && !mb.Msg.Timestamp.IsZero() && !mb.Msg.Timestamp.Before(this.until) {
+				return nil
+			}
+
+			offset = mb.Offset + 1
+			atomic.AddInt64(&this.scanned, 1)
+			if !this.pattern.Match(mb.Msg.Key) && !this.pattern.Match(mb.Msg.Value) {
+				continue
+			}
+
+			this.display(topic, o.partition, mb)
+			if n := atomic.AddInt64(&this.matched, 1); this.limit > 0 && n >= this.limit {
+				this.once.Do(func() { close(this.quit) })
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+func (this *Grep) display(topic string, partitionId int32, mb *sarama.MessageBlock) {
+	header := fmt.Sprintf("%s/%d offset %d", topic, partitionId, mb.Offset)
+	if mb.Msg.Version >= 1 {
+		header += " " + mb.Msg.Timestamp.Format(offsetFindTimeLayout)
+	}
+	if this.colorize {
+		header = color.Green(header)
+	}
+
+	_, value := splitKatewayTag(mb.Msg.Value)
+	line := header
+	if len(mb.Msg.Key) > 0 {
+		line += fmt.Sprintf(" key:%s", string(mb.Msg.Key))
+	}
+	this.output(line + " " + string(value))
+}
+
+func (this *Grep) output(s string) {
+	this.uiLock.Lock()
+	this.Ui.Output(s)
+	this.uiLock.Unlock()
+}
+
+// parseGrepTime parses either a duration relative to now like -2h or an absolute local time.
+func parseGrepTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(strings.TrimPrefix(s, "-")); err == nil {
+		return now.Add(-d), nil
+	}
+
+	return time.ParseInLocation(offsetFindTimeLayout, s, time.Local)
+}
+
+func (*Grep) Synopsis() string {
+	return "Search message payloads of a topic within a time range"
+}
+
+func (this *Grep) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s grep [options]
+
+    %s
+
+    All partitions are consumed in parallel from the offsets of -since,
+    and messages whose key or value matches the pattern are printed with partition/offset.
+
+    e,g.
+    %s grep -z prod -c trade -t order -since -2h -pattern "orderId=12345"
+
+Options:
+
+    -z zone
+      Default %s
+
+    -c cluster
+
+    -t topic
+
+    -pattern regexp
+      Go regular expression matched against message key and value.
+      Prefix with (?i) for case insensitive match.
+
+    -since time
+      Either duration before now, e,g. -2h, or local time in format '%s'.
+      Default -1h.
+
+    -until time
+      Same format as -since, default now.
+
+    -n limit
+      Stop after N matched messages, default 0 means unlimited.
+
+    -qps n
+      Max fetch requests per second to the brokers across all partitions.
+      Each fetch returns at most %s of messages.
+      Default 20.
+
+    -parallel n
+      Max partitions scanned concurrently, default 8.
+
+    -color
+      Default true.
+
+`, this.Cmd, this.Synopsis(), this.Cmd, ctx.ZkDefaultZone(), offsetFindTimeLayout, gofmt.ByteSize(grepFetchSize))
+	return strings.TrimSpace(help)
+}
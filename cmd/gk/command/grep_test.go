@@ -0,0 +1,26 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestParseGrepTime(t *testing.T) {
+	now := time.Now()
+	t1, err := parseGrepTime("-2h", now)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, now.Add(-2*time.Hour), t1)
+
+	t1, err = parseGrepTime("30m", now)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, now.Add(-30*time.Minute), t1)
+
+	t1, err = parseGrepTime("2017-03-01 10:00:00", now)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 10, t1.Hour())
+
+	_, err = parseGrepTime("yesterday", now)
+	assert.NotEqual(t, nil, err)
+}
@@ -25,15 +25,32 @@ type Haproxy struct {
 }
 
 func (this *Haproxy) Run(args []string) (exitCode int) {
-	var topMode bool
+	var (
+		topMode   bool
+		fleetMode bool
+	)
 	cmdFlags := flag.NewFlagSet("haproxy", flag.ContinueOnError)
 	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
-	cmdFlags.StringVar(&this.zone, "z", ctx.DefaultZone(), "")
+	cmdFlags.StringVar(&this.zone, "z", "", "")
 	cmdFlags.BoolVar(&topMode, "top", true, "")
+	cmdFlags.BoolVar(&fleetMode, "fleet", false, "")
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
+	if fleetMode {
+		zones := ctx.SortedZones()
+		if this.zone != "" {
+			zones = []string{this.zone}
+		}
+		this.showFleet(zones)
+		return
+	}
+
+	if this.zone == "" {
+		this.zone = ctx.DefaultZone()
+	}
+
 	zone := ctx.Zone(this.zone)
 	if topMode {
 		header, _ := this.getStats(zone.HaProxyStatsUri[0])
@@ -183,10 +200,16 @@ Usage: %s haproxy [options]
 Options:
 
     -z zone
+      Default %s
 
     -top
       Top mode
 
-`, this.Cmd, this.Synopsis())
+    -fleet
+      Display ehaproxy instances side by side: backend membership, sessions,
+      error rate and config generation time.
+      Across all zones unless -z is specified.
+
+`, this.Cmd, this.Synopsis(), ctx.DefaultZone())
 	return strings.TrimSpace(help)
 }
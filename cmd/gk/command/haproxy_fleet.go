@@ -0,0 +1,177 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/golib/color"
+	"github.com/funkygao/golib/gofmt"
+	"github.com/ryanuber/columnize"
+)
+
+// ehaproxyState is the state of an ehaproxy instance collected from its admin endpoints.
+type ehaproxyState struct {
+	host string
+	err  error
+
+	ver       string
+	uptime    time.Time
+	generated time.Time // when haproxy config generated
+
+	backends map[string][]string         // svc:sorted kateway addrs
+	stats    map[string]map[string]int64 // svc:col:value
+}
+
+func (this *ehaproxyState) membership() string {
+	return fmt.Sprintf("%v|%v|%v", this.backends["pub"], this.backends["sub"], this.backends["man"])
+}
+
+func (this *ehaproxyState) sum(col string) (n int64) {
+	for _, stats := range this.stats {
+		n += stats[col]
+	}
+	return
+}
+
+// showFleet displays ehaproxy instances of the zones side by side.
+func (this *Haproxy) showFleet(zones []string) {
+	for _, zone := range zones {
+		uris := ctx.Zone(zone).HaProxyStatsUri
+		if len(uris) == 0 {
+			continue
+		}
+
+		states := make([]*ehaproxyState, len(uris))
+		var wg sync.WaitGroup
+		for i, uri := range uris {
+			wg.Add(1)
+			go func(i int, uri string) {
+				defer wg.Done()
+
+				states[i] = fetchEhaproxyState(uri)
+			}(i, uri)
+		}
+		wg.Wait()
+
+		this.Ui.Output(color.Blue(zone))
+		this.Ui.Output(columnize.SimpleFormat(this.fleetLines(states)))
+	}
+}
+
+func (this *Haproxy) fleetLines(states []*ehaproxyState) []string {
+	// the membership most instances agree on
+	votes := make(map[string]int)
+	for _, s := range states {
+		if s.err == nil {
+			votes[s.membership()]++
+		}
+	}
+	var majority string
+	for m, n := range votes {
+		if n > votes[majority] || (n == votes[majority] && m < majority) {
+			majority = m
+		}
+	}
+
+	lines := []string{"Host|Ver|Uptime|Config|Pub|Sub|Man|Sessions|Total|5xx%|ConnErr|Members"}
+	for _, s := range states {
+		if s.err != nil {
+			lines = append(lines, fmt.Sprintf("%s|-|-|-|-|-|-|-|-|-|-|%s", s.host, color.Red(s.err.Error())))
+			continue
+		}
+
+		members := "ok"
+		if s.membership() != majority {
+			members = color.Red("diverged")
+		}
+
+		generated := "-"
+		if s.generated.Unix() > 0 {
+			generated = gofmt.PrettySince(s.generated)
+		}
+
+		total := s.sum("stot")
+		errRate := "-"
+		if total > 0 {
+			errRate = fmt.Sprintf("%.2f", float64(s.sum("hrsp_5xx"))*100/float64(total))
+		}
+
+		lines = append(lines, fmt.Sprintf("%s|%s|%s|%s|%d|%d|%d|%s|%s|%s|%s|%s",
+			s.host, s.ver, gofmt.PrettySince(s.uptime), generated,
+			len(s.backends["pub"]), len(s.backends["sub"]), len(s.backends["man"]),
+			gofmt.Comma(s.sum("scur")), gofmt.Comma(total), errRate, gofmt.Comma(s.sum("econ")),
+			members))
+	}
+
+	return lines
+}
+
+// fetchEhaproxyState derives the admin endpoints from the stats uri of an ehaproxy instance.
+func fetchEhaproxyState(statsUri string) *ehaproxyState {
+	s := &ehaproxyState{host: statsUri}
+	u, err := url.Parse(statsUri)
+	if err != nil {
+		s.err = err
+		return s
+	}
+
+	s.host = u.Host
+	base := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+
+	var ver map[string]string
+	if s.err = getJson(base+"/v1/ver", &ver); s.err != nil {
+		return s
+	}
+	s.ver = ver["version"]
+	if ts, err := strconv.ParseInt(ver["uptime"], 10, 64); err == nil {
+		s.uptime = time.Unix(ts, 0)
+	}
+
+	if s.err = getJson(statsUri, &s.stats); s.err != nil {
+		return s
+	}
+
+	var backends struct {
+		Generated int64    `json:"generated"`
+		Pub       []string `json:"pub"`
+		Sub       []string `json:"sub"`
+		Man       []string `json:"man"`
+	}
+	if s.err = getJson(base+"/v1/backends", &backends); s.err != nil {
+		return s
+	}
+	s.generated = time.Unix(backends.Generated, 0)
+	s.backends = map[string][]string{
+		"pub": backends.Pub,
+		"sub": backends.Sub,
+		"man": backends.Man,
+	}
+	for _, addrs := range s.backends {
+		sort.Strings(addrs)
+	}
+
+	return s
+}
+
+func getJson(uri string, v interface{}) error {
+	client := http.Client{Timeout: time.Second * 10}
+	resp, err := client.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", strings.TrimPrefix(uri, "http://"), resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
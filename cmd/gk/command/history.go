@@ -0,0 +1,237 @@
+package command
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/ryanuber/columnize"
+)
+
+const historyFilename = ".gk_history"
+
+// HistoryEvent is an invocation of gk that changes something.
+type HistoryEvent struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Host   string    `json:"host"`
+	Zone   string    `json:"zone"`
+	Cmd    string    `json:"cmd"`
+	Exit   int       `json:"exit"`
+	Err    string    `json:"err,omitempty"`
+	Elapse string    `json:"elapse"`
+}
+
+// Mutating returns whether this gk invocation changes anything: either it requires admin
+// rights or it ever writes zk.
+func Mutating() bool {
+	return adminInvoked || zk.Mutated()
+}
+
+// RecordHistory appends the gk invocation to the local ledger $HOME/.gk_history, and
+// sends it to the central kafka topic if gk_history is configured.
+func RecordHistory(args []string, startedAt time.Time, exitCode int, err error) error {
+	evt := HistoryEvent{
+		Time:   startedAt,
+		User:   ctx.CurrentUser(),
+		Host:   ctx.Hostname(),
+		Zone:   historyZone(args),
+		Cmd:    strings.Join(args, " "),
+		Exit:   exitCode,
+		Elapse: time.Since(startedAt).String(),
+	}
+	if err != nil {
+		evt.Err = err.Error()
+	}
+
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+
+	fn, err := historyFile()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fn, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	if spec := ctx.GkHistory(); spec != "" {
+		return sendHistory(spec, b)
+	}
+	return nil
+}
+
+// sendHistory produces the history event to kafka:host1:9092,host2:9092/topic.
+func sendHistory(spec string, evt []byte) error {
+	p := strings.LastIndex(spec, "/")
+	if !strings.HasPrefix(spec, "kafka:") || p <= len("kafka:") || p == len(spec)-1 {
+		return fmt.Errorf("invalid gk_history: %s", spec)
+	}
+
+	cf := saramaConfig()
+	cf.Producer.RequiredAcks = sarama.WaitForAll
+	cf.Producer.Return.Successes = true
+	producer, err := sarama.NewSyncProducer(strings.Split(spec[len("kafka:"):p], ","), cf)
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	_, _, err = producer.SendMessage(&sarama.ProducerMessage{
+		Topic: spec[p+1:],
+		Value: sarama.ByteEncoder(evt),
+	})
+	return err
+}
+
+func historyFile() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(usr.HomeDir, historyFilename), nil
+}
+
+// historyZone returns the zone of gk invocation args, which starts with the sub command.
+func historyZone(args []string) string {
+	for i := 1; i < len(args)-1; i++ {
+		if args[i] == "-z" {
+			return args[i+1]
+		}
+	}
+
+	return ctx.ZkDefaultZone()
+}
+
+type History struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone    string
+	pattern string
+	limit   int
+}
+
+func (this *History) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("history", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", "", "")
+	cmdFlags.StringVar(&this.pattern, "grep", "", "")
+	cmdFlags.IntVar(&this.limit, "n", 50, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	fn, err := historyFile()
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			this.Ui.Output("no history")
+			return
+		}
+
+		this.Ui.Error(err.Error())
+		return 1
+	}
+	defer f.Close()
+
+	var events []HistoryEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var evt HistoryEvent
+		if err = json.Unmarshal(scanner.Bytes(), &evt); err != nil {
+			continue
+		}
+
+		if this.matched(evt) {
+			events = append(events, evt)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	if this.limit > 0 && len(events) > this.limit {
+		events = events[len(events)-this.limit:]
+	}
+
+	lines := []string{"Time|User|Zone|Exit|Elapse|Command"}
+	for _, evt := range events {
+		cmd := evt.Cmd
+		if evt.Err != "" {
+			cmd += " => " + evt.Err
+		}
+		lines = append(lines, fmt.Sprintf("%s|%s|%s|%d|%s|%s",
+			evt.Time.Format("2006-01-02 15:04:05"), evt.User, evt.Zone, evt.Exit, evt.Elapse,
+			strings.Replace(cmd, "|", " ", -1)))
+	}
+	this.Ui.Output(columnize.SimpleFormat(lines))
+
+	return
+}
+
+func (this *History) matched(evt HistoryEvent) bool {
+	if this.zone != "" && evt.Zone != this.zone {
+		return false
+	}
+
+	return this.pattern == "" || strings.Contains(evt.Cmd, this.pattern)
+}
+
+func (*History) Synopsis() string {
+	return "Display history of the administrative gk commands"
+}
+
+func (this *History) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s history [options]
+
+    %s
+
+    Each gk invocation that requires admin rights or writes zookeeper is recorded
+    with user, time, zone, full args and result to $HOME/%s.
+    If 'gk_history' is configured in $HOME/.gafka.cf, it is also sent to the central kafka topic:
+
+      gk_history: "kafka:host1:9092,host2:9092/gk_history"
+
+Options:
+
+    -z zone
+      Only show commands of this zone.
+
+    -grep pattern
+      Only show commands containing the pattern, e,g. topic name.
+
+    -n limit
+      Show the latest N commands, default 50.
+      0 means all.
+
+`, this.Cmd, this.Synopsis(), historyFilename)
+	return strings.TrimSpace(help)
+}
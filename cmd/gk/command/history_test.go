@@ -0,0 +1,20 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestHistoryZone(t *testing.T) {
+	assert.Equal(t, "prod", historyZone([]string{"topics", "-z", "prod", "-add", "foo"}))
+	assert.Equal(t, "test", historyZone([]string{"migrate", "-c", "trade", "-z", "test"}))
+}
+
+func TestHistoryMatched(t *testing.T) {
+	evt := HistoryEvent{Zone: "prod", Cmd: "topics -z prod -c trade -add order"}
+	assert.Equal(t, true, (&History{}).matched(evt))
+	assert.Equal(t, true, (&History{zone: "prod", pattern: "order"}).matched(evt))
+	assert.Equal(t, false, (&History{zone: "test"}).matched(evt))
+	assert.Equal(t, false, (&History{pattern: "payment"}).matched(evt))
+}
@@ -348,18 +348,20 @@ func (this *Kateway) installGuide(zkzone *zk.ZkZone) {
 	}
 	nextId++
 
-	zone := ctx.Zone(this.zone)
-	influxAddr := zone.InfluxAddr
+	influxAddr, influxDB := ctx.ZoneInfluxDB(this.zone)
 	if influxAddr != "" && !strings.HasPrefix(influxAddr, "http://") {
 		influxAddr = "http://" + influxAddr
 	}
 	var influxInfo string
 	if influxAddr != "" {
 		influxInfo = "-influxdbaddr " + influxAddr
+		if influxDB != "" {
+			influxInfo += " -influxdbname " + influxDB
+		}
 	}
 
-	this.Ui.Output(fmt.Sprintf(`nohup ./sbin/kateway -zone prod -id %d -debughttp ":10194" -level trace -log kateway.log -crashlog panic %s &`,
-		nextId, influxInfo))
+	this.Ui.Output(fmt.Sprintf(`nohup ./sbin/kateway -zone %s -id %d -debughttp ":10194" -level trace -log kateway.log -crashlog panic %s &`,
+		this.zone, nextId, influxInfo))
 	this.Ui.Output("")
 
 	this.Ui.Output("yum install -y logstash")
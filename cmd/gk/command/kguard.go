@@ -45,15 +45,21 @@ func (this *Kguard) Run(args []string) (exitCode int) {
 		gofmt.PrettySince(leader.Ctime)))
 
 	if this.longFmt {
-		this.showKguardVersion(leader.Host)
-		this.showStats(leader.Host)
+		// the zone kguard addr is preferred, e,g. a VIP that always points to the leader
+		addr := ctx.ZoneKguardAddr(this.zone)
+		if addr == "" {
+			addr = fmt.Sprintf("%s:10025", leader.Host)
+		}
+
+		this.showKguardVersion(addr)
+		this.showStats(addr)
 	}
 
 	return
 }
 
-func (this *Kguard) showStats(host string) {
-	url := fmt.Sprintf("http://%s:10025/metrics", host)
+func (this *Kguard) showStats(addr string) {
+	url := fmt.Sprintf("http://%s/metrics", addr)
 	req := gorequest.New()
 	req.Get(url).Set("User-Agent", "gk")
 	_, b, errs := req.EndBytes()
@@ -69,8 +75,8 @@ func (this *Kguard) showStats(host string) {
 	this.Ui.Output(prettyJSON.String())
 }
 
-func (this *Kguard) showKguardVersion(host string) {
-	url := fmt.Sprintf("http://%s:10025/ver", host)
+func (this *Kguard) showKguardVersion(addr string) {
+	url := fmt.Sprintf("http://%s/ver", addr)
 	req := gorequest.New()
 	req.Get(url).Set("User-Agent", "gk")
 	_, b, errs := req.EndBytes()
@@ -98,6 +104,7 @@ Options:
 
     -l
       Use a long listing format.
+      kguard api is reached at the kguard addr of the zone in ~/.gafka.cf if configured.
 
 `, this.Cmd, this.Synopsis())
 	return strings.TrimSpace(help)
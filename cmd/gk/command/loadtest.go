@@ -0,0 +1,399 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/api/v1"
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/ryanuber/columnize"
+)
+
+type Loadtest struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone             string
+	pubAddr, subAddr string
+	appid, secret    string
+	hisApp           string
+	topic, ver       string
+	group            string
+	concurrency      int
+	rate             int
+	size             int
+	duration         time.Duration
+	withPub, withSub bool
+
+	slaP99     time.Duration
+	slaErrRate float64
+
+	pubStats, subStats loadStats
+}
+
+func (this *Loadtest) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.pubAddr, "kateway", "", "")
+	cmdFlags.StringVar(&this.subAddr, "subaddr", "", "")
+	cmdFlags.StringVar(&this.appid, "app", "", "")
+	cmdFlags.StringVar(&this.secret, "secret", "", "")
+	cmdFlags.StringVar(&this.topic, "t", "", "")
+	cmdFlags.StringVar(&this.ver, "ver", "", "")
+	cmdFlags.StringVar(&this.group, "g", "", "")
+	cmdFlags.IntVar(&this.concurrency, "c", 50, "")
+	cmdFlags.IntVar(&this.rate, "rate", 5000, "")
+	cmdFlags.IntVar(&this.size, "size", 512, "")
+	cmdFlags.DurationVar(&this.duration, "d", time.Minute, "")
+	cmdFlags.BoolVar(&this.withPub, "pub", true, "")
+	cmdFlags.BoolVar(&this.withSub, "sub", false, "")
+	cmdFlags.DurationVar(&this.slaP99, "p99", time.Millisecond*100, "")
+	cmdFlags.Float64Var(&this.slaErrRate, "errrate", 0.001, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	ensureZoneValid(this.zone)
+	this.applyZoneDefaults()
+
+	switch {
+	case !this.withPub && !this.withSub:
+		this.Ui.Error("nothing to do: -pub=false without -sub")
+		return 2
+
+	case this.withPub && this.pubAddr == "":
+		this.Ui.Error("-kateway required: zone has no pub endpoint")
+		return 2
+
+	case this.withSub && this.subAddr == "":
+		this.Ui.Error("-subaddr required: zone has no sub endpoint")
+		return 2
+
+	case this.appid == "" || this.secret == "" || this.topic == "":
+		this.Ui.Error("-app -secret -t required: zone has no smoke app")
+		return 2
+
+	case this.concurrency < 1 || this.size < 1:
+		this.Ui.Error("-c and -size must be positive")
+		return 2
+	}
+
+	this.Ui.Info(fmt.Sprintf("loadtest %s/%s.%s c:%d rate:%d/s size:%d for %s pub:%v sub:%v",
+		this.appid, this.topic, this.ver, this.concurrency, this.rate, this.size, this.duration, this.withPub, this.withSub))
+
+	var (
+		wg       sync.WaitGroup
+		deadline = time.Now().Add(this.duration)
+	)
+	for i := 0; i < this.concurrency; i++ {
+		if this.withPub {
+			wg.Add(1)
+			go this.pubWorker(deadline, &wg)
+		}
+		if this.withSub {
+			go this.subWorker(deadline)
+		}
+	}
+
+	stopProgress := make(chan struct{})
+	go this.showProgress(stopProgress)
+
+	if this.withPub {
+		wg.Wait()
+	} else {
+		time.Sleep(this.duration)
+	}
+	close(stopProgress)
+
+	// sub workers might be blocked in long polling, we don't wait for them
+	if !this.report() {
+		exitCode = 1
+	}
+
+	return
+}
+
+func (this *Loadtest) applyZoneDefaults() {
+	zone := ctx.Zone(this.zone)
+	if this.pubAddr == "" {
+		this.pubAddr = zone.PubEndpoint
+	}
+	if this.subAddr == "" {
+		this.subAddr = zone.SubEndpoint
+	}
+	if this.appid == "" {
+		this.appid, this.secret = zone.SmokeApp, zone.SmokeSecret
+	}
+	this.hisApp = this.appid
+	if this.topic == "" {
+		this.topic = zone.SmokeTopic
+	}
+	if this.ver == "" {
+		this.ver = zone.SmokeTopicVersion
+	}
+	if this.group == "" {
+		this.group = zone.SmokeGroup + "_loadtest"
+	}
+}
+
+func (this *Loadtest) pubWorker(deadline time.Time, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	cf := api.DefaultConfig(this.appid, this.secret)
+	cf.Pub.Endpoint = this.pubAddr
+	cf.Timeout = time.Second * 10
+	cli := api.NewClient(cf)
+
+	// each worker takes an even share of the total rate
+	var ticker *time.Ticker
+	if this.rate > 0 {
+		if interval := time.Second * time.Duration(this.concurrency) / time.Duration(this.rate); interval > 0 {
+			ticker = time.NewTicker(interval)
+			defer ticker.Stop()
+		}
+	}
+
+	msg := []byte(strings.Repeat("X", this.size))
+	opt := api.PubOption{Topic: this.topic, Ver: this.ver}
+	for time.Now().Before(deadline) {
+		if ticker != nil {
+			<-ticker.C
+		}
+
+		t0 := time.Now()
+		err := cli.Pub("", msg, opt)
+		this.pubStats.record(time.Since(t0), err)
+	}
+}
+
+func (this *Loadtest) subWorker(deadline time.Time) {
+	cf := api.DefaultConfig(this.appid, this.secret)
+	cf.Sub.Endpoint = this.subAddr
+	cli := api.NewClient(cf)
+
+	t0 := time.Now()
+	err := cli.Sub(api.SubOption{
+		AppId: this.hisApp,
+		Topic: this.topic,
+		Ver:   this.ver,
+		Group: this.group,
+		Reset: "newest",
+	}, func(statusCode int, msg []byte) error {
+		switch statusCode {
+		case http.StatusOK:
+			this.subStats.record(time.Since(t0), nil)
+
+		case http.StatusNoContent:
+			// idle long polling timeout, not counted
+
+		default:
+			this.subStats.record(time.Since(t0), fmt.Errorf("%d %s", statusCode, string(msg)))
+		}
+
+		if time.Now().After(deadline) {
+			return api.ErrSubStop
+		}
+
+		t0 = time.Now()
+		return nil
+	})
+	if err != nil {
+		this.subStats.record(time.Since(t0), err)
+	}
+}
+
+func (this *Loadtest) showProgress(stop <-chan struct{}) {
+	const interval = time.Second * 5
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastPub, lastSub int64
+	for {
+		select {
+		case <-stop:
+			return
+
+		case <-ticker.C:
+			pubN, subN := this.pubStats.total(), this.subStats.total()
+			this.Ui.Output(fmt.Sprintf("%s pub:%d/s sub:%d/s fail pub:%d sub:%d",
+				time.Now().Format("15:04:05"),
+				(pubN-lastPub)/int64(interval.Seconds()), (subN-lastSub)/int64(interval.Seconds()),
+				atomic.LoadInt64(&this.pubStats.fail), atomic.LoadInt64(&this.subStats.fail)))
+			lastPub, lastSub = pubN, subN
+		}
+	}
+}
+
+// report renders the latency summary and returns whether the SLA is met.
+func (this *Loadtest) report() (pass bool) {
+	pass = true
+	lines := []string{"Op|Ok|Fail|Qps|Min|P50|P90|P99|P999|Max|SLA"}
+	for _, op := range []struct {
+		name    string
+		enabled bool
+		stats   *loadStats
+	}{
+		{"pub", this.withPub, &this.pubStats},
+		{"sub", this.withSub, &this.subStats},
+	} {
+		if !op.enabled {
+			continue
+		}
+
+		ok, fail, latencies := op.stats.snapshot()
+		errRate := 0.
+		if ok+fail > 0 {
+			errRate = float64(fail) / float64(ok+fail)
+		}
+
+		p99 := percentile(latencies, 99)
+		verdict := color.Green("PASS")
+		if ok == 0 || p99 > this.slaP99 || errRate > this.slaErrRate {
+			verdict = color.Red("FAIL")
+			pass = false
+		}
+
+		var min, max time.Duration
+		if len(latencies) > 0 {
+			min, max = latencies[0], latencies[len(latencies)-1]
+		}
+		lines = append(lines, fmt.Sprintf("%s|%d|%d|%d|%s|%s|%s|%s|%s|%s|%s",
+			op.name, ok, fail, ok/int64(math.Max(this.duration.Seconds(), 1)),
+			min, percentile(latencies, 50), percentile(latencies, 90), p99, percentile(latencies, 99.9), max,
+			verdict))
+	}
+
+	this.Ui.Output(columnize.SimpleFormat(lines))
+	this.Ui.Output(fmt.Sprintf("SLA: p99<=%s error rate<=%.4f", this.slaP99, this.slaErrRate))
+	return
+}
+
+func (*Loadtest) Synopsis() string {
+	return "Load test kateway Pub/Sub with latency percentiles and SLA check"
+}
+
+func (this *Loadtest) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s loadtest [options]
+
+    %s
+
+    Exit code is non-zero if SLA not met, so that it can gate a release.
+
+Options:
+
+    -z zone
+
+    -kateway host:port
+      Kateway Pub address, defaults to zone pub endpoint.
+
+    -subaddr host:port
+      Kateway Sub address, defaults to zone sub endpoint.
+
+    -app appid
+      Defaults to zone smoke app.
+
+    -secret secret
+
+    -t topic
+      Defaults to zone smoke topic.
+
+    -ver topic version
+
+    -g group
+      Sub group, defaults to zone smoke group with '_loadtest' suffix.
+
+    -c concurrency
+      Default 50.
+
+    -rate n
+      Total Pub messages per second across all workers, 0 means unlimited.
+      Default 5000.
+
+    -size bytes
+      Message size. Default 512.
+
+    -d duration
+      Default 1m.
+
+    -pub=false
+      Disable Pub load.
+
+    -sub
+      Also drive Sub load with -c consumers.
+
+    -p99 duration
+      SLA of p99 latency. Default 100ms.
+
+    -errrate ratio
+      SLA of error rate. Default 0.001.
+
+`, this.Cmd, this.Synopsis())
+	return strings.TrimSpace(help)
+}
+
+// loadStats records the latency and outcome of each request.
+type loadStats struct {
+	ok, fail int64
+
+	mu        sync.Mutex
+	latencies []time.Duration
+}
+
+func (this *loadStats) record(latency time.Duration, err error) {
+	if err != nil {
+		atomic.AddInt64(&this.fail, 1)
+		return
+	}
+
+	atomic.AddInt64(&this.ok, 1)
+	this.mu.Lock()
+	this.latencies = append(this.latencies, latency)
+	this.mu.Unlock()
+}
+
+func (this *loadStats) total() int64 {
+	return atomic.LoadInt64(&this.ok) + atomic.LoadInt64(&this.fail)
+}
+
+// snapshot returns the counters and sorted latencies of successful requests.
+func (this *loadStats) snapshot() (ok, fail int64, latencies []time.Duration) {
+	this.mu.Lock()
+	latencies = make([]time.Duration, len(this.latencies))
+	copy(latencies, this.latencies)
+	this.mu.Unlock()
+
+	sort.Sort(durations(latencies))
+	return atomic.LoadInt64(&this.ok), atomic.LoadInt64(&this.fail), latencies
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// percentile returns the nearest-rank p-th percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	} else if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
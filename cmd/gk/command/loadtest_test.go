@@ -0,0 +1,35 @@
+package command
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestPercentile(t *testing.T) {
+	assert.Equal(t, time.Duration(0), percentile(nil, 99))
+
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, time.Millisecond, percentile(sorted, 0))
+	assert.Equal(t, 50*time.Millisecond, percentile(sorted, 50))
+	assert.Equal(t, 99*time.Millisecond, percentile(sorted, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(sorted, 99.9))
+	assert.Equal(t, 100*time.Millisecond, percentile(sorted, 100))
+}
+
+func TestLoadStatsSnapshot(t *testing.T) {
+	var s loadStats
+	s.record(time.Second, nil)
+	s.record(time.Millisecond, nil)
+	s.record(time.Minute, errors.New("timeout"))
+	ok, fail, latencies := s.snapshot()
+	assert.Equal(t, int64(2), ok)
+	assert.Equal(t, int64(1), fail)
+	assert.Equal(t, time.Millisecond, latencies[0])
+	assert.Equal(t, int64(3), s.total())
+}
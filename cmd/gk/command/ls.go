@@ -0,0 +1,258 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/ryanuber/columnize"
+)
+
+// lsColumns are the selectable columns of each resource kind, the first lsDefaultColumns are
+// displayed by default.
+var lsColumns = map[string][]string{
+	"cluster": {"cluster", "brokers", "topics", "path"},
+	"topic":   {"cluster", "topic", "partitions", "ctime"},
+	"group":   {"cluster", "group", "members", "topics"},
+}
+
+const lsDefaultColumns = 3
+
+// lsQuery is a parsed resource path: cluster/<glob>[/topic|group[/<glob>]]
+type lsQuery struct {
+	kind         string // cluster | topic | group
+	clusterGlob  string
+	resourceGlob string
+}
+
+type Ls struct {
+	Ui  cli.Ui
+	Cmd string
+}
+
+func (this *Ls) Run(args []string) (exitCode int) {
+	var (
+		zone string
+		cols string
+	)
+	cmdFlags := flag.NewFlagSet("ls", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&cols, "cols", "", "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 2
+	}
+
+	if len(cmdFlags.Args()) > 1 {
+		this.Ui.Error("only 1 resource path allowed")
+		return 2
+	}
+
+	q, err := parseLsPath(cmdFlags.Arg(0))
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 2
+	}
+
+	columns, err := selectLsColumns(q.kind, cols)
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 2
+	}
+
+	ensureZoneValid(zone)
+	zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
+	defer zkzone.Close()
+
+	lines := []string{strings.Join(columns, "|")}
+	zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+		if !lsGlobMatched(q.clusterGlob, zkcluster.Name()) {
+			return
+		}
+
+		for _, row := range this.rows(zkcluster, q) {
+			lines = append(lines, lsRowLine(row, columns))
+		}
+	})
+
+	if len(lines) == 1 {
+		this.Ui.Warn("nothing matched")
+		return 1
+	}
+
+	this.Ui.Output(columnize.SimpleFormat(lines))
+	return
+}
+
+// rows returns {column: value} of each matched resource of the cluster.
+func (this *Ls) rows(zkcluster *zk.ZkCluster, q lsQuery) []map[string]string {
+	var r []map[string]string
+	switch q.kind {
+	case "cluster":
+		topics, err := zkcluster.Topics()
+		swallow(err)
+		r = append(r, map[string]string{
+			"cluster": zkcluster.Name(),
+			"brokers": strconv.Itoa(len(zkcluster.Brokers())),
+			"topics":  strconv.Itoa(len(topics)),
+			"path":    zkcluster.Chroot(),
+		})
+
+	case "topic":
+		ctimes := zkcluster.TopicsCtime()
+		topics := make([]string, 0, len(ctimes))
+		for topic := range ctimes {
+			if lsGlobMatched(q.resourceGlob, topic) {
+				topics = append(topics, topic)
+			}
+		}
+		sort.Strings(topics)
+
+		for _, topic := range topics {
+			r = append(r, map[string]string{
+				"cluster":    zkcluster.Name(),
+				"topic":      topic,
+				"partitions": strconv.Itoa(len(zkcluster.Partitions(topic))),
+				"ctime":      ctimes[topic].Format("2006-01-02 15:04:05"),
+			})
+		}
+
+	case "group":
+		consumerGroups := zkcluster.ConsumerGroups()
+		groups := make([]string, 0, len(consumerGroups))
+		for group := range consumerGroups {
+			if lsGlobMatched(q.resourceGlob, group) {
+				groups = append(groups, group)
+			}
+		}
+		sort.Strings(groups)
+
+		for _, group := range groups {
+			r = append(r, map[string]string{
+				"cluster": zkcluster.Name(),
+				"group":   group,
+				"members": strconv.Itoa(len(consumerGroups[group])),
+				"topics":  strconv.Itoa(len(zkcluster.ConsumerOffsetsOfGroup(group))),
+			})
+		}
+	}
+
+	return r
+}
+
+// parseLsPath parses resource path like cluster/trade*/topic/order.*, empty path means all clusters.
+func parseLsPath(p string) (lsQuery, error) {
+	q := lsQuery{kind: "cluster", clusterGlob: "*", resourceGlob: "*"}
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return q, nil
+	}
+
+	segments := strings.Split(p, "/")
+	if segments[0] != "cluster" || len(segments) > 4 {
+		return q, fmt.Errorf("invalid path: %s, expected cluster/<glob>[/topic|group[/<glob>]]", p)
+	}
+
+	if len(segments) > 1 {
+		q.clusterGlob = segments[1]
+	}
+	if len(segments) > 2 {
+		q.kind = segments[2]
+		if q.kind != "topic" && q.kind != "group" {
+			return q, fmt.Errorf("invalid resource: %s, expected topic or group", q.kind)
+		}
+	}
+	if len(segments) > 3 {
+		q.resourceGlob = segments[3]
+	}
+
+	for _, glob := range []string{q.clusterGlob, q.resourceGlob} {
+		if _, err := path.Match(glob, ""); err != nil {
+			return q, fmt.Errorf("invalid glob: %s", glob)
+		}
+	}
+
+	return q, nil
+}
+
+// selectLsColumns returns the default columns of the kind if cols is empty.
+func selectLsColumns(kind, cols string) ([]string, error) {
+	all := lsColumns[kind]
+	if cols == "" {
+		return all[:lsDefaultColumns], nil
+	}
+
+	var r []string
+	for _, c := range strings.Split(cols, ",") {
+		c = strings.TrimSpace(c)
+		found := false
+		for _, col := range all {
+			if c == col {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid column %s of %s, valid: %s", c, kind, strings.Join(all, ","))
+		}
+
+		r = append(r, c)
+	}
+
+	return r, nil
+}
+
+func lsGlobMatched(glob, name string) bool {
+	matched, _ := path.Match(glob, name)
+	return matched
+}
+
+func lsRowLine(row map[string]string, columns []string) string {
+	values := make([]string, 0, len(columns))
+	for _, c := range columns {
+		values = append(values, row[c])
+	}
+	return strings.Join(values, "|")
+}
+
+func (*Ls) Synopsis() string {
+	return "List clusters, topics and consumer groups with glob filters"
+}
+
+func (this *Ls) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s ls [options] [path]
+
+    %s
+
+    path is hierarchical with glob of each level:
+
+    cluster                        all clusters
+    cluster/trade*                 clusters whose name begins with trade
+    cluster/trade*/topic           all topics of the clusters
+    cluster/trade*/topic/order.*   topics whose name begins with order.
+    cluster/*/group/app1.*         consumer groups of app1 in all clusters
+
+    e,g.
+    %s ls -z prod 'cluster/trade*/topic/order.*'
+
+Options:
+
+    -z zone
+      Default %s
+
+    -cols column[,column]
+      Columns to display, default the first 3 of each kind.
+      cluster  cluster,brokers,topics,path
+      topic    cluster,topic,partitions,ctime
+      group    cluster,group,members,topics
+
+`, this.Cmd, this.Synopsis(), this.Cmd, ctx.ZkDefaultZone())
+	return strings.TrimSpace(help)
+}
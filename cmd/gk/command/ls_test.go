@@ -0,0 +1,47 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestParseLsPath(t *testing.T) {
+	q, err := parseLsPath("")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, lsQuery{kind: "cluster", clusterGlob: "*", resourceGlob: "*"}, q)
+
+	q, err = parseLsPath("cluster/trade*")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, lsQuery{kind: "cluster", clusterGlob: "trade*", resourceGlob: "*"}, q)
+
+	q, err = parseLsPath("/cluster/trade*/topic/order.*/")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, lsQuery{kind: "topic", clusterGlob: "trade*", resourceGlob: "order.*"}, q)
+
+	q, err = parseLsPath("cluster/*/group")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, lsQuery{kind: "group", clusterGlob: "*", resourceGlob: "*"}, q)
+
+	for _, p := range []string{"topic/foo", "cluster/*/broker", "cluster/*/topic/a/b", "cluster/[a"} {
+		_, err = parseLsPath(p)
+		assert.NotEqual(t, nil, err)
+	}
+
+	assert.Equal(t, true, lsGlobMatched("order.*", "order.created"))
+	assert.Equal(t, false, lsGlobMatched("order.*", "orders"))
+}
+
+func TestSelectLsColumns(t *testing.T) {
+	cols, err := selectLsColumns("topic", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"cluster", "topic", "partitions"}, cols)
+
+	cols, err = selectLsColumns("topic", "topic, ctime")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"topic", "ctime"}, cols)
+	assert.Equal(t, "t1|2017", lsRowLine(map[string]string{"topic": "t1", "ctime": "2017", "cluster": "me"}, cols))
+
+	_, err = selectLsColumns("group", "partitions")
+	assert.NotEqual(t, nil, err)
+}
@@ -80,6 +80,7 @@ func (this *Migrate) Run(args []string) (exitCode int) {
 	}
 
 	//this.ensureBrokersAreAlive()
+	this.warnSingleRack()
 	data := this.generateReassignFile()
 	this.Ui.Output(data)
 	yes, _ := this.Ui.Ask("Are you sure to execute the migration? [Y/N]")
@@ -104,6 +105,20 @@ func (this *Migrate) ensureBrokersAreAlive() {
 
 }
 
+// warnSingleRack warns if all the target brokers are in the same failure domain.
+func (this *Migrate) warnSingleRack() {
+	var replicas []int32
+	for _, b := range strings.Split(this.brokerId, ",") {
+		bid, err := strconv.Atoi(strings.TrimSpace(b))
+		swallow(err)
+		replicas = append(replicas, int32(bid))
+	}
+
+	if len(replicas) > 1 && zk.DistinctRacks(replicas, this.zkcluster.BrokerRacks()) == 1 {
+		this.Ui.Warn(fmt.Sprintf("brokers %s are in the same rack, a rack failure loses all replicas", this.brokerId))
+	}
+}
+
 func (this *Migrate) normalizePartitions() {
 	if strings.Contains(this.partition, "-") {
 		// e,g. 0-10
@@ -0,0 +1,360 @@
+package command
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/ryanuber/columnize"
+)
+
+type Net struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone, cluster string
+	topic         string
+	probes        int
+	timeout       time.Duration
+	warn          time.Duration
+	pairwise      bool
+	sshUser       string
+}
+
+func (this *Net) Run(args []string) (exitCode int) {
+	var probeAddrs string
+	cmdFlags := flag.NewFlagSet("net", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.StringVar(&this.topic, "t", "", "")
+	cmdFlags.IntVar(&this.probes, "n", 5, "")
+	cmdFlags.DurationVar(&this.timeout, "timeout", time.Second*2, "")
+	cmdFlags.DurationVar(&this.warn, "warn", time.Millisecond*5, "")
+	cmdFlags.BoolVar(&this.pairwise, "pair", false, "")
+	cmdFlags.StringVar(&this.sshUser, "user", "", "")
+	cmdFlags.StringVar(&probeAddrs, "probe", "", "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if this.probes < 1 {
+		this.Ui.Error("-n must be positive")
+		return 2
+	}
+
+	if probeAddrs != "" {
+		// invoked on a broker host through ssh by the pairwise mode
+		this.probeLocal(strings.Split(probeAddrs, ","))
+		return
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-c").
+		invalid(args) {
+		return 2
+	}
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	zkcluster := zkzone.NewCluster(this.cluster)
+	brokers := this.sortedBrokers(zkcluster)
+	if len(brokers) == 0 {
+		this.Ui.Error(fmt.Sprintf("%s: no live brokers", this.cluster))
+		return 1
+	}
+
+	this.Ui.Info(fmt.Sprintf("client -> broker, min/avg of %d probes", this.probes))
+	this.displayClientLatency(zkcluster, brokers)
+
+	if this.pairwise {
+		this.Ui.Output("")
+		this.Ui.Info(fmt.Sprintf("broker -> broker TCP connect, min of %d probes", this.probes))
+		this.displayBrokerMatrix(brokers)
+	}
+
+	return
+}
+
+func (this *Net) sortedBrokers(zkcluster *zk.ZkCluster) []*zk.BrokerZnode {
+	var (
+		brokers []*zk.BrokerZnode
+		ids     []int
+		byId    = make(map[int]*zk.BrokerZnode)
+	)
+	for id, b := range zkcluster.Brokers() {
+		n, err := strconv.Atoi(id)
+		swallow(err)
+
+		ids = append(ids, n)
+		byId[n] = b
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		brokers = append(brokers, byId[id])
+	}
+	return brokers
+}
+
+// connectLatency dials addr n times and returns min and avg of the TCP connect time.
+func connectLatency(addr string, n int, timeout time.Duration) (min, avg time.Duration, err error) {
+	var total time.Duration
+	for i := 0; i < n; i++ {
+		t0 := time.Now()
+		conn, e := net.DialTimeout("tcp", addr, timeout)
+		if e != nil {
+			return 0, 0, e
+		}
+		d := time.Since(t0)
+		conn.Close()
+
+		total += d
+		if min == 0 || d < min {
+			min = d
+		}
+	}
+
+	return min, total / time.Duration(n), nil
+}
+
+func (this *Net) displayClientLatency(zkcluster *zk.ZkCluster, brokers []*zk.BrokerZnode) {
+	var produceRtt map[string]string // broker id: min/avg
+	if this.topic != "" {
+		produceRtt = this.produceLatency(zkcluster)
+	}
+
+	lines := []string{"Broker|Addr|Connect|Produce"}
+	for _, b := range brokers {
+		connect := "-"
+		if min, avg, err := connectLatency(b.Addr(), this.probes, this.timeout); err != nil {
+			connect = color.Red(err.Error())
+		} else {
+			connect = this.colorize(min) + "/" + avg.String()
+		}
+
+		produce := "-"
+		if r, present := produceRtt[b.Id]; present {
+			produce = r
+		}
+		lines = append(lines, fmt.Sprintf("%s|%s|%s|%s", b.Id, b.Addr(), connect, produce))
+	}
+	this.Ui.Output(columnize.SimpleFormat(lines))
+}
+
+// produceLatency produces small messages to a partition led by each broker, returns
+// {brokerId: min/avg}.
+func (this *Net) produceLatency(zkcluster *zk.ZkCluster) map[string]string {
+	cf := saramaConfig()
+	cf.Producer.RequiredAcks = sarama.WaitForLocal
+	cf.Producer.Partitioner = sarama.NewManualPartitioner
+	cf.Producer.Return.Successes = true
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), cf)
+	swallow(err)
+	defer kfk.Close()
+
+	p, err := sarama.NewSyncProducerFromClient(kfk)
+	swallow(err)
+	defer p.Close()
+
+	partitions, err := kfk.Partitions(this.topic)
+	swallow(err)
+
+	r := make(map[string]string)
+	for _, partition := range partitions {
+		leader, err := kfk.Leader(this.topic, partition)
+		if err != nil {
+			continue
+		}
+
+		id := strconv.Itoa(int(leader.ID()))
+		if _, present := r[id]; present {
+			// one partition per broker is enough
+			continue
+		}
+
+		var min, total time.Duration
+		for i := 0; i < this.probes; i++ {
+			t0 := time.Now()
+			if _, _, err = p.SendMessage(&sarama.ProducerMessage{
+				Topic:     this.topic,
+				Partition: partition,
+				Value:     sarama.StringEncoder("gk net probe"),
+			}); err != nil {
+				break
+			}
+			d := time.Since(t0)
+
+			total += d
+			if min == 0 || d < min {
+				min = d
+			}
+		}
+
+		if err != nil {
+			r[id] = color.Red(err.Error())
+		} else {
+			r[id] = this.colorize(min) + "/" + (total / time.Duration(this.probes)).String()
+		}
+	}
+
+	return r
+}
+
+// displayBrokerMatrix runs 'gk net -probe' on each broker host through ssh concurrently.
+func (this *Net) displayBrokerMatrix(brokers []*zk.BrokerZnode) {
+	addrs := make([]string, 0, len(brokers))
+	for _, b := range brokers {
+		addrs = append(addrs, b.Addr())
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		matrix = make(map[string]map[string]string) // from broker id: {to addr: latency}
+	)
+	for _, b := range brokers {
+		wg.Add(1)
+		go func(b *zk.BrokerZnode) {
+			defer wg.Done()
+
+			row, err := this.probeRemote(b.Host, addrs)
+			if err != nil {
+				this.Ui.Error(fmt.Sprintf("%s %s: %v", b.Id, b.Host, err))
+			}
+
+			mu.Lock()
+			matrix[b.Id] = row
+			mu.Unlock()
+		}(b)
+	}
+	wg.Wait()
+
+	header := []string{"From\\To"}
+	for _, b := range brokers {
+		header = append(header, b.Id)
+	}
+	lines := []string{strings.Join(header, "|")}
+	for _, from := range brokers {
+		line := []string{from.Id}
+		for _, to := range brokers {
+			switch {
+			case from.Id == to.Id:
+				line = append(line, "-")
+
+			case matrix[from.Id][to.Addr()] == "":
+				line = append(line, "?")
+
+			default:
+				line = append(line, matrix[from.Id][to.Addr()])
+			}
+		}
+		lines = append(lines, strings.Join(line, "|"))
+	}
+	this.Ui.Output(columnize.SimpleFormat(lines))
+}
+
+// probeRemote returns {addr: colored latency} measured on the host.
+func (this *Net) probeRemote(host string, addrs []string) (map[string]string, error) {
+	target := host
+	if this.sshUser != "" {
+		target = this.sshUser + "@" + host
+	}
+
+	cmd := exec.Command("ssh", "-o", "BatchMode=yes", "-o", "ConnectTimeout=5", target,
+		"gk", "net", "-probe", strings.Join(addrs, ","),
+		"-n", strconv.Itoa(this.probes), "-timeout", this.timeout.String())
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		// addr latency|error
+		tuples := strings.SplitN(scanner.Text(), " ", 2)
+		if len(tuples) != 2 {
+			continue
+		}
+
+		if d, err := time.ParseDuration(tuples[1]); err == nil {
+			r[tuples[0]] = this.colorize(d)
+		} else {
+			r[tuples[0]] = color.Red(tuples[1])
+		}
+	}
+
+	return r, nil
+}
+
+// probeLocal prints the min TCP connect latency from this host to each addr, one per line.
+func (this *Net) probeLocal(addrs []string) {
+	for _, addr := range addrs {
+		if min, _, err := connectLatency(addr, this.probes, this.timeout); err != nil {
+			this.Ui.Output(fmt.Sprintf("%s %v", addr, err))
+		} else {
+			this.Ui.Output(fmt.Sprintf("%s %s", addr, min))
+		}
+	}
+}
+
+func (this *Net) colorize(d time.Duration) string {
+	if d >= this.warn {
+		return color.Red(d.String())
+	}
+
+	return d.String()
+}
+
+func (*Net) Synopsis() string {
+	return "Measure client-broker and inter-broker network latency"
+}
+
+func (this *Net) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s net [options]
+
+    %s
+
+Options:
+
+    -z zone
+      Default %s
+
+    -c cluster
+
+    -t topic
+      Also measure RTT of producing a small message to a partition led by each broker.
+      The probe messages stay in the topic, use a test topic.
+
+    -n probes
+      Default 5
+
+    -timeout duration
+      Default 2s
+
+    -warn duration
+      Latency above which is highlighted.
+      Default 5ms
+
+    -pair
+      Measure pairwise TCP connect latency between brokers.
+      Runs 'gk net -probe' on each broker host through ssh, which requires key based login
+      and gk installed on the brokers.
+
+    -user ssh user
+
+`, this.Cmd, this.Synopsis(), ctx.ZkDefaultZone())
+	return strings.TrimSpace(help)
+}
@@ -17,6 +17,10 @@ type Offset struct {
 }
 
 func (this *Offset) Run(args []string) (exitCode int) {
+	if len(args) > 0 && args[0] == "find" {
+		return this.runFind(args[1:])
+	}
+
 	var (
 		zone      string
 		cluster   string
@@ -65,7 +69,7 @@ func (this *Offset) Run(args []string) (exitCode int) {
 }
 
 func (*Offset) Synopsis() string {
-	return "Manually set consumer group offset"
+	return "Manually set consumer group offset or find offsets by time"
 }
 
 func (this *Offset) Help() string {
@@ -74,6 +78,11 @@ Usage: %s offset -z zone -c cluster -t topic -g group -p partition -offset offse
 
     %s
 
-`, this.Cmd, this.Synopsis())
+Usage: %s offset find -z zone -c cluster -t topic -time "2016-05-01 12:00:00" [-g group]
+
+    Find offset of each partition by timestamp for point-in-time replay.
+    With -g, prints the commands to reset the group offsets, else the peek commands.
+
+`, this.Cmd, this.Synopsis(), this.Cmd)
 	return strings.TrimSpace(help)
 }
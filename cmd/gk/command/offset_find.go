@@ -0,0 +1,125 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/golib/color"
+	"github.com/ryanuber/columnize"
+)
+
+const offsetFindTimeLayout = "2006-01-02 15:04:05"
+
+type partitionTimeOffset struct {
+	partition              int32
+	offset, oldest, newest int64
+}
+
+// runFind is the time travel subcommand: gk offset find.
+func (this *Offset) runFind(args []string) (exitCode int) {
+	var (
+		zone    string
+		cluster string
+		topic   string
+		group   string
+		at      string
+	)
+	cmdFlags := flag.NewFlagSet("offset find", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&cluster, "c", "", "")
+	cmdFlags.StringVar(&topic, "t", "", "")
+	cmdFlags.StringVar(&group, "g", "", "")
+	cmdFlags.StringVar(&at, "time", "", "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-c", "-t", "-time").
+		invalid(args) {
+		return 2
+	}
+
+	t, err := time.ParseInLocation(offsetFindTimeLayout, at, time.Local)
+	if err != nil {
+		this.Ui.Error(fmt.Sprintf("invalid -time, expected format: %s", offsetFindTimeLayout))
+		return 2
+	}
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
+	zkcluster := zkzone.NewCluster(cluster)
+	offsets, err := findOffsetsByTime(zkcluster, topic, t)
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	lines := []string{"Partition|Offset|Oldest|Newest|Behind"}
+	for _, o := range offsets {
+		lines = append(lines, fmt.Sprintf("%d|%d|%d|%d|%d", o.partition, o.offset, o.oldest, o.newest, o.newest-o.offset))
+	}
+	this.Ui.Output(columnize.SimpleFormat(lines))
+
+	this.Ui.Output("")
+	for _, o := range offsets {
+		if group != "" {
+			this.Ui.Output(fmt.Sprintf("%s offset -z %s -c %s -t %s -g %s -p %d -offset %d",
+				this.Cmd, zone, cluster, topic, group, o.partition, o.offset))
+		} else {
+			this.Ui.Output(fmt.Sprintf("%s peek -z %s -c %s -t %s -p %d -o %d",
+				this.Cmd, zone, cluster, topic, o.partition, o.offset))
+		}
+	}
+	this.Ui.Output(color.Yellow("offsets are aligned to log segments on kafka before 0.10.1, messages slightly earlier than %s might be included", at))
+
+	return
+}
+
+// findOffsetsByTime looks up the earliest offset of each partition whose message might be
+// produced at or after t with the kafka offset-by-time API.
+func findOffsetsByTime(zkcluster *zk.ZkCluster, topic string, t time.Time) ([]partitionTimeOffset, error) {
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), saramaConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer kfk.Close()
+
+	partitions, err := kfk.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := t.UnixNano() / int64(time.Millisecond)
+	r := make([]partitionTimeOffset, 0, len(partitions))
+	for _, p := range partitions {
+		o := partitionTimeOffset{partition: p}
+		if o.oldest, err = kfk.GetOffset(topic, p, sarama.OffsetOldest); err != nil {
+			return nil, err
+		}
+		if o.newest, err = kfk.GetOffset(topic, p, sarama.OffsetNewest); err != nil {
+			return nil, err
+		}
+
+		o.offset, err = kfk.GetOffset(topic, p, ms)
+		switch {
+		case err == sarama.ErrOffsetOutOfRange || (err == nil && o.offset < o.oldest):
+			// t is before the oldest retained message
+			o.offset = o.oldest
+
+		case err != nil:
+			return nil, fmt.Errorf("%s/%d: %v", topic, p, err)
+
+		case o.offset > o.newest:
+			o.offset = o.newest
+		}
+
+		r = append(r, o)
+	}
+
+	return r, nil
+}
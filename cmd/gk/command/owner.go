@@ -0,0 +1,446 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/gofmt"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/ryanuber/columnize"
+)
+
+// ownerNotifyTemplates are the builtin notifications, -tpl of gk owner notify.
+var ownerNotifyTemplates = map[string]string{
+	"lag": `Hi {{.Owner}},
+
+Your consumer group {{.Group}} on {{.Zone}}/{{.Cluster}} is lagging {{.Lag}} messages{{if .Offline}}, and has no online consumers{{end}}.
+Please check whether your consumers are healthy and fast enough.
+{{if .Message}}
+{{.Message}}
+{{end}}
+{{.Metrics}}`,
+
+	"topic": `Hi {{.Owner}},
+
+About your topic {{.Topic}} on {{.Zone}}/{{.Cluster}}:
+{{if .Message}}
+{{.Message}}
+{{end}}
+{{.Metrics}}`,
+
+	"group": `Hi {{.Owner}},
+
+About your consumer group {{.Group}} on {{.Zone}}/{{.Cluster}}:
+{{if .Message}}
+{{.Message}}
+{{end}}
+{{.Metrics}}`,
+}
+
+// ownerNotification is the data of notification templates.
+type ownerNotification struct {
+	Owner   string
+	AppId   string
+	AppName string
+	Zone    string
+	Cluster string
+	Topic   string
+	Group   string
+	Lag     string
+	Offline bool
+	Message string
+	Metrics string
+}
+
+type Owner struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone, cluster string
+	topic, group  string
+}
+
+func (this *Owner) Run(args []string) (exitCode int) {
+	notify := len(args) > 0 && args[0] == "notify"
+	if notify {
+		args = args[1:]
+	}
+
+	var (
+		tpl     string
+		message string
+		via     string
+		dryrun  bool
+	)
+	cmdFlags := flag.NewFlagSet("owner", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.StringVar(&this.topic, "t", "", "")
+	cmdFlags.StringVar(&this.group, "g", "", "")
+	cmdFlags.StringVar(&tpl, "tpl", "", "")
+	cmdFlags.StringVar(&message, "m", "", "")
+	cmdFlags.StringVar(&via, "via", "mail", "")
+	cmdFlags.BoolVar(&dryrun, "dryrun", false, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-c").
+		invalid(args) {
+		return 2
+	}
+
+	if (this.topic == "") == (this.group == "") {
+		this.Ui.Error("either -t or -g required")
+		return 2
+	}
+
+	ensureZoneValid(this.zone)
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	defer zkzone.Close()
+
+	dsn, err := zkzone.KatewayMysqlDsn()
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	n, err := this.lookupOwner(dsn)
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	if !notify {
+		this.Ui.Output(columnize.SimpleFormat([]string{
+			"AppId|App|Owner",
+			fmt.Sprintf("%s|%s|%s", n.AppId, n.AppName, n.Owner),
+		}))
+		return
+	}
+
+	if tpl == "" {
+		tpl = "topic"
+		if this.group != "" {
+			tpl = "lag"
+		}
+	}
+	tplText, present := ownerNotifyTemplates[tpl]
+	if !present {
+		this.Ui.Error(fmt.Sprintf("unknown -tpl %s", tpl))
+		return 2
+	}
+
+	n.Message = message
+	zkcluster := zkzone.NewCluster(this.cluster)
+	if this.group != "" {
+		n.Metrics, n.Lag, n.Offline = this.groupMetrics(zkcluster)
+	} else {
+		n.Metrics = this.topicMetrics(zkcluster)
+	}
+
+	var body bytes.Buffer
+	if err = template.Must(template.New(tpl).Parse(tplText)).Execute(&body, n); err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	subject := fmt.Sprintf("[kafka] %s/%s %s%s", this.zone, this.cluster, this.topic, this.group)
+	if dryrun {
+		this.Ui.Output(fmt.Sprintf("To: %s\nSubject: %s\n\n%s", n.Owner, subject, body.String()))
+		return
+	}
+
+	for _, channel := range strings.Split(via, ",") {
+		switch channel {
+		case "mail":
+			err = sendOwnerMail(n.Owner, subject, body.String())
+
+		case "dingtalk":
+			err = sendOwnerDingTalk(n.Owner, subject, body.String())
+
+		default:
+			err = fmt.Errorf("unknown channel: %s", channel)
+		}
+
+		if err != nil {
+			this.Ui.Error(fmt.Sprintf("%s: %v", channel, err))
+			exitCode = 1
+		} else {
+			this.Ui.Info(fmt.Sprintf("%s notified via %s", n.Owner, channel))
+		}
+	}
+
+	return
+}
+
+// lookupOwner finds owner of the topic named appid.topic.ver or the group named appid.group
+// in the manager db.
+func (this *Owner) lookupOwner(dsn string) (*ownerNotification, error) {
+	name := this.topic
+	if name == "" {
+		name = this.group
+	}
+	tuples := strings.SplitN(name, ".", 3)
+	if len(tuples) < 2 {
+		return nil, fmt.Errorf("%s not created by kateway", name)
+	}
+	appid := tuples[0]
+
+	db, err := dbx.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var ai WhoisAppInfo
+	if err = db.NewQuery("SELECT AppId,ApplicationName,CreateBy FROM application WHERE AppId={:app}").
+		Bind(dbx.Params{"app": appid}).One(&ai); err != nil {
+		return nil, fmt.Errorf("app %s: %v", appid, err)
+	}
+
+	n := &ownerNotification{
+		Owner:   ai.CreateBy,
+		AppId:   ai.AppId,
+		AppName: ai.ApplicationName,
+		Zone:    this.zone,
+		Cluster: this.cluster,
+		Topic:   this.topic,
+		Group:   this.group,
+	}
+
+	// owner of the topic/group itself if registered, else the app owner
+	if this.topic != "" {
+		var ti WhoisTopicInfo
+		err = db.NewQuery("SELECT AppId,TopicName,CreateBy,Status FROM topics WHERE AppId={:app} AND TopicName={:topic}").
+			Bind(dbx.Params{"app": appid, "topic": tuples[1]}).One(&ti)
+		if err == nil && ti.CreateBy != "" {
+			n.Owner = ti.CreateBy
+		}
+	} else {
+		var gi WhoisGroupInfo
+		err = db.NewQuery("SELECT AppId,GroupName,CreateBy,Status FROM application_group WHERE AppId={:app} AND GroupName={:group}").
+			Bind(dbx.Params{"app": appid, "group": strings.TrimPrefix(name, appid+".")}).One(&gi)
+		if err == nil && gi.CreateBy != "" {
+			n.Owner = gi.CreateBy
+		}
+	}
+
+	if n.Owner == "" {
+		return nil, fmt.Errorf("%s has no owner", name)
+	}
+	return n, nil
+}
+
+// groupMetrics renders lag of each topic partition the group consumes.
+func (this *Owner) groupMetrics(zkcluster *zk.ZkCluster) (metrics string, lag string, offline bool) {
+	consumers := zkcluster.ConsumersByGroup(this.group)[this.group]
+	if len(consumers) == 0 {
+		// ConsumersByGroup only reports partitions with online consumers
+		for topic := range zkcluster.ConsumerOffsetsOfGroup(this.group) {
+			groups, err := zkcluster.ConsumerGroupsOfTopic(topic)
+			if err != nil {
+				return err.Error(), "unknown", true
+			}
+			consumers = append(consumers, groups[this.group]...)
+		}
+	}
+	sort.Sort(consumerMetasByPartition(consumers))
+
+	var totalLag int64
+	online := false
+	lines := []string{"Topic|Partition|Consumer|Produced|Consumed|Lag|Committed"}
+	for _, c := range consumers {
+		totalLag += c.Lag
+		consumer := "-"
+		if c.ConsumerZnode != nil {
+			consumer = c.ConsumerZnode.Host()
+		}
+		if c.Online {
+			online = true
+		}
+		committed := "-"
+		if c.Mtime > 0 {
+			committed = gofmt.PrettySince(c.Mtime.Time())
+		}
+
+		lines = append(lines, fmt.Sprintf("%s|%s|%s|%s|%s|%s|%s",
+			c.Topic, c.PartitionId, consumer,
+			gofmt.Comma(c.ProducerOffset), gofmt.Comma(c.ConsumerOffset), gofmt.Comma(c.Lag), committed))
+	}
+	if len(consumers) == 0 {
+		return "no committed offsets found", "unknown", true
+	}
+
+	return columnize.SimpleFormat(lines), gofmt.Comma(totalLag), !online
+}
+
+// topicMetrics renders the consumer groups and their lags of the topic.
+func (this *Owner) topicMetrics(zkcluster *zk.ZkCluster) string {
+	groups, err := zkcluster.ConsumerGroupsOfTopic(this.topic)
+	if err != nil {
+		return err.Error()
+	}
+
+	sortedGroups := make([]string, 0, len(groups))
+	for group := range groups {
+		sortedGroups = append(sortedGroups, group)
+	}
+	sort.Strings(sortedGroups)
+
+	lines := []string{"Group|Online|Partitions|Lag"}
+	for _, group := range sortedGroups {
+		var lag int64
+		online := false
+		for _, c := range groups[group] {
+			lag += c.Lag
+			online = online || c.Online
+		}
+		lines = append(lines, fmt.Sprintf("%s|%v|%d|%s", group, online, len(groups[group]), gofmt.Comma(lag)))
+	}
+	if len(sortedGroups) == 0 {
+		return "no consumer groups"
+	}
+
+	return columnize.SimpleFormat(lines)
+}
+
+type consumerMetasByPartition []zk.ConsumerMeta
+
+func (s consumerMetasByPartition) Len() int      { return len(s) }
+func (s consumerMetasByPartition) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s consumerMetasByPartition) Less(i, j int) bool {
+	if s[i].Topic != s[j].Topic {
+		return s[i].Topic < s[j].Topic
+	}
+	if len(s[i].PartitionId) != len(s[j].PartitionId) {
+		return len(s[i].PartitionId) < len(s[j].PartitionId)
+	}
+	return s[i].PartitionId < s[j].PartitionId
+}
+
+// ownerMailAddr appends the configured mail domain to owner without one.
+func ownerMailAddr(owner, domain string) string {
+	if strings.Contains(owner, "@") || domain == "" {
+		return owner
+	}
+
+	return owner + "@" + strings.TrimPrefix(domain, "@")
+}
+
+func sendOwnerMail(owner, subject, body string) error {
+	cf := ctx.Notify()
+	if cf.SmtpAddr == "" || cf.From == "" {
+		return fmt.Errorf("notify_smtp and notify_from not configured")
+	}
+
+	to := ownerMailAddr(owner, cf.MailDomain)
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		cf.From, to, subject, strings.Replace(body, "\n", "\r\n", -1))
+	return smtp.SendMail(cf.SmtpAddr, nil, cf.From, []string{to}, []byte(msg))
+}
+
+func sendOwnerDingTalk(owner, subject, body string) error {
+	cf := ctx.Notify()
+	if cf.DingTalk == "" {
+		return fmt.Errorf("notify_dingtalk not configured")
+	}
+
+	webhook, err := ctx.Secret(cf.DingTalk)
+	if err != nil {
+		return fmt.Errorf("secret %s: %v", cf.DingTalk, err)
+	}
+
+	// DingTalk markdown needs code block to keep the metrics table aligned
+	b, _ := json.Marshal(map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": subject,
+			"text":  fmt.Sprintf("@%s\n\n```\n%s\n```", owner, body),
+		},
+	})
+	client := &http.Client{Timeout: time.Second * 10}
+	resp, err := client.Post(webhook, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Errcode int    `json:"errcode"`
+		Errmsg  string `json:"errmsg"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("%s: %v", resp.Status, err)
+	}
+	if result.Errcode != 0 {
+		return fmt.Errorf("dingtalk %d: %s", result.Errcode, result.Errmsg)
+	}
+
+	return nil
+}
+
+func (*Owner) Synopsis() string {
+	return "Lookup and notify owner of a topic or consumer group"
+}
+
+func (this *Owner) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s owner [notify] [options]
+
+    %s
+
+    The owner is looked up in the manager db.
+    With 'notify', a templated notification with the relevant metrics attached
+    is sent to the owner, configured in $HOME/.gafka.cf:
+
+      notify_smtp: "smtp.foo.com:25"
+      notify_from: "kafka-ops@foo.com"
+      notify_mail_domain: "foo.com"
+      notify_dingtalk: "dingtalk.webhook" # name of the secret holding the robot webhook url
+
+    e,g.
+    %s owner notify -z prod -c trade -g app1.orders_consumer -m "lag alert fired since 10:00"
+
+Options:
+
+    -z zone
+
+    -c cluster
+
+    -t topic
+      Kafka topic name created by kateway: appid.topic.ver
+
+    -g group
+      Consumer group name created by kateway: appid.group
+
+    -tpl template
+      Builtin notification template: lag|topic|group
+      Default lag for -g and topic for -t.
+
+    -m message
+      Additional message in the notification.
+
+    -via mail|dingtalk
+      Comma separated notification channels, default mail.
+
+    -dryrun
+      Display the notification without sending.
+
+`, this.Cmd, this.Synopsis(), this.Cmd)
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,38 @@
+package command
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/funkygao/assert"
+)
+
+func TestOwnerMailAddr(t *testing.T) {
+	assert.Equal(t, "funky@foo.com", ownerMailAddr("funky", "foo.com"))
+	assert.Equal(t, "funky@foo.com", ownerMailAddr("funky", "@foo.com"))
+	assert.Equal(t, "funky@bar.com", ownerMailAddr("funky@bar.com", "foo.com"))
+	assert.Equal(t, "funky", ownerMailAddr("funky", ""))
+}
+
+func TestOwnerNotifyTemplates(t *testing.T) {
+	n := ownerNotification{
+		Owner:   "funky",
+		Zone:    "prod",
+		Cluster: "trade",
+		Group:   "app1.orders",
+		Lag:     "2,000,000",
+		Offline: true,
+		Metrics: "Topic|Lag",
+	}
+	for name, tpl := range ownerNotifyTemplates {
+		var body bytes.Buffer
+		assert.Equal(t, nil, template.Must(template.New(name).Parse(tpl)).Execute(&body, n))
+		assert.Equal(t, true, strings.Contains(body.String(), "Topic|Lag"))
+	}
+
+	var body bytes.Buffer
+	template.Must(template.New("lag").Parse(ownerNotifyTemplates["lag"])).Execute(&body, n)
+	assert.Equal(t, true, strings.Contains(body.String(), "lagging 2,000,000 messages, and has no online consumers"))
+}
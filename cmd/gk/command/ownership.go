@@ -0,0 +1,264 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/ryanuber/columnize"
+)
+
+const orphanOwner = "-"
+
+type Ownership struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone, cluster string
+	topicPattern  string
+	groupPattern  string
+	orphanOnly    bool
+	includeIdle   bool
+
+	apps   map[string]WhoisAppInfo   // appid:app
+	topics map[string]WhoisTopicInfo // appid.topic:topic
+	groups map[string]WhoisGroupInfo // appid.group:group
+}
+
+func (this *Ownership) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("ownership", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.StringVar(&this.topicPattern, "t", "", "")
+	cmdFlags.StringVar(&this.groupPattern, "g", "", "")
+	cmdFlags.BoolVar(&this.orphanOnly, "orphan", false, "")
+	cmdFlags.BoolVar(&this.includeIdle, "idle", false, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	ensureZoneValid(this.zone)
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	dsn, err := zkzone.KatewayMysqlDsn()
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	if err = this.loadOwners(dsn); err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	var orphanTopics, orphanGroups int
+	zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+		if !patternMatched(zkcluster.Name(), this.cluster) {
+			return
+		}
+
+		t, g := this.reportCluster(zkcluster)
+		orphanTopics += t
+		orphanGroups += g
+	})
+
+	this.Ui.Output(fmt.Sprintf("zone:%s orphan topics:%d groups:%d", this.zone, orphanTopics, orphanGroups))
+
+	return
+}
+
+func (this *Ownership) loadOwners(dsn string) error {
+	db, err := dbx.Open("mysql", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var (
+		apps   []WhoisAppInfo
+		topics []WhoisTopicInfo
+		groups []WhoisGroupInfo
+	)
+	if err = db.NewQuery("SELECT AppId,ApplicationName,CreateBy FROM application").All(&apps); err != nil {
+		return err
+	}
+	if err = db.NewQuery("SELECT AppId,TopicName,CreateBy,Status FROM topics").All(&topics); err != nil {
+		return err
+	}
+	if err = db.NewQuery("SELECT AppId,GroupName,CreateBy,Status FROM application_group").All(&groups); err != nil {
+		return err
+	}
+
+	this.apps = make(map[string]WhoisAppInfo, len(apps))
+	for _, ai := range apps {
+		this.apps[ai.AppId] = ai
+	}
+	this.topics = make(map[string]WhoisTopicInfo, len(topics))
+	for _, ti := range topics {
+		ti.AppName = this.apps[ti.AppId].ApplicationName
+		this.topics[ti.AppId+"."+ti.TopicName] = ti
+	}
+	this.groups = make(map[string]WhoisGroupInfo, len(groups))
+	for _, gi := range groups {
+		gi.AppName = this.apps[gi.AppId].ApplicationName
+		this.groups[gi.AppId+"."+gi.GroupName] = gi
+	}
+
+	return nil
+}
+
+// topicOwner resolves owner of a kafka topic named as appid.topic.ver[.cookie].
+func (this *Ownership) topicOwner(kafkaTopic string) (ti WhoisTopicInfo, found bool) {
+	tuples := strings.SplitN(kafkaTopic, ".", 3)
+	if len(tuples) < 3 {
+		// not created by kateway
+		return
+	}
+
+	ti, found = this.topics[tuples[0]+"."+tuples[1]]
+	return
+}
+
+// groupOwner resolves owner of a consumer group named as appid.group.
+func (this *Ownership) groupOwner(group string) (gi WhoisGroupInfo, found bool) {
+	gi, found = this.groups[group]
+	return
+}
+
+func (this *Ownership) reportCluster(zkcluster *zk.ZkCluster) (orphanTopics, orphanGroups int) {
+	this.Ui.Output(color.Blue("%s %s", this.zone, zkcluster.Name()))
+
+	// topic:[]group
+	consumedBy := make(map[string][]string)
+	groupLines := []string{"Group|Online|Topics|AppId|App|Owner"}
+	consumerGroups := zkcluster.ConsumerGroups()
+	sortedGroups := make([]string, 0, len(consumerGroups))
+	for group := range consumerGroups {
+		sortedGroups = append(sortedGroups, group)
+	}
+	sort.Strings(sortedGroups)
+	for _, group := range sortedGroups {
+		if strings.HasPrefix(group, "console-consumer-") {
+			continue
+		}
+
+		online := len(consumerGroups[group])
+		if online == 0 && !this.includeIdle {
+			continue
+		}
+
+		topics := make([]string, 0)
+		for topic := range zkcluster.ConsumerOffsetsOfGroup(group) {
+			topics = append(topics, topic)
+			consumedBy[topic] = append(consumedBy[topic], group)
+		}
+		sort.Strings(topics)
+
+		if !patternMatched(group, this.groupPattern) {
+			continue
+		}
+
+		gi, found := this.groupOwner(group)
+		if !found {
+			orphanGroups++
+		} else if this.orphanOnly {
+			continue
+		}
+
+		groupLines = append(groupLines, fmt.Sprintf("%s|%d|%s|%s",
+			group, online, strings.Join(topics, ","), this.ownerColumns(gi.AppId, gi.AppName, gi.CreateBy, found)))
+	}
+
+	topicLines := []string{"Topic|Groups|AppId|App|Owner"}
+	topics, err := zkcluster.Topics()
+	if err != nil {
+		this.Ui.Error(fmt.Sprintf("%s: %v", zkcluster.Name(), err))
+		return
+	}
+	sort.Strings(topics)
+	for _, topic := range topics {
+		if strings.HasPrefix(topic, "__") || !patternMatched(topic, this.topicPattern) {
+			// kafka internal topic
+			continue
+		}
+
+		groups := consumedBy[topic]
+		if len(groups) == 0 && !this.includeIdle {
+			continue
+		}
+
+		ti, found := this.topicOwner(topic)
+		if !found {
+			orphanTopics++
+		} else if this.orphanOnly {
+			continue
+		}
+
+		topicLines = append(topicLines, fmt.Sprintf("%s|%d|%s",
+			topic, len(groups), this.ownerColumns(ti.AppId, ti.AppName, ti.CreateBy, found)))
+	}
+
+	if len(topicLines) > 1 {
+		this.Ui.Output(columnize.SimpleFormat(topicLines))
+		this.Ui.Output("")
+	}
+	if len(groupLines) > 1 {
+		this.Ui.Output(columnize.SimpleFormat(groupLines))
+		this.Ui.Output("")
+	}
+
+	return
+}
+
+func (this *Ownership) ownerColumns(appid, app, owner string, found bool) string {
+	if !found {
+		return fmt.Sprintf("%s|%s|%s", orphanOwner, orphanOwner, color.Red("orphan"))
+	}
+
+	if owner == "" {
+		owner = color.Yellow("unknown")
+	}
+	return fmt.Sprintf("%s|%s|%s", appid, app, owner)
+}
+
+func (*Ownership) Synopsis() string {
+	return "Report owner of each active topic and consumer group"
+}
+
+func (this *Ownership) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s ownership [options]
+
+    %s
+
+    Live topics and consumer groups are discovered from zookeeper and joined
+    with the application/topic/group owners registered in manager db.
+    Topics or groups that are not registered in manager are flagged as orphan.
+
+Options:
+
+    -z zone
+
+    -c cluster pattern
+
+    -t topic pattern
+
+    -g group pattern
+
+    -orphan
+      Only show orphan topics and groups.
+
+    -idle
+      Include idle topics and offline consumer groups.
+      By default only topics with online consumer groups are reported.
+
+`, this.Cmd, this.Synopsis())
+	return strings.TrimSpace(help)
+}
@@ -71,6 +71,7 @@ func (this *Peek) Run(args []string) (exitCode int) {
 		partitionId  int
 		wait         time.Duration
 		silence      bool
+		exactOffset  int64
 	)
 	cmdFlags := flag.NewFlagSet("peek", flag.ContinueOnError)
 	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
@@ -88,10 +89,38 @@ func (this *Peek) Run(args []string) (exitCode int) {
 	cmdFlags.BoolVar(&silence, "s", false, "")
 	cmdFlags.DurationVar(&wait, "d", time.Hour, "")
 	cmdFlags.BoolVar(&this.bodyOnly, "body", false, "")
+	cmdFlags.Int64Var(&exactOffset, "o", -1, "")
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
+	if validateArgs(this, this.Ui).
+		on("-o", "-c", "-t", "-p").
+		invalid(args) {
+		return 2
+	}
+
+	if exactOffset >= 0 {
+		if partitionId < 0 {
+			this.Ui.Error("-o requires an exact partition")
+			return 2
+		}
+
+		n := this.limit
+		if n <= 0 {
+			n = 1
+		}
+
+		zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
+		defer zkzone.Close()
+		if err := this.peekExact(zkzone.NewCluster(cluster), topicPattern, int32(partitionId), exactOffset, n); err != nil {
+			this.Ui.Error(err.Error())
+			return 1
+		}
+
+		return
+	}
+
 	if this.pretty {
 		this.bodyOnly = true
 	}
@@ -403,6 +432,10 @@ Options:
     -n count
       Limit how many messages to consume
 
+    -o exact offset
+      Display the message at the offset of a partition in detail with size, CRC and headers,
+      then exit. Requires -c -t -p, -t is the exact topic name. With -n, display n messages.
+
     -d duration
       Limit how long to keep peeking
       e,g. -d 5m
@@ -0,0 +1,194 @@
+package command
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/golib/color"
+	"github.com/funkygao/golib/gofmt"
+)
+
+const (
+	peekFetchSize = 4 << 20
+
+	// kateway tagged message: TagMarkStart tag TagMarkEnd body
+	kwTagMarkStart = byte(1)
+	kwTagMarkEnd   = byte(2)
+)
+
+// peekExact fetches n messages starting from the exact offset of a partition and
+// displays each message in detail.
+func (this *Peek) peekExact(zkcluster *zk.ZkCluster, topic string, partitionId int32, offset int64, n int) error {
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), saramaConfig())
+	if err != nil {
+		return err
+	}
+	defer kfk.Close()
+
+	oldest, err := kfk.GetOffset(topic, partitionId, sarama.OffsetOldest)
+	if err != nil {
+		return err
+	}
+	newest, err := kfk.GetOffset(topic, partitionId, sarama.OffsetNewest)
+	if err != nil {
+		return err
+	}
+	if offset < oldest || offset >= newest {
+		return fmt.Errorf("%s/%d offset %d out of range [%d, %d)", topic, partitionId, offset, oldest, newest)
+	}
+
+	leader, err := kfk.Leader(topic, partitionId)
+	if err != nil {
+		return err
+	}
+
+	for shown := 0; shown < n && offset < newest; {
+		req := &sarama.FetchRequest{MaxWaitTime: 1000, MinBytes: 1}
+		req.AddBlock(topic, partitionId, offset, peekFetchSize)
+		resp, err := leader.Fetch(req)
+		if err != nil {
+			return err
+		}
+
+		block := resp.GetBlock(topic, partitionId)
+		if block == nil {
+			return fmt.Errorf("%s/%d empty fetch response", topic, partitionId)
+		}
+		if block.Err != sarama.ErrNoError {
+			return block.Err
+		}
+
+		msgs := flattenMessageSet(block.MsgSet.Messages)
+		if len(msgs) == 0 {
+			// message bigger than fetch size
+			return fmt.Errorf("%s/%d offset %d: message larger than %s", topic, partitionId, offset, gofmt.ByteSize(peekFetchSize))
+		}
+
+		for _, mb := range msgs {
+			if mb.Offset < offset {
+				// compressed message set starts before the offset
+				continue
+			}
+
+			this.displayMessage(topic, partitionId, mb)
+			offset = mb.Offset + 1
+			shown++
+			if shown >= n {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// flattenMessageSet expands compressed wrapper messages with absolute offsets.
+func flattenMessageSet(blocks []*sarama.MessageBlock) []*sarama.MessageBlock {
+	r := make([]*sarama.MessageBlock, 0, len(blocks))
+	for _, mb := range blocks {
+		if mb.Msg == nil {
+			continue
+		}
+
+		if mb.Msg.Set == nil || len(mb.Msg.Set.Messages) == 0 {
+			r = append(r, mb)
+			continue
+		}
+
+		inner := mb.Msg.Set.Messages
+		delta := int64(0)
+		if mb.Msg.Version >= 1 {
+			// inner offsets are relative, the wrapper carries offset of the last inner message
+			delta = mb.Offset - inner[len(inner)-1].Offset
+		}
+		for _, imb := range inner {
+			r = append(r, &sarama.MessageBlock{Offset: imb.Offset + delta, Msg: imb.Msg})
+		}
+	}
+	return r
+}
+
+func (this *Peek) displayMessage(topic string, partitionId int32, mb *sarama.MessageBlock) {
+	msg := mb.Msg
+	tags, value := splitKatewayTag(msg.Value)
+
+	lines := []string{
+		fmt.Sprintf("%s/%d offset %s", topic, partitionId, gofmt.Comma(mb.Offset)),
+		fmt.Sprintf("   size: key %d, value %d", len(msg.Key), len(msg.Value)),
+		fmt.Sprintf("    crc: %08x", messageCrc(msg)),
+		fmt.Sprintf("  codec: %s, magic %d", codecName(msg.Codec), msg.Version),
+	}
+	if msg.Version >= 1 {
+		lines = append(lines, fmt.Sprintf("   time: %s", msg.Timestamp))
+	}
+	if tags != "" {
+		lines = append(lines, fmt.Sprintf("headers: %s", tags))
+	}
+	lines = append(lines, fmt.Sprintf("    key: %q", msg.Key))
+	lines = append(lines, fmt.Sprintf("  value: %s", string(value)))
+
+	if this.colorize {
+		lines[0] = color.Green(lines[0])
+	}
+	this.Ui.Output(strings.Join(lines, "\n") + "\n")
+}
+
+// splitKatewayTag splits the kateway message tag, which serves as message headers.
+func splitKatewayTag(v []byte) (string, []byte) {
+	if len(v) == 0 || v[0] != kwTagMarkStart {
+		return "", v
+	}
+
+	end := bytes.IndexByte(v, kwTagMarkEnd)
+	if end == -1 {
+		return "", v
+	}
+
+	return string(v[1:end]), v[end+1:]
+}
+
+// messageCrc recomputes the CRC32 of a message as it is on the wire:
+// crc32(magic attributes [timestamp] key value)
+func messageCrc(msg *sarama.Message) uint32 {
+	var buf bytes.Buffer
+	buf.WriteByte(byte(msg.Version))
+	buf.WriteByte(byte(msg.Codec) & 0x07)
+	if msg.Version >= 1 {
+		ts := int64(-1)
+		if !msg.Timestamp.IsZero() {
+			ts = msg.Timestamp.UnixNano() / 1e6
+		}
+		binary.Write(&buf, binary.BigEndian, ts)
+	}
+	writeKafkaBytes(&buf, msg.Key)
+	writeKafkaBytes(&buf, msg.Value)
+	return crc32.ChecksumIEEE(buf.Bytes())
+}
+
+func writeKafkaBytes(buf *bytes.Buffer, b []byte) {
+	if b == nil {
+		binary.Write(buf, binary.BigEndian, int32(-1))
+		return
+	}
+
+	binary.Write(buf, binary.BigEndian, int32(len(b)))
+	buf.Write(b)
+}
+
+func codecName(codec sarama.CompressionCodec) string {
+	switch codec {
+	case sarama.CompressionNone:
+		return "none"
+	case sarama.CompressionGZIP:
+		return "gzip"
+	case sarama.CompressionSnappy:
+		return "snappy"
+	default:
+		return fmt.Sprintf("%d", codec)
+	}
+}
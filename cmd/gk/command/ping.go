@@ -44,8 +44,11 @@ func (this *Ping) Run(args []string) (exitCode int) {
 	this.zkzone = zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
 
 	for {
-		this.diagnose()
+		failures := this.diagnose()
 		if this.logfile == "stdout" {
+			if failures > 0 {
+				exitCode = 1
+			}
 			break
 		}
 
@@ -69,7 +72,29 @@ func (this *Ping) setupLog() {
 
 }
 
-func (this *Ping) diagnose() {
+// report goes to log4go in daemon mode, otherwise to Ui so that checkup can tell failures.
+func (this *Ping) report(err error, addr, namedAddr string) {
+	daemon := this.logfile != "stdout"
+	switch {
+	case err != nil && daemon:
+		log.Error("%25s %30s %s", addr, namedAddr, color.Red(err.Error()))
+
+	case err != nil:
+		this.Ui.Error(fmt.Sprintf("%25s %30s %s", addr, namedAddr, color.Red(err.Error())))
+
+	case this.problematicMode:
+		// only problematic brokers shown
+
+	case daemon:
+		log.Info("%25s %30s %s", addr, namedAddr, color.Green("ok"))
+
+	default:
+		this.Ui.Output(fmt.Sprintf("%25s %30s %s", addr, namedAddr, color.Green("ok")))
+	}
+}
+
+// diagnose pings all the registered brokers and returns how many failed.
+func (this *Ping) diagnose() (failures int) {
 	this.zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
 		if this.cluster != "" && this.cluster != zkcluster.Name() {
 			return
@@ -81,22 +106,20 @@ func (this *Ping) diagnose() {
 
 			kfk, err := sarama.NewClient([]string{broker.Addr()}, saramaConfig())
 			if err != nil {
-				log.Error("%25s %30s %s", broker.Addr(), broker.NamedAddr(), color.Red(err.Error()))
-
+				failures++
+				this.report(err, broker.Addr(), broker.NamedAddr())
 				continue
 			}
 
 			_, err = kfk.Topics() // kafka didn't provide ping, so use Topics() as ping
 			if err != nil {
-				log.Error("%25s %30s %s", broker.Addr(), broker.NamedAddr(), color.Red(err.Error()))
-			} else {
-				if !this.problematicMode {
-					log.Info("%25s %30s %s", broker.Addr(), broker.NamedAddr(), color.Green("ok"))
-				}
+				failures++
 			}
+			this.report(err, broker.Addr(), broker.NamedAddr())
 			kfk.Close()
 		}
 	})
+	return
 }
 
 func (*Ping) Synopsis() string {
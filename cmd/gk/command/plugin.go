@@ -0,0 +1,177 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gocli"
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	// external plugin executables on PATH are named gk-<name>
+	pluginPrefix = "gk-"
+
+	pluginHelpTimeout = time.Second
+)
+
+// Plugins discovers the private subcommands living outside of this tree.
+// Builtin commands are never overridden, and Go plugins in ctx.GkPluginDir take precedence
+// over gk-<name> executables on PATH.
+func Plugins(ui cli.Ui, cmd string, builtin map[string]cli.CommandFactory) map[string]cli.CommandFactory {
+	r := make(map[string]cli.CommandFactory)
+	for name, factory := range loadGoPlugins(ctx.GkPluginDir(), ui, cmd) {
+		if _, present := builtin[name]; present {
+			log.Warn("plugin %s conflicts with builtin command, ignored", name)
+			continue
+		}
+
+		r[name] = factory
+	}
+
+	for name, path := range discoverExecPlugins(filepath.SplitList(os.Getenv("PATH"))) {
+		if _, present := builtin[name]; present {
+			log.Warn("plugin %s conflicts with builtin command, ignored", path)
+			continue
+		}
+		if _, present := r[name]; present {
+			continue
+		}
+
+		name, path := name, path
+		r[name] = func() (cli.Command, error) {
+			return &Plugin{
+				Ui:   ui,
+				Cmd:  cmd,
+				Name: name,
+				Path: path,
+			}, nil
+		}
+	}
+
+	return r
+}
+
+// discoverExecPlugins returns name:path of the gk-<name> executables, the first dir wins.
+func discoverExecPlugins(dirs []string) map[string]string {
+	r := make(map[string]string)
+	for _, dir := range dirs {
+		if dir == "" {
+			dir = "."
+		}
+
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, f := range files {
+			name := f.Name()
+			if !strings.HasPrefix(name, pluginPrefix) || len(name) == len(pluginPrefix) {
+				continue
+			}
+
+			path := filepath.Join(dir, name)
+			if f.Mode()&os.ModeSymlink != 0 {
+				// stat the target
+				if f, err = os.Stat(path); err != nil {
+					continue
+				}
+			}
+			if !f.Mode().IsRegular() || f.Mode().Perm()&0111 == 0 {
+				continue
+			}
+
+			name = strings.TrimPrefix(name, pluginPrefix)
+			if _, present := r[name]; !present {
+				r[name] = path
+			}
+		}
+	}
+
+	return r
+}
+
+// Plugin is an external gk-<name> executable exposed as gk subcommand.
+//
+// It inherits stdin/stdout/stderr and the exit code, and is given the env GK_CMD and GK_ZONE.
+// It should print a one line synopsis with --synopsis and its usage with --help.
+type Plugin struct {
+	Ui   cli.Ui
+	Cmd  string
+	Name string
+	Path string
+}
+
+func (this *Plugin) Run(args []string) (exitCode int) {
+	c := exec.Command(this.Path, args...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	c.Env = this.env()
+	if err := c.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				return status.ExitStatus()
+			}
+		}
+
+		this.Ui.Error(fmt.Sprintf("%s: %v", this.Path, err))
+		return 1
+	}
+
+	return
+}
+
+func (this *Plugin) env() []string {
+	return append(os.Environ(),
+		"GK_CMD="+this.Cmd,
+		"GK_ZONE="+ctx.ZkDefaultZone())
+}
+
+// query runs the plugin with a flag and returns its output, with timeout in case it ignores the flag.
+func (this *Plugin) query(flag string) (string, error) {
+	c, cancel := context.WithTimeout(context.Background(), pluginHelpTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(c, this.Path, flag)
+	cmd.Stdout = &out
+	cmd.Env = this.env()
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(out.String()), nil
+}
+
+func (this *Plugin) Synopsis() string {
+	if s, err := this.query("--synopsis"); err == nil && s != "" {
+		return strings.SplitN(s, "\n", 2)[0]
+	}
+
+	return fmt.Sprintf("Plugin %s", this.Path)
+}
+
+func (this *Plugin) Help() string {
+	if s, err := this.query("--help"); err == nil && s != "" {
+		return s
+	}
+
+	help := fmt.Sprintf(`
+Usage: %s %s [args]
+
+    External plugin %s
+
+    Plugins are gk-<name> executables on PATH, or Go plugins in gk_plugin_dir of ~/.gafka.cf.
+
+`, this.Cmd, this.Name, this.Path)
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,65 @@
+// +build go1.8,linux,cgo
+
+package command
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"plugin"
+	"strings"
+
+	"github.com/funkygao/gocli"
+	log "github.com/funkygao/log4go"
+)
+
+// goPluginSymbol is what a Go plugin <name>.so exports to create its command:
+//
+//	func NewCommand(ui cli.Ui, cmd string) cli.Command
+//
+// It must be built with -buildmode=plugin against the same gocli as gk.
+const goPluginSymbol = "NewCommand"
+
+func loadGoPlugins(dir string, ui cli.Ui, cmd string) map[string]cli.CommandFactory {
+	if dir == "" {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Warn("plugin dir: %v", err)
+		return nil
+	}
+
+	r := make(map[string]cli.CommandFactory)
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".so" {
+			continue
+		}
+
+		path := filepath.Join(dir, f.Name())
+		p, err := plugin.Open(path)
+		if err != nil {
+			log.Warn("plugin %s: %v", path, err)
+			continue
+		}
+
+		sym, err := p.Lookup(goPluginSymbol)
+		if err != nil {
+			log.Warn("plugin %s: %v", path, err)
+			continue
+		}
+
+		newCommand, ok := sym.(func(cli.Ui, string) cli.Command)
+		if !ok {
+			log.Warn("plugin %s: %s has wrong signature %T", path, goPluginSymbol, sym)
+			continue
+		}
+
+		name := strings.TrimSuffix(f.Name(), ".so")
+		r[name] = func() (cli.Command, error) {
+			return newCommand(ui, cmd), nil
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,15 @@
+// +build !go1.8 !linux !cgo
+
+package command
+
+import (
+	"github.com/funkygao/gocli"
+	log "github.com/funkygao/log4go"
+)
+
+func loadGoPlugins(dir string, ui cli.Ui, cmd string) map[string]cli.CommandFactory {
+	if dir != "" {
+		log.Warn("Go plugins not supported on this build, %s ignored", dir)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestDiscoverExecPlugins(t *testing.T) {
+	dir1, _ := ioutil.TempDir("", "gkplugin")
+	defer os.RemoveAll(dir1)
+	dir2, _ := ioutil.TempDir("", "gkplugin")
+	defer os.RemoveAll(dir2)
+
+	ioutil.WriteFile(filepath.Join(dir1, "gk-foo"), []byte("#!/bin/sh\n"), 0755)
+	ioutil.WriteFile(filepath.Join(dir1, "gk-noexec"), []byte("#!/bin/sh\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir1, "gk-"), []byte("#!/bin/sh\n"), 0755)
+	ioutil.WriteFile(filepath.Join(dir1, "kafka-foo"), []byte("#!/bin/sh\n"), 0755)
+	os.Mkdir(filepath.Join(dir1, "gk-dir"), 0755)
+	ioutil.WriteFile(filepath.Join(dir2, "gk-foo"), []byte("#!/bin/sh\n"), 0755)
+	ioutil.WriteFile(filepath.Join(dir2, "gk-bar"), []byte("#!/bin/sh\n"), 0755)
+	os.Symlink(filepath.Join(dir2, "gk-bar"), filepath.Join(dir2, "gk-baz"))
+
+	plugins := discoverExecPlugins([]string{dir1, filepath.Join(dir1, "non-exist"), dir2})
+	assert.Equal(t, 3, len(plugins))
+	assert.Equal(t, filepath.Join(dir1, "gk-foo"), plugins["foo"]) // first dir wins
+	assert.Equal(t, filepath.Join(dir2, "gk-bar"), plugins["bar"])
+	assert.Equal(t, filepath.Join(dir2, "gk-baz"), plugins["baz"])
+}
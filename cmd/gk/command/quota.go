@@ -0,0 +1,316 @@
+package command
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/ryanuber/columnize"
+)
+
+// appQuota is a row of manager db table app_quota, 0 means unlimited.
+type appQuota struct {
+	AppId      string `db:"AppId"`
+	MsgsLimit  int64  `db:"PubMsgsLimit"`  // Pub msgs per second
+	BytesLimit int64  `db:"PubBytesLimit"` // Pub bytes per second
+	MaxTopics  int64  `db:"MaxTopics"`
+}
+
+// appQuotaAudit is a row of manager db table app_quota_audit.
+type appQuotaAudit struct {
+	AppId      string `db:"AppId"`
+	Item       string `db:"Item"`
+	OldValue   int64  `db:"OldValue"`
+	NewValue   int64  `db:"NewValue"`
+	By         string `db:"By"`
+	CreateTime string `db:"CreateTime"`
+}
+
+// quotaChange is a changed item of an app quota.
+type quotaChange struct {
+	item     string
+	old, new int64
+}
+
+var quotaItems = []string{"msgs", "bytes", "topics"}
+
+type Quota struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone  string
+	appid string
+}
+
+func (this *Quota) Run(args []string) (exitCode int) {
+	var (
+		spec        string
+		showHistory bool
+	)
+	cmdFlags := flag.NewFlagSet("quota", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.appid, "app", "", "")
+	cmdFlags.StringVar(&spec, "set", "", "")
+	cmdFlags.BoolVar(&showHistory, "history", false, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		on("-set", "-app").
+		on("-history", "-app").
+		requireAdminRights("-set").
+		invalid(args) {
+		return 2
+	}
+
+	ensureZoneValid(this.zone)
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	defer zkzone.Close()
+
+	dsn, err := zkzone.KatewayMysqlDsn()
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	db, err := dbx.Open("mysql", dsn)
+	swallow(err)
+	defer db.Close()
+
+	switch {
+	case spec != "":
+		err = this.setQuota(db, spec)
+
+	case showHistory:
+		err = this.showHistory(db)
+
+	default:
+		err = this.listQuotas(db)
+	}
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	return
+}
+
+func (this *Quota) listQuotas(db *dbx.DB) error {
+	q := db.NewQuery("SELECT AppId,PubMsgsLimit,PubBytesLimit,MaxTopics FROM app_quota ORDER BY AppId")
+	if this.appid != "" {
+		q = db.NewQuery("SELECT AppId,PubMsgsLimit,PubBytesLimit,MaxTopics FROM app_quota WHERE AppId={:app}").
+			Bind(dbx.Params{"app": this.appid})
+	}
+
+	var quotas []appQuota
+	if err := q.All(&quotas); err != nil {
+		return err
+	}
+
+	lines := []string{"AppId|Msgs/s|Bytes/s|MaxTopics"}
+	for _, quota := range quotas {
+		lines = append(lines, fmt.Sprintf("%s|%s|%s|%s", quota.AppId,
+			quotaValueString(quota.MsgsLimit), quotaValueString(quota.BytesLimit), quotaValueString(quota.MaxTopics)))
+	}
+	if len(lines) == 1 {
+		this.Ui.Info("no quota found, all apps unlimited")
+		return nil
+	}
+
+	this.Ui.Output(columnize.SimpleFormat(lines))
+	return nil
+}
+
+func (this *Quota) showHistory(db *dbx.DB) error {
+	var audits []appQuotaAudit
+	if err := db.NewQuery("SELECT AppId,Item,OldValue,NewValue,`By`,CreateTime FROM app_quota_audit WHERE AppId={:app} ORDER BY CreateTime").
+		Bind(dbx.Params{"app": this.appid}).All(&audits); err != nil {
+		return err
+	}
+
+	lines := []string{"Time|Item|Old|New|By"}
+	for _, a := range audits {
+		lines = append(lines, fmt.Sprintf("%s|%s|%s|%s|%s", a.CreateTime, a.Item,
+			quotaValueString(a.OldValue), quotaValueString(a.NewValue), a.By))
+	}
+	this.Ui.Output(columnize.SimpleFormat(lines))
+	return nil
+}
+
+// setQuota updates the quota of the app and appends an audit entry per changed item within
+// the same transaction.
+func (this *Quota) setQuota(db *dbx.DB, spec string) error {
+	var app struct {
+		AppId string `db:"AppId"`
+	}
+	if err := db.NewQuery("SELECT AppId FROM application WHERE AppId={:app}").
+		Bind(dbx.Params{"app": this.appid}).One(&app); err != nil {
+		return fmt.Errorf("app %s: %v", this.appid, err)
+	}
+
+	old := appQuota{AppId: this.appid}
+	exists := true
+	if err := db.NewQuery("SELECT AppId,PubMsgsLimit,PubBytesLimit,MaxTopics FROM app_quota WHERE AppId={:app}").
+		Bind(dbx.Params{"app": this.appid}).One(&old); err != nil {
+		if err != sql.ErrNoRows {
+			return err
+		}
+		exists = false
+	}
+
+	quota, err := applyQuotaSpec(old, spec)
+	if err != nil {
+		return err
+	}
+
+	changes := quotaChanges(old, quota)
+	if len(changes) == 0 {
+		this.Ui.Info(fmt.Sprintf("quota of app %s unchanged", this.appid))
+		return nil
+	}
+
+	cols := dbx.Params{
+		"PubMsgsLimit":  quota.MsgsLimit,
+		"PubBytesLimit": quota.BytesLimit,
+		"MaxTopics":     quota.MaxTopics,
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		_, err = tx.Update("app_quota", cols, dbx.HashExp{"AppId": this.appid}).Execute()
+	} else {
+		cols["AppId"] = this.appid
+		_, err = tx.Insert("app_quota", cols).Execute()
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	by := ctx.CurrentUser()
+	now := time.Now().Format("2006-01-02 15:04:05")
+	for _, c := range changes {
+		if _, err = tx.Insert("app_quota_audit", dbx.Params{
+			"AppId":      this.appid,
+			"Item":       c.item,
+			"OldValue":   c.old,
+			"NewValue":   c.new,
+			"By":         by,
+			"CreateTime": now,
+		}).Execute(); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		this.Ui.Info(fmt.Sprintf("app %s %s: %s -> %s", this.appid, c.item,
+			quotaValueString(c.old), color.Green(quotaValueString(c.new))))
+	}
+	return nil
+}
+
+// applyQuotaSpec returns the quota with items of spec applied, e,g. msgs=1000,bytes=1048576,topics=20
+func applyQuotaSpec(quota appQuota, spec string) (appQuota, error) {
+	for _, kv := range strings.Split(spec, ",") {
+		p := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(p) != 2 {
+			return quota, fmt.Errorf("invalid quota: %s", kv)
+		}
+
+		n, err := strconv.ParseInt(p[1], 10, 64)
+		if err != nil || n < 0 {
+			return quota, fmt.Errorf("invalid quota %s: %s", p[0], p[1])
+		}
+
+		switch p[0] {
+		case "msgs":
+			quota.MsgsLimit = n
+
+		case "bytes":
+			quota.BytesLimit = n
+
+		case "topics":
+			quota.MaxTopics = n
+
+		default:
+			return quota, fmt.Errorf("unknown quota item: %s, valid items: %s", p[0], strings.Join(quotaItems, ","))
+		}
+	}
+
+	return quota, nil
+}
+
+// quotaChanges returns the changed items in the order of quotaItems.
+func quotaChanges(old, new appQuota) []quotaChange {
+	var r []quotaChange
+	if old.MsgsLimit != new.MsgsLimit {
+		r = append(r, quotaChange{item: "msgs", old: old.MsgsLimit, new: new.MsgsLimit})
+	}
+	if old.BytesLimit != new.BytesLimit {
+		r = append(r, quotaChange{item: "bytes", old: old.BytesLimit, new: new.BytesLimit})
+	}
+	if old.MaxTopics != new.MaxTopics {
+		r = append(r, quotaChange{item: "topics", old: old.MaxTopics, new: new.MaxTopics})
+	}
+	return r
+}
+
+func quotaValueString(n int64) string {
+	if n == 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+func (*Quota) Synopsis() string {
+	return "View and set Pub quotas of PubSub apps"
+}
+
+func (this *Quota) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s quota [options]
+
+    %s
+
+    Quotas are stored in manager db table app_quota, 0 means unlimited.
+    Each changed item is recorded in table app_quota_audit with the operator.
+
+Options:
+
+    -z zone
+      Default %s
+
+    -app appid
+
+    -set item=value[,item=value]
+      Update quota of the app, items:
+      msgs    Pub messages per second
+      bytes   Pub bytes per second
+      topics  max number of topics
+
+    -history
+      Display the quota change history of the app.
+
+`, this.Cmd, this.Synopsis(), ctx.ZkDefaultZone())
+	return strings.TrimSpace(help)
+}
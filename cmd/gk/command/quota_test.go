@@ -0,0 +1,28 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestApplyQuotaSpec(t *testing.T) {
+	old := appQuota{AppId: "app1", MsgsLimit: 100, BytesLimit: 1024}
+
+	q, err := applyQuotaSpec(old, "msgs=200, topics=20")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(200), q.MsgsLimit)
+	assert.Equal(t, int64(1024), q.BytesLimit)
+	assert.Equal(t, int64(20), q.MaxTopics)
+
+	changes := quotaChanges(old, q)
+	assert.Equal(t, 2, len(changes))
+	assert.Equal(t, quotaChange{item: "msgs", old: 100, new: 200}, changes[0])
+	assert.Equal(t, quotaChange{item: "topics", old: 0, new: 20}, changes[1])
+	assert.Equal(t, 0, len(quotaChanges(q, q)))
+
+	for _, spec := range []string{"", "msgs", "msgs=-1", "msgs=1k", "qps=10"} {
+		_, err = applyQuotaSpec(old, spec)
+		assert.NotEqual(t, nil, err)
+	}
+}
@@ -0,0 +1,238 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/ryanuber/columnize"
+)
+
+type Reassign struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone, cluster string
+	cancel        bool
+	election      bool
+	resign        bool
+	stuck         time.Duration
+}
+
+func (this *Reassign) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("reassign", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.Bool("status", true, "")
+	cmdFlags.BoolVar(&this.cancel, "cancel", false, "")
+	cmdFlags.BoolVar(&this.election, "election", false, "")
+	cmdFlags.BoolVar(&this.resign, "resign", false, "")
+	cmdFlags.DurationVar(&this.stuck, "stuck", time.Hour, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		on("-cancel", "-c").
+		on("-election", "-cancel").
+		on("-resign", "-cancel").
+		requireAdminRights("-cancel").
+		invalid(args) {
+		return 2
+	}
+
+	ensureZoneValid(this.zone)
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	defer zkzone.Close()
+
+	if this.cancel {
+		return this.cancelPending(zkzone.NewCluster(this.cluster))
+	}
+
+	zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+		if !patternMatched(zkcluster.Name(), this.cluster) {
+			return
+		}
+
+		this.displayStatus(zkcluster)
+	})
+
+	return
+}
+
+func (this *Reassign) displayStatus(zkcluster *zk.ZkCluster) {
+	reassignment, err := zkcluster.PendingReassignment()
+	if err != nil {
+		this.Ui.Error(fmt.Sprintf("%s reassignment: %v", zkcluster.Name(), err))
+		return
+	}
+	election, err := zkcluster.PendingPreferredReplicaElection()
+	if err != nil {
+		this.Ui.Error(fmt.Sprintf("%s preferred replica election: %v", zkcluster.Name(), err))
+		return
+	}
+
+	if reassignment == nil && election == nil {
+		this.Ui.Output(fmt.Sprintf("%s %s", zkcluster.Name(), color.Green("no pending reassignment")))
+		return
+	}
+
+	if reassignment != nil {
+		this.Ui.Output(fmt.Sprintf("%s reassignment of %d partitions pending %s", zkcluster.Name(),
+			len(reassignment.Partitions), this.colorAge(reassignment.Age())))
+
+		lines := []string{"Topic|Partition|Target|Isr|Leader|Status"}
+		states := make(map[string]map[int32]zk.PartitionState)
+		for _, p := range sortedAdminPartitions(reassignment.Partitions) {
+			if _, present := states[p.Topic]; !present {
+				states[p.Topic] = zkcluster.PartitionStates(p.Topic)
+			}
+
+			state, present := states[p.Topic][p.Partition]
+			status := color.Yellow("copying")
+			if !present {
+				status = color.Red("no state")
+			} else if isrCaughtUp(state.Isr, p.Replicas) {
+				status = color.Green("caught up")
+			}
+			lines = append(lines, fmt.Sprintf("%s|%d|%+v|%+v|%d|%s", p.Topic, p.Partition,
+				p.Replicas, state.Isr, state.Leader, status))
+		}
+		this.Ui.Output(columnize.SimpleFormat(lines))
+	}
+
+	if election != nil {
+		var partitions []string
+		for _, p := range sortedAdminPartitions(election.Partitions) {
+			partitions = append(partitions, fmt.Sprintf("%s#%d", p.Topic, p.Partition))
+		}
+		this.Ui.Output(fmt.Sprintf("%s preferred replica election pending %s: %s", zkcluster.Name(),
+			this.colorAge(election.Age()), strings.Join(partitions, " ")))
+	}
+}
+
+func (this *Reassign) colorAge(age time.Duration) string {
+	if age >= this.stuck {
+		return color.Red("%s, stuck?", age)
+	}
+	return age.String()
+}
+
+func (this *Reassign) cancelPending(zkcluster *zk.ZkCluster) (exitCode int) {
+	what := "reassignment"
+	pending, err := zkcluster.PendingReassignment()
+	if this.election {
+		what = "preferred replica election"
+		pending, err = zkcluster.PendingPreferredReplicaElection()
+	}
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+	if pending == nil {
+		this.Ui.Info(fmt.Sprintf("%s has no pending %s", this.cluster, what))
+		return
+	}
+
+	this.displayStatus(zkcluster)
+	if pending.Age() < this.stuck {
+		this.Ui.Warn(fmt.Sprintf("%s pending only %s, might be still in progress", what, pending.Age()))
+	}
+
+	yes, _ := this.Ui.Ask(fmt.Sprintf("Are you sure to delete %s? [Y/N]", pending.Path))
+	if yes != "Y" {
+		this.Ui.Output("bye")
+		return
+	}
+
+	if err = zkcluster.ClearPendingAdmin(pending); err != nil {
+		// e,g. zk.ErrBadVersion: the controller finished it or it was resubmitted meanwhile
+		this.Ui.Error(fmt.Sprintf("%s: %v", pending.Path, err))
+		return 1
+	}
+	this.Ui.Info(fmt.Sprintf("%s deleted", pending.Path))
+
+	if !this.resign {
+		this.Ui.Warn("the controller still has it in memory, re-elect the controller with -resign or restart it")
+		return
+	}
+
+	if err = zkcluster.ResignController(); err != nil {
+		this.Ui.Error(fmt.Sprintf("resign controller: %v", err))
+		return 1
+	}
+	this.Ui.Info("controller resigned, a new one will be elected")
+
+	return
+}
+
+type adminPartitions []zk.AdminPartition
+
+func (this adminPartitions) Len() int      { return len(this) }
+func (this adminPartitions) Swap(i, j int) { this[i], this[j] = this[j], this[i] }
+func (this adminPartitions) Less(i, j int) bool {
+	if this[i].Topic != this[j].Topic {
+		return this[i].Topic < this[j].Topic
+	}
+	return this[i].Partition < this[j].Partition
+}
+
+func sortedAdminPartitions(partitions []zk.AdminPartition) []zk.AdminPartition {
+	r := make([]zk.AdminPartition, len(partitions))
+	copy(r, partitions)
+	sort.Sort(adminPartitions(r))
+	return r
+}
+
+func (*Reassign) Synopsis() string {
+	return "Display or cancel pending partition reassignment and preferred replica election"
+}
+
+func (this *Reassign) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s reassign [options]
+
+    %s
+
+    Shows /admin/reassign_partitions and /admin/preferred_replica_election of clusters
+    with their age and the ISR catch-up of each reassigned partition.
+    A stuck one can be cancelled without zkCli surgery.
+
+    e,g.
+      gk reassign -z prod
+      gk reassign -z prod -c trade -cancel -resign
+
+Options:
+
+    -z zone
+      Default %s
+
+    -c cluster pattern
+
+    -status
+      Display the pending ones, which is the default.
+
+    -cancel
+      Delete the pending reassignment of the cluster.
+      Only the version displayed is deleted, so a newly submitted one is never lost.
+
+    -election
+      With -cancel, delete the pending preferred replica election instead.
+
+    -resign
+      With -cancel, re-elect the controller afterwards so that it forgets the cancelled one.
+
+    -stuck duration
+      Pending longer than this is highlighted as stuck.
+      Default 1h.
+
+`, this.Cmd, this.Synopsis(), ctx.ZkDefaultZone())
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,332 @@
+package command
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/funkygao/golib/gofmt"
+	"github.com/funkygao/golib/pipestream"
+	"github.com/ryanuber/columnize"
+)
+
+type Redistribute struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone, cluster string
+	topic         string
+	msgSize       int64 // avg message size in bytes to estimate data movement
+	throttle      int64 // replication bytes/s during reassignment, 0 means unlimited
+	yes           bool
+}
+
+// spreadPlan is the reassignment that spreads replicas of a topic evenly across brokers.
+type spreadPlan struct {
+	topic        string
+	current      map[int32][]int32
+	plan         map[int32][]int32
+	brokers      int   // brokers hosting replicas of the topic now
+	spread       int   // brokers hosting replicas of the topic after the plan
+	maxPerBroker int   // most replicas on a broker now
+	moves        int   // replicas to move
+	movedBytes   int64 // estimated
+}
+
+func (this *Redistribute) Run(args []string) (exitCode int) {
+	var throttleMB int64
+	cmdFlags := flag.NewFlagSet("redistribute", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.StringVar(&this.topic, "t", "", "")
+	cmdFlags.Int64Var(&this.msgSize, "msgsize", 1024, "")
+	cmdFlags.Int64Var(&throttleMB, "throttle", 0, "")
+	cmdFlags.BoolVar(&this.yes, "yes", false, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-c").
+		invalid(args) {
+		return 2
+	}
+
+	if this.msgSize < 1 || throttleMB < 0 {
+		this.Ui.Error("-msgsize must be positive, -throttle can't be negative")
+		return 2
+	}
+	this.throttle = throttleMB << 20
+
+	ensureZoneValid(this.zone)
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	defer zkzone.Close()
+	zkcluster := zkzone.NewCluster(this.cluster)
+	racks := zkcluster.BrokerRacks()
+	if len(racks) == 0 {
+		this.Ui.Error(fmt.Sprintf("cluster[%s] has no live brokers", this.cluster))
+		return 1
+	}
+
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), saramaConfig())
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+	defer kfk.Close()
+
+	if this.topic == "" {
+		this.detect(kfk, racks)
+		return
+	}
+
+	// redistribute a single topic requires admin rights
+	if validateArgs(this, this.Ui).
+		requireAdminRights("-z").
+		invalid(args) {
+		return 2
+	}
+
+	sp, err := this.planTopic(kfk, this.topic, racks)
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+	if sp.moves == 0 {
+		this.Ui.Info(fmt.Sprintf("%s already spread evenly across %d brokers", this.topic, len(racks)))
+		return
+	}
+
+	this.displayPlan(sp, racks)
+	swallow((&Replicas{topic: this.topic}).writeReassignFile(sp.plan))
+
+	if !this.yes {
+		yes, _ := this.Ui.Ask(fmt.Sprintf("Are you sure to move %d replicas of %s? [Y/N]", sp.moves, this.topic))
+		if yes != "Y" {
+			this.Ui.Output("bye")
+			return
+		}
+	}
+
+	this.executeReassignment(zkcluster)
+	this.Ui.Info(fmt.Sprintf("track with: %s migrate -z %s -c %s -t %s -verify", this.Cmd, this.zone, this.cluster, this.topic))
+	if this.throttle > 0 {
+		this.Ui.Warn("the throttle is removed by the verify after the reassignment completes")
+	}
+
+	return
+}
+
+// detect lists the topics whose replicas are concentrated on a few brokers.
+func (this *Redistribute) detect(kfk sarama.Client, racks map[int32]string) {
+	topics, err := kfk.Topics()
+	swallow(err)
+	sort.Strings(topics)
+
+	lines := []string{"Topic|Partitions|Brokers|Max/Broker|Moves|Movement"}
+	var totalMoves int
+	var totalBytes int64
+	for _, topic := range topics {
+		sp, err := this.planTopic(kfk, topic, racks)
+		if err != nil {
+			this.Ui.Warn(fmt.Sprintf("%s: %v", topic, err))
+			continue
+		}
+		if sp.moves == 0 {
+			continue
+		}
+
+		totalMoves += sp.moves
+		totalBytes += sp.movedBytes
+		lines = append(lines, fmt.Sprintf("%s|%d|%d/%d|%d|%d|%s", topic, len(sp.current),
+			sp.brokers, len(racks), sp.maxPerBroker, sp.moves, gofmt.ByteSize(sp.movedBytes)))
+	}
+
+	if len(lines) == 1 {
+		this.Ui.Info(fmt.Sprintf("%s/%s all topics spread evenly across %d brokers", this.zone, this.cluster, len(racks)))
+		return
+	}
+
+	this.Ui.Output(columnize.SimpleFormat(lines))
+	this.Ui.Output(fmt.Sprintf("%d topics concentrated, %d replicas %s to move, estimated with %dB/msg",
+		len(lines)-1, totalMoves, gofmt.ByteSize(totalBytes), this.msgSize))
+}
+
+func (this *Redistribute) planTopic(kfk sarama.Client, topic string, racks map[int32]string) (*spreadPlan, error) {
+	partitions, err := kfk.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := &spreadPlan{topic: topic, current: make(map[int32][]int32, len(partitions))}
+	load := make(map[int32]int)
+	for _, partitionId := range partitions {
+		replicas, err := kfk.Replicas(topic, partitionId)
+		if err != nil {
+			return nil, fmt.Errorf("#%d: %v", partitionId, err)
+		}
+
+		sp.current[partitionId] = replicas
+		for _, id := range replicas {
+			load[id]++
+		}
+	}
+
+	sp.brokers = len(load)
+	for _, n := range load {
+		if n > sp.maxPerBroker {
+			sp.maxPerBroker = n
+		}
+	}
+
+	sp.plan = zk.PlanSpread(sp.current, racks)
+	spread := make(map[int32]struct{})
+	for partitionId, replicas := range sp.current {
+		if target, present := sp.plan[partitionId]; present {
+			replicas = target
+		}
+		for _, id := range replicas {
+			spread[id] = struct{}{}
+		}
+	}
+	sp.spread = len(spread)
+
+	for partitionId, replicas := range sp.plan {
+		moved := movedReplicas(sp.current[partitionId], replicas)
+		if moved == 0 {
+			continue
+		}
+
+		sp.moves += moved
+		latestOffset, err := kfk.GetOffset(topic, partitionId, sarama.OffsetNewest)
+		if err != nil {
+			return nil, fmt.Errorf("#%d: %v", partitionId, err)
+		}
+		oldestOffset, err := kfk.GetOffset(topic, partitionId, sarama.OffsetOldest)
+		if err != nil {
+			return nil, fmt.Errorf("#%d: %v", partitionId, err)
+		}
+
+		sp.movedBytes += int64(moved) * (latestOffset - oldestOffset) * this.msgSize
+	}
+
+	return sp, nil
+}
+
+// movedReplicas returns how many replicas of target are not in current, each of which
+// copies the whole partition.
+func movedReplicas(current, target []int32) int {
+	n := 0
+	for _, id := range target {
+		found := false
+		for _, c := range current {
+			if c == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			n++
+		}
+	}
+	return n
+}
+
+func (this *Redistribute) displayPlan(sp *spreadPlan, racks map[int32]string) {
+	var partitionIds []int
+	for partitionId := range sp.plan {
+		partitionIds = append(partitionIds, int(partitionId))
+	}
+	sort.Ints(partitionIds)
+	for _, partitionId := range partitionIds {
+		replicas := sp.plan[int32(partitionId)]
+		this.Ui.Output(fmt.Sprintf("%s#%d %+v -> %s across %d racks", sp.topic, partitionId,
+			sp.current[int32(partitionId)], color.Cyan("%+v", replicas), zk.DistinctRacks(replicas, racks)))
+	}
+
+	this.Ui.Output(fmt.Sprintf("%s brokers %d -> %d, %d replicas to move, %s estimated with %dB/msg",
+		sp.topic, sp.brokers, sp.spread, sp.moves,
+		gofmt.ByteSize(sp.movedBytes), this.msgSize))
+	if this.throttle > 0 {
+		this.Ui.Output(fmt.Sprintf("throttled at %s/s, takes at least %s", gofmt.ByteSize(this.throttle),
+			time.Duration(sp.movedBytes/this.throttle)*time.Second))
+	}
+}
+
+func (this *Redistribute) executeReassignment(zkcluster *zk.ZkCluster) {
+	args := []string{
+		fmt.Sprintf("--zookeeper %s", zkcluster.ZkConnectAddr()),
+		fmt.Sprintf("--reassignment-json-file %s", reassignNodeFilename),
+		"--execute",
+	}
+	if this.throttle > 0 {
+		// requires kafka 0.10.1+
+		args = append(args, fmt.Sprintf("--throttle %d", this.throttle))
+	}
+
+	cmd := pipestream.New(fmt.Sprintf("%s/bin/kafka-reassign-partitions.sh", ctx.KafkaHome()), args...)
+	if err := cmd.Open(); err != nil {
+		this.Ui.Error(err.Error())
+		return
+	}
+	defer cmd.Close()
+
+	scanner := bufio.NewScanner(cmd.Reader())
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		this.Ui.Output(color.Yellow(scanner.Text()))
+	}
+}
+
+func (*Redistribute) Synopsis() string {
+	return "Spread partitions of topics concentrated on a few brokers across all brokers"
+}
+
+func (this *Redistribute) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s redistribute -z zone -c cluster [options]
+
+    %s
+
+    Topics created before the cluster grew keep their replicas on the old brokers.
+    Without -t, lists such topics with the replicas to move and the estimated data movement.
+    With -t, generates the reassignment that moves the fewest replicas to spread the topic
+    evenly, keeping rack diversity and preferred leader position, then executes it.
+
+    e,g.
+      gk redistribute -z prod -c trade
+      gk redistribute -z prod -c trade -t order -throttle 50
+
+Options:
+
+    -z zone
+      Default %s
+
+    -c cluster
+
+    -t topic
+      Redistribute the topic.
+
+    -msgsize bytes
+      Avg message size to estimate data movement from messages in stock.
+      Default 1024.
+
+    -throttle MB/s
+      Replication throttle during the reassignment, requires kafka 0.10.1+.
+      Default 0, unlimited.
+
+    -yes
+      Execute without confirmation.
+
+`, this.Cmd, this.Synopsis(), ctx.ZkDefaultZone())
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,13 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestMovedReplicas(t *testing.T) {
+	assert.Equal(t, 0, movedReplicas([]int32{1, 2}, []int32{2, 1}))
+	assert.Equal(t, 1, movedReplicas([]int32{1, 2}, []int32{3, 2}))
+	assert.Equal(t, 2, movedReplicas([]int32{1, 2}, []int32{3, 4}))
+}
@@ -0,0 +1,246 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/ryanuber/columnize"
+)
+
+type RenameGroup struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone, cluster string
+	from, to      string
+	topicPattern  string
+	force         bool
+	confirmYes    bool
+	deleteOld     bool
+	timeout       time.Duration
+}
+
+func (this *RenameGroup) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("rename-group", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.StringVar(&this.from, "from", "", "")
+	cmdFlags.StringVar(&this.to, "to", "", "")
+	cmdFlags.StringVar(&this.topicPattern, "t", "", "")
+	cmdFlags.BoolVar(&this.force, "force", false, "")
+	cmdFlags.BoolVar(&this.confirmYes, "yes", false, "")
+	cmdFlags.BoolVar(&this.deleteOld, "delete", false, "")
+	cmdFlags.DurationVar(&this.timeout, "timeout", time.Minute*30, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-c", "-from", "-to").
+		requireAdminRights("-z").
+		invalid(args) {
+		return 2
+	}
+
+	if this.from == this.to {
+		this.Ui.Error("-from and -to are the same group")
+		return 2
+	}
+
+	ensureZoneValid(this.zone)
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	defer zkzone.Close()
+	zkcluster := zkzone.NewCluster(this.cluster)
+
+	groups := zkcluster.ConsumerGroups()
+	if n := len(groups[this.from]); n > 0 {
+		this.Ui.Error(fmt.Sprintf("group[%s] has %d online consumers, stop them first", this.from, n))
+		return 1
+	}
+	if n := len(groups[this.to]); n > 0 {
+		this.Ui.Error(fmt.Sprintf("group[%s] has %d online consumers, stop them first", this.to, n))
+		return 1
+	}
+
+	offsets := this.offsetsOf(zkcluster, this.from)
+	if len(offsets) == 0 {
+		this.Ui.Error(fmt.Sprintf("group[%s] has no committed offsets", this.from))
+		return 1
+	}
+
+	existing := this.offsetsOf(zkcluster, this.to)
+	for topic := range offsets {
+		if len(existing[topic]) > 0 && !this.force {
+			this.Ui.Error(fmt.Sprintf("group[%s] already has offsets of topic[%s], -force to overwrite", this.to, topic))
+			return 1
+		}
+	}
+
+	this.printOffsets(offsets)
+	if !this.confirm(fmt.Sprintf("copy offsets of group %s to %s?", this.from, this.to)) {
+		return
+	}
+
+	for topic, partitions := range offsets {
+		for partition, offset := range partitions {
+			if err := zkcluster.SetConsumerGroupOffset(topic, this.to, partition, offset); err != nil {
+				this.Ui.Error(fmt.Sprintf("%s#%s: %v", topic, partition, err))
+				return 1
+			}
+		}
+	}
+
+	// verify
+	copied := this.offsetsOf(zkcluster, this.to)
+	for topic, partitions := range offsets {
+		for partition, offset := range partitions {
+			if got, present := copied[topic][partition]; !present || got != offset {
+				this.Ui.Error(fmt.Sprintf("verify %s#%s: expected %d, got %d", topic, partition, offset, got))
+				return 1
+			}
+		}
+	}
+	this.Ui.Info(fmt.Sprintf("group[%s] offsets copied to %s and verified", this.from, this.to))
+
+	if !this.deleteOld {
+		this.Ui.Output(fmt.Sprintf("start consumers with group %s, then cleanup old group with: %s consumers -z %s -c %s -g %s -cleanup",
+			this.to, this.Cmd, this.zone, this.cluster, this.from))
+		return
+	}
+
+	return this.deleteOldGroup(zkzone, zkcluster, offsets)
+}
+
+// deleteOldGroup waits for the new group to commit, then deletes the old group.
+func (this *RenameGroup) deleteOldGroup(zkzone *zk.ZkZone, zkcluster *zk.ZkCluster,
+	offsets map[string]map[string]int64) (exitCode int) {
+	this.Ui.Output(fmt.Sprintf("waiting up to %s for group %s to commit...", this.timeout, this.to))
+
+	deadline := time.Now().Add(this.timeout)
+	for !this.committedSince(zkcluster, this.to, offsets) {
+		if time.Now().After(deadline) {
+			this.Ui.Warn(fmt.Sprintf("group[%s] shows no commits within %s, old group %s kept", this.to, this.timeout, this.from))
+			return 1
+		}
+
+		time.Sleep(time.Second * 10)
+	}
+
+	// the old group must not have been resurrected in the meantime
+	if n := len(zkcluster.ConsumerGroups()[this.from]); n > 0 || this.committedSince(zkcluster, this.from, offsets) {
+		this.Ui.Error(fmt.Sprintf("group[%s] is still in use, old group kept", this.from))
+		return 1
+	}
+
+	if !this.confirm(fmt.Sprintf("group %s is committing, delete old group %s?", this.to, this.from)) {
+		return
+	}
+
+	swallow(zkzone.DeleteRecursive(zkcluster.ConsumerGroupRoot(this.from)))
+	this.Ui.Info(fmt.Sprintf("group[%s] deleted", this.from))
+	return
+}
+
+// offsetsOf returns committed offsets of a group on topics matching the topic pattern.
+func (this *RenameGroup) offsetsOf(zkcluster *zk.ZkCluster, group string) map[string]map[string]int64 {
+	r := zkcluster.ConsumerOffsetsOfGroup(group)
+	for topic, partitions := range r {
+		if !patternMatched(topic, this.topicPattern) || len(partitions) == 0 {
+			delete(r, topic)
+		}
+	}
+	return r
+}
+
+// committedSince checks whether the group has committed any offset other than the baseline.
+func (this *RenameGroup) committedSince(zkcluster *zk.ZkCluster, group string, baseline map[string]map[string]int64) bool {
+	for topic, partitions := range this.offsetsOf(zkcluster, group) {
+		for partition, offset := range partitions {
+			if old, present := baseline[topic][partition]; !present || old != offset {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (this *RenameGroup) confirm(question string) bool {
+	if this.confirmYes {
+		return true
+	}
+
+	yes, err := this.Ui.Ask(question + " [y/N]")
+	swallow(err)
+	if strings.ToLower(yes) != "y" {
+		this.Ui.Info("aborted")
+		return false
+	}
+	return true
+}
+
+func (this *RenameGroup) printOffsets(offsets map[string]map[string]int64) {
+	topics := make([]string, 0, len(offsets))
+	for topic := range offsets {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	lines := []string{"Topic|Partition|Offset"}
+	for _, topic := range topics {
+		partitions := make([]string, 0, len(offsets[topic]))
+		for partition := range offsets[topic] {
+			partitions = append(partitions, partition)
+		}
+		sort.Strings(partitions)
+
+		for _, partition := range partitions {
+			lines = append(lines, fmt.Sprintf("%s|%s|%d", topic, partition, offsets[topic][partition]))
+		}
+	}
+
+	this.Ui.Output(color.Blue("%s/%s %s -> %s", this.zone, this.cluster, this.from, this.to))
+	this.Ui.Output(columnize.SimpleFormat(lines))
+}
+
+func (*RenameGroup) Synopsis() string {
+	return "Migrate a consumer group to a new name without losing its position"
+}
+
+func (this *RenameGroup) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s rename-group -z zone -c cluster -from group -to group [options]
+
+    %s
+
+    Committed offsets of all subscribed topics are copied to the new group and verified.
+    Consumers of both groups must be stopped during the copy.
+
+Options:
+
+    -t topic pattern
+      Only migrate offsets of matched topics.
+
+    -force
+      Overwrite offsets the new group already has.
+
+    -delete
+      After copy, wait for consumers of the new group to commit, then delete the old group.
+
+    -timeout duration
+      Max time to wait for the new group to commit when -delete. Default 30m.
+
+    -yes
+      Skip confirmation.
+
+`, this.Cmd, this.Synopsis())
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,234 @@
+package command
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+)
+
+type Replicas struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone, cluster string
+	topic         string
+	replicas      int
+	yes           bool
+}
+
+func (this *Replicas) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("replicas", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.StringVar(&this.topic, "t", "", "")
+	cmdFlags.IntVar(&this.replicas, "n", 0, "")
+	cmdFlags.BoolVar(&this.yes, "yes", false, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-c", "-t", "-n").
+		requireAdminRights("-z").
+		invalid(args) {
+		return 2
+	}
+
+	if this.replicas < 1 {
+		this.Ui.Error("-n must be positive")
+		return 2
+	}
+
+	ensureZoneValid(this.zone)
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	zkcluster := zkzone.NewCluster(this.cluster)
+
+	current, err := this.currentAssignment(zkcluster)
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	racks := zkcluster.BrokerRacks()
+	plan, err := zk.PlanReplicas(current, racks, this.replicas)
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+	if len(plan) == 0 {
+		this.Ui.Info(fmt.Sprintf("%s already has %d replicas", this.topic, this.replicas))
+		return
+	}
+
+	var partitionIds []int
+	for partitionId := range plan {
+		partitionIds = append(partitionIds, int(partitionId))
+	}
+	sort.Ints(partitionIds)
+	for _, partitionId := range partitionIds {
+		replicas := plan[int32(partitionId)]
+		this.Ui.Output(fmt.Sprintf("%s#%d %+v -> %s across %d racks", this.topic, partitionId,
+			current[int32(partitionId)], color.Cyan("%+v", replicas), zk.DistinctRacks(replicas, racks)))
+	}
+
+	swallow(this.writeReassignFile(plan))
+
+	if !this.yes {
+		yes, _ := this.Ui.Ask(fmt.Sprintf("Are you sure to change replicas of %s to %d? [Y/N]", this.topic, this.replicas))
+		if yes != "Y" {
+			this.Ui.Output("bye")
+			return
+		}
+	}
+
+	(&Migrate{Ui: this.Ui, zkcluster: zkcluster}).executeReassignment()
+	this.track(zkcluster, plan)
+
+	return
+}
+
+// currentAssignment returns replicas of each partition, the 1st replica is the preferred leader.
+func (this *Replicas) currentAssignment(zkcluster *zk.ZkCluster) (map[int32][]int32, error) {
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), saramaConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer kfk.Close()
+
+	partitions, err := kfk.Partitions(this.topic)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[int32][]int32, len(partitions))
+	for _, partitionId := range partitions {
+		replicas, err := kfk.Replicas(this.topic, partitionId)
+		if err != nil {
+			return nil, fmt.Errorf("%s#%d: %v", this.topic, partitionId, err)
+		}
+
+		r[partitionId] = replicas
+	}
+
+	return r, nil
+}
+
+func (this *Replicas) writeReassignFile(plan map[int32][]int32) error {
+	type PartitionMeta struct {
+		Topic     string  `json:"topic"`
+		Partition int32   `json:"partition"`
+		Replicas  []int32 `json:"replicas"`
+	}
+	type ReassignMeta struct {
+		Version    int             `json:"version"`
+		Partitions []PartitionMeta `json:"partitions"`
+	}
+
+	js := ReassignMeta{Version: 1}
+	for partitionId, replicas := range plan {
+		js.Partitions = append(js.Partitions, PartitionMeta{
+			Topic:     this.topic,
+			Partition: partitionId,
+			Replicas:  replicas,
+		})
+	}
+
+	b, err := json.Marshal(js)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(reassignNodeFilename, b, 0644)
+}
+
+// track waits till the ISR of each reassigned partition is exactly the planned replicas.
+func (this *Replicas) track(zkcluster *zk.ZkCluster, plan map[int32][]int32) {
+	t0 := time.Now()
+	pending := make(map[int32][]int32, len(plan))
+	for partitionId, replicas := range plan {
+		pending[partitionId] = replicas
+	}
+
+	for len(pending) > 0 {
+		time.Sleep(time.Second * 5)
+
+		for partitionId, replicas := range pending {
+			isr, _, _ := zkcluster.Isr(this.topic, partitionId)
+			if isrCaughtUp(isr, replicas) {
+				delete(pending, partitionId)
+				continue
+			}
+
+			this.Ui.Output(fmt.Sprintf("    %s#%d isr %+v, replicas %+v", this.topic, partitionId, isr, replicas))
+		}
+
+		this.Ui.Output(fmt.Sprintf("%s %d/%d partitions caught up", time.Since(t0), len(plan)-len(pending), len(plan)))
+	}
+
+	this.Ui.Info(fmt.Sprintf("%s now has %d replicas, %s is safe to remove", this.topic, this.replicas,
+		reassignNodeFilename))
+}
+
+func isrCaughtUp(isr []int, replicas []int32) bool {
+	if len(isr) != len(replicas) {
+		return false
+	}
+
+	in := make(map[int]struct{}, len(isr))
+	for _, id := range isr {
+		in[id] = struct{}{}
+	}
+	for _, id := range replicas {
+		if _, present := in[int(id)]; !present {
+			return false
+		}
+	}
+	return true
+}
+
+func (*Replicas) Synopsis() string {
+	return "Change replication factor of an existing topic"
+}
+
+func (this *Replicas) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s replicas [options]
+
+    %s
+
+    Generates the partition reassignment with replicas spread across racks and brokers,
+    executes it and tracks the ISR catch-up till completion.
+    Tag broker racks with 'gk clusters -s -rack' beforehand if racks can't be derived.
+
+    e,g.
+      gk replicas -z prod -c trade -t order -n 3
+
+Options:
+
+    -z zone
+      Default %s
+
+    -c cluster
+
+    -t topic
+
+    -n replicas
+      The target replication factor.
+
+    -yes
+      Execute without confirmation.
+
+`, this.Cmd, this.Synopsis(), ctx.ZkDefaultZone())
+	return strings.TrimSpace(help)
+}
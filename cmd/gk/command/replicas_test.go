@@ -0,0 +1,70 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/zk"
+)
+
+func TestPlanReplicasRaise(t *testing.T) {
+	racks := map[int32]string{
+		1: "a",
+		2: "a",
+		3: "b",
+		4: "b",
+	}
+	current := map[int32][]int32{
+		0: {1},
+		1: {2},
+		2: {3, 4}, // already 2 replicas
+	}
+
+	plan, err := zk.PlanReplicas(current, racks, 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(plan))
+	assert.Equal(t, []int32{1, 3}, plan[0]) // another rack with fewest replicas
+	assert.Equal(t, []int32{2, 4}, plan[1])
+	_, present := plan[2]
+	assert.Equal(t, false, present)
+
+	_, err = zk.PlanReplicas(current, racks, 5)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestPlanReplicasLower(t *testing.T) {
+	racks := map[int32]string{
+		1: "a",
+		2: "a",
+		3: "b",
+	}
+	current := map[int32][]int32{
+		0: {2, 1, 3},
+	}
+
+	plan, err := zk.PlanReplicas(current, racks, 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []int32{2, 3}, plan[0]) // leader kept, rack diversity kept
+}
+
+func TestPlanReplicasHostAsRack(t *testing.T) {
+	// untagged brokers fall back to their host as rack in ZkCluster.BrokerRacks
+	racks := map[int32]string{
+		1: "10.1.1.1",
+		2: "10.1.1.1",
+		3: "10.1.1.2",
+	}
+	current := map[int32][]int32{
+		0: {1},
+	}
+
+	plan, err := zk.PlanReplicas(current, racks, 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []int32{1, 3}, plan[0])
+}
+
+func TestIsrCaughtUp(t *testing.T) {
+	assert.Equal(t, true, isrCaughtUp([]int{1, 3}, []int32{3, 1}))
+	assert.Equal(t, false, isrCaughtUp([]int{1}, []int32{1, 3}))
+	assert.Equal(t, false, isrCaughtUp([]int{1, 2, 3}, []int32{1, 3}))
+}
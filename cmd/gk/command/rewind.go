@@ -0,0 +1,245 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/ryanuber/columnize"
+)
+
+type Rewind struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone, cluster string
+	group         string
+	topicPattern  string
+	back          time.Duration
+	confirmYes    bool
+}
+
+// rewindPartition is the rollback plan of a partition.
+type rewindPartition struct {
+	topic     string
+	partition string
+	committed int64
+	target    int64
+	oldest    bool // target is capped by retention
+}
+
+func (this rewindPartition) replay() int64 {
+	return this.committed - this.target
+}
+
+func (this *Rewind) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("rewind", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.StringVar(&this.group, "g", "", "")
+	cmdFlags.StringVar(&this.topicPattern, "t", "", "")
+	cmdFlags.DurationVar(&this.back, "back", 0, "")
+	cmdFlags.BoolVar(&this.confirmYes, "yes", false, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-c", "-g", "-back").
+		requireAdminRights("-z").
+		invalid(args) {
+		return 2
+	}
+
+	if this.back <= 0 {
+		this.Ui.Error("-back must be positive")
+		return 2
+	}
+
+	ensureZoneValid(this.zone)
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	defer zkzone.Close()
+	zkcluster := zkzone.NewCluster(this.cluster)
+
+	// online consumers would overwrite the rewound offsets with their next commit
+	if n := len(zkcluster.ConsumerGroups()[this.group]); n > 0 {
+		this.Ui.Error(fmt.Sprintf("group[%s] has %d online consumers, stop them first", this.group, n))
+		return 1
+	}
+
+	committed := zkcluster.ConsumerOffsetsOfGroup(this.group)
+	for topic, partitions := range committed {
+		if !patternMatched(topic, this.topicPattern) || len(partitions) == 0 {
+			delete(committed, topic)
+		}
+	}
+	if len(committed) == 0 {
+		this.Ui.Error(fmt.Sprintf("group[%s] has no committed offsets", this.group))
+		return 1
+	}
+
+	at := time.Now().Add(-this.back)
+	byTime := make(map[string][]partitionTimeOffset, len(committed))
+	for topic := range committed {
+		offsets, err := findOffsetsByTime(zkcluster, topic, at)
+		if err != nil {
+			this.Ui.Error(fmt.Sprintf("%s: %v", topic, err))
+			return 1
+		}
+		byTime[topic] = offsets
+	}
+
+	plan := rewindPlan(committed, byTime)
+	if len(plan) == 0 {
+		this.Ui.Info(fmt.Sprintf("group[%s] has nothing to replay since %s", this.group, at.Format(offsetFindTimeLayout)))
+		return
+	}
+
+	replay := this.printPlan(plan, at)
+	if !this.confirm(fmt.Sprintf("rewind group %s to replay %d messages?", this.group, replay)) {
+		return
+	}
+
+	// the group might be started during confirmation
+	if n := len(zkcluster.ConsumerGroups()[this.group]); n > 0 {
+		this.Ui.Error(fmt.Sprintf("group[%s] has %d online consumers, aborted", this.group, n))
+		return 1
+	}
+
+	targets := make(map[string]map[string]int64)
+	for _, p := range plan {
+		if _, present := targets[p.topic]; !present {
+			targets[p.topic] = make(map[string]int64)
+		}
+		targets[p.topic][p.partition] = p.target
+	}
+	if err := zkcluster.SetConsumerGroupOffsets(this.group, targets); err != nil {
+		this.Ui.Error(fmt.Sprintf("nothing changed: %v", err))
+		return 1
+	}
+
+	// verify
+	written := zkcluster.ConsumerOffsetsOfGroup(this.group)
+	for _, p := range plan {
+		if got := written[p.topic][p.partition]; got != p.target {
+			this.Ui.Error(fmt.Sprintf("verify %s#%s: expected %d, got %d", p.topic, p.partition, p.target, got))
+			return 1
+		}
+	}
+
+	this.Ui.Info(fmt.Sprintf("group[%s] rewound %s on %d partitions, %d messages to replay",
+		this.group, this.back, len(plan), replay))
+	return
+}
+
+// rewindPlan computes the partitions to roll back, sorted by topic and partition.
+// A group is never moved forward: partitions whose committed offset is already before
+// the offset by time are left as is.
+func rewindPlan(committed map[string]map[string]int64, byTime map[string][]partitionTimeOffset) []rewindPartition {
+	var r []rewindPartition
+	for topic, offsets := range byTime {
+		for _, o := range offsets {
+			partition := strconv.Itoa(int(o.partition))
+			c, present := committed[topic][partition]
+			if !present || o.offset >= c {
+				continue
+			}
+
+			r = append(r, rewindPartition{
+				topic:     topic,
+				partition: partition,
+				committed: c,
+				target:    o.offset,
+				oldest:    o.offset == o.oldest,
+			})
+		}
+	}
+
+	sort.Sort(rewindPartitionsByName(r))
+	return r
+}
+
+// printPlan shows the rollback plan and returns the total messages to replay.
+func (this *Rewind) printPlan(plan []rewindPartition, at time.Time) (replay int64) {
+	lines := []string{"Topic|Partition|Committed|Target|Replay|Note"}
+	for _, p := range plan {
+		var note string
+		if p.oldest {
+			note = color.Yellow("oldest retained")
+		}
+		lines = append(lines, fmt.Sprintf("%s|%s|%d|%d|%d|%s", p.topic, p.partition, p.committed, p.target, p.replay(), note))
+		replay += p.replay()
+	}
+
+	this.Ui.Output(color.Blue("%s/%s %s rewind to %s", this.zone, this.cluster, this.group, at.Format(offsetFindTimeLayout)))
+	this.Ui.Output(columnize.SimpleFormat(lines))
+	this.Ui.Output(fmt.Sprintf("%d partitions, %d messages to replay", len(plan), replay))
+	return
+}
+
+func (this *Rewind) confirm(question string) bool {
+	if this.confirmYes {
+		return true
+	}
+
+	yes, err := this.Ui.Ask(question + " [y/N]")
+	swallow(err)
+	if strings.ToLower(yes) != "y" {
+		this.Ui.Info("aborted")
+		return false
+	}
+	return true
+}
+
+type rewindPartitionsByName []rewindPartition
+
+func (this rewindPartitionsByName) Len() int      { return len(this) }
+func (this rewindPartitionsByName) Swap(i, j int) { this[i], this[j] = this[j], this[i] }
+func (this rewindPartitionsByName) Less(i, j int) bool {
+	if this[i].topic != this[j].topic {
+		return this[i].topic < this[j].topic
+	}
+
+	pi, _ := strconv.Atoi(this[i].partition)
+	pj, _ := strconv.Atoi(this[j].partition)
+	return pi < pj
+}
+
+func (*Rewind) Synopsis() string {
+	return "Roll back a consumer group by duration across all its topics"
+}
+
+func (this *Rewind) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s rewind -z zone -c cluster -g group -back duration [options]
+
+    %s
+
+    Target offset of each partition is found by timestamp, and the plan with the
+    messages to be replayed is shown for confirmation. Offsets are written in a single
+    zk transaction: either all partitions are rewound or none.
+    Consumers of the group must be stopped.
+
+Options:
+
+    -back duration
+      How far to roll back, e,g. 30m.
+
+    -t topic pattern
+      Only rewind offsets of matched topics.
+
+    -yes
+      Skip confirmation.
+
+`, this.Cmd, this.Synopsis())
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,34 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestRewindPlan(t *testing.T) {
+	committed := map[string]map[string]int64{
+		"t1": {"0": 100, "1": 50},
+		"t2": {"0": 10},
+	}
+	byTime := map[string][]partitionTimeOffset{
+		"t1": {
+			{partition: 1, offset: 20, oldest: 0, newest: 60},
+			{partition: 0, offset: 80, oldest: 80, newest: 120},
+			{partition: 2, offset: 5, oldest: 0, newest: 9}, // never committed
+		},
+		"t2": {
+			{partition: 0, offset: 15, oldest: 0, newest: 30}, // never moved forward
+		},
+	}
+
+	plan := rewindPlan(committed, byTime)
+	assert.Equal(t, 2, len(plan))
+	assert.Equal(t, "0", plan[0].partition)
+	assert.Equal(t, int64(80), plan[0].target)
+	assert.Equal(t, int64(20), plan[0].replay())
+	assert.Equal(t, true, plan[0].oldest)
+	assert.Equal(t, "1", plan[1].partition)
+	assert.Equal(t, int64(30), plan[1].replay())
+	assert.Equal(t, false, plan[1].oldest)
+}
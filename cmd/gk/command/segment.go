@@ -15,8 +15,10 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/ctx"
 	"github.com/funkygao/gocli"
 	"github.com/funkygao/golib/gofmt"
 	"github.com/golang/snappy"
@@ -33,18 +35,51 @@ type Segment struct {
 	rootPath string
 	filename string
 	limit    int
+
+	topic        string
+	instanceRoot string
+	sshUser      string
+	slack        time.Duration
+	stuckOnly    bool
 }
 
 func (this *Segment) Run(args []string) (exitCode int) {
+	var (
+		zone, cluster string
+		instanceDir   string
+	)
 	cmdFlags := flag.NewFlagSet("segment", flag.ContinueOnError)
 	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
 	cmdFlags.StringVar(&this.rootPath, "s", "", "")
 	cmdFlags.IntVar(&this.limit, "n", -1, "")
 	cmdFlags.StringVar(&this.filename, "f", "", "")
+	cmdFlags.StringVar(&zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&cluster, "c", "", "")
+	cmdFlags.StringVar(&this.topic, "t", "", "")
+	cmdFlags.StringVar(&this.instanceRoot, "root", "/var/wd", "")
+	cmdFlags.StringVar(&this.sshUser, "user", "", "")
+	cmdFlags.DurationVar(&this.slack, "slack", time.Hour, "")
+	cmdFlags.BoolVar(&this.stuckOnly, "stuck", false, "")
+	cmdFlags.StringVar(&instanceDir, "report", "", "")
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
+	if instanceDir != "" {
+		// invoked on a broker host through ssh by the cluster mode
+		if err := this.reportLocal(instanceDir); err != nil {
+			this.Ui.Error(err.Error())
+			return 1
+		}
+		return
+	}
+
+	if cluster != "" {
+		ensureZoneValid(zone)
+		this.reportCluster(zone, cluster)
+		return
+	}
+
 	if this.rootPath != "" {
 		this.printSummary()
 		return
@@ -264,7 +299,7 @@ func (this *Segment) printSummary() {
 }
 
 func (*Segment) Synopsis() string {
-	return "Scan the kafka segments and display summary"
+	return "Scan the kafka segments and display summary, find partitions retention fails to delete"
 }
 
 func (this *Segment) Help() string {
@@ -282,6 +317,31 @@ Usage: %s segment [options]
     -n limit
       Default unlimited.
 
-`, this.Cmd, this.Synopsis())
+    -z zone
+      Default %s
+
+    -c cluster
+      Report segment count, size and oldest segment of each partition on every broker,
+      flagging partitions whose closed segments outlive the retention: retention not
+      actually deleting data.
+      Runs 'gk segment -report' on each broker host through ssh, which requires key based
+      login and gk installed on the brokers.
+
+    -t topic
+
+    -root dir
+      Root dir of kafka instances deployed by 'gk deploy'.
+      Default /var/wd
+
+    -user ssh user
+
+    -slack duration
+      Tolerance beyond retention before a partition is flagged.
+      Default 1h
+
+    -stuck
+      Display flagged partitions only.
+
+`, this.Cmd, this.Synopsis(), ctx.ZkDefaultZone())
 	return strings.TrimSpace(help)
 }
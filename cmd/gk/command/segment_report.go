@@ -0,0 +1,348 @@
+package command
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/golib/color"
+	"github.com/funkygao/golib/gofmt"
+	gio "github.com/funkygao/golib/io"
+	"github.com/ryanuber/columnize"
+)
+
+// kafka default log.retention.hours
+const defaultKafkaRetention = time.Hour * 168
+
+// partitionSegments is the on-broker log segments of a partition.
+type partitionSegments struct {
+	topic     string
+	partition string
+	segments  int
+	size      int64     // all files of the partition dir
+	oldest    time.Time // mtime of the oldest segment
+}
+
+// brokerSegments is reported by 'gk segment -report' on a broker host.
+type brokerSegments struct {
+	retention  time.Duration // broker default, 0 if not found in server.properties
+	partitions []partitionSegments
+}
+
+// reportLocal prints the segments of each partition of the kafka instance on this host.
+// Invoked on a broker host through ssh by the cluster mode.
+//
+// Output:
+// retention.ms <broker default>
+// <topic-partition> <segments> <size> <oldest segment mtime>
+func (this *Segment) reportLocal(instanceDir string) error {
+	lines, err := gio.ReadLines(filepath.Join(instanceDir, "config", "server.properties"))
+	if err != nil {
+		return err
+	}
+
+	retention, logDirs := parseServerProperties(lines)
+	if len(logDirs) == 0 {
+		return fmt.Errorf("%s: empty log.dirs", instanceDir)
+	}
+
+	if retention > 0 {
+		this.Ui.Output(fmt.Sprintf("retention.ms %d", retention/time.Millisecond))
+	}
+	for _, logDir := range logDirs {
+		dirs, err := ioutil.ReadDir(logDir)
+		if err != nil {
+			return err
+		}
+
+		for _, dir := range dirs {
+			if !dir.IsDir() {
+				continue
+			}
+			if _, _, ok := topicPartitionOfDir(dir.Name()); !ok {
+				continue
+			}
+
+			files, err := ioutil.ReadDir(filepath.Join(logDir, dir.Name()))
+			if err != nil {
+				return err
+			}
+
+			var (
+				segments int
+				size     int64
+				oldest   time.Time
+			)
+			for _, f := range files {
+				size += f.Size()
+				if !this.isKafkaLogSegment(f.Name()) {
+					continue
+				}
+
+				segments++
+				if oldest.IsZero() || f.ModTime().Before(oldest) {
+					oldest = f.ModTime()
+				}
+			}
+
+			var mtime int64
+			if !oldest.IsZero() {
+				mtime = oldest.Unix()
+			}
+			this.Ui.Output(fmt.Sprintf("%s %d %d %d", dir.Name(), segments, size, mtime))
+		}
+	}
+
+	return nil
+}
+
+// parseServerProperties returns the default retention and log dirs of a kafka server.properties.
+// As kafka does, log.retention.ms takes precedence over minutes, which over hours.
+func parseServerProperties(lines []string) (retention time.Duration, logDirs []string) {
+	var ms, minutes, hours int64
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		k, v := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch k {
+		case "log.dirs", "log.dir":
+			logDirs = logDirs[:0]
+			for _, dir := range strings.Split(v, ",") {
+				if dir = strings.TrimSpace(dir); dir != "" {
+					logDirs = append(logDirs, dir)
+				}
+			}
+
+		case "log.retention.ms":
+			ms, _ = strconv.ParseInt(v, 10, 64)
+
+		case "log.retention.minutes":
+			minutes, _ = strconv.ParseInt(v, 10, 64)
+
+		case "log.retention.hours":
+			hours, _ = strconv.ParseInt(v, 10, 64)
+		}
+	}
+
+	switch {
+	case ms > 0:
+		retention = time.Duration(ms) * time.Millisecond
+	case minutes > 0:
+		retention = time.Duration(minutes) * time.Minute
+	case hours > 0:
+		retention = time.Duration(hours) * time.Hour
+	}
+	return
+}
+
+// topicPartitionOfDir parses kafka partition dir name: topic-partition.
+func topicPartitionOfDir(name string) (topic, partition string, ok bool) {
+	i := strings.LastIndex(name, "-")
+	if i <= 0 || i == len(name)-1 {
+		return
+	}
+
+	if _, err := strconv.Atoi(name[i+1:]); err != nil {
+		return
+	}
+
+	return name[:i], name[i+1:], true
+}
+
+// topicRetention returns retention.ms of the topic config znode data, 0 if not overridden.
+func topicRetention(config string) time.Duration {
+	var v struct {
+		Config map[string]string `json:"config"`
+	}
+	if err := json.Unmarshal([]byte(config), &v); err != nil {
+		return 0
+	}
+
+	ms, _ := strconv.ParseInt(v.Config["retention.ms"], 10, 64)
+	return time.Duration(ms) * time.Millisecond
+}
+
+// retentionStuck checks if closed segments outlive the retention: kafka never deletes the
+// active segment, so a single segment older than retention is fine.
+func retentionStuck(p partitionSegments, retention, slack time.Duration, now time.Time) bool {
+	return p.segments > 1 && now.Sub(p.oldest) > retention+slack
+}
+
+// reportCluster runs 'gk segment -report' on each live broker host of the cluster through ssh concurrently.
+func (this *Segment) reportCluster(zone, cluster string) {
+	zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
+	zkcluster := zkzone.NewCluster(cluster)
+
+	topicRetentions := make(map[string]time.Duration)
+	for topic, config := range zkcluster.ConfiggedTopics() {
+		if d := topicRetention(config.Config); d > 0 {
+			topicRetentions[topic] = d
+		}
+	}
+
+	brokers := zkcluster.Brokers()
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		reports = make(map[string]brokerSegments, len(brokers)) // broker id: segments
+	)
+	for _, b := range brokers {
+		wg.Add(1)
+		go func(b *zk.BrokerZnode) {
+			defer wg.Done()
+
+			r, err := this.reportRemote(b.Host, cluster)
+			if err != nil {
+				this.Ui.Error(fmt.Sprintf("%s %s: %v", b.Id, b.Host, err))
+				return
+			}
+
+			mu.Lock()
+			reports[b.Id] = r
+			mu.Unlock()
+		}(b)
+	}
+	wg.Wait()
+
+	ids := make([]int, 0, len(reports))
+	for id := range reports {
+		n, _ := strconv.Atoi(id)
+		ids = append(ids, n)
+	}
+	sort.Ints(ids)
+
+	var (
+		now    = time.Now()
+		stuckN int
+		lines  = []string{"Broker|Partition|Segments|Size|Oldest|Retention|Status"}
+	)
+	for _, id := range ids {
+		r := reports[strconv.Itoa(id)]
+		for _, p := range r.partitions {
+			if this.topic != "" && p.topic != this.topic {
+				continue
+			}
+
+			retention, present := topicRetentions[p.topic]
+			if !present {
+				retention = r.retention
+			}
+			if retention == 0 {
+				retention = defaultKafkaRetention
+			}
+
+			status := "ok"
+			if retentionStuck(p, retention, this.slack, now) {
+				status = color.Red("stuck")
+				stuckN++
+			} else if this.stuckOnly {
+				continue
+			}
+
+			oldest := "-"
+			if p.segments > 0 {
+				oldest = gofmt.PrettySince(p.oldest)
+			}
+			lines = append(lines, fmt.Sprintf("%d|%s-%s|%d|%s|%s|%s|%s", id, p.topic, p.partition,
+				p.segments, gofmt.ByteSize(p.size), oldest, retention, status))
+		}
+	}
+
+	if len(lines) > 1 {
+		this.Ui.Output(columnize.SimpleFormat(lines))
+	}
+	this.Ui.Output(fmt.Sprintf("%d brokers, %d partitions not deleted by retention", len(ids), stuckN))
+}
+
+func (this *Segment) reportRemote(host, cluster string) (r brokerSegments, err error) {
+	target := host
+	if this.sshUser != "" {
+		target = this.sshUser + "@" + host
+	}
+
+	instanceDir := fmt.Sprintf("%s/kfk_%s", strings.TrimSuffix(this.instanceRoot, "/"), cluster)
+	cmd := exec.Command("ssh", "-o", "BatchMode=yes", "-o", "ConnectTimeout=5", target,
+		"gk", "segment", "-report", instanceDir)
+	out, err := cmd.Output()
+	if err != nil {
+		return
+	}
+
+	r, err = parseSegmentReport(string(out))
+	return
+}
+
+func parseSegmentReport(out string) (r brokerSegments, err error) {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		tuples := strings.Fields(scanner.Text())
+		if len(tuples) == 2 && tuples[0] == "retention.ms" {
+			ms, e := strconv.ParseInt(tuples[1], 10, 64)
+			if e != nil {
+				return r, e
+			}
+
+			r.retention = time.Duration(ms) * time.Millisecond
+			continue
+		}
+		if len(tuples) != 4 {
+			continue
+		}
+
+		topic, partition, ok := topicPartitionOfDir(tuples[0])
+		if !ok {
+			continue
+		}
+
+		p := partitionSegments{topic: topic, partition: partition}
+		if p.segments, err = strconv.Atoi(tuples[1]); err != nil {
+			return
+		}
+		if p.size, err = strconv.ParseInt(tuples[2], 10, 64); err != nil {
+			return
+		}
+		mtime, e := strconv.ParseInt(tuples[3], 10, 64)
+		if e != nil {
+			return r, e
+		}
+		p.oldest = time.Unix(mtime, 0)
+
+		r.partitions = append(r.partitions, p)
+	}
+
+	sort.Sort(partitionSegmentsByName(r.partitions))
+	err = scanner.Err()
+	return
+}
+
+type partitionSegmentsByName []partitionSegments
+
+func (this partitionSegmentsByName) Len() int      { return len(this) }
+func (this partitionSegmentsByName) Swap(i, j int) { this[i], this[j] = this[j], this[i] }
+func (this partitionSegmentsByName) Less(i, j int) bool {
+	if this[i].topic != this[j].topic {
+		return this[i].topic < this[j].topic
+	}
+
+	pi, _ := strconv.Atoi(this[i].partition)
+	pj, _ := strconv.Atoi(this[j].partition)
+	return pi < pj
+}
@@ -0,0 +1,61 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestParseServerProperties(t *testing.T) {
+	retention, logDirs := parseServerProperties([]string{
+		"# log.retention.ms=1",
+		"log.dirs=/data1/kfk, /data2/kfk",
+		"log.retention.hours=72",
+		"log.retention.minutes=60",
+	})
+	assert.Equal(t, time.Hour, retention)
+	assert.Equal(t, []string{"/data1/kfk", "/data2/kfk"}, logDirs)
+
+	retention, logDirs = parseServerProperties([]string{"broker.id=1"})
+	assert.Equal(t, time.Duration(0), retention)
+	assert.Equal(t, 0, len(logDirs))
+}
+
+func TestTopicPartitionOfDir(t *testing.T) {
+	topic, partition, ok := topicPartitionOfDir("app1.orders-v1-12")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "app1.orders-v1", topic)
+	assert.Equal(t, "12", partition)
+
+	for _, name := range []string{"lost+found", "-1", "foo-", "foo-bar"} {
+		_, _, ok = topicPartitionOfDir(name)
+		assert.Equal(t, false, ok)
+	}
+}
+
+func TestTopicRetention(t *testing.T) {
+	assert.Equal(t, time.Hour, topicRetention(`{"version":1,"config":{"retention.ms":"3600000"}}`))
+	assert.Equal(t, time.Duration(0), topicRetention(`{"version":1,"config":{"max.message.bytes":"1000"}}`))
+	assert.Equal(t, time.Duration(0), topicRetention("bad"))
+}
+
+func TestRetentionStuck(t *testing.T) {
+	now := time.Now()
+	p := partitionSegments{segments: 1, oldest: now.Add(-time.Hour * 10)}
+	assert.Equal(t, false, retentionStuck(p, time.Hour, time.Hour, now)) // active segment only
+
+	p.segments = 3
+	assert.Equal(t, true, retentionStuck(p, time.Hour, time.Hour, now))
+	assert.Equal(t, false, retentionStuck(p, time.Hour*9, time.Hour, now))
+}
+
+func TestParseSegmentReport(t *testing.T) {
+	r, err := parseSegmentReport("retention.ms 3600000\nfoo-10 2 2048 1500000000\nfoo-2 1 1024 1500000001\nbad line\n")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, time.Hour, r.retention)
+	assert.Equal(t, 2, len(r.partitions))
+	assert.Equal(t, "2", r.partitions[0].partition)
+	assert.Equal(t, int64(2048), r.partitions[1].size)
+	assert.Equal(t, int64(1500000000), r.partitions[1].oldest.Unix())
+}
@@ -0,0 +1,308 @@
+package command
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+)
+
+// apiCluster is the read-only data of a cluster served by the api.
+type apiCluster struct {
+	name      string
+	zkAddrs   []string
+	chroot    string
+	brokers   []*zk.BrokerZnode            // sorted by id
+	topics    map[string][]int64           // topic: newest offset of each partition, -1 if unknown
+	consumers map[string][]zk.ConsumerMeta // group: committed partitions
+}
+
+func (this *apiCluster) sortedTopics() []string {
+	r := make([]string, 0, len(this.topics))
+	for topic := range this.topics {
+		r = append(r, topic)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (this *apiCluster) sortedGroups() []string {
+	r := make([]string, 0, len(this.consumers))
+	for group := range this.consumers {
+		r = append(r, group)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (this *apiCluster) groupTopics(group string) []string {
+	seen := make(map[string]bool)
+	var r []string
+	for _, m := range this.consumers[group] {
+		if !seen[m.Topic] {
+			seen[m.Topic] = true
+			r = append(r, m.Topic)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// groupOffsets returns the committed offset of each partition of the topic, -1 if uncommitted.
+func (this *apiCluster) groupOffsets(group, topic string) []int64 {
+	r := make([]int64, len(this.topics[topic]))
+	for i := range r {
+		r[i] = -1
+	}
+	for _, m := range this.consumers[group] {
+		if m.Topic != topic {
+			continue
+		}
+
+		if pid, err := strconv.Atoi(m.PartitionId); err == nil && pid < len(r) {
+			r[pid] = m.ConsumerOffset
+		}
+	}
+	return r
+}
+
+type apiSnapshot struct {
+	at       time.Time
+	clusters map[string]*apiCluster
+}
+
+func (this *apiSnapshot) sortedClusters() []string {
+	r := make([]string, 0, len(this.clusters))
+	for name := range this.clusters {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
+
+type Serve struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone     string
+	apiAddr  string
+	refresh  time.Duration
+	warnLag  int64
+	hostname string
+
+	mu       sync.RWMutex
+	snapshot *apiSnapshot
+}
+
+func (this *Serve) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.apiAddr, "api", "", "")
+	cmdFlags.DurationVar(&this.refresh, "refresh", time.Second*30, "")
+	cmdFlags.Int64Var(&this.warnLag, "warnlag", 10000, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-api").
+		invalid(args) {
+		return 2
+	}
+
+	this.hostname, _ = os.Hostname()
+
+	ensureZoneValid(this.zone)
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	defer zkzone.Close()
+
+	this.setSnapshot(this.collect(zkzone))
+	go func() {
+		for range time.Tick(this.refresh) {
+			this.setSnapshot(this.collect(zkzone))
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/kafka", this.burrowHandler)
+	mux.HandleFunc("/v2/kafka/", this.burrowHandler)
+	mux.HandleFunc("/api/status/", this.kafkaManagerHandler)
+
+	this.Ui.Info(fmt.Sprintf("serving zone %s on %s, refreshed every %s", this.zone, this.apiAddr, this.refresh))
+	if err := http.ListenAndServe(this.apiAddr, mux); err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	return
+}
+
+func (this *Serve) setSnapshot(s *apiSnapshot) {
+	this.mu.Lock()
+	this.snapshot = s
+	this.mu.Unlock()
+}
+
+func (this *Serve) currentSnapshot() *apiSnapshot {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.snapshot
+}
+
+func (this *Serve) collect(zkzone *zk.ZkZone) *apiSnapshot {
+	s := &apiSnapshot{at: time.Now(), clusters: make(map[string]*apiCluster)}
+	zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+		c, err := this.collectCluster(zkcluster)
+		if err != nil {
+			this.Ui.Error(fmt.Sprintf("%s: %v", zkcluster.Name(), err))
+		}
+		s.clusters[c.name] = c
+	})
+	return s
+}
+
+// collectCluster returns what is collected even on error.
+func (this *Serve) collectCluster(zkcluster *zk.ZkCluster) (*apiCluster, error) {
+	c := &apiCluster{
+		name:      zkcluster.Name(),
+		zkAddrs:   zkcluster.ZkZone().ZkAddrList(),
+		chroot:    zkcluster.Chroot(),
+		topics:    make(map[string][]int64),
+		consumers: make(map[string][]zk.ConsumerMeta),
+	}
+
+	for _, b := range zkcluster.Brokers() {
+		c.brokers = append(c.brokers, b)
+	}
+	sort.Sort(brokerZnodesById(c.brokers))
+	if len(c.brokers) == 0 {
+		return c, nil
+	}
+
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), sarama.NewConfig())
+	if err != nil {
+		return c, err
+	}
+	defer kfk.Close()
+
+	topics, err := kfk.Topics()
+	if err != nil {
+		return c, err
+	}
+
+	for _, topic := range topics {
+		partitions, err := kfk.Partitions(topic)
+		if err != nil {
+			continue
+		}
+
+		offsets := make([]int64, len(partitions))
+		for _, partitionId := range partitions {
+			if int(partitionId) >= len(offsets) {
+				continue
+			}
+
+			offsets[partitionId] = -1
+			if newest, err := kfk.GetOffset(topic, partitionId, sarama.OffsetNewest); err == nil {
+				offsets[partitionId] = newest
+			}
+		}
+		c.topics[topic] = offsets
+	}
+
+	metas, err := zkcluster.AllConsumerGroups()
+	for _, m := range metas {
+		c.consumers[m.Group] = append(c.consumers[m.Group], m)
+	}
+
+	return c, err
+}
+
+type brokerZnodesById []*zk.BrokerZnode
+
+func (this brokerZnodesById) Len() int      { return len(this) }
+func (this brokerZnodesById) Swap(i, j int) { this[i], this[j] = this[j], this[i] }
+func (this brokerZnodesById) Less(i, j int) bool {
+	a, _ := strconv.Atoi(this[i].Id)
+	b, _ := strconv.Atoi(this[j].Id)
+	return a < b
+}
+
+func writeApiJson(w http.ResponseWriter, status int, v interface{}) {
+	b, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// apiPath splits the url path after prefix into segments.
+func apiPath(path, prefix string) []string {
+	path = strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func (*Serve) Synopsis() string {
+	return "Serve read-only zone data over Burrow and kafka-manager compatible REST API"
+}
+
+func (this *Serve) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s serve -api addr [options]
+
+    %s
+
+    Existing dashboards and alert scripts written against Burrow or kafka-manager work
+    against the zone without modification. Data is collected on startup and then refreshed
+    in background, only consumer groups committing offsets to zookeeper are seen.
+
+    Burrow v2:
+      GET /v2/kafka
+      GET /v2/kafka/:cluster
+      GET /v2/kafka/:cluster/topic
+      GET /v2/kafka/:cluster/topic/:topic
+      GET /v2/kafka/:cluster/consumer
+      GET /v2/kafka/:cluster/consumer/:group/topic
+      GET /v2/kafka/:cluster/consumer/:group/topic/:topic
+      GET /v2/kafka/:cluster/consumer/:group/status
+      GET /v2/kafka/:cluster/consumer/:group/lag
+
+    kafka-manager:
+      GET /api/status/clusters
+      GET /api/status/:cluster/brokers
+      GET /api/status/:cluster/topics
+      GET /api/status/:cluster/:group/:topic/ZK/topicSummary
+      GET /api/status/:cluster/:group/ZK/groupSummary
+
+Options:
+
+    -z zone
+      Default %s
+
+    -api addr
+      e,g. :8077
+
+    -refresh interval
+      Default 30s
+
+    -warnlag n
+      Partition with lag over n is WARN, an offline consumer group lagging behind is ERR.
+      Default 10000
+
+`, this.Cmd, this.Synopsis(), ctx.ZkDefaultZone())
+	return strings.TrimSpace(help)
+}
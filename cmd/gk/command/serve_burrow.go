@@ -0,0 +1,272 @@
+package command
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/funkygao/gafka/zk"
+)
+
+const (
+	burrowOk       = "OK"
+	burrowWarn     = "WARN"
+	burrowErr      = "ERR"
+	burrowStop     = "STOP"
+	burrowNotFound = "NOTFOUND"
+)
+
+type burrowRequest struct {
+	Url     string `json:"url"`
+	Host    string `json:"host"`
+	Cluster string `json:"cluster"`
+	Group   string `json:"group"`
+	Topic   string `json:"topic"`
+}
+
+type burrowClusterDetail struct {
+	Zookeepers    []string `json:"zookeepers"`
+	ZookeeperPort int      `json:"zookeeper_port"`
+	ZookeeperPath string   `json:"zookeeper_path"`
+	Brokers       []string `json:"brokers"`
+	BrokerPort    int      `json:"broker_port"`
+	OffsetsTopic  string   `json:"offsets_topic"`
+}
+
+type burrowOffset struct {
+	Offset    int64 `json:"offset"`
+	Timestamp int64 `json:"timestamp"` // in ms
+	Lag       int64 `json:"lag"`
+}
+
+type burrowPartition struct {
+	Topic     string       `json:"topic"`
+	Partition int32        `json:"partition"`
+	Status    string       `json:"status"`
+	Start     burrowOffset `json:"start"`
+	End       burrowOffset `json:"end"`
+}
+
+type burrowStatus struct {
+	Cluster        string             `json:"cluster"`
+	Group          string             `json:"group"`
+	Status         string             `json:"status"`
+	Complete       bool               `json:"complete"`
+	Partitions     []*burrowPartition `json:"partitions"`
+	PartitionCount int                `json:"partition_count"`
+	Maxlag         *burrowPartition   `json:"maxlag"`
+	TotalLag       int64              `json:"totallag"`
+}
+
+type burrowPartitions []*burrowPartition
+
+func (this burrowPartitions) Len() int           { return len(this) }
+func (this burrowPartitions) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this burrowPartitions) Less(i, j int) bool { return this[i].before(this[j]) }
+
+func (this *burrowPartition) before(that *burrowPartition) bool {
+	if this.Topic != that.Topic {
+		return this.Topic < that.Topic
+	}
+	return this.Partition < that.Partition
+}
+
+// burrowGroupStatus evaluates the committed partitions of a group, there is no sliding window
+// of offsets as Burrow so start and end are the same:
+//   - a partition lagging behind is STOP if the group is offline, WARN if lag is over warnLag
+//   - the group is ERR if any partition STOP, else WARN if any partition WARN
+//
+// Only the partitions not OK are included unless all.
+func burrowGroupStatus(cluster, group string, metas []zk.ConsumerMeta, warnLag int64, all bool) *burrowStatus {
+	r := &burrowStatus{
+		Cluster:        cluster,
+		Group:          group,
+		Status:         burrowOk,
+		Complete:       true,
+		Partitions:     []*burrowPartition{},
+		PartitionCount: len(metas),
+	}
+	if len(metas) == 0 {
+		r.Status = burrowNotFound
+		return r
+	}
+
+	for _, m := range metas {
+		pid, _ := strconv.Atoi(m.PartitionId)
+		offset := burrowOffset{
+			Offset:    m.ConsumerOffset,
+			Timestamp: int64(m.Mtime), // zk mtime in ms
+			Lag:       m.Lag,
+		}
+		if offset.Lag < 0 {
+			offset.Lag = 0
+		}
+		p := &burrowPartition{
+			Topic:     m.Topic,
+			Partition: int32(pid),
+			Status:    burrowOk,
+			Start:     offset,
+			End:       offset,
+		}
+
+		switch {
+		case offset.Lag > 0 && !m.Online:
+			p.Status = burrowStop
+			r.Status = burrowErr
+		case offset.Lag > warnLag:
+			p.Status = burrowWarn
+			if r.Status == burrowOk {
+				r.Status = burrowWarn
+			}
+		}
+
+		r.TotalLag += offset.Lag
+		if r.Maxlag == nil || offset.Lag > r.Maxlag.End.Lag ||
+			(offset.Lag == r.Maxlag.End.Lag && p.before(r.Maxlag)) {
+			r.Maxlag = p
+		}
+
+		if all || p.Status != burrowOk {
+			r.Partitions = append(r.Partitions, p)
+		}
+	}
+
+	sort.Sort(burrowPartitions(r.Partitions))
+	return r
+}
+
+func (this *Serve) burrowHandler(w http.ResponseWriter, r *http.Request) {
+	var (
+		s    = this.currentSnapshot()
+		args = apiPath(r.URL.Path, "/v2/kafka")
+		req  = burrowRequest{Url: r.URL.Path, Host: this.hostname}
+	)
+	if len(args) > 0 {
+		req.Cluster = args[0]
+	}
+	if len(args) > 2 && args[1] == "consumer" {
+		req.Group = args[2]
+	}
+	if len(args) > 2 && args[1] == "topic" {
+		req.Topic = args[2]
+	} else if len(args) > 4 {
+		req.Topic = args[4]
+	}
+
+	reply := func(message string, key string, v interface{}) {
+		writeApiJson(w, http.StatusOK, map[string]interface{}{
+			"error":   false,
+			"message": message,
+			key:       v,
+			"request": req,
+		})
+	}
+	fail := func(status int, message string) {
+		writeApiJson(w, status, map[string]interface{}{
+			"error":   true,
+			"message": message,
+			"request": req,
+		})
+	}
+
+	if r.Method != "GET" {
+		fail(http.StatusMethodNotAllowed, "request method not supported")
+		return
+	}
+
+	if len(args) == 0 {
+		reply("cluster list returned", "clusters", s.sortedClusters())
+		return
+	}
+
+	c, present := s.clusters[req.Cluster]
+	if !present {
+		fail(http.StatusNotFound, "cluster not found")
+		return
+	}
+
+	switch {
+	case len(args) == 1:
+		reply("cluster detail returned", "cluster", burrowDetailOf(c))
+
+	case len(args) == 2 && args[1] == "topic":
+		reply("broker topic list returned", "topics", c.sortedTopics())
+
+	case len(args) == 3 && args[1] == "topic":
+		offsets, present := c.topics[req.Topic]
+		if !present {
+			fail(http.StatusNotFound, "topic not found")
+			return
+		}
+		reply("broker topic offsets returned", "offsets", offsets)
+
+	case len(args) == 2 && args[1] == "consumer":
+		reply("consumer list returned", "consumers", c.sortedGroups())
+
+	case len(args) >= 4 && args[1] == "consumer":
+		if _, present := c.consumers[req.Group]; !present {
+			fail(http.StatusNotFound, "consumer group not found")
+			return
+		}
+
+		switch {
+		case len(args) == 4 && args[3] == "topic":
+			reply("consumer topic list returned", "topics", c.groupTopics(req.Group))
+
+		case len(args) == 5 && args[3] == "topic":
+			if _, present := c.topics[req.Topic]; !present {
+				fail(http.StatusNotFound, "topic not found")
+				return
+			}
+			reply("consumer group topic offsets returned", "offsets", c.groupOffsets(req.Group, req.Topic))
+
+		case len(args) == 4 && args[3] == "status":
+			reply("consumer group status returned", "status",
+				burrowGroupStatus(c.name, req.Group, c.consumers[req.Group], this.warnLag, false))
+
+		case len(args) == 4 && args[3] == "lag":
+			reply("consumer group status returned", "status",
+				burrowGroupStatus(c.name, req.Group, c.consumers[req.Group], this.warnLag, true))
+
+		default:
+			fail(http.StatusNotFound, "unsupported request")
+		}
+
+	default:
+		fail(http.StatusNotFound, "unsupported request")
+	}
+}
+
+func burrowDetailOf(c *apiCluster) *burrowClusterDetail {
+	r := &burrowClusterDetail{
+		ZookeeperPath: c.chroot,
+		Zookeepers:    []string{},
+		Brokers:       []string{},
+		OffsetsTopic:  "__consumer_offsets",
+	}
+	for _, addr := range c.zkAddrs {
+		host, port := splitHostPort(addr)
+		r.Zookeepers = append(r.Zookeepers, host)
+		if r.ZookeeperPort == 0 {
+			r.ZookeeperPort = port
+		}
+	}
+	for _, b := range c.brokers {
+		r.Brokers = append(r.Brokers, b.Host)
+		if r.BrokerPort == 0 {
+			r.BrokerPort = b.Port
+		}
+	}
+	return r
+}
+
+func splitHostPort(addr string) (host string, port int) {
+	i := strings.LastIndex(addr, ":")
+	if i < 0 {
+		return addr, 0
+	}
+
+	port, _ = strconv.Atoi(addr[i+1:])
+	return addr[:i], port
+}
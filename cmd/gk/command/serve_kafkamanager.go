@@ -0,0 +1,148 @@
+package command
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const kafkaManagerZkConsumer = "ZK"
+
+type kafkaManagerCluster struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+type kafkaManagerTopicSummary struct {
+	TotalLag               int64    `json:"totalLag"`
+	PercentageCovered      int      `json:"percentageCovered"` // of partitions owned by a consumer
+	PartitionOffsets       []int64  `json:"partitionOffsets"`
+	PartitionLatestOffsets []int64  `json:"partitionLatestOffsets"`
+	Owners                 []string `json:"owners"`
+}
+
+// topicSummary returns the consumption of a topic by a group, partitions never
+// committed are not covered and not counted in lag.
+func (this *apiCluster) topicSummary(group, topic string) *kafkaManagerTopicSummary {
+	latest := this.topics[topic]
+	r := &kafkaManagerTopicSummary{
+		PartitionOffsets:       this.groupOffsets(group, topic),
+		PartitionLatestOffsets: latest,
+		Owners:                 make([]string, len(latest)),
+	}
+	if r.PartitionLatestOffsets == nil {
+		r.PartitionLatestOffsets = []int64{}
+	}
+
+	owned := 0
+	for _, m := range this.consumers[group] {
+		if m.Topic != topic {
+			continue
+		}
+
+		pid, err := strconv.Atoi(m.PartitionId)
+		if err != nil || pid >= len(latest) {
+			continue
+		}
+
+		if m.Lag > 0 {
+			r.TotalLag += m.Lag
+		}
+		if m.ConsumerZnode != nil {
+			r.Owners[pid] = m.ConsumerZnode.Id
+			owned++
+		}
+	}
+	if len(latest) > 0 {
+		r.PercentageCovered = owned * 100 / len(latest)
+	}
+
+	return r
+}
+
+func (this *Serve) kafkaManagerHandler(w http.ResponseWriter, r *http.Request) {
+	var (
+		s    = this.currentSnapshot()
+		args = apiPath(r.URL.Path, "/api/status")
+	)
+	fail := func(status int, message string) {
+		writeApiJson(w, status, map[string]string{"error": message})
+	}
+
+	if r.Method != "GET" {
+		fail(http.StatusMethodNotAllowed, "request method not supported")
+		return
+	}
+
+	if len(args) == 1 && args[0] == "clusters" {
+		active := []kafkaManagerCluster{}
+		for _, name := range s.sortedClusters() {
+			active = append(active, kafkaManagerCluster{Name: name, Enabled: true})
+		}
+		writeApiJson(w, http.StatusOK, map[string]interface{}{
+			"clusters": map[string]interface{}{
+				"active":  active,
+				"pending": []kafkaManagerCluster{},
+			},
+		})
+		return
+	}
+
+	if len(args) < 2 {
+		fail(http.StatusNotFound, "unsupported request")
+		return
+	}
+
+	c, present := s.clusters[args[0]]
+	if !present {
+		fail(http.StatusNotFound, "Unknown cluster : "+args[0])
+		return
+	}
+
+	switch {
+	case len(args) == 2 && args[1] == "brokers":
+		brokers := make([]int, 0, len(c.brokers))
+		for _, b := range c.brokers {
+			id, _ := strconv.Atoi(b.Id)
+			brokers = append(brokers, id)
+		}
+		writeApiJson(w, http.StatusOK, map[string]interface{}{"brokers": brokers})
+
+	case len(args) == 2 && args[1] == "topics":
+		writeApiJson(w, http.StatusOK, map[string]interface{}{"topics": c.sortedTopics()})
+
+	case len(args) == 5 && args[4] == "topicSummary":
+		group, topic := args[1], args[2]
+		if args[3] != kafkaManagerZkConsumer {
+			fail(http.StatusNotFound, "only ZK consumers are supported")
+			return
+		}
+		if _, present := c.consumers[group]; !present {
+			fail(http.StatusNotFound, "Unknown consumer : "+group)
+			return
+		}
+		if _, present := c.topics[topic]; !present {
+			fail(http.StatusNotFound, "Unknown topic : "+topic)
+			return
+		}
+		writeApiJson(w, http.StatusOK, c.topicSummary(group, topic))
+
+	case len(args) == 4 && args[3] == "groupSummary":
+		group := args[1]
+		if args[2] != kafkaManagerZkConsumer {
+			fail(http.StatusNotFound, "only ZK consumers are supported")
+			return
+		}
+		if _, present := c.consumers[group]; !present {
+			fail(http.StatusNotFound, "Unknown consumer : "+group)
+			return
+		}
+		summary := make(map[string]*kafkaManagerTopicSummary)
+		for _, topic := range c.groupTopics(group) {
+			summary[topic] = c.topicSummary(group, topic)
+		}
+		writeApiJson(w, http.StatusOK, summary)
+
+	default:
+		fail(http.StatusNotFound, "unsupported request")
+	}
+}
@@ -0,0 +1,125 @@
+package command
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/zk"
+)
+
+func newServeForTest() *Serve {
+	owner := &zk.ConsumerZnode{Id: "g1_host-1"}
+	s := &Serve{warnLag: 100, hostname: "gk"}
+	s.setSnapshot(&apiSnapshot{clusters: map[string]*apiCluster{
+		"me": {
+			name:    "me",
+			zkAddrs: []string{"zk1:2181", "zk2:2181"},
+			chroot:  "/kafka/me",
+			brokers: []*zk.BrokerZnode{{Id: "0", Host: "k0", Port: 9092}, {Id: "1", Host: "k1", Port: 9092}},
+			topics:  map[string][]int64{"orders": {100, 200}, "logs": {50}},
+			consumers: map[string][]zk.ConsumerMeta{
+				"g1": {
+					{Group: "g1", Topic: "orders", PartitionId: "0", Online: true, ConsumerOffset: 90, Lag: 10, ConsumerZnode: owner},
+					{Group: "g1", Topic: "orders", PartitionId: "1", Online: true, ConsumerOffset: 50, Lag: 150, ConsumerZnode: owner},
+				},
+				"g2": {
+					{Group: "g2", Topic: "logs", PartitionId: "0", Online: false, ConsumerOffset: 40, Lag: 10},
+				},
+			},
+		},
+	}})
+	return s
+}
+
+func serveGet(h http.HandlerFunc, path string) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", path, nil)
+	h(w, r)
+
+	var v map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &v)
+	return w.Code, v
+}
+
+func TestBurrowGroupStatus(t *testing.T) {
+	s := newServeForTest()
+	c := s.currentSnapshot().clusters["me"]
+
+	st := burrowGroupStatus("me", "g1", c.consumers["g1"], s.warnLag, false)
+	assert.Equal(t, burrowWarn, st.Status)
+	assert.Equal(t, 1, len(st.Partitions))
+	assert.Equal(t, int32(1), st.Partitions[0].Partition)
+	assert.Equal(t, int64(160), st.TotalLag)
+	assert.Equal(t, int64(150), st.Maxlag.End.Lag)
+
+	st = burrowGroupStatus("me", "g1", c.consumers["g1"], s.warnLag, true)
+	assert.Equal(t, 2, len(st.Partitions))
+	assert.Equal(t, int32(0), st.Partitions[0].Partition)
+
+	st = burrowGroupStatus("me", "g2", c.consumers["g2"], s.warnLag, false)
+	assert.Equal(t, burrowErr, st.Status)
+	assert.Equal(t, burrowStop, st.Partitions[0].Status)
+
+	assert.Equal(t, burrowNotFound, burrowGroupStatus("me", "g3", nil, s.warnLag, false).Status)
+}
+
+func TestBurrowHandler(t *testing.T) {
+	s := newServeForTest()
+
+	code, v := serveGet(s.burrowHandler, "/v2/kafka")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, false, v["error"])
+	assert.Equal(t, []interface{}{"me"}, v["clusters"])
+
+	_, v = serveGet(s.burrowHandler, "/v2/kafka/me")
+	cluster := v["cluster"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"zk1", "zk2"}, cluster["zookeepers"])
+	assert.Equal(t, float64(2181), cluster["zookeeper_port"])
+	assert.Equal(t, []interface{}{"k0", "k1"}, cluster["brokers"])
+
+	_, v = serveGet(s.burrowHandler, "/v2/kafka/me/topic")
+	assert.Equal(t, []interface{}{"logs", "orders"}, v["topics"])
+
+	_, v = serveGet(s.burrowHandler, "/v2/kafka/me/topic/orders")
+	assert.Equal(t, []interface{}{float64(100), float64(200)}, v["offsets"])
+
+	_, v = serveGet(s.burrowHandler, "/v2/kafka/me/consumer")
+	assert.Equal(t, []interface{}{"g1", "g2"}, v["consumers"])
+
+	_, v = serveGet(s.burrowHandler, "/v2/kafka/me/consumer/g1/topic/orders")
+	assert.Equal(t, []interface{}{float64(90), float64(50)}, v["offsets"])
+
+	_, v = serveGet(s.burrowHandler, "/v2/kafka/me/consumer/g2/lag")
+	status := v["status"].(map[string]interface{})
+	assert.Equal(t, "ERR", status["status"])
+	assert.Equal(t, "g2", v["request"].(map[string]interface{})["group"])
+
+	code, v = serveGet(s.burrowHandler, "/v2/kafka/you")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, true, v["error"])
+	code, _ = serveGet(s.burrowHandler, "/v2/kafka/me/consumer/g3/status")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestKafkaManagerHandler(t *testing.T) {
+	s := newServeForTest()
+
+	_, v := serveGet(s.kafkaManagerHandler, "/api/status/me/brokers")
+	assert.Equal(t, []interface{}{float64(0), float64(1)}, v["brokers"])
+
+	_, v = serveGet(s.kafkaManagerHandler, "/api/status/me/g1/orders/ZK/topicSummary")
+	assert.Equal(t, float64(160), v["totalLag"])
+	assert.Equal(t, float64(100), v["percentageCovered"])
+	assert.Equal(t, []interface{}{"g1_host-1", "g1_host-1"}, v["owners"])
+
+	_, v = serveGet(s.kafkaManagerHandler, "/api/status/me/g2/ZK/groupSummary")
+	logs := v["logs"].(map[string]interface{})
+	assert.Equal(t, float64(0), logs["percentageCovered"])
+	assert.Equal(t, []interface{}{float64(40)}, logs["partitionOffsets"])
+
+	code, _ := serveGet(s.kafkaManagerHandler, "/api/status/me/g1/KF/groupSummary")
+	assert.Equal(t, http.StatusNotFound, code)
+}
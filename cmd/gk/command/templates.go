@@ -0,0 +1,139 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/naming"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+)
+
+type Templates struct {
+	Ui  cli.Ui
+	Cmd string
+}
+
+func (this *Templates) Run(args []string) (exitCode int) {
+	var (
+		zone    string
+		cluster string
+		topic   string
+	)
+	cmdFlags := flag.NewFlagSet("templates", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&cluster, "c", "", "")
+	cmdFlags.StringVar(&topic, "check", "", "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 2
+	}
+
+	ensureZoneValid(zone)
+
+	policy, err := naming.New(ctx.ZoneTopicNaming(zone))
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	if topic != "" {
+		if err = policy.Validate(topic); err != nil {
+			this.Ui.Error(err.Error())
+			return 1
+		}
+
+		this.Ui.Info(fmt.Sprintf("%s ok", topic))
+		return
+	}
+
+	if cluster != "" {
+		zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
+		defer zkzone.Close()
+
+		return this.audit(zkzone.NewCluster(cluster), policy)
+	}
+
+	if len(policy.Templates()) == 0 {
+		this.Ui.Warn(fmt.Sprintf("zone[%s] has no topic naming templates, any name allowed", zone))
+		return
+	}
+
+	for _, t := range policy.Templates() {
+		this.Ui.Output(t)
+	}
+
+	return
+}
+
+// audit lists the existing topics of the cluster that violate the naming policy.
+func (this *Templates) audit(zkcluster *zk.ZkCluster, policy *naming.Policy) (exitCode int) {
+	topics, err := zkcluster.Topics()
+	swallow(err)
+	sort.Strings(topics)
+
+	violations := 0
+	for _, t := range topics {
+		if strings.HasPrefix(t, "__") {
+			// kafka internal topics
+			continue
+		}
+
+		if policy.Validate(t) != nil {
+			violations++
+			this.Ui.Output(color.Red(t))
+		}
+	}
+
+	this.Ui.Output(fmt.Sprintf("%d/%d topics violate naming policy", violations, len(topics)))
+	if violations > 0 {
+		return 1
+	}
+	return
+}
+
+// validateTopicName checks the topic against the naming policy of the zone.
+func validateTopicName(zone, topic string) error {
+	policy, err := naming.New(ctx.ZoneTopicNaming(zone))
+	if err != nil {
+		return err
+	}
+
+	return policy.Validate(topic)
+}
+
+func (*Templates) Synopsis() string {
+	return "Topic naming templates of a zone and validation against them"
+}
+
+func (this *Templates) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s templates [options]
+
+    %s
+
+    Templates are configured per zone in $HOME/.gafka.cf:
+    topic_naming: ["{appid}.{domain}_{event}.v{n}"]
+
+    {n} matches digits and any other {placeholder} letters and digits.
+    Entry beginning with ^ is a regex.
+    Topics created by 'gk topics' and kateway must match any of them.
+
+Options:
+
+    -z zone
+      Default %s
+
+    -check topic
+      Validate a topic name.
+
+    -c cluster
+      List existing topics of the cluster violating the templates.
+
+`, this.Cmd, this.Synopsis(), ctx.ZkDefaultZone())
+	return strings.TrimSpace(help)
+}
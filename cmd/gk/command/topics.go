@@ -53,6 +53,9 @@ func (this *Topics) Run(args []string) (exitCode int) {
 		debug                   bool
 		summaryMode             bool
 		configged               bool
+		manifest                string
+		prune                   bool
+		dryRun                  bool
 	)
 	cmdFlags := flag.NewFlagSet("brokers", flag.ContinueOnError)
 	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
@@ -75,6 +78,9 @@ func (this *Topics) Run(args []string) (exitCode int) {
 	cmdFlags.Int64Var(&this.count, "count", 0, "")
 	cmdFlags.IntVar(&retentionInMinute, "retention", -1, "")
 	cmdFlags.IntVar(&replicas, "replicas", 2, "")
+	cmdFlags.StringVar(&manifest, "apply", "", "")
+	cmdFlags.BoolVar(&prune, "prune", false, "")
+	cmdFlags.BoolVar(&dryRun, "dryrun", false, "")
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
@@ -84,7 +90,8 @@ func (this *Topics) Run(args []string) (exitCode int) {
 		on("-del", "-c").
 		on("-retention", "-c", "-t").
 		on("-cfreset", "-c", "-t").
-		requireAdminRights("-add", "-del", "-retention").
+		on("-apply", "-c").
+		requireAdminRights("-add", "-del", "-retention", "-apply").
 		invalid(args) {
 		return 2
 	}
@@ -98,6 +105,11 @@ func (this *Topics) Run(args []string) (exitCode int) {
 	}
 
 	if addTopic != "" {
+		if err := validateTopicName(zone, addTopic); err != nil {
+			this.Ui.Error(err.Error())
+			return 1
+		}
+
 		zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
 		zkcluster := zkzone.NewCluster(cluster)
 		swallow(this.addTopic(zkcluster, addTopic, replicas, partitions))
@@ -108,6 +120,12 @@ func (this *Topics) Run(args []string) (exitCode int) {
 		zkcluster := zkzone.NewCluster(cluster)
 		swallow(this.delTopic(zkcluster, delTopic))
 
+		return
+	} else if manifest != "" {
+		zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
+		zkcluster := zkzone.NewCluster(cluster)
+		swallow(this.applyManifest(zkcluster, manifest, prune, dryRun))
+
 		return
 	}
 
@@ -458,6 +476,7 @@ func (this *Topics) displayTopicsOfCluster(zkcluster *zk.ZkCluster) {
 			continue
 		}
 
+		states := zkcluster.PartitionStates(topic)
 		for _, partitionID := range alivePartitions {
 			leader, err := kfk.Leader(topic, partitionID)
 			swallow(err)
@@ -474,7 +493,8 @@ func (this *Topics) displayTopicsOfCluster(zkcluster *zk.ZkCluster) {
 				this.Ui.Error(fmt.Sprintf("%s/%d %v", topic, partitionID, err))
 			}
 
-			isr, isrMtime, partitionCtime := zkcluster.Isr(topic, partitionID)
+			state := states[partitionID]
+			isr, isrMtime, partitionCtime := state.Isr, state.IsrMtime, state.Ctime
 			isrMtimeSince := gofmt.PrettySince(isrMtime)
 			if time.Since(isrMtime).Hours() < 24 {
 				// ever out of sync last 24h
@@ -601,15 +621,33 @@ Options:
 
     -add topic
       Add a topic to a kafka cluster.
+      The topic name must match the naming templates of the zone, see 'gk templates'.
 
     -del topic
-      Delete a kafka topic.
+      Delete a kafka topic immediately.
+      Prefer 'disable-topic' to let consumers drain before deletion.
 
     -kill topic
       Ruin a topic.
 
     -restore topic
 
+    -apply manifest file
+      Converge topics of the cluster to the YAML/JSON manifest: create topics,
+      add partitions and alter configs. e,g.
+      topics:
+        - name: orders
+          partitions: 6
+          replicas: 2
+          configs:
+            retention.ms: "86400000"
+
+    -prune
+      Work with -apply, delete topics and configs absent from the manifest.
+
+    -dryrun
+      Work with -apply, only display the plan.
+
     -partitions n
       Partition count when adding a new topic. Default 1.
 
@@ -0,0 +1,302 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/sla"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/golib/color"
+	"gopkg.in/yaml.v2"
+)
+
+// topicManifest declares the desired topics of a kafka cluster, e,g.
+//
+//	topics:
+//	  - name: orders
+//	    partitions: 6
+//	    replicas: 2
+//	    configs:
+//	      retention.ms: "86400000"
+type topicManifest struct {
+	Topics []topicSpec `json:"topics" yaml:"topics"`
+}
+
+type topicSpec struct {
+	Name       string            `json:"name" yaml:"name"`
+	Partitions int               `json:"partitions" yaml:"partitions"`
+	Replicas   int               `json:"replicas" yaml:"replicas"`
+	Configs    map[string]string `json:"configs" yaml:"configs"`
+}
+
+const (
+	topicChangeCreate     = "create"
+	topicChangePartitions = "partitions"
+	topicChangeConfig     = "config"
+	topicChangeDelete     = "delete"
+	topicChangeDrift      = "drift" // can't be applied automatically
+)
+
+type topicChange struct {
+	action  string
+	topic   string
+	spec    topicSpec // desired
+	configs map[string]string
+	deletes []string // config keys to delete
+	reason  string
+}
+
+func (this topicChange) String() string {
+	switch this.action {
+	case topicChangeCreate:
+		return fmt.Sprintf("+ %s partitions=%d replicas=%d configs=%v",
+			this.topic, this.spec.Partitions, this.spec.Replicas, this.spec.Configs)
+	case topicChangeDelete:
+		return fmt.Sprintf("- %s", this.topic)
+	case topicChangeDrift:
+		return fmt.Sprintf("! %s %s", this.topic, this.reason)
+	case topicChangePartitions:
+		return fmt.Sprintf("~ %s %s", this.topic, this.reason)
+	default:
+		return fmt.Sprintf("~ %s configs=%v deleteConfigs=%v", this.topic, this.configs, this.deletes)
+	}
+}
+
+func loadTopicManifest(fn string) (*topicManifest, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &topicManifest{}
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".json":
+		err = json.Unmarshal(b, m)
+	default:
+		err = yaml.Unmarshal(b, m)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(m.Topics))
+	for i, t := range m.Topics {
+		if t.Name == "" {
+			return nil, fmt.Errorf("topics[%d] without name", i)
+		}
+		if _, present := seen[t.Name]; present {
+			return nil, fmt.Errorf("duplicated topic: %s", t.Name)
+		}
+		seen[t.Name] = struct{}{}
+
+		if t.Partitions == 0 {
+			m.Topics[i].Partitions = 1
+		}
+		if t.Replicas == 0 {
+			m.Topics[i].Replicas = 2
+		}
+	}
+
+	return m, nil
+}
+
+// diffTopics plans the changes to converge actual topics to the desired, topics and
+// config keys absent from desired are deleted only if prune.
+func diffTopics(desired []topicSpec, actual map[string]topicSpec, prune bool) []topicChange {
+	var changes []topicChange
+	wanted := make(map[string]struct{}, len(desired))
+	for _, d := range desired {
+		wanted[d.Name] = struct{}{}
+
+		a, present := actual[d.Name]
+		if !present {
+			changes = append(changes, topicChange{action: topicChangeCreate, topic: d.Name, spec: d})
+			continue
+		}
+
+		if d.Replicas != a.Replicas {
+			changes = append(changes, topicChange{action: topicChangeDrift, topic: d.Name,
+				reason: fmt.Sprintf("replicas %d->%d needs partition reassignment", a.Replicas, d.Replicas)})
+		}
+
+		switch {
+		case d.Partitions > a.Partitions:
+			changes = append(changes, topicChange{action: topicChangePartitions, topic: d.Name, spec: d,
+				reason: fmt.Sprintf("partitions %d->%d", a.Partitions, d.Partitions)})
+		case d.Partitions < a.Partitions:
+			changes = append(changes, topicChange{action: topicChangeDrift, topic: d.Name,
+				reason: fmt.Sprintf("partitions %d->%d can't be reduced", a.Partitions, d.Partitions)})
+		}
+
+		c := topicChange{action: topicChangeConfig, topic: d.Name, configs: make(map[string]string)}
+		for k, v := range d.Configs {
+			if a.Configs[k] != v {
+				c.configs[k] = v
+			}
+		}
+		if prune {
+			for k := range a.Configs {
+				if _, present := d.Configs[k]; !present {
+					c.deletes = append(c.deletes, k)
+				}
+			}
+			sort.Strings(c.deletes)
+		}
+		if len(c.configs) > 0 || len(c.deletes) > 0 {
+			changes = append(changes, c)
+		}
+	}
+
+	if prune {
+		var gone []string
+		for name := range actual {
+			if _, present := wanted[name]; !present {
+				gone = append(gone, name)
+			}
+		}
+		sort.Strings(gone)
+		for _, name := range gone {
+			changes = append(changes, topicChange{action: topicChangeDelete, topic: name})
+		}
+	}
+
+	return changes
+}
+
+// actualTopics collects the current state of all topics in a cluster.
+func (this *Topics) actualTopics(zkcluster *zk.ZkCluster) (map[string]topicSpec, error) {
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), saramaConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer kfk.Close()
+
+	topics, err := kfk.Topics()
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[string]topicSpec, len(topics))
+	for _, t := range topics {
+		if strings.HasPrefix(t, "__") {
+			// kafka internal topics e,g. __consumer_offsets
+			continue
+		}
+
+		partitions, err := kfk.Partitions(t)
+		if err != nil {
+			return nil, err
+		}
+
+		spec := topicSpec{Name: t, Partitions: len(partitions), Configs: make(map[string]string)}
+		if len(partitions) > 0 {
+			replicas, err := kfk.Replicas(t, partitions[0])
+			if err != nil {
+				return nil, err
+			}
+			spec.Replicas = len(replicas)
+		}
+		r[t] = spec
+	}
+
+	for t, cf := range zkcluster.ConfiggedTopics() {
+		spec, present := r[t]
+		if !present {
+			continue
+		}
+
+		var v struct {
+			Config map[string]string `json:"config"`
+		}
+		if err = json.Unmarshal([]byte(cf.Config), &v); err != nil {
+			return nil, fmt.Errorf("%s config: %v", t, err)
+		}
+		spec.Configs = v.Config
+		r[t] = spec
+	}
+
+	return r, nil
+}
+
+// applyManifest converges topics of the cluster to the manifest.
+func (this *Topics) applyManifest(zkcluster *zk.ZkCluster, fn string, prune, dryRun bool) error {
+	manifest, err := loadTopicManifest(fn)
+	if err != nil {
+		return err
+	}
+
+	actual, err := this.actualTopics(zkcluster)
+	if err != nil {
+		return err
+	}
+
+	changes := diffTopics(manifest.Topics, actual, prune)
+	for _, c := range changes {
+		if c.action != topicChangeCreate {
+			continue
+		}
+
+		if err = validateTopicName(zkcluster.ZkZone().Name(), c.topic); err != nil {
+			return err
+		}
+	}
+
+	if len(changes) == 0 {
+		this.Ui.Info(fmt.Sprintf("%s: %d topics up to date", zkcluster.Name(), len(manifest.Topics)))
+		return nil
+	}
+
+	for _, c := range changes {
+		this.Ui.Output(c.String())
+	}
+	if dryRun {
+		return nil
+	}
+
+	for _, c := range changes {
+		var (
+			lines []string
+			err   error
+		)
+		switch c.action {
+		case topicChangeCreate:
+			ts := sla.DefaultSla()
+			ts.Partitions = c.spec.Partitions
+			ts.Replicas = c.spec.Replicas
+			if lines, err = zkcluster.AddTopic(c.topic, ts); err == nil && len(c.spec.Configs) > 0 {
+				var more []string
+				more, err = zkcluster.ConfigTopic(c.topic, c.spec.Configs, nil)
+				lines = append(lines, more...)
+			}
+
+		case topicChangePartitions:
+			ts := sla.DefaultSla()
+			ts.Partitions = c.spec.Partitions
+			lines, err = zkcluster.AlterTopic(c.topic, ts)
+
+		case topicChangeConfig:
+			lines, err = zkcluster.ConfigTopic(c.topic, c.configs, c.deletes)
+
+		case topicChangeDelete:
+			lines, err = zkcluster.DeleteTopic(c.topic)
+
+		case topicChangeDrift:
+			this.Ui.Warn(c.String())
+			continue
+		}
+
+		for _, l := range lines {
+			this.Ui.Output(color.Yellow(l))
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", c, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestDiffTopics(t *testing.T) {
+	actual := map[string]topicSpec{
+		"orders":  {Name: "orders", Partitions: 2, Replicas: 2, Configs: map[string]string{"retention.ms": "3600000", "max.message.bytes": "1000"}},
+		"payment": {Name: "payment", Partitions: 4, Replicas: 2, Configs: map[string]string{}},
+		"legacy":  {Name: "legacy", Partitions: 1, Replicas: 2, Configs: map[string]string{}},
+	}
+	desired := []topicSpec{
+		{Name: "orders", Partitions: 6, Replicas: 2, Configs: map[string]string{"retention.ms": "86400000"}},
+		{Name: "payment", Partitions: 2, Replicas: 3},
+		{Name: "refund", Partitions: 1, Replicas: 2},
+	}
+
+	changes := diffTopics(desired, actual, false)
+	assert.Equal(t, 5, len(changes))
+	assert.Equal(t, topicChangePartitions, changes[0].action)
+	assert.Equal(t, topicChangeConfig, changes[1].action)
+	assert.Equal(t, "86400000", changes[1].configs["retention.ms"])
+	assert.Equal(t, 0, len(changes[1].deletes))
+	assert.Equal(t, topicChangeDrift, changes[2].action) // replicas
+	assert.Equal(t, topicChangeDrift, changes[3].action) // partitions reduced
+	assert.Equal(t, topicChangeCreate, changes[4].action)
+	assert.Equal(t, "refund", changes[4].topic)
+
+	// never deletes without prune
+	changes = diffTopics(desired, actual, true)
+	assert.Equal(t, 6, len(changes))
+	assert.Equal(t, []string{"max.message.bytes"}, changes[1].deletes)
+	assert.Equal(t, topicChangeDelete, changes[5].action)
+	assert.Equal(t, "legacy", changes[5].topic)
+
+	// converged
+	assert.Equal(t, 0, len(diffTopics([]topicSpec{actual["legacy"]}, map[string]topicSpec{"legacy": actual["legacy"]}, true)))
+}
@@ -127,6 +127,7 @@ func (this *UnderReplicated) displayUnderReplicatedPartitionsOfCluster(zkcluster
 				topic, color.Red("dead"), alivePartitions, partions))
 		}
 
+		states := zkcluster.PartitionStates(topic)
 		for _, partitionID := range alivePartitions {
 			replicas, err := kfk.Replicas(topic, partitionID)
 			if err != nil {
@@ -134,7 +135,8 @@ func (this *UnderReplicated) displayUnderReplicatedPartitionsOfCluster(zkcluster
 				continue
 			}
 
-			isr, isrMtime, partitionCtime := zkcluster.Isr(topic, partitionID)
+			state := states[partitionID]
+			isr, isrMtime, partitionCtime := state.Isr, state.IsrMtime, state.Ctime
 
 			underReplicated := false
 			if len(isr) != len(replicas) {
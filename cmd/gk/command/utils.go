@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -20,6 +21,9 @@ import (
 	"github.com/influxdata/influxdb/client/v2"
 )
 
+// adminInvoked is true if gk is invoked with any option that requires admin rights.
+var adminInvoked bool
+
 type argsRule struct {
 	cmd           cli.Command
 	ui            cli.Ui
@@ -112,6 +116,8 @@ func (this *argsRule) invalid(args []string) bool {
 		}
 	}
 	if adminAuthRequired {
+		adminInvoked = true
+
 		if pass := os.Getenv("GK_PASS"); Authenticator("", pass) {
 			return false
 		}
@@ -342,3 +348,28 @@ func queryInfluxDB(addr, db, cmd string) (res []client.Result, err error) {
 
 	return res, nil
 }
+
+// parseBrokerRacks parses rack of brokers in the form of 1:rack1,2:rack1,3:, empty rack
+// means untagging.
+func parseBrokerRacks(s string) (map[int32]string, error) {
+	r := make(map[int32]string)
+	if s == "" {
+		return r, nil
+	}
+
+	for _, tuple := range strings.Split(s, ",") {
+		p := strings.SplitN(tuple, ":", 2)
+		if len(p) != 2 {
+			return nil, fmt.Errorf("invalid broker rack: %s", tuple)
+		}
+
+		id, err := strconv.Atoi(p[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid broker rack: %s", tuple)
+		}
+
+		r[int32(id)] = p[1]
+	}
+
+	return r, nil
+}
@@ -28,3 +28,21 @@ func TestPatternMatched(t *testing.T) {
 func TestShortIp(t *testing.T) {
 	assert.Equal(t, "44.212", shortIp("12.21.44.212"))
 }
+
+func TestParseBrokerRacks(t *testing.T) {
+	r, err := parseBrokerRacks("1:a,2:b")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "a", r[1])
+	assert.Equal(t, "b", r[2])
+
+	r, err = parseBrokerRacks("3:")
+	assert.Equal(t, nil, err)
+	rack, present := r[3]
+	assert.Equal(t, true, present)
+	assert.Equal(t, "", rack)
+
+	_, err = parseBrokerRacks("x:a")
+	assert.NotEqual(t, nil, err)
+	_, err = parseBrokerRacks("1")
+	assert.NotEqual(t, nil, err)
+}
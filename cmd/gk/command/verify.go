@@ -37,6 +37,7 @@ type Verify struct {
 	zkclusters map[string]*zk.ZkCluster // cluster:zkcluster
 	confirmed  bool
 	mode       string
+	format     string
 
 	db *dbx.DB
 
@@ -55,6 +56,7 @@ func (this *Verify) Run(args []string) (exitCode int) {
 	cmdFlags.StringVar(&this.cluster, "c", "bigtopic", "")
 	cmdFlags.BoolVar(&this.confirmed, "go", false, "")
 	cmdFlags.StringVar(&this.mode, "mode", "p", "")
+	cmdFlags.StringVar(&this.format, "format", "", "")
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
@@ -65,6 +67,13 @@ func (this *Verify) Run(args []string) (exitCode int) {
 		return 2
 	}
 
+	if this.format != "" {
+		if _, err := newDiffView(this.format, "", ""); err != nil {
+			this.Ui.Error(err.Error())
+			return 2
+		}
+	}
+
 	cf := mandb.DefaultConfig(this.zone)
 	manager.Default = mandb.New(cf)
 
@@ -160,6 +169,7 @@ func (this *Verify) showTable() {
 func (this *Verify) verifyPub() {
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"Kafka", "Stock", "PubSub", "Stock", "Diff", "?"})
+	var entries []diffEntry
 	for _, t := range this.topics {
 		if t.KafkaTopicName == "" {
 			continue
@@ -182,6 +192,11 @@ func (this *Verify) verifyPub() {
 			diff = color.Red("%d", offsets[1]-offsets[0])
 		}
 
+		if offsets[0] != offsets[1] && (offsets[0] == 0 || math.Abs(float64(offsets[0]-offsets[1])) >= 20) {
+			entries = append(entries, diffEntry{Op: diffChanged, Path: []string{t.KafkaTopicName, t.TopicName},
+				Left: fmt.Sprintf("%d", offsets[0]), Right: fmt.Sprintf("%d", offsets[1])})
+		}
+
 		problem := "N"
 		if _, present := this.problemeticTopics[t.KafkaTopicName]; present {
 			problem = color.Yellow("Y")
@@ -192,6 +207,13 @@ func (this *Verify) verifyPub() {
 			t.TopicName, fmt.Sprintf("%d", offsets[1]), diff, problem})
 	}
 
+	if this.format != "" {
+		// only the topics whose stock differs
+		view, _ := newDiffView(this.format, "Kafka Stock", "PubSub Stock", "Kafka", "PubSub")
+		this.Ui.Output(view.Render(entries))
+		return
+	}
+
 	table.Render()
 }
 
@@ -330,6 +352,9 @@ Options:
 
     -mode <p|s|t>   
 
+    -format side|unified|json
+      With -mode p, only display topics whose stock differs in the format.
+
     -go
       Confirmed to update KafkaTopicName in table topics.
 
@@ -0,0 +1,387 @@
+package command
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/ryanuber/columnize"
+)
+
+// perBrokerConfigs differ among brokers by nature, never diffed.
+var perBrokerConfigs = map[string]bool{
+	"broker.id":            true,
+	"port":                 true,
+	"host.name":            true,
+	"advertised.host.name": true,
+	"advertised.port":      true,
+	"listeners":            true,
+	"advertised.listeners": true,
+	"log.dirs":             true,
+	"log.dir":              true,
+	"num.io.threads":       true, // 3 * #disk
+}
+
+// brokerConfigRule flags a dangerous effective setting of a broker.
+type brokerConfigRule struct {
+	key       string
+	dflt      string // kafka default if absent from server.properties
+	why       string
+	dangerous func(v string) bool
+}
+
+var brokerConfigRules = []brokerConfigRule{
+	{"unclean.leader.election.enable", "true", "out of sync replica elected leader loses messages",
+		func(v string) bool { return v == "true" }},
+	{"replica.lag.time.max.ms", "10000", "isr shrinks and expands on every gc pause",
+		func(v string) bool { n, err := strconv.Atoi(v); return err == nil && n < 6000 }},
+	{"min.insync.replicas", "1", "ack=all Pub survives with a single replica",
+		func(v string) bool { n, err := strconv.Atoi(v); return err == nil && n < 2 }},
+	{"default.replication.factor", "1", "auto created topics have no replica",
+		func(v string) bool { n, err := strconv.Atoi(v); return err == nil && n < 2 }},
+	{"auto.create.topics.enable", "true", "typo of topic name creates topics",
+		func(v string) bool { return v == "true" }},
+}
+
+type brokerConfigDanger struct {
+	Broker string `json:"broker"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Why    string `json:"why"`
+}
+
+type VerifyConfig struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone, cluster string
+	instanceRoot  string
+	sshUser       string
+	golden        string
+	format        string
+}
+
+func (this *VerifyConfig) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("verifyconfig", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.StringVar(&this.instanceRoot, "root", "/var/wd", "")
+	cmdFlags.StringVar(&this.sshUser, "user", "", "")
+	cmdFlags.StringVar(&this.golden, "golden", "", "")
+	cmdFlags.StringVar(&this.format, "format", diffSideBySide, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-c").
+		invalid(args) {
+		return 2
+	}
+
+	goldenView, err := newDiffView(this.format, "golden", "broker", "Broker", "Key")
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 2
+	}
+	peersView, _ := newDiffView(this.format, "peers", "broker", "Broker", "Key")
+
+	golden, err := this.loadGolden()
+	if err != nil {
+		this.Ui.Error(fmt.Sprintf("golden: %v", err))
+		return 1
+	}
+
+	ensureZoneValid(this.zone)
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	defer zkzone.Close()
+
+	configs := this.collect(zkzone.NewCluster(this.cluster))
+	if len(configs) == 0 {
+		this.Ui.Error(fmt.Sprintf("%s: no broker config collected", this.cluster))
+		return 1
+	}
+
+	goldenDiffs := diffBrokerConfigs(golden, configs)
+	peerDiffs := diffBrokerPeers(configs)
+	dangers := dangerousBrokerConfigs(configs)
+
+	if this.format == diffJson {
+		if goldenDiffs == nil {
+			goldenDiffs = []diffEntry{}
+		}
+		if peerDiffs == nil {
+			peerDiffs = []diffEntry{}
+		}
+		if dangers == nil {
+			dangers = []brokerConfigDanger{}
+		}
+		b, _ := json.MarshalIndent(map[string]interface{}{
+			"golden":    goldenDiffs,
+			"peers":     peerDiffs,
+			"dangerous": dangers,
+		}, "", "    ")
+		this.Ui.Output(string(b))
+	} else {
+		this.Ui.Output(color.Cyan("drift from golden: %d", len(goldenDiffs)))
+		if len(goldenDiffs) > 0 {
+			this.Ui.Output(goldenView.Render(goldenDiffs))
+		}
+		this.Ui.Output(color.Cyan("drift from peers: %d", len(peerDiffs)))
+		if len(peerDiffs) > 0 {
+			this.Ui.Output(peersView.Render(peerDiffs))
+		}
+		this.Ui.Output(color.Cyan("dangerous: %d", len(dangers)))
+		if len(dangers) > 0 {
+			lines := []string{"Broker|Key|Value|Why"}
+			for _, d := range dangers {
+				lines = append(lines, fmt.Sprintf("%s|%s|%s|%s", d.Broker, d.Key, color.Red("%s", d.Value), d.Why))
+			}
+			this.Ui.Output(columnize.SimpleFormat(lines))
+		}
+	}
+
+	if len(goldenDiffs) > 0 || len(peerDiffs) > 0 || len(dangers) > 0 {
+		exitCode = 1
+	}
+	return
+}
+
+// loadGolden returns the golden configs, the gk deploy template by default.
+// Templated values such as broker.id={{.BrokerId}} are per broker, never diffed.
+func (this *VerifyConfig) loadGolden() (map[string]string, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if this.golden != "" {
+		b, err = ioutil.ReadFile(this.golden)
+	} else {
+		b, err = Asset("template/config/server.properties")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	golden := parseProperties(strings.Split(string(b), "\n"))
+	for k, v := range golden {
+		if strings.Contains(v, "{{") {
+			delete(golden, k)
+		}
+	}
+	return golden, nil
+}
+
+// collect fetches server.properties of each live broker of the cluster through ssh concurrently.
+func (this *VerifyConfig) collect(zkcluster *zk.ZkCluster) map[string]map[string]string {
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		r  = make(map[string]map[string]string) // broker id: configs
+	)
+	for _, b := range zkcluster.Brokers() {
+		wg.Add(1)
+		go func(b *zk.BrokerZnode) {
+			defer wg.Done()
+
+			config, err := this.fetchRemote(b.Host)
+			if err != nil {
+				this.Ui.Error(fmt.Sprintf("%s %s: %v", b.Id, b.Host, err))
+				return
+			}
+
+			mu.Lock()
+			r[b.Id] = config
+			mu.Unlock()
+		}(b)
+	}
+	wg.Wait()
+
+	return r
+}
+
+func (this *VerifyConfig) fetchRemote(host string) (map[string]string, error) {
+	target := host
+	if this.sshUser != "" {
+		target = this.sshUser + "@" + host
+	}
+
+	serverProperties := fmt.Sprintf("%s/kfk_%s/config/server.properties",
+		strings.TrimSuffix(this.instanceRoot, "/"), this.cluster)
+	cmd := exec.Command("ssh", "-o", "BatchMode=yes", "-o", "ConnectTimeout=5", target,
+		"cat", serverProperties)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseProperties(strings.Split(string(out), "\n")), nil
+}
+
+// parseProperties parses the key=value or key:value lines of a java properties file.
+func parseProperties(lines []string) map[string]string {
+	r := make(map[string]string)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		i := strings.IndexAny(line, "=:")
+		if i < 1 {
+			continue
+		}
+
+		r[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	return r
+}
+
+func sortedBrokerIds(configs map[string]map[string]string) []string {
+	ids := make([]int, 0, len(configs))
+	for id := range configs {
+		n, _ := strconv.Atoi(id)
+		ids = append(ids, n)
+	}
+	sort.Ints(ids)
+
+	r := make([]string, 0, len(ids))
+	for _, id := range ids {
+		r = append(r, strconv.Itoa(id))
+	}
+	return r
+}
+
+func sortedConfigKeys(configs ...map[string]string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, c := range configs {
+		for k := range c {
+			if !seen[k] && !perBrokerConfigs[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// diffBrokerConfigs returns the differences of each broker from the golden configs.
+func diffBrokerConfigs(golden map[string]string, configs map[string]map[string]string) []diffEntry {
+	var r []diffEntry
+	for _, id := range sortedBrokerIds(configs) {
+		for _, k := range sortedConfigKeys(golden, configs[id]) {
+			if golden[k] != configs[id][k] {
+				r = append(r, newDiffEntry(golden[k], configs[id][k], id, k))
+			}
+		}
+	}
+	return r
+}
+
+// diffBrokerPeers returns the configs of each broker that differ from most of the brokers.
+func diffBrokerPeers(configs map[string]map[string]string) []diffEntry {
+	all := make([]map[string]string, 0, len(configs))
+	for _, c := range configs {
+		all = append(all, c)
+	}
+
+	ids := sortedBrokerIds(configs)
+	keys := sortedConfigKeys(all...)
+	majority := make(map[string]string)
+	for _, k := range keys {
+		votes := make(map[string]int)
+		for _, id := range ids {
+			votes[configs[id][k]]++
+		}
+
+		best := -1
+		for v, n := range votes {
+			if n > best || (n == best && v < majority[k]) {
+				majority[k], best = v, n
+			}
+		}
+	}
+
+	var r []diffEntry
+	for _, id := range ids {
+		for _, k := range keys {
+			if v := configs[id][k]; v != majority[k] {
+				r = append(r, newDiffEntry(majority[k], v, id, k))
+			}
+		}
+	}
+	return r
+}
+
+// dangerousBrokerConfigs checks the effective value of each rule, kafka default if absent.
+func dangerousBrokerConfigs(configs map[string]map[string]string) []brokerConfigDanger {
+	var r []brokerConfigDanger
+	for _, id := range sortedBrokerIds(configs) {
+		for _, rule := range brokerConfigRules {
+			v, present := configs[id][rule.key]
+			if !present {
+				v = rule.dflt
+			}
+
+			if rule.dangerous(v) {
+				r = append(r, brokerConfigDanger{Broker: id, Key: rule.key, Value: v, Why: rule.why})
+			}
+		}
+	}
+	return r
+}
+
+func (*VerifyConfig) Synopsis() string {
+	return "Lint server.properties of brokers against golden template and each other"
+}
+
+func (this *VerifyConfig) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s verifyconfig -c cluster [options]
+
+    %s
+
+    Collects config/server.properties of each live broker through ssh, which requires key
+    based login, and reports:
+      - drift from the golden template, the gk deploy template by default
+      - drift from most of the peer brokers, e,g. left behind by a manual hotfix
+      - dangerous effective settings, kafka defaults included
+
+    Per broker settings such as broker.id, port and log.dirs are never diffed.
+    Exits 1 if any drift or dangerous setting is found.
+
+Options:
+
+    -z zone
+      Default %s
+
+    -c cluster
+
+    -root dir
+      Root dir of the broker instances, server.properties is at {root}/kfk_{cluster}/config.
+      Default /var/wd
+
+    -user ssh user
+
+    -golden server.properties
+      Golden template file instead of the gk deploy template.
+
+    -format side|unified|json
+      Default side.
+
+`, this.Cmd, this.Synopsis(), ctx.ZkDefaultZone())
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,72 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestParseProperties(t *testing.T) {
+	p := parseProperties([]string{
+		"# comment",
+		"",
+		"broker.id=1",
+		" log.retention.hours = 168 ",
+		"zookeeper.connect:zk1:2181,zk2:2181",
+		"!bang",
+		"=novalue",
+	})
+	assert.Equal(t, 3, len(p))
+	assert.Equal(t, "1", p["broker.id"])
+	assert.Equal(t, "168", p["log.retention.hours"])
+	assert.Equal(t, "zk1:2181,zk2:2181", p["zookeeper.connect"])
+}
+
+func TestDiffBrokerConfigs(t *testing.T) {
+	golden := map[string]string{"num.network.threads": "8", "log.retention.hours": "168"}
+	configs := map[string]map[string]string{
+		"10": {"broker.id": "10", "num.network.threads": "8", "log.retention.hours": "168"},
+		"2":  {"broker.id": "2", "num.network.threads": "8", "log.retention.hours": "24", "message.max.bytes": "2000000"},
+		"3":  {"broker.id": "3", "num.network.threads": "8", "log.retention.hours": "168"},
+	}
+
+	r := diffBrokerConfigs(golden, configs)
+	assert.Equal(t, 2, len(r))
+	assert.Equal(t, []string{"2", "log.retention.hours"}, r[0].Path)
+	assert.Equal(t, "168", r[0].Left)
+	assert.Equal(t, "24", r[0].Right)
+	assert.Equal(t, []string{"2", "message.max.bytes"}, r[1].Path)
+	assert.Equal(t, "", r[1].Left)
+
+	r = diffBrokerPeers(configs)
+	assert.Equal(t, 2, len(r))
+	assert.Equal(t, "168", r[0].Left)
+	assert.Equal(t, "24", r[0].Right)
+	assert.Equal(t, []string{"2", "message.max.bytes"}, r[1].Path)
+	assert.Equal(t, "2000000", r[1].Right)
+}
+
+func TestDangerousBrokerConfigs(t *testing.T) {
+	configs := map[string]map[string]string{
+		"1": {
+			"unclean.leader.election.enable": "false",
+			"replica.lag.time.max.ms":        "30000",
+			"min.insync.replicas":            "2",
+			"default.replication.factor":     "2",
+			"auto.create.topics.enable":      "false",
+		},
+		"2": {
+			"replica.lag.time.max.ms":    "3000",
+			"min.insync.replicas":        "2",
+			"default.replication.factor": "2",
+			"auto.create.topics.enable":  "false",
+		},
+	}
+
+	r := dangerousBrokerConfigs(configs)
+	assert.Equal(t, 2, len(r))
+	assert.Equal(t, "2", r[0].Broker)
+	assert.Equal(t, "unclean.leader.election.enable", r[0].Key)
+	assert.Equal(t, "true", r[0].Value) // kafka default
+	assert.Equal(t, "replica.lag.time.max.ms", r[1].Key)
+}
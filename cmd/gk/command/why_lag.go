@@ -0,0 +1,532 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/color"
+	"github.com/funkygao/golib/gofmt"
+)
+
+const (
+	whyLagStallAge     = time.Minute * 5 // online owner not committing for this long is stuck
+	whyLagSizeSpike    = 2               // avg message size at the consumer offset vs before
+	whyLagBaselineBack = 10              // size baseline is sampled this many samples before the consumer offset
+	whyLagMaxSampled   = 8               // most lagging partitions sampled for message size
+	whyLagHostOverload = 1.0             // load1 per cpu
+)
+
+type WhyLag struct {
+	Ui  cli.Ui
+	Cmd string
+
+	zone, cluster string
+	group, topic  string
+	lagThreshold  int64
+	since         time.Duration
+	samples       int
+	sshUser       string
+	noSsh         bool
+}
+
+// lagPartition is a partition consumed by the group.
+type lagPartition struct {
+	topic     string
+	partition int32
+	committed int64
+	lag       int64
+	owner     *zk.ConsumerZnode // nil if no online consumer owns it
+	mtime     time.Time         // last commit, zero if unknown
+}
+
+func (this lagPartition) String() string {
+	return fmt.Sprintf("%s/%d", this.topic, this.partition)
+}
+
+// lagSuspect is a likely root cause of the lag with its evidence.
+type lagSuspect struct {
+	cause    string
+	weight   int   // likelihood 0-100 if the cause covers all the lag
+	lag      int64 // lag of the partitions affected by the cause
+	evidence []string
+}
+
+// score is the weight scaled by the share of the total lag the cause covers.
+func (this lagSuspect) score(totalLag int64) int {
+	if totalLag <= 0 {
+		return 0
+	}
+	return int(int64(this.weight) * this.lag / totalLag)
+}
+
+func (this *WhyLag) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("why-lag", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.StringVar(&this.group, "g", "", "")
+	cmdFlags.StringVar(&this.topic, "t", "", "")
+	cmdFlags.Int64Var(&this.lagThreshold, "lag", 5000, "")
+	cmdFlags.DurationVar(&this.since, "since", time.Hour, "")
+	cmdFlags.IntVar(&this.samples, "n", 20, "")
+	cmdFlags.StringVar(&this.sshUser, "user", "", "")
+	cmdFlags.BoolVar(&this.noSsh, "nossh", false, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-c", "-g").
+		invalid(args) {
+		return 2
+	}
+
+	ensureZoneValid(this.zone)
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	defer zkzone.Close()
+	zkcluster := zkzone.NewCluster(this.cluster) // panic if invalid cluster
+
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), saramaConfig())
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+	defer kfk.Close()
+
+	partitions, online := this.groupPartitions(zkcluster, kfk)
+	if len(partitions) == 0 {
+		this.Ui.Warn(fmt.Sprintf("group[%s] consumes no topic matching '%s'", this.group, this.topic))
+		return
+	}
+
+	var (
+		lagging  []lagPartition
+		totalLag int64
+	)
+	for _, p := range partitions {
+		if p.lag > this.lagThreshold {
+			lagging = append(lagging, p)
+			totalLag += p.lag
+		}
+	}
+	if len(lagging) == 0 {
+		this.Ui.Info(fmt.Sprintf("group[%s] has no partition lagging over %d", this.group, this.lagThreshold))
+		return
+	}
+	sort.Sort(lagPartitionsByLag(lagging))
+
+	this.Ui.Output(fmt.Sprintf("group[%s] lags %s over %d/%d partitions, %d online consumers",
+		this.group, gofmt.Comma(totalLag), len(lagging), len(partitions), online))
+
+	var suspects []lagSuspect
+	suspects = append(suspects, consumerSuspects(lagging, online, time.Now())...)
+	suspects = append(suspects, this.partitionSuspects(zkcluster, kfk, lagging)...)
+	suspects = append(suspects, this.messageSizeSuspects(kfk, lagging)...)
+	if !this.noSsh {
+		suspects = append(suspects, this.hostLoadSuspects(lagging)...)
+	}
+
+	suspects = rankLagSuspects(suspects, totalLag)
+	if len(suspects) == 0 {
+		this.Ui.Info("none of the usual suspects found, the consumer may just be slower than the producer")
+		return
+	}
+
+	for i, s := range suspects {
+		score := s.score(totalLag)
+		title := fmt.Sprintf("#%d %s, score %d, covering lag %s", i+1, s.cause, score, gofmt.Comma(s.lag))
+		if score >= 50 {
+			title = color.Red(title)
+		} else {
+			title = color.Yellow(title)
+		}
+		this.Ui.Output(title)
+		for _, e := range s.evidence {
+			this.Ui.Output("    " + e)
+		}
+	}
+
+	return
+}
+
+// groupPartitions returns the partitions the group committed offsets on, including those
+// not owned by any online consumer, and the number of online consumers.
+func (this *WhyLag) groupPartitions(zkcluster *zk.ZkCluster, kfk sarama.Client) ([]lagPartition, int) {
+	consumers := zkcluster.ConsumerGroups()[this.group]
+
+	// last commit time of owned partitions
+	mtimes := make(map[string]time.Time)
+	for _, m := range zkcluster.ConsumersByGroup(this.group)[this.group] {
+		mtimes[m.Topic+"/"+m.PartitionId] = m.Mtime.Time()
+	}
+
+	var r []lagPartition
+	for topic, offsets := range zkcluster.ConsumerOffsetsOfGroup(this.group) {
+		if !patternMatched(topic, this.topic) {
+			continue
+		}
+
+		owners := zkcluster.OwnersOfGroupByTopic(this.group, topic)
+		for partitionId, committed := range offsets {
+			pid, err := strconv.Atoi(partitionId)
+			if err != nil {
+				continue
+			}
+
+			newest, err := kfk.GetOffset(topic, int32(pid), sarama.OffsetNewest)
+			if err != nil {
+				this.Ui.Warn(fmt.Sprintf("%s/%d: %v", topic, pid, err))
+				continue
+			}
+
+			p := lagPartition{
+				topic:     topic,
+				partition: int32(pid),
+				committed: committed,
+				lag:       newest - committed,
+				mtime:     mtimes[topic+"/"+partitionId],
+			}
+			if consumerId, present := owners[partitionId]; present {
+				p.owner = consumers[consumerId]
+			}
+			r = append(r, p)
+		}
+	}
+
+	return r, len(consumers)
+}
+
+// consumerSuspects finds lagging partitions without online owner or whose owner stopped committing.
+func consumerSuspects(lagging []lagPartition, online int, now time.Time) []lagSuspect {
+	offline := lagSuspect{cause: "consumer offline", weight: 100}
+	stuck := lagSuspect{cause: "consumer stuck", weight: 90}
+	if online == 0 {
+		offline.evidence = append(offline.evidence, "group has no online consumer")
+	}
+
+	for _, p := range lagging {
+		switch {
+		case p.owner == nil:
+			offline.lag += p.lag
+			if online > 0 {
+				offline.evidence = append(offline.evidence, fmt.Sprintf("%s lag %s not owned by any online consumer",
+					p, gofmt.Comma(p.lag)))
+			}
+
+		case !p.mtime.IsZero() && now.Sub(p.mtime) > whyLagStallAge:
+			stuck.lag += p.lag
+			stuck.evidence = append(stuck.evidence, fmt.Sprintf("%s lag %s owned by %s, last commit %s",
+				p, gofmt.Comma(p.lag), consumerHost(p.owner), gofmt.PrettySince(p.mtime)))
+		}
+	}
+
+	return []lagSuspect{offline, stuck}
+}
+
+// partitionSuspects finds lagging partitions offline, with leader recently moved or under-replicated.
+func (this *WhyLag) partitionSuspects(zkcluster *zk.ZkCluster, kfk sarama.Client, lagging []lagPartition) []lagSuspect {
+	leaderGone := lagSuspect{cause: "partition offline", weight: 100}
+	moved := lagSuspect{cause: "partition leader recently moved", weight: 60}
+	under := lagSuspect{cause: "leader broker under-replicated", weight: 50}
+
+	states := make(map[string]map[int32]zk.PartitionState)
+	for _, p := range lagging {
+		if _, present := states[p.topic]; !present {
+			states[p.topic] = zkcluster.PartitionStates(p.topic)
+		}
+
+		state, present := states[p.topic][p.partition]
+		if !present {
+			continue
+		}
+
+		if state.Leader == -1 {
+			leaderGone.lag += p.lag
+			leaderGone.evidence = append(leaderGone.evidence, fmt.Sprintf("%s has no leader since %s",
+				p, gofmt.PrettySince(state.IsrMtime)))
+			continue
+		}
+
+		if time.Since(state.IsrMtime) < this.since {
+			// leader and isr share the state znode, so mtime tells either changed
+			moved.lag += p.lag
+			moved.evidence = append(moved.evidence, fmt.Sprintf("%s leader %d isr %s changed %s",
+				p, state.Leader, intsString(state.Isr), gofmt.PrettySince(state.IsrMtime)))
+		}
+
+		replicas, err := kfk.Replicas(p.topic, p.partition)
+		if err == nil && len(state.Isr) < len(replicas) {
+			under.lag += p.lag
+			under.evidence = append(under.evidence, fmt.Sprintf("%s leader %d replicas %+v isr %s",
+				p, state.Leader, replicas, intsString(state.Isr)))
+		}
+	}
+
+	return []lagSuspect{leaderGone, moved, under}
+}
+
+// messageSizeSuspects compares the avg message size at the consumer offset with that of
+// messages before it, for the most lagging partitions.
+func (this *WhyLag) messageSizeSuspects(kfk sarama.Client, lagging []lagPartition) []lagSuspect {
+	spike := lagSuspect{cause: "message size spike", weight: 70}
+	for i, p := range lagging {
+		if i >= whyLagMaxSampled {
+			break
+		}
+
+		oldest, err := kfk.GetOffset(p.topic, p.partition, sarama.OffsetOldest)
+		if err != nil {
+			continue
+		}
+		baselineOffset := p.committed - int64(this.samples*whyLagBaselineBack)
+		if baselineOffset < oldest {
+			baselineOffset = oldest
+		}
+		if p.committed-baselineOffset < int64(this.samples) {
+			// not enough history before the consumer offset
+			continue
+		}
+
+		baseline, err := avgMessageSize(kfk, p.topic, p.partition, baselineOffset, this.samples)
+		if err != nil || baseline == 0 {
+			continue
+		}
+		current, err := avgMessageSize(kfk, p.topic, p.partition, p.committed, this.samples)
+		if err != nil {
+			continue
+		}
+
+		if current >= baseline*whyLagSizeSpike {
+			spike.lag += p.lag
+			spike.evidence = append(spike.evidence, fmt.Sprintf("%s avg message %s at offset %d, %s before",
+				p, gofmt.ByteSize(current), p.committed, gofmt.ByteSize(baseline)))
+		}
+	}
+
+	return []lagSuspect{spike}
+}
+
+// avgMessageSize fetches n messages from the offset and returns their avg key+value bytes.
+func avgMessageSize(kfk sarama.Client, topic string, partitionId int32, offset int64, n int) (int64, error) {
+	leader, err := kfk.Leader(topic, partitionId)
+	if err != nil {
+		return 0, err
+	}
+
+	req := &sarama.FetchRequest{MaxWaitTime: 1000, MinBytes: 1}
+	req.AddBlock(topic, partitionId, offset, peekFetchSize)
+	resp, err := leader.Fetch(req)
+	if err != nil {
+		return 0, err
+	}
+
+	block := resp.GetBlock(topic, partitionId)
+	if block == nil {
+		return 0, fmt.Errorf("%s/%d empty fetch response", topic, partitionId)
+	}
+	if block.Err != sarama.ErrNoError {
+		return 0, block.Err
+	}
+
+	var total, count int64
+	for _, mb := range flattenMessageSet(block.MsgSet.Messages) {
+		if mb.Offset < offset {
+			continue
+		}
+
+		total += int64(len(mb.Msg.Key) + len(mb.Msg.Value))
+		count++
+		if count >= int64(n) {
+			break
+		}
+	}
+	if count == 0 {
+		// a single message larger than the fetch size is a spike in itself
+		return peekFetchSize, nil
+	}
+
+	return total / count, nil
+}
+
+// hostLoadSuspects checks the load of the hosts running the owners of lagging partitions through ssh.
+func (this *WhyLag) hostLoadSuspects(lagging []lagPartition) []lagSuspect {
+	lagOfHost := make(map[string]int64)
+	for _, p := range lagging {
+		if p.owner != nil {
+			lagOfHost[consumerHost(p.owner)] += p.lag
+		}
+	}
+
+	var (
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		overloaded = lagSuspect{cause: "consumer host overloaded", weight: 60}
+	)
+	for host, lag := range lagOfHost {
+		wg.Add(1)
+		go func(host string, lag int64) {
+			defer wg.Done()
+
+			load1, cpus, err := this.remoteLoad(host)
+			if err != nil {
+				this.Ui.Warn(fmt.Sprintf("ssh %s: %v", host, err))
+				return
+			}
+
+			if load1/float64(cpus) >= whyLagHostOverload {
+				mu.Lock()
+				overloaded.lag += lag
+				overloaded.evidence = append(overloaded.evidence, fmt.Sprintf("%s load %.2f on %d cpus",
+					host, load1, cpus))
+				mu.Unlock()
+			}
+		}(host, lag)
+	}
+	wg.Wait()
+
+	sort.Strings(overloaded.evidence)
+	return []lagSuspect{overloaded}
+}
+
+func (this *WhyLag) remoteLoad(host string) (load1 float64, cpus int, err error) {
+	target := host
+	if this.sshUser != "" {
+		target = this.sshUser + "@" + host
+	}
+
+	cmd := exec.Command("ssh", "-o", "BatchMode=yes", "-o", "ConnectTimeout=5", target,
+		"cat /proc/loadavg; nproc")
+	out, err := cmd.Output()
+	if err != nil {
+		return
+	}
+
+	return parseLoadavg(string(out))
+}
+
+// parseLoadavg parses the output of 'cat /proc/loadavg; nproc'.
+func parseLoadavg(out string) (load1 float64, cpus int, err error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		return 0, 0, fmt.Errorf("unexpected output: %s", out)
+	}
+
+	fields := strings.Fields(lines[0])
+	if len(fields) == 0 {
+		return 0, 0, fmt.Errorf("unexpected loadavg: %s", lines[0])
+	}
+	if load1, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return
+	}
+	if cpus, err = strconv.Atoi(strings.TrimSpace(lines[1])); err != nil {
+		return
+	}
+	if cpus <= 0 {
+		return 0, 0, fmt.Errorf("invalid cpus: %d", cpus)
+	}
+
+	return
+}
+
+// consumerHost returns the host running the consumer: kateway for Sub by kateway.
+func consumerHost(c *zk.ConsumerZnode) string {
+	host := c.Host()
+	if i := strings.Index(host, "@"); i > 0 {
+		host = host[:i]
+	}
+	return host
+}
+
+// rankLagSuspects drops suspects without evidence and sorts the rest by score descending.
+func rankLagSuspects(suspects []lagSuspect, totalLag int64) []lagSuspect {
+	r := make([]lagSuspect, 0, len(suspects))
+	for _, s := range suspects {
+		if len(s.evidence) > 0 {
+			r = append(r, s)
+		}
+	}
+
+	sort.Stable(lagSuspectsByScore{suspects: r, totalLag: totalLag})
+	return r
+}
+
+func intsString(a []int) string {
+	s := make([]string, 0, len(a))
+	for _, i := range a {
+		s = append(s, strconv.Itoa(i))
+	}
+	return "[" + strings.Join(s, ",") + "]"
+}
+
+type lagSuspectsByScore struct {
+	suspects []lagSuspect
+	totalLag int64
+}
+
+func (this lagSuspectsByScore) Len() int { return len(this.suspects) }
+func (this lagSuspectsByScore) Swap(i, j int) {
+	this.suspects[i], this.suspects[j] = this.suspects[j], this.suspects[i]
+}
+func (this lagSuspectsByScore) Less(i, j int) bool {
+	return this.suspects[i].score(this.totalLag) > this.suspects[j].score(this.totalLag)
+}
+
+type lagPartitionsByLag []lagPartition
+
+func (this lagPartitionsByLag) Len() int           { return len(this) }
+func (this lagPartitionsByLag) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this lagPartitionsByLag) Less(i, j int) bool { return this[i].lag > this[j].lag }
+
+func (*WhyLag) Synopsis() string {
+	return "Rank the likely root causes of a lagging consumer group with evidence"
+}
+
+func (this *WhyLag) Help() string {
+	help := fmt.Sprintf(`
+Usage: %s why-lag [options]
+
+    %s
+
+    Checks the usual suspects of the lagging partitions: consumer offline or stuck,
+    partition offline, leader recently moved, leader under-replicated, message size
+    spike and consumer host load, and prints them ranked by the share of lag covered.
+
+Options:
+
+    -z zone
+
+    -c cluster
+
+    -g group
+
+    -t topic pattern
+
+    -lag threshold
+      Partitions lagging over this are checked. Default 5000.
+
+    -since duration
+      Leader/isr changed within this is recent. Default 1h.
+
+    -n messages
+      Number of messages sampled for size at and before the consumer offset. Default 20.
+
+    -user ssh user
+      Consumer host load is checked through ssh, which requires key based login.
+
+    -nossh
+      Skip checking consumer host load.
+
+`, this.Cmd, this.Synopsis())
+	return strings.TrimSpace(help)
+}
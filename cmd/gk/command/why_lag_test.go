@@ -0,0 +1,47 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/zk"
+)
+
+func TestParseLoadavg(t *testing.T) {
+	load1, cpus, err := parseLoadavg("12.50 8.01 4.00 3/512 12345\n8\n")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 12.5, load1)
+	assert.Equal(t, 8, cpus)
+
+	_, _, err = parseLoadavg("12.50 8.01 4.00 3/512 12345\n")
+	assert.NotEqual(t, nil, err)
+	_, _, err = parseLoadavg("12.50 8.01 4.00 3/512 12345\n0\n")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestConsumerSuspectsRanked(t *testing.T) {
+	now := time.Now()
+	owner := &zk.ConsumerZnode{Id: "10.1.1.2@10.9.9.9:5ad8e1b7-0c1a-4b2e-9a9b-7b0d1d2f3a4b"}
+	lagging := []lagPartition{
+		{topic: "orders", partition: 0, lag: 6000},
+		{topic: "orders", partition: 1, lag: 3000, owner: owner, mtime: now.Add(-time.Hour)},
+		{topic: "orders", partition: 2, lag: 1000, owner: owner, mtime: now},
+	}
+
+	suspects := consumerSuspects(lagging, 1, now)
+	suspects = append(suspects, lagSuspect{cause: "message size spike", weight: 70})
+	suspects = rankLagSuspects(suspects, 10000)
+	assert.Equal(t, 2, len(suspects))
+	assert.Equal(t, "consumer offline", suspects[0].cause)
+	assert.Equal(t, 60, suspects[0].score(10000))
+	assert.Equal(t, "consumer stuck", suspects[1].cause)
+	assert.Equal(t, 27, suspects[1].score(10000))
+	assert.Equal(t, "10.1.1.2", consumerHost(owner))
+
+	// the whole group offline
+	suspects = rankLagSuspects(consumerSuspects(lagging[:1], 0, now), 6000)
+	assert.Equal(t, 1, len(suspects))
+	assert.Equal(t, 100, suspects[0].score(6000))
+	assert.Equal(t, []string{"group has no online consumer"}, suspects[0].evidence)
+}
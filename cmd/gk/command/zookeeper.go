@@ -10,6 +10,8 @@ import (
 	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/gocli"
 	"github.com/funkygao/golib/color"
+	"github.com/funkygao/golib/gofmt"
+	"github.com/ryanuber/columnize"
 )
 
 type Zookeeper struct {
@@ -21,9 +23,16 @@ type Zookeeper struct {
 	zkHost     string
 	watchMode  bool
 	leaderOnly bool
+	statsMode  bool
 }
 
 func (this *Zookeeper) Run(args []string) (exitCode int) {
+	if len(args) > 0 {
+		if _, present := znodeOps[args[0]]; present {
+			return this.runZnode(args[0], args[1:])
+		}
+	}
+
 	var (
 		zone string
 	)
@@ -34,11 +43,12 @@ func (this *Zookeeper) Run(args []string) (exitCode int) {
 	cmdFlags.StringVar(&this.zkHost, "host", "", "")
 	cmdFlags.BoolVar(&this.watchMode, "watch", false, "")
 	cmdFlags.BoolVar(&this.leaderOnly, "leader", false, "")
+	cmdFlags.BoolVar(&this.statsMode, "stats", false, "")
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
-	if !this.leaderOnly && validateArgs(this, this.Ui).require("-c").invalid(args) {
+	if !this.leaderOnly && !this.statsMode && validateArgs(this, this.Ui).require("-c").invalid(args) {
 		return 2
 	}
 
@@ -65,7 +75,7 @@ func (this *Zookeeper) Run(args []string) (exitCode int) {
 		}
 	}
 
-	if !foundCmd && !this.leaderOnly {
+	if !foundCmd && !this.leaderOnly && !this.statsMode {
 		this.Ui.Error(fmt.Sprintf("invalid command: %s", this.flw))
 		this.Ui.Info(this.Help())
 		return 2
@@ -78,9 +88,14 @@ func (this *Zookeeper) Run(args []string) (exitCode int) {
 	zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
 	defer printSwallowedErrors(this.Ui, zkzone)
 
-	if this.leaderOnly {
+	switch {
+	case this.leaderOnly:
 		this.printLeader(zkzone)
-	} else {
+
+	case this.statsMode:
+		this.printEnsembleStats(zkzone)
+
+	default:
 		this.printZkStats(zkzone)
 	}
 
@@ -91,17 +106,13 @@ func (this *Zookeeper) printLeader(zkzone *zk.ZkZone) {
 	// FIXME all zones will only show the 1st zone info because it blocks others
 	for {
 		this.Ui.Output(color.Blue(zkzone.Name()))
-		for zkhost, lines := range zkzone.RunZkFourLetterCommand("mntr") {
-			if this.zkHost != "" && !strings.HasPrefix(zkhost, this.zkHost+":") {
+		for _, stats := range zkzone.EnsembleStats() {
+			if this.zkHost != "" && !strings.HasPrefix(stats.Server, this.zkHost+":") {
 				continue
 			}
 
-			parts := strings.Split(lines, "\n")
-			for _, l := range parts {
-				if strings.HasPrefix(l, "zk_server_state") && strings.HasSuffix(l, "leader") {
-					this.Ui.Output(color.Green("%28s", zkhost))
-					break
-				}
+			if stats.Leader() {
+				this.Ui.Output(color.Green("%28s", stats.Server))
 			}
 		}
 
@@ -114,6 +125,39 @@ func (this *Zookeeper) printLeader(zkzone *zk.ZkZone) {
 
 }
 
+func (this *Zookeeper) printEnsembleStats(zkzone *zk.ZkZone) {
+	for {
+		this.Ui.Output(color.Blue(zkzone.Name()))
+		lines := []string{"Server|Mode|Version|Conns|Outstanding|Latency|Znodes|Watches|Data"}
+		for _, stats := range zkzone.EnsembleStats() {
+			if this.zkHost != "" && !strings.HasPrefix(stats.Server, this.zkHost+":") {
+				continue
+			}
+
+			if stats.Err != nil {
+				lines = append(lines, fmt.Sprintf("%s|%s|-|-|-|-|-|-|-", stats.Server, color.Red(stats.Err.Error())))
+				continue
+			}
+
+			mode := stats.Srvr.Mode
+			if stats.Leader() {
+				mode = color.Green(mode)
+			}
+			lines = append(lines, fmt.Sprintf("%s|%s|%s|%d|%s|%s|%s|%d|%s",
+				stats.Server, mode, stats.Srvr.Version, len(stats.Conns), stats.Srvr.Outstanding,
+				stats.Srvr.Latency, stats.Srvr.Znodes, stats.MntrInt("zk_watch_count"),
+				gofmt.ByteSize(stats.MntrInt("zk_approximate_data_size"))))
+		}
+		this.Ui.Output(columnize.SimpleFormat(lines))
+
+		if this.watchMode {
+			time.Sleep(time.Second * 5)
+		} else {
+			break
+		}
+	}
+}
+
 func (this *Zookeeper) printZkStats(zkzone *zk.ZkZone) {
 	for {
 		this.Ui.Output(color.Blue(zkzone.Name()))
@@ -135,7 +179,7 @@ func (this *Zookeeper) printZkStats(zkzone *zk.ZkZone) {
 }
 
 func (*Zookeeper) Synopsis() string {
-	return "Monitor zone Zookeeper status by four letter word command"
+	return "Monitor zone Zookeeper status and browse/edit znodes"
 }
 
 func (this *Zookeeper) Help() string {
@@ -144,6 +188,9 @@ Usage: %s zookeeper [options]
 
     %s
 
+    %s zk ls|get|set|rm|stat path [options]
+      Browse and edit znodes of the zone.
+
 Options:
 
     -z zone
@@ -157,8 +204,35 @@ Options:
     -leader
       Display zk leader only.
 
+    -stats
+      Display summary of each zk server collected by srvr/mntr/cons.
+
     -c zk four letter word command
       conf cons dump envi reqs ruok srvr stat wchs wchc wchp mntr
-`, this.Cmd, this.Synopsis())
+
+Znode options:
+
+    -l
+      ls with size, children, mtime and ephemeral owner of each child.
+
+    -raw
+      get value as is without pretty print of json.
+
+    set path <value> | -f file
+      -f - to read value from stdin.
+      Refuses to replace json value with non-json unless -force.
+
+    -create
+      set creates the znode along with its parents if not exists.
+
+    -R
+      rm the znode recursively.
+
+    -version n
+      set/rm only if the znode is still at version n.
+
+    -force
+      Allow set/rm of controller, brokers, cluster root and live ephemeral znodes.
+`, this.Cmd, this.Synopsis(), this.Cmd)
 	return strings.TrimSpace(help)
 }
@@ -0,0 +1,334 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/golib/color"
+	"github.com/funkygao/golib/gofmt"
+	"github.com/ryanuber/columnize"
+	zklib "github.com/samuel/go-zookeeper/zk"
+)
+
+// znode subcommands of gk zk
+var znodeOps = map[string]struct{}{
+	"ls":   {},
+	"get":  {},
+	"set":  {},
+	"rm":   {},
+	"stat": {},
+}
+
+// runZnode browses and edits znodes of the zone, so that raw zkCli through tunnels is unnecessary.
+func (this *Zookeeper) runZnode(op string, args []string) (exitCode int) {
+	var (
+		zone      string
+		long      bool
+		raw       bool
+		force     bool
+		create    bool
+		recursive bool
+		file      string
+		version   int
+	)
+	cmdFlags := flag.NewFlagSet("zk "+op, flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&zone, "z", ctx.DefaultZone(), "")
+	cmdFlags.BoolVar(&long, "l", false, "")
+	cmdFlags.BoolVar(&raw, "raw", false, "")
+	cmdFlags.BoolVar(&force, "force", false, "")
+	cmdFlags.BoolVar(&create, "create", false, "")
+	cmdFlags.BoolVar(&recursive, "R", false, "")
+	cmdFlags.StringVar(&file, "f", "", "")
+	cmdFlags.IntVar(&version, "version", -1, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	// options are allowed after the path: gk zk get /foo -z prod
+	rest := cmdFlags.Args()
+	if len(rest) == 0 {
+		this.Ui.Error("path required")
+		this.Ui.Output(this.Help())
+		return 2
+	}
+	znode := rest[0]
+	if err := cmdFlags.Parse(rest[1:]); err != nil {
+		return 1
+	}
+	rest = append(rest[:1], cmdFlags.Args()...)
+
+	if !strings.HasPrefix(znode, "/") || (znode != "/" && strings.HasSuffix(znode, "/")) {
+		this.Ui.Error(fmt.Sprintf("invalid path: %s", znode))
+		return 2
+	}
+
+	// mutating ops require admin rights
+	if validateArgs(this, this.Ui).
+		requireAdminRights("set", "rm").
+		invalid([]string{op}) {
+		return 2
+	}
+
+	ensureZoneValid(zone)
+	zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
+	defer zkzone.Close()
+
+	var err error
+	switch op {
+	case "ls":
+		err = this.znodeLs(zkzone, znode, long)
+
+	case "get":
+		err = this.znodeGet(zkzone, znode, raw)
+
+	case "stat":
+		err = this.znodeStat(zkzone, znode)
+
+	case "set":
+		var data []byte
+		switch {
+		case file == "-":
+			data, err = ioutil.ReadAll(os.Stdin)
+		case file != "":
+			data, err = ioutil.ReadFile(file)
+		case len(rest) == 2:
+			data = []byte(rest[1])
+		default:
+			err = fmt.Errorf("value required: either <value> or -f file")
+		}
+		if err == nil {
+			err = this.znodeSet(zkzone, znode, data, int32(version), create, force)
+		}
+
+	case "rm":
+		err = this.znodeRm(zkzone, znode, int32(version), recursive, force)
+	}
+
+	if err != nil {
+		this.Ui.Error(fmt.Sprintf("%s: %v", znode, err))
+		return 1
+	}
+
+	return
+}
+
+func (this *Zookeeper) znodeLs(zkzone *zk.ZkZone, znode string, long bool) error {
+	children, _, err := zkzone.Conn().Children(znode)
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(children)
+	if !long {
+		for _, c := range children {
+			this.Ui.Output(c)
+		}
+		return nil
+	}
+
+	lines := []string{"Name|Size|Children|Mtime|Ephemeral Owner"}
+	for _, c := range children {
+		_, stat, err := zkzone.Conn().Exists(path.Join(znode, c))
+		if err != nil || stat == nil {
+			// deleted in between
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("%s|%s|%d|%s|%s", c, gofmt.ByteSize(int64(stat.DataLength)),
+			stat.NumChildren, zkTime(stat.Mtime), ephemeralOwner(stat)))
+	}
+	this.Ui.Output(columnize.SimpleFormat(lines))
+	return nil
+}
+
+func (this *Zookeeper) znodeGet(zkzone *zk.ZkZone, znode string, raw bool) error {
+	data, stat, err := zkzone.Conn().Get(znode)
+	if err != nil {
+		return err
+	}
+
+	if !raw {
+		data = prettyZnodeData(data)
+	}
+	this.Ui.Output(string(data))
+	if owner := ephemeralOwner(stat); owner != "" {
+		this.Ui.Output(color.Yellow("ephemeral, owner session %s", owner))
+	}
+	return nil
+}
+
+func (this *Zookeeper) znodeStat(zkzone *zk.ZkZone, znode string) error {
+	_, stat, err := zkzone.Conn().Exists(znode)
+	if err != nil {
+		return err
+	}
+	if stat == nil {
+		return zklib.ErrNoNode
+	}
+
+	owner := ephemeralOwner(stat)
+	if owner == "" {
+		owner = "-"
+	}
+	lines := []string{
+		fmt.Sprintf("czxid|0x%x", stat.Czxid),
+		fmt.Sprintf("ctime|%s", zkTime(stat.Ctime)),
+		fmt.Sprintf("mzxid|0x%x", stat.Mzxid),
+		fmt.Sprintf("mtime|%s", zkTime(stat.Mtime)),
+		fmt.Sprintf("pzxid|0x%x", stat.Pzxid),
+		fmt.Sprintf("version|%d", stat.Version),
+		fmt.Sprintf("cversion|%d", stat.Cversion),
+		fmt.Sprintf("aversion|%d", stat.Aversion),
+		fmt.Sprintf("ephemeralOwner|%s", owner),
+		fmt.Sprintf("dataLength|%d", stat.DataLength),
+		fmt.Sprintf("numChildren|%d", stat.NumChildren),
+	}
+	this.Ui.Output(columnize.SimpleFormat(lines))
+	return nil
+}
+
+func (this *Zookeeper) znodeSet(zkzone *zk.ZkZone, znode string, data []byte,
+	version int32, create, force bool) error {
+	old, stat, err := zkzone.Conn().Get(znode)
+	switch {
+	case err == zklib.ErrNoNode && create:
+		if err = zkzone.CreateZnode(znode, data); err == nil {
+			this.Ui.Info(fmt.Sprintf("%s created", znode))
+		}
+		return err
+
+	case err != nil:
+		return err
+	}
+
+	if reason := protectedZnode(znode, zkzone.Clusters()); reason != "" && !force {
+		return fmt.Errorf("%s, -force to override", reason)
+	}
+	if isJson(old) && !isJson(data) && !force {
+		// a typo in kafka metadata brings the cluster down
+		return fmt.Errorf("current value is json but the new value is not, -force to override")
+	}
+
+	if version == -1 {
+		// guard against concurrent change between Get and Set
+		version = stat.Version
+	}
+	if err = zkzone.SetZnode(znode, data, version); err != nil {
+		return err
+	}
+
+	this.Ui.Output(fmt.Sprintf("%s %s", color.Red("-"), string(old)))
+	this.Ui.Output(fmt.Sprintf("%s %s", color.Green("+"), string(data)))
+	this.Ui.Info(fmt.Sprintf("%s version %d -> %d", znode, version, version+1))
+	return nil
+}
+
+func (this *Zookeeper) znodeRm(zkzone *zk.ZkZone, znode string, version int32, recursive, force bool) error {
+	_, stat, err := zkzone.Conn().Exists(znode)
+	if err != nil {
+		return err
+	}
+	if stat == nil {
+		return zklib.ErrNoNode
+	}
+
+	if reason := protectedZnode(znode, zkzone.Clusters()); reason != "" && !force {
+		return fmt.Errorf("%s, -force to override", reason)
+	}
+	if owner := ephemeralOwner(stat); owner != "" && !force {
+		return fmt.Errorf("ephemeral znode owned by live session %s, -force to override", owner)
+	}
+
+	if stat.NumChildren > 0 {
+		if !recursive {
+			return fmt.Errorf("%d children, -R to remove recursively", stat.NumChildren)
+		}
+
+		yes, _ := this.Ui.Ask(fmt.Sprintf("confirm to remove %s with %d children recursively? [y/N]",
+			znode, stat.NumChildren))
+		if strings.ToLower(yes) != "y" {
+			return fmt.Errorf("aborted")
+		}
+
+		err = zkzone.DeleteRecursive(znode)
+	} else {
+		err = zkzone.DeleteZnode(znode, version)
+	}
+	if err != nil {
+		return err
+	}
+
+	this.Ui.Info(fmt.Sprintf("%s removed", znode))
+	return nil
+}
+
+// protectedZnode returns why the znode is too critical to change without -force, empty if not.
+// clusters is the registered kafka clusters of the zone: {name: chroot path}.
+func protectedZnode(znode string, clusters map[string]string) string {
+	if znode == "/" || znode == "/zookeeper" || strings.HasPrefix(znode, "/zookeeper/") {
+		return "zookeeper internal znode"
+	}
+	if znode == zk.KatewayIdsRoot || strings.HasPrefix(znode, zk.KatewayIdsRoot+"/") {
+		return "kateway registry"
+	}
+
+	for name, root := range clusters {
+		if root == "" {
+			continue
+		}
+
+		if root == znode || strings.HasPrefix(root, znode+"/") {
+			return fmt.Sprintf("root of kafka cluster %s", name)
+		}
+		if !strings.HasPrefix(znode, root+"/") {
+			continue
+		}
+
+		switch rel := strings.TrimPrefix(znode, root); {
+		case rel == zk.ControllerPath, rel == zk.ControllerEpochPath:
+			return fmt.Sprintf("controller of kafka cluster %s", name)
+		case rel == path.Dir(zk.BrokerIdsPath), rel == zk.BrokerIdsPath, rel == zk.BrokerTopicsPath,
+			strings.HasPrefix(rel, zk.BrokerIdsPath+"/"):
+			return fmt.Sprintf("brokers of kafka cluster %s", name)
+		}
+	}
+
+	return ""
+}
+
+// prettyZnodeData indents json value, others are returned as is.
+func prettyZnodeData(data []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "    "); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
+
+func isJson(data []byte) bool {
+	var v interface{}
+	return len(data) > 0 && json.Unmarshal(data, &v) == nil
+}
+
+func ephemeralOwner(stat *zklib.Stat) string {
+	if stat == nil || stat.EphemeralOwner == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("0x%x", stat.EphemeralOwner)
+}
+
+func zkTime(ms int64) string {
+	return time.Unix(0, ms*int64(time.Millisecond)).Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,38 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestProtectedZnode(t *testing.T) {
+	clusters := map[string]string{"trade": "/kafka/trade", "bad": ""}
+	fixtures := map[string]bool{
+		"/":                               true,
+		"/zookeeper/quota":                true,
+		"/_kateway/ids/prod/1":            true,
+		"/kafka":                          true,
+		"/kafka/trade":                    true,
+		"/kafka/trade/controller":         true,
+		"/kafka/trade/controller_epoch":   true,
+		"/kafka/trade/brokers":            true,
+		"/kafka/trade/brokers/ids/0":      true,
+		"/kafka/trade/brokers/topics":     true,
+		"/kafka/trade/brokers/topics/foo": false,
+		"/kafka/trade/consumers/g1":       false,
+		"/kafka/tradex/controller":        false,
+		"/foo":                            false,
+	}
+	for znode, protected := range fixtures {
+		assert.Equal(t, protected, protectedZnode(znode, clusters) != "")
+	}
+}
+
+func TestPrettyZnodeData(t *testing.T) {
+	assert.Equal(t, "{\n    \"a\": 1\n}", string(prettyZnodeData([]byte(`{"a":1}`))))
+	assert.Equal(t, "host:9092", string(prettyZnodeData([]byte("host:9092"))))
+	assert.Equal(t, true, isJson([]byte(`[1]`)))
+	assert.Equal(t, false, isJson([]byte("")))
+	assert.Equal(t, false, isJson([]byte("{")))
+}
@@ -7,10 +7,13 @@ import (
 	"github.com/funkygao/gocli"
 )
 
-var commands map[string]cli.CommandFactory
+var (
+	commands map[string]cli.CommandFactory
+	ui       cli.Ui
+)
 
 func init() {
-	ui := &cli.ColoredUi{
+	ui = &cli.ColoredUi{
 		Ui: &cli.BasicUi{
 			Writer:      os.Stdout,
 			Reader:      os.Stdin,
@@ -38,6 +41,13 @@ func init() {
 			}, nil
 		},
 
+		"grep": func() (cli.Command, error) {
+			return &command.Grep{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"haproxy": func() (cli.Command, error) {
 			return &command.Haproxy{
 				Ui:  ui,
@@ -101,6 +111,13 @@ func init() {
 			}, nil
 		},
 
+		"history": func() (cli.Command, error) {
+			return &command.History{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"histogram": func() (cli.Command, error) {
 			return &command.Histogram{
 				Ui:  ui,
@@ -157,6 +174,13 @@ func init() {
 			}, nil
 		},
 
+		"serve": func() (cli.Command, error) {
+			return &command.Serve{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"rebalance": func() (cli.Command, error) {
 			return &command.Rebalance{
 				Ui:  ui,
@@ -164,6 +188,48 @@ func init() {
 			}, nil
 		},
 
+		"reassign": func() (cli.Command, error) {
+			return &command.Reassign{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
+		"redistribute": func() (cli.Command, error) {
+			return &command.Redistribute{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
+		"rename-group": func() (cli.Command, error) {
+			return &command.RenameGroup{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
+		"why-lag": func() (cli.Command, error) {
+			return &command.WhyLag{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
+		"compare-zones": func() (cli.Command, error) {
+			return &command.CompareZones{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
+		"rewind": func() (cli.Command, error) {
+			return &command.Rewind{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"ext4": func() (cli.Command, error) {
 			return &command.Ext4fs{
 				Ui:  ui,
@@ -185,6 +251,20 @@ func init() {
 			}, nil
 		},
 
+		"disable-topic": func() (cli.Command, error) {
+			return &command.DisableTopic{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
+		"net": func() (cli.Command, error) {
+			return &command.Net{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"produce": func() (cli.Command, error) {
 			return &command.Produce{
 				Ui:  ui,
@@ -192,6 +272,13 @@ func init() {
 			}, nil
 		},
 
+		"quota": func() (cli.Command, error) {
+			return &command.Quota{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"upgrade": func() (cli.Command, error) {
 			return &command.Upgrade{
 				Ui:  ui,
@@ -213,6 +300,13 @@ func init() {
 			}, nil
 		},
 
+		"verifyconfig": func() (cli.Command, error) {
+			return &command.VerifyConfig{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"whois": func() (cli.Command, error) {
 			return &command.Whois{
 				Ui:  ui,
@@ -220,6 +314,20 @@ func init() {
 			}, nil
 		},
 
+		"owner": func() (cli.Command, error) {
+			return &command.Owner{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
+		"ownership": func() (cli.Command, error) {
+			return &command.Ownership{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"sample": func() (cli.Command, error) {
 			return &command.Sample{
 				Ui:  ui,
@@ -248,6 +356,20 @@ func init() {
 			}, nil
 		},
 
+		"completion": func() (cli.Command, error) {
+			return &command.Completion{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
+		"ls": func() (cli.Command, error) {
+			return &command.Ls{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"lszk": func() (cli.Command, error) {
 			return &command.LsZk{
 				Ui:  ui,
@@ -297,6 +419,13 @@ func init() {
 			}, nil
 		},
 
+		"diff": func() (cli.Command, error) {
+			return &command.Diff{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"deploy": func() (cli.Command, error) {
 			return &command.Deploy{
 				Ui:  ui,
@@ -325,6 +454,13 @@ func init() {
 			}, nil
 		},
 
+		"loadtest": func() (cli.Command, error) {
+			return &command.Loadtest{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"consumers": func() (cli.Command, error) {
 			return &command.Consumers{
 				Ui:  ui,
@@ -339,6 +475,13 @@ func init() {
 			}, nil
 		},
 
+		"console-config": func() (cli.Command, error) {
+			return &command.ConsoleConfig{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"console": func() (cli.Command, error) {
 			return &command.Console{
 				Ui:   ui,
@@ -364,6 +507,13 @@ func init() {
 			}, nil
 		},
 
+		"replicas": func() (cli.Command, error) {
+			return &command.Replicas{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"producers": func() (cli.Command, error) {
 			return &command.Producers{
 				Ui:  ui,
@@ -406,6 +556,13 @@ func init() {
 			}, nil
 		},
 
+		"capacity": func() (cli.Command, error) {
+			return &command.Capacity{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"topics": func() (cli.Command, error) {
 			return &command.Topics{
 				Ui:  ui,
@@ -441,6 +598,20 @@ func init() {
 			}, nil
 		},
 
+		"events": func() (cli.Command, error) {
+			return &command.Events{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
+		"exec": func() (cli.Command, error) {
+			return &command.Exec{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"peek": func() (cli.Command, error) {
 			return &command.Peek{
 				Ui:  ui,
@@ -448,6 +619,13 @@ func init() {
 			}, nil
 		},
 
+		"templates": func() (cli.Command, error) {
+			return &command.Templates{
+				Ui:  ui,
+				Cmd: cmd,
+			}, nil
+		},
+
 		"top": func() (cli.Command, error) {
 			return &command.Top{
 				Ui:  ui,
@@ -462,5 +640,11 @@ func init() {
 			}, nil
 		},
 	}
+}
 
+// loadPlugins registers the plugin commands, ctx must be loaded before this.
+func loadPlugins() {
+	for name, factory := range command.Plugins(ui, os.Args[0], commands) {
+		commands[name] = factory
+	}
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+)
+
+// clusters of a zone rarely change while completing consecutive commands
+const clusterCacheTTL = time.Minute * 5
+
+// cachedClusters returns sorted cluster names of a zone, cached in a tmp file
+// to avoid connecting zookeeper on each <TAB>.
+func cachedClusters(zone string) []string {
+	cacheFile := filepath.Join(os.TempDir(), fmt.Sprintf("gk.%s.%d.clusters", zone, os.Getuid()))
+	if stat, err := os.Stat(cacheFile); err == nil && time.Since(stat.ModTime()) < clusterCacheTTL {
+		if b, err := ioutil.ReadFile(cacheFile); err == nil {
+			return strings.Fields(string(b))
+		}
+	}
+
+	zkAddrs, present := ctx.Zones()[zone]
+	if !present {
+		// partially typed zone
+		return nil
+	}
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(zone, zkAddrs))
+	defer zkzone.Close()
+
+	var clusters []string
+	zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+		clusters = append(clusters, zkcluster.Name())
+	})
+
+	if len(clusters) > 0 {
+		ioutil.WriteFile(cacheFile, []byte(strings.Join(clusters, "\n")), 0600)
+	}
+
+	return clusters
+}
@@ -7,8 +7,10 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/funkygao/gafka"
+	"github.com/funkygao/gafka/cmd/gk/command"
 	"github.com/funkygao/gafka/ctx"
 	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/gocli"
@@ -18,6 +20,7 @@ import (
 func main() {
 	ctx.LoadFromHome()
 	setupLogging()
+	loadPlugins()
 
 	app := os.Args[0]
 	args := os.Args[1:]
@@ -48,10 +51,9 @@ func main() {
 							zone = args[i+1]
 						}
 					}
-					zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
-					zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
-						fmt.Println(zkcluster.Name())
-					})
+					for _, cluster := range cachedClusters(zone) {
+						fmt.Println(cluster)
+					}
 					return
 
 				case "-t": // topic
@@ -110,7 +112,22 @@ func main() {
 		return buf.String()
 	}
 
+	if spec := ctx.ZkAudit(); spec != "" {
+		// required by change management: refuse to run without audit
+		if err := zk.EnableAudit(spec, strings.Join(os.Args, " "), ctx.CurrentUser()); err != nil {
+			fmt.Fprintf(os.Stderr, "zk audit: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	startedAt := time.Now()
 	exitCode, err := c.Run()
+	zk.DisableAudit()
+	if command.Mutating() {
+		if e := command.RecordHistory(c.Args, startedAt, exitCode, err); e != nil {
+			fmt.Fprintf(os.Stderr, "history: %v\n", e)
+		}
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%+v\n", err)
 		os.Exit(1)
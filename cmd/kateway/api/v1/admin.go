@@ -1,7 +1,6 @@
 package api
 
 import (
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -26,6 +25,7 @@ func (this *Client) AddTopic(cluster, appid, topic, ver string) (err error) {
 	}
 
 	req.Header.Set(gateway.HttpHeaderAppid, this.cf.AppId)
+	req.Header.Set(gateway.HttpHeaderClientVersion, ClientVersion)
 	req.Header.Set(gateway.HttpHeaderPubkey, this.cf.Secret)
 
 	var response *http.Response
@@ -47,7 +47,7 @@ func (this *Client) AddTopic(cluster, appid, topic, ver string) (err error) {
 	}
 
 	if response.StatusCode != http.StatusOK {
-		return errors.New(string(b))
+		return newError(response.StatusCode, b)
 	}
 
 	return nil
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error is the error response of kateway.
+type Error struct {
+	Status    int    `json:"-"`
+	Code      string `json:"errcode"` // stable machine readable code, e,g. quota_exceeded
+	Msg       string `json:"errmsg"`
+	Retryable bool   `json:"retryable"`
+	RequestId string `json:"request_id"`
+}
+
+func newError(status int, body []byte) error {
+	e := &Error{Status: status}
+	if err := json.Unmarshal(body, e); err != nil || e.Code == "" {
+		// not from kateway, e,g. the load balancer in between
+		e.Msg = strings.TrimSpace(string(body))
+		e.Retryable = status >= http.StatusInternalServerError
+	}
+
+	return e
+}
+
+func (this *Error) Error() string {
+	s := fmt.Sprintf("%d %s: %s", this.Status, this.Code, this.Msg)
+	if this.Code == "" {
+		s = fmt.Sprintf("%d: %s", this.Status, this.Msg)
+	}
+	if this.RequestId != "" {
+		s += ", request id: " + this.RequestId
+	}
+	return s
+}
+
+// Temporary tells whether the same request might succeed if retried with backoff.
+func (this *Error) Temporary() bool {
+	return this.Retryable
+}
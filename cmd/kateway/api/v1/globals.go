@@ -14,4 +14,7 @@ const (
 	ShadowDead  = "dead"
 
 	UserAgent = "pubsub-go v0.1"
+
+	// ClientVersion is sent in header X-Client-Version for kateway to track and negotiate
+	ClientVersion = "pubsub-go/0.1.0"
 )
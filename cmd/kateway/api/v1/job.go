@@ -1,12 +1,12 @@
 package api
 
 import (
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 
 	"github.com/funkygao/gafka/cmd/kateway/gateway"
 	"github.com/funkygao/gafka/mpool"
@@ -26,6 +26,9 @@ func (this *Client) AddJob(payload []byte, delay string, opt PubOption) (jobId s
 	u.Path = fmt.Sprintf("/v1/jobs/%s/%s", opt.Topic, opt.Ver)
 	q := u.Query()
 	q.Set("delay", delay)
+	if opt.Priority > 0 {
+		q.Set("priority", strconv.Itoa(opt.Priority))
+	}
 	u.RawQuery = q.Encode()
 
 	req, err = http.NewRequest("POST", u.String(), buf)
@@ -34,6 +37,7 @@ func (this *Client) AddJob(payload []byte, delay string, opt PubOption) (jobId s
 	}
 
 	req.Header.Set("AppId", this.cf.AppId)
+	req.Header.Set(gateway.HttpHeaderClientVersion, ClientVersion)
 	req.Header.Set("Pubkey", this.cf.Secret)
 
 	var response *http.Response
@@ -53,7 +57,7 @@ func (this *Client) AddJob(payload []byte, delay string, opt PubOption) (jobId s
 	response.Body.Close()
 
 	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusAccepted {
-		return "", errors.New(string(b))
+		return "", newError(response.StatusCode, b)
 	}
 
 	jobId = response.Header.Get(gateway.HttpHeaderJobId)
@@ -82,6 +86,7 @@ func (this *Client) DeleteJob(jobId string, opt PubOption) (err error) {
 	}
 
 	req.Header.Set("AppId", this.cf.AppId)
+	req.Header.Set(gateway.HttpHeaderClientVersion, ClientVersion)
 	req.Header.Set("Pubkey", this.cf.Secret)
 
 	var response *http.Response
@@ -100,7 +105,7 @@ func (this *Client) DeleteJob(jobId string, opt PubOption) (err error) {
 	response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return errors.New(string(b))
+		return newError(response.StatusCode, b)
 	}
 
 	return nil
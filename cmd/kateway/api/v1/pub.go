@@ -1,7 +1,6 @@
 package api
 
 import (
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -17,6 +16,7 @@ type PubOption struct {
 	Async      bool
 	AckAll     bool
 	Tag        string
+	Priority   int // only for AddJob, 0-9
 }
 
 // Pub publish a keyed message to specified versioned topic.
@@ -48,6 +48,7 @@ func (this *Client) Pub(key string, msg []byte, opt PubOption) (err error) {
 	}
 
 	req.Header.Set(gateway.HttpHeaderAppid, this.cf.AppId)
+	req.Header.Set(gateway.HttpHeaderClientVersion, ClientVersion)
 	req.Header.Set(gateway.HttpHeaderPubkey, this.cf.Secret)
 	if opt.Tag != "" {
 		req.Header.Set(gateway.HttpHeaderMsgTag, opt.Tag)
@@ -72,7 +73,7 @@ func (this *Client) Pub(key string, msg []byte, opt PubOption) (err error) {
 	}
 
 	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusAccepted {
-		return errors.New(string(b))
+		return newError(response.StatusCode, b)
 	}
 
 	if this.cf.Debug {
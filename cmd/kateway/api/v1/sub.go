@@ -56,6 +56,7 @@ func (this *Client) Sub(opt SubOption, h SubHandler) error {
 	}
 
 	req.Header.Set(gateway.HttpHeaderAppid, this.cf.AppId)
+	req.Header.Set(gateway.HttpHeaderClientVersion, ClientVersion)
 	req.Header.Set(gateway.HttpHeaderSubkey, this.cf.Secret)
 	if opt.Tag != "" {
 		req.Header.Set(gateway.HttpHeaderMsgTag, opt.Tag)
@@ -132,6 +133,7 @@ func (this *Client) SubX(opt SubOption, h SubXHandler) error {
 		Set(gateway.HttpHeaderAppid, this.cf.AppId).
 		Set(gateway.HttpHeaderSubkey, this.cf.Secret).
 		Set("User-Agent", UserAgent).
+		Set(gateway.HttpHeaderClientVersion, ClientVersion).
 		Set(gateway.HttpHeaderPartition, "-1").
 		Set(gateway.HttpHeaderOffset, "-1")
 	if opt.Tag != "" {
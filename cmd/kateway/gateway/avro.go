@@ -0,0 +1,106 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/funkygao/go-metrics"
+	"github.com/linkedin/goavro"
+)
+
+// avroJsonDecoder decodes avro messages to json for Sub clients that cannot speak avro,
+// e,g. dashboards and scripts.
+type avroJsonDecoder struct {
+	mu     sync.RWMutex
+	codecs map[string]*goavro.Codec   // schema:codec
+	oks    map[string]metrics.Counter // appid.topic.ver:decoded
+	errs   map[string]metrics.Counter // appid.topic.ver:errors
+
+	latency metrics.Histogram // in us
+}
+
+func newAvroJsonDecoder() *avroJsonDecoder {
+	return &avroJsonDecoder{
+		codecs: make(map[string]*goavro.Codec),
+		oks:    make(map[string]metrics.Counter),
+		errs:   make(map[string]metrics.Counter),
+		latency: metrics.NewRegisteredHistogram("sub.avro2json.latency",
+			metrics.DefaultRegistry, metrics.NewExpDecaySample(1028, 0.015)),
+	}
+}
+
+// acceptJson checks if the Sub client wants json instead of the raw message.
+func acceptJson(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// decode converts a single avro binary encoded message to its json representation.
+func (this *avroJsonDecoder) decode(key, schema string, msg []byte) ([]byte, error) {
+	codec, err := this.codec(schema)
+	if err == nil {
+		t0 := time.Now()
+		msg, err = avroToJson(codec, msg)
+		if !Options.DisableMetrics {
+			this.latency.Update(time.Since(t0).Nanoseconds() / 1e3)
+		}
+	}
+
+	ok, errs := this.counters(key)
+	if err != nil {
+		errs.Inc(1)
+		return nil, err
+	}
+
+	ok.Inc(1)
+	return msg, nil
+}
+
+func avroToJson(codec *goavro.Codec, msg []byte) ([]byte, error) {
+	native, _, err := codec.NativeFromBinary(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return codec.TextualFromNative(nil, native)
+}
+
+func (this *avroJsonDecoder) codec(schema string) (*goavro.Codec, error) {
+	this.mu.RLock()
+	codec, present := this.codecs[schema]
+	this.mu.RUnlock()
+	if present {
+		return codec, nil
+	}
+
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	this.mu.Lock()
+	this.codecs[schema] = codec
+	this.mu.Unlock()
+	return codec, nil
+}
+
+func (this *avroJsonDecoder) counters(key string) (ok, errs metrics.Counter) {
+	this.mu.RLock()
+	ok, present := this.oks[key]
+	errs = this.errs[key]
+	this.mu.RUnlock()
+	if present {
+		return
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if ok, present = this.oks[key]; !present {
+		ok = metrics.NewRegisteredCounter("sub.avro2json."+key+".ok", metrics.DefaultRegistry)
+		this.oks[key] = ok
+		this.errs[key] = metrics.NewRegisteredCounter("sub.avro2json."+key+".err", metrics.DefaultRegistry)
+	}
+	errs = this.errs[key]
+	return
+}
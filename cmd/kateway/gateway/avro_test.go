@@ -0,0 +1,35 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestAvroJsonDecoder(t *testing.T) {
+	schema := `{"type":"record","name":"order","fields":[{"name":"id","type":"long"},{"name":"sku","type":"string"}]}`
+	d := newAvroJsonDecoder()
+
+	// id=1 zigzag encoded as 2, sku="x" with length 1 zigzag encoded as 2
+	b, err := d.decode("app1.order.v1", schema, []byte{2, 2, 'x'})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `{"id":1,"sku":"x"}`, string(b))
+	assert.Equal(t, 1, len(d.codecs))
+	assert.Equal(t, int64(1), d.oks["app1.order.v1"].Count())
+
+	_, err = d.decode("app1.order.v1", schema, []byte{2})
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, int64(1), d.errs["app1.order.v1"].Count())
+
+	_, err = d.decode("app1.bad.v1", "{", []byte{2})
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, int64(1), d.errs["app1.bad.v1"].Count())
+}
+
+func TestAcceptJson(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/v1/msgs/app1/foo/v1", nil)
+	assert.Equal(t, false, acceptJson(r))
+	r.Header.Set("Accept", "application/json, text/plain")
+	assert.Equal(t, true, acceptJson(r))
+}
@@ -141,7 +141,9 @@ func BenchmarkDirectKafkaProduce1K(b *testing.B) {
 	cf.Refresh = time.Hour
 	meta.Default = zkmeta.New(cf, zkzone)
 	meta.Default.Start()
-	store.DefaultPubStore = kafka.NewPubStore(100, 0, false, false, true)
+	store.DefaultPubStore = kafka.NewPubStore(kafka.PoolConfigs{
+		Default: kafka.PoolConfig{Producers: 100, Clients: 2, MetaRefresh: time.Minute},
+	}, 0, false, false, true)
 	store.DefaultPubStore.Start()
 
 	data := []byte(strings.Repeat("X", msgSize))
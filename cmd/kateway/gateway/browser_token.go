@@ -0,0 +1,146 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/httprouter"
+	log "github.com/funkygao/log4go"
+)
+
+// BrowserTokenSecret is the ctx secret name of the HMAC key signing browser tokens,
+// which must be the same across the kateway instances of a zone.
+const BrowserTokenSecret = "kateway.browser.key"
+
+const maxBrowserTokenTopics = 10
+
+// browserClaims is what a browser token grants: Sub of the scoped topics as the group of the appid.
+type browserClaims struct {
+	Appid  string   `json:"appid"`
+	Group  string   `json:"group"`
+	Topics []string `json:"topics"` // appid/topic/ver of the subscribed topics
+	jwt.StandardClaims
+}
+
+func browserTopic(hisAppid, topic, ver string) string {
+	return hisAppid + "/" + topic + "/" + ver
+}
+
+// permits checks if the claims permit myAppid Sub the topic as the group.
+func (this *browserClaims) permits(myAppid, hisAppid, topic, ver, group string) bool {
+	if myAppid != this.Appid || group != this.Group {
+		return false
+	}
+
+	t := browserTopic(hisAppid, topic, ver)
+	for _, scoped := range this.Topics {
+		if scoped == t {
+			return true
+		}
+	}
+	return false
+}
+
+// browserTokens issues and verifies the short lived signed tokens with which web frontends
+// Sub directly from the browser without holding the subkey.
+type browserTokens struct {
+	key []byte
+	ttl time.Duration
+}
+
+func newBrowserTokens(ttl time.Duration) (*browserTokens, error) {
+	key, err := ctx.Secret(BrowserTokenSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &browserTokens{key: []byte(key), ttl: ttl}, nil
+}
+
+func (this *browserTokens) issue(appid, group string, topics []string, now time.Time) (token string, expires time.Time, err error) {
+	expires = now.Add(this.ttl)
+	token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, &browserClaims{
+		Appid:  appid,
+		Group:  group,
+		Topics: topics,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expires.Unix(),
+		},
+	}).SignedString(this.key)
+	return
+}
+
+func (this *browserTokens) verify(token string) (*browserClaims, error) {
+	claims := &browserClaims{}
+	t, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		// reject alg none and asymmetric algs signed with our key as public key
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidBrowserToken
+		}
+		return this.key, nil
+	})
+	if err != nil || !t.Valid || claims.Appid == "" {
+		return nil, ErrInvalidBrowserToken
+	}
+
+	return claims, nil
+}
+
+// browserTokenOf returns the browser token of a request: Authorization: Bearer xxx, or query
+// token=xxx for EventSource and WebSocket that cannot set headers.
+func browserTokenOf(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(auth[len("Bearer "):])
+	}
+
+	return r.URL.Query().Get("token")
+}
+
+type browserClaimsKey struct{}
+
+// browserAuth verifies the browser token of a Sub request if any, then the appid of the token
+// is put into header Appid and the claims into the request context for authSub.
+func (this *subServer) browserAuth(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		token := browserTokenOf(r)
+		if token == "" {
+			h(w, r, params)
+			return
+		}
+
+		if this.gw.browserTokens == nil {
+			writeAuthFailure(w, ErrBrowserTokenDisabled)
+			return
+		}
+
+		claims, err := this.gw.browserTokens.verify(token)
+		if err != nil {
+			log.Error("sub -(%s): {%s UA:%s} %v", getHttpRemoteIp(r), r.URL.Path, r.Header.Get("User-Agent"), err)
+
+			writeAuthFailure(w, err)
+			return
+		}
+
+		r.Header.Set(HttpHeaderAppid, claims.Appid)
+		r.Header.Del(HttpHeaderSubkey)
+		h(w, r.WithContext(context.WithValue(r.Context(), browserClaimsKey{}, claims)), params)
+	}
+}
+
+// authSub authenticates a Sub request by the scope of its browser token if any, otherwise by subkey.
+func authSub(r *http.Request, myAppid, hisAppid, topic, ver, group string) error {
+	if claims, ok := r.Context().Value(browserClaimsKey{}).(*browserClaims); ok {
+		if !claims.permits(myAppid, hisAppid, topic, ver, group) {
+			return ErrBrowserTokenScope
+		}
+		return nil
+	}
+
+	return manager.Default.AuthSub(myAppid, r.Header.Get(HttpHeaderSubkey), hisAppid, topic, group)
+}
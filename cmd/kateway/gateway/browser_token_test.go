@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/funkygao/assert"
+	"github.com/funkygao/httprouter"
+)
+
+func TestBrowserTokenIssueVerify(t *testing.T) {
+	tokens := &browserTokens{key: []byte("secret"), ttl: time.Minute}
+	token, expires, err := tokens.issue("app1", "web", []string{"app2/notice/v1"}, time.Now())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, expires.After(time.Now()))
+
+	claims, err := tokens.verify(token)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "app1", claims.Appid)
+	assert.Equal(t, true, claims.permits("app1", "app2", "notice", "v1", "web"))
+	assert.Equal(t, false, claims.permits("app1", "app2", "notice", "v2", "web"))
+	assert.Equal(t, false, claims.permits("app1", "app2", "notice", "v1", "other"))
+	assert.Equal(t, false, claims.permits("app3", "app2", "notice", "v1", "web"))
+
+	// expired
+	token, _, _ = tokens.issue("app1", "web", []string{"app2/notice/v1"}, time.Now().Add(-time.Hour))
+	_, err = tokens.verify(token)
+	assert.Equal(t, ErrInvalidBrowserToken, err)
+
+	// signed by another key
+	other := &browserTokens{key: []byte("guess"), ttl: time.Minute}
+	token, _, _ = other.issue("app1", "web", []string{"app2/notice/v1"}, time.Now())
+	_, err = tokens.verify(token)
+	assert.Equal(t, ErrInvalidBrowserToken, err)
+
+	// alg none
+	token, _ = jwt.NewWithClaims(jwt.SigningMethodNone, &browserClaims{Appid: "app1"}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	_, err = tokens.verify(token)
+	assert.Equal(t, ErrInvalidBrowserToken, err)
+}
+
+func TestBrowserAuth(t *testing.T) {
+	gw := &Gateway{browserTokens: &browserTokens{key: []byte("secret"), ttl: time.Minute}}
+	s := &subServer{webServer: &webServer{gw: gw}}
+	token, _, _ := gw.browserTokens.issue("app1", "web", []string{"app2/notice/v1"}, time.Now())
+
+	var authErr error
+	h := s.browserAuth(func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		assert.Equal(t, "app1", r.Header.Get(HttpHeaderAppid))
+		authErr = authSub(r, r.Header.Get(HttpHeaderAppid), params.ByName(UrlParamAppid),
+			params.ByName(UrlParamTopic), params.ByName(UrlParamVersion), r.URL.Query().Get("group"))
+	})
+	params := httprouter.Params{{Key: UrlParamAppid, Value: "app2"}, {Key: UrlParamTopic, Value: "notice"},
+		{Key: UrlParamVersion, Value: "v1"}}
+
+	// appid of the token wins over the header
+	r, _ := http.NewRequest("GET", "/v1/msgs/app2/notice/v1?group=web&token="+token, nil)
+	r.Header.Set(HttpHeaderAppid, "app3")
+	h(httptest.NewRecorder(), r, params)
+	assert.Equal(t, nil, authErr)
+
+	r, _ = http.NewRequest("GET", "/v1/msgs/app2/notice/v1?group=admin", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	h(httptest.NewRecorder(), r, params)
+	assert.Equal(t, ErrBrowserTokenScope, authErr)
+
+	// rejected before the handler
+	authErr = nil
+	w := httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/v1/msgs/app2/notice/v1?group=web&token="+strings.ToUpper(token), nil)
+	h(w, r, params)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, nil, authErr)
+}
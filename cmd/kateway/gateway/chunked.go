@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"io"
+
+	"github.com/funkygao/gafka/mpool"
+)
+
+const chunkedReadSize = 4 << 10
+
+// readChunkedBody streams a body of unknown size(chunked transfer encoding) into
+// pooled message memory.
+//
+// The message slab grows as bytes arrive instead of reserving max pub size upfront,
+// and reading stops as soon as the body exceeds max bytes.
+func readChunkedBody(body io.Reader, max int64) (*mpool.Message, error) {
+	msg := mpool.NewMessage(chunkedReadSize)
+	n := 0
+	for {
+		if n == cap(msg.Body) {
+			msg = growMessage(msg, n, 2*n)
+		}
+
+		nr, err := body.Read(msg.Body[n:cap(msg.Body)])
+		n += nr
+		if int64(n) > max {
+			msg.Free()
+			return nil, ErrTooBigMessage
+		}
+
+		if err == io.EOF {
+			msg.Body = msg.Body[:n]
+			return msg, nil
+		} else if err != nil {
+			msg.Free()
+			return nil, err
+		}
+	}
+}
+
+// maxBytesReader is io.LimitReader failing with ErrTooBigMessage instead of EOF once the
+// body exceeds max bytes.
+type maxBytesReader struct {
+	r io.Reader
+	n int64 // bytes left
+}
+
+func newMaxBytesReader(r io.Reader, max int64) *maxBytesReader {
+	return &maxBytesReader{r: r, n: max}
+}
+
+func (this *maxBytesReader) Read(p []byte) (n int, err error) {
+	if int64(len(p)) > this.n+1 {
+		p = p[:this.n+1]
+	}
+	n, err = this.r.Read(p)
+	if int64(n) > this.n {
+		n = int(this.n)
+		this.n = 0
+		return n, ErrTooBigMessage
+	}
+
+	this.n -= int64(n)
+	return
+}
+
+// growMessage returns a message of at least size capacity with the first n bytes
+// of msg copied, msg is recycled if a new message is allocated.
+func growMessage(msg *mpool.Message, n, size int) *mpool.Message {
+	if cap(msg.Body) >= size {
+		msg.Body = msg.Body[:n]
+		return msg
+	}
+
+	newMsg := mpool.NewMessage(size)
+	newMsg.Body = newMsg.Body[:n]
+	copy(newMsg.Body, msg.Body[:n])
+	msg.Free()
+	return newMsg
+}
@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestReadChunkedBody(t *testing.T) {
+	body := strings.Repeat("x", chunkedReadSize*3+5)
+	msg, err := readChunkedBody(strings.NewReader(body), int64(len(body)))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, body, string(msg.Body))
+	msg.Free()
+
+	_, err = readChunkedBody(strings.NewReader(body), int64(len(body)-1))
+	assert.Equal(t, ErrTooBigMessage, err)
+
+	msg, err = readChunkedBody(bytes.NewReader(nil), 10)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(msg.Body))
+	msg.Free()
+}
+
+func TestGrowMessage(t *testing.T) {
+	msg, err := readChunkedBody(strings.NewReader("hello"), 100)
+	assert.Equal(t, nil, err)
+	msg = growMessage(msg, 5, 100<<10)
+	assert.Equal(t, true, cap(msg.Body) >= 100<<10)
+	assert.Equal(t, "hello", string(msg.Body))
+	msg.Free()
+}
+
+func TestMaxBytesReader(t *testing.T) {
+	buf := make([]byte, 10)
+	n, err := io.ReadAtLeast(newMaxBytesReader(strings.NewReader("hello"), 5), buf, 5)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+
+	_, err = io.ReadFull(newMaxBytesReader(strings.NewReader("hello world"), 5), buf)
+	assert.Equal(t, ErrTooBigMessage, err)
+
+	_, err = io.ReadFull(newMaxBytesReader(strings.NewReader("hi"), 5), buf[:5])
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
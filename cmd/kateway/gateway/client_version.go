@@ -0,0 +1,210 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// clients without X-Client-Version are counted as this version
+	unknownClientVersion = "unknown"
+
+	// bounds the inventory against appid/version spoofing
+	maxClientVersionApps        = 10000
+	maxClientVersionsPerApp     = 32
+	maxClientVersionHeaderBytes = 64
+)
+
+// clientVersion is parsed from header X-Client-Version: [name/]major.minor.patch, e,g.
+// pubsub-go/0.2.1. Only the numeric part takes part in comparison.
+type clientVersion []int
+
+func parseClientVersion(s string) (clientVersion, error) {
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		s = s[i+1:]
+	}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if s == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 4 {
+		return nil, fmt.Errorf("invalid version: %s", s)
+	}
+
+	v := make(clientVersion, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version: %s", s)
+		}
+		v = append(v, n)
+	}
+	return v, nil
+}
+
+// less compares numerically with missing parts as 0, so 0.2 equals 0.2.0.
+func (this clientVersion) less(that clientVersion) bool {
+	for i := 0; i < len(this) || i < len(that); i++ {
+		var a, b int
+		if i < len(this) {
+			a = this[i]
+		}
+		if i < len(that) {
+			b = that[i]
+		}
+		if a != b {
+			return a < b
+		}
+	}
+	return false
+}
+
+type clientVersionStat struct {
+	Requests  int64     `json:"requests"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// clientVersions is the inventory of client versions by appid, so that before retiring
+// an old API behavior we know who is still relying on it.
+//
+// It also enforces the version policy: versions below deprecated get a Warning header,
+// versions below floor are rejected.
+type clientVersions struct {
+	mu         sync.RWMutex
+	apps       map[string]map[string]*clientVersionStat // appid:version:stat
+	floor      clientVersion
+	deprecated clientVersion
+}
+
+func newClientVersions() *clientVersions {
+	return &clientVersions{
+		apps: make(map[string]map[string]*clientVersionStat),
+	}
+}
+
+// setPolicy updates the version floor and deprecation threshold, empty to disable.
+func (this *clientVersions) setPolicy(floor, deprecated string) error {
+	var f, d clientVersion
+	var err error
+	if floor != "" {
+		if f, err = parseClientVersion(floor); err != nil {
+			return err
+		}
+	}
+	if deprecated != "" {
+		if d, err = parseClientVersion(deprecated); err != nil {
+			return err
+		}
+	}
+
+	this.mu.Lock()
+	this.floor, this.deprecated = f, d
+	this.mu.Unlock()
+	return nil
+}
+
+// record accounts a request of the appid and returns the policy decision for its version.
+// A missing or malformed version is never rejected, it only gets the deprecation warning.
+func (this *clientVersions) record(appid, ver string) (reject bool, warning string) {
+	if ver == "" || len(ver) > maxClientVersionHeaderBytes {
+		ver = unknownClientVersion
+	}
+	v, err := parseClientVersion(ver)
+
+	now := time.Now()
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if appid != "" {
+		versions, present := this.apps[appid]
+		if !present && len(this.apps) < maxClientVersionApps {
+			versions = make(map[string]*clientVersionStat)
+			this.apps[appid] = versions
+		}
+
+		if versions != nil {
+			stat, present := versions[ver]
+			if !present && len(versions) < maxClientVersionsPerApp {
+				stat = &clientVersionStat{FirstSeen: now}
+				versions[ver] = stat
+			}
+			if stat != nil {
+				stat.Requests++
+				stat.LastSeen = now
+			}
+		}
+	}
+
+	switch {
+	case err != nil:
+		if this.floor != nil || this.deprecated != nil {
+			warning = "client version unknown, please send X-Client-Version"
+		}
+
+	case this.floor != nil && v.less(this.floor):
+		reject = true
+
+	case this.deprecated != nil && v.less(this.deprecated):
+		warning = fmt.Sprintf("client version %s deprecated, please upgrade", ver)
+	}
+	return
+}
+
+// check records the request and responds 426 if the client version is below the floor.
+func (this *clientVersions) check(w http.ResponseWriter, r *http.Request) (rejected bool) {
+	ver := r.Header.Get(HttpHeaderClientVersion)
+	reject, warning := this.record(r.Header.Get(HttpHeaderAppid), ver)
+	if reject {
+		writeErrorCode(w, ErrCodeClientTooOld, fmt.Sprintf("client version %s not supported, please upgrade", ver),
+			http.StatusUpgradeRequired)
+		return true
+	}
+
+	if warning != "" {
+		// RFC 7234 miscellaneous persistent warning
+		w.Header().Set("Warning", fmt.Sprintf(`299 kateway "%s"`, warning))
+	}
+	return false
+}
+
+type clientVersionInfo struct {
+	Version string `json:"version"`
+	clientVersionStat
+}
+
+// inventory returns {appid: [version]} of the appid or all apps if empty.
+func (this *clientVersions) inventory(appid string) map[string][]clientVersionInfo {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	r := make(map[string][]clientVersionInfo)
+	for app, versions := range this.apps {
+		if appid != "" && app != appid {
+			continue
+		}
+
+		infos := make([]clientVersionInfo, 0, len(versions))
+		for ver, stat := range versions {
+			infos = append(infos, clientVersionInfo{Version: ver, clientVersionStat: *stat})
+		}
+		sort.Sort(clientVersionInfoByVersion(infos))
+		r[app] = infos
+	}
+	return r
+}
+
+type clientVersionInfoByVersion []clientVersionInfo
+
+func (this clientVersionInfoByVersion) Len() int      { return len(this) }
+func (this clientVersionInfoByVersion) Swap(i, j int) { this[i], this[j] = this[j], this[i] }
+func (this clientVersionInfoByVersion) Less(i, j int) bool {
+	return this[i].Version < this[j].Version
+}
@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestParseClientVersion(t *testing.T) {
+	v, err := parseClientVersion("pubsub-go/0.2.1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, clientVersion{0, 2, 1}, v)
+
+	v, err = parseClientVersion("v1.3")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, clientVersion{1, 3}, v)
+
+	for _, s := range []string{"", "unknown", "pubsub-go/", "1.x", "1.-2", "1.2.3.4.5"} {
+		_, err = parseClientVersion(s)
+		assert.NotEqual(t, nil, err)
+	}
+
+	assert.Equal(t, true, clientVersion{0, 2}.less(clientVersion{0, 2, 1}))
+	assert.Equal(t, false, clientVersion{0, 2}.less(clientVersion{0, 2, 0}))
+	assert.Equal(t, false, clientVersion{1}.less(clientVersion{0, 9, 9}))
+	assert.Equal(t, true, clientVersion{0, 10}.less(clientVersion{1}))
+}
+
+func TestClientVersionsCheck(t *testing.T) {
+	cv := newClientVersions()
+	assert.NotEqual(t, nil, cv.setPolicy("x", ""))
+	assert.Equal(t, nil, cv.setPolicy("0.2", "0.3"))
+
+	check := func(appid, ver string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/v1/msgs/foo/v1", nil)
+		r.Header.Set(HttpHeaderAppid, appid)
+		if ver != "" {
+			r.Header.Set(HttpHeaderClientVersion, ver)
+		}
+		w := httptest.NewRecorder()
+		if !cv.check(w, r) {
+			w.WriteHeader(http.StatusOK)
+		}
+		return w
+	}
+
+	w := check("app1", "pubsub-go/0.1.9")
+	assert.Equal(t, http.StatusUpgradeRequired, w.Code)
+
+	w = check("app1", "pubsub-go/0.2.5")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `299 kateway "client version pubsub-go/0.2.5 deprecated, please upgrade"`, w.Header().Get("Warning"))
+
+	w = check("app1", "pubsub-go/0.3")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Header().Get("Warning"))
+
+	// missing version is never rejected
+	w = check("app2", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, "", w.Header().Get("Warning"))
+	check("app2", "")
+
+	inventory := cv.inventory("")
+	assert.Equal(t, 2, len(inventory))
+	assert.Equal(t, 3, len(inventory["app1"]))
+	assert.Equal(t, "pubsub-go/0.1.9", inventory["app1"][0].Version)
+	assert.Equal(t, unknownClientVersion, inventory["app2"][0].Version)
+	assert.Equal(t, int64(2), inventory["app2"][0].Requests)
+	assert.Equal(t, 1, len(cv.inventory("app2")))
+
+	// policy off
+	assert.Equal(t, nil, cv.setPolicy("", ""))
+	w = check("app1", "pubsub-go/0.1.9")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Header().Get("Warning"))
+}
@@ -8,6 +8,15 @@ const (
 	HttpHeaderMsgKey          = "X-Key"
 	HttpHeaderMsgTag          = "X-Tag"
 	HttpHeaderJobId           = "X-Job-Id"
+	HttpHeaderDelay           = "X-Delay"
+	HttpHeaderDuplicated      = "X-Duplicated"
+	HttpHeaderSubSession      = "X-Sub-Session"
+	HttpHeaderResumeToken     = "X-Resume-Token"
+	HttpHeaderRedelivery      = "X-Redelivery-Count"
+	HttpHeaderRequestId       = "X-Request-Id"
+	HttpHeaderRedirect        = "X-Redirect"
+	HttpHeaderClientVersion   = "X-Client-Version"
+	HttpHeaderServerVersion   = "X-Server-Version"
 	HttpHeaderAcceptEncoding  = "Accept-Encoding"
 	HttpHeaderContentEncoding = "Content-Encoding"
 	HttpEncodingGzip          = "gzip"
@@ -0,0 +1,92 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/funkygao/httprouter"
+)
+
+var (
+	corsAllowHeaders = strings.Join([]string{"Origin", "Content-Type", "Content-Length", "Accept-Encoding",
+		"X-CSRF-Token", "Authorization", HttpHeaderPartition, HttpHeaderOffset, HttpHeaderResumeToken}, ", ")
+	corsExposeHeaders = strings.Join([]string{HttpHeaderPartition, HttpHeaderOffset, HttpHeaderMsgTag,
+		HttpHeaderRedelivery, HttpHeaderRequestId, HttpHeaderResumeToken}, ", ")
+)
+
+// corsPolicy decides which origins may call kateway cross origin, so that web frontends
+// can Sub directly from the browser.
+type corsPolicy struct {
+	any     bool
+	origins map[string]struct{}
+}
+
+// newCorsPolicy parses origins seperated by comma, * for any origin. Empty disables CORS.
+func newCorsPolicy(origins string) *corsPolicy {
+	this := &corsPolicy{origins: make(map[string]struct{})}
+	for _, o := range strings.Split(origins, ",") {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		switch o {
+		case "":
+		case "*":
+			this.any = true
+		default:
+			this.origins[strings.ToLower(o)] = struct{}{}
+		}
+	}
+
+	return this
+}
+
+func (this *corsPolicy) allowed(origin string) bool {
+	if this == nil || origin == "" {
+		return false
+	}
+	if this.any {
+		return true
+	}
+
+	_, present := this.origins[strings.ToLower(origin)]
+	return present
+}
+
+// writeHeaders writes the CORS headers if the origin of the request is allowed.
+func (this *corsPolicy) writeHeaders(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if !this.allowed(origin) {
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+	w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Max-Age", "600")
+	w.Header().Add("Vary", "Origin")
+}
+
+// checkOrigin is the websocket origin check: same origin or allowed cross origin.
+func (this *corsPolicy) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if i := strings.Index(origin, "://"); i > 0 && strings.EqualFold(origin[i+3:], r.Host) {
+		return true
+	}
+
+	return this.allowed(origin)
+}
+
+// corsPreflightHandler answers the browser preflight OPTIONS request, the CORS headers
+// are written by the middleware.
+func (this *Gateway) corsPreflightHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if !this.cors.allowed(r.Header.Get("Origin")) {
+		writeErrorCode(w, ErrCodeAuthFailed, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,47 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestCorsPolicy(t *testing.T) {
+	p := newCorsPolicy("https://web.mycorp.com/, http://localhost:8080")
+	assert.Equal(t, true, p.allowed("https://web.mycorp.com"))
+	assert.Equal(t, true, p.allowed("https://WEB.mycorp.com"))
+	assert.Equal(t, true, p.allowed("http://localhost:8080"))
+	assert.Equal(t, false, p.allowed("https://evil.com"))
+	assert.Equal(t, false, p.allowed(""))
+
+	assert.Equal(t, true, newCorsPolicy("*").allowed("https://evil.com"))
+	assert.Equal(t, false, newCorsPolicy("").allowed("https://web.mycorp.com"))
+	var disabled *corsPolicy
+	assert.Equal(t, false, disabled.allowed("https://web.mycorp.com"))
+
+	r, _ := http.NewRequest("GET", "/v1/msgs/app2/notice/v1", nil)
+	r.Header.Set("Origin", "https://evil.com")
+	w := httptest.NewRecorder()
+	p.writeHeaders(w, r)
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+
+	r.Header.Set("Origin", "https://web.mycorp.com")
+	p.writeHeaders(w, r)
+	assert.Equal(t, "https://web.mycorp.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, corsExposeHeaders, w.Header().Get("Access-Control-Expose-Headers"))
+}
+
+func TestCorsCheckOrigin(t *testing.T) {
+	p := newCorsPolicy("https://web.mycorp.com")
+	r, _ := http.NewRequest("GET", "http://sub.mycorp.com:9192/v1/ws/msgs/app2/notice/v1", nil)
+	assert.Equal(t, true, p.checkOrigin(r))
+
+	r.Header.Set("Origin", "http://sub.mycorp.com:9192")
+	assert.Equal(t, true, p.checkOrigin(r))
+	r.Header.Set("Origin", "https://web.mycorp.com")
+	assert.Equal(t, true, p.checkOrigin(r))
+	r.Header.Set("Origin", "https://evil.com")
+	assert.Equal(t, false, p.checkOrigin(r))
+}
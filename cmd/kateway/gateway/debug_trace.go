@@ -0,0 +1,317 @@
+package gateway
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/funkygao/httprouter"
+)
+
+const (
+	debugTraceMaxRules    = 20
+	debugTraceDefaultSize = 500
+	debugTraceMaxSize     = 10000
+	debugTraceMaxTTL      = time.Hour * 2
+	debugTraceMaxBody     = 4 << 10
+
+	// expired rules are kept for download before purged
+	debugTraceRetention = time.Hour
+)
+
+// debugTraceEntry is a captured request/response exchange.
+type debugTraceEntry struct {
+	Time          time.Time   `json:"time"`
+	Method        string      `json:"method"`
+	Uri           string      `json:"uri"`
+	Remote        string      `json:"remote"`
+	Appid         string      `json:"appid"`
+	ReqHeader     http.Header `json:"req_header"`
+	ReqBody       string      `json:"req_body"`
+	Status        int         `json:"status"`
+	RespHeader    http.Header `json:"resp_header"`
+	RespBody      string      `json:"resp_body"`
+	RespBytes     int         `json:"resp_bytes"`
+	Latency       string      `json:"latency"`
+	BodyTruncated bool        `json:"body_truncated,omitempty"`
+}
+
+// debugTraceRule captures the traffic of an appid and/or topic into a ring buffer till it expires.
+type debugTraceRule struct {
+	Appid    string
+	Topic    string
+	Size     int
+	ExpireAt time.Time
+
+	mu       sync.Mutex
+	ring     []debugTraceEntry
+	next     int
+	captured int64
+}
+
+type debugTraceRuleInfo struct {
+	Appid    string    `json:"appid"`
+	Topic    string    `json:"topic"`
+	Size     int       `json:"size"`
+	ExpireAt time.Time `json:"expire_at"`
+	Active   bool      `json:"active"`
+	Captured int64     `json:"captured"`
+}
+
+func (this *debugTraceRule) key() string {
+	return this.Appid + "/" + this.Topic
+}
+
+// match checks appid against both the caller and the topic owner, empty field matches all.
+func (this *debugTraceRule) match(appid, owner, topic string, now time.Time) bool {
+	if now.After(this.ExpireAt) {
+		return false
+	}
+	if this.Appid != "" && this.Appid != appid && this.Appid != owner {
+		return false
+	}
+
+	return this.Topic == "" || this.Topic == topic
+}
+
+func (this *debugTraceRule) record(e debugTraceEntry) {
+	this.mu.Lock()
+	if len(this.ring) < this.Size {
+		this.ring = append(this.ring, e)
+	} else {
+		this.ring[this.next] = e
+	}
+	this.next = (this.next + 1) % this.Size
+	this.captured++
+	this.mu.Unlock()
+}
+
+func (this *debugTraceRule) info() debugTraceRuleInfo {
+	this.mu.Lock()
+	captured := this.captured
+	this.mu.Unlock()
+
+	return debugTraceRuleInfo{
+		Appid:    this.Appid,
+		Topic:    this.Topic,
+		Size:     this.Size,
+		ExpireAt: this.ExpireAt,
+		Active:   time.Now().Before(this.ExpireAt),
+		Captured: captured,
+	}
+}
+
+// entries returns the captured exchanges, the oldest first.
+func (this *debugTraceRule) entries() []debugTraceEntry {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	r := make([]debugTraceEntry, 0, len(this.ring))
+	if len(this.ring) == this.Size {
+		r = append(r, this.ring[this.next:]...)
+		r = append(r, this.ring[:this.next]...)
+	} else {
+		r = append(r, this.ring...)
+	}
+	return r
+}
+
+// debugTraces enables verbose tracing of specific appid/topic at runtime, so that a misbehaving
+// client's exact traffic can be captured without raising the global log level.
+type debugTraces struct {
+	n int32 // num of rules, to skip the lock on hot path
+
+	mu    sync.RWMutex
+	rules map[string]*debugTraceRule // appid/topic: rule
+}
+
+func newDebugTraces() *debugTraces {
+	return &debugTraces{rules: make(map[string]*debugTraceRule)}
+}
+
+func (this *debugTraces) enable(appid, topic string, ttl time.Duration, size int) (*debugTraceRule, error) {
+	if appid == "" && topic == "" {
+		return nil, fmt.Errorf("appid or topic required")
+	}
+	if ttl <= 0 || ttl > debugTraceMaxTTL {
+		return nil, fmt.Errorf("ttl must be within (0, %s]", debugTraceMaxTTL)
+	}
+	if size <= 0 || size > debugTraceMaxSize {
+		return nil, fmt.Errorf("size must be within (0, %d]", debugTraceMaxSize)
+	}
+
+	rule := &debugTraceRule{
+		Appid:    appid,
+		Topic:    topic,
+		Size:     size,
+		ExpireAt: time.Now().Add(ttl),
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.purge(time.Now())
+	if _, present := this.rules[rule.key()]; !present && len(this.rules) >= debugTraceMaxRules {
+		return nil, fmt.Errorf("too many trace rules, max %d", debugTraceMaxRules)
+	}
+	this.rules[rule.key()] = rule // a renewed rule starts with an empty ring
+	atomic.StoreInt32(&this.n, int32(len(this.rules)))
+	return rule, nil
+}
+
+func (this *debugTraces) disable(appid, topic string) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	k := appid + "/" + topic
+	_, present := this.rules[k]
+	delete(this.rules, k)
+	atomic.StoreInt32(&this.n, int32(len(this.rules)))
+	return present
+}
+
+func (this *debugTraces) get(appid, topic string) *debugTraceRule {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.rules[appid+"/"+topic]
+}
+
+// list returns all the rules sorted by key, purging those long expired.
+func (this *debugTraces) list() []debugTraceRuleInfo {
+	this.mu.Lock()
+	rules := make([]*debugTraceRule, 0, len(this.rules))
+	this.purge(time.Now())
+	for _, rule := range this.rules {
+		rules = append(rules, rule)
+	}
+	this.mu.Unlock()
+
+	sort.Sort(debugTraceRulesByKey(rules))
+	r := make([]debugTraceRuleInfo, 0, len(rules))
+	for _, rule := range rules {
+		r = append(r, rule.info())
+	}
+	return r
+}
+
+// purge must be called with lock held.
+func (this *debugTraces) purge(now time.Time) {
+	for k, rule := range this.rules {
+		if now.Sub(rule.ExpireAt) > debugTraceRetention {
+			delete(this.rules, k)
+		}
+	}
+	atomic.StoreInt32(&this.n, int32(len(this.rules)))
+}
+
+// matched returns the active rules the request matches.
+func (this *debugTraces) matched(r *http.Request, params httprouter.Params) []*debugTraceRule {
+	if atomic.LoadInt32(&this.n) == 0 {
+		return nil
+	}
+
+	appid := r.Header.Get(HttpHeaderAppid)
+	owner := params.ByName(UrlParamAppid)
+	topic := params.ByName(UrlParamTopic)
+	now := time.Now()
+
+	var rules []*debugTraceRule
+	this.mu.RLock()
+	for _, rule := range this.rules {
+		if rule.match(appid, owner, topic, now) {
+			rules = append(rules, rule)
+		}
+	}
+	this.mu.RUnlock()
+	return rules
+}
+
+type debugTraceRulesByKey []*debugTraceRule
+
+func (s debugTraceRulesByKey) Len() int           { return len(s) }
+func (s debugTraceRulesByKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s debugTraceRulesByKey) Less(i, j int) bool { return s[i].key() < s[j].key() }
+
+// cappedBuffer keeps the first limit bytes written to it and never fails.
+type cappedBuffer struct {
+	buf       []byte
+	limit     int
+	truncated bool
+}
+
+func (this *cappedBuffer) Write(p []byte) (int, error) {
+	if room := this.limit - len(this.buf); room < len(p) {
+		this.truncated = true
+		if room > 0 {
+			this.buf = append(this.buf, p[:room]...)
+		}
+	} else {
+		this.buf = append(this.buf, p...)
+	}
+	return len(p), nil
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// debugTraceCapture collects a request/response exchange for the matched rules.
+type debugTraceCapture struct {
+	rules   []*debugTraceRule
+	r       *http.Request
+	startAt time.Time
+	reqBody *cappedBuffer
+}
+
+// startDebugTrace tees the request body, and the response body is teed by the writer wrapper.
+func startDebugTrace(rules []*debugTraceRule, r *http.Request, ww WriterWrapper) *debugTraceCapture {
+	c := &debugTraceCapture{
+		rules:   rules,
+		r:       r,
+		startAt: time.Now(),
+		reqBody: &cappedBuffer{limit: debugTraceMaxBody},
+	}
+	if r.Body != nil {
+		r.Body = teeReadCloser{Reader: io.TeeReader(r.Body, c.reqBody), Closer: r.Body}
+	}
+	ww.tee(&cappedBuffer{limit: debugTraceMaxBody})
+	return c
+}
+
+func (this *debugTraceCapture) finish(ww WriterWrapper) {
+	reqHeader := make(http.Header, len(this.r.Header))
+	for k, v := range this.r.Header {
+		reqHeader[k] = v
+	}
+	// credentials never captured
+	for _, k := range []string{HttpHeaderPubkey, HttpHeaderSubkey, "Authorization"} {
+		if _, present := reqHeader[k]; present {
+			reqHeader[k] = []string{"***"}
+		}
+	}
+
+	respBody := ww.teed()
+	e := debugTraceEntry{
+		Time:          this.startAt,
+		Method:        this.r.Method,
+		Uri:           this.r.RequestURI,
+		Remote:        getHttpRemoteIp(this.r),
+		Appid:         this.r.Header.Get(HttpHeaderAppid),
+		ReqHeader:     reqHeader,
+		ReqBody:       string(this.reqBody.buf),
+		Status:        ww.Status(),
+		RespHeader:    ww.Header(),
+		RespBody:      string(respBody.buf),
+		RespBytes:     ww.BytesWritten(),
+		Latency:       time.Since(this.startAt).String(),
+		BodyTruncated: this.reqBody.truncated || respBody.truncated,
+	}
+	for _, rule := range this.rules {
+		rule.record(e)
+	}
+}
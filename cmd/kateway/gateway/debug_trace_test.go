@@ -0,0 +1,83 @@
+package gateway
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/httprouter"
+)
+
+func TestDebugTracesMatch(t *testing.T) {
+	traces := newDebugTraces()
+	_, err := traces.enable("", "", time.Minute, 10)
+	assert.NotEqual(t, nil, err)
+	_, err = traces.enable("app1", "", time.Hour*3, 10)
+	assert.NotEqual(t, nil, err)
+
+	_, err = traces.enable("app1", "", time.Minute, 10)
+	assert.Equal(t, nil, err)
+	_, err = traces.enable("", "foobar", time.Minute, 10)
+	assert.Equal(t, nil, err)
+
+	r, _ := http.NewRequest("GET", "/v1/msgs/app1/orders/v1", nil)
+	r.Header.Set(HttpHeaderAppid, "app2")
+	params := httprouter.Params{{Key: UrlParamAppid, Value: "app1"}, {Key: UrlParamTopic, Value: "orders"}}
+	assert.Equal(t, 1, len(traces.matched(r, params))) // topic owner matches
+
+	params = httprouter.Params{{Key: UrlParamAppid, Value: "app3"}, {Key: UrlParamTopic, Value: "foobar"}}
+	assert.Equal(t, 1, len(traces.matched(r, params)))
+
+	params = httprouter.Params{{Key: UrlParamTopic, Value: "orders"}}
+	assert.Equal(t, 0, len(traces.matched(r, params)))
+
+	assert.Equal(t, 2, len(traces.list()))
+	assert.Equal(t, true, traces.disable("app1", ""))
+	assert.Equal(t, false, traces.disable("app1", ""))
+	assert.Equal(t, 1, len(traces.list()))
+
+	traces.get("", "foobar").ExpireAt = time.Now().Add(-time.Second)
+	params = httprouter.Params{{Key: UrlParamTopic, Value: "foobar"}}
+	assert.Equal(t, 0, len(traces.matched(r, params))) // expired
+	assert.Equal(t, 1, len(traces.list()))             // but still downloadable
+}
+
+func TestDebugTraceRuleRing(t *testing.T) {
+	rule := &debugTraceRule{Size: 3, ExpireAt: time.Now().Add(time.Minute)}
+	for i := 0; i < 5; i++ {
+		rule.record(debugTraceEntry{Status: i})
+	}
+
+	entries := rule.entries()
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, 2, entries[0].Status) // the oldest first
+	assert.Equal(t, 4, entries[2].Status)
+	assert.Equal(t, int64(5), rule.info().Captured)
+}
+
+func TestDebugTraceCapture(t *testing.T) {
+	rule := &debugTraceRule{Size: 3, ExpireAt: time.Now().Add(time.Minute)}
+	r, _ := http.NewRequest("POST", "/v1/msgs/foobar/v1", bytes.NewBufferString("hello world"))
+	r.Header.Set(HttpHeaderPubkey, "secret")
+
+	ww := SniffWriter(httptest.NewRecorder())
+	c := startDebugTrace([]*debugTraceRule{rule}, r, ww)
+	body, _ := ioutil.ReadAll(r.Body)
+	assert.Equal(t, "hello world", string(body))
+	ww.WriteHeader(http.StatusCreated)
+	ww.Write(bytes.Repeat([]byte("x"), debugTraceMaxBody+1))
+	c.finish(ww)
+
+	e := rule.entries()[0]
+	assert.Equal(t, "hello world", e.ReqBody)
+	assert.Equal(t, "***", e.ReqHeader.Get(HttpHeaderPubkey))
+	assert.Equal(t, "secret", r.Header.Get(HttpHeaderPubkey))
+	assert.Equal(t, http.StatusCreated, e.Status)
+	assert.Equal(t, debugTraceMaxBody, len(e.RespBody))
+	assert.Equal(t, debugTraceMaxBody+1, e.RespBytes)
+	assert.Equal(t, true, e.BodyTruncated)
+}
@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	// 1MB per generation, false positive rate is below 1e-6 with 100K msgs in a window
+	dedupBloomBits   = 1 << 23
+	dedupBloomHashes = 5
+)
+
+// dedupFilters drops exactly duplicated Pub messages of a topic within its dedup window,
+// e,g. caused by producer retry storms.
+type dedupFilters struct {
+	mu      sync.Mutex
+	filters map[string]*rollingBloom // raw topic:filter
+}
+
+func newDedupFilters() *dedupFilters {
+	return &dedupFilters{filters: make(map[string]*rollingBloom)}
+}
+
+// duplicated checks if the message has been published within the window, and
+// remembers it if not.
+func (this *dedupFilters) duplicated(rawTopic string, window time.Duration, key, body []byte) bool {
+	this.mu.Lock()
+	f, present := this.filters[rawTopic]
+	if !present || f.window != window {
+		// window changed in manager, start over
+		f = newRollingBloom(window, dedupBloomBits)
+		this.filters[rawTopic] = f
+	}
+	this.mu.Unlock()
+
+	h1, h2 := dedupHash(key, body)
+	return f.testAndAdd(h1, h2, time.Now())
+}
+
+// rollingBloom is a bloom filter of 2 generations rotated each window, so a message
+// is remembered for at least 1 window and at most 2 windows.
+type rollingBloom struct {
+	mu        sync.Mutex
+	window    time.Duration
+	rotatedAt time.Time
+	cur, prev []uint64
+}
+
+func newRollingBloom(window time.Duration, bits int) *rollingBloom {
+	return &rollingBloom{
+		window:    window,
+		rotatedAt: time.Now(),
+		cur:       make([]uint64, bits/64),
+		prev:      make([]uint64, bits/64),
+	}
+}
+
+func (this *rollingBloom) testAndAdd(h1, h2 uint64, now time.Time) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if elapsed := now.Sub(this.rotatedAt); elapsed >= this.window {
+		if elapsed >= 2*this.window {
+			// idle for long, both generations expired
+			this.prev = make([]uint64, len(this.cur))
+		} else {
+			this.prev = this.cur
+		}
+		this.cur = make([]uint64, len(this.prev))
+		this.rotatedAt = now
+	}
+
+	bits := uint64(len(this.cur) * 64)
+	inCur, inPrev := true, true
+	for i := uint64(0); i < dedupBloomHashes; i++ {
+		idx := (h1 + i*h2) % bits
+		word, mask := idx/64, uint64(1)<<(idx%64)
+		if this.cur[word]&mask == 0 {
+			inCur = false
+			this.cur[word] |= mask
+		}
+		if this.prev[word]&mask == 0 {
+			inPrev = false
+		}
+	}
+
+	return inCur || inPrev
+}
+
+// dedupHash returns 2 independent hashes of a message for double hashing.
+func dedupHash(key, body []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(key)
+	h.Write([]byte{0}) // separates key from body
+	h.Write(body)
+	sum := h.Sum64()
+
+	// fnv is weak in low bits for similar messages, mix it
+	return fmix64(sum), fmix64(sum^0x9e3779b97f4a7c15) | 1
+}
+
+// fmix64 is the finalizer of murmur3.
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
@@ -0,0 +1,42 @@
+package gateway
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestRollingBloom(t *testing.T) {
+	now := time.Now()
+	f := newRollingBloom(time.Minute, 1<<16)
+	f.rotatedAt = now
+
+	h1, h2 := dedupHash([]byte("k"), []byte("hello"))
+	assert.Equal(t, false, f.testAndAdd(h1, h2, now))
+	assert.Equal(t, true, f.testAndAdd(h1, h2, now.Add(time.Second)))
+
+	// same body with different key is not a duplicate
+	k1, k2 := dedupHash([]byte("k2"), []byte("hello"))
+	assert.Equal(t, false, f.testAndAdd(k1, k2, now.Add(time.Second)))
+
+	// remembered in the previous generation after rotation
+	assert.Equal(t, true, f.testAndAdd(h1, h2, now.Add(time.Minute+time.Second)))
+
+	// expired after 2 windows idle
+	assert.Equal(t, false, f.testAndAdd(h1, h2, now.Add(time.Minute*4)))
+}
+
+func TestRollingBloomFalsePositive(t *testing.T) {
+	now := time.Now()
+	f := newRollingBloom(time.Minute, 1<<20)
+	n, fp := 10000, 0
+	for i := 0; i < n; i++ {
+		h1, h2 := dedupHash(nil, []byte(fmt.Sprintf("msg%d", i)))
+		if f.testAndAdd(h1, h2, now) {
+			fp++
+		}
+	}
+	assert.Equal(t, true, fp < 5)
+}
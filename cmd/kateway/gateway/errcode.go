@@ -0,0 +1,119 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+)
+
+// ErrCode is the stable machine readable code of an error response, so that client SDK
+// decides whether to retry by the code instead of parsing the error message.
+type ErrCode string
+
+const (
+	ErrCodeBadRequest        ErrCode = "bad_request"
+	ErrCodeAuthFailed        ErrCode = "auth_failed"
+	ErrCodeNotFound          ErrCode = "not_found"
+	ErrCodeTopicNotFound     ErrCode = "topic_not_found"
+	ErrCodeMethodNotAllowed  ErrCode = "method_not_allowed"
+	ErrCodeConflict          ErrCode = "conflict"
+	ErrCodeMessageTooLarge   ErrCode = "message_too_large"
+	ErrCodeQuotaExceeded     ErrCode = "quota_exceeded"
+	ErrCodeRebalancing       ErrCode = "rebalancing"
+	ErrCodeBrokerUnavailable ErrCode = "broker_unavailable"
+	ErrCodeInternal          ErrCode = "internal_error"
+	ErrCodeMaintenance       ErrCode = "maintenance"
+	ErrCodeClientTooOld      ErrCode = "client_too_old"
+	ErrCodeOverloaded        ErrCode = "overloaded"
+)
+
+// errCatalog tells whether the client can retry the same request on each code.
+var errCatalog = map[ErrCode]bool{
+	ErrCodeBadRequest:        false,
+	ErrCodeAuthFailed:        false,
+	ErrCodeNotFound:          false,
+	ErrCodeTopicNotFound:     false,
+	ErrCodeMethodNotAllowed:  false,
+	ErrCodeConflict:          false,
+	ErrCodeMessageTooLarge:   false,
+	ErrCodeQuotaExceeded:     true, // with backoff
+	ErrCodeRebalancing:       true,
+	ErrCodeBrokerUnavailable: true,
+	ErrCodeInternal:          true,
+	ErrCodeMaintenance:       true, // on another kateway
+	ErrCodeClientTooOld:      false,
+	ErrCodeOverloaded:        true, // after Retry-After
+}
+
+// errCodeOfMsg classifies the well known errors whose message is passed to the response writers.
+var errCodeOfMsg = map[string]ErrCode{
+	ErrTooBigMessage.Error():               ErrCodeMessageTooLarge,
+	manager.ErrEmptyIdentity.Error():       ErrCodeAuthFailed,
+	manager.ErrAuthenticationFail.Error():  ErrCodeAuthFailed,
+	manager.ErrAuthorizationFail.Error():   ErrCodeAuthFailed,
+	manager.ErrCrossTenant.Error():         ErrCodeAuthFailed,
+	store.ErrInvalidTopic.Error():          ErrCodeTopicNotFound,
+	store.ErrRebalancing.Error():           ErrCodeRebalancing,
+	store.ErrShuttingDown.Error():          ErrCodeBrokerUnavailable,
+	store.ErrBusy.Error():                  ErrCodeBrokerUnavailable,
+	store.ErrEmptyBrokers.Error():          ErrCodeBrokerUnavailable,
+	store.ErrCircuitOpen.Error():           ErrCodeBrokerUnavailable,
+	store.ErrTooManyConsumers.Error():      ErrCodeConflict,
+	manager.ErrDisabledTopic.Error():       ErrCodeTopicNotFound,
+	http.StatusText(http.StatusNotFound):   ErrCodeNotFound,
+	http.StatusText(http.StatusBadRequest): ErrCodeBadRequest,
+}
+
+// errCodeOf returns the code of an error response by its message, or by its status if unknown.
+func errCodeOf(msg string, status int) ErrCode {
+	if code, present := errCodeOfMsg[msg]; present {
+		return code
+	}
+
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrCodeAuthFailed
+	case http.StatusNotFound:
+		return ErrCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrCodeMethodNotAllowed
+	case http.StatusConflict:
+		return ErrCodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return ErrCodeMessageTooLarge
+	case http.StatusTooManyRequests:
+		return ErrCodeQuotaExceeded
+	case http.StatusServiceUnavailable:
+		return ErrCodeBrokerUnavailable
+	}
+
+	if status >= http.StatusInternalServerError {
+		return ErrCodeInternal
+	}
+	return ErrCodeBadRequest
+}
+
+// errorResponse is the json envelope of all error responses.
+type errorResponse struct {
+	Code      ErrCode `json:"errcode"`
+	Msg       string  `json:"errmsg"`
+	Retryable bool    `json:"retryable"`
+	RequestId string  `json:"request_id,omitempty"`
+}
+
+const maxRequestIdLen = 64
+
+var (
+	requestIdPrefix = strconv.FormatInt(time.Now().UnixNano(), 36) + "-"
+	requestIdSeq    uint64
+)
+
+// nextRequestId generates an id that stays unique across restarts of kateway, so that an error
+// reported by client can be pinpointed.
+func nextRequestId() string {
+	return requestIdPrefix + strconv.FormatUint(atomic.AddUint64(&requestIdSeq, 1), 36)
+}
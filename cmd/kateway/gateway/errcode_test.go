@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+)
+
+func TestErrCodeOf(t *testing.T) {
+	assert.Equal(t, ErrCodeMessageTooLarge, errCodeOf(ErrTooBigMessage.Error(), http.StatusBadRequest))
+	assert.Equal(t, ErrCodeAuthFailed, errCodeOf(manager.ErrAuthenticationFail.Error(), http.StatusBadRequest))
+	assert.Equal(t, ErrCodeTopicNotFound, errCodeOf(store.ErrInvalidTopic.Error(), http.StatusBadRequest))
+	assert.Equal(t, ErrCodeBrokerUnavailable, errCodeOf(store.ErrCircuitOpen.Error(), http.StatusInternalServerError))
+	assert.Equal(t, ErrCodeAuthFailed, errCodeOf("whatever", http.StatusUnauthorized))
+	assert.Equal(t, ErrCodeQuotaExceeded, errCodeOf("whatever", http.StatusTooManyRequests))
+	assert.Equal(t, ErrCodeInternal, errCodeOf("whatever", http.StatusInternalServerError))
+	assert.Equal(t, ErrCodeBadRequest, errCodeOf("whatever", http.StatusBadRequest))
+
+	// every code is in the catalog
+	for _, code := range errCodeOfMsg {
+		_, present := errCatalog[code]
+		assert.Equal(t, true, present)
+	}
+}
+
+func TestWriteErrorCode(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set(HttpHeaderRequestId, "req1")
+	writeErrorCode(w, ErrCodeQuotaExceeded, "quota exceeded", http.StatusTooManyRequests)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "application/json; charset=utf8", w.Header().Get("Content-Type"))
+
+	var resp errorResponse
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, ErrCodeQuotaExceeded, resp.Code)
+	assert.Equal(t, "quota exceeded", resp.Msg)
+	assert.Equal(t, true, resp.Retryable)
+	assert.Equal(t, "req1", resp.RequestId)
+}
+
+func TestNextRequestId(t *testing.T) {
+	assert.NotEqual(t, nextRequestId(), nextRequestId())
+}
@@ -11,4 +11,19 @@ var (
 	ErrIllegalTaggedMessage = errors.New("illegal tagged message")
 	ErrClientKilled         = errors.New("client killed")
 	ErrBadResponseWriter    = errors.New("ResponseWriter Close not supported")
+	ErrNoRouteMatched       = errors.New("no route matched for virtual topic")
+	ErrNoEndpoint           = errors.New("no endpoint")
+	ErrInvalidSpoolKey      = errors.New("invalid spool key")
+	ErrUndefinedCluster     = errors.New("undefined cluster")
+	ErrBrowserTokenDisabled = errors.New("browser token not enabled")
+	ErrInvalidBrowserToken  = errors.New("invalid browser token")
+	ErrBrowserTokenScope    = errors.New("topic not permitted by browser token")
+	ErrInvalidResumeToken   = errors.New("invalid resume token")
+	ErrResumeTokenScope     = errors.New("resume token of another topic or group")
+	ErrPubDelayDisabled     = errors.New("delayed Pub not enabled")
+	ErrInvalidPubDelay      = errors.New("invalid delay")
+	ErrTooLongPubDelay      = errors.New("too long delay")
+	ErrInvalidPartition     = errors.New("invalid partition")
+	ErrInvalidOffset        = errors.New("invalid offset")
+	ErrGroupOnline          = errors.New("group has online consumers")
 )
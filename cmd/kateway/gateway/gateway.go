@@ -3,6 +3,7 @@ package gateway
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"runtime"
@@ -29,6 +30,7 @@ import (
 	"github.com/funkygao/gafka/cmd/kateway/store"
 	storedummy "github.com/funkygao/gafka/cmd/kateway/store/dummy"
 	storekfk "github.com/funkygao/gafka/cmd/kateway/store/kafka"
+	"github.com/funkygao/gafka/cmd/kateway/transform"
 	"github.com/funkygao/gafka/ctx"
 	"github.com/funkygao/gafka/registry"
 	"github.com/funkygao/gafka/registry/zk"
@@ -46,9 +48,23 @@ import (
 type Gateway struct {
 	id string // must be unique across the zone
 
-	zkzone       *gzk.ZkZone // load/resume/flush counter metrics to zk
-	svrMetrics   *serverMetrics
-	accessLogger *AccessLogger
+	zkzone        *gzk.ZkZone // load/resume/flush counter metrics to zk
+	svrMetrics    *serverMetrics
+	accessLogger  *AccessLogger
+	slowLogger    *AccessLogger
+	inflight      *inflightRequests
+	debugTraces   *debugTraces
+	maintenance   *maintenance
+	pubShedder    *pubShedder
+	clients       *clientVersions
+	readiness     *readinessProbe
+	tracer        io.Closer // zipkin collector
+	transforms    *transformPipeline
+	avroJson      *avroJsonDecoder
+	spooler       *subSpooler // nil if spool disabled
+	cors          *corsPolicy
+	browserTokens *browserTokens // nil if browser token disabled
+	resumeTokens  *resumeTokens  // nil if Sub resume token disabled
 
 	shutdownOnce        sync.Once
 	shutdownCh, quiting chan struct{}
@@ -70,9 +86,11 @@ func New(id string) *Gateway {
 		quiting:    make(chan struct{}),
 		certFile:   Options.CertFile,
 		keyFile:    Options.KeyFile,
+		transforms: newTransformPipeline(),
+		avroJson:   newAvroJsonDecoder(),
 	}
 
-	this.zkzone = gzk.NewZkZone(gzk.DefaultConfig(Options.Zone, ctx.ZoneZkAddrs(Options.Zone)))
+	this.zkzone = gzk.NewSharedZkZone(gzk.DefaultConfig(Options.Zone, ctx.ZoneZkAddrs(Options.Zone)))
 	if err := this.zkzone.Ping(); err != nil {
 		panic(err)
 	}
@@ -84,6 +102,31 @@ func New(id string) *Gateway {
 	metaConf.Refresh = Options.MetaRefresh
 	meta.Default = zkmeta.New(metaConf, this.zkzone)
 	this.accessLogger = NewAccessLogger("access_log", 100)
+	this.slowLogger = NewAccessLogger("slow_log", 100)
+	this.inflight = newInflightRequests()
+	this.debugTraces = newDebugTraces()
+	this.maintenance = newMaintenance()
+	this.pubShedder = newPubShedder(Options.ShedErrRate, Options.ShedLatency, Options.ShedStep,
+		func(appid string) manager.Priority { return manager.Default.AppPriority(appid) })
+	this.clients = newClientVersions()
+	this.readiness = newReadinessProbe(this)
+	this.cors = newCorsPolicy(Options.CorsOrigins)
+	upgrader.CheckOrigin = this.cors.checkOrigin
+	if Options.BrowserTokenTTL > 0 {
+		var err error
+		if this.browserTokens, err = newBrowserTokens(Options.BrowserTokenTTL); err != nil {
+			panic(BrowserTokenSecret + ": " + err.Error())
+		}
+	}
+	if Options.SubResumeTTL > 0 {
+		var err error
+		if this.resumeTokens, err = newResumeTokens(Options.SubResumeTTL); err != nil {
+			panic(ResumeTokenSecret + ": " + err.Error())
+		}
+	}
+	if err := this.clients.setPolicy(Options.MinClientVersion, Options.DeprecatedClientVersion); err != nil {
+		panic(err)
+	}
 	this.svrMetrics = NewServerMetrics(Options.ReporterInterval, this)
 	rc, err := influxdb.NewConfig(Options.InfluxServer, Options.InfluxDbName, "", "", Options.ReporterInterval)
 	if err != nil {
@@ -92,11 +135,27 @@ func New(id string) *Gateway {
 		telemetry.Default = influxdb.New(metrics.DefaultRegistry, rc)
 	}
 
+	if tracingEnabled() {
+		collector, err := setupTracer(Options.PubHttpAddr)
+		if err != nil {
+			panic(err)
+		}
+
+		this.tracer = collector
+	}
+
+	if Options.TransformPluginDir != "" {
+		if err := transform.LoadPlugins(Options.TransformPluginDir); err != nil {
+			panic(err)
+		}
+	}
+
 	// initialize the manager store
 	switch Options.ManagerStore {
 	case "mysql":
 		cf := mandb.DefaultConfig(Options.Zone)
 		cf.Refresh = Options.ManagerRefresh
+		cf.SnapshotFile = Options.ManagerSnapshot
 		manager.Default = mandb.New(cf)
 		manager.Default.AllowSubWithUnregisteredGroup(Options.PermitUnregisteredGroup)
 
@@ -132,7 +191,11 @@ func New(id string) *Gateway {
 
 		switch Options.Store {
 		case "kafka":
-			store.DefaultPubStore = storekfk.NewPubStore(Options.PubPoolCapcity, Options.PubPoolIdleTimeout,
+			poolConfigs, err := kafkaPoolConfigs()
+			if err != nil {
+				panic(err)
+			}
+			store.DefaultPubStore = storekfk.NewPubStore(poolConfigs, Options.PubPoolIdleTimeout,
 				Options.UseCompress, Options.Debug, Options.DryRun)
 
 		case "dummy":
@@ -174,12 +237,28 @@ func New(id string) *Gateway {
 			}
 			cfg := hhdisk.DefaultConfig()
 			cfg.Dirs = strings.Split(Options.HintedHandoffDir, ",")
-			if err := cfg.Validate(); err != nil {
+			cfg.EncryptKeyId = uint32(Options.HintedHandoffKeyId)
+			cfg.ReadAhead = Options.HintedHandoffReadAhead
+			cfg.Format = uint8(Options.HintedHandoffFormat)
+			cfg.MigrateOnRead = !Options.HintedHandoffNoMigrate
+			if Options.HintedHandoffBufio {
+				cfg.WriteBuffer = 4 << 10
+			}
+			readAheads, err := parseQueueReadAheads(Options.HintedHandoffReadAheads)
+			if err != nil {
+				panic(err)
+			}
+			cfg.QueueReadAhead = readAheads
+			if cfg.Policy, err = parseHhPolicy(Options.HintedHandoffPolicy); err != nil {
+				panic(err)
+			}
+			hhdisk.BatchWrite = Options.HintedHandoffBatch
+			if err = cfg.Validate(); err != nil {
 				panic(err)
 			}
-			hhdisk.DisableBufio = !Options.HintedHandoffBufio
 			if Options.AuditPub {
 				hhdisk.Auditor = &this.pubServer.auditor
+				hhdisk.AuditJSON = Options.HintedHandoffAuditJSON
 			}
 			hh.Default = hhdisk.New(cfg)
 
@@ -209,7 +288,11 @@ func New(id string) *Gateway {
 
 		switch Options.Store {
 		case "kafka":
-			store.DefaultSubStore = storekfk.NewSubStore(this.subServer.closedConnCh, Options.Debug)
+			subStore := storekfk.NewSubStore(this.subServer.closedConnCh, Options.SubPrefetch, Options.Debug)
+			if Options.SubPartner != "" {
+				subStore.CheckpointSessions(this.id, this.zkzone, Options.SubCheckpointInterval)
+			}
+			store.DefaultSubStore = subStore
 
 		case "dummy":
 			store.DefaultSubStore = storedummy.NewSubStore(this.subServer.closedConnCh, Options.Debug)
@@ -218,6 +301,10 @@ func New(id string) *Gateway {
 			panic("invalid store")
 
 		}
+
+		if Options.SubSpoolDir != "" {
+			this.spooler = newSubSpooler(this, Options.SubSpoolDir, Options.SubSpoolMaxAge)
+		}
 	}
 
 	return this
@@ -267,10 +354,18 @@ func (this *Gateway) Start() (err error) {
 	meta.Default.Start()
 	log.Trace("meta store[%s] started", meta.Default.Name())
 
+	if errs := this.checkDependencies(); len(errs) > 0 && Options.StrictStartup {
+		return errs[0]
+	}
+
 	if err = manager.Default.Start(); err != nil {
 		return
 	}
-	log.Trace("manager store[%s] started", manager.Default.Name())
+	if managerDegraded() {
+		log.Warn("manager store[%s] started in degraded mode", manager.Default.Name())
+	} else {
+		log.Trace("manager store[%s] started", manager.Default.Name())
+	}
 
 	if telemetry.Default != nil {
 		go func() {
@@ -287,6 +382,10 @@ func (this *Gateway) Start() (err error) {
 			log.Error("access logger: %s", err)
 		}
 	}
+	// slow log can be turned on at runtime
+	if err = this.slowLogger.Start(); err != nil {
+		log.Error("slow logger: %s", err)
+	}
 
 	this.buildRouting()
 
@@ -312,6 +411,11 @@ func (this *Gateway) Start() (err error) {
 		log.Trace("job store[%s] started", job.Default.Name())
 
 		this.pubServer.Start()
+
+		if this.pubShedder.enabled() {
+			this.wg.Add(1)
+			go this.runPubShedder()
+		}
 	}
 	if this.subServer != nil {
 		if err = store.DefaultSubStore.Start(); err != nil {
@@ -320,6 +424,16 @@ func (this *Gateway) Start() (err error) {
 		log.Trace("sub store[%s] started", store.DefaultSubStore.Name())
 
 		this.subServer.Start()
+
+		if this.spooler != nil {
+			this.wg.Add(1)
+			go this.spooler.run()
+		}
+
+		if Options.SubPartner != "" && Options.Store == "kafka" {
+			this.wg.Add(1)
+			go this.watchPartner(Options.SubPartner)
+		}
 	}
 
 	// the last thing is to register: notify others: come on baby!
@@ -369,6 +483,8 @@ func (this *Gateway) ServeForever() {
 			log.Trace("stopping access logger")
 			this.accessLogger.Stop()
 		}
+		log.Trace("stopping slow logger")
+		this.slowLogger.Stop()
 
 		// FIXME because the pub_server didn't close the idle conns, if now
 		// an idle client POST a message, will lead to panic: nil pointer
@@ -397,6 +513,12 @@ func (this *Gateway) ServeForever() {
 			log.Trace("telemetry[%s] stopped", telemetry.Default.Name())
 		}
 
+		if this.tracer != nil {
+			// flush the pending spans
+			this.tracer.Close()
+			log.Trace("tracer stopped")
+		}
+
 		meta.Default.Stop()
 		log.Trace("meta store[%s] stopped", meta.Default.Name())
 
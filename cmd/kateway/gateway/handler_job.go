@@ -14,7 +14,8 @@ import (
 )
 
 //go:generate goannotation $GOFILE
-// @rest POST /v1/jobs/:topic/:ver?delay=100|due=1471565204
+// @rest POST /v1/jobs/:topic/:ver?delay=100|due=1471565204&priority=0
+// priority is 0-9, jobs of higher priority due at the same time fire first.
 // TODO tag, partitionKey
 // TODO use dedicated metrics
 func (this *pubServer) addJobHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
@@ -59,6 +60,19 @@ func (this *pubServer) addJobHandler(w http.ResponseWriter, r *http.Request, par
 		return
 	}
 
+	priority := job.MinPriority
+	if priorityParam := q.Get("priority"); priorityParam != "" {
+		p, err := strconv.Atoi(priorityParam)
+		if err != nil || p < job.MinPriority || p > job.MaxPriority {
+			log.Error("+job[%s] %s(%s) priority:%s invalid", appid, r.RemoteAddr, realIp, priorityParam)
+
+			writeBadRequest(w, "invalid priority param")
+			return
+		}
+
+		priority = p
+	}
+
 	if Options.Ratelimit && !this.throttlePub.Pour(realIp, 1) {
 		log.Warn("+job[%s] %s(%s) rate limit reached", appid, r.RemoteAddr, realIp)
 
@@ -110,8 +124,8 @@ func (this *pubServer) addJobHandler(w http.ResponseWriter, r *http.Request, par
 		return
 	}
 
-	log.Debug("+job[%s] %s(%s) {topic:%s, ver:%s} due:%d/%ds",
-		appid, r.RemoteAddr, realIp, topic, ver, due, due-t1.Unix())
+	log.Debug("+job[%s] %s(%s) {topic:%s, ver:%s} due:%d/%ds priority:%d",
+		appid, r.RemoteAddr, realIp, topic, ver, due, due-t1.Unix(), priority)
 
 	if !Options.DisableMetrics {
 		this.pubMetrics.JobQps.Mark(1)
@@ -129,7 +143,7 @@ func (this *pubServer) addJobHandler(w http.ResponseWriter, r *http.Request, par
 		return
 	}
 
-	jobId, err := job.Default.Add(appid, manager.Default.KafkaTopic(appid, topic, ver), msg.Body, due)
+	jobId, err := job.Default.Add(appid, manager.Default.KafkaTopic(appid, topic, ver), msg.Body, due, priority)
 	msg.Free()
 	if err != nil {
 		if !Options.DisableMetrics {
@@ -143,8 +157,8 @@ func (this *pubServer) addJobHandler(w http.ResponseWriter, r *http.Request, par
 	}
 
 	if Options.AuditPub {
-		this.auditor.Trace("+job[%s] %s(%s) {topic:%s ver:%s UA:%s} due:%d id:%s",
-			appid, r.RemoteAddr, realIp, topic, ver, r.Header.Get("User-Agent"), due, jobId)
+		this.auditor.Trace("+job[%s] %s(%s) {topic:%s ver:%s UA:%s} due:%d priority:%d id:%s",
+			appid, r.RemoteAddr, realIp, topic, ver, r.Header.Get("User-Agent"), due, priority, jobId)
 	}
 
 	w.Header().Set(HttpHeaderJobId, jobId)
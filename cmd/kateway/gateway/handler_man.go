@@ -3,6 +3,7 @@ package gateway
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"runtime"
@@ -67,6 +68,9 @@ func (this *manServer) statusHandler(w http.ResponseWriter, r *http.Request, par
 	output["subconn"] = strconv.Itoa(subConns)
 	output["hh_appends"] = strconv.FormatInt(hh.Default.AppendN(), 10)
 	output["hh_delivers"] = strconv.FormatInt(hh.Default.DeliverN(), 10)
+	if p, ok := hh.Default.(hh.Policer); ok {
+		output["hh_policy"] = p.Policy()
+	}
 	output["goroutines"] = strconv.Itoa(runtime.NumGoroutine())
 
 	var mem runtime.MemStats
@@ -82,6 +86,35 @@ func (this *manServer) statusHandler(w http.ResponseWriter, r *http.Request, par
 	w.Write(b)
 }
 
+// @rest GET /v1/inflight?age=1s
+// dump requests inflight longer than age, the oldest first
+// response: [{"method":"GET","uri":"/v1/msgs/app1/foobar/v1?group=g1","appid":"app2","remote":"10.1.1.1","age":"35.2s"}]
+func (this *manServer) inflightHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous inflight call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, getHttpRemoteIp(r), appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	var minAge time.Duration
+	if age := r.URL.Query().Get("age"); age != "" {
+		var err error
+		if minAge, err = time.ParseDuration(age); err != nil {
+			writeBadRequest(w, "invalid age")
+			return
+		}
+	}
+
+	log.Info("inflight[%s] %s(%s) age:%s", appid, r.RemoteAddr, getHttpRemoteIp(r), minAge)
+
+	b, _ := json.Marshal(this.gw.inflight.dump(minAge))
+	w.Write(b)
+}
+
 // @rest GET /v1/clusters
 func (this *manServer) clustersHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	log.Info("clusters %s(%s)", r.RemoteAddr, getHttpRemoteIp(r))
@@ -222,10 +255,78 @@ func (this *manServer) setOptionHandler(w http.ResponseWriter, r *http.Request,
 	}
 
 	log.Info("option %s(%s) %s to %s, %#v", r.RemoteAddr, getHttpRemoteIp(r), option, value, Options)
+	this.auditor.Info("option %s(%s) %s to %s", r.RemoteAddr, getHttpRemoteIp(r), option, value)
 
 	w.Write(ResponseOk)
 }
 
+// @rest GET /v1/options
+func (this *manServer) getOptionsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+	realIp := getHttpRemoteIp(r)
+
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous get options call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, realIp, appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	log.Info("get options[%s] %s(%s)", appid, r.RemoteAddr, realIp)
+
+	b, _ := json.MarshalIndent(runtimeOptionValues(), "", "    ")
+	w.Write(b)
+}
+
+// @rest PUT /v1/options
+// body: {"gzip": false, "level": "debug"}
+func (this *manServer) putOptionsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+	realIp := getHttpRemoteIp(r)
+
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous put options call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, realIp, appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	var body map[string]interface{}
+	decoder := json.NewDecoder(io.LimitReader(r.Body, 64<<10))
+	decoder.UseNumber() // keep numbers literal
+	if err := decoder.Decode(&body); err != nil {
+		writeBadRequest(w, "invalid json body")
+		return
+	}
+
+	values := make(map[string]string, len(body))
+	for name, v := range body {
+		values[name] = fmt.Sprint(v)
+	}
+
+	old := runtimeOptionValues()
+	changed, err := setRuntimeOptions(this.gw, values)
+	if err != nil {
+		log.Warn("put options[%s] %s(%s) %+v: %v", appid, r.RemoteAddr, realIp, values, err)
+
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	current := runtimeOptionValues()
+	for _, name := range changed {
+		log.Info("put options[%s] %s(%s) %s: %v -> %v", appid, r.RemoteAddr, realIp, name, old[name], current[name])
+		this.auditor.Info("put options[%s] %s(%s) %s: %v -> %v", appid, r.RemoteAddr, realIp, name, old[name], current[name])
+	}
+
+	b, _ := json.MarshalIndent(current, "", "    ")
+	w.Write(b)
+}
+
 // @rest GET /v1/partitions/:appid/:topic/:ver
 func (this *manServer) partitionsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	topic := params.ByName(UrlParamTopic)
@@ -286,6 +387,7 @@ func (this *manServer) partitionsHandler(w http.ResponseWriter, r *http.Request,
 }
 
 // @rest PUT /v1/webhook/:appid/:topic/:ver?group=xx
+// body: {"endpoints": ["http://host/hook"], "retry_chain": "5s,1m,10m"}, retry_chain is optional.
 func (this *manServer) createWebhookHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	topic := params.ByName(UrlParamTopic)
 	if !manager.Default.ValidateTopicName(topic) {
@@ -347,6 +449,32 @@ func (this *manServer) createWebhookHandler(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
+	if hook.RetryChain != "" {
+		chain, err := sla.ParseRetryChain(hook.RetryChain)
+		if err != nil {
+			log.Error("+webhook[%s/%s] %s(%s): {%s.%s.%s UA:%s} retry:%s %v",
+				myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"), hook.RetryChain, err)
+
+			writeBadRequest(w, err.Error())
+			return
+		}
+
+		// failed pushes hop through rawTopic.retry.5s... and land in rawTopic.dead
+		err = this.createRetryStages(cluster, hisAppid, chain.Topics(rawTopic), sla.DefaultSla())
+		if err == nil {
+			err = ensureTopic(cluster, rawTopic+"."+sla.SlaKeyDeadLetterTopic, sla.DefaultSla())
+		}
+		if err != nil {
+			log.Error("+webhook[%s/%s] %s(%s): {%s.%s.%s UA:%s} retry:%s %v",
+				myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"), hook.RetryChain, err)
+
+			writeServerError(w, err.Error())
+			return
+		}
+
+		hook.RetryChain = chain.String()
+	}
+
 	hook.Cluster = cluster // cluster is decided by server
 	if err := this.gw.zkzone.CreateOrUpdateWebhook(rawTopic, hook); err != nil {
 		log.Error("+webhook[%s/%s] %s(%s): {%s.%s.%s UA:%s} %v",
@@ -546,6 +674,13 @@ func (this *manServer) createTopicHandler(w http.ResponseWriter, r *http.Request
 		appid, r.RemoteAddr, realIp, hisAppid, cluster, topic, ver, query.Encode())
 
 	rawTopic := manager.Default.KafkaTopic(hisAppid, topic, ver)
+	if err := this.topicNaming.Validate(rawTopic); err != nil {
+		log.Warn("app[%s] %s(%s) create topic: %v", appid, r.RemoteAddr, realIp, err)
+
+		writeBadRequest(w, err.Error())
+		return
+	}
+
 	lines, err := zkcluster.AddTopic(rawTopic, ts)
 	if err != nil {
 		log.Error("app[%s] %s(%s) create topic[%s]: %s", appid, r.RemoteAddr, realIp, rawTopic, err.Error())
@@ -588,6 +723,30 @@ func (this *manServer) createTopicHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// @rest GET /v1/naming/:appid/:topic/:ver
+// validates the topic against the naming templates of the zone before creating it
+func (this *manServer) topicNamingHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	topic := params.ByName(UrlParamTopic)
+	if !manager.Default.ValidateTopicName(topic) {
+		writeBadRequest(w, "illegal topic")
+		return
+	}
+
+	rawTopic := manager.Default.KafkaTopic(params.ByName(UrlParamAppid), topic, params.ByName(UrlParamVersion))
+	v := map[string]interface{}{
+		"topic":     rawTopic,
+		"valid":     true,
+		"templates": this.topicNaming.Templates(),
+	}
+	if err := this.topicNaming.Validate(rawTopic); err != nil {
+		v["valid"] = false
+		v["reason"] = err.Error()
+	}
+
+	b, _ := json.Marshal(v)
+	w.Write(b)
+}
+
 // @rest PUT /v1/topics/:appid/:topic/:ver?partitions=1&retention.hours=72&retention.bytes=-1
 func (this *manServer) alterTopicHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	topic := params.ByName(UrlParamTopic)
@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/httprouter"
+	log "github.com/funkygao/log4go"
+)
+
+// @rest POST /v1/browser/tokens?group=xx&topics=appid/topic/ver,appid/topic/ver
+// The web backend calls with its Appid and Subkey to get a short lived token for its web frontend,
+// which Sub the scoped topics as the group from the browser with header Authorization: Bearer {token}
+// or query token={token} for EventSource and WebSocket.
+// response: {"token":"xx","expires":1488888888}
+func (this *manServer) browserTokenHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var (
+		myAppid = r.Header.Get(HttpHeaderAppid)
+		subkey  = r.Header.Get(HttpHeaderSubkey)
+		query   = r.URL.Query()
+		group   = query.Get("group")
+		realIp  = getHttpRemoteIp(r)
+	)
+
+	if this.gw.browserTokens == nil {
+		writeBadRequest(w, ErrBrowserTokenDisabled.Error())
+		return
+	}
+
+	if !manager.Default.ValidateGroupName(r.Header, group) {
+		writeBadRequest(w, "illegal group")
+		return
+	}
+
+	topics := strings.Split(query.Get("topics"), ",")
+	if len(topics) > maxBrowserTokenTopics {
+		writeBadRequest(w, "too many topics")
+		return
+	}
+
+	// the token grants no more than what the appid can Sub
+	for _, t := range topics {
+		tuples := strings.Split(t, "/")
+		if len(tuples) != 3 {
+			writeBadRequest(w, "illegal topics")
+			return
+		}
+
+		hisAppid, topic := tuples[0], tuples[1]
+		if err := manager.Default.AuthSub(myAppid, subkey, hisAppid, topic, group); err != nil {
+			log.Error("browser token[%s/%s] %s(%s): {%s UA:%s} %v",
+				myAppid, group, r.RemoteAddr, realIp, t, r.Header.Get("User-Agent"), err)
+
+			writeAuthFailure(w, err)
+			return
+		}
+	}
+
+	token, expires, err := this.gw.browserTokens.issue(myAppid, group, topics, time.Now())
+	if err != nil {
+		log.Error("browser token[%s/%s] %s(%s): %v", myAppid, group, r.RemoteAddr, realIp, err)
+
+		writeServerError(w, err.Error())
+		return
+	}
+
+	log.Info("browser token[%s/%s] %s(%s): %+v expires %s", myAppid, group, r.RemoteAddr, realIp, topics, expires)
+
+	b, _ := json.Marshal(map[string]interface{}{
+		"token":   token,
+		"expires": expires.Unix(),
+	})
+	w.Write(b)
+}
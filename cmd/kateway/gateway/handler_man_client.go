@@ -0,0 +1,29 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/httprouter"
+	log "github.com/funkygao/log4go"
+)
+
+//go:generate goannotation $GOFILE
+// @rest GET /v1/versions?appid=xx
+// client version inventory by appid as reported by header X-Client-Version, all apps if appid is empty
+// response: {"app1":[{"version":"pubsub-go/0.2.1","requests":1024,"first_seen":"2017-03-01T10:00:00+08:00","last_seen":"2017-03-02T10:00:00+08:00"}]}
+func (this *manServer) clientVersionsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous client versions call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, getHttpRemoteIp(r), appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	b, _ := json.Marshal(this.gw.clients.inventory(r.URL.Query().Get("appid")))
+	w.Write(b)
+}
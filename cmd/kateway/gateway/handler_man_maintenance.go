@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/hh"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/httprouter"
+	log "github.com/funkygao/log4go"
+)
+
+//go:generate goannotation $GOFILE
+// @rest GET /v1/maintenance
+// response: {"on":true,"since":"2017-03-01T10:00:00+08:00","retry_after":"30s","redirect":"10.1.1.2:9191","reason":"migrate","rejected":35,"hh_inflights":0}
+func (this *manServer) maintenanceHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	info := this.gw.maintenance.info()
+	if hh.Default != nil {
+		info.HhInflights = hh.Default.Inflights()
+	}
+
+	b, _ := json.Marshal(info)
+	w.Write(b)
+}
+
+// @rest PUT /v1/maintenance?retry=30s&redirect=host:port&reason=xx
+// reject Pub with 503 and Retry-After, optionally pointing clients to the redirect kateway
+// Sub and hh flushing go on, so that the cluster can be migrated cleanly
+func (this *manServer) enterMaintenanceHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+	realIp := getHttpRemoteIp(r)
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous enter maintenance call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, realIp, appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	q := r.URL.Query()
+	retryAfter := maintenanceDefaultRetryAfter
+	if s := q.Get("retry"); s != "" {
+		var err error
+		if retryAfter, err = time.ParseDuration(s); err != nil ||
+			retryAfter < time.Second || retryAfter > maintenanceMaxRetryAfter {
+			writeBadRequest(w, "invalid retry")
+			return
+		}
+	}
+
+	redirect, reason := q.Get("redirect"), q.Get("reason")
+	this.gw.maintenance.enter(retryAfter, redirect, reason)
+
+	log.Warn("maintenance[%s] %s(%s) entered {retry:%s redirect:%s reason:%s}",
+		appid, r.RemoteAddr, realIp, retryAfter, redirect, reason)
+	this.auditor.Info("maintenance[%s] %s(%s) entered {retry:%s redirect:%s reason:%s}",
+		appid, r.RemoteAddr, realIp, retryAfter, redirect, reason)
+
+	w.Write(ResponseOk)
+}
+
+// @rest DELETE /v1/maintenance
+// resume Pub
+func (this *manServer) exitMaintenanceHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+	realIp := getHttpRemoteIp(r)
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous exit maintenance call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, realIp, appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	if !this.gw.maintenance.exit() {
+		writeBadRequest(w, "not in maintenance")
+		return
+	}
+
+	log.Info("maintenance[%s] %s(%s) exited", appid, r.RemoteAddr, realIp)
+	this.auditor.Info("maintenance[%s] %s(%s) exited", appid, r.RemoteAddr, realIp)
+
+	w.Write(ResponseOk)
+}
@@ -2,9 +2,11 @@ package gateway
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/funkygao/gafka/cmd/kateway/hh"
 	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/cmd/kateway/meta"
 	"github.com/funkygao/gafka/cmd/kateway/store"
@@ -45,3 +47,123 @@ func (this *manServer) pubRawHandler(w http.ResponseWriter, r *http.Request, par
 	b, _ := json.Marshal(out)
 	w.Write(b)
 }
+
+// @rest GET /v1/hh/:appid/:topic/:ver
+// downloads the hinted handoff queue snapshot of a topic on this kateway in tar format
+func (this *manServer) hhSnapshotHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	ver := params.ByName(UrlParamVersion)
+	topic := params.ByName(UrlParamTopic)
+	hisAppid := params.ByName(UrlParamAppid)
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+	realIp := getHttpRemoteIp(r)
+
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous hh snapshot call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, realIp, appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	snapshotter, ok := hh.Default.(hh.Snapshotter)
+	if !ok {
+		writeBadRequest(w, "hh snapshot not supported")
+		return
+	}
+
+	cluster, found := manager.Default.LookupCluster(hisAppid)
+	if !found {
+		writeBadRequest(w, "invalid appid")
+		return
+	}
+
+	kafkaTopic := manager.Default.KafkaTopic(hisAppid, topic, ver)
+	log.Info("hh snapshot[%s] %s(%s) {cluster:%s topic:%s}", appid, r.RemoteAddr, realIp, cluster, kafkaTopic)
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s.tar"`, cluster, kafkaTopic))
+	if err := snapshotter.Snapshot(cluster, kafkaTopic, w); err != nil {
+		// if the archive is partially sent, the client gets a truncated tar
+		log.Error("hh snapshot[%s] %s(%s) {cluster:%s topic:%s} %v", appid, r.RemoteAddr, realIp, cluster, kafkaTopic, err)
+
+		writeBadRequest(w, err.Error())
+	}
+}
+
+// @rest GET /v1/hhpolicy
+// response: {"cluster1/*":false,"cluster1/topic1":true}
+func (this *manServer) hhPolicyHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	policer, ok := hh.Default.(hh.Policer)
+	if !ok {
+		writeBadRequest(w, "hh policy not supported")
+		return
+	}
+
+	b, _ := json.Marshal(policer.Policy())
+	w.Write(b)
+}
+
+// @rest PUT /v1/hhpolicy/:cluster/:topic/:state
+// state is on or off, topic * for all topics of the cluster. Pub of off topics fails fast
+// instead of resorting to hinted handoff. Not persisted, use -hhpolicy for that.
+func (this *manServer) setHhPolicyHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	cluster := params.ByName("cluster")
+	topic := params.ByName("topic")
+	state := params.ByName("state")
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+	realIp := getHttpRemoteIp(r)
+
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous hh policy call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, realIp, appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	policer, ok := hh.Default.(hh.Policer)
+	if !ok {
+		writeBadRequest(w, "hh policy not supported")
+		return
+	}
+
+	if state != "on" && state != "off" {
+		writeBadRequest(w, "invalid state")
+		return
+	}
+
+	log.Info("hh policy[%s] %s(%s) {cluster:%s topic:%s state:%s}", appid, r.RemoteAddr, realIp, cluster, topic, state)
+
+	policer.SetPolicy(cluster, topic, state == "on")
+	w.Write(ResponseOk)
+}
+
+// @rest DELETE /v1/hhpolicy/:cluster/:topic
+func (this *manServer) resetHhPolicyHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	cluster := params.ByName("cluster")
+	topic := params.ByName("topic")
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+	realIp := getHttpRemoteIp(r)
+
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous hh policy call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, realIp, appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	policer, ok := hh.Default.(hh.Policer)
+	if !ok {
+		writeBadRequest(w, "hh policy not supported")
+		return
+	}
+
+	log.Info("hh policy[%s] %s(%s) {cluster:%s topic:%s} reset", appid, r.RemoteAddr, realIp, cluster, topic)
+
+	policer.ResetPolicy(cluster, topic)
+	w.Write(ResponseOk)
+}
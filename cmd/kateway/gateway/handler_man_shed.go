@@ -0,0 +1,17 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/funkygao/httprouter"
+)
+
+//go:generate goannotation $GOFILE
+// @rest GET /v1/shed
+// Pub admission control: how much Pub of each priority is shed with 503 while the brokers degrade
+// response: {"enabled":true,"level":130,"since":"2017-03-01T10:00:00+08:00","percent":{"bulk":100,"normal":30},"shed":{"bulk":5312,"normal":874},"err_rate":0.21,"latency":"850ms","max_err_rate":0.2,"max_latency":"0s"}
+func (this *manServer) pubShedHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	b, _ := json.Marshal(this.gw.pubShedder.info())
+	w.Write(b)
+}
@@ -0,0 +1,191 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/httprouter"
+	log "github.com/funkygao/log4go"
+)
+
+// spoolParams authenticates the spool api call and returns the registration identity.
+func (this *manServer) spoolParams(w http.ResponseWriter, r *http.Request, params httprouter.Params,
+	op string) (cluster, rawTopic, group string, ok bool) {
+	var (
+		topic    = params.ByName(UrlParamTopic)
+		ver      = params.ByName(UrlParamVersion)
+		hisAppid = params.ByName(UrlParamAppid)
+		myAppid  = r.Header.Get(HttpHeaderAppid)
+		realIp   = getHttpRemoteIp(r)
+	)
+	group = params.ByName(UrlParamGroup)
+
+	if this.gw.spooler == nil {
+		writeBadRequest(w, "spool not enabled")
+		return
+	}
+
+	if !manager.Default.ValidateGroupName(r.Header, group) {
+		writeBadRequest(w, "illegal group")
+		return
+	}
+
+	if err := manager.Default.AuthSub(myAppid, r.Header.Get(HttpHeaderSubkey),
+		hisAppid, topic, group); err != nil {
+		log.Error("%s spool[%s/%s] %s(%s): {%s.%s.%s UA:%s} %v",
+			op, myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"), err)
+
+		writeAuthFailure(w, err)
+		return
+	}
+
+	cluster, found := manager.Default.LookupCluster(hisAppid)
+	if !found {
+		log.Error("%s spool[%s/%s] %s(%s): {%s.%s.%s UA:%s} undefined cluster",
+			op, myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"))
+
+		writeBadRequest(w, "invalid appid")
+		return
+	}
+
+	log.Info("%s spool[%s/%s] %s(%s): {%s.%s.%s UA:%s}",
+		op, myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"))
+	this.auditor.Info("%s spool[%s/%s] %s(%s): {%s.%s.%s}",
+		op, myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver)
+
+	return cluster, manager.Default.KafkaTopic(hisAppid, topic, ver), myAppid + "." + group, true
+}
+
+// @rest PUT /v1/spools/:appid/:topic/:ver/:group
+// body: {"endpoints":["http://host/path"]}
+// kateway consumes the topic on behalf of the group and spools messages to local disk
+// before POST them to the endpoints.
+func (this *manServer) createSpoolHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	cluster, rawTopic, group, ok := this.spoolParams(w, r, params, "+")
+	if !ok {
+		return
+	}
+
+	var meta zk.SpoolMeta
+	if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	r.Body.Close()
+
+	if len(meta.Endpoints) == 0 {
+		writeBadRequest(w, "empty endpoints")
+		return
+	}
+	for _, ep := range meta.Endpoints {
+		if _, err := url.ParseRequestURI(ep); err != nil {
+			writeBadRequest(w, err.Error())
+			return
+		}
+	}
+
+	old, err := this.gw.zkzone.Spool(cluster, rawTopic, group)
+	if err != nil {
+		writeServerError(w, err.Error())
+		return
+	}
+
+	// cluster, topic and group are decided by server
+	meta.Cluster, meta.Topic, meta.Group = cluster, rawTopic, group
+	meta.By = r.Header.Get(HttpHeaderAppid)
+	meta.Ctime = time.Now()
+	meta.ReplayAt, meta.ReplaySince = time.Time{}, time.Time{}
+	if old != nil {
+		meta.Ctime = old.Ctime
+		meta.ReplayAt, meta.ReplaySince = old.ReplayAt, old.ReplaySince
+	}
+
+	if err = this.gw.zkzone.CreateOrUpdateSpool(meta); err != nil {
+		writeServerError(w, err.Error())
+		return
+	}
+
+	this.gw.spooler.refresh()
+	w.Write(ResponseOk)
+}
+
+// @rest DELETE /v1/spools/:appid/:topic/:ver/:group
+// undelivered spooled messages are discarded
+func (this *manServer) deleteSpoolHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	cluster, rawTopic, group, ok := this.spoolParams(w, r, params, "-")
+	if !ok {
+		return
+	}
+
+	if err := this.gw.zkzone.DeleteSpool(cluster, rawTopic, group); err != nil {
+		writeServerError(w, err.Error())
+		return
+	}
+
+	this.gw.spooler.refresh()
+	w.Write(ResponseOk)
+}
+
+// @rest PUT /v1/spools/:appid/:topic/:ver/:group/replay?since=1h
+// each kateway forwards again its spooled messages since then that are still on disk
+func (this *manServer) replaySpoolHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	since, err := time.ParseDuration(r.URL.Query().Get("since"))
+	if err != nil || since <= 0 {
+		writeBadRequest(w, "invalid since")
+		return
+	}
+
+	cluster, rawTopic, group, ok := this.spoolParams(w, r, params, "replay")
+	if !ok {
+		return
+	}
+
+	meta, err := this.gw.zkzone.Spool(cluster, rawTopic, group)
+	if err != nil {
+		writeServerError(w, err.Error())
+		return
+	}
+	if meta == nil {
+		writeBadRequest(w, "spool not found")
+		return
+	}
+
+	meta.ReplayAt = time.Now()
+	meta.ReplaySince = meta.ReplayAt.Add(-since)
+	meta.By = r.Header.Get(HttpHeaderAppid)
+	if err = this.gw.zkzone.CreateOrUpdateSpool(*meta); err != nil {
+		writeServerError(w, err.Error())
+		return
+	}
+
+	this.gw.spooler.refresh()
+	w.Write(ResponseOk)
+}
+
+// @rest GET /v1/spools
+// response: {"cluster/topic/group":{"endpoints":["http://host/path"],"inflights":10,"spooled":100,"forwarded":90}}
+// local spools of this kateway
+func (this *manServer) spoolsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous spools call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, getHttpRemoteIp(r), appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	if this.gw.spooler == nil {
+		writeBadRequest(w, "spool not enabled")
+		return
+	}
+
+	b, _ := json.Marshal(this.gw.spooler.status())
+	w.Write(b)
+}
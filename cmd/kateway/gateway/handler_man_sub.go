@@ -3,6 +3,7 @@ package gateway
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/funkygao/gafka/cmd/kateway/meta"
 	"github.com/funkygao/gafka/cmd/kateway/store"
 	"github.com/funkygao/gafka/sla"
+	gzk "github.com/funkygao/gafka/zk"
 	"github.com/funkygao/httprouter"
 	log "github.com/funkygao/log4go"
 	"github.com/samuel/go-zookeeper/zk"
@@ -389,7 +391,9 @@ func (this *manServer) delSubGroupHandler(w http.ResponseWriter, r *http.Request
 	w.Write(ResponseOk)
 }
 
-// @rest POST /v1/shadow/:appid/:topic/:ver/:group?replicas=2
+// @rest POST /v1/shadow/:appid/:topic/:ver/:group?replicas=2&retry=5s,1m,10m
+// retry registers a retry chain: buried or unacked messages hop through the retry stage topics
+// with increasing delays fired by the job subsystem before the dead shadow queue.
 func (this *manServer) addTopicShadowHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	var (
 		topic    string
@@ -439,11 +443,25 @@ func (this *manServer) addTopicShadowHandler(w http.ResponseWriter, r *http.Requ
 		writeBadRequest(w, err.Error())
 		return
 	}
+	var chain sla.RetryChain
+	if retry := query.Get("retry"); retry != "" {
+		if chain, err = sla.ParseRetryChain(retry); err != nil {
+			log.Warn("shadow+ [%s/%s] %s(%s) %s.%s.%s retry:%s %v", myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, retry, err)
+
+			writeBadRequest(w, err.Error())
+			return
+		}
+	}
+
 	zkcluster := meta.Default.ZkCluster(cluster)
 	shadowTopics := []string{
 		manager.Default.ShadowTopic(sla.SlaKeyRetryTopic, myAppid, hisAppid, topic, ver, group),
 		manager.Default.ShadowTopic(sla.SlaKeyDeadLetterTopic, myAppid, hisAppid, topic, ver, group),
 	}
+	if chain != nil && manager.Default.IsShadowedTopic(hisAppid, topic, ver, myAppid, group) {
+		// registered before, only the retry chain is added
+		shadowTopics = nil
+	}
 	for _, t := range shadowTopics {
 		lines, err := zkcluster.AddTopic(t, ts)
 		if err != nil {
@@ -471,6 +489,35 @@ func (this *manServer) addTopicShadowHandler(w http.ResponseWriter, r *http.Requ
 		}
 	}
 
+	if chain != nil {
+		var stages []string
+		for stage := 1; stage <= len(chain); stage++ {
+			stages = append(stages, manager.Default.ShadowTopic(chain.Shadow(stage), myAppid, hisAppid, topic, ver, group))
+		}
+		if err = this.createRetryStages(cluster, hisAppid, stages, ts); err != nil {
+			log.Error("shadow+ [%s/%s] %s(%s) %s.%s.%s retry:%s %v", myAppid, group, r.RemoteAddr, realIp,
+				hisAppid, topic, ver, chain, err)
+
+			writeServerError(w, err.Error())
+			return
+		}
+
+		if err = this.gw.zkzone.CreateOrUpdateRetryChain(gzk.RetryChainMeta{
+			Cluster: cluster,
+			Topic:   manager.Default.KafkaTopic(hisAppid, topic, ver),
+			Group:   myAppid + "." + group,
+			Chain:   chain.String(),
+			Ctime:   time.Now(),
+			By:      realIp,
+		}); err != nil {
+			log.Error("shadow+ [%s/%s] %s(%s) %s.%s.%s retry:%s %v", myAppid, group, r.RemoteAddr, realIp,
+				hisAppid, topic, ver, chain, err)
+
+			writeServerError(w, err.Error())
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusCreated)
 	w.Write(ResponseOk)
 }
@@ -620,3 +667,257 @@ func (this *manServer) appSubStatusHandler(w http.ResponseWriter, r *http.Reques
 	b, _ := json.Marshal(out)
 	w.Write(b)
 }
+
+// @rest GET /v1/bandwidth
+// response: {"global":0,"groups":{"app1.group1":1048576}} in bytes per second, 0 means unlimited
+func (this *manServer) subBandwidthHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous sub bandwidth call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, getHttpRemoteIp(r), appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	if this.gw.subServer == nil {
+		writeBadRequest(w, "sub server not enabled")
+		return
+	}
+
+	b, _ := json.Marshal(map[string]interface{}{
+		"global": Options.SubBandwidthLimit,
+		"groups": this.gw.subServer.bandwidth.groupLimits(),
+	})
+	w.Write(b)
+}
+
+// @rest PUT /v1/bandwidth/:appid/:group/:limit
+// limit is in bytes per second, 0 to remove the limit of the group
+func (this *manServer) setSubBandwidthHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+	realIp := getHttpRemoteIp(r)
+
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous set sub bandwidth call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, realIp, appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	if this.gw.subServer == nil {
+		writeBadRequest(w, "sub server not enabled")
+		return
+	}
+
+	myAppid := params.ByName(UrlParamAppid)
+	group := params.ByName(UrlParamGroup)
+	limit, err := strconv.ParseInt(params.ByName("limit"), 10, 64)
+	if err != nil || limit < 0 {
+		writeBadRequest(w, "invalid limit")
+		return
+	}
+	if !manager.Default.ValidateGroupName(r.Header, group) {
+		writeBadRequest(w, "illegal group")
+		return
+	}
+
+	this.gw.subServer.bandwidth.setGroupLimit(myAppid, group, limit)
+
+	log.Info("sub bandwidth[%s] %s(%s) {app:%s group:%s} %d B/s", appid, r.RemoteAddr, realIp, myAppid, group, limit)
+	this.auditor.Info("sub bandwidth[%s] %s(%s) {app:%s group:%s} %d B/s", appid, r.RemoteAddr, realIp, myAppid, group, limit)
+
+	w.Write(ResponseOk)
+}
+
+// @rest GET /v1/scale/:appid/:topic/:ver/:group?drain=5m
+// drain is the expected duration to catch up the lag, polled by app autoscalers
+// response: {"group":"group1","partitions":8,"consumers":2,"pub_rate":1200,"sub_rate":800,"lag":50000,"recommended":4,"partition_bound":false,"reason":"consumers fall behind"}
+func (this *manServer) subScaleHintHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var (
+		topic    = params.ByName(UrlParamTopic)
+		ver      = params.ByName(UrlParamVersion)
+		hisAppid = params.ByName(UrlParamAppid)
+		group    = params.ByName(UrlParamGroup)
+		myAppid  = r.Header.Get(HttpHeaderAppid)
+		realIp   = getHttpRemoteIp(r)
+		drain    = time.Minute * 5
+	)
+
+	if !this.throttleSubStatus.Pour(realIp, 1) {
+		writeQuotaExceeded(w)
+		return
+	}
+
+	if d := r.URL.Query().Get("drain"); d != "" {
+		var err error
+		if drain, err = time.ParseDuration(d); err != nil || drain <= 0 {
+			writeBadRequest(w, "invalid drain")
+			return
+		}
+	}
+
+	if err := manager.Default.AuthSub(myAppid, r.Header.Get(HttpHeaderSubkey),
+		hisAppid, topic, group); err != nil {
+		log.Error("sub scale[%s] %s(%s) {app:%s, topic:%s, ver:%s, group:%s} %v",
+			myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, group, err)
+
+		writeAuthFailure(w, err)
+		return
+	}
+
+	cluster, found := manager.Default.LookupCluster(hisAppid)
+	if !found {
+		log.Error("sub scale[%s] %s(%s) {app:%s, topic:%s, ver:%s, group:%s} cluster not found",
+			myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, group)
+
+		writeBadRequest(w, "invalid appid")
+		return
+	}
+
+	rawTopic := manager.Default.KafkaTopic(hisAppid, topic, ver)
+	hint, err := this.subScaleHint(cluster, rawTopic, myAppid+"."+group, drain)
+	if err != nil {
+		log.Error("sub scale[%s] %s(%s) {app:%s, topic:%s, ver:%s, group:%s} %v",
+			myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, group, err)
+
+		writeServerError(w, err.Error())
+		return
+	}
+	hint.Group = group
+
+	log.Info("sub scale[%s] %s(%s) {app:%s, topic:%s, ver:%s, group:%s} %+v",
+		myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, group, hint)
+
+	b, _ := json.Marshal(hint)
+	w.Write(b)
+}
+
+// @rest GET /v1/sub/export?cluster=xx&appid=xx
+// exports all consumer groups of each topic in one call for consumption dashboards, cached for -subexport.
+// cluster is all clusters if empty, appid filters the topics of the app and implies its cluster.
+// response: [{"cluster":"me","created_at":"2017-03-01T10:00:00+08:00","topics":[{"topic":"app1.foobar.v1","groups":[{"group":"app2.group1","online":true,"lag":120,"hosts":["10.10.1.2"],"partitions":[{"partition":0,"oldest":0,"newest":7827,"consumed":7707,"lag":120,"host":"10.10.1.2"}]}]}]}]
+func (this *manServer) subExportHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var (
+		appid   = r.Header.Get(HttpHeaderAppid)
+		pubkey  = r.Header.Get(HttpHeaderPubkey)
+		realIp  = getHttpRemoteIp(r)
+		query   = r.URL.Query()
+		cluster = query.Get("cluster")
+		hisApp  = query.Get("appid")
+	)
+
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous sub export call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, realIp, appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	if !this.throttleSubStatus.Pour(realIp, 1) {
+		writeQuotaExceeded(w)
+		return
+	}
+
+	clusters := meta.Default.ClusterNames()
+	if hisApp != "" {
+		c, found := manager.Default.LookupCluster(hisApp)
+		if !found {
+			writeBadRequest(w, "invalid appid")
+			return
+		}
+		if cluster != "" && cluster != c {
+			writeBadRequest(w, "appid not in cluster")
+			return
+		}
+
+		clusters = []string{c}
+	} else if cluster != "" {
+		if meta.Default.ZkCluster(cluster) == nil {
+			writeBadRequest(w, "invalid cluster")
+			return
+		}
+
+		clusters = []string{cluster}
+	}
+	sort.Strings(clusters)
+
+	log.Info("sub export[%s] %s(%s) {cluster:%s appid:%s}", appid, r.RemoteAddr, realIp, cluster, hisApp)
+
+	out := make([]subExport, 0, len(clusters))
+	for _, c := range clusters {
+		export, err := this.exporter.export(c)
+		if err != nil {
+			log.Error("sub export[%s] %s(%s) {cluster:%s appid:%s} %v", appid, r.RemoteAddr, realIp, c, hisApp, err)
+
+			writeServerError(w, err.Error())
+			return
+		}
+
+		out = append(out, subExport{
+			Cluster:   export.Cluster,
+			CreatedAt: export.CreatedAt,
+			Topics:    export.filter(hisApp),
+		})
+	}
+
+	b, _ := json.Marshal(out)
+	w.Write(b)
+}
+
+func (this *manServer) subScaleHint(cluster, rawTopic, group string, drain time.Duration) (*subScaleHint, error) {
+	zkcluster := meta.Default.ZkCluster(cluster)
+	partitions := meta.Default.TopicPartitions(cluster, rawTopic)
+	if len(partitions) == 0 {
+		return nil, store.ErrInvalidTopic
+	}
+
+	consumers, err := meta.Default.OnlineConsumersCount(cluster, rawTopic, group)
+	if err != nil {
+		return nil, err
+	}
+
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), sarama.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer kfk.Close()
+
+	var produced, consumed int64
+	for partitionId, consumerOffset := range zkcluster.ConsumerOffsetsOfGroup(group)[rawTopic] {
+		pid, err := strconv.Atoi(partitionId)
+		if err != nil {
+			continue
+		}
+
+		producerOffset, err := kfk.GetOffset(rawTopic, int32(pid), sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+
+		produced += producerOffset
+		consumed += consumerOffset
+	}
+
+	hint := &subScaleHint{
+		Partitions: len(partitions),
+		Consumers:  consumers,
+		Lag:        produced - consumed,
+	}
+	pubRate, subRate, ok := this.scaler.rates(cluster+"/"+rawTopic+"/"+group, produced, consumed, time.Now())
+	if !ok {
+		// the 1st poll, assume consumers keep up
+		hint.Recommended = consumers
+		hint.Reason = "rates not sampled yet, poll again later"
+		return hint, nil
+	}
+
+	hint.PubRate, hint.SubRate = pubRate, subRate
+	hint.recommend(drain)
+	return hint, nil
+}
@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/httprouter"
+	log "github.com/funkygao/log4go"
+)
+
+//go:generate goannotation $GOFILE
+// @rest GET /v1/trace
+// list the debug trace rules
+// response: [{"appid":"app1","topic":"","size":500,"expire_at":"2017-03-01T10:00:00+08:00","active":true,"captured":35}]
+func (this *manServer) listTraceHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous list trace call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, getHttpRemoteIp(r), appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	b, _ := json.Marshal(this.gw.debugTraces.list())
+	w.Write(b)
+}
+
+// @rest PUT /v1/trace?appid=xx&topic=xx&ttl=10m&size=500
+// capture request/response of the appid and/or topic for ttl into a ring buffer of size
+// appid matches either the caller or the topic owner
+func (this *manServer) enableTraceHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+	realIp := getHttpRemoteIp(r)
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous enable trace call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, realIp, appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	q := r.URL.Query()
+	ttl := time.Minute * 10
+	if s := q.Get("ttl"); s != "" {
+		var err error
+		if ttl, err = time.ParseDuration(s); err != nil {
+			writeBadRequest(w, "invalid ttl")
+			return
+		}
+	}
+	size := debugTraceDefaultSize
+	if s := q.Get("size"); s != "" {
+		var err error
+		if size, err = strconv.Atoi(s); err != nil {
+			writeBadRequest(w, "invalid size")
+			return
+		}
+	}
+
+	rule, err := this.gw.debugTraces.enable(q.Get("appid"), q.Get("topic"), ttl, size)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	log.Info("trace[%s] %s(%s) enabled {app:%s topic:%s} ttl:%s size:%d", appid, r.RemoteAddr, realIp,
+		rule.Appid, rule.Topic, ttl, size)
+	this.auditor.Info("trace[%s] %s(%s) enabled {app:%s topic:%s} ttl:%s size:%d", appid, r.RemoteAddr, realIp,
+		rule.Appid, rule.Topic, ttl, size)
+
+	b, _ := json.Marshal(rule.info())
+	w.Write(b)
+}
+
+// @rest DELETE /v1/trace?appid=xx&topic=xx
+// disable the debug trace rule and discard its captured traffic
+func (this *manServer) disableTraceHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+	realIp := getHttpRemoteIp(r)
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous disable trace call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, realIp, appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	q := r.URL.Query()
+	if !this.gw.debugTraces.disable(q.Get("appid"), q.Get("topic")) {
+		writeNotFound(w)
+		return
+	}
+
+	log.Info("trace[%s] %s(%s) disabled {app:%s topic:%s}", appid, r.RemoteAddr, realIp, q.Get("appid"), q.Get("topic"))
+	this.auditor.Info("trace[%s] %s(%s) disabled {app:%s topic:%s}", appid, r.RemoteAddr, realIp, q.Get("appid"), q.Get("topic"))
+
+	w.Write(ResponseOk)
+}
+
+// @rest GET /v1/trace/dump?appid=xx&topic=xx
+// download the captured request/response of the rule, the oldest first
+func (this *manServer) dumpTraceHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	appid := r.Header.Get(HttpHeaderAppid)
+	pubkey := r.Header.Get(HttpHeaderPubkey)
+	if !manager.Default.AuthAdmin(appid, pubkey) {
+		log.Warn("suspicous dump trace call from %s(%s) {app:%s key:%s}",
+			r.RemoteAddr, getHttpRemoteIp(r), appid, pubkey)
+
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+
+	q := r.URL.Query()
+	rule := this.gw.debugTraces.get(q.Get("appid"), q.Get("topic"))
+	if rule == nil {
+		writeNotFound(w)
+		return
+	}
+
+	log.Info("trace[%s] %s(%s) dump {app:%s topic:%s}", appid, r.RemoteAddr, getHttpRemoteIp(r), rule.Appid, rule.Topic)
+
+	b, _ := json.Marshal(rule.entries())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="trace-%s-%s.json"`, rule.Appid, rule.Topic))
+	w.Write(b)
+}
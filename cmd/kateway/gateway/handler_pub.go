@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/funkygao/gafka/cmd/kateway/hh"
+	"github.com/funkygao/gafka/cmd/kateway/job"
 	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/cmd/kateway/store"
 	"github.com/funkygao/gafka/mpool"
@@ -18,6 +19,7 @@ import (
 
 //go:generate goannotation $GOFILE
 // @rest POST /v1/msgs/:topic/:ver?key=mykey&async=1&ack=all&hh=n
+// With header X-Delay: 30s the message is fired into the topic by the job subsystem when due.
 func (this *pubServer) pubHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	var (
 		appid        string
@@ -56,14 +58,27 @@ func (this *pubServer) pubHandler(w http.ResponseWriter, r *http.Request, params
 		return
 	}
 
+	if tenant, found := manager.Default.LookupTenant(appid); found && !this.tenantQuotas.allow(tenant) {
+		log.Warn("pub[%s] %s(%s) {topic:%s ver:%s UA:%s} tenant[%s] quota exceeded",
+			appid, r.RemoteAddr, realIp, topic, ver, r.Header.Get("User-Agent"), tenant.Name)
+
+		this.pubMetrics.ClientError.Inc(1)
+		writeQuotaExceeded(w)
+		return
+	}
+
 	msgLen := int(r.ContentLength)
+	chunked := r.ContentLength == -1
 	switch {
+	case chunked:
+		// chunked transfer encoding: size is enforced as bytes arrive
+
 	case int64(msgLen) > Options.MaxPubSize:
 		log.Warn("pub[%s] %s(%s) {topic:%s ver:%s UA:%s} too big content length: %d",
 			appid, r.RemoteAddr, realIp, topic, ver, r.Header.Get("User-Agent"), msgLen)
 
 		this.pubMetrics.ClientError.Inc(1)
-		this.respond4XX(appid, w, ErrTooBigMessage.Error(), http.StatusBadRequest)
+		this.respond4XX(appid, w, ErrTooBigMessage.Error(), http.StatusRequestEntityTooLarge)
 		return
 
 	case msgLen < Options.MinPubSize:
@@ -95,32 +110,134 @@ func (this *pubServer) pubHandler(w http.ResponseWriter, r *http.Request, params
 			this.respond4XX(appid, w, "too big tag", http.StatusBadRequest)
 			return
 		}
+	}
+
+	if chunked {
+		var err error
+		if msg, err = readChunkedBody(r.Body, Options.MaxPubSize); err != nil {
+			log.Warn("pub[%s] %s(%s) {topic:%s ver:%s UA:%s} chunked: %s",
+				appid, r.RemoteAddr, realIp, topic, ver, r.Header.Get("User-Agent"), err)
+
+			this.pubMetrics.ClientError.Inc(1)
+			if err == ErrTooBigMessage {
+				this.respond4XX(appid, w, err.Error(), http.StatusRequestEntityTooLarge)
+			} else {
+				this.respond4XX(appid, w, err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
 
-		msgSz := tagLen(tag) + msgLen
-		msg = mpool.NewMessage(msgSz)
-		msg.Body = msg.Body[0:msgSz]
+		msgLen = len(msg.Body)
+		if msgLen < Options.MinPubSize {
+			msg.Free()
+
+			log.Warn("pub[%s] %s(%s) {topic:%s ver:%s UA:%s} too small chunked body: %d",
+				appid, r.RemoteAddr, realIp, topic, ver, r.Header.Get("User-Agent"), msgLen)
+
+			this.pubMetrics.ClientError.Inc(1)
+			this.respond4XX(appid, w, ErrTooSmallMessage.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if tag != "" {
+			msgSz := tagLen(tag) + msgLen
+			msg = growMessage(msg, msgLen, msgSz)
+			msg.Body = msg.Body[0:msgSz]
+		}
 	} else {
-		msg = mpool.NewMessage(msgLen)
-		msg.Body = msg.Body[0:msgLen]
+		if tag != "" {
+			msgSz := tagLen(tag) + msgLen
+			msg = mpool.NewMessage(msgSz)
+			msg.Body = msg.Body[0:msgSz]
+		} else {
+			msg = mpool.NewMessage(msgLen)
+			msg.Body = msg.Body[0:msgLen]
+		}
+
+		// get the raw POST message, if body more than content-length ignore the extra payload
+		lbr := newMaxBytesReader(r.Body, Options.MaxPubSize)
+		if _, err := io.ReadAtLeast(lbr, msg.Body, msgLen); err != nil {
+			msg.Free()
+
+			log.Error("pub[%s] %s(%s) {topic:%s ver:%s UA:%s} %s",
+				appid, r.RemoteAddr, realIp, topic, ver, r.Header.Get("User-Agent"), err)
+
+			this.pubMetrics.ClientError.Inc(1)
+			if err == ErrTooBigMessage {
+				this.respond4XX(appid, w, err.Error(), http.StatusRequestEntityTooLarge)
+			} else {
+				// body shorter than content length
+				this.respond4XX(appid, w, err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
 	}
 
-	// get the raw POST message, if body more than content-length ignore the extra payload
-	lbr := io.LimitReader(r.Body, Options.MaxPubSize+1)
-	if _, err := io.ReadAtLeast(lbr, msg.Body, msgLen); err != nil {
-		msg.Free()
+	if rules := manager.Default.RouteRules(appid, topic, ver); len(rules) > 0 {
+		// virtual topic: route the message to a physical topic by its content
+		rule, found := manager.MatchRoute(rules, r.Header, msg.Body[:msgLen])
+		if !found {
+			msg.Free()
 
-		log.Error("pub[%s] %s(%s) {topic:%s ver:%s UA:%s} %s",
-			appid, r.RemoteAddr, realIp, topic, ver, r.Header.Get("User-Agent"), err)
+			log.Warn("pub[%s] %s(%s) {topic:%s ver:%s UA:%s} %s",
+				appid, r.RemoteAddr, realIp, topic, ver, r.Header.Get("User-Agent"), ErrNoRouteMatched)
 
-		this.pubMetrics.ClientError.Inc(1)
-		this.respond4XX(appid, w, err.Error(), http.StatusBadRequest) // TODO http.StatusRequestEntityTooLarge
-		return
+			this.pubMetrics.ClientError.Inc(1)
+			this.respond4XX(appid, w, ErrNoRouteMatched.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Debug("pub[%s] %s(%s) {topic:%s ver:%s} routed to {topic:%s ver:%s}",
+			appid, r.RemoteAddr, realIp, topic, ver, rule.Topic, rule.Ver)
+
+		topic, ver = rule.Topic, rule.Ver
+	}
+
+	if rules := manager.Default.TransformRules(appid, topic, ver); this.gw.transforms.enabled(rules, false) {
+		body, err := this.gw.transforms.apply(rules, false, msg.Body[:msgLen])
+		if err != nil {
+			msg.Free()
+
+			log.Warn("pub[%s] %s(%s) {topic:%s ver:%s UA:%s} transform: %s",
+				appid, r.RemoteAddr, realIp, topic, ver, r.Header.Get("User-Agent"), err)
+
+			this.pubMetrics.ClientError.Inc(1)
+			this.respond4XX(appid, w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// the transformed message might grow or shrink
+		msgLen = len(body)
+		msgSz := msgLen
+		if tag != "" {
+			msgSz += tagLen(tag)
+		}
+		transformed := mpool.NewMessage(msgSz)
+		transformed.Body = transformed.Body[0:msgSz]
+		copy(transformed.Body, body)
+		msg.Free()
+		msg = transformed
 	}
 
 	if tag != "" {
 		AddTagToMessage(msg, tag)
 	}
 
+	if window := manager.Default.DedupWindow(appid, topic, ver); window > 0 &&
+		this.dedup.duplicated(appid+"."+topic+"."+ver, window, []byte(partitionKey), msg.Body) {
+		// exact duplicate within the window, e,g. producer retry: pretend it's published
+		msg.Free()
+
+		log.Debug("pub[%s] %s(%s) {topic:%s ver:%s} duplicated within %s",
+			appid, r.RemoteAddr, realIp, topic, ver, window)
+
+		this.pubMetrics.PubDup.Inc(1)
+		w.Header().Set(HttpHeaderDuplicated, "1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(ResponseOk)
+		return
+	}
+
 	if !Options.DisableMetrics {
 		this.pubMetrics.PubQps.Mark(1)
 		this.pubMetrics.PubMsgSize.Update(int64(len(msg.Body)))
@@ -136,6 +253,11 @@ func (this *pubServer) pubHandler(w http.ResponseWriter, r *http.Request, params
 		return
 	}
 
+	if delayHeader := r.Header.Get(HttpHeaderDelay); delayHeader != "" {
+		this.delayedPub(w, r, appid, topic, ver, cluster, delayHeader, msg, t1)
+		return
+	}
+
 	var (
 		partition int32
 		offset    int64 = -1
@@ -144,23 +266,31 @@ func (this *pubServer) pubHandler(w http.ResponseWriter, r *http.Request, params
 	)
 
 	pubMethod := store.DefaultPubStore.SyncPub
+	pubOp := "kafka.SyncPub"
 	async = query.Get("async") == "1"
 	if async {
 		pubMethod = store.DefaultPubStore.AsyncPub
+		pubOp = "kafka.AsyncPub"
 	}
 
 	ackAll := query.Get("ack") == "all"
 	if ackAll {
 		pubMethod = store.DefaultPubStore.SyncAllPub
+		pubOp = "kafka.SyncAllPub"
+	}
+
+	if tracingEnabled() {
+		pubMethod = tracedPub(r, pubOp, pubMethod)
 	}
 
-	hhDisabled = query.Get("hh") == "n" // yes | no
+	hhBypass := hhBypassed(cluster, rawTopic)
+	hhDisabled = query.Get("hh") == "n" || hhBypass // yes | no
 
 	msgKey := []byte(partitionKey)
 	if ackAll {
 		// hh not applied
 		partition, offset, err = pubMethod(cluster, rawTopic, msgKey, msg.Body)
-	} else if Options.AllwaysHintedHandoff {
+	} else if Options.AllwaysHintedHandoff && !hhBypass {
 		err = hh.Default.Append(cluster, rawTopic, msgKey, msg.Body)
 	} else if !hhDisabled && Options.EnableHintedHandoff && !hh.Default.Empty(cluster, rawTopic) {
 		err = hh.Default.Append(cluster, rawTopic, msgKey, msg.Body)
@@ -207,13 +337,15 @@ func (this *pubServer) pubHandler(w http.ResponseWriter, r *http.Request, params
 		}
 
 		if store.DefaultPubStore.IsSystemError(err) {
-			writeServerError(w, err.Error())
+			this.gw.pubShedder.observe(true, time.Since(t1))
+			writeStoreError(w, err.Error())
 		} else {
 			this.respond4XX(appid, w, err.Error(), http.StatusBadRequest)
 		}
 		return
 	}
 
+	this.gw.pubShedder.observe(false, time.Since(t1))
 	w.Header().Set(HttpHeaderPartition, strconv.FormatInt(int64(partition), 10))
 	w.Header().Set(HttpHeaderOffset, strconv.FormatInt(offset, 10))
 	if async {
@@ -233,3 +365,58 @@ func (this *pubServer) pubHandler(w http.ResponseWriter, r *http.Request, params
 	}
 
 }
+
+// delayedPub puts the message into the job queue of the topic, which fires into the topic
+// when due. The partition key is not kept since jobs carry payload only.
+func (this *pubServer) delayedPub(w http.ResponseWriter, r *http.Request, appid, topic, ver, cluster,
+	delayHeader string, msg *mpool.Message, t1 time.Time) {
+	defer msg.Free()
+
+	realIp := getHttpRemoteIp(r)
+	delay, err := parsePubDelay(delayHeader, Options.MaxPubDelay)
+	if err == nil && int64(len(msg.Body)) > Options.MaxJobSize {
+		err = ErrTooBigMessage
+	}
+	if err != nil {
+		log.Warn("pub[%s] %s(%s) {topic:%s ver:%s UA:%s} delay:%s %s",
+			appid, r.RemoteAddr, realIp, topic, ver, r.Header.Get("User-Agent"), delayHeader, err)
+
+		this.pubMetrics.ClientError.Inc(1)
+		this.respond4XX(appid, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rawTopic := manager.Default.KafkaTopic(appid, topic, ver)
+	due := t1.Add(delay).Unix()
+	var jobId string
+	if err = this.jobQueues.ensure(appid, cluster, rawTopic); err == nil {
+		jobId, err = job.Default.Add(appid, rawTopic, msg.Body, due, job.MinPriority)
+	}
+	if err != nil {
+		log.Error("pub[%s] %s(%s) {topic:%s ver:%s} delay:%s %s", appid, r.RemoteAddr, realIp, topic, ver, delay, err)
+
+		if !Options.DisableMetrics {
+			this.pubMetrics.PubFail(appid, topic, ver)
+		}
+		writeServerError(w, err.Error())
+		return
+	}
+
+	if Options.AuditPub {
+		this.auditor.Trace("pub[%s] %s(%s) {%s.%s.%s UA:%s} due:%d id:%s",
+			appid, r.RemoteAddr, realIp, appid, topic, ver, r.Header.Get("User-Agent"), due, jobId)
+	}
+
+	w.Header().Set(HttpHeaderJobId, jobId)
+	w.WriteHeader(http.StatusCreated)
+	if _, err = w.Write(ResponseOk); err != nil {
+		log.Error("%s: %v", r.RemoteAddr, err)
+		this.pubMetrics.ClientError.Inc(1)
+	}
+
+	if !Options.DisableMetrics {
+		this.pubMetrics.JobQps.Mark(1)
+		this.pubMetrics.PubOk(appid, topic, ver)
+		this.pubMetrics.PubLatency.Update(time.Since(t1).Nanoseconds() / 1e6) // in ms
+	}
+}
@@ -0,0 +1,272 @@
+// +build !fasthttp
+
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/hh"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+	"github.com/funkygao/gafka/mpool"
+	"github.com/funkygao/httprouter"
+	log "github.com/funkygao/log4go"
+)
+
+//go:generate goannotation $GOFILE
+// @rest POST /v1/multi/msgs
+func (this *pubServer) pubMultiHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var (
+		appid  = r.Header.Get(HttpHeaderAppid)
+		pubkey = r.Header.Get(HttpHeaderPubkey)
+		realIp = getHttpRemoteIp(r)
+		t1     = time.Now()
+	)
+
+	if !Options.DisableMetrics {
+		this.pubMetrics.PubTryQps.Mark(1)
+	}
+
+	if Options.Ratelimit && !this.throttlePub.Pour(realIp, 1) {
+		log.Warn("pub multi[%s] %s(%s) rate limit reached: %d/s", appid, r.RemoteAddr, realIp, Options.PubQpsLimit)
+
+		this.pubMetrics.ClientError.Inc(1)
+		writeQuotaExceeded(w)
+		return
+	}
+
+	if tenant, found := manager.Default.LookupTenant(appid); found && !this.tenantQuotas.allow(tenant) {
+		log.Warn("pub multi[%s] %s(%s) tenant[%s] quota exceeded", appid, r.RemoteAddr, realIp, tenant.Name)
+
+		this.pubMetrics.ClientError.Inc(1)
+		writeQuotaExceeded(w)
+		return
+	}
+
+	var req multiPubRequest
+	maxLen := int64(maxMultiPubMsgs) * (Options.MaxPubSize + int64(Options.MaxMsgTagLen) + 1<<10)
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxLen))
+	if err == nil {
+		err = json.Unmarshal(b, &req)
+	}
+	if err != nil {
+		log.Warn("pub multi[%s] %s(%s) UA:%s %v", appid, r.RemoteAddr, realIp, r.Header.Get("User-Agent"), err)
+
+		this.pubMetrics.ClientError.Inc(1)
+		this.respond4XX(appid, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Msgs) == 0 || len(req.Msgs) > maxMultiPubMsgs {
+		this.pubMetrics.ClientError.Inc(1)
+		this.respond4XX(appid, w, fmt.Sprintf("1-%d msgs allowed", maxMultiPubMsgs), http.StatusBadRequest)
+		return
+	}
+
+	// all-or-nothing relies on hinted handoff once kafka fails in the middle
+	if r.URL.Query().Get("hh") == "n" {
+		this.pubMetrics.ClientError.Inc(1)
+		this.respond4XX(appid, w, "hh=n not allowed", http.StatusBadRequest)
+		return
+	}
+	if !Options.EnableHintedHandoff {
+		log.Warn("pub multi[%s] %s(%s) refused: hinted handoff disabled", appid, r.RemoteAddr, realIp)
+
+		_writeErrorResponse(w, "hinted handoff disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	cluster, found := manager.Default.LookupCluster(appid)
+	if !found {
+		log.Warn("pub multi[%s] %s(%s) UA:%s cluster not found", appid, r.RemoteAddr, realIp, r.Header.Get("User-Agent"))
+
+		this.pubMetrics.ClientError.Inc(1)
+		this.respond4XX(appid, w, "invalid appid", http.StatusBadRequest)
+		return
+	}
+
+	// validate all before publishing any
+	bodies := make([][]byte, len(req.Msgs))
+	receipt := &pubReceipt{
+		Id:        newReceiptId(),
+		Appid:     appid,
+		CreatedAt: t1,
+		topic:     req.Msgs[0].Topic,
+		Parts:     make([]multiPubPart, len(req.Msgs)),
+	}
+	for i, msg := range req.Msgs {
+		if err = manager.Default.OwnTopic(appid, pubkey, msg.Topic); err != nil {
+			log.Warn("pub multi[%s] %s(%s) {topic:%s ver:%s UA:%s} #%d %s",
+				appid, r.RemoteAddr, realIp, msg.Topic, msg.Ver, r.Header.Get("User-Agent"), i, err)
+
+			this.pubMetrics.ClientError.Inc(1)
+			this.respond4XX(appid, w, fmt.Sprintf("msgs[%d]: %s", i, err), http.StatusUnauthorized)
+			return
+		}
+
+		body, topic, ver, err := this.prepareMultiPubMsg(appid, r, msg)
+		if err != nil {
+			log.Warn("pub multi[%s] %s(%s) {topic:%s ver:%s UA:%s} #%d %s",
+				appid, r.RemoteAddr, realIp, msg.Topic, msg.Ver, r.Header.Get("User-Agent"), i, err)
+
+			this.pubMetrics.ClientError.Inc(1)
+			this.respond4XX(appid, w, fmt.Sprintf("msgs[%d]: %s", i, err), http.StatusBadRequest)
+			return
+		}
+
+		bodies[i] = body
+		receipt.Parts[i] = multiPubPart{
+			Topic:     topic,
+			Ver:       ver,
+			Partition: -1,
+			Offset:    -1,
+			cluster:   cluster,
+			rawTopic:  manager.Default.KafkaTopic(appid, topic, ver),
+		}
+	}
+
+	for i, p := range receipt.Parts {
+		if hhBypassed(cluster, p.rawTopic) {
+			log.Warn("pub multi[%s] %s(%s) {topic:%s ver:%s} #%d refused: hinted handoff bypassed",
+				appid, r.RemoteAddr, realIp, p.Topic, p.Ver, i)
+
+			_writeErrorResponse(w, fmt.Sprintf("msgs[%d]: hinted handoff bypassed", i), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	keys := make([][]byte, len(req.Msgs))
+	for i := range req.Msgs {
+		keys[i] = []byte(req.Msgs[i].Key)
+	}
+	publisher := &multiPublisher{
+		pub:   store.DefaultPubStore.SyncPub,
+		spool: hh.Default.Append,
+		mustSpool: func(cluster, topic string) bool {
+			// keep order with the pending messages of the topic in hh
+			return Options.AllwaysHintedHandoff || !hh.Default.Empty(cluster, topic)
+		},
+		isSystemError: store.DefaultPubStore.IsSystemError,
+	}
+	if i, e := publisher.publish(receipt, keys, bodies); e != nil {
+		err = e
+		p := receipt.Parts[i]
+		log.Error("pub multi[%s] %s(%s) {topic:%s ver:%s} receipt[%s] #%d %s",
+			appid, r.RemoteAddr, realIp, p.Topic, p.Ver, receipt.Id, i, err)
+
+		if !Options.DisableMetrics {
+			this.pubMetrics.PubFail(appid, p.Topic, p.Ver)
+		}
+	}
+
+	receipt.refresh(func(cluster, topic string) bool { return false })
+	this.receipts.add(receipt)
+	this.gw.pubShedder.observe(receipt.State == multiPubFailed && store.DefaultPubStore.IsSystemError(err), time.Since(t1))
+
+	if Options.AuditPub {
+		for _, p := range receipt.Parts {
+			this.auditor.Trace("pub multi[%s] %s(%s) {%s.%s.%s UA:%s} receipt[%s] {P:%d O:%d} %s",
+				appid, r.RemoteAddr, realIp, appid, p.Topic, p.Ver, r.Header.Get("User-Agent"),
+				receipt.Id, p.Partition, p.Offset, p.State)
+		}
+	}
+
+	b, _ = json.Marshal(receipt)
+	switch receipt.State {
+	case multiPubPublished:
+		w.WriteHeader(http.StatusCreated)
+	case multiPubSpooled:
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		time.Sleep(Options.InternalServerErrorBackoff)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	if _, err = w.Write(b); err != nil {
+		log.Error("%s: %v", r.RemoteAddr, err)
+		this.pubMetrics.ClientError.Inc(1)
+	}
+
+	if !Options.DisableMetrics && receipt.State != multiPubFailed {
+		for _, p := range receipt.Parts {
+			this.pubMetrics.PubOk(appid, p.Topic, p.Ver)
+		}
+		this.pubMetrics.PubQps.Mark(int64(len(receipt.Parts)))
+		this.pubMetrics.PubLatency.Update(time.Since(t1).Nanoseconds() / 1e6) // in ms
+	}
+}
+
+// prepareMultiPubMsg validates a message the same way as pubHandler does and returns the
+// final body and topic after routing, transforming and tagging.
+func (this *pubServer) prepareMultiPubMsg(appid string, r *http.Request,
+	msg multiPubMsg) (body []byte, topic, ver string, err error) {
+	topic, ver, body = msg.Topic, msg.Ver, []byte(msg.Body)
+	switch {
+	case ver == "":
+		err = fmt.Errorf("empty ver")
+	case int64(len(body)) > Options.MaxPubSize:
+		err = ErrTooBigMessage
+	case len(body) < Options.MinPubSize:
+		err = ErrTooSmallMessage
+	case len(msg.Key) > MaxPartitionKeyLen:
+		err = fmt.Errorf("too big key")
+	case len(msg.Tag) > Options.MaxMsgTagLen:
+		err = fmt.Errorf("too big tag")
+	}
+	if err != nil {
+		return
+	}
+
+	if rules := manager.Default.RouteRules(appid, topic, ver); len(rules) > 0 {
+		rule, found := manager.MatchRoute(rules, r.Header, body)
+		if !found {
+			err = ErrNoRouteMatched
+			return
+		}
+
+		topic, ver = rule.Topic, rule.Ver
+	}
+
+	if rules := manager.Default.TransformRules(appid, topic, ver); this.gw.transforms.enabled(rules, false) {
+		if body, err = this.gw.transforms.apply(rules, false, body); err != nil {
+			return
+		}
+	}
+
+	if msg.Tag != "" {
+		msgSz := tagLen(msg.Tag) + len(body)
+		m := mpool.NewMessage(msgSz)
+		m.Body = m.Body[0:msgSz]
+		copy(m.Body, body)
+		AddTagToMessage(m, msg.Tag)
+		body = append([]byte(nil), m.Body...)
+		m.Free()
+	}
+
+	return
+}
+
+//go:generate goannotation $GOFILE
+// @rest GET /v1/receipts/:id
+func (this *pubServer) receiptHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	appid := r.Header.Get(HttpHeaderAppid)
+	receipt := this.receipts.get(params.ByName("id"), hh.Default.Empty)
+	if receipt == nil || receipt.Appid != appid {
+		writeNotFound(w)
+		return
+	}
+
+	// the caller must own the topics of the receipt
+	if err := manager.Default.OwnTopic(appid, r.Header.Get(HttpHeaderPubkey), receipt.topic); err != nil {
+		log.Warn("receipt[%s] %s(%s) %s", appid, r.RemoteAddr, getHttpRemoteIp(r), err)
+
+		writeAuthFailure(w, err)
+		return
+	}
+
+	b, _ := json.Marshal(receipt)
+	w.Write(b)
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/cmd/kateway/store"
 	"github.com/funkygao/httprouter"
 	log "github.com/funkygao/log4go"
@@ -29,6 +30,16 @@ func (this *pubServer) pubRawHandler(w http.ResponseWriter, r *http.Request, par
 	realIp := getHttpRemoteIp(r)
 	topic = params.ByName(UrlParamTopic)
 	cluster = params.ByName("cluster")
+	appid := r.Header.Get(HttpHeaderAppid)
+
+	if err := manager.Default.AuthRaw(appid, cluster); err != nil {
+		log.Error("pub raw[%s] %s(%s) {C:%s T:%s UA:%s} %v",
+			appid, r.RemoteAddr, realIp, cluster, topic, r.Header.Get("User-Agent"), err)
+
+		this.pubMetrics.ClientError.Inc(1)
+		writeAuthFailure(w, err)
+		return
+	}
 
 	buf := bytes.NewBuffer(make([]byte, 0, 1<<10))
 	_, err := buf.ReadFrom(r.Body)
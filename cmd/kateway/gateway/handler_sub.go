@@ -12,10 +12,14 @@ import (
 	"github.com/funkygao/gafka/sla"
 	"github.com/funkygao/httprouter"
 	log "github.com/funkygao/log4go"
+	opentracing "github.com/opentracing/opentracing-go"
 )
 
 //go:generate goannotation $GOFILE
 // @rest GET /v1/msgs/:appid/:topic/:ver?group=xx&batch=10&reset=<newest|oldest>&ack=1&q=<dead|retry>
+// In ack mode, messages not acked within the ack timeout are redelivered with exponential backoff
+// and header X-Redelivery-Count, and moved to the dead shadow queue after max redeliveries.
+// If the group has a retry chain, they are moved to the next retry stage instead, e,g. q=retry.5s.
 func (this *subServer) subHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	var (
 		topic      string
@@ -84,8 +88,7 @@ func (this *subServer) subHandler(w http.ResponseWriter, r *http.Request, params
 	hisAppid = params.ByName(UrlParamAppid)
 
 	// auth
-	if err = manager.Default.AuthSub(myAppid, r.Header.Get(HttpHeaderSubkey),
-		hisAppid, topic, group); err != nil {
+	if err = authSub(r, myAppid, hisAppid, topic, ver, group); err != nil {
 		log.Error("sub[%s/%s] -(%s): {%s.%s.%s UA:%s} %v",
 			myAppid, group, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"), err)
 
@@ -181,8 +184,39 @@ func (this *subServer) subHandler(w http.ResponseWriter, r *http.Request, params
 		return
 	}
 
+	clientId := subClientId(r, cluster, rawTopic, realGroup)
+	permitStandby := Options.PermitStandbySub
+	var resume *resumeClaims // nil if resume token disabled
+	if this.gw.resumeTokens != nil {
+		var from string
+		resume, from, err = this.gw.resumeTokens.resumeOf(r, this.gw.id, clientId, cluster, rawTopic, realGroup)
+		if err != nil {
+			log.Error("sub[%s/%s] %s(%s) {%s UA:%s} %v",
+				myAppid, group, r.RemoteAddr, realIp, rawTopic, r.Header.Get("User-Agent"), err)
+
+			this.subMetrics.ClientError.Mark(1)
+			writeBadRequest(w, err.Error())
+			return
+		}
+
+		if from != "" {
+			// the old instance of this client might be still in the group
+			permitStandby = true
+
+			log.Info("sub[%s/%s] %s(%s) {%s} resumed from kateway[%s], %d partitions moved forward",
+				myAppid, group, r.RemoteAddr, realIp, rawTopic, from, this.gw.resumeTokens.resume(resume))
+		}
+	}
+
+	var span opentracing.Span
+	if tracingEnabled() {
+		span = traceStore(r, "kafka.Fetch", cluster, rawTopic)
+	}
 	fetcher, err := store.DefaultSubStore.Fetch(cluster, rawTopic,
-		realGroup, r.RemoteAddr, realIp, reset, Options.PermitStandbySub)
+		realGroup, clientId, realIp, reset, permitStandby)
+	if span != nil {
+		finishSpan(span, err)
+	}
 	if err != nil {
 		// e,g. kafka was totally shutdown
 		// e,g. too many consumers for the same group
@@ -191,7 +225,7 @@ func (this *subServer) subHandler(w http.ResponseWriter, r *http.Request, params
 				myAppid, group, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"), err)
 
 			this.subMetrics.ServerError.Mark(1)
-			writeServerError(w, err.Error())
+			writeStoreError(w, err.Error())
 		} else {
 			log.Error("sub[%s/%s] -(%s): {%s.%s.%s UA:%s} %v",
 				myAppid, group, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"), err)
@@ -221,11 +255,37 @@ func (this *subServer) subHandler(w http.ResponseWriter, r *http.Request, params
 			log.Debug("sub land[%s/%s] %s(%s) {T:%s/%s, O:%s}",
 				myAppid, group, r.RemoteAddr, realIp, rawTopic, partition, offset)
 		}
+
+		// acked, no redelivery any more
+		this.redelivery.ack(cluster, rawTopic, realGroup, int32(partitionN), offsetN)
+
+		if resume != nil {
+			resume.advance(int32(partitionN), offsetN)
+		}
+	}
+
+	var buryTo *retryHop // where to move the message after max redeliveries
+	if delayedAck && Options.SubAckTimeout > 0 &&
+		manager.Default.IsShadowedTopic(hisAppid, topic, ver, myAppid, group) {
+		// the next retry stage if the group has a retry chain
+		if buryTo, err = this.nextRetryHop(cluster, myAppid, hisAppid, topic, ver, group, shadow); err != nil {
+			log.Warn("sub[%s/%s] %s(%s) {%s} retry chain: %v", myAppid, group, r.RemoteAddr, realIp, rawTopic, err)
+		}
+		if buryTo == nil && shadow == "" {
+			buryTo = &retryHop{topic: manager.Default.ShadowTopic(sla.SlaKeyDeadLetterTopic, myAppid, hisAppid, topic, ver, group)}
+		}
 	}
 
 	var gz *gzip.Writer
 	w, gz = gzipWriter(w, r)
-	err = this.pumpMessages(w, r, realIp, fetcher, limit, myAppid, hisAppid, topic, ver, group, delayedAck)
+	if tracingEnabled() {
+		span = traceStore(r, "kafka.Consume", cluster, rawTopic)
+	}
+	err = this.pumpMessages(w, r, realIp, fetcher, limit, myAppid, hisAppid, topic, ver, group, delayedAck,
+		cluster, rawTopic, buryTo, resume)
+	if span != nil {
+		finishSpan(span, err)
+	}
 	if err != nil {
 		// e,g. broken pipe, io timeout, client gone
 		// e,g. kafka: error while consuming app1.foobar.v1/0: EOF (kafka was shutdown)
@@ -235,7 +295,7 @@ func (this *subServer) subHandler(w http.ResponseWriter, r *http.Request, params
 		if err != ErrClientGone {
 			if store.DefaultSubStore.IsSystemError(err) {
 				this.subMetrics.ServerError.Mark(1)
-				writeServerError(w, err.Error())
+				writeStoreError(w, err.Error())
 			} else {
 				this.subMetrics.ClientError.Mark(1)
 				if Options.BadGroupRateLimit && !this.throttleBadGroup.Pour(realGroup, 1) {
@@ -276,21 +336,51 @@ func (this *subServer) subHandler(w http.ResponseWriter, r *http.Request, params
 }
 
 func (this *subServer) pumpMessages(w http.ResponseWriter, r *http.Request, realIp string,
-	fetcher store.Fetcher, limit int, myAppid, hisAppid, topic, ver, group string, delayedAck bool) error {
+	fetcher store.Fetcher, limit int, myAppid, hisAppid, topic, ver, group string, delayedAck bool,
+	cluster, rawTopic string, buryTo *retryHop, resume *resumeClaims) error {
 	cn, ok := w.(http.CloseNotifier)
 	if !ok {
 		return ErrBadResponseWriter
 	}
 
 	var (
-		metaBuf       []byte = nil
-		n                    = 0
-		idleTimeout          = Options.SubTimeout
-		chunkedEver          = false
-		tagConditions        = make(map[string]struct{})
-		clientGoneCh         = cn.CloseNotify()
-		startedAt            = time.Now()
+		msw            *messageSetWriter // batch mode only
+		n              = 0
+		idleTimeout    = Options.SubTimeout
+		chunkedEver    = false
+		unflushed      = false
+		tagConditions  = make(map[string]struct{})
+		clientGoneCh   = cn.CloseNotify()
+		startedAt      = time.Now()
+		transforms     = manager.Default.TransformRules(hisAppid, topic, ver)
+		transformOnSub = this.gw.transforms.enabled(transforms, true)
+		jsonSchema     = ""
+		contentType    = "text/plain; charset=utf8"
+		realGroup      = myAppid + "." + group
+		redeliver      = delayedAck && Options.SubAckTimeout > 0
 	)
+	defer func() {
+		if msw != nil {
+			// deliver the pending messages on any exit
+			msw.Flush()
+			msw.Close()
+
+			if !delayedAck {
+				// the final position of the batch goes out as trailer
+				this.setResumeToken(w, resume, nil)
+			}
+		}
+	}()
+
+	// the position unchanged if no message is delivered
+	this.setResumeToken(w, resume, nil)
+
+	if acceptJson(r) {
+		// decode avro on the fly only if the topic allows it, else feed the raw messages
+		if jsonSchema = manager.Default.SubJsonSchema(hisAppid, topic, ver); jsonSchema != "" {
+			contentType = "application/json; charset=utf8"
+		}
+	}
 
 	// parse http tag header as filter condition
 	if tagFilter := r.Header.Get(HttpHeaderMsgTag); tagFilter != "" {
@@ -313,169 +403,268 @@ func (this *subServer) pumpMessages(w http.ResponseWriter, r *http.Request, real
 			return nil
 		}
 
-		select {
-		case <-clientGoneCh:
-			// FIXME access log will not be able to record this behavior
-			return ErrClientGone
-
-		case <-this.gw.shutdownCh:
-			// don't call me again
-			w.Header().Set("Connection", "close")
+		var (
+			msg        *sarama.ConsumerMessage
+			ok         bool
+			deliveries = 1
+		)
+		if redeliver {
+			if um := this.redelivery.due(cluster, rawTopic, realGroup, time.Now()); um != nil {
+				if um.deliveries > Options.SubMaxRedelivery {
+					if this.buryUnacked(um, myAppid, group, realIp, cluster, realGroup, buryTo) == nil {
+						this.subMetrics.DeadLettered(myAppid, topic, ver)
+					}
+					continue
+				}
 
-			if !chunkedEver {
-				w.WriteHeader(http.StatusNoContent)
-				w.Write([]byte{})
+				msg, ok, deliveries = um.msg, true, um.deliveries+1
 			}
+		}
 
-			return nil
+		if msg == nil {
+			select {
+			case msg, ok = <-fetcher.Messages():
+				// message ready e,g. from prefetch cache, coalesce it into the pending chunk
+
+			default:
+				if unflushed {
+					// about to wait, deliver what we have written so far
+					if msw != nil {
+						if err := msw.Flush(); err != nil {
+							return err
+						}
+					}
 
-		case err := <-fetcher.Errors():
-			// e,g. consume a non-existent topic
-			// e,g. conn with broker is broken
-			// e,g. kafka: error while consuming foobar/0: EOF
-			// e,g. kafka: error while consuming foobar/2: read tcp 10.1.1.1:60088->10.1.1.2:11005: i/o timeout
-			return err
+					// http chunked: len in hex
+					// curl CURLOPT_HTTP_TRANSFER_DECODING will auto unchunk
+					w.(http.Flusher).Flush()
+					unflushed = false
+				}
 
-		case <-this.timer.After(idleTimeout):
-			if chunkedEver {
-				// response already sent in chunk
-				log.Debug("chunked sub idle timeout %s {A:%s/G:%s->A:%s T:%s V:%s}",
-					idleTimeout, myAppid, group, hisAppid, topic, ver)
-				return nil
-			}
+				select {
+				case <-clientGoneCh:
+					// FIXME access log will not be able to record this behavior
+					return ErrClientGone
 
-			w.WriteHeader(http.StatusNoContent)
-			w.Write([]byte{}) // without this, client cant get response
-			return nil
+				case <-this.gw.shutdownCh:
+					// don't call me again
+					w.Header().Set("Connection", "close")
 
-		case msg, ok := <-fetcher.Messages():
-			if !ok {
-				return ErrClientKilled
-			}
+					if !chunkedEver {
+						w.WriteHeader(http.StatusNoContent)
+						w.Write([]byte{})
+					}
 
-			if Options.AuditSub {
-				this.auditor.Trace("sub[%s/%s] %s(%s) {T:%s/%d O:%d}",
-					myAppid, group, r.RemoteAddr, realIp, msg.Topic, msg.Partition, msg.Offset)
-			}
+					return nil
 
-			partition := strconv.FormatInt(int64(msg.Partition), 10)
+				case err := <-fetcher.Errors():
+					// e,g. consume a non-existent topic
+					// e,g. conn with broker is broken
+					// e,g. kafka: error while consuming foobar/0: EOF
+					// e,g. kafka: error while consuming foobar/2: read tcp 10.1.1.1:60088->10.1.1.2:11005: i/o timeout
+					return err
 
-			if limit == 1 {
-				w.Header().Set("Content-Type", "text/plain; charset=utf8") // override middleware header
-				w.Header().Set(HttpHeaderMsgKey, string(msg.Key))
-				w.Header().Set(HttpHeaderPartition, partition)
-				w.Header().Set(HttpHeaderOffset, strconv.FormatInt(msg.Offset, 10))
-			}
+				case <-this.timer.After(idleTimeout):
+					if chunkedEver {
+						// response already sent in chunk
+						log.Debug("chunked sub idle timeout %s {A:%s/G:%s->A:%s T:%s V:%s}",
+							idleTimeout, myAppid, group, hisAppid, topic, ver)
+						return nil
+					}
 
-			var (
-				tags    []string
-				bodyIdx int
-				err     error
-			)
-			if IsTaggedMessage(msg.Value) {
-				tags, bodyIdx, err = ExtractMessageTag(msg.Value)
-				if err != nil {
-					// always move offset cursor ahead, otherwise will be blocked forever
-					fetcher.CommitUpto(msg)
+					w.WriteHeader(http.StatusNoContent)
+					w.Write([]byte{}) // without this, client cant get response
+					return nil
 
-					return err
+				case msg, ok = <-fetcher.Messages():
 				}
 			}
+		}
 
-			// assert tag conditions are satisfied. if empty, feed all messages
-			if len(tagConditions) > 0 {
-				tagSatisfied := false
-				for _, t := range tags {
-					if _, present := tagConditions[t]; present {
-						tagSatisfied = true
-						break
-					}
-				}
+		if !ok {
+			return ErrClientKilled
+		}
 
-				if !tagSatisfied {
-					if !delayedAck {
-						log.Debug("sub auto commit offset with tag unmatched %s(%s) {G:%s, T:%s/%d, O:%d} %+v/%+v",
-							r.RemoteAddr, realIp, group, msg.Topic, msg.Partition, msg.Offset, tagConditions, tags)
+		if Options.AuditSub {
+			this.auditor.Trace("sub[%s/%s] %s(%s) {T:%s/%d O:%d}",
+				myAppid, group, r.RemoteAddr, realIp, msg.Topic, msg.Partition, msg.Offset)
+		}
 
-						fetcher.CommitUpto(msg)
-					}
+		partition := strconv.FormatInt(int64(msg.Partition), 10)
 
-					continue
-				}
+		if limit == 1 {
+			w.Header().Set("Content-Type", contentType) // override middleware header
+			w.Header().Set(HttpHeaderMsgKey, string(msg.Key))
+			w.Header().Set(HttpHeaderPartition, partition)
+			w.Header().Set(HttpHeaderOffset, strconv.FormatInt(msg.Offset, 10))
+			if deliveries > 1 {
+				w.Header().Set(HttpHeaderRedelivery, strconv.Itoa(deliveries-1))
+			}
+			if !delayedAck {
+				this.setResumeToken(w, resume, msg)
 			}
+		}
 
-			if limit == 1 {
-				// non-batch mode, just the message itself without meta
-				if _, err = w.Write(msg.Value[bodyIdx:]); err != nil {
-					// when remote close silently, the write still ok
-					return err
-				}
-			} else {
-				// batch mode, write MessageSet
-				// MessageSet => [Partition(int32) Offset(int64) MessageSize(int32) Message] BigEndian
-				if metaBuf == nil {
-					// initialize the reuseable buffer
-					metaBuf = make([]byte, 8)
-
-					// override the middleware added header
-					w.Header().Set("Content-Type", "application/octet-stream")
-				}
+		var (
+			tags    []string
+			bodyIdx int
+			err     error
+		)
+		if IsTaggedMessage(msg.Value) {
+			tags, bodyIdx, err = ExtractMessageTag(msg.Value)
+			if err != nil {
+				// always move offset cursor ahead, otherwise will be blocked forever
+				fetcher.CommitUpto(msg)
 
-				if err = writeI32(w, metaBuf, msg.Partition); err != nil {
-					return err
-				}
-				if err = writeI64(w, metaBuf, msg.Offset); err != nil {
-					return err
-				}
-				if err = writeI32(w, metaBuf, int32(len(msg.Value[bodyIdx:]))); err != nil {
-					return err
+				return err
+			}
+		}
+
+		// assert tag conditions are satisfied. if empty, feed all messages
+		if len(tagConditions) > 0 {
+			tagSatisfied := false
+			for _, t := range tags {
+				if _, present := tagConditions[t]; present {
+					tagSatisfied = true
+					break
 				}
-				if _, err = w.Write(msg.Value[bodyIdx:]); err != nil {
-					return err
+			}
+
+			if !tagSatisfied {
+				if !delayedAck {
+					log.Debug("sub auto commit offset with tag unmatched %s(%s) {G:%s, T:%s/%d, O:%d} %+v/%+v",
+						r.RemoteAddr, realIp, group, msg.Topic, msg.Partition, msg.Offset, tagConditions, tags)
+
+					fetcher.CommitUpto(msg)
 				}
+
+				continue
 			}
+		}
 
-			if !delayedAck {
-				log.Debug("sub[%s/%s] %s(%s) auto commit offset {%s/%d O:%d}",
-					myAppid, group, r.RemoteAddr, realIp, msg.Topic, msg.Partition, msg.Offset)
-
-				// ignore the offset commit err on purpose:
-				// during rebalance, offset commit often encounter errors because fetcher
-				// underlying partition offset tracker has changed
-				// e,g.
-				// topic has partition: 0, 1
-				// 1. got msg(p=0) from fetcher
-				// 2. rebalanced, then start consuming p=1
-				// 3. commit the msg offset, still msg(p=0) => error
-				// BUT, it has no fatal effects.
-				// The worst case is between 1-3, kateway shutdown, sub client
-				// will get 1 duplicated msg.
+		body := msg.Value[bodyIdx:]
+		if transformOnSub {
+			if body, err = this.gw.transforms.apply(transforms, true, body); err != nil {
+				// always move offset cursor ahead, otherwise will be blocked forever
 				fetcher.CommitUpto(msg)
-			} else {
-				log.Debug("sub[%s/%s] %s(%s) take off {%s/%d O:%d}",
-					myAppid, group, r.RemoteAddr, realIp, msg.Topic, msg.Partition, msg.Offset)
+
+				return err
 			}
+		}
 
-			this.subMetrics.ConsumeOk(myAppid, topic, ver)
-			this.subMetrics.ConsumedOk(hisAppid, topic, ver)
+		if jsonSchema != "" {
+			if body, err = this.gw.avroJson.decode(hisAppid+"."+topic+"."+ver, jsonSchema, body); err != nil {
+				// always move offset cursor ahead, otherwise will be blocked forever
+				fetcher.CommitUpto(msg)
 
-			n++
-			if n >= limit {
-				return nil
+				return err
 			}
+		}
 
-			// http chunked: len in hex
-			// curl CURLOPT_HTTP_TRANSFER_DECODING will auto unchunk
-			w.(http.Flusher).Flush()
+		if err = this.throttle(myAppid, group, len(body), clientGoneCh); err != nil {
+			return err
+		}
+
+		if limit == 1 {
+			// non-batch mode, just the message itself without meta
+			if _, err = w.Write(body); err != nil {
+				// when remote close silently, the write still ok
+				return err
+			}
+		} else {
+			// batch mode, write MessageSet
+			if msw == nil {
+				// the header goes out with the 1st message, the rest of the batch is in the trailer
+				if !delayedAck {
+					this.declareResumeTrailer(w, resume)
+					this.setResumeToken(w, resume, msg)
+				}
 
-			chunkedEver = true
+				msw = newMessageSetWriter(w, this.vectoredConn(w, r))
+
+				// override the middleware added header
+				w.Header().Set("Content-Type", "application/octet-stream")
+			}
 
-			if n == 1 {
-				log.Debug("sub idle timeout %s->1s %s(%s) {G:%s, T:%s/%d, O:%d B:%d}",
-					idleTimeout, r.RemoteAddr, realIp, group, msg.Topic, msg.Partition, msg.Offset, limit)
-				idleTimeout = time.Second
+			if err = msw.WriteMessage(msg.Partition, msg.Offset, body); err != nil {
+				return err
 			}
 
+			if !delayedAck && resume != nil {
+				resume.advance(msg.Partition, msg.Offset)
+			}
+		}
+
+		if !delayedAck {
+			log.Debug("sub[%s/%s] %s(%s) auto commit offset {%s/%d O:%d}",
+				myAppid, group, r.RemoteAddr, realIp, msg.Topic, msg.Partition, msg.Offset)
+
+			// ignore the offset commit err on purpose:
+			// during rebalance, offset commit often encounter errors because fetcher
+			// underlying partition offset tracker has changed
+			// e,g.
+			// topic has partition: 0, 1
+			// 1. got msg(p=0) from fetcher
+			// 2. rebalanced, then start consuming p=1
+			// 3. commit the msg offset, still msg(p=0) => error
+			// BUT, it has no fatal effects.
+			// The worst case is between 1-3, kateway shutdown, sub client
+			// will get 1 duplicated msg.
+			fetcher.CommitUpto(msg)
+		} else {
+			log.Debug("sub[%s/%s] %s(%s) take off {%s/%d O:%d} #%d",
+				myAppid, group, r.RemoteAddr, realIp, msg.Topic, msg.Partition, msg.Offset, deliveries)
+
+			if redeliver {
+				this.redelivery.delivered(cluster, realGroup, msg, deliveries, Options.SubAckTimeout, time.Now())
+				if deliveries > 1 {
+					this.subMetrics.Redelivered(myAppid, topic, ver)
+				}
+			}
+		}
+
+		this.subMetrics.ConsumeOk(myAppid, topic, ver)
+		this.subMetrics.ConsumedOk(hisAppid, topic, ver)
+
+		n++
+		if n >= limit {
+			return nil
+		}
+
+		// flushed before waiting for the next message
+		unflushed = true
+		chunkedEver = true
+
+		if n == 1 {
+			log.Debug("sub idle timeout %s->1s %s(%s) {G:%s, T:%s/%d, O:%d B:%d}",
+				idleTimeout, r.RemoteAddr, realIp, group, msg.Topic, msg.Partition, msg.Offset, limit)
+			idleTimeout = time.Second
 		}
 	}
 }
+
+// buryUnacked moves a message that reached max redeliveries to the next stage of the group
+// retry chain, or to the dead shadow queue.
+// If the group has no dead shadow queue, the message is dropped.
+func (this *subServer) buryUnacked(um *unackedMessage, myAppid, group, realIp,
+	cluster, realGroup string, buryTo *retryHop) error {
+	msg := um.msg
+	if buryTo == nil {
+		log.Warn("sub[%s/%s] (%s) {%s/%d O:%d} dropped after %d deliveries: no dead shadow queue",
+			myAppid, group, realIp, msg.Topic, msg.Partition, msg.Offset, um.deliveries)
+		return nil
+	}
+
+	if err := buryTo.send(cluster, msg.Key, msg.Value); err != nil {
+		log.Error("sub[%s/%s] (%s) {%s/%d O:%d} -> %s: %v",
+			myAppid, group, realIp, msg.Topic, msg.Partition, msg.Offset, buryTo.topic, err)
+
+		// try again later
+		this.redelivery.delivered(cluster, realGroup, msg, um.deliveries, Options.SubAckTimeout, time.Now())
+		return err
+	}
+
+	log.Warn("sub[%s/%s] (%s) {%s/%d O:%d} moved to %s after %d deliveries",
+		myAppid, group, realIp, msg.Topic, msg.Partition, msg.Offset, buryTo.topic, um.deliveries)
+	return nil
+}
@@ -0,0 +1,411 @@
+package gateway
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/cmd/kateway/meta"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+	"github.com/funkygao/httprouter"
+	log "github.com/funkygao/log4go"
+)
+
+//go:generate goannotation $GOFILE
+// @rest GET /v1/assigned/msgs/:appid/:topic/:ver?group=xx&partitions=0,2&offsets=0:100,2:300&batch=10&reset=<newest|oldest>
+// Sub the partitions without joining the group, see sub_assign.go
+func (this *subServer) subAssignedHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var (
+		topic     string
+		ver       string
+		myAppid   string
+		hisAppid  string
+		group     string
+		realGroup string
+		rawTopic  string
+		limit     int // max messages to include in the message set
+		err       error
+	)
+
+	if !Options.DisableMetrics {
+		this.subMetrics.SubTryQps.Mark(1)
+	}
+
+	query := r.URL.Query()
+	group = query.Get("group")
+	myAppid = r.Header.Get(HttpHeaderAppid)
+	realGroup = myAppid + "." + group
+	realIp := getHttpRemoteIp(r)
+
+	if !manager.Default.ValidateGroupName(r.Header, group) {
+		log.Error("sub assigned -(%s): illegal group: %s", realIp, group)
+		this.subMetrics.ClientError.Mark(1)
+		writeBadRequest(w, "illegal group")
+		return
+	}
+
+	limit, err = getHttpQueryInt(&query, "batch", 1)
+	if err != nil {
+		log.Error("sub assigned -(%s): illegal batch: %v", realIp, err)
+		this.subMetrics.ClientError.Mark(1)
+		writeBadRequest(w, "illegal batch")
+		return
+	}
+	if limit > Options.MaxSubBatchSize && Options.MaxSubBatchSize > 0 {
+		limit = Options.MaxSubBatchSize
+	}
+
+	ver = params.ByName(UrlParamVersion)
+	topic = params.ByName(UrlParamTopic)
+	hisAppid = params.ByName(UrlParamAppid)
+
+	if err = authSub(r, myAppid, hisAppid, topic, ver, group); err != nil {
+		log.Error("sub assigned[%s/%s] -(%s): {%s.%s.%s UA:%s} %v",
+			myAppid, group, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"), err)
+
+		this.subMetrics.ClientError.Mark(1)
+		writeAuthFailure(w, err)
+		return
+	}
+
+	cluster, found := manager.Default.LookupCluster(hisAppid)
+	if !found {
+		log.Error("sub assigned[%s/%s] -(%s): {%s.%s.%s UA:%s} cluster not found",
+			myAppid, group, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"))
+
+		this.subMetrics.ClientError.Mark(1)
+		writeBadRequest(w, "invalid appid")
+		return
+	}
+
+	rawTopic = manager.Default.KafkaTopic(hisAppid, topic, ver)
+	partitions, err := parseAssignedPartitions(query.Get("partitions"), meta.Default.TopicPartitions(cluster, rawTopic))
+	if err != nil {
+		log.Error("sub assigned[%s/%s] -(%s): {%s P:%s} %v", myAppid, group, realIp, rawTopic, query.Get("partitions"), err)
+
+		this.subMetrics.ClientError.Mark(1)
+		writeBadRequest(w, err.Error())
+		return
+	}
+	explicit, err := parseAssignedOffsets(query.Get("offsets"))
+	if err != nil {
+		log.Error("sub assigned[%s/%s] -(%s): {%s O:%s} %v", myAppid, group, realIp, rawTopic, query.Get("offsets"), err)
+
+		this.subMetrics.ClientError.Mark(1)
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	var committed map[string]int64
+	if len(explicit) < len(partitions) {
+		committed = meta.Default.ZkCluster(cluster).ConsumerOffsetsOfGroup(realGroup)[rawTopic]
+	}
+	positions, err := assignedPositions(partitions, explicit, committed, query.Get("reset"))
+	if err != nil {
+		log.Error("sub assigned[%s/%s] -(%s): {%s P:%s O:%s} %v",
+			myAppid, group, realIp, rawTopic, query.Get("partitions"), query.Get("offsets"), err)
+
+		this.subMetrics.ClientError.Mark(1)
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	log.Debug("sub assigned[%s/%s] %s(%s) {%s batch:%d positions:%+v UA:%s}",
+		myAppid, group, r.RemoteAddr, realIp, rawTopic, limit, positions, r.Header.Get("User-Agent"))
+
+	if !Options.DisableMetrics {
+		this.subMetrics.SubQps.Mark(1)
+	}
+
+	fetcher, err := store.DefaultSubStore.FetchPartitions(cluster, rawTopic, positions)
+	if err != nil {
+		log.Error("sub assigned[%s/%s] -(%s): {%s UA:%s} %v",
+			myAppid, group, realIp, rawTopic, r.Header.Get("User-Agent"), err)
+
+		if store.DefaultSubStore.IsSystemError(err) {
+			this.subMetrics.ServerError.Mark(1)
+			writeStoreError(w, err.Error())
+		} else {
+			this.subMetrics.ClientError.Mark(1)
+			writeBadRequest(w, err.Error())
+		}
+
+		return
+	}
+
+	var gz *gzip.Writer
+	w, gz = gzipWriter(w, r)
+	err = this.pumpAssignedMessages(w, r, fetcher, limit, myAppid, hisAppid, topic, ver, group)
+	if err != nil {
+		// e,g. broken pipe, io timeout, client gone
+		log.Error("sub assigned[%s/%s] %s(%s) {%s UA:%s} %v",
+			myAppid, group, r.RemoteAddr, realIp, rawTopic, r.Header.Get("User-Agent"), err)
+
+		if err != ErrClientGone {
+			if store.DefaultSubStore.IsSystemError(err) {
+				this.subMetrics.ServerError.Mark(1)
+				writeStoreError(w, err.Error())
+			} else {
+				this.subMetrics.ClientError.Mark(1)
+				writeBadRequest(w, err.Error())
+			}
+		}
+	}
+
+	// the partitions are consumed per request, nothing is kept across requests
+	if err = fetcher.Close(); err != nil {
+		log.Error("sub assigned[%s/%s] %s(%s) %s %v", myAppid, group, r.RemoteAddr, realIp, rawTopic, err)
+	}
+
+	if gz != nil {
+		gz.Close()
+	}
+}
+
+func (this *subServer) pumpAssignedMessages(w http.ResponseWriter, r *http.Request, fetcher store.Fetcher,
+	limit int, myAppid, hisAppid, topic, ver, group string) error {
+	cn, ok := w.(http.CloseNotifier)
+	if !ok {
+		return ErrBadResponseWriter
+	}
+
+	var (
+		msw          *messageSetWriter // batch mode only
+		n            = 0
+		idleTimeout  = Options.SubTimeout
+		chunkedEver  = false
+		clientGoneCh = cn.CloseNotify()
+	)
+	defer func() {
+		if msw != nil {
+			// deliver the pending messages on any exit
+			msw.Flush()
+			msw.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-clientGoneCh:
+			return ErrClientGone
+
+		case <-this.gw.shutdownCh:
+			// don't call me again
+			w.Header().Set("Connection", "close")
+
+			if !chunkedEver {
+				w.WriteHeader(http.StatusNoContent)
+				w.Write([]byte{})
+			}
+
+			return nil
+
+		case err := <-fetcher.Errors():
+			// e,g. conn with broker is broken
+			return err
+
+		case <-this.timer.After(idleTimeout):
+			if chunkedEver {
+				return nil
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			w.Write([]byte{}) // without this, client cant get response
+			return nil
+
+		case msg, ok := <-fetcher.Messages():
+			if !ok {
+				return ErrClientKilled
+			}
+
+			body := msg.Value
+			if IsTaggedMessage(msg.Value) {
+				// the client sees the message body only, the same as Sub
+				_, bodyIdx, err := ExtractMessageTag(msg.Value)
+				if err != nil {
+					return err
+				}
+				body = msg.Value[bodyIdx:]
+			}
+
+			if err := this.throttle(myAppid, group, len(body), clientGoneCh); err != nil {
+				return err
+			}
+
+			if limit == 1 {
+				w.Header().Set("Content-Type", "text/plain; charset=utf8") // override middleware header
+				w.Header().Set(HttpHeaderMsgKey, string(msg.Key))
+				w.Header().Set(HttpHeaderPartition, strconv.FormatInt(int64(msg.Partition), 10))
+				w.Header().Set(HttpHeaderOffset, strconv.FormatInt(msg.Offset, 10))
+
+				// non-batch mode, just the message itself without meta
+				if _, err := w.Write(body); err != nil {
+					return err
+				}
+			} else {
+				// batch mode, write MessageSet
+				if msw == nil {
+					msw = newMessageSetWriter(w, this.vectoredConn(w, r))
+
+					// override the middleware added header
+					w.Header().Set("Content-Type", "application/octet-stream")
+				}
+
+				if err := msw.WriteMessage(msg.Partition, msg.Offset, body); err != nil {
+					return err
+				}
+			}
+
+			this.subMetrics.ConsumeOk(myAppid, topic, ver)
+			this.subMetrics.ConsumedOk(hisAppid, topic, ver)
+
+			n++
+			if n >= limit {
+				return nil
+			}
+
+			if msw != nil {
+				if err := msw.Flush(); err != nil {
+					return err
+				}
+			}
+
+			// http chunked: len in hex
+			// curl CURLOPT_HTTP_TRANSFER_DECODING will auto unchunk
+			w.(http.Flusher).Flush()
+
+			chunkedEver = true
+			idleTimeout = time.Second
+		}
+	}
+}
+
+//go:generate goannotation $GOFILE
+// @rest GET /v1/assigned/offsets/:appid/:topic/:ver/:group
+// committed offsets of the group, the next offset to consume of each partition
+func (this *subServer) assignedOffsetsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var (
+		topic    string
+		ver      string
+		myAppid  string
+		hisAppid string
+		group    string
+		err      error
+	)
+
+	group = params.ByName(UrlParamGroup)
+	ver = params.ByName(UrlParamVersion)
+	topic = params.ByName(UrlParamTopic)
+	hisAppid = params.ByName(UrlParamAppid)
+	myAppid = r.Header.Get(HttpHeaderAppid)
+
+	if err = authSub(r, myAppid, hisAppid, topic, ver, group); err != nil {
+		writeAuthFailure(w, err)
+		return
+	}
+
+	cluster, found := manager.Default.LookupCluster(hisAppid)
+	if !found {
+		writeBadRequest(w, "invalid appid")
+		return
+	}
+
+	rawTopic := manager.Default.KafkaTopic(hisAppid, topic, ver)
+	committed := meta.Default.ZkCluster(cluster).ConsumerOffsetsOfGroup(myAppid + "." + group)[rawTopic]
+	offsets := make([]assignedOffset, 0, len(committed))
+	for _, p := range meta.Default.TopicPartitions(cluster, rawTopic) {
+		if offset, present := committed[strconv.Itoa(int(p))]; present {
+			offsets = append(offsets, assignedOffset{Partition: p, Offset: offset})
+		}
+	}
+	sort.Sort(assignedOffsets(offsets))
+
+	b, _ := json.Marshal(offsets)
+	w.Write(b)
+}
+
+//go:generate goannotation $GOFILE
+// @rest PUT /v1/assigned/offsets/:appid/:topic/:ver/:group with json body [{"partition":0,"offset":100}]
+// commits the next offset to consume of each partition synchronously
+func (this *subServer) commitAssignedOffsetsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var (
+		topic    string
+		ver      string
+		myAppid  string
+		hisAppid string
+		group    string
+		err      error
+	)
+
+	group = params.ByName(UrlParamGroup)
+	ver = params.ByName(UrlParamVersion)
+	topic = params.ByName(UrlParamTopic)
+	hisAppid = params.ByName(UrlParamAppid)
+	myAppid = r.Header.Get(HttpHeaderAppid)
+
+	if err = authSub(r, myAppid, hisAppid, topic, ver, group); err != nil {
+		writeAuthFailure(w, err)
+		return
+	}
+
+	cluster, found := manager.Default.LookupCluster(hisAppid)
+	if !found {
+		writeBadRequest(w, "invalid appid")
+		return
+	}
+
+	var offsets []assignedOffset
+	if err = json.NewDecoder(io.LimitReader(r.Body, Options.MaxPubSize)).Decode(&offsets); err != nil {
+		writeBadRequest(w, "invalid offsets json body")
+		return
+	}
+
+	realIp := getHttpRemoteIp(r)
+	realGroup := myAppid + "." + group
+	rawTopic := manager.Default.KafkaTopic(hisAppid, topic, ver)
+	valid := make(map[int32]bool)
+	for _, p := range meta.Default.TopicPartitions(cluster, rawTopic) {
+		valid[p] = true
+	}
+	for _, o := range offsets {
+		if !valid[o.Partition] {
+			writeBadRequest(w, ErrInvalidPartition.Error())
+			return
+		}
+		if o.Offset < 0 {
+			writeBadRequest(w, ErrInvalidOffset.Error())
+			return
+		}
+	}
+
+	if onlineN, e := meta.Default.OnlineConsumersCount(cluster, rawTopic, realGroup); e != nil {
+		writeServerError(w, e.Error())
+		return
+	} else if onlineN > 0 {
+		log.Warn("commit assigned[%s/%s] %s(%s) {%s} %d online consumers",
+			myAppid, group, r.RemoteAddr, realIp, rawTopic, onlineN)
+
+		writeBadRequest(w, ErrGroupOnline.Error())
+		return
+	}
+
+	log.Debug("commit assigned[%s/%s] %s(%s) {%s} %+v", myAppid, group, r.RemoteAddr, realIp, rawTopic, offsets)
+
+	zkcluster := meta.Default.ZkCluster(cluster)
+	for _, o := range offsets {
+		if err = zkcluster.SetConsumerGroupOffset(rawTopic, realGroup, strconv.Itoa(int(o.Partition)), o.Offset); err != nil {
+			log.Error("commit assigned[%s/%s] %s(%s) {%s/%d O:%d} %v",
+				myAppid, group, r.RemoteAddr, realIp, rawTopic, o.Partition, o.Offset, err)
+
+			writeServerError(w, err.Error())
+			return
+		}
+	}
+
+	w.Write(ResponseOk)
+}
@@ -14,8 +14,10 @@ import (
 )
 
 //go:generate goannotation $GOFILE
-// @rest PUT /v1/msgs/:appid/:topic/:ver?group=xx&q=<dead|retry>
+// @rest PUT /v1/msgs/:appid/:topic/:ver?group=xx&q=<dead|retry|retry.5s>
 // q=retry&X-Bury=dead means bury from retry queue to dead queue
+// If the group has a retry chain, X-Bury=retry schedules the message into the next retry stage,
+// e,g. from q=retry.5s into q=retry.1m after 1m, and into the dead queue after the last stage.
 func (this *subServer) buryHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	var (
 		topic      string
@@ -47,7 +49,7 @@ func (this *subServer) buryHandler(w http.ResponseWriter, r *http.Request, param
 	realIp := getHttpRemoteIp(r)
 
 	bury = r.Header.Get(HttpHeaderMsgBury)
-	if !sla.ValidateShadowName(bury) {
+	if !sla.ValidateShadowName(bury) || sla.IsRetryStageShadow(bury) {
 		log.Error("bury[%s/%s] %s(%s) {%s.%s.%s UA:%s} illegal bury: %s",
 			myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"), bury)
 
@@ -140,7 +142,7 @@ func (this *subServer) buryHandler(w http.ResponseWriter, r *http.Request, param
 	}
 
 	fetcher, err := store.DefaultSubStore.Fetch(cluster, rawTopic,
-		myAppid+"."+group, r.RemoteAddr, realIp, "", Options.PermitStandbySub)
+		myAppid+"."+group, subClientId(r, cluster, rawTopic, myAppid+"."+group), realIp, "", Options.PermitStandbySub)
 	if err != nil {
 		log.Error("bury[%s/%s] %s(%s) {%s UA:%s} %v",
 			myAppid, group, r.RemoteAddr, realIp, rawTopic, r.Header.Get("User-Agent"), err)
@@ -150,15 +152,31 @@ func (this *subServer) buryHandler(w http.ResponseWriter, r *http.Request, param
 	}
 
 	// step1: pub
-	shadowTopic := manager.Default.ShadowTopic(bury, myAppid, hisAppid, topic, ver, group)
-	_, _, err = store.DefaultPubStore.SyncPub(cluster, shadowTopic, nil, msg)
-	if err != nil {
-		log.Error("bury[%s/%s] %s(%s) %s %v", myAppid, group, r.RemoteAddr, realIp, shadowTopic, err)
+	// if the group has a retry chain, retry means the next stage of the chain
+	var hop *retryHop
+	if bury == sla.SlaKeyRetryTopic {
+		if hop, err = this.nextRetryHop(cluster, myAppid, hisAppid, topic, ver, group, shadow); err != nil {
+			log.Error("bury[%s/%s] %s(%s) %s retry chain: %v", myAppid, group, r.RemoteAddr, realIp, rawTopic, err)
+
+			writeServerError(w, err.Error())
+			return
+		}
+	}
+	if hop == nil {
+		hop = &retryHop{topic: manager.Default.ShadowTopic(bury, myAppid, hisAppid, topic, ver, group)}
+	}
+	if err = hop.send(cluster, nil, msg); err != nil {
+		log.Error("bury[%s/%s] %s(%s) %s %v", myAppid, group, r.RemoteAddr, realIp, hop.topic, err)
 
 		writeServerError(w, err.Error())
 		return
 	}
 
+	if hop.delay > 0 {
+		log.Debug("bury[%s/%s] %s(%s) {%s/%s O:%s} -> %s after %s",
+			myAppid, group, r.RemoteAddr, realIp, rawTopic, partition, offset, hop.topic, hop.delay)
+	}
+
 	// step2: skip this message in the master topic TODO atomic with step1
 	if err = fetcher.CommitUpto(&sarama.ConsumerMessage{
 		Topic:     rawTopic,
@@ -58,12 +58,21 @@ func (this *subServer) subRawHandler(w http.ResponseWriter, r *http.Request, par
 	log.Debug("sub raw[%s/%s] %s(%s) {%s/%s batch:%d UA:%s}",
 		myAppid, group, r.RemoteAddr, realIp, cluster, topic, limit, r.Header.Get("User-Agent"))
 
+	if err = manager.Default.AuthRaw(myAppid, cluster); err != nil {
+		log.Error("sub raw[%s/%s] %s(%s) {%s/%s UA:%s} %v",
+			myAppid, group, r.RemoteAddr, realIp, cluster, topic, r.Header.Get("User-Agent"), err)
+
+		this.subMetrics.ClientError.Mark(1)
+		writeAuthFailure(w, err)
+		return
+	}
+
 	if !Options.DisableMetrics {
 		this.subMetrics.SubQps.Mark(1)
 	}
 
 	fetcher, err := store.DefaultSubStore.Fetch(cluster, topic,
-		myAppid+"."+group, r.RemoteAddr, realIp, reset, Options.PermitStandbySub)
+		myAppid+"."+group, subClientId(r, cluster, topic, myAppid+"."+group), realIp, reset, Options.PermitStandbySub)
 	if err != nil {
 		// e,g. kafka was totally shutdown
 		// e,g. too many consumers for the same group
@@ -71,7 +80,7 @@ func (this *subServer) subRawHandler(w http.ResponseWriter, r *http.Request, par
 			myAppid, group, r.RemoteAddr, realIp, cluster, topic, limit, r.Header.Get("User-Agent"), err)
 
 		if store.DefaultSubStore.IsSystemError(err) {
-			writeServerError(w, err.Error())
+			writeStoreError(w, err.Error())
 		} else {
 			writeBadRequest(w, err.Error())
 		}
@@ -90,7 +99,7 @@ func (this *subServer) subRawHandler(w http.ResponseWriter, r *http.Request, par
 
 		if err != ErrClientGone {
 			if store.DefaultSubStore.IsSystemError(err) {
-				writeServerError(w, err.Error())
+				writeStoreError(w, err.Error())
 			} else {
 				writeBadRequest(w, err.Error())
 			}
@@ -116,12 +125,19 @@ func (this *subServer) pumpRawMessages(w http.ResponseWriter, r *http.Request, r
 	}
 
 	var (
-		n                   = 0
-		idleTimeout         = Options.SubTimeout
-		chunkedEver         = false
-		clientGoneCh        = cn.CloseNotify()
-		metaBuf      []byte = nil
+		msw          *messageSetWriter // batch mode only
+		n            = 0
+		idleTimeout  = Options.SubTimeout
+		chunkedEver  = false
+		clientGoneCh = cn.CloseNotify()
 	)
+	defer func() {
+		if msw != nil {
+			// deliver the pending messages on any exit
+			msw.Flush()
+			msw.Close()
+		}
+	}()
 
 	for {
 		select {
@@ -161,6 +177,10 @@ func (this *subServer) pumpRawMessages(w http.ResponseWriter, r *http.Request, r
 				return ErrClientKilled
 			}
 
+			if err := this.throttle(myAppid, group, len(msg.Value), clientGoneCh); err != nil {
+				return err
+			}
+
 			if limit == 1 {
 				partition := strconv.FormatInt(int64(msg.Partition), 10)
 
@@ -178,25 +198,14 @@ func (this *subServer) pumpRawMessages(w http.ResponseWriter, r *http.Request, r
 				fetcher.CommitUpto(msg)
 			} else {
 				// batch mode, write MessageSet
-				// MessageSet => [Partition(int32) Offset(int64) MessageSize(int32) Message] BigEndian
-				if metaBuf == nil {
-					// initialize the reuseable buffer
-					metaBuf = make([]byte, 8)
+				if msw == nil {
+					msw = newMessageSetWriter(w, this.vectoredConn(w, r))
 
 					// override the middleware added header
 					w.Header().Set("Content-Type", "application/octet-stream")
 				}
 
-				if err := writeI32(w, metaBuf, msg.Partition); err != nil {
-					return err
-				}
-				if err := writeI64(w, metaBuf, msg.Offset); err != nil {
-					return err
-				}
-				if err := writeI32(w, metaBuf, int32(len(msg.Value))); err != nil {
-					return err
-				}
-				if _, err := w.Write(msg.Value); err != nil {
+				if err := msw.WriteMessage(msg.Partition, msg.Offset, msg.Value); err != nil {
 					return err
 				}
 			}
@@ -206,6 +215,12 @@ func (this *subServer) pumpRawMessages(w http.ResponseWriter, r *http.Request, r
 				return nil
 			}
 
+			if msw != nil {
+				if err := msw.Flush(); err != nil {
+					return err
+				}
+			}
+
 			// http chunked: len in hex
 			// curl CURLOPT_HTTP_TRANSFER_DECODING will auto unchunk
 			w.(http.Flusher).Flush()
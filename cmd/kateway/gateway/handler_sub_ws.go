@@ -55,8 +55,7 @@ func (this *subServer) subWsHandler(w http.ResponseWriter, r *http.Request, para
 	hisAppid = params.ByName(UrlParamAppid)
 	myAppid = r.Header.Get(HttpHeaderAppid)
 	realIp := getHttpRemoteIp(r)
-	if err = manager.Default.AuthSub(myAppid, r.Header.Get(HttpHeaderSubkey),
-		hisAppid, topic, group); err != nil {
+	if err = authSub(r, myAppid, hisAppid, topic, ver, group); err != nil {
 		log.Error("consumer[%s] %s {hisapp:%s, topic:%s, ver:%s, group:%s, limit:%d}: %s",
 			myAppid, r.RemoteAddr, hisAppid, topic, ver, group, limit, err)
 
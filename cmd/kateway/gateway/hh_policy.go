@@ -0,0 +1,15 @@
+package gateway
+
+import (
+	"github.com/funkygao/gafka/cmd/kateway/hh"
+)
+
+// hhBypassed returns whether Pub of cluster/topic bypasses hinted handoff by policy:
+// it fails fast instead of being spooled for delayed delivery.
+func hhBypassed(cluster, rawTopic string) bool {
+	if p, ok := hh.Default.(hh.Policer); ok {
+		return !p.Enabled(cluster, rawTopic)
+	}
+
+	return false
+}
@@ -0,0 +1,138 @@
+package gateway
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type inflightRequest struct {
+	id      uint64
+	r       *http.Request
+	appid   string
+	startAt time.Time
+}
+
+// inflightRequests tracks the requests being served to diagnose stuck long polls and
+// hung Pub calls.
+type inflightRequests struct {
+	seq uint64
+
+	mu       sync.Mutex
+	requests map[uint64]*inflightRequest
+}
+
+func newInflightRequests() *inflightRequests {
+	return &inflightRequests{requests: make(map[uint64]*inflightRequest, 1000)}
+}
+
+func (this *inflightRequests) add(r *http.Request) *inflightRequest {
+	req := &inflightRequest{
+		id:      atomic.AddUint64(&this.seq, 1),
+		r:       r,
+		appid:   r.Header.Get(HttpHeaderAppid),
+		startAt: time.Now(),
+	}
+
+	this.mu.Lock()
+	this.requests[req.id] = req
+	this.mu.Unlock()
+	return req
+}
+
+func (this *inflightRequests) remove(req *inflightRequest) {
+	this.mu.Lock()
+	delete(this.requests, req.id)
+	this.mu.Unlock()
+}
+
+type inflightRequestInfo struct {
+	Method string `json:"method"`
+	Uri    string `json:"uri"`
+	Appid  string `json:"appid"`
+	Remote string `json:"remote"`
+	Age    string `json:"age"`
+
+	age time.Duration
+}
+
+// dump returns requests inflight longer than minAge, the oldest first.
+func (this *inflightRequests) dump(minAge time.Duration) []inflightRequestInfo {
+	now := time.Now()
+	r := make([]inflightRequestInfo, 0)
+
+	this.mu.Lock()
+	for _, req := range this.requests {
+		age := now.Sub(req.startAt)
+		if age < minAge {
+			continue
+		}
+
+		r = append(r, inflightRequestInfo{
+			Method: req.r.Method,
+			Uri:    req.r.RequestURI,
+			Appid:  req.appid,
+			Remote: getHttpRemoteIp(req.r),
+			Age:    age.String(),
+			age:    age,
+		})
+	}
+	this.mu.Unlock()
+
+	sort.Sort(inflightRequestsByAge(r))
+	return r
+}
+
+type inflightRequestsByAge []inflightRequestInfo
+
+func (s inflightRequestsByAge) Len() int           { return len(s) }
+func (s inflightRequestsByAge) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s inflightRequestsByAge) Less(i, j int) bool { return s[i].age > s[j].age }
+
+// logSlowRequest records the request to slow log if it is slower than threshold, with the latency
+// broken down into handling before the response header and writing the response body.
+func (this *Gateway) logSlowRequest(req *inflightRequest, ww WriterWrapper, threshold time.Duration) {
+	now := time.Now()
+	total := now.Sub(req.startAt)
+	if total < threshold || ww.Status() == http.StatusNoContent {
+		// 204 is the idle long poll of Sub, slow as expected
+		return
+	}
+
+	handle := total
+	if at := ww.HeaderWrittenAt(); !at.IsZero() {
+		handle = at.Sub(req.startAt)
+	}
+
+	appid := req.appid
+	if appid == "" {
+		appid = "-"
+	}
+
+	// slow requests are rare, and the line is queued to logger so can't be recycled here
+	buf := make([]byte, 0, 256)
+	buf = append(buf, now.Format("2006-01-02 15:04:05.000")...)
+	buf = append(buf, ' ')
+	buf = append(buf, spanName(req.r)...)
+	buf = append(buf, " uri:"...)
+	buf = append(buf, req.r.RequestURI...)
+	buf = append(buf, " appid:"...)
+	buf = append(buf, appid...)
+	buf = append(buf, " remote:"...)
+	buf = append(buf, getHttpRemoteIp(req.r)...)
+	buf = append(buf, " status:"...)
+	buf = append(buf, strconv.Itoa(ww.Status())...)
+	buf = append(buf, " bytes:"...)
+	buf = append(buf, strconv.Itoa(ww.BytesWritten())...)
+	buf = append(buf, " total:"...)
+	buf = append(buf, total.String()...)
+	buf = append(buf, " handle:"...)
+	buf = append(buf, handle.String()...)
+	buf = append(buf, " write:"...)
+	buf = append(buf, (total - handle).String()...)
+	buf = append(buf, '\n')
+	this.slowLogger.Log(buf)
+}
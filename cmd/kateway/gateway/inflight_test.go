@@ -0,0 +1,33 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestInflightRequestsDump(t *testing.T) {
+	reqs := newInflightRequests()
+
+	r1, _ := http.NewRequest("GET", "/v1/msgs/app1/foobar/v1?group=g1", nil)
+	r1.Header.Set(HttpHeaderAppid, "app2")
+	old := reqs.add(r1)
+	old.startAt = old.startAt.Add(-time.Minute)
+
+	r2, _ := http.NewRequest("POST", "/v1/msgs/foobar/v1", nil)
+	recent := reqs.add(r2)
+
+	dump := reqs.dump(0)
+	assert.Equal(t, 2, len(dump))
+	assert.Equal(t, "GET", dump[0].Method) // the oldest first
+	assert.Equal(t, "app2", dump[0].Appid)
+	assert.Equal(t, "POST", dump[1].Method)
+
+	assert.Equal(t, 1, len(reqs.dump(time.Second)))
+
+	reqs.remove(old)
+	reqs.remove(recent)
+	assert.Equal(t, 0, len(reqs.dump(0)))
+}
@@ -98,6 +98,10 @@ type limitListenerConn struct {
 	name        string
 }
 
+func (c *limitListenerConn) unwrap() net.Conn {
+	return c.Conn
+}
+
 func (c *limitListenerConn) Close() error {
 	log.Debug("%s[%s] closing conn from %s", c.name, c.Conn.LocalAddr(), c.Conn.RemoteAddr())
 
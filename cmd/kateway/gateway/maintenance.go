@@ -0,0 +1,127 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/funkygao/httprouter"
+)
+
+const (
+	maintenanceDefaultRetryAfter = time.Second * 30
+	maintenanceMaxRetryAfter     = time.Hour
+)
+
+// maintenance rejects Pub with 503 and Retry-After, so that clients switch to another kateway,
+// while Sub sessions keep draining and hh keeps flushing: a clean way to migrate the cluster.
+type maintenance struct {
+	on       int32 // atomic, checked on every Pub
+	rejected int64 // atomic
+
+	mu         sync.RWMutex
+	since      time.Time
+	retryAfter time.Duration
+	redirect   string // pub addr of another kateway clients are pointed to, optional
+	reason     string
+}
+
+type maintenanceInfo struct {
+	On         bool      `json:"on"`
+	Since      time.Time `json:"since,omitempty"`
+	RetryAfter string    `json:"retry_after,omitempty"`
+	Redirect   string    `json:"redirect,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Rejected   int64     `json:"rejected"`
+
+	// the migration is safe to proceed when hh is drained
+	HhInflights int64 `json:"hh_inflights"`
+}
+
+func newMaintenance() *maintenance {
+	return &maintenance{}
+}
+
+func (this *maintenance) active() bool {
+	return atomic.LoadInt32(&this.on) == 1
+}
+
+// enter turns on maintenance mode, entering again just updates the settings.
+func (this *maintenance) enter(retryAfter time.Duration, redirect, reason string) {
+	this.mu.Lock()
+	if !this.active() {
+		this.since = time.Now()
+		atomic.StoreInt64(&this.rejected, 0)
+	}
+	this.retryAfter = retryAfter
+	this.redirect = redirect
+	this.reason = reason
+	atomic.StoreInt32(&this.on, 1)
+	this.mu.Unlock()
+}
+
+// exit turns off maintenance mode and returns whether it was on.
+func (this *maintenance) exit() bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return atomic.SwapInt32(&this.on, 0) == 1
+}
+
+func (this *maintenance) info() maintenanceInfo {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	r := maintenanceInfo{
+		On:       this.active(),
+		Rejected: atomic.LoadInt64(&this.rejected),
+	}
+	if r.On {
+		r.Since = this.since
+		r.RetryAfter = this.retryAfter.String()
+		r.Redirect = this.redirect
+		r.Reason = this.reason
+	}
+	return r
+}
+
+// reject responds 503 if in maintenance mode and returns true.
+func (this *maintenance) reject(w http.ResponseWriter) bool {
+	if !this.active() {
+		return false
+	}
+
+	atomic.AddInt64(&this.rejected, 1)
+
+	this.mu.RLock()
+	retryAfter, redirect := this.retryAfter, this.redirect
+	this.mu.RUnlock()
+
+	// Retry-After is in seconds, round up
+	w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+	if redirect != "" {
+		w.Header().Set(HttpHeaderRedirect, redirect)
+	}
+
+	// the client is expected to reconnect to another kateway
+	w.Header().Set("Connection", "close")
+	writeErrorCode(w, ErrCodeMaintenance, "kateway in maintenance", http.StatusServiceUnavailable)
+	return true
+}
+
+// pubGuard wraps the Pub handlers that are rejected in maintenance mode or shed when
+// the brokers degrade.
+func (this *Gateway) pubGuard(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if this.maintenance.reject(w) {
+			return
+		}
+		if this.pubShedder.reject(w, r.Header.Get(HttpHeaderAppid)) {
+			return
+		}
+
+		h(w, r, params)
+	}
+}
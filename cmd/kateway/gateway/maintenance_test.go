@@ -0,0 +1,44 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/httprouter"
+)
+
+func TestMaintenanceReject(t *testing.T) {
+	gw := &Gateway{maintenance: newMaintenance(), pubShedder: newPubShedder(0, 0, 10, nil)}
+	served := 0
+	h := gw.pubGuard(func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		served++
+	})
+	r, _ := http.NewRequest("POST", "/v1/msgs/foo/v1", nil)
+
+	w := httptest.NewRecorder()
+	h(w, r, nil)
+	assert.Equal(t, 1, served)
+	assert.Equal(t, false, gw.maintenance.exit())
+
+	gw.maintenance.enter(time.Millisecond*1500, "10.1.1.2:9191", "migrate")
+	w = httptest.NewRecorder()
+	h(w, r, nil)
+	assert.Equal(t, 1, served)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, "10.1.1.2:9191", w.Header().Get(HttpHeaderRedirect))
+
+	info := gw.maintenance.info()
+	assert.Equal(t, true, info.On)
+	assert.Equal(t, int64(1), info.Rejected)
+	assert.Equal(t, "migrate", info.Reason)
+
+	assert.Equal(t, true, gw.maintenance.exit())
+	w = httptest.NewRecorder()
+	h(w, r, nil)
+	assert.Equal(t, 2, served)
+	assert.Equal(t, false, gw.maintenance.info().On)
+}
@@ -25,6 +25,7 @@ type pubMetrics struct {
 	pubFailMu  sync.RWMutex
 
 	ClientError metrics.Counter
+	PubDup      metrics.Counter
 	PubQps      metrics.Meter
 	PubTryQps   metrics.Meter
 	JobQps      metrics.Meter
@@ -41,6 +42,7 @@ func NewPubMetrics(gw *Gateway) *pubMetrics {
 		PubFailMap: make(map[string]metrics.Counter),
 
 		ClientError: metrics.NewRegisteredCounter("pub.clienterr", metrics.DefaultRegistry),
+		PubDup:      metrics.NewRegisteredCounter("pub.dup", metrics.DefaultRegistry),
 		PubQps:      metrics.NewRegisteredMeter("pub.qps", metrics.DefaultRegistry),
 		PubTryQps:   metrics.NewRegisteredMeter("pub.try.qps", metrics.DefaultRegistry),
 		JobQps:      metrics.NewRegisteredMeter("job.qps", metrics.DefaultRegistry),
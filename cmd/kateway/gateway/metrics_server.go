@@ -30,6 +30,7 @@ type serverMetrics struct {
 	ConcurrentPub   metrics.Counter
 	ConcurrentSub   metrics.Counter
 	ConcurrentSubWs metrics.Counter
+	ConcurrentH2    metrics.Counter // inflight HTTP/2 streams
 }
 
 func NewServerMetrics(interval time.Duration, gw *Gateway) *serverMetrics {
@@ -40,6 +41,7 @@ func NewServerMetrics(interval time.Duration, gw *Gateway) *serverMetrics {
 		ConcurrentPub:   metrics.NewRegisteredCounter("server.conns.pub", metrics.DefaultRegistry),
 		ConcurrentSub:   metrics.NewRegisteredCounter("server.conns.sub", metrics.DefaultRegistry),
 		ConcurrentSubWs: metrics.NewRegisteredCounter("server.conns.subws", metrics.DefaultRegistry),
+		ConcurrentH2:    metrics.NewRegisteredCounter("server.streams.h2", metrics.DefaultRegistry),
 	}
 
 	if Options.DebugHttpAddr != "" {
@@ -17,6 +17,7 @@ type subMetrics struct {
 	SubTryQps   metrics.Meter
 	ClientError metrics.Meter
 	ServerError metrics.Meter
+	Throttled   metrics.Meter // Sub writes delayed by bandwidth limit
 
 	expConsumeOk      *expvar.Int
 	expActiveConns    *expvar.Int
@@ -27,17 +28,26 @@ type subMetrics struct {
 	consumeMapMu  sync.RWMutex
 	ConsumedMap   map[string]metrics.Counter // my msgs are consumed by others
 	consumedMapMu sync.RWMutex               // TODO who are consuming my msgs
+
+	// explicit ack failures of the consumers
+	RedeliverMap   map[string]metrics.Counter
+	redeliverMapMu sync.RWMutex
+	DeadMap        map[string]metrics.Counter // moved to dead letter queue after max redeliveries
+	deadMapMu      sync.RWMutex
 }
 
 func NewSubMetrics(gw *Gateway) *subMetrics {
 	this := &subMetrics{
-		gw:          gw,
-		ConsumeMap:  make(map[string]metrics.Counter),
-		ConsumedMap: make(map[string]metrics.Counter),
-		SubQps:      metrics.NewRegisteredMeter("sub.qps", metrics.DefaultRegistry),
-		SubTryQps:   metrics.NewRegisteredMeter("sub.try.qps", metrics.DefaultRegistry),
-		ClientError: metrics.NewRegisteredMeter(("sub.clienterr"), metrics.DefaultRegistry),
-		ServerError: metrics.NewRegisteredMeter("sub.servererr", metrics.DefaultRegistry),
+		gw:           gw,
+		ConsumeMap:   make(map[string]metrics.Counter),
+		ConsumedMap:  make(map[string]metrics.Counter),
+		RedeliverMap: make(map[string]metrics.Counter),
+		DeadMap:      make(map[string]metrics.Counter),
+		SubQps:       metrics.NewRegisteredMeter("sub.qps", metrics.DefaultRegistry),
+		SubTryQps:    metrics.NewRegisteredMeter("sub.try.qps", metrics.DefaultRegistry),
+		ClientError:  metrics.NewRegisteredMeter(("sub.clienterr"), metrics.DefaultRegistry),
+		ServerError:  metrics.NewRegisteredMeter("sub.servererr", metrics.DefaultRegistry),
+		Throttled:    metrics.NewRegisteredMeter("sub.throttled", metrics.DefaultRegistry),
 	}
 
 	if Options.DebugHttpAddr != "" {
@@ -102,3 +112,11 @@ func (this *subMetrics) ConsumeOk(appid, topic, ver string) {
 func (this *subMetrics) ConsumedOk(appid, topic, ver string) {
 	telemetry.UpdateCounter(appid, topic, ver, "subd.ok", 1, &this.consumedMapMu, this.ConsumedMap)
 }
+
+func (this *subMetrics) Redelivered(appid, topic, ver string) {
+	telemetry.UpdateCounter(appid, topic, ver, "sub.redeliver", 1, &this.redeliverMapMu, this.RedeliverMap)
+}
+
+func (this *subMetrics) DeadLettered(appid, topic, ver string) {
+	telemetry.UpdateCounter(appid, topic, ver, "sub.dead", 1, &this.deadMapMu, this.DeadMap)
+}
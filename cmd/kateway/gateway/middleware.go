@@ -8,9 +8,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/funkygao/gafka"
 	"github.com/funkygao/gafka/mpool"
 	"github.com/funkygao/httprouter"
 	log "github.com/funkygao/log4go"
+	"github.com/opentracing/opentracing-go/ext"
 )
 
 func (this *Gateway) middleware(h httprouter.Handle) httprouter.Handle {
@@ -25,19 +27,38 @@ func (this *Gateway) middleware(h httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 		w.Header().Set("Server", "kateway")
 
+		// request id in error response, client provided id is echoed back
+		reqId := r.Header.Get(HttpHeaderRequestId)
+		if reqId == "" || len(reqId) > maxRequestIdLen {
+			reqId = nextRequestId()
+		}
+		w.Header().Set(HttpHeaderRequestId, reqId)
+
 		// kateway response is mostly json, including error reponse
 		// for non-json response, handler can override this
 		w.Header().Set("Content-Type", "application/json; charset=utf8")
 
+		// client version inventory and policy, the server version is advertised for feature negotiation
+		if this.clients != nil {
+			if r.Header.Get(HttpHeaderClientVersion) != "" {
+				w.Header().Set(HttpHeaderServerVersion, gafka.Version)
+			}
+			if this.clients.check(w, r) {
+				return
+			}
+		}
+
 		// CORS: cross origin resource sharing
-		if origin := r.Header.Get("Origin"); origin != "" {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		this.cors.writeHeaders(w, r)
+
+		// HTTP/2 multiplexes requests over a conn, so the conn accounting can't tell the load
+		if r.ProtoMajor == 2 && !Options.DisableMetrics {
+			this.svrMetrics.ConcurrentH2.Inc(1)
+			defer this.svrMetrics.ConcurrentH2.Dec(1)
 		}
 
 		// max request per conn to rebalance the session sticky http conns
+		// for HTTP/2, Connection: close leads to GOAWAY after inflight streams are done
 		if Options.MaxRequestPerConn > 1 {
 			maxReqReached := false
 			connectionsMu.Lock()
@@ -56,19 +77,44 @@ func (this *Gateway) middleware(h httprouter.Handle) httprouter.Handle {
 			}
 		}
 
-		if !Options.EnableAccessLog {
+		if tracingEnabled() {
+			span, tr := traceRequest(r)
+			sw := SniffWriter(w)
+			w, r = sw, tr
+			defer func() {
+				ext.HTTPStatusCode.Set(span, uint16(sw.Status()))
+				span.Finish()
+			}()
+		}
+
+		if rules := this.debugTraces.matched(r, params); len(rules) > 0 {
+			// runtime debug tracing of specific appid/topic
+			tw := SniffWriter(w)
+			c := startDebugTrace(rules, r, tw)
+			w = tw
+			defer c.finish(tw)
+		}
+
+		req := this.inflight.add(r)
+		defer this.inflight.remove(req)
+
+		slowThreshold := Options.SlowRequestThreshold
+		if !Options.EnableAccessLog && slowThreshold <= 0 {
 			h(w, r, params)
 
 			return
 		}
 
 		// TODO latency histogram here
-		// TODO slow response recording here
 
 		ww := SniffWriter(w) // sniff the status and content size for logging
 		h(ww, r, params)     // delegate request to the given handle
 
-		if this.accessLogger != nil {
+		if slowThreshold > 0 {
+			this.logSlowRequest(req, ww, slowThreshold)
+		}
+
+		if Options.EnableAccessLog && this.accessLogger != nil {
 			// NCSA Common Log Format (CLF)
 			// host ident authuser date request status bytes
 
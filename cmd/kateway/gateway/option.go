@@ -34,16 +34,29 @@ var (
 		DummyCluster               string
 		InfluxServer               string
 		InfluxDbName               string
+		ZipkinCollector            string
 		KillFile                   string
 		HintedHandoffType          string
 		HintedHandoffDir           string
+		HintedHandoffReadAheads    string // per queue read ahead: cluster/topic:size,...
+		HintedHandoffPolicy        string // per queue policy: cluster/topic:on|off,...
+		SubPartner                 string
+		TransformPluginDir         string
+		ManagerSnapshot            string
+		MinClientVersion           string
+		DeprecatedClientVersion    string
+		KafkaPoolOverrides         string
 		AllwaysHintedHandoff       bool
 		ShowVersion                bool
 		Ratelimit                  bool
 		PermitStandbySub           bool
+		SubWritev                  bool
 		DisableMetrics             bool
 		EnableHintedHandoff        bool
 		HintedHandoffBufio         bool
+		HintedHandoffBatch         bool
+		HintedHandoffAuditJSON     bool
+		HintedHandoffNoMigrate     bool
 		FlushHintedOffOnly         bool
 		BadGroupRateLimit          bool
 		BadPubAppRateLimit         bool
@@ -60,6 +73,10 @@ var (
 		UseCompress                bool
 		Debug                      bool
 		EnableRegistry             bool
+		DisableTransform           bool
+		EnableHttp2                bool
+		StrictStartup              bool
+		TraceSampleRate            float64
 		HttpHeaderMaxBytes         int
 		MaxPubSize                 int64
 		MaxJobSize                 int64
@@ -67,14 +84,25 @@ var (
 		MaxMsgTagLen               int
 		MinPubSize                 int
 		PubQpsLimit                int64
+		ReadyMaxHhInflights        int64
+		SubBandwidthLimit          int64 // bytes per second, 0 means unlimited
 		MaxSubBatchSize            int
+		SubPrefetch                int
+		SubMaxRedelivery           int
+		HintedHandoffKeyId         int
+		HintedHandoffReadAhead     int
+		HintedHandoffFormat        int
 		MaxClients                 int
+		Http2MaxStreams            int
 		MaxRequestPerConn          int // to make load balancer distribute request even for persistent conn
 		PubPoolCapcity             int
+		KafkaClients               int
 		AssignJobShardId           int // how to assign shard id for new app
 		PubPoolIdleTimeout         time.Duration
 		SubTimeout                 time.Duration
+		SubAckTimeout              time.Duration
 		OffsetCommitInterval       time.Duration
+		SubCheckpointInterval      time.Duration
 		BadClientPunishDuration    time.Duration
 		InternalServerErrorBackoff time.Duration
 		ReporterInterval           time.Duration
@@ -82,6 +110,19 @@ var (
 		ManagerRefresh             time.Duration
 		HttpReadTimeout            time.Duration
 		HttpWriteTimeout           time.Duration
+		SlowRequestThreshold       time.Duration
+		ReadyManagerStaleness      time.Duration
+		KafkaMetaRefresh           time.Duration
+		SubExportCacheTTL          time.Duration
+		SubSpoolDir                string
+		SubSpoolMaxAge             time.Duration
+		CorsOrigins                string
+		BrowserTokenTTL            time.Duration
+		SubResumeTTL               time.Duration // ttl of Sub resume tokens, 0 to disable
+		MaxPubDelay                time.Duration // cap of Pub header X-Delay, 0 to disable
+		ShedErrRate                float64       // Pub error rate to start shedding low priority apps, 0 to disable
+		ShedLatency                time.Duration // Pub avg latency to start shedding low priority apps, 0 to disable
+		ShedStep                   int           // percentage of shedding stepped each interval
 	}
 )
 
@@ -118,6 +159,12 @@ func ParseFlags() {
 	flag.StringVar(&Options.Store, "store", "kafka", "message underlying store")
 	flag.StringVar(&Options.HintedHandoffType, "hhtype", "disk", "underlying hinted handoff")
 	flag.StringVar(&Options.HintedHandoffDir, "hhdirs", "hhdata", "hinted handoff dirs seperated by comma")
+	flag.IntVar(&Options.HintedHandoffKeyId, "hhkey", 0, "hinted handoff encryption key id resolved by secret hh.key.<id>, 0 to disable")
+	flag.IntVar(&Options.HintedHandoffReadAhead, "hhreadahead", 256<<10, "hinted handoff pump read ahead buffer size in bytes, 0 to disable")
+	flag.IntVar(&Options.HintedHandoffFormat, "hhformat", 1, "hinted handoff on-disk format version of new blocks, pin to the old one while rolling out a new version")
+	flag.BoolVar(&Options.HintedHandoffNoMigrate, "hhnomigrate", false, "disable hinted handoff online migration of segments in other format versions")
+	flag.StringVar(&Options.HintedHandoffReadAheads, "hhreadaheadq", "", "per queue hinted handoff read ahead in bytes, e,g. cluster1/topic1:1048576,cluster2/topic2:0")
+	flag.StringVar(&Options.HintedHandoffPolicy, "hhpolicy", "", "per queue hinted handoff on|off, Pub of off queues fails fast, e,g. cluster1/*:off,cluster1/topic1:on")
 	flag.BoolVar(&Options.FlushHintedOffOnly, "hhflush", false, "flush hinted handoff and exit")
 	flag.StringVar(&Options.JobStore, "jstore", "mysql", "job underlying store")
 	flag.StringVar(&Options.DummyCluster, "dummycluster", "me", "dummy store's cluster name")
@@ -126,6 +173,8 @@ func ParseFlags() {
 	flag.StringVar(&Options.KillFile, "kill", "", "kill running kateway by pid file")
 	flag.StringVar(&Options.InfluxServer, "influxdbaddr", "", "influxdb server address for the metrics reporter")
 	flag.StringVar(&Options.InfluxDbName, "influxdbname", "pubsub", "influxdb db name")
+	flag.StringVar(&Options.ZipkinCollector, "zipkin", "", "zipkin http collector url, tracing disabled if empty")
+	flag.Float64Var(&Options.TraceSampleRate, "tracerate", 0.001, "tracing sample rate within [0, 1]")
 	flag.BoolVar(&Options.ShowVersion, "version", false, "show version and exit")
 	flag.BoolVar(&Options.Debug, "debug", false, "enable debug mode")
 	flag.BoolVar(&Options.RunSwaggerServer, "swagger", false, "run swagger server")
@@ -137,10 +186,13 @@ func ParseFlags() {
 	flag.BoolVar(&Options.EnableAccessLog, "accesslog", false, "en(dis)able access log")
 	flag.BoolVar(&Options.EnableRegistry, "withreg", true, "self register in zk, otherwise isolated from cluster")
 	flag.BoolVar(&Options.DryRun, "dryrun", false, "dry run mode")
-	flag.BoolVar(&Options.HintedHandoffBufio, "hhbuf", false, "enable hinted handoff bufio")
+	flag.BoolVar(&Options.HintedHandoffBufio, "hhbuf", false, "enable hinted handoff write buffer before group commit")
+	flag.BoolVar(&Options.HintedHandoffBatch, "hhbatch", false, "experimental hinted handoff batched writev append, requires build tag hhbatch")
+	flag.BoolVar(&Options.HintedHandoffAuditJSON, "hhauditjson", false, "hinted handoff audit events in json, key=value text if false")
 	flag.BoolVar(&Options.EnableHintedHandoff, "hh", true, "enable hinted handoff for full pub availability")
 	flag.BoolVar(&Options.PermitUnregisteredGroup, "unregrp", false, "permit sub group usage without being registered")
 	flag.BoolVar(&Options.PermitStandbySub, "standbysub", false, "permits sub threads exceed partitions")
+	flag.BoolVar(&Options.SubWritev, "subwritev", true, "write batch sub responses of plain http/1.1 to socket with writev")
 	flag.BoolVar(&Options.EnableGzip, "gzip", false, "enable http response gzip")
 	flag.BoolVar(&Options.CpuAffinity, "cpuaffinity", false, "enable cpu affinity")
 	flag.BoolVar(&Options.BadGroupRateLimit, "badgroup_rater", true, "rate limit of bad consumer group")
@@ -148,27 +200,57 @@ func ParseFlags() {
 	flag.BoolVar(&Options.Ratelimit, "raltelimit", false, "enable rate limit")
 	flag.BoolVar(&Options.EnableHttpPanicRecover, "httppanic", true, "enable http handler panic recover")
 	flag.BoolVar(&Options.DisableMetrics, "metricsoff", false, "disable metrics reporter")
+	flag.BoolVar(&Options.DisableTransform, "transformoff", false, "kill switch of message transforms")
+	flag.StringVar(&Options.TransformPluginDir, "transformdir", "", "dir of message transform Go plugins(*.so)")
+	flag.BoolVar(&Options.EnableHttp2, "h2", false, "enable HTTP/2: h2 on https and h2c with prior knowledge on http listeners")
+	flag.IntVar(&Options.Http2MaxStreams, "h2streams", 250, "max concurrent HTTP/2 streams per connection")
 	flag.IntVar(&Options.HttpHeaderMaxBytes, "maxheader", 4<<10, "http header max size in bytes")
 	flag.Int64Var(&Options.MaxPubSize, "maxpub", 512<<10, "max Pub message size")
 	flag.Int64Var(&Options.MaxJobSize, "maxjob", 16<<10, "max Pub job size")
+	flag.DurationVar(&Options.MaxPubDelay, "maxdelay", time.Hour, "max delay of Pub with header "+HttpHeaderDelay+" fired by the job subsystem, 0 to disable")
 	flag.IntVar(&Options.MinPubSize, "minpub", 1, "min Pub message size")
 	flag.IntVar(&Options.MaxRequestPerConn, "maxreq", -1, "max request per connection")
 	flag.IntVar(&Options.AssignJobShardId, "shardid", 1, "how to assign shard id for new app")
 	flag.IntVar(&Options.MaxMsgTagLen, "tagsz", 1024, "max message tag length permitted")
 	// kafka Fetch maxFetchSize=1MB, so if our msg agv size is 250B, batch size can be 4000
 	flag.IntVar(&Options.MaxSubBatchSize, "maxbatch", 4000, "max sub batch size")
+	flag.StringVar(&Options.SubPartner, "partner", "", "id of the standby partner kateway that takes over sub sessions of each other")
+	flag.DurationVar(&Options.SubCheckpointInterval, "subcheckpoint", time.Second, "sub session checkpoint interval for the standby partner")
+	flag.IntVar(&Options.SubPrefetch, "subprefetch", 0, "prefetched messages per partition for each sub client, 0 to disable")
+	flag.DurationVar(&Options.SubExportCacheTTL, "subexport", time.Second*30, "cache ttl of the consumer groups export of a cluster")
+	flag.StringVar(&Options.SubSpoolDir, "spooldir", "", "dir of the local disk spools of Sub store-and-forward, empty to disable")
+	flag.DurationVar(&Options.SubSpoolMaxAge, "spoolage", time.Hour*72, "spooled messages are kept for replay within this after forwarded")
+	flag.StringVar(&Options.CorsOrigins, "cors", "*", "origins allowed for CORS seperated by comma, * for any, empty to disable")
+	flag.DurationVar(&Options.BrowserTokenTTL, "browsertoken", 0, "ttl of the browser tokens for Sub from web frontends signed by secret "+BrowserTokenSecret+", 0 to disable")
+	flag.DurationVar(&Options.SubResumeTTL, "subresume", 0, "ttl of the Sub resume tokens signed by secret "+ResumeTokenSecret+", 0 to disable")
 	flag.IntVar(&Options.LogRotateSize, "logsize", 10<<30, "max unrotated log file size")
 	flag.Int64Var(&Options.PubQpsLimit, "publimit", 60*10000, "pub qps limit per minute per ip")
 	flag.IntVar(&Options.PubPoolCapcity, "pubpool", 100, "pub connection pool capacity")
+	flag.IntVar(&Options.KafkaClients, "kafkaclients", 2, "kafka clients per cluster shared by pub producers of each ack kind")
+	flag.DurationVar(&Options.KafkaMetaRefresh, "kafkameta", time.Minute*10, "kafka client metadata refresh interval")
+	flag.StringVar(&Options.KafkaPoolOverrides, "kafkapool", "", "per cluster overrides of pubpool/kafkaclients/kafkameta, e,g. me:producers=200,clients=4;big:meta=5m")
 	flag.IntVar(&Options.MaxClients, "maxclient", 100000, "max concurrent connections")
 	flag.DurationVar(&Options.OffsetCommitInterval, "offsetcommit", time.Minute, "consumer offset commit interval")
 	flag.DurationVar(&Options.HttpReadTimeout, "httprtimeout", time.Minute*5, "http server read timeout")
 	flag.DurationVar(&Options.HttpWriteTimeout, "httpwtimeout", time.Minute, "http server write timeout")
+	flag.Int64Var(&Options.SubBandwidthLimit, "subbw", 0, "sub egress bandwidth limit of all groups in bytes per second, 0 means unlimited")
+	flag.DurationVar(&Options.SlowRequestThreshold, "slow", 0, "log requests slower than this to slow_log, 0 to disable")
 	flag.DurationVar(&Options.SubTimeout, "subtimeout", time.Second*30, "sub timeout before send http 204")
+	flag.DurationVar(&Options.SubAckTimeout, "acktimeout", 0, "redeliver messages of explicit ack Sub not acked within this with exponential backoff, 0 to disable")
+	flag.IntVar(&Options.SubMaxRedelivery, "maxredeliver", 5, "max redeliveries of a message before moving to the dead letter queue")
 	flag.DurationVar(&Options.ReporterInterval, "report", time.Second*30, "reporter flush interval")
 	flag.DurationVar(&Options.BadClientPunishDuration, "punish", time.Second*3, "punish bad client by sleep")
 	flag.DurationVar(&Options.MetaRefresh, "metarefresh", time.Minute*5, "meta data refresh interval")
 	flag.DurationVar(&Options.ManagerRefresh, "manrefresh", time.Minute*5, "manager integration refresh interval")
+	flag.StringVar(&Options.ManagerSnapshot, "mansnapshot", "manager.snapshot", "local snapshot of manager data to start in degraded mode when manager db is down, empty to disable")
+	flag.StringVar(&Options.MinClientVersion, "minclientver", "", "reject clients whose X-Client-Version is below this with 426, empty to disable")
+	flag.StringVar(&Options.DeprecatedClientVersion, "deprecatedclientver", "", "warn clients whose X-Client-Version is below this with header Warning, empty to disable")
+	flag.Int64Var(&Options.ReadyMaxHhInflights, "readyhh", 1000000, "not ready if hh inflight messages exceed this, 0 to disable the check")
+	flag.Float64Var(&Options.ShedErrRate, "shederr", 0, "shed Pub of low priority apps with 503 when Pub error rate within [0, 1] exceeds this, 0 to disable")
+	flag.DurationVar(&Options.ShedLatency, "shedlatency", 0, "shed Pub of low priority apps with 503 when Pub avg latency exceeds this, 0 to disable")
+	flag.IntVar(&Options.ShedStep, "shedstep", 10, "shed percentage stepped up or down every 5s by the Pub health")
+	flag.DurationVar(&Options.ReadyManagerStaleness, "readyman", time.Minute*30, "not ready if manager data is not refreshed within this, 0 to disable the check")
+	flag.BoolVar(&Options.StrictStartup, "strictstart", false, "refuse to start if zk or any cluster is unreachable")
 	flag.DurationVar(&Options.PubPoolIdleTimeout, "pubpoolidle", 0, "pub pool connect idle timeout")
 	flag.DurationVar(&Options.InternalServerErrorBackoff, "500backoff", time.Second, "internal server error backoff duration")
 
@@ -194,4 +276,24 @@ func ValidateFlags() {
 		fmt.Fprintf(os.Stderr, "-zone required\n")
 		os.Exit(1)
 	}
+
+	if Options.SubPartner != "" && (!Options.EnableRegistry || Options.SubPartner == Options.Id) {
+		fmt.Fprintf(os.Stderr, "-partner requires -withreg and must not be myself\n")
+		os.Exit(1)
+	}
+
+	if Options.TraceSampleRate < 0 || Options.TraceSampleRate > 1 {
+		fmt.Fprintf(os.Stderr, "-tracerate must be within [0, 1]\n")
+		os.Exit(1)
+	}
+
+	if err := newClientVersions().setPolicy(Options.MinClientVersion, Options.DeprecatedClientVersion); err != nil {
+		fmt.Fprintf(os.Stderr, "-minclientver/-deprecatedclientver: %v\n", err)
+		os.Exit(1)
+	}
+
+	if _, err := kafkaPoolConfigs(); err != nil {
+		fmt.Fprintf(os.Stderr, "-kafkapool: %v\n", err)
+		os.Exit(1)
+	}
 }
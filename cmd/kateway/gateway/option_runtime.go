@@ -0,0 +1,278 @@
+package gateway
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+	storekfk "github.com/funkygao/gafka/cmd/kateway/store/kafka"
+	log "github.com/funkygao/log4go"
+)
+
+// runtimeOption is an option that takes effect without restart when changed.
+// Options consumed only at startup, e,g. addresses and stores, are not runtime options.
+type runtimeOption struct {
+	get   func() interface{}
+	parse func(value string) (interface{}, error) // validates the value
+	apply func(gw *Gateway, v interface{})
+}
+
+// runtimeOptions are keyed by flag name.
+var runtimeOptions = map[string]runtimeOption{
+	"debug":          boolOption(&Options.Debug),
+	"metricsoff":     boolOption(&Options.DisableMetrics),
+	"transformoff":   boolOption(&Options.DisableTransform),
+	"gzip":           boolOption(&Options.EnableGzip),
+	"raltelimit":     boolOption(&Options.Ratelimit),
+	"badgroup_rater": boolOption(&Options.BadGroupRateLimit),
+	"badpub_rater":   boolOption(&Options.BadPubAppRateLimit),
+	"auditpub":       boolOption(&Options.AuditPub),
+	"auditsub":       boolOption(&Options.AuditSub),
+	"allhh":          boolOption(&Options.AllwaysHintedHandoff),
+	"standbysub":     boolOption(&Options.PermitStandbySub),
+	"httppanic":      boolOption(&Options.EnableHttpPanicRecover),
+	"maxpub":         int64Option(&Options.MaxPubSize, 1, 64<<20),
+	"maxjob":         int64Option(&Options.MaxJobSize, 1, 64<<20),
+	"minpub":         intOption(&Options.MinPubSize, 0, 1<<20),
+	"tagsz":          intOption(&Options.MaxMsgTagLen, 0, 64<<10),
+	"maxbatch":       intOption(&Options.MaxSubBatchSize, 1, 100000),
+	"maxreq":         intOption(&Options.MaxRequestPerConn, -1, 1<<30),
+	"shardid":        intOption(&Options.AssignJobShardId, 0, 1<<20),
+	"subbw":          int64Option(&Options.SubBandwidthLimit, 0, 1<<40),
+	"subtimeout":     durationOption(&Options.SubTimeout, time.Second, time.Minute*10),
+	"punish":         durationOption(&Options.BadClientPunishDuration, 0, time.Minute),
+	"500backoff":     durationOption(&Options.InternalServerErrorBackoff, 0, time.Minute),
+	"slow":           durationOption(&Options.SlowRequestThreshold, 0, time.Hour),
+	"readyhh":        int64Option(&Options.ReadyMaxHhInflights, 0, 1<<40),
+	"readyman":       durationOption(&Options.ReadyManagerStaleness, 0, time.Hour*24),
+
+	// changing any of them rebuilds kafka conn pools of the affected clusters
+	"pubpool":      kafkaPoolOption(intOption(&Options.PubPoolCapcity, 1, 10000)),
+	"kafkaclients": kafkaPoolOption(intOption(&Options.KafkaClients, 1, 100)),
+	"kafkameta":    kafkaPoolOption(durationOption(&Options.KafkaMetaRefresh, time.Second*10, time.Hour*24)),
+	"kafkapool": kafkaPoolOption(runtimeOption{
+		get: func() interface{} { return Options.KafkaPoolOverrides },
+		parse: func(value string) (interface{}, error) {
+			if _, err := storekfk.ParsePoolOverrides(value); err != nil {
+				return nil, err
+			}
+			return value, nil
+		},
+		apply: func(gw *Gateway, v interface{}) { Options.KafkaPoolOverrides = v.(string) },
+	}),
+
+	"minclientver": {
+		get:   func() interface{} { return Options.MinClientVersion },
+		parse: parseClientVersionOption,
+		apply: func(gw *Gateway, v interface{}) {
+			Options.MinClientVersion = v.(string)
+			gw.clients.setPolicy(Options.MinClientVersion, Options.DeprecatedClientVersion)
+		},
+	},
+	"deprecatedclientver": {
+		get:   func() interface{} { return Options.DeprecatedClientVersion },
+		parse: parseClientVersionOption,
+		apply: func(gw *Gateway, v interface{}) {
+			Options.DeprecatedClientVersion = v.(string)
+			gw.clients.setPolicy(Options.MinClientVersion, Options.DeprecatedClientVersion)
+		},
+	},
+
+	"unregrp": {
+		get:   func() interface{} { return Options.PermitUnregisteredGroup },
+		parse: parseBool,
+		apply: func(gw *Gateway, v interface{}) {
+			Options.PermitUnregisteredGroup = v.(bool)
+			manager.Default.AllowSubWithUnregisteredGroup(v.(bool))
+		},
+	},
+	"accesslog": {
+		get:   func() interface{} { return Options.EnableAccessLog },
+		parse: parseBool,
+		apply: func(gw *Gateway, v interface{}) {
+			on := v.(bool)
+			if Options.EnableAccessLog != on {
+				// on/off switching
+				if on {
+					gw.accessLogger.Start()
+				} else {
+					gw.accessLogger.Stop()
+				}
+			}
+			Options.EnableAccessLog = on
+		},
+	},
+	"level": {
+		get: func() interface{} { return logLevel.String() },
+		parse: func(value string) (interface{}, error) {
+			switch value {
+			case "trace", "debug", "info", "warn", "error", "alarm":
+				return value, nil
+			}
+			return nil, fmt.Errorf("invalid log level: %s", value)
+		},
+		apply: func(gw *Gateway, v interface{}) {
+			logLevel = toLogLevel(v.(string))
+			for _, filter := range log.Global {
+				filter.Level = logLevel
+			}
+		},
+	},
+}
+
+// runtimeOptionValues returns current values of all runtime options.
+func runtimeOptionValues() map[string]interface{} {
+	r := make(map[string]interface{}, len(runtimeOptions))
+	for name, opt := range runtimeOptions {
+		r[name] = opt.get()
+	}
+	return r
+}
+
+// setRuntimeOptions validates all the values before applying any of them, so that
+// a bad request changes nothing. It returns the names of applied options.
+func setRuntimeOptions(gw *Gateway, values map[string]string) ([]string, error) {
+	parsed := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		opt, present := runtimeOptions[name]
+		if !present {
+			return nil, fmt.Errorf("option[%s] not runtime changeable", name)
+		}
+
+		v, err := opt.parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("option[%s]: %v", name, err)
+		}
+		parsed[name] = v
+	}
+
+	names := make([]string, 0, len(parsed))
+	for name := range parsed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		runtimeOptions[name].apply(gw, parsed[name])
+	}
+
+	return names, nil
+}
+
+func parseBool(value string) (interface{}, error) {
+	return strconv.ParseBool(value)
+}
+
+// parseClientVersionOption accepts a client version, or "off" to disable.
+func parseClientVersionOption(value string) (interface{}, error) {
+	if value == "off" {
+		return "", nil
+	}
+
+	if _, err := parseClientVersion(value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func boolOption(p *bool) runtimeOption {
+	return runtimeOption{
+		get:   func() interface{} { return *p },
+		parse: parseBool,
+		apply: func(gw *Gateway, v interface{}) { *p = v.(bool) },
+	}
+}
+
+func intOption(p *int, min, max int) runtimeOption {
+	return runtimeOption{
+		get: func() interface{} { return *p },
+		parse: func(value string) (interface{}, error) {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, err
+			}
+			if n < min || n > max {
+				return nil, fmt.Errorf("%d out of range [%d, %d]", n, min, max)
+			}
+			return n, nil
+		},
+		apply: func(gw *Gateway, v interface{}) { *p = v.(int) },
+	}
+}
+
+func int64Option(p *int64, min, max int64) runtimeOption {
+	return runtimeOption{
+		get: func() interface{} { return *p },
+		parse: func(value string) (interface{}, error) {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			if n < min || n > max {
+				return nil, fmt.Errorf("%d out of range [%d, %d]", n, min, max)
+			}
+			return n, nil
+		},
+		apply: func(gw *Gateway, v interface{}) { *p = v.(int64) },
+	}
+}
+
+func durationOption(p *time.Duration, min, max time.Duration) runtimeOption {
+	return runtimeOption{
+		get: func() interface{} { return p.String() },
+		parse: func(value string) (interface{}, error) {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, err
+			}
+			if d < min || d > max {
+				return nil, fmt.Errorf("%s out of range [%s, %s]", d, min, max)
+			}
+			return d, nil
+		},
+		apply: func(gw *Gateway, v interface{}) { *p = v.(time.Duration) },
+	}
+}
+
+// kafkaPoolConfigs returns the kafka conn pool configs of all clusters.
+func kafkaPoolConfigs() (storekfk.PoolConfigs, error) {
+	overrides, err := storekfk.ParsePoolOverrides(Options.KafkaPoolOverrides)
+	if err != nil {
+		return storekfk.PoolConfigs{}, err
+	}
+
+	return storekfk.PoolConfigs{
+		Default: storekfk.PoolConfig{
+			Producers:   Options.PubPoolCapcity,
+			Clients:     Options.KafkaClients,
+			MetaRefresh: Options.KafkaMetaRefresh,
+		},
+		Clusters: overrides,
+	}, nil
+}
+
+// kafkaPoolOption reconfigures the pub store after the option is applied.
+func kafkaPoolOption(opt runtimeOption) runtimeOption {
+	apply := opt.apply
+	opt.apply = func(gw *Gateway, v interface{}) {
+		apply(gw, v)
+
+		s, ok := store.DefaultPubStore.(interface {
+			Reconfigure(storekfk.PoolConfigs)
+		})
+		if !ok {
+			return
+		}
+
+		cf, err := kafkaPoolConfigs()
+		if err != nil {
+			// should never happen: validated by parse
+			log.Error("kafka pool: %v", err)
+			return
+		}
+		s.Reconfigure(cf)
+	}
+	return opt
+}
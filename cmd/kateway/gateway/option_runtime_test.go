@@ -0,0 +1,47 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestSetRuntimeOptions(t *testing.T) {
+	Options.EnableGzip = false
+	Options.MaxSubBatchSize = 4000
+	Options.SubTimeout = time.Second * 30
+
+	changed, err := setRuntimeOptions(nil, map[string]string{
+		"gzip":       "true",
+		"maxbatch":   "100",
+		"subtimeout": "10s",
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"gzip", "maxbatch", "subtimeout"}, changed)
+	assert.Equal(t, true, Options.EnableGzip)
+	assert.Equal(t, 100, Options.MaxSubBatchSize)
+	assert.Equal(t, time.Second*10, Options.SubTimeout)
+
+	// any invalid value rejects the whole request
+	_, err = setRuntimeOptions(nil, map[string]string{
+		"gzip":     "false",
+		"maxbatch": "0",
+	})
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, true, Options.EnableGzip)
+	assert.Equal(t, 100, Options.MaxSubBatchSize)
+
+	_, err = setRuntimeOptions(nil, map[string]string{"zone": "prod"})
+	assert.NotEqual(t, nil, err)
+
+	_, err = setRuntimeOptions(nil, map[string]string{"subtimeout": "1h"})
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, time.Second*10, Options.SubTimeout)
+
+	_, err = setRuntimeOptions(nil, map[string]string{"kafkapool": "me:clients=0"})
+	assert.NotEqual(t, nil, err)
+	_, err = setRuntimeOptions(nil, map[string]string{"kafkapool": "me:clients=4"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "me:clients=4", Options.KafkaPoolOverrides)
+}
@@ -0,0 +1,83 @@
+package gateway
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/job"
+	gzk "github.com/funkygao/gafka/zk"
+)
+
+// parsePubDelay parses header X-Delay of Pub: Go duration e,g. 30s 5m, or seconds e,g. 30.
+// Jobs are due in seconds, so the delay must be at least 1s.
+func parsePubDelay(v string, max time.Duration) (time.Duration, error) {
+	if max <= 0 {
+		return 0, ErrPubDelayDisabled
+	}
+
+	var delay time.Duration
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		delay = time.Duration(secs) * time.Second
+	} else if delay, err = time.ParseDuration(v); err != nil {
+		return 0, ErrInvalidPubDelay
+	}
+
+	switch {
+	case delay < time.Second:
+		return 0, ErrInvalidPubDelay
+	case delay > max:
+		return 0, ErrTooLongPubDelay
+	}
+
+	return delay, nil
+}
+
+// jobQueues remembers the topics whose job queue exists, so that a delayed Pub creates the
+// job queue of its topic on the fly once, and the app needn't learn the jobs API.
+type jobQueues struct {
+	mu     sync.Mutex
+	ready  map[string]struct{} // raw topics
+	exists func(topic string) (bool, error)
+	create func(appid, cluster, topic string) error
+}
+
+func newJobQueues(zkzone *gzk.ZkZone) *jobQueues {
+	return &jobQueues{
+		ready: make(map[string]struct{}),
+		exists: func(topic string) (bool, error) {
+			exists, _, err := zkzone.Conn().Exists(gzk.PubsubJobQueues + "/" + topic)
+			return exists, err
+		},
+		create: func(appid, cluster, topic string) error {
+			if err := job.Default.CreateJobQueue(Options.AssignJobShardId, appid, topic); err != nil {
+				return err
+			}
+			return zkzone.CreateJobQueue(topic, cluster)
+		},
+	}
+}
+
+// ensure makes sure the job queue of the topic exists, creating it if not.
+// The lock is held while creating so that concurrent delayed Pub creates it only once.
+func (this *jobQueues) ensure(appid, cluster, topic string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if _, present := this.ready[topic]; present {
+		return nil
+	}
+
+	exists, err := this.exists(topic)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err = this.create(appid, cluster, topic); err != nil {
+			return err
+		}
+	}
+
+	this.ready[topic] = struct{}{}
+	return nil
+}
@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestParsePubDelay(t *testing.T) {
+	d, err := parsePubDelay("30s", time.Hour)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 30*time.Second, d)
+	d, err = parsePubDelay("30", time.Hour)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 30*time.Second, d)
+	d, err = parsePubDelay("1h", time.Hour)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, time.Hour, d)
+
+	_, err = parsePubDelay("61m", time.Hour)
+	assert.Equal(t, ErrTooLongPubDelay, err)
+	_, err = parsePubDelay("500ms", time.Hour)
+	assert.Equal(t, ErrInvalidPubDelay, err)
+	_, err = parsePubDelay("-5s", time.Hour)
+	assert.Equal(t, ErrInvalidPubDelay, err)
+	_, err = parsePubDelay("soon", time.Hour)
+	assert.Equal(t, ErrInvalidPubDelay, err)
+	_, err = parsePubDelay("30s", 0)
+	assert.Equal(t, ErrPubDelayDisabled, err)
+}
+
+func TestJobQueuesEnsure(t *testing.T) {
+	existing := map[string]bool{"app1.exists.v1": true}
+	var created []string
+	var createErr error
+	q := &jobQueues{
+		ready: make(map[string]struct{}),
+		exists: func(topic string) (bool, error) {
+			return existing[topic], nil
+		},
+		create: func(appid, cluster, topic string) error {
+			if createErr != nil {
+				return createErr
+			}
+			created = append(created, topic)
+			existing[topic] = true
+			return nil
+		},
+	}
+
+	assert.Equal(t, nil, q.ensure("app1", "trade", "app1.exists.v1"))
+	assert.Equal(t, 0, len(created))
+
+	// retried on next delayed Pub if creation fails
+	createErr = errors.New("mysql gone")
+	assert.Equal(t, createErr, q.ensure("app1", "trade", "app1.order.v1"))
+	createErr = nil
+	assert.Equal(t, nil, q.ensure("app1", "trade", "app1.order.v1"))
+	assert.Equal(t, nil, q.ensure("app1", "trade", "app1.order.v1"))
+	assert.Equal(t, []string{"app1.order.v1"}, created)
+}
@@ -0,0 +1,211 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	// max messages of a multi-topic Pub request
+	maxMultiPubMsgs = 16
+
+	pubReceiptTTL  = time.Hour
+	maxPubReceipts = 100000
+)
+
+// state of each part of a multi-topic Pub
+const (
+	multiPubPublished = "published" // written to kafka
+	multiPubSpooled   = "spooled"   // appended to hinted handoff, to be delivered
+	multiPubDelivered = "delivered" // spooled and then delivered by hinted handoff
+	multiPubFailed    = "failed"    // neither published nor spooled, client should retry it
+)
+
+// multiPubMsg is a part of a multi-topic Pub request.
+type multiPubMsg struct {
+	Topic string `json:"topic"`
+	Ver   string `json:"ver"`
+	Key   string `json:"key,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+	Body  string `json:"body"`
+}
+
+// multiPubRequest publishes a small set of messages to topics of the same appid together, for
+// apps that must emit paired events.
+//
+// Messages are validated before any is published, and published in the order of the request.
+// Once kafka fails, the unfinished ones are spooled to hinted handoff to be delivered later, so
+// that paired events are never half emitted from the client's perspective. The outcome is kept
+// as a receipt that the client polls with its id till all parts are delivered.
+// Hence hinted handoff is required: the request is refused if it is disabled, bypassed for any
+// of the topics or hh=n. Only if appending to hinted handoff fails, the rest parts are reported
+// failed and not tried.
+type multiPubRequest struct {
+	Msgs []multiPubMsg `json:"msgs"`
+}
+
+// multiPubPart is the result of a part, in the order of the request.
+type multiPubPart struct {
+	Topic     string `json:"topic"`
+	Ver       string `json:"ver"`
+	State     string `json:"state"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Err       string `json:"err,omitempty"`
+
+	cluster, rawTopic string
+}
+
+// multiPublisher publishes the parts of a multi-topic Pub in order.
+type multiPublisher struct {
+	pub           func(cluster, topic string, key, body []byte) (partition int32, offset int64, err error)
+	spool         func(cluster, topic string, key, body []byte) error // append to hinted handoff
+	mustSpool     func(cluster, topic string) bool                    // e,g. hh has pending messages of the topic
+	isSystemError func(error) bool
+}
+
+// publish publishes the parts of receipt, and returns the index of the first failed part
+// and the error, -1 if none failed.
+//
+// Once a part fails to publish after any part has been published, it and the rest are spooled
+// regardless of the error, so that the parts are never partially published. If the first
+// part fails with a non system error, nothing is published and all parts fail.
+func (this *multiPublisher) publish(receipt *pubReceipt, keys, bodies [][]byte) (failed int, err error) {
+	spooling := false // once kafka fails, the rest goes to hh directly
+	published := false
+	for i := range receipt.Parts {
+		p := &receipt.Parts[i]
+		if !spooling && !this.mustSpool(p.cluster, p.rawTopic) {
+			p.Partition, p.Offset, err = this.pub(p.cluster, p.rawTopic, keys[i], bodies[i])
+			if err == nil {
+				p.State = multiPubPublished
+				published = true
+				continue
+			}
+
+			p.Partition, p.Offset = -1, -1
+			if !published && !this.isSystemError(err) {
+				return this.fail(receipt, 0, err)
+			}
+
+			spooling = true
+		}
+
+		if err = this.spool(p.cluster, p.rawTopic, keys[i], bodies[i]); err != nil {
+			// the rest are not tried so that the client can retry the failed ones in order
+			return this.fail(receipt, i, err)
+		}
+
+		p.State = multiPubSpooled
+	}
+
+	return -1, nil
+}
+
+func (this *multiPublisher) fail(receipt *pubReceipt, from int, err error) (int, error) {
+	for j := from; j < len(receipt.Parts); j++ {
+		receipt.Parts[j].State = multiPubFailed
+		receipt.Parts[j].Err = err.Error()
+	}
+	return from, err
+}
+
+// pubReceipt is the outcome of a multi-topic Pub, which the client polls by id till final.
+type pubReceipt struct {
+	Id        string         `json:"id"`
+	Appid     string         `json:"appid"`
+	State     string         `json:"state"`
+	CreatedAt time.Time      `json:"created_at"`
+	Parts     []multiPubPart `json:"parts"`
+
+	topic string // the first topic of the request, to authorize the query of the receipt
+}
+
+// refresh derives the receipt state from its parts: published if all published or delivered,
+// spooled if some still in hinted handoff, failed if any failed.
+// empty tells whether the hinted handoff queue of cluster/topic is drained.
+func (this *pubReceipt) refresh(empty func(cluster, topic string) bool) {
+	state := multiPubPublished
+	for i := range this.Parts {
+		p := &this.Parts[i]
+		if p.State == multiPubSpooled && empty(p.cluster, p.rawTopic) {
+			// the queue drained, so everything appended before is delivered
+			p.State = multiPubDelivered
+		}
+
+		switch p.State {
+		case multiPubFailed:
+			state = multiPubFailed
+		case multiPubSpooled:
+			if state != multiPubFailed {
+				state = multiPubSpooled
+			}
+		}
+	}
+
+	this.State = state
+}
+
+// pubReceipts keeps receipts of multi-topic Pub for pubReceiptTTL.
+type pubReceipts struct {
+	mu       sync.Mutex
+	receipts map[string]*pubReceipt
+	order    []string // receipt ids, the oldest first
+}
+
+func newPubReceipts() *pubReceipts {
+	return &pubReceipts{receipts: make(map[string]*pubReceipt)}
+}
+
+func newReceiptId() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (this *pubReceipts) add(r *pubReceipt) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.expire(time.Now())
+	if len(this.order) >= maxPubReceipts {
+		delete(this.receipts, this.order[0])
+		this.order = this.order[1:]
+	}
+
+	this.receipts[r.Id] = r
+	this.order = append(this.order, r.Id)
+}
+
+// get returns a copy of the receipt with refreshed state, nil if not found or expired.
+func (this *pubReceipts) get(id string, empty func(cluster, topic string) bool) *pubReceipt {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.expire(time.Now())
+	r, present := this.receipts[id]
+	if !present {
+		return nil
+	}
+
+	r.refresh(empty)
+	c := *r
+	c.Parts = append([]multiPubPart(nil), r.Parts...)
+	return &c
+}
+
+// expire must be called with lock held.
+func (this *pubReceipts) expire(now time.Time) {
+	n := 0
+	for _, id := range this.order {
+		if now.Sub(this.receipts[id].CreatedAt) < pubReceiptTTL {
+			break
+		}
+
+		delete(this.receipts, id)
+		n++
+	}
+	this.order = this.order[n:]
+}
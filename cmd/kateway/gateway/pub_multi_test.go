@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestPubReceiptRefresh(t *testing.T) {
+	drained := map[string]bool{}
+	empty := func(cluster, topic string) bool { return drained[cluster+"/"+topic] }
+
+	r := &pubReceipt{Parts: []multiPubPart{
+		{State: multiPubPublished, cluster: "c", rawTopic: "a"},
+		{State: multiPubSpooled, cluster: "c", rawTopic: "b"},
+	}}
+	r.refresh(empty)
+	assert.Equal(t, multiPubSpooled, r.State)
+	assert.Equal(t, multiPubSpooled, r.Parts[1].State)
+
+	// hh of the topic drained
+	drained["c/b"] = true
+	r.refresh(empty)
+	assert.Equal(t, multiPubPublished, r.State)
+	assert.Equal(t, multiPubDelivered, r.Parts[1].State)
+
+	r.Parts = append(r.Parts, multiPubPart{State: multiPubFailed})
+	r.refresh(empty)
+	assert.Equal(t, multiPubFailed, r.State)
+}
+
+func TestPubReceiptsExpire(t *testing.T) {
+	empty := func(cluster, topic string) bool { return true }
+	rs := newPubReceipts()
+	old := &pubReceipt{Id: "old", CreatedAt: time.Now().Add(-pubReceiptTTL - time.Second)}
+	rs.add(old)
+	rs.add(&pubReceipt{Id: "new", CreatedAt: time.Now(), Parts: []multiPubPart{{State: multiPubPublished}}})
+
+	assert.Equal(t, true, rs.get("old", empty) == nil)
+	assert.Equal(t, true, rs.get("none", empty) == nil)
+
+	r := rs.get("new", empty)
+	assert.NotEqual(t, true, r == nil)
+	assert.Equal(t, multiPubPublished, r.State)
+
+	// a copy is returned
+	r.Parts[0].State = multiPubFailed
+	assert.Equal(t, multiPubPublished, rs.get("new", empty).Parts[0].State)
+	assert.Equal(t, 1, len(rs.order))
+}
+
+func TestNewReceiptId(t *testing.T) {
+	assert.Equal(t, 24, len(newReceiptId()))
+	assert.NotEqual(t, newReceiptId(), newReceiptId())
+}
+
+func TestMultiPublisherMidBatchFailure(t *testing.T) {
+	var (
+		published, spooled []string
+		kafkaDown          = map[string]bool{"t2": true}
+	)
+	brokerDown := errors.New("broker down")
+	publisher := &multiPublisher{
+		pub: func(cluster, topic string, key, body []byte) (int32, int64, error) {
+			if kafkaDown[topic] {
+				return -1, -1, brokerDown
+			}
+			published = append(published, topic)
+			return 0, 1, nil
+		},
+		spool: func(cluster, topic string, key, body []byte) error {
+			spooled = append(spooled, topic)
+			return nil
+		},
+		mustSpool:     func(cluster, topic string) bool { return false },
+		isSystemError: func(err error) bool { return err == brokerDown },
+	}
+	newReceipt := func() *pubReceipt {
+		return &pubReceipt{Parts: []multiPubPart{
+			{cluster: "c", rawTopic: "t1"}, {cluster: "c", rawTopic: "t2"}, {cluster: "c", rawTopic: "t3"},
+		}}
+	}
+	keys, bodies := make([][]byte, 3), make([][]byte, 3)
+
+	// kafka fails on part 1: it and the rest are spooled even if t3 is fine
+	r := newReceipt()
+	failed, err := publisher.publish(r, keys, bodies)
+	assert.Equal(t, -1, failed)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"t1"}, published)
+	assert.Equal(t, []string{"t2", "t3"}, spooled)
+	r.refresh(func(cluster, topic string) bool { return false })
+	assert.Equal(t, multiPubSpooled, r.State)
+	assert.Equal(t, int32(-1), r.Parts[1].Partition)
+
+	// non system error after part 0 published is spooled too
+	published, spooled = nil, nil
+	kafkaDown = map[string]bool{}
+	rejected := errors.New("rejected")
+	publisher.pub = func(cluster, topic string, key, body []byte) (int32, int64, error) {
+		if topic == "t2" {
+			return -1, -1, rejected
+		}
+		published = append(published, topic)
+		return 0, 1, nil
+	}
+	r = newReceipt()
+	failed, _ = publisher.publish(r, keys, bodies)
+	assert.Equal(t, -1, failed)
+	assert.Equal(t, []string{"t1"}, published)
+	assert.Equal(t, []string{"t2", "t3"}, spooled)
+
+	// non system error on the first part: nothing published
+	published, spooled = nil, nil
+	publisher.pub = func(cluster, topic string, key, body []byte) (int32, int64, error) {
+		return -1, -1, rejected
+	}
+	r = newReceipt()
+	failed, err = publisher.publish(r, keys, bodies)
+	assert.Equal(t, 0, failed)
+	assert.Equal(t, rejected, err)
+	assert.Equal(t, 0, len(published)+len(spooled))
+	r.refresh(func(cluster, topic string) bool { return false })
+	assert.Equal(t, multiPubFailed, r.State)
+	assert.Equal(t, multiPubFailed, r.Parts[2].State)
+
+	// hh fails too: the rest are failed and not tried
+	publisher.pub = func(cluster, topic string, key, body []byte) (int32, int64, error) {
+		return -1, -1, brokerDown
+	}
+	publisher.spool = func(cluster, topic string, key, body []byte) error {
+		return errors.New("disk full")
+	}
+	r = newReceipt()
+	failed, _ = publisher.publish(r, keys, bodies)
+	assert.Equal(t, 0, failed)
+	assert.Equal(t, "disk full", r.Parts[2].Err)
+}
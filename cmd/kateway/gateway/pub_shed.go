@@ -0,0 +1,249 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/go-metrics"
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	pubShedInterval = time.Second * 5
+
+	// too few Pub in a window tells nothing about the brokers
+	pubShedMinSamples = 50
+
+	// each sheddable priority takes 100 levels, from the lowest
+	pubShedMaxLevel = 100 * int32(manager.PriorityCritical)
+)
+
+// pubShedder is the admission control of Pub when the brokers degrade: instead of letting
+// all apps degrade equally, a percentage of Pub of the low priority apps is shed with 503.
+//
+// Each interval the shed level steps up if the Pub error rate or average latency crosses
+// the threshold, and steps down otherwise. The level spans the sheddable priorities from
+// the lowest, e,g. level 130 sheds all of bulk Pub and 30% of normal Pub. Critical apps
+// are never shed.
+type pubShedder struct {
+	errRate  float64       // threshold, 0 to disable
+	latency  time.Duration // threshold, 0 to disable
+	step     int32
+	priority func(appid string) manager.Priority
+
+	// Pub of the current window, atomic
+	total, failed, latencySum int64
+
+	level int32                            // atomic
+	seq   [manager.PriorityCritical]uint32 // atomic, admission sequence of each sheddable priority
+	shed  [manager.PriorityCritical]int64  // atomic
+	gauge [manager.PriorityCritical]metrics.Gauge
+
+	mu          sync.RWMutex
+	since       time.Time // when shedding started
+	lastErrRate float64
+	lastLatency time.Duration
+}
+
+type pubShedInfo struct {
+	Enabled bool             `json:"enabled"`
+	Level   int32            `json:"level"`
+	Since   time.Time        `json:"since,omitempty"`
+	Percent map[string]int32 `json:"percent"` // priority:shed percentage
+	Shed    map[string]int64 `json:"shed"`    // priority:shed Pub since started
+
+	// of the last window
+	ErrRate float64 `json:"err_rate"`
+	Latency string  `json:"latency"`
+
+	MaxErrRate float64 `json:"max_err_rate"`
+	MaxLatency string  `json:"max_latency"`
+}
+
+func newPubShedder(errRate float64, latency time.Duration, step int, priority func(appid string) manager.Priority) *pubShedder {
+	this := &pubShedder{
+		errRate:  errRate,
+		latency:  latency,
+		step:     int32(step),
+		priority: priority,
+	}
+	for p := manager.PriorityBulk; p < manager.PriorityCritical; p++ {
+		this.gauge[p] = metrics.NewRegisteredGauge("pub.shed."+p.String(), metrics.DefaultRegistry)
+	}
+	return this
+}
+
+func (this *pubShedder) enabled() bool {
+	return (this.errRate > 0 || this.latency > 0) && this.step > 0
+}
+
+// observe records the outcome of a Pub, failed is true only on broker side errors.
+func (this *pubShedder) observe(failed bool, latency time.Duration) {
+	if !this.enabled() {
+		return
+	}
+
+	atomic.AddInt64(&this.total, 1)
+	atomic.AddInt64(&this.latencySum, int64(latency))
+	if failed {
+		atomic.AddInt64(&this.failed, 1)
+	}
+}
+
+// evaluate closes the current window and steps the shed level.
+func (this *pubShedder) evaluate() {
+	total := atomic.SwapInt64(&this.total, 0)
+	failed := atomic.SwapInt64(&this.failed, 0)
+	latencySum := atomic.SwapInt64(&this.latencySum, 0)
+
+	var (
+		errRate  float64
+		latency  time.Duration
+		degraded bool
+	)
+	if total >= pubShedMinSamples {
+		errRate = float64(failed) / float64(total)
+		latency = time.Duration(latencySum / total)
+		degraded = (this.errRate > 0 && errRate >= this.errRate) ||
+			(this.latency > 0 && latency >= this.latency)
+	}
+
+	old := atomic.LoadInt32(&this.level)
+	level := old - this.step
+	if degraded {
+		level = old + this.step
+	}
+	if level < 0 {
+		level = 0
+	} else if level > pubShedMaxLevel {
+		level = pubShedMaxLevel
+	}
+	atomic.StoreInt32(&this.level, level)
+
+	this.mu.Lock()
+	this.lastErrRate, this.lastLatency = errRate, latency
+	if old == 0 && level > 0 {
+		this.since = time.Now()
+		for p := range this.shed {
+			atomic.StoreInt64(&this.shed[p], 0)
+		}
+	}
+	since := this.since
+	this.mu.Unlock()
+
+	for p := manager.PriorityBulk; p < manager.PriorityCritical; p++ {
+		this.gauge[p].Update(int64(this.percent(p)))
+	}
+
+	switch {
+	case old == 0 && level > 0:
+		log.Warn("pub shedding started {level:%d err:%.3f latency:%s}", level, errRate, latency)
+	case old > 0 && level == 0:
+		log.Info("pub shedding stopped after %s", time.Since(since))
+	case old != level:
+		log.Warn("pub shedding level %d -> %d {err:%.3f latency:%s}", old, level, errRate, latency)
+	}
+}
+
+// percent returns the shed percentage of Pub of a priority.
+func (this *pubShedder) percent(p manager.Priority) int32 {
+	if p >= manager.PriorityCritical {
+		return 0
+	}
+	if p < manager.PriorityBulk {
+		p = manager.PriorityBulk
+	}
+
+	pct := atomic.LoadInt32(&this.level) - 100*int32(p)
+	if pct < 0 {
+		return 0
+	} else if pct > 100 {
+		return 100
+	}
+	return pct
+}
+
+// admit decides whether a Pub of the app goes on.
+func (this *pubShedder) admit(appid string) bool {
+	if atomic.LoadInt32(&this.level) == 0 {
+		// the normal case
+		return true
+	}
+
+	p := this.priority(appid)
+	pct := this.percent(p)
+	if pct == 0 {
+		return true
+	}
+	if p < manager.PriorityBulk {
+		p = manager.PriorityBulk
+	}
+
+	// deterministic instead of random: exactly pct of every 100 Pub are shed
+	if int32(atomic.AddUint32(&this.seq[p], 1)%100) >= pct {
+		return true
+	}
+
+	atomic.AddInt64(&this.shed[p], 1)
+	return false
+}
+
+// reject responds 503 if the Pub of the app is shed and returns true.
+func (this *pubShedder) reject(w http.ResponseWriter, appid string) bool {
+	if this.admit(appid) {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(pubShedInterval/time.Second)))
+	writeErrorCode(w, ErrCodeOverloaded, "kateway overloaded", http.StatusServiceUnavailable)
+	return true
+}
+
+func (this *pubShedder) info() pubShedInfo {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	r := pubShedInfo{
+		Enabled:    this.enabled(),
+		Level:      atomic.LoadInt32(&this.level),
+		Percent:    make(map[string]int32),
+		Shed:       make(map[string]int64),
+		ErrRate:    this.lastErrRate,
+		Latency:    this.lastLatency.String(),
+		MaxErrRate: this.errRate,
+		MaxLatency: this.latency.String(),
+	}
+	if r.Level > 0 {
+		r.Since = this.since
+	}
+	for p := manager.PriorityBulk; p < manager.PriorityCritical; p++ {
+		r.Percent[p.String()] = this.percent(p)
+		r.Shed[p.String()] = atomic.LoadInt64(&this.shed[p])
+	}
+	return r
+}
+
+func (this *Gateway) runPubShedder() {
+	defer this.wg.Done()
+
+	log.Info("pub shedder started {err:%.3f latency:%s step:%d}",
+		this.pubShedder.errRate, this.pubShedder.latency, this.pubShedder.step)
+
+	ticker := time.NewTicker(pubShedInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-this.shutdownCh:
+			log.Info("pub shedder stopped")
+			return
+
+		case <-ticker.C:
+			this.pubShedder.evaluate()
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+)
+
+func TestPubShedderLevel(t *testing.T) {
+	priorities := map[string]manager.Priority{"log": manager.PriorityBulk, "trade": manager.PriorityCritical}
+	s := newPubShedder(0.2, time.Second, 60, func(appid string) manager.Priority {
+		if p, present := priorities[appid]; present {
+			return p
+		}
+		return manager.PriorityNormal
+	})
+	assert.Equal(t, true, s.enabled())
+
+	// healthy
+	for i := 0; i < 100; i++ {
+		s.observe(i < 10, time.Millisecond*10)
+	}
+	s.evaluate()
+	assert.Equal(t, int32(0), s.info().Level)
+	assert.Equal(t, true, s.admit("log"))
+
+	// too many errors: bulk is shed first
+	for i := 0; i < 100; i++ {
+		s.observe(i < 30, time.Millisecond*10)
+	}
+	s.evaluate()
+	info := s.info()
+	assert.Equal(t, int32(60), info.Level)
+	assert.Equal(t, int32(60), info.Percent["bulk"])
+	assert.Equal(t, int32(0), info.Percent["normal"])
+	admitted := 0
+	for i := 0; i < 100; i++ {
+		if s.admit("log") {
+			admitted++
+		}
+	}
+	assert.Equal(t, 40, admitted)
+	assert.Equal(t, true, s.admit("order"))
+
+	// too slow: then normal
+	for i := 0; i < 100; i++ {
+		s.observe(false, time.Second*2)
+	}
+	s.evaluate()
+	assert.Equal(t, int32(100), s.percent(manager.PriorityBulk))
+	assert.Equal(t, int32(20), s.percent(manager.PriorityNormal))
+	assert.Equal(t, int32(0), s.percent(manager.PriorityCritical))
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, true, s.admit("trade"))
+	}
+
+	// capped
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 100; j++ {
+			s.observe(true, time.Millisecond)
+		}
+		s.evaluate()
+	}
+	assert.Equal(t, pubShedMaxLevel, s.info().Level)
+	assert.Equal(t, false, s.admit("order"))
+	assert.Equal(t, true, s.admit("trade"))
+
+	w := httptest.NewRecorder()
+	assert.Equal(t, true, s.reject(w, "log"))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+
+	// too few samples tell nothing: recovers step by step
+	s.evaluate()
+	assert.Equal(t, pubShedMaxLevel-60, s.info().Level)
+	for i := 0; i < 4; i++ {
+		s.evaluate()
+	}
+	assert.Equal(t, int32(0), s.info().Level)
+	assert.Equal(t, true, s.admit("log"))
+}
+
+func TestPubShedderDisabled(t *testing.T) {
+	s := newPubShedder(0, 0, 10, nil)
+	assert.Equal(t, false, s.enabled())
+	for i := 0; i < 100; i++ {
+		s.observe(true, time.Second)
+	}
+	s.evaluate()
+	assert.Equal(t, int32(0), s.info().Level)
+	assert.Equal(t, false, s.reject(httptest.NewRecorder(), "log"))
+}
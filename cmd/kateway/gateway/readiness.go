@@ -0,0 +1,195 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/hh"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/cmd/kateway/meta"
+	"github.com/funkygao/httprouter"
+	zklib "github.com/samuel/go-zookeeper/zk"
+)
+
+const (
+	// load balancers of all kateways probe frequently, the result is reused within this
+	readinessCacheTTL = time.Second
+
+	brokerDialTimeout = time.Second
+)
+
+type dependencyStatus struct {
+	Ok     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// readiness is the response body of /ready.
+type readiness struct {
+	Ready     bool                        `json:"ready"`
+	CheckedAt time.Time                   `json:"checked_at"`
+	Deps      map[string]dependencyStatus `json:"deps"`
+}
+
+// readinessProbe tells whether kateway is able to serve: unlike /alive which only tells
+// the process is up, it checks each dependency so that load balancers and orchestrators
+// route only to genuinely ready instances.
+//
+// The dependencies are funcs so that they can be faked in tests.
+type readinessProbe struct {
+	zkSession   func() error
+	clusters    func() map[string][]string // cluster:live broker addrs
+	dial        func(addr string) error
+	refreshedAt func() time.Time // of manager data
+	hhInflights func() int64
+	maintenance func() bool
+
+	mu        sync.Mutex
+	last      readiness
+	checkedAt time.Time
+}
+
+func newReadinessProbe(gw *Gateway) *readinessProbe {
+	return &readinessProbe{
+		zkSession: func() error {
+			if state := gw.zkzone.Conn().State(); state != zklib.StateHasSession {
+				return fmt.Errorf("zk %s", state)
+			}
+			return nil
+		},
+		clusters: func() map[string][]string {
+			r := make(map[string][]string)
+			for _, cluster := range meta.Default.ClusterNames() {
+				r[cluster] = meta.Default.BrokerList(cluster)
+			}
+			return r
+		},
+		dial: func(addr string) error {
+			conn, err := net.DialTimeout("tcp", addr, brokerDialTimeout)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+		refreshedAt: func() time.Time { return manager.Default.RefreshedAt() },
+		hhInflights: func() int64 {
+			if hh.Default == nil {
+				return 0
+			}
+			return hh.Default.Inflights()
+		},
+		maintenance: gw.maintenance.active,
+	}
+}
+
+// check returns the readiness, probing the dependencies at most once per readinessCacheTTL.
+func (this *readinessProbe) check() readiness {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if time.Since(this.checkedAt) < readinessCacheTTL {
+		return this.last
+	}
+
+	this.last = this.probe()
+	this.checkedAt = this.last.CheckedAt
+	return this.last
+}
+
+func (this *readinessProbe) probe() readiness {
+	r := readiness{
+		Ready:     true,
+		CheckedAt: time.Now(),
+		Deps:      make(map[string]dependencyStatus),
+	}
+	set := func(name string, err error) {
+		if err != nil {
+			r.Ready = false
+			r.Deps[name] = dependencyStatus{Ok: false, Detail: err.Error()}
+		} else {
+			r.Deps[name] = dependencyStatus{Ok: true}
+		}
+	}
+
+	set("zk", this.zkSession())
+
+	// at least 1 reachable broker per cluster, clusters are probed concurrently
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for cluster, brokers := range this.clusters() {
+		wg.Add(1)
+		go func(cluster string, brokers []string) {
+			defer wg.Done()
+
+			err := this.probeBrokers(brokers)
+			mu.Lock()
+			set("kafka."+cluster, err)
+			mu.Unlock()
+		}(cluster, brokers)
+	}
+	wg.Wait()
+
+	var managerErr error
+	if stale := Options.ReadyManagerStaleness; stale > 0 {
+		if at := this.refreshedAt(); at.IsZero() {
+			managerErr = fmt.Errorf("never refreshed")
+		} else if age := r.CheckedAt.Sub(at); age > stale {
+			managerErr = fmt.Errorf("refreshed %s ago", age)
+		}
+	}
+	set("manager", managerErr)
+
+	var hhErr error
+	if max := Options.ReadyMaxHhInflights; max > 0 {
+		if n := this.hhInflights(); n > max {
+			hhErr = fmt.Errorf("%d inflights over %d", n, max)
+		}
+	}
+	set("hh", hhErr)
+
+	var maintenanceErr error
+	if this.maintenance() {
+		maintenanceErr = fmt.Errorf("in maintenance")
+	}
+	set("maintenance", maintenanceErr)
+
+	return r
+}
+
+// probeBrokers returns nil as soon as a broker is reachable.
+func (this *readinessProbe) probeBrokers(brokers []string) error {
+	if len(brokers) == 0 {
+		return fmt.Errorf("no live brokers")
+	}
+
+	var errs []string
+	for _, addr := range brokers {
+		err := this.dial(addr)
+		if err == nil {
+			return nil
+		}
+
+		errs = append(errs, err.Error())
+	}
+
+	sort.Strings(errs)
+	return fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+// checkReadyHandler responds 200 if ready else 503, with the dependency breakdown in body.
+func (this *Gateway) checkReadyHandler(w http.ResponseWriter, r *http.Request,
+	params httprouter.Params) {
+	ready := this.readiness.check()
+	b, _ := json.Marshal(ready)
+	if !ready.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(b)
+}
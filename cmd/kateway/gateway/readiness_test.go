@@ -0,0 +1,83 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func newFakeReadinessProbe() *readinessProbe {
+	return &readinessProbe{
+		zkSession: func() error { return nil },
+		clusters: func() map[string][]string {
+			return map[string][]string{
+				"c1": {"10.1.1.1:9092", "10.1.1.2:9092"},
+			}
+		},
+		dial: func(addr string) error {
+			if addr == "10.1.1.1:9092" {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+		refreshedAt: func() time.Time { return time.Now() },
+		hhInflights: func() int64 { return 0 },
+		maintenance: func() bool { return false },
+	}
+}
+
+func TestReadinessProbe(t *testing.T) {
+	Options.ReadyManagerStaleness = time.Minute * 30
+	Options.ReadyMaxHhInflights = 100
+
+	p := newFakeReadinessProbe()
+	r := p.probe()
+	assert.Equal(t, true, r.Ready)
+	assert.Equal(t, 5, len(r.Deps))
+	assert.Equal(t, true, r.Deps["kafka.c1"].Ok) // 1 reachable broker is enough
+
+	p.clusters = func() map[string][]string {
+		return map[string][]string{"c1": {"10.1.1.1:9092"}, "c2": nil}
+	}
+	p.refreshedAt = func() time.Time { return time.Now().Add(-time.Hour) }
+	p.hhInflights = func() int64 { return 101 }
+	r = p.probe()
+	assert.Equal(t, false, r.Ready)
+	assert.Equal(t, "connection refused", r.Deps["kafka.c1"].Detail)
+	assert.Equal(t, "no live brokers", r.Deps["kafka.c2"].Detail)
+	assert.Equal(t, false, r.Deps["manager"].Ok)
+	assert.Equal(t, "101 inflights over 100", r.Deps["hh"].Detail)
+	assert.Equal(t, true, r.Deps["zk"].Ok)
+
+	// 0 disables the check
+	Options.ReadyManagerStaleness = 0
+	Options.ReadyMaxHhInflights = 0
+	r = p.probe()
+	assert.Equal(t, true, r.Deps["manager"].Ok)
+	assert.Equal(t, true, r.Deps["hh"].Ok)
+}
+
+func TestCheckReadyHandler(t *testing.T) {
+	Options.ReadyManagerStaleness = time.Minute * 30
+	Options.ReadyMaxHhInflights = 100
+
+	gw := &Gateway{readiness: newFakeReadinessProbe()}
+	w := httptest.NewRecorder()
+	gw.checkReadyHandler(w, nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// cached within readinessCacheTTL
+	gw.readiness.zkSession = func() error { return errors.New("zk StateDisconnected") }
+	w = httptest.NewRecorder()
+	gw.checkReadyHandler(w, nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	gw.readiness.checkedAt = time.Time{}
+	w = httptest.NewRecorder()
+	gw.checkReadyHandler(w, nil, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
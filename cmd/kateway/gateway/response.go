@@ -12,13 +12,23 @@ func punishClient() {
 	time.Sleep(Options.BadClientPunishDuration)
 }
 
-func _writeErrorResponse(w http.ResponseWriter, err string, code int) {
-	var out = map[string]string{
-		"errmsg": err,
-	}
-	b, _ := json.Marshal(out)
+func _writeErrorResponse(w http.ResponseWriter, err string, status int) {
+	writeErrorCode(w, errCodeOf(err, status), err, status)
+}
 
-	http.Error(w, string(b), code)
+func writeErrorCode(w http.ResponseWriter, code ErrCode, err string, status int) {
+	b, _ := json.Marshal(errorResponse{
+		Code:      code,
+		Msg:       err,
+		Retryable: errCatalog[code],
+		RequestId: w.Header().Get(HttpHeaderRequestId),
+	})
+
+	w.Header().Set("Content-Type", "application/json; charset=utf8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(b)
+	w.Write([]byte{'\n'})
 }
 
 func writeNotFound(w http.ResponseWriter) {
@@ -51,7 +61,7 @@ func writeQuotaExceeded(w http.ResponseWriter) {
 	punishClient() // twice on purpose
 
 	w.Header().Set("Connection", "close")
-	_writeErrorResponse(w, "quota exceeded", http.StatusTooManyRequests)
+	writeErrorCode(w, ErrCodeQuotaExceeded, "quota exceeded", http.StatusTooManyRequests)
 }
 
 func writeServerError(w http.ResponseWriter, err string) {
@@ -63,6 +73,14 @@ func writeServerError(w http.ResponseWriter, err string) {
 	_writeErrorResponse(w, err, http.StatusInternalServerError)
 }
 
+// writeStoreError responds the system error of the underlying store, e,g. kafka brokers down.
+func writeStoreError(w http.ResponseWriter, err string) {
+	time.Sleep(Options.InternalServerErrorBackoff)
+
+	// unknown errors of the store are regarded as broker unavailable
+	writeErrorCode(w, errCodeOf(err, http.StatusServiceUnavailable), err, http.StatusInternalServerError)
+}
+
 func writeBadRequest(w http.ResponseWriter, err string) {
 	punishClient()
 
@@ -18,11 +18,24 @@ func (this *Gateway) buildRouting() {
 
 		// health check
 		this.manServer.Router().GET("/alive", m(this.checkAliveHandler))
+		this.manServer.Router().GET("/ready", m(this.checkReadyHandler))
 
 		// api for 'gk kateway'
 		this.manServer.Router().GET("/v1/clusters", m(this.manServer.clustersHandler))
 		this.manServer.Router().GET("/v1/status", m(this.manServer.statusHandler))
+		this.manServer.Router().GET("/v1/inflight", m(this.manServer.inflightHandler))
 		this.manServer.Router().PUT("/v1/options/:option/:value", m(this.manServer.setOptionHandler))
+		this.manServer.Router().GET("/v1/options", m(this.manServer.getOptionsHandler))
+		this.manServer.Router().PUT("/v1/options", m(this.manServer.putOptionsHandler))
+		this.manServer.Router().GET("/v1/trace", m(this.manServer.listTraceHandler))
+		this.manServer.Router().PUT("/v1/trace", m(this.manServer.enableTraceHandler))
+		this.manServer.Router().DELETE("/v1/trace", m(this.manServer.disableTraceHandler))
+		this.manServer.Router().GET("/v1/trace/dump", m(this.manServer.dumpTraceHandler))
+		this.manServer.Router().GET("/v1/maintenance", m(this.manServer.maintenanceHandler))
+		this.manServer.Router().PUT("/v1/maintenance", m(this.manServer.enterMaintenanceHandler))
+		this.manServer.Router().DELETE("/v1/maintenance", m(this.manServer.exitMaintenanceHandler))
+		this.manServer.Router().GET("/v1/shed", m(this.manServer.pubShedHandler))
+		this.manServer.Router().GET("/v1/versions", m(this.manServer.clientVersionsHandler))
 
 		// api for pubsub manager
 		this.manServer.Router().GET("/v1/partitions/:appid/:topic/:ver",
@@ -31,6 +44,8 @@ func (this *Gateway) buildRouting() {
 			m(this.manServer.createTopicHandler))
 		this.manServer.Router().PUT("/v1/topics/:appid/:topic/:ver",
 			m(this.manServer.alterTopicHandler))
+		this.manServer.Router().GET("/v1/naming/:appid/:topic/:ver",
+			m(this.manServer.topicNamingHandler))
 		this.manServer.Router().POST("/v1/jobs/:appid/:topic/:ver",
 			this.manServer.createJobHandler)
 		this.manServer.Router().PUT("/v1/webhooks/:appid/:topic/:ver",
@@ -45,6 +60,14 @@ func (this *Gateway) buildRouting() {
 		// Pub related api for pubsub manager
 		this.manServer.Router().GET("/v1/raw/pub/:topic/:ver",
 			m(this.manServer.pubRawHandler))
+		this.manServer.Router().GET("/v1/hh/:appid/:topic/:ver",
+			m(this.manServer.hhSnapshotHandler))
+		this.manServer.Router().GET("/v1/hhpolicy",
+			m(this.manServer.hhPolicyHandler))
+		this.manServer.Router().PUT("/v1/hhpolicy/:cluster/:topic/:state",
+			m(this.manServer.setHhPolicyHandler))
+		this.manServer.Router().DELETE("/v1/hhpolicy/:cluster/:topic",
+			m(this.manServer.resetHhPolicyHandler))
 
 		// Sub related api for pubsub manager
 		this.manServer.Router().GET("/v1/raw/sub/:appid/:topic/:ver",
@@ -63,44 +86,77 @@ func (this *Gateway) buildRouting() {
 			m(this.manServer.delSubGroupHandler))
 		this.manServer.Router().PUT("/v1/offset/:appid/:topic/:ver/:group/:partition",
 			m(this.manServer.resetSubOffsetHandler))
+		this.manServer.Router().GET("/v1/bandwidth",
+			m(this.manServer.subBandwidthHandler))
+		this.manServer.Router().PUT("/v1/bandwidth/:appid/:group/:limit",
+			m(this.manServer.setSubBandwidthHandler))
+		this.manServer.Router().GET("/v1/scale/:appid/:topic/:ver/:group",
+			m(this.manServer.subScaleHintHandler))
+		this.manServer.Router().GET("/v1/sub/export",
+			m(this.manServer.subExportHandler))
+		this.manServer.Router().GET("/v1/spools",
+			m(this.manServer.spoolsHandler))
+		this.manServer.Router().PUT("/v1/spools/:appid/:topic/:ver/:group",
+			m(this.manServer.createSpoolHandler))
+		this.manServer.Router().DELETE("/v1/spools/:appid/:topic/:ver/:group",
+			m(this.manServer.deleteSpoolHandler))
+		this.manServer.Router().PUT("/v1/spools/:appid/:topic/:ver/:group/replay",
+			m(this.manServer.replaySpoolHandler))
+		this.manServer.Router().POST("/v1/browser/tokens",
+			m(this.manServer.browserTokenHandler))
 	}
 
 	if this.pubServer != nil {
 		this.pubServer.Router().NotFound = http.HandlerFunc(this.pubServer.notFoundHandler)
 		this.pubServer.Router().MethodNotAllowed = http.HandlerFunc(this.pubServer.notAllowedHandler)
 
-		// health check
-		this.pubServer.Router().GET("/alive", m(this.checkAliveHandler))
+		// Pub is rejected in maintenance mode
+		p := func(h httprouter.Handle) httprouter.Handle { return m(this.pubGuard(h)) }
 
-		this.pubServer.Router().POST("/v1/raw/msgs/:cluster/:topic", m(this.pubServer.pubRawHandler))
-		this.pubServer.Router().POST("/v1/msgs/:topic/:ver", m(this.pubServer.pubHandler))
-		this.pubServer.Router().POST("/v1/ws/msgs/:topic/:ver", m(this.pubServer.pubWsHandler))
-		this.pubServer.Router().POST("/v1/jobs/:topic/:ver", m(this.pubServer.addJobHandler))
+		// health check: /alive for liveness, /ready for load balancer
+		this.pubServer.Router().GET("/alive", m(this.checkAliveHandler))
+		this.pubServer.Router().GET("/ready", m(this.checkReadyHandler))
+
+		this.pubServer.Router().POST("/v1/raw/msgs/:cluster/:topic", p(this.pubServer.pubRawHandler))
+		this.pubServer.Router().POST("/v1/msgs/:topic/:ver", p(this.pubServer.pubHandler))
+		this.pubServer.Router().POST("/v1/ws/msgs/:topic/:ver", p(this.pubServer.pubWsHandler))
+		this.pubServer.Router().POST("/v1/multi/msgs", p(this.pubServer.pubMultiHandler))
+		this.pubServer.Router().GET("/v1/receipts/:id", m(this.pubServer.receiptHandler))
+		this.pubServer.Router().POST("/v1/jobs/:topic/:ver", p(this.pubServer.addJobHandler))
 		this.pubServer.Router().DELETE("/v1/jobs/:topic/:ver", m(this.pubServer.deleteJobHandler))
 
 		// pubServer acts as a XA compliant RM(resource manager)
-		this.pubServer.Router().POST("/v1/xa/prepare/:topic/:ver", m(this.pubServer.xa_prepare))
+		this.pubServer.Router().POST("/v1/xa/prepare/:topic/:ver", p(this.pubServer.xa_prepare))
 		this.pubServer.Router().PUT("/v1/xa/rollback", m(this.pubServer.xa_commit))
 		this.pubServer.Router().PUT("/v1/xa/abort", m(this.pubServer.xa_rollback))
 
 		// TODO deprecated
-		this.pubServer.Router().POST("/topics/:topic/:ver", m(this.pubServer.pubHandler))
+		this.pubServer.Router().POST("/topics/:topic/:ver", p(this.pubServer.pubHandler))
 	}
 
 	if this.subServer != nil {
 		this.subServer.Router().NotFound = http.HandlerFunc(this.subServer.notFoundHandler)
 		this.subServer.Router().MethodNotAllowed = http.HandlerFunc(this.subServer.notAllowedHandler)
 
-		// health check
+		// health check: /alive for liveness, /ready for load balancer
 		this.subServer.Router().GET("/alive", m(this.checkAliveHandler))
+		this.subServer.Router().GET("/ready", m(this.checkReadyHandler))
 
 		this.subServer.Router().GET("/v1/raw/msgs/:cluster/:topic", m(this.subServer.subRawHandler))
-		this.subServer.Router().GET("/v1/msgs/:appid/:topic/:ver", m(this.subServer.subHandler))
+		// web frontends Sub with browser token, preflighted for the Authorization header
+		b := func(h httprouter.Handle) httprouter.Handle { return m(this.subServer.browserAuth(h)) }
+		this.subServer.Router().GET("/v1/msgs/:appid/:topic/:ver", b(this.subServer.subHandler))
+		this.subServer.Router().OPTIONS("/v1/msgs/:appid/:topic/:ver", m(this.corsPreflightHandler))
 		this.subServer.Router().PUT("/v1/msgs/:appid/:topic/:ver", m(this.subServer.buryHandler))
-		this.subServer.Router().GET("/v1/ws/msgs/:appid/:topic/:ver", m(this.subServer.subWsHandler))
+		this.subServer.Router().GET("/v1/ws/msgs/:appid/:topic/:ver", b(this.subServer.subWsHandler))
 		this.subServer.Router().PUT("/v1/offsets/:appid/:topic/:ver/:group", m(this.subServer.ackHandler))
 		this.subServer.Router().PUT("/v1/raw/offsets/:cluster/:topic/:group", m(this.subServer.ackRawHandler))
 
+		// partition aware consumers Sub assigned partitions and manage offsets themselves
+		this.subServer.Router().GET("/v1/assigned/msgs/:appid/:topic/:ver", m(this.subServer.subAssignedHandler))
+		this.subServer.Router().GET("/v1/assigned/offsets/:appid/:topic/:ver/:group", m(this.subServer.assignedOffsetsHandler))
+		this.subServer.Router().PUT("/v1/assigned/offsets/:appid/:topic/:ver/:group", m(this.subServer.commitAssignedOffsetsHandler))
+
 		// TODO deprecated
 		this.subServer.Router().GET("/topics/:appid/:topic/:ver", m(this.subServer.subHandler))
 	}
@@ -17,8 +17,13 @@ func setupHttpsListener(listener net.Listener, certFile, keyFile string) (net.Li
 		return nil, nil, err
 	}
 
+	nextProtos := []string{"http/1.1", "h2"}
+	if Options.EnableHttp2 {
+		// server preference wins in ALPN
+		nextProtos = []string{"h2", "http/1.1"}
+	}
 	config := &tls.Config{
-		NextProtos:   []string{"http/1.1", "h2"},
+		NextProtos:   nextProtos,
 		Certificates: []tls.Certificate{cer},
 	}
 
@@ -0,0 +1,150 @@
+package gateway
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/funkygao/log4go"
+	"golang.org/x/net/http2"
+)
+
+// http2Preface is the connection preface sent by HTTP/2 clients with prior knowledge.
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// h2cListener serves cleartext HTTP/2(h2c) with prior knowledge on a plain TCP listener.
+//
+// Each accepted conn is sniffed in its own goroutine: conns that start with the HTTP/2
+// preface are served by the http2 server directly, the others are handed to net/http by
+// Accept. HTTP/1.1 Upgrade: h2c is not supported.
+//
+// Since net/http never sees the h2c conns, the conn state hook is fired here so that the
+// per-connection accounting works for both.
+type h2cListener struct {
+	net.Listener
+
+	name      string
+	server    *http.Server
+	h2        *http2.Server
+	connState func(net.Conn, http.ConnState)
+
+	conns     chan net.Conn
+	errCh     chan error
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newH2cListener(name string, l net.Listener, server *http.Server, h2 *http2.Server) *h2cListener {
+	this := &h2cListener{
+		Listener:  l,
+		name:      name,
+		server:    server,
+		h2:        h2,
+		connState: server.ConnState,
+		conns:     make(chan net.Conn),
+		errCh:     make(chan error, 1),
+		closed:    make(chan struct{}),
+	}
+	go this.acceptLoop()
+	return this
+}
+
+func (this *h2cListener) acceptLoop() {
+	for {
+		c, err := this.Listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(time.Millisecond * 5)
+				continue
+			}
+
+			this.errCh <- err
+			return
+		}
+
+		go this.sniff(c)
+	}
+}
+
+func (this *h2cListener) sniff(c net.Conn) {
+	br := bufio.NewReaderSize(c, len(http2Preface))
+	c.SetReadDeadline(time.Now().Add(Options.HttpReadTimeout))
+	isH2 := true
+	for i := 1; i <= len(http2Preface); i++ {
+		b, err := br.Peek(i)
+		if err != nil || b[i-1] != http2Preface[i-1] {
+			// the early bytes tell HTTP/1.x from HTTP/2, e,g. GET and POST
+			isH2 = false
+			break
+		}
+	}
+	c.SetReadDeadline(time.Time{})
+
+	sc := &sniffedConn{Conn: c, r: br}
+	if !isH2 {
+		select {
+		case this.conns <- sc:
+		case <-this.closed:
+			c.Close()
+		}
+		return
+	}
+
+	if this.connState != nil {
+		this.connState(sc, http.StateNew)
+		this.connState(sc, http.StateActive)
+	}
+
+	log.Debug("%s h2c conn from %s", this.name, c.RemoteAddr())
+	this.h2.ServeConn(sc, &http2.ServeConnOpts{BaseConfig: this.server})
+
+	if this.connState != nil {
+		this.connState(sc, http.StateClosed)
+	}
+}
+
+func (this *h2cListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-this.conns:
+		return c, nil
+
+	case err := <-this.errCh:
+		return nil, err
+	}
+}
+
+func (this *h2cListener) Close() error {
+	this.closeOnce.Do(func() {
+		close(this.closed)
+	})
+	return this.Listener.Close()
+}
+
+// sniffedConn replays the sniffed bytes before reading from the conn.
+type sniffedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (this *sniffedConn) Read(b []byte) (int, error) {
+	return this.r.Read(b)
+}
+
+func (this *sniffedConn) unwrap() net.Conn {
+	return this.Conn
+}
+
+// subClientId identifies a Sub client, each of which owns a consumer group instance.
+//
+// HTTP/1.x client is the connection. HTTP/2 multiplexes Sub calls over a connection, so the
+// client is the connection plus the Sub target, and clients can run multiple consumers of
+// the same group over a connection by X-Sub-Session header.
+func subClientId(r *http.Request, cluster, topic, group string) string {
+	if r.ProtoMajor < 2 {
+		return r.RemoteAddr
+	}
+
+	return r.RemoteAddr + "/" + cluster + "." + topic + "." + group + "/" + r.Header.Get(HttpHeaderSubSession)
+}
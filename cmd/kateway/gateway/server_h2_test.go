@@ -0,0 +1,181 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"golang.org/x/net/http2"
+)
+
+func TestH2cListenerHttp1(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})}
+	hl := newH2cListener("test", l, server, nil)
+	defer hl.Close()
+	go server.Serve(hl)
+
+	// shorter than the HTTP/2 preface
+	c, err := net.Dial("tcp", l.Addr().String())
+	assert.Equal(t, nil, err)
+	c.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(c), nil)
+	assert.Equal(t, nil, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "HTTP/1.0", string(body))
+}
+
+func TestSubClientId(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/v1/msgs/app/topic/v1?group=g", nil)
+	r.RemoteAddr = "10.1.1.1:12345"
+	assert.Equal(t, "10.1.1.1:12345", subClientId(r, "me", "app.topic.v1", "app.g"))
+
+	r.ProtoMajor = 2
+	assert.Equal(t, "10.1.1.1:12345/me.app.topic.v1.app.g/", subClientId(r, "me", "app.topic.v1", "app.g"))
+	r.Header.Set(HttpHeaderSubSession, "2")
+	assert.Equal(t, "10.1.1.1:12345/me.app.topic.v1.app.g/2", subClientId(r, "me", "app.topic.v1", "app.g"))
+}
+
+// h1 vs h2 loopback benchmark of Pub and Sub, the numbers in README come from:
+//
+//	go test -run none -bench H2 -benchtime 20000x -count 3
+//
+// The handlers do the HTTP work of pubHandler and subHandler without kafka: Pub reads the
+// body and responds with partition and offset, Sub responds a ready message.
+const (
+	h2BenchClients  = 64
+	h2BenchBodySize = 256
+)
+
+func h2BenchPubHandler(w http.ResponseWriter, r *http.Request) {
+	body := make([]byte, r.ContentLength)
+	if _, err := io.ReadFull(r.Body, body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set(HttpHeaderPartition, "0")
+	w.Header().Set(HttpHeaderOffset, "9087")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(ResponseOk)
+}
+
+func h2BenchSubHandler(body []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf8")
+		w.Header().Set(HttpHeaderMsgKey, "")
+		w.Header().Set(HttpHeaderPartition, "0")
+		w.Header().Set(HttpHeaderOffset, "9087")
+		w.Write(body)
+	}
+}
+
+// benchmarkH2 runs b.N requests from h2BenchClients concurrent clients over HTTP/1.1 with a
+// conn per client, or HTTP/2(h2c) with all clients sharing 1 conn, and reports throughput
+// and latency percentiles.
+func benchmarkH2(b *testing.B, h2 bool, method string, handler http.Handler) {
+	Options.HttpReadTimeout = time.Second * 5 // for h2c sniffing
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	server := &http.Server{Handler: handler}
+	hl := newH2cListener("bench", l, server, &http2.Server{MaxConcurrentStreams: 250})
+	defer hl.Close()
+	go server.Serve(hl)
+
+	var rt http.RoundTripper = &http.Transport{MaxIdleConnsPerHost: h2BenchClients}
+	if h2 {
+		rt = &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		}
+	}
+	client := &http.Client{Transport: rt}
+	url := "http://" + l.Addr().String() + "/v1/msgs/foobar/v1"
+	body := bytes.Repeat([]byte("X"), h2BenchBodySize)
+
+	var (
+		wg        sync.WaitGroup
+		n         int64 = -1
+		failures  int32
+		latencies = make([][]time.Duration, h2BenchClients)
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	t0 := time.Now()
+	for i := 0; i < h2BenchClients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for atomic.AddInt64(&n, 1) < int64(b.N) {
+				var reqBody io.Reader
+				if method == "POST" {
+					reqBody = bytes.NewReader(body)
+				}
+				req, _ := http.NewRequest(method, url, reqBody)
+
+				t1 := time.Now()
+				resp, err := client.Do(req)
+				if err != nil {
+					atomic.AddInt32(&failures, 1)
+					continue
+				}
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+				latencies[i] = append(latencies[i], time.Since(t1))
+			}
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(t0)
+	b.StopTimer()
+
+	if failures > 0 {
+		b.Fatalf("%d requests failed", failures)
+	}
+
+	var all []time.Duration
+	for _, l := range latencies {
+		all = append(all, l...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	b.ReportMetric(float64(b.N)/elapsed.Seconds(), "req/s")
+	b.ReportMetric(float64(all[len(all)/2])/float64(time.Millisecond), "p50-ms")
+	b.ReportMetric(float64(all[len(all)*99/100])/float64(time.Millisecond), "p99-ms")
+}
+
+func BenchmarkH2PubHttp1(b *testing.B) {
+	benchmarkH2(b, false, "POST", http.HandlerFunc(h2BenchPubHandler))
+}
+
+func BenchmarkH2PubHttp2(b *testing.B) {
+	benchmarkH2(b, true, "POST", http.HandlerFunc(h2BenchPubHandler))
+}
+
+func BenchmarkH2SubHttp1(b *testing.B) {
+	benchmarkH2(b, false, "GET", h2BenchSubHandler(bytes.Repeat([]byte("X"), h2BenchBodySize)))
+}
+
+func BenchmarkH2SubHttp2(b *testing.B) {
+	benchmarkH2(b, true, "GET", h2BenchSubHandler(bytes.Repeat([]byte("X"), h2BenchBodySize)))
+}
@@ -1,9 +1,13 @@
 package gateway
 
 import (
+	"os"
 	"time"
 
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/naming"
 	"github.com/funkygao/golib/ratelimiter"
+	log "github.com/funkygao/log4go"
 )
 
 // management server
@@ -12,6 +16,10 @@ type manServer struct {
 
 	throttleAddTopic  *ratelimiter.LeakyBuckets
 	throttleSubStatus *ratelimiter.LeakyBuckets
+	scaler            *subScaler
+	exporter          *subExporter
+	topicNaming       *naming.Policy
+	auditor           log.Logger
 }
 
 func newManServer(httpAddr, httpsAddr string, maxClients int, gw *Gateway) *manServer {
@@ -19,7 +27,29 @@ func newManServer(httpAddr, httpsAddr string, maxClients int, gw *Gateway) *manS
 		webServer:         newWebServer("man_server", httpAddr, httpsAddr, maxClients, time.Minute, gw),
 		throttleAddTopic:  ratelimiter.NewLeakyBuckets(60, time.Minute),
 		throttleSubStatus: ratelimiter.NewLeakyBuckets(60, time.Minute),
+		scaler:            newSubScaler(),
+		exporter:          newSubExporter(),
 	}
 
+	var err error
+	if this.topicNaming, err = naming.New(ctx.ZoneTopicNaming(Options.Zone)); err != nil {
+		panic(err)
+	}
+
+	// audit of runtime options change
+	this.auditor = log.NewDefaultLogger(log.TRACE)
+	this.auditor.DeleteFilter("stdout")
+
+	_ = os.Mkdir("audit", os.ModePerm)
+	rotateEnabled, discardWhenDiskFull := true, false
+	filer := log.NewFileLogWriter("audit/man_audit.log", rotateEnabled, discardWhenDiskFull, 0644)
+	if filer == nil {
+		panic("failed to open man audit log")
+	}
+	filer.SetFormat("[%d %T] [%L] (%S) %M")
+	filer.SetRotateLines(0)
+	filer.SetRotateDaily(true)
+	this.auditor.AddFilter("file", logLevel, filer)
+
 	return this
 }
@@ -20,6 +20,10 @@ type pubServer struct {
 	auditor     log.Logger
 
 	throttleBadAppid *ratelimiter.LeakyBuckets
+	tenantQuotas     *tenantQuotas
+	dedup            *dedupFilters
+	receipts         *pubReceipts
+	jobQueues        *jobQueues
 }
 
 func newPubServer(httpAddr, httpsAddr string, maxClients int, gw *Gateway) *pubServer {
@@ -27,6 +31,10 @@ func newPubServer(httpAddr, httpsAddr string, maxClients int, gw *Gateway) *pubS
 		webServer:        newWebServer("pub_server", httpAddr, httpsAddr, maxClients, Options.HttpReadTimeout, gw),
 		throttlePub:      ratelimiter.NewLeakyBuckets(Options.PubQpsLimit, time.Minute),
 		throttleBadAppid: ratelimiter.NewLeakyBuckets(3, time.Minute),
+		tenantQuotas:     newTenantQuotas(),
+		dedup:            newDedupFilters(),
+		receipts:         newPubReceipts(),
+		jobQueues:        newJobQueues(gw.zkzone),
 	}
 	this.pubMetrics = NewPubMetrics(this.gw)
 	this.onConnNewFunc = this.onConnNew
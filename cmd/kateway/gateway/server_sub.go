@@ -25,6 +25,9 @@ type subServer struct {
 	idleConns     map[net.Conn]struct{}
 	idleConnsLock sync.Mutex
 
+	activeConns     map[string]net.Conn // key is remote addr, conns handling a request
+	activeConnsLock sync.RWMutex
+
 	auditor log.Logger
 
 	timer *timewheel.TimeWheel
@@ -38,9 +41,12 @@ type subServer struct {
 	ackCh        chan ackOffsets                                // client ack'ed offsets
 	ackedOffsets map[string]map[string]map[string]map[int]int64 // [cluster][topic][group][partition]: offset
 
-	subMetrics *subMetrics
+	subMetrics  *subMetrics
+	redelivery  *subRedelivery
+	retryChains *subRetryChains
 
 	throttleBadGroup *ratelimiter.LeakyBuckets
+	bandwidth        *subBandwidth
 	goodGroupClients map[string]struct{} // key is remote addr(port inclusive)
 	goodGroupLock    sync.RWMutex
 }
@@ -50,16 +56,20 @@ func newSubServer(httpAddr, httpsAddr string, maxClients int, gw *Gateway) *subS
 		webServer:        newWebServer("sub_server", httpAddr, httpsAddr, maxClients, Options.HttpReadTimeout, gw),
 		closedConnCh:     make(chan string, 1<<10),
 		idleConns:        make(map[net.Conn]struct{}, 200),
+		activeConns:      make(map[string]net.Conn, 200),
 		wsReadLimit:      8 << 10,
 		wsPongWait:       time.Minute,
 		timer:            timewheel.NewTimeWheel(time.Second, 120),
 		throttleBadGroup: ratelimiter.NewLeakyBuckets(3, time.Minute),
+		bandwidth:        newSubBandwidth(),
+		redelivery:       newSubRedelivery(),
 		goodGroupClients: make(map[string]struct{}, 100),
 		ackShutdown:      0,
 		ackCh:            make(chan ackOffsets, 100),
 		ackedOffsets:     make(map[string]map[string]map[string]map[int]int64),
 	}
 	this.subMetrics = NewSubMetrics(this.gw)
+	this.retryChains = newSubRetryChains(this.gw.zkzone.RetryChain)
 	this.waitExitFunc = this.waitExit
 	this.connStateFunc = this.connStateHandler
 
@@ -99,6 +109,48 @@ func (this *subServer) Start() {
 	this.webServer.Start()
 }
 
+func (this *subServer) forgetActiveConn(c net.Conn) {
+	this.activeConnsLock.Lock()
+	delete(this.activeConns, c.RemoteAddr().String())
+	this.activeConnsLock.Unlock()
+}
+
+// vectoredConn returns the TCP conn of a plain HTTP/1.1 Sub for messageSetWriter to write
+// the response body directly, nil if not applicable.
+func (this *subServer) vectoredConn(w http.ResponseWriter, r *http.Request) net.Conn {
+	if !Options.SubWritev || r.ProtoMajor != 1 || r.ProtoMinor < 1 {
+		return nil
+	}
+	if _, gzipped := w.(gzipResponseWriter); gzipped {
+		return nil
+	}
+	if ww, ok := w.(WriterWrapper); ok && ww.teed() != nil {
+		// debug tracing needs the response body
+		return nil
+	}
+
+	this.activeConnsLock.RLock()
+	c := this.activeConns[r.RemoteAddr]
+	this.activeConnsLock.RUnlock()
+	for c != nil {
+		switch conn := c.(type) {
+		case *net.TCPConn:
+			return conn
+
+		case interface {
+			unwrap() net.Conn
+		}:
+			c = conn.unwrap()
+
+		default:
+			// e,g. TLS
+			return nil
+		}
+	}
+
+	return nil
+}
+
 func (this *subServer) connStateHandler(c net.Conn, cs http.ConnState) {
 	switch cs {
 	case http.StateNew:
@@ -121,7 +173,13 @@ func (this *subServer) connStateHandler(c net.Conn, cs http.ConnState) {
 		delete(this.idleConns, c)
 		this.idleConnsLock.Unlock()
 
+		this.activeConnsLock.Lock()
+		this.activeConns[c.RemoteAddr().String()] = c
+		this.activeConnsLock.Unlock()
+
 	case http.StateIdle:
+		this.forgetActiveConn(c)
+
 		// StateIdle represents a connection that has finished
 		// handling a request and is in the keep-alive state, waiting
 		// for a new request. Connections transition from StateIdle
@@ -143,6 +201,8 @@ func (this *subServer) connStateHandler(c net.Conn, cs http.ConnState) {
 
 	case http.StateHijacked:
 		// websocket steals the socket
+		this.forgetActiveConn(c)
+
 		this.idleConnsLock.Lock()
 		delete(this.idleConns, c)
 		this.idleConnsLock.Unlock()
@@ -163,6 +223,8 @@ func (this *subServer) connStateHandler(c net.Conn, cs http.ConnState) {
 		remoteAddr := c.RemoteAddr().String()
 		log.Debug("closed from %s", remoteAddr)
 
+		this.forgetActiveConn(c)
+
 		this.goodGroupLock.Lock()
 		delete(this.goodGroupClients, remoteAddr)
 		this.goodGroupLock.Unlock()
@@ -266,6 +328,7 @@ func (this *subServer) ackCommitter() {
 
 					// TODO validation
 					this.ackedOffsets[ack.cluster][ack.topic][ack.group][ack.Partition] = ack.Offset
+					this.redelivery.ack(ack.cluster, ack.topic, ack.group, int32(ack.Partition), ack.Offset)
 				}
 
 				n++
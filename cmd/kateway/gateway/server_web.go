@@ -13,6 +13,7 @@ import (
 
 	"github.com/funkygao/httprouter"
 	log "github.com/funkygao/log4go"
+	"golang.org/x/net/http2"
 )
 
 type webServer struct {
@@ -22,6 +23,7 @@ type webServer struct {
 	maxClients int
 
 	router *httprouter.Router
+	h2     *http2.Server // nil if HTTP/2 disabled
 
 	httpListener net.Listener
 	httpServer   *http.Server
@@ -81,6 +83,19 @@ func newWebServer(name string, httpAddr, httpsAddr string, maxClients int, idleT
 		}
 	}
 
+	if Options.EnableHttp2 {
+		this.h2 = &http2.Server{
+			MaxConcurrentStreams: uint32(Options.Http2MaxStreams),
+			IdleTimeout:          idleTimeout,
+		}
+
+		if this.httpsServer != nil {
+			if err := http2.ConfigureServer(this.httpsServer, this.h2); err != nil {
+				panic(fmt.Errorf("%s h2: %v", this.name, err))
+			}
+		}
+	}
+
 	return this
 }
 
@@ -171,6 +186,9 @@ func (this *webServer) startServer(https bool) {
 			}
 
 			theListener = LimitListener(this.name, this.gw, theListener, this.maxClients)
+			if !https && this.h2 != nil {
+				theListener = newH2cListener(this.name, theListener, this.httpServer, this.h2)
+			}
 			waitListenerUpOnce.Do(func() {
 				close(waitListenerUp)
 			})
@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/cmd/kateway/meta"
+	log "github.com/funkygao/log4go"
+)
+
+const dependencyDialTimeout = time.Second * 3
+
+// checkDependencies verifies reachability of zk and at least one broker of each cluster
+// before serving, and returns the failed checks.
+func (this *Gateway) checkDependencies() (errs []error) {
+	if err := this.zkzone.Ping(); err != nil {
+		errs = append(errs, fmt.Errorf("zk[%s]: %v", Options.Zone, err))
+	}
+
+	for _, cluster := range meta.Default.ClusterNames() {
+		if err := anyBrokerReachable(meta.Default.BrokerList(cluster)); err != nil {
+			errs = append(errs, fmt.Errorf("cluster[%s]: %v", cluster, err))
+		}
+	}
+
+	for _, err := range errs {
+		log.Error("dependency check %v", err)
+	}
+
+	return
+}
+
+func anyBrokerReachable(brokers []string) error {
+	if len(brokers) == 0 {
+		return fmt.Errorf("no live brokers")
+	}
+
+	var lastErr error
+	for _, addr := range brokers {
+		conn, err := net.DialTimeout("tcp", addr, dependencyDialTimeout)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		lastErr = err
+	}
+
+	return fmt.Errorf("%d brokers unreachable, last: %v", len(brokers), lastErr)
+}
+
+// managerDegraded returns true if the manager store runs on the local snapshot instead of its db.
+func managerDegraded() bool {
+	if d, ok := manager.Default.(interface {
+		Degraded() bool
+	}); ok {
+		return d.Degraded()
+	}
+
+	return false
+}
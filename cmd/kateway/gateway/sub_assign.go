@@ -0,0 +1,113 @@
+package gateway
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Shopify/sarama"
+)
+
+// Assigned Sub is for partition aware consumers doing their own partition assignment,
+// e,g. stream processing frameworks: the client Subs an explicit partition list without
+// joining the consumer group, so there is no rebalance, and manages the offsets itself.
+//
+// The position of each partition is the offset given by the client if any, else the
+// offset committed by the group, else reset. Nothing is committed on Sub: the client
+// commits the next offsets to consume through the assigned offsets endpoint.
+//
+// A group is either assigned or balanced: the offsets of a group with online consumers
+// are owned by kafka-cg, commits of assigned Sub would be overwritten.
+
+// assignedOffset is the position of a partition of assigned Sub: the next offset to consume.
+type assignedOffset struct {
+	Partition int32 `json:"partition"`
+	Offset    int64 `json:"offset"`
+}
+
+type assignedOffsets []assignedOffset
+
+func (this assignedOffsets) Len() int           { return len(this) }
+func (this assignedOffsets) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this assignedOffsets) Less(i, j int) bool { return this[i].Partition < this[j].Partition }
+
+// parseAssignedPartitions parses partition list e,g. 0,2,5 against the partitions of the
+// topic, all partitions if empty.
+func parseAssignedPartitions(s string, all []int32) ([]int32, error) {
+	if s == "" {
+		return all, nil
+	}
+
+	valid := make(map[int32]bool, len(all))
+	for _, p := range all {
+		valid[p] = true
+	}
+
+	var r []int32
+	seen := make(map[int32]bool)
+	for _, p := range strings.Split(s, ",") {
+		n, err := strconv.ParseInt(strings.TrimSpace(p), 10, 32)
+		if err != nil || !valid[int32(n)] {
+			return nil, ErrInvalidPartition
+		}
+
+		if !seen[int32(n)] {
+			seen[int32(n)] = true
+			r = append(r, int32(n))
+		}
+	}
+	return r, nil
+}
+
+// parseAssignedOffsets parses partition:offset list e,g. 0:100,2:300.
+func parseAssignedOffsets(s string) (map[int32]int64, error) {
+	r := make(map[int32]int64)
+	if s == "" {
+		return r, nil
+	}
+
+	for _, po := range strings.Split(s, ",") {
+		tuple := strings.SplitN(strings.TrimSpace(po), ":", 2)
+		if len(tuple) != 2 {
+			return nil, ErrInvalidOffset
+		}
+
+		partition, err := strconv.ParseInt(tuple[0], 10, 32)
+		if err != nil {
+			return nil, ErrInvalidPartition
+		}
+		offset, err := strconv.ParseInt(tuple[1], 10, 64)
+		if err != nil || offset < 0 {
+			return nil, ErrInvalidOffset
+		}
+
+		r[int32(partition)] = offset
+	}
+	return r, nil
+}
+
+// assignedPositions returns where to start consuming each partition: the explicit offset,
+// else the committed offset{partitionId: offset}, else reset.
+func assignedPositions(partitions []int32, explicit map[int32]int64, committed map[string]int64,
+	reset string) (map[int32]int64, error) {
+	r := make(map[int32]int64, len(partitions))
+	for _, p := range partitions {
+		if offset, present := explicit[p]; present {
+			r[p] = offset
+		} else if offset, present := committed[strconv.Itoa(int(p))]; present {
+			r[p] = offset
+		} else if reset == "newest" {
+			r[p] = sarama.OffsetNewest
+		} else {
+			r[p] = sarama.OffsetOldest
+		}
+	}
+
+	for p := range explicit {
+		if _, present := r[p]; !present {
+			// offset of a partition not assigned
+			return nil, ErrInvalidPartition
+		}
+	}
+
+	return r, nil
+}
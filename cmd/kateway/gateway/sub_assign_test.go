@@ -0,0 +1,57 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/assert"
+)
+
+func TestParseAssignedPartitions(t *testing.T) {
+	all := []int32{0, 1, 2, 3}
+
+	r, err := parseAssignedPartitions("", all)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, all, r)
+
+	r, err = parseAssignedPartitions("2, 0,2", all)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []int32{2, 0}, r)
+
+	_, err = parseAssignedPartitions("0,4", all)
+	assert.Equal(t, ErrInvalidPartition, err)
+	_, err = parseAssignedPartitions("0,", all)
+	assert.Equal(t, ErrInvalidPartition, err)
+}
+
+func TestParseAssignedOffsets(t *testing.T) {
+	r, err := parseAssignedOffsets("")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(r))
+
+	r, err = parseAssignedOffsets("0:100, 2:300")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[int32]int64{0: 100, 2: 300}, r)
+
+	_, err = parseAssignedOffsets("0")
+	assert.Equal(t, ErrInvalidOffset, err)
+	_, err = parseAssignedOffsets("0:-1")
+	assert.Equal(t, ErrInvalidOffset, err)
+	_, err = parseAssignedOffsets("x:1")
+	assert.Equal(t, ErrInvalidPartition, err)
+}
+
+func TestAssignedPositions(t *testing.T) {
+	committed := map[string]int64{"0": 50, "1": 60}
+
+	r, err := assignedPositions([]int32{0, 1, 2}, map[int32]int64{1: 100}, committed, "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[int32]int64{0: 50, 1: 100, 2: sarama.OffsetOldest}, r)
+
+	r, err = assignedPositions([]int32{2}, nil, committed, "newest")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[int32]int64{2: sarama.OffsetNewest}, r)
+
+	_, err = assignedPositions([]int32{0}, map[int32]int64{1: 100}, committed, "")
+	assert.Equal(t, ErrInvalidPartition, err)
+}
@@ -0,0 +1,148 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket throttles bytes per second with a burst of 1 second.
+//
+// Tokens are allowed to go negative so that a message larger than the burst still
+// gets through: the debt is paid by the delay of the following reservations.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   int64 // bytes per second
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate int64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: float64(rate), last: time.Now()}
+}
+
+// reserve takes n tokens and returns how long the caller should wait before sending.
+func (this *tokenBucket) reserve(n int, now time.Time) time.Duration {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if elapsed := now.Sub(this.last); elapsed > 0 {
+		this.tokens += float64(this.rate) * elapsed.Seconds()
+		if this.tokens > float64(this.rate) {
+			this.tokens = float64(this.rate)
+		}
+	}
+	this.last = now
+
+	this.tokens -= float64(n)
+	if this.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-this.tokens / float64(this.rate) * float64(time.Second))
+}
+
+func (this *tokenBucket) setRate(rate int64) {
+	this.mu.Lock()
+	this.rate = rate
+	if this.tokens > float64(rate) {
+		this.tokens = float64(rate)
+	}
+	this.mu.Unlock()
+}
+
+// subBandwidth caps the Sub egress bytes of this kateway, globally and per consumer group,
+// so that a group replaying history can't saturate the NIC and starve online consumers.
+type subBandwidth struct {
+	global *tokenBucket // rate follows Options.SubBandwidthLimit
+
+	mu     sync.RWMutex
+	groups map[string]*tokenBucket // key is myAppid.group
+}
+
+func newSubBandwidth() *subBandwidth {
+	return &subBandwidth{
+		global: newTokenBucket(Options.SubBandwidthLimit),
+		groups: make(map[string]*tokenBucket),
+	}
+}
+
+// reserve returns how long to wait before writing n bytes of message to a Sub client of the group.
+func (this *subBandwidth) reserve(myAppid, group string, n int) time.Duration {
+	var (
+		delay time.Duration
+		now   = time.Now()
+	)
+
+	if limit := Options.SubBandwidthLimit; limit > 0 {
+		this.global.setRate(limit) // might be changed at runtime
+		delay = this.global.reserve(n, now)
+	}
+
+	this.mu.RLock()
+	b, present := this.groups[myAppid+"."+group]
+	this.mu.RUnlock()
+	if present {
+		if d := b.reserve(n, now); d > delay {
+			delay = d
+		}
+	}
+
+	return delay
+}
+
+// setGroupLimit caps bytes per second of a group, 0 means unlimited.
+func (this *subBandwidth) setGroupLimit(myAppid, group string, limit int64) {
+	key := myAppid + "." + group
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if limit <= 0 {
+		delete(this.groups, key)
+		return
+	}
+
+	if b, present := this.groups[key]; present {
+		b.setRate(limit)
+	} else {
+		this.groups[key] = newTokenBucket(limit)
+	}
+}
+
+// groupLimits returns {myAppid.group: bytes per second}.
+func (this *subBandwidth) groupLimits() map[string]int64 {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	r := make(map[string]int64, len(this.groups))
+	for key, b := range this.groups {
+		b.mu.Lock()
+		r[key] = b.rate
+		b.mu.Unlock()
+	}
+	return r
+}
+
+// throttle blocks the Sub response until n bytes of message are allowed to be written.
+func (this *subServer) throttle(myAppid, group string, n int, clientGoneCh <-chan bool) error {
+	delay := this.bandwidth.reserve(myAppid, group, n)
+	if delay <= 0 {
+		return nil
+	}
+
+	this.subMetrics.Throttled.Mark(1)
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-clientGoneCh:
+		return ErrClientGone
+
+	case <-this.gw.shutdownCh:
+		// don't delay the shutdown
+		return nil
+
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,44 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(1000)
+	now := b.last
+
+	// burst of 1 second
+	assert.Equal(t, time.Duration(0), b.reserve(600, now))
+	assert.Equal(t, time.Duration(0), b.reserve(400, now))
+	assert.Equal(t, time.Millisecond*500, b.reserve(500, now))
+
+	// debt is paid before refilled
+	assert.Equal(t, time.Duration(0), b.reserve(0, now.Add(time.Millisecond*500)))
+	assert.Equal(t, time.Duration(0), b.reserve(1000, now.Add(time.Millisecond*1500)))
+
+	// message larger than the burst
+	assert.Equal(t, time.Second*2, b.reserve(2000, now.Add(time.Millisecond*1500)))
+
+	// refill never exceeds the burst
+	assert.Equal(t, time.Duration(0), b.reserve(1000, now.Add(time.Hour)))
+	assert.Equal(t, time.Millisecond, b.reserve(1, now.Add(time.Hour)))
+}
+
+func TestSubBandwidthGroupLimit(t *testing.T) {
+	bw := newSubBandwidth()
+	assert.Equal(t, time.Duration(0), bw.reserve("app1", "g1", 1<<30))
+
+	bw.setGroupLimit("app1", "g1", 100)
+	assert.Equal(t, map[string]int64{"app1.g1": 100}, bw.groupLimits())
+	assert.Equal(t, time.Duration(0), bw.reserve("app1", "g2", 1<<30))
+	bw.reserve("app1", "g1", 100)
+	assert.NotEqual(t, time.Duration(0), bw.reserve("app1", "g1", 100))
+
+	bw.setGroupLimit("app1", "g1", 0)
+	assert.Equal(t, 0, len(bw.groupLimits()))
+	assert.Equal(t, time.Duration(0), bw.reserve("app1", "g1", 1<<30))
+}
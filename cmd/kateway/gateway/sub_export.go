@@ -0,0 +1,189 @@
+package gateway
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/meta"
+	"github.com/funkygao/gafka/zk"
+)
+
+// subExport is the consumption snapshot of all consumer groups of a cluster.
+type subExport struct {
+	Cluster   string           `json:"cluster"`
+	CreatedAt time.Time        `json:"created_at"`
+	Topics    []subExportTopic `json:"topics"`
+}
+
+type subExportTopic struct {
+	Topic  string           `json:"topic"`
+	Groups []subExportGroup `json:"groups"`
+}
+
+type subExportGroup struct {
+	Group      string               `json:"group"` // appid.group
+	Online     bool                 `json:"online"`
+	Lag        int64                `json:"lag"`
+	Hosts      []string             `json:"hosts"` // of the online members
+	Partitions []subExportPartition `json:"partitions"`
+}
+
+type subExportPartition struct {
+	Partition int    `json:"partition"`
+	Oldest    int64  `json:"oldest"`
+	Newest    int64  `json:"newest"`
+	Consumed  int64  `json:"consumed"`
+	Lag       int64  `json:"lag"`
+	Host      string `json:"host,omitempty"`
+}
+
+// filter returns the topics of an appid, all topics if appid is empty.
+func (this *subExport) filter(appid string) []subExportTopic {
+	if appid == "" {
+		return this.Topics
+	}
+
+	r := make([]subExportTopic, 0)
+	for _, t := range this.Topics {
+		if strings.HasPrefix(t.Topic, appid+".") {
+			r = append(r, t)
+		}
+	}
+	return r
+}
+
+// subExporter caches the consumption snapshot of each cluster: dashboards poll all
+// groups of all topics and walking zk plus querying kafka offsets per poll is expensive.
+//
+// Concurrent polls of the same cluster wait for a single load.
+type subExporter struct {
+	ttl  func() time.Duration
+	load func(cluster string) ([]zk.ConsumerMeta, error)
+
+	mu      sync.Mutex
+	entries map[string]*subExportEntry // cluster:entry
+}
+
+type subExportEntry struct {
+	mu     sync.Mutex
+	export *subExport
+}
+
+func newSubExporter() *subExporter {
+	return &subExporter{
+		ttl: func() time.Duration { return Options.SubExportCacheTTL },
+		load: func(cluster string) ([]zk.ConsumerMeta, error) {
+			return meta.Default.ZkCluster(cluster).AllConsumerGroups()
+		},
+		entries: make(map[string]*subExportEntry),
+	}
+}
+
+// export returns the cached snapshot of the cluster if it is fresh, else reloads it.
+func (this *subExporter) export(cluster string) (*subExport, error) {
+	this.mu.Lock()
+	e, present := this.entries[cluster]
+	if !present {
+		e = &subExportEntry{}
+		this.entries[cluster] = e
+	}
+	this.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.export != nil && time.Since(e.export.CreatedAt) < this.ttl() {
+		return e.export, nil
+	}
+
+	consumers, err := this.load(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	e.export = buildSubExport(cluster, consumers, time.Now())
+	return e.export, nil
+}
+
+// buildSubExport groups the consumers by topic and group, all sorted for stable output.
+func buildSubExport(cluster string, consumers []zk.ConsumerMeta, now time.Time) *subExport {
+	groups := make(map[string]map[string]*subExportGroup) // topic:group:group
+	for _, c := range consumers {
+		if _, present := groups[c.Topic]; !present {
+			groups[c.Topic] = make(map[string]*subExportGroup)
+		}
+		g, present := groups[c.Topic][c.Group]
+		if !present {
+			g = &subExportGroup{Group: c.Group, Hosts: make([]string, 0)}
+			groups[c.Topic][c.Group] = g
+		}
+
+		pid, _ := strconv.Atoi(c.PartitionId)
+		p := subExportPartition{
+			Partition: pid,
+			Oldest:    c.OldestOffset,
+			Newest:    c.ProducerOffset,
+			Consumed:  c.ConsumerOffset,
+			Lag:       c.Lag,
+		}
+		if c.Online && c.ConsumerZnode != nil {
+			p.Host = c.ConsumerZnode.ClientRealIP()
+		}
+
+		g.Online = g.Online || c.Online
+		g.Lag += c.Lag
+		g.Partitions = append(g.Partitions, p)
+	}
+
+	export := &subExport{
+		Cluster:   cluster,
+		CreatedAt: now,
+		Topics:    make([]subExportTopic, 0, len(groups)),
+	}
+	for topic, topicGroups := range groups {
+		t := subExportTopic{Topic: topic, Groups: make([]subExportGroup, 0, len(topicGroups))}
+		for _, g := range topicGroups {
+			sort.Sort(subExportPartitions(g.Partitions))
+
+			hosts := make(map[string]struct{})
+			for _, p := range g.Partitions {
+				if p.Host != "" {
+					hosts[p.Host] = struct{}{}
+				}
+			}
+			for h := range hosts {
+				g.Hosts = append(g.Hosts, h)
+			}
+			sort.Strings(g.Hosts)
+
+			t.Groups = append(t.Groups, *g)
+		}
+		sort.Sort(subExportGroups(t.Groups))
+
+		export.Topics = append(export.Topics, t)
+	}
+	sort.Sort(subExportTopics(export.Topics))
+
+	return export
+}
+
+type subExportTopics []subExportTopic
+
+func (s subExportTopics) Len() int           { return len(s) }
+func (s subExportTopics) Less(i, j int) bool { return s[i].Topic < s[j].Topic }
+func (s subExportTopics) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type subExportGroups []subExportGroup
+
+func (s subExportGroups) Len() int           { return len(s) }
+func (s subExportGroups) Less(i, j int) bool { return s[i].Group < s[j].Group }
+func (s subExportGroups) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type subExportPartitions []subExportPartition
+
+func (s subExportPartitions) Len() int           { return len(s) }
+func (s subExportPartitions) Less(i, j int) bool { return s[i].Partition < s[j].Partition }
+func (s subExportPartitions) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/zk"
+)
+
+func TestBuildSubExport(t *testing.T) {
+	member := &zk.ConsumerZnode{Id: "10.1.1.1@10.10.1.2:8a3c0b2e"}
+	consumers := []zk.ConsumerMeta{
+		{Group: "app2.g1", Topic: "app1.foo.v1", PartitionId: "1", Online: true, ConsumerZnode: member,
+			OldestOffset: 0, ProducerOffset: 100, ConsumerOffset: 90, Lag: 10},
+		{Group: "app2.g1", Topic: "app1.foo.v1", PartitionId: "0", Online: true, ConsumerZnode: member,
+			OldestOffset: 0, ProducerOffset: 200, ConsumerOffset: 150, Lag: 50},
+		{Group: "app1.g0", Topic: "app1.foo.v1", PartitionId: "0",
+			OldestOffset: 0, ProducerOffset: 200, ConsumerOffset: 200},
+		{Group: "app3.g1", Topic: "app3.bar.v1", PartitionId: "0",
+			OldestOffset: 5, ProducerOffset: 8, ConsumerOffset: 6, Lag: 2},
+	}
+
+	now := time.Now()
+	export := buildSubExport("me", consumers, now)
+	assert.Equal(t, "me", export.Cluster)
+	assert.Equal(t, now, export.CreatedAt)
+	assert.Equal(t, 2, len(export.Topics))
+	assert.Equal(t, "app1.foo.v1", export.Topics[0].Topic)
+	assert.Equal(t, "app3.bar.v1", export.Topics[1].Topic)
+
+	groups := export.Topics[0].Groups
+	assert.Equal(t, 2, len(groups))
+	assert.Equal(t, "app1.g0", groups[0].Group)
+	assert.Equal(t, false, groups[0].Online)
+	assert.Equal(t, 0, len(groups[0].Hosts))
+
+	g := groups[1]
+	assert.Equal(t, "app2.g1", g.Group)
+	assert.Equal(t, true, g.Online)
+	assert.Equal(t, int64(60), g.Lag)
+	assert.Equal(t, []string{"10.10.1.2"}, g.Hosts)
+	assert.Equal(t, 2, len(g.Partitions))
+	assert.Equal(t, 0, g.Partitions[0].Partition)
+	assert.Equal(t, int64(150), g.Partitions[0].Consumed)
+	assert.Equal(t, "10.10.1.2", g.Partitions[1].Host)
+
+	assert.Equal(t, 1, len(export.filter("app3")))
+	assert.Equal(t, 0, len(export.filter("app")))
+	assert.Equal(t, 2, len(export.filter("")))
+}
+
+func TestSubExporterCache(t *testing.T) {
+	loads := 0
+	ttl := time.Hour
+	e := newSubExporter()
+	e.ttl = func() time.Duration { return ttl }
+	e.load = func(cluster string) ([]zk.ConsumerMeta, error) {
+		loads++
+		return []zk.ConsumerMeta{{Group: "app2.g1", Topic: "app1.foo.v1", PartitionId: "0"}}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		export, err := e.export("me")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, 1, len(export.Topics))
+	}
+	assert.Equal(t, 1, loads)
+
+	e.export("you")
+	assert.Equal(t, 2, loads)
+
+	ttl = 0
+	e.export("me")
+	assert.Equal(t, 3, loads)
+}
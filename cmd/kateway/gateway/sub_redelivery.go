@@ -0,0 +1,193 @@
+package gateway
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	subRedeliveryMaxBackoff = time.Hour
+
+	// unacked messages tracked per group partition, beyond which they are only redelivered
+	// on rebalance as before
+	subRedeliveryMaxPending = 10000
+)
+
+type redeliveryKey struct {
+	cluster, topic, group string
+}
+
+type unackedMessage struct {
+	msg        *sarama.ConsumerMessage
+	deliveries int // how many times delivered
+	dueAt      time.Time
+	index      int // in unackedHeap
+}
+
+// unackedPartition is the unacked messages of a group partition, indexed by offset and
+// ordered by due time so that the next due message is found without scan.
+type unackedPartition struct {
+	offsets map[int64]*unackedMessage
+	byDue   unackedHeap
+}
+
+// subRedelivery tracks messages delivered in explicit ack mode and redelivers those not
+// acked in time with exponential backoff.
+type subRedelivery struct {
+	mu      sync.Mutex
+	pending map[redeliveryKey]map[int32]*unackedPartition
+}
+
+func newSubRedelivery() *subRedelivery {
+	return &subRedelivery{pending: make(map[redeliveryKey]map[int32]*unackedPartition)}
+}
+
+// redeliveryBackoff returns how long to wait for the ack of a message delivered n times:
+// ackTimeout, 2*ackTimeout, 4*ackTimeout... till subRedeliveryMaxBackoff.
+func redeliveryBackoff(ackTimeout time.Duration, deliveries int) time.Duration {
+	d := ackTimeout
+	for i := 1; i < deliveries && d < subRedeliveryMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > subRedeliveryMaxBackoff {
+		d = subRedeliveryMaxBackoff
+	}
+	return d
+}
+
+func (this *subRedelivery) delivered(cluster, group string, msg *sarama.ConsumerMessage,
+	deliveries int, ackTimeout time.Duration, now time.Time) {
+	k := redeliveryKey{cluster: cluster, topic: msg.Topic, group: group}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	partitions, present := this.pending[k]
+	if !present {
+		partitions = make(map[int32]*unackedPartition)
+		this.pending[k] = partitions
+	}
+	p, present := partitions[msg.Partition]
+	if !present {
+		p = &unackedPartition{offsets: make(map[int64]*unackedMessage)}
+		partitions[msg.Partition] = p
+	}
+
+	if m, present := p.offsets[msg.Offset]; present {
+		m.msg = msg
+		m.deliveries = deliveries
+		m.dueAt = now.Add(redeliveryBackoff(ackTimeout, deliveries))
+		heap.Fix(&p.byDue, m.index)
+		return
+	}
+	if len(p.offsets) >= subRedeliveryMaxPending {
+		return
+	}
+
+	m := &unackedMessage{
+		msg:        msg,
+		deliveries: deliveries,
+		dueAt:      now.Add(redeliveryBackoff(ackTimeout, deliveries)),
+	}
+	p.offsets[msg.Offset] = m
+	heap.Push(&p.byDue, m)
+}
+
+// ack forgets messages of the partition upto offset because acks commit cumulatively.
+func (this *subRedelivery) ack(cluster, topic, group string, partition int32, offset int64) {
+	k := redeliveryKey{cluster: cluster, topic: topic, group: group}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	p, present := this.pending[k][partition]
+	if !present {
+		return
+	}
+
+	byDue := p.byDue[:0]
+	for _, m := range p.byDue {
+		if m.msg.Offset <= offset {
+			delete(p.offsets, m.msg.Offset)
+			continue
+		}
+
+		m.index = len(byDue)
+		byDue = append(byDue, m)
+	}
+	for i := len(byDue); i < len(p.byDue); i++ {
+		p.byDue[i] = nil // help GC
+	}
+	p.byDue = byDue
+	heap.Init(&p.byDue)
+	this.cleanup(k, partition)
+}
+
+func (this *subRedelivery) cleanup(k redeliveryKey, partition int32) {
+	if p, present := this.pending[k][partition]; present && len(p.offsets) == 0 {
+		delete(this.pending[k], partition)
+	}
+	if len(this.pending[k]) == 0 {
+		delete(this.pending, k)
+	}
+}
+
+// due takes off the oldest message of the group due for redelivery, nil if none.
+// Only the earliest message of each partition is checked.
+func (this *subRedelivery) due(cluster, topic, group string, now time.Time) *unackedMessage {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	k := redeliveryKey{cluster: cluster, topic: topic, group: group}
+	var (
+		r  *unackedMessage
+		rp *unackedPartition
+	)
+	for _, p := range this.pending[k] {
+		m := p.byDue[0]
+		if m.dueAt.After(now) {
+			continue
+		}
+
+		if r == nil || m.dueAt.Before(r.dueAt) {
+			r, rp = m, p
+		}
+	}
+
+	if r != nil {
+		heap.Pop(&rp.byDue)
+		delete(rp.offsets, r.msg.Offset)
+		this.cleanup(k, r.msg.Partition)
+	}
+
+	return r
+}
+
+type unackedHeap []*unackedMessage
+
+func (h unackedHeap) Len() int           { return len(h) }
+func (h unackedHeap) Less(i, j int) bool { return h[i].dueAt.Before(h[j].dueAt) }
+
+func (h unackedHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *unackedHeap) Push(x interface{}) {
+	m := x.(*unackedMessage)
+	m.index = len(*h)
+	*h = append(*h, m)
+}
+
+func (h *unackedHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil // help GC
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/assert"
+)
+
+func TestRedeliveryBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, redeliveryBackoff(time.Second, 1))
+	assert.Equal(t, time.Second*2, redeliveryBackoff(time.Second, 2))
+	assert.Equal(t, time.Second*8, redeliveryBackoff(time.Second, 4))
+	assert.Equal(t, subRedeliveryMaxBackoff, redeliveryBackoff(time.Minute, 10))
+}
+
+func TestSubRedelivery(t *testing.T) {
+	r := newSubRedelivery()
+	now := time.Now()
+	for i := int64(0); i < 3; i++ {
+		r.delivered("c1", "app2.g1", &sarama.ConsumerMessage{Topic: "t1", Partition: 0, Offset: i}, 1, time.Second, now)
+	}
+	r.delivered("c1", "app2.g1", &sarama.ConsumerMessage{Topic: "t1", Partition: 1, Offset: 5}, 2, time.Second, now)
+
+	// not due yet
+	assert.Equal(t, (*unackedMessage)(nil), r.due("c1", "t1", "app2.g1", now))
+
+	// acks are cumulative
+	r.ack("c1", "t1", "app2.g1", 0, 1)
+	um := r.due("c1", "t1", "app2.g1", now.Add(time.Second))
+	assert.Equal(t, int64(2), um.msg.Offset)
+	assert.Equal(t, 1, um.deliveries)
+	assert.Equal(t, (*unackedMessage)(nil), r.due("c1", "t1", "app2.g1", now.Add(time.Second)))
+
+	// redelivered once, backoff doubled
+	um = r.due("c1", "t1", "app2.g1", now.Add(time.Second*2))
+	assert.Equal(t, int64(5), um.msg.Offset)
+	assert.Equal(t, 0, len(r.pending))
+}
+
+func TestSubRedeliveryDueOrder(t *testing.T) {
+	r := newSubRedelivery()
+	now := time.Now()
+	for i := int64(0); i < 100; i++ {
+		// later offsets delivered earlier
+		r.delivered("c1", "app2.g1", &sarama.ConsumerMessage{Topic: "t1", Partition: int32(i % 3), Offset: i},
+			1, time.Second, now.Add(-time.Duration(i)*time.Millisecond))
+	}
+
+	// redelivered, due later than the others
+	r.delivered("c1", "app2.g1", &sarama.ConsumerMessage{Topic: "t1", Partition: 0, Offset: 99}, 2, time.Second, now)
+
+	r.ack("c1", "t1", "app2.g1", 1, 49)
+	var offsets []int64
+	for um := r.due("c1", "t1", "app2.g1", now.Add(time.Second)); um != nil; um = r.due("c1", "t1", "app2.g1", now.Add(time.Second)) {
+		offsets = append(offsets, um.msg.Offset)
+	}
+	assert.Equal(t, 100-17-1, len(offsets))
+	assert.Equal(t, int64(98), offsets[0])
+	assert.Equal(t, int64(0), offsets[len(offsets)-1])
+
+	um := r.due("c1", "t1", "app2.g1", now.Add(time.Second*2))
+	assert.Equal(t, int64(99), um.msg.Offset)
+	assert.Equal(t, 2, um.deliveries)
+	assert.Equal(t, 0, len(r.pending))
+}
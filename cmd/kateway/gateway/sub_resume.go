@@ -0,0 +1,161 @@
+package gateway
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/dgrijalva/jwt-go"
+	storekfk "github.com/funkygao/gafka/cmd/kateway/store/kafka"
+	"github.com/funkygao/gafka/ctx"
+)
+
+// ResumeTokenSecret is the ctx secret name of the HMAC key signing Sub resume tokens,
+// which must be the same across the kateway instances of a zone.
+const ResumeTokenSecret = "kateway.resume.key"
+
+// resumeClaims is the position of a Sub client carried over its requests by the resume token.
+type resumeClaims struct {
+	Kateway string `json:"kw"`  // id of the kateway that issued the token
+	Client  string `json:"cli"` // sub client id on that kateway
+
+	Cluster string          `json:"cluster"`
+	Topic   string          `json:"topic"` // raw kafka topic
+	Group   string          `json:"group"` // real group
+	Offsets map[int32]int64 `json:"offsets"`
+
+	jwt.StandardClaims
+}
+
+// advance moves the position of a partition to the next offset of a consumed message.
+func (this *resumeClaims) advance(partition int32, offset int64) {
+	if offset+1 > this.Offsets[partition] {
+		this.Offsets[partition] = offset + 1
+	}
+}
+
+func (this *resumeClaims) checkpoints() []storekfk.SubCheckpoint {
+	r := make([]storekfk.SubCheckpoint, 0, len(this.Offsets))
+	for partition, offset := range this.Offsets {
+		r = append(r, storekfk.SubCheckpoint{
+			Cluster:   this.Cluster,
+			Topic:     this.Topic,
+			Group:     this.Group,
+			Partition: partition,
+			Offset:    offset,
+		})
+	}
+	return r
+}
+
+// resumeTokens issues and verifies the resume tokens of Sub clients.
+//
+// Each Sub response carries a token X-Resume-Token with the position of the client, which
+// the client sends back on its next Sub. When the token is sent to another kateway behind
+// the LB, or over a new connection, the group offsets are moved forward to the position
+// before joining the group: the client resumes exactly where it left off instead of from
+// the last offsets committed by the kafka-cg of the old connection, and joins as standby
+// instead of being rejected while its old instance is yet to expire from the group.
+//
+// In ack mode the position advances only with the acks piggybacked on Sub, in auto commit
+// mode with the messages delivered.
+type resumeTokens struct {
+	key []byte
+	ttl time.Duration
+}
+
+func newResumeTokens(ttl time.Duration) (*resumeTokens, error) {
+	key, err := ctx.Secret(ResumeTokenSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resumeTokens{key: []byte(key), ttl: ttl}, nil
+}
+
+func (this *resumeTokens) issue(claims *resumeClaims, now time.Time) (string, error) {
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(this.ttl).Unix()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(this.key)
+}
+
+func (this *resumeTokens) verify(token string) (*resumeClaims, error) {
+	claims := &resumeClaims{}
+	t, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidResumeToken
+		}
+		return this.key, nil
+	})
+	if err != nil || !t.Valid {
+		return nil, ErrInvalidResumeToken
+	}
+
+	if claims.Offsets == nil {
+		claims.Offsets = make(map[int32]int64)
+	}
+	return claims, nil
+}
+
+// resumeOf returns the position of a Sub client from its resume token, a fresh one if absent.
+// from is the kateway id that issued the token if issued by another kateway or over another
+// connection, empty otherwise.
+func (this *resumeTokens) resumeOf(r *http.Request, kateway, client, cluster, rawTopic, realGroup string) (claims *resumeClaims, from string, err error) {
+	token := r.Header.Get(HttpHeaderResumeToken)
+	if token == "" {
+		claims = &resumeClaims{
+			Kateway: kateway,
+			Client:  client,
+			Cluster: cluster,
+			Topic:   rawTopic,
+			Group:   realGroup,
+			Offsets: make(map[int32]int64),
+		}
+		return
+	}
+
+	if claims, err = this.verify(token); err != nil {
+		return
+	}
+
+	if claims.Cluster != cluster || claims.Topic != rawTopic || claims.Group != realGroup {
+		return nil, "", ErrResumeTokenScope
+	}
+
+	if claims.Kateway != kateway || claims.Client != client {
+		from = claims.Kateway
+	}
+	claims.Kateway, claims.Client = kateway, client
+	return
+}
+
+// resume moves the group offsets forward to the position of the client, returns number of
+// partitions moved forward.
+func (this *resumeTokens) resume(claims *resumeClaims) int {
+	return storekfk.MoveOffsetsForward(claims.checkpoints())
+}
+
+// setResumeToken puts the resume token into the response header, advanced to msg if not nil.
+// After the response header is written, it takes effect only as a declared trailer.
+func (this *subServer) setResumeToken(w http.ResponseWriter, claims *resumeClaims, msg *sarama.ConsumerMessage) {
+	if claims == nil {
+		return
+	}
+
+	if msg != nil {
+		claims.advance(msg.Partition, msg.Offset)
+	}
+	if token, err := this.gw.resumeTokens.issue(claims, time.Now()); err == nil {
+		w.Header().Set(HttpHeaderResumeToken, token)
+	}
+}
+
+// declareResumeTrailer announces the resume token trailer of a batch response.
+// It must be called before the response header is written.
+func (this *subServer) declareResumeTrailer(w http.ResponseWriter, claims *resumeClaims) {
+	if claims == nil {
+		return
+	}
+
+	w.Header().Set("Trailer", HttpHeaderResumeToken)
+}
@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/assert"
+)
+
+func TestResumeTokens(t *testing.T) {
+	tokens := &resumeTokens{key: []byte("secret"), ttl: time.Minute}
+	r, _ := http.NewRequest("GET", "/v1/msgs/app2/orders/v1?group=g1", nil)
+
+	// fresh client
+	claims, from, err := tokens.resumeOf(r, "kw1", "1.1.1.1:1000", "me", "app2.orders.v1", "app1.g1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "", from)
+	assert.Equal(t, 0, len(claims.Offsets))
+
+	claims.advance(0, 10)
+	claims.advance(1, 5)
+	claims.advance(0, 8) // redelivered
+	assert.Equal(t, int64(11), claims.Offsets[0])
+	assert.Equal(t, int64(6), claims.Offsets[1])
+
+	token, err := tokens.issue(claims, time.Now())
+	assert.Equal(t, nil, err)
+	r.Header.Set(HttpHeaderResumeToken, token)
+
+	// next Sub over the same connection
+	claims, from, err = tokens.resumeOf(r, "kw1", "1.1.1.1:1000", "me", "app2.orders.v1", "app1.g1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "", from)
+	assert.Equal(t, int64(11), claims.Offsets[0])
+
+	// reconnected through another kateway
+	claims, from, err = tokens.resumeOf(r, "kw2", "1.1.1.1:2000", "me", "app2.orders.v1", "app1.g1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "kw1", from)
+	assert.Equal(t, "kw2", claims.Kateway)
+	assert.Equal(t, 2, len(claims.checkpoints()))
+
+	// another group
+	_, _, err = tokens.resumeOf(r, "kw2", "1.1.1.1:2000", "me", "app2.orders.v1", "app1.g2")
+	assert.Equal(t, ErrResumeTokenScope, err)
+
+	// expired
+	token, _ = tokens.issue(claims, time.Now().Add(-time.Hour))
+	r.Header.Set(HttpHeaderResumeToken, token)
+	_, _, err = tokens.resumeOf(r, "kw2", "1.1.1.1:2000", "me", "app2.orders.v1", "app1.g1")
+	assert.Equal(t, ErrInvalidResumeToken, err)
+
+	// signed by another key
+	other := &resumeTokens{key: []byte("guess"), ttl: time.Minute}
+	token, _ = other.issue(claims, time.Now())
+	r.Header.Set(HttpHeaderResumeToken, token)
+	_, _, err = tokens.resumeOf(r, "kw2", "1.1.1.1:2000", "me", "app2.orders.v1", "app1.g1")
+	assert.Equal(t, ErrInvalidResumeToken, err)
+}
+
+func TestSetResumeToken(t *testing.T) {
+	gw := &Gateway{resumeTokens: &resumeTokens{key: []byte("secret"), ttl: time.Minute}}
+	s := &subServer{webServer: &webServer{gw: gw}}
+
+	// disabled
+	w := httptest.NewRecorder()
+	s.setResumeToken(w, nil, &sarama.ConsumerMessage{Partition: 1, Offset: 5})
+	assert.Equal(t, "", w.Header().Get(HttpHeaderResumeToken))
+
+	claims := &resumeClaims{Offsets: make(map[int32]int64)}
+	s.setResumeToken(w, claims, &sarama.ConsumerMessage{Partition: 1, Offset: 5})
+	claims, err := gw.resumeTokens.verify(w.Header().Get(HttpHeaderResumeToken))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(6), claims.Offsets[1])
+}
+
+func TestResumeTokenTrailer(t *testing.T) {
+	gw := &Gateway{resumeTokens: &resumeTokens{key: []byte("secret"), ttl: time.Minute}}
+	s := &subServer{webServer: &webServer{gw: gw}}
+	batch := []*sarama.ConsumerMessage{
+		{Partition: 0, Offset: 10, Value: []byte("a")},
+		{Partition: 1, Offset: 5, Value: []byte("b")},
+		{Partition: 0, Offset: 11, Value: []byte("c")},
+	}
+
+	// how pumpMessages delivers a batch in auto commit mode
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := &resumeClaims{Offsets: make(map[int32]int64)}
+		msw := newMessageSetWriter(w, nil)
+		for i, msg := range batch {
+			if i == 0 {
+				s.declareResumeTrailer(w, claims)
+				s.setResumeToken(w, claims, msg)
+			}
+			msw.WriteMessage(msg.Partition, msg.Offset, msg.Value)
+			claims.advance(msg.Partition, msg.Offset)
+		}
+		msw.Flush()
+		msw.Close()
+		s.setResumeToken(w, claims, nil)
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Equal(t, nil, err)
+	defer resp.Body.Close()
+
+	claims, err := gw.resumeTokens.verify(resp.Header.Get(HttpHeaderResumeToken))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(claims.Offsets)) // the 1st message only
+
+	ioutil.ReadAll(resp.Body)
+	claims, err = gw.resumeTokens.verify(resp.Trailer.Get(HttpHeaderResumeToken))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(12), claims.Offsets[0])
+	assert.Equal(t, int64(6), claims.Offsets[1])
+}
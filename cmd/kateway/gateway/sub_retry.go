@@ -0,0 +1,154 @@
+package gateway
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/job"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/cmd/kateway/meta"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+	"github.com/funkygao/gafka/sla"
+	"github.com/funkygao/gafka/zk"
+)
+
+const subRetryChainTTL = time.Second * 30
+
+type cachedRetryChain struct {
+	chain    sla.RetryChain // nil if none
+	loadedAt time.Time
+}
+
+// subRetryChains caches the retry chains of explicit ack groups registered in zk.
+type subRetryChains struct {
+	mu     sync.Mutex
+	load   func(cluster, topic, group string) (*zk.RetryChainMeta, error)
+	chains map[redeliveryKey]cachedRetryChain
+}
+
+func newSubRetryChains(load func(cluster, topic, group string) (*zk.RetryChainMeta, error)) *subRetryChains {
+	return &subRetryChains{
+		load:   load,
+		chains: make(map[redeliveryKey]cachedRetryChain),
+	}
+}
+
+// get returns the retry chain of a group, nil if it has none.
+func (this *subRetryChains) get(cluster, topic, group string, now time.Time) (sla.RetryChain, error) {
+	k := redeliveryKey{cluster: cluster, topic: topic, group: group}
+
+	this.mu.Lock()
+	c, present := this.chains[k]
+	this.mu.Unlock()
+	if present && now.Sub(c.loadedAt) < subRetryChainTTL {
+		return c.chain, nil
+	}
+
+	meta, err := this.load(cluster, topic, group)
+	if err != nil {
+		return nil, err
+	}
+
+	c = cachedRetryChain{loadedAt: now}
+	if meta != nil {
+		if c.chain, err = sla.ParseRetryChain(meta.Chain); err != nil {
+			return nil, err
+		}
+	}
+
+	this.mu.Lock()
+	this.chains[k] = c
+	this.mu.Unlock()
+	return c.chain, nil
+}
+
+// retryHop is where a failed message goes next: the topic of the next retry stage fired by
+// the job subsystem after delay, or the dead shadow topic if delay is 0.
+type retryHop struct {
+	appid string // owner of the topics
+	topic string
+	delay time.Duration
+}
+
+// send moves a message to the hop, the key is lost if the hop is a retry stage because jobs
+// carry payload only.
+func (this *retryHop) send(cluster string, key, value []byte) error {
+	if this.delay == 0 {
+		_, _, err := store.DefaultPubStore.SyncPub(cluster, this.topic, key, value)
+		return err
+	}
+
+	_, err := job.Default.Add(this.appid, this.topic, value, time.Now().Add(this.delay).Unix(), job.MinPriority)
+	return err
+}
+
+// nextRetryHop returns the next hop of a message failed in the shadow(empty for the original
+// topic) if the group has a retry chain, nil if it has none or the shadow is not a stage of it.
+func (this *subServer) nextRetryHop(cluster, myAppid, hisAppid, topic, ver, group, shadow string) (*retryHop, error) {
+	chain, err := this.retryChains.get(cluster, manager.Default.KafkaTopic(hisAppid, topic, ver),
+		myAppid+"."+group, time.Now())
+	if err != nil || chain == nil {
+		return nil, err
+	}
+
+	stage := chain.Stage(shadow)
+	if stage < 0 {
+		return nil, nil
+	}
+
+	next, delay, _ := chain.Next(stage)
+	return &retryHop{
+		appid: hisAppid,
+		topic: manager.Default.ShadowTopic(next, myAppid, hisAppid, topic, ver, group),
+		delay: delay,
+	}, nil
+}
+
+// createRetryStages creates the kafka topics and job queues of retry stages, existing ones
+// are skipped so that a retry chain can be extended.
+func (this *manServer) createRetryStages(cluster, appid string, topics []string, ts *sla.TopicSla) error {
+	for _, t := range topics {
+		if err := ensureTopic(cluster, t, ts); err != nil {
+			return err
+		}
+
+		// the job subsystem fires the delayed message into the stage topic
+		exists, _, err := this.gw.zkzone.Conn().Exists(zk.PubsubJobQueues + "/" + t)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		if err = job.Default.CreateJobQueue(Options.AssignJobShardId, appid, t); err != nil {
+			return err
+		}
+		if err = this.gw.zkzone.CreateJobQueue(t, cluster); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureTopic creates a kafka topic if not exists.
+func ensureTopic(cluster, topic string, ts *sla.TopicSla) error {
+	zkcluster := meta.Default.ZkCluster(cluster)
+	if zkcluster == nil {
+		return ErrUndefinedCluster
+	}
+
+	lines, err := zkcluster.AddTopic(topic, ts)
+	if err != nil {
+		return err
+	}
+
+	output := strings.Join(lines, ";")
+	if !strings.Contains(output, "Created topic") && !strings.Contains(output, "already exists") {
+		return errors.New(output)
+	}
+	return nil
+}
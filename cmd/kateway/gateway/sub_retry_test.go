@@ -0,0 +1,40 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/zk"
+)
+
+func TestSubRetryChains(t *testing.T) {
+	var (
+		loads int
+		meta  *zk.RetryChainMeta
+	)
+	chains := newSubRetryChains(func(cluster, topic, group string) (*zk.RetryChainMeta, error) {
+		loads++
+		return meta, nil
+	})
+
+	now := time.Now()
+	chain, err := chains.get("me", "app1.foo.v1", "app2.g1", now)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(chain))
+	assert.Equal(t, 1, loads)
+
+	// cached even if none
+	meta = &zk.RetryChainMeta{Chain: "5s,1m"}
+	chain, _ = chains.get("me", "app1.foo.v1", "app2.g1", now.Add(time.Second))
+	assert.Equal(t, 0, len(chain))
+	assert.Equal(t, 1, loads)
+
+	chain, _ = chains.get("me", "app1.foo.v1", "app2.g1", now.Add(subRetryChainTTL))
+	assert.Equal(t, "5s,1m", chain.String())
+	assert.Equal(t, 2, loads)
+
+	meta = &zk.RetryChainMeta{Chain: "1m,5s"}
+	_, err = chains.get("me", "app1.foo.v1", "app2.g2", now)
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// offsets are committed periodically, rates sampled in shorter window are jittery
+	subScaleMinSampleInterval = time.Second * 30
+
+	// consumers are regarded as saturated only if they fall behind by this ratio,
+	// so that an in-flight lag won't flap the hint
+	subScaleTolerance = 0.1
+)
+
+// subScaleHint is the recommended consumer instance count of a group for app autoscalers.
+type subScaleHint struct {
+	Group          string  `json:"group"`
+	Partitions     int     `json:"partitions"`
+	Consumers      int     `json:"consumers"` // online consumer instances
+	PubRate        float64 `json:"pub_rate"`  // msgs per second
+	SubRate        float64 `json:"sub_rate"`  // msgs per second
+	Lag            int64   `json:"lag"`
+	Recommended    int     `json:"recommended"`
+	PartitionBound bool    `json:"partition_bound"` // more consumers won't help, add partitions
+	Reason         string  `json:"reason"`
+}
+
+type offsetSample struct {
+	at       time.Time
+	produced int64 // sum of newest offsets of all partitions
+	consumed int64 // sum of committed offsets of all partitions
+
+	// rates between this sample and the previous one
+	pubRate, subRate float64
+	rated            bool
+}
+
+// subScaler tracks the production and consumption rate of groups between polls of the
+// scale hint api.
+type subScaler struct {
+	mu      sync.Mutex
+	samples map[string]offsetSample // key is cluster/topic/group
+}
+
+func newSubScaler() *subScaler {
+	return &subScaler{samples: make(map[string]offsetSample)}
+}
+
+// rates returns msgs per second produced to the topic and consumed by the group.
+// ok is false if there is no earlier sample to compare with yet.
+func (this *subScaler) rates(key string, produced, consumed int64, now time.Time) (pubRate, subRate float64, ok bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	prev, present := this.samples[key]
+	if present && now.Sub(prev.at) < subScaleMinSampleInterval {
+		return prev.pubRate, prev.subRate, prev.rated
+	}
+
+	s := offsetSample{at: now, produced: produced, consumed: consumed}
+	if present && produced >= prev.produced && consumed >= prev.consumed {
+		// offsets might go backwards if topic recreated or offset reset
+		elapsed := now.Sub(prev.at).Seconds()
+		s.pubRate = float64(produced-prev.produced) / elapsed
+		s.subRate = float64(consumed-prev.consumed) / elapsed
+		s.rated = true
+	}
+	this.samples[key] = s
+
+	return s.pubRate, s.subRate, s.rated
+}
+
+// recommend calculates the consumer instance count to catch up the lag within drain.
+//
+// Consumption rate is a measure of consumer capacity only when consumers fall behind,
+// otherwise they just consume whatever produced, so the hint never scales down below
+// the current count except the idle consumers beyond partitions.
+func (this *subScaleHint) recommend(drain time.Duration) {
+	need := this.PubRate + float64(this.Lag)/drain.Seconds()
+
+	switch {
+	case this.Consumers == 0:
+		this.Recommended = 1
+		this.Reason = "no online consumers"
+
+	case this.Lag <= 0 || need <= this.SubRate*(1+subScaleTolerance):
+		this.Recommended = this.Consumers
+		this.Reason = "consumers keep up"
+
+	case this.SubRate <= 0:
+		this.Recommended = this.Consumers
+		this.Reason = "consumers make no progress, check them before scaling"
+
+	default:
+		perConsumer := this.SubRate / float64(this.Consumers)
+		this.Recommended = int(math.Ceil(need / perConsumer))
+		this.Reason = "consumers fall behind"
+	}
+
+	if this.Partitions > 0 && this.Recommended > this.Partitions {
+		if this.Consumers < this.Recommended {
+			// consumers beyond partitions would be idle
+			this.PartitionBound = true
+			this.Reason = "partitions are the bottleneck, add partitions"
+		}
+		this.Recommended = this.Partitions
+	}
+}
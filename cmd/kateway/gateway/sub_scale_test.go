@@ -0,0 +1,61 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestSubScalerRates(t *testing.T) {
+	s := newSubScaler()
+	now := time.Now()
+
+	_, _, ok := s.rates("c/t/g", 1000, 500, now)
+	assert.Equal(t, false, ok)
+
+	// too short window reuses the previous rates
+	_, _, ok = s.rates("c/t/g", 1100, 600, now.Add(time.Second))
+	assert.Equal(t, false, ok)
+
+	pubRate, subRate, ok := s.rates("c/t/g", 4000, 2000, now.Add(time.Minute))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, float64(50), pubRate)
+	assert.Equal(t, float64(25), subRate)
+
+	// offsets reset
+	_, _, ok = s.rates("c/t/g", 10, 10, now.Add(time.Minute*2))
+	assert.Equal(t, false, ok)
+}
+
+func TestSubScaleHintRecommend(t *testing.T) {
+	drain := time.Minute
+
+	// keep up
+	h := subScaleHint{Partitions: 8, Consumers: 2, PubRate: 100, SubRate: 100, Lag: 60}
+	h.recommend(drain)
+	assert.Equal(t, 2, h.Recommended)
+	assert.Equal(t, false, h.PartitionBound)
+
+	// fall behind: need 100+6000/60=200 msg/s, each consumer 50 msg/s
+	h = subScaleHint{Partitions: 8, Consumers: 2, PubRate: 100, SubRate: 100, Lag: 6000}
+	h.recommend(drain)
+	assert.Equal(t, 4, h.Recommended)
+	assert.Equal(t, false, h.PartitionBound)
+
+	// partitions are the bottleneck
+	h = subScaleHint{Partitions: 3, Consumers: 2, PubRate: 100, SubRate: 100, Lag: 6000}
+	h.recommend(drain)
+	assert.Equal(t, 3, h.Recommended)
+	assert.Equal(t, true, h.PartitionBound)
+
+	// stuck consumers
+	h = subScaleHint{Partitions: 8, Consumers: 2, PubRate: 100, SubRate: 0, Lag: 6000}
+	h.recommend(drain)
+	assert.Equal(t, 2, h.Recommended)
+
+	// no consumers
+	h = subScaleHint{Partitions: 8, PubRate: 100, Lag: 6000}
+	h.recommend(drain)
+	assert.Equal(t, 1, h.Recommended)
+}
@@ -0,0 +1,372 @@
+package gateway
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	hhdisk "github.com/funkygao/gafka/cmd/kateway/hh/disk"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+	"github.com/funkygao/gafka/zk"
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	spoolRefreshInterval = time.Second * 30
+	spoolFetchBackoff    = time.Second * 5
+)
+
+var spoolHttpClient = &http.Client{Timeout: time.Second * 30}
+
+// subSpooler consumes the spools registered in zk on behalf of their downstreams and
+// stores the messages to local disk before forwarding them, giving downstreams that are
+// frequently offline a durable buffer with replay.
+//
+// Partitions of a spool are balanced across kateways by its consumer group, each kateway
+// forwards what it has spooled.
+type subSpooler struct {
+	gw     *Gateway
+	dir    string
+	maxAge time.Duration
+
+	mu     sync.Mutex
+	spools map[string]*subSpool // cluster/topic/group:spool
+
+	refreshCh chan struct{}
+}
+
+func newSubSpooler(gw *Gateway, dir string, maxAge time.Duration) *subSpooler {
+	return &subSpooler{
+		gw:        gw,
+		dir:       dir,
+		maxAge:    maxAge,
+		spools:    make(map[string]*subSpool),
+		refreshCh: make(chan struct{}, 1),
+	}
+}
+
+func spoolKey(cluster, topic, group string) string {
+	return cluster + "/" + topic + "/" + group
+}
+
+func (this *subSpooler) run() {
+	defer this.gw.wg.Done()
+
+	log.Info("sub spooler started, dir: %s", this.dir)
+
+	ticker := time.NewTicker(spoolRefreshInterval)
+	defer ticker.Stop()
+
+	this.reconcile()
+	for {
+		select {
+		case <-this.gw.shutdownCh:
+			this.closeAll()
+			log.Info("sub spooler stopped")
+			return
+
+		case <-ticker.C:
+			this.reconcile()
+
+		case <-this.refreshCh:
+			this.reconcile()
+		}
+	}
+}
+
+// refresh triggers reconciliation with zk at once instead of waiting for the next tick.
+func (this *subSpooler) refresh() {
+	select {
+	case this.refreshCh <- struct{}{}:
+	default:
+	}
+}
+
+// reconcile starts the newly registered spools, applies changes of the existing ones and
+// removes the deregistered ones.
+func (this *subSpooler) reconcile() {
+	wanted := make(map[string]zk.SpoolMeta)
+	for _, meta := range this.gw.zkzone.Spools() {
+		wanted[spoolKey(meta.Cluster, meta.Topic, meta.Group)] = meta
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for key, meta := range wanted {
+		s, present := this.spools[key]
+		if !present {
+			s, err := openSubSpool(this.dir, meta, this.maxAge)
+			if err != nil {
+				log.Error("spool[%s] open: %v", key, err)
+				continue
+			}
+
+			this.spools[key] = s
+			log.Info("spool[%s] started -> %+v", key, meta.Endpoints)
+			continue
+		}
+
+		s.update(meta)
+	}
+
+	for key, s := range this.spools {
+		if _, present := wanted[key]; present {
+			continue
+		}
+
+		// deregistered: undelivered messages are discarded with it
+		if err := s.stop(true); err != nil {
+			log.Error("spool[%s] remove: %v", key, err)
+		}
+		delete(this.spools, key)
+		log.Info("spool[%s] removed", key)
+	}
+}
+
+func (this *subSpooler) closeAll() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for key, s := range this.spools {
+		if err := s.stop(false); err != nil {
+			log.Error("spool[%s] close: %v", key, err)
+		}
+	}
+	this.spools = make(map[string]*subSpool)
+}
+
+// status returns local state of each spool.
+func (this *subSpooler) status() map[string]map[string]interface{} {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	r := make(map[string]map[string]interface{}, len(this.spools))
+	for key, s := range this.spools {
+		r[key] = map[string]interface{}{
+			"endpoints": s.endpoints(),
+			"inflights": s.spool.Inflights(),
+			"spooled":   s.spool.AppendN(),
+			"forwarded": s.spool.DeliverN(),
+		}
+	}
+	return r
+}
+
+// subSpool consumes a topic into the local disk spool, and forwards the spooled messages.
+type subSpool struct {
+	mu       sync.Mutex
+	meta     zk.SpoolMeta
+	replayAt time.Time // the last replay request applied
+
+	spool *hhdisk.Spool
+	quit  chan struct{}
+	done  chan struct{}
+}
+
+func openSubSpool(dir string, meta zk.SpoolMeta, maxAge time.Duration) (*subSpool, error) {
+	s := &subSpool{
+		meta:     meta,
+		replayAt: meta.ReplayAt, // a replay requested before we start is not ours
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	var err error
+	s.spool, err = hhdisk.OpenSpool(dir, meta.Cluster, meta.Topic+"."+meta.Group, maxAge, s.forward)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.consume()
+	return s, nil
+}
+
+func (this *subSpool) key() string {
+	return spoolKey(this.meta.Cluster, this.meta.Topic, this.meta.Group)
+}
+
+func (this *subSpool) endpoints() []string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.meta.Endpoints
+}
+
+// update applies the latest registration, replaying if requested.
+func (this *subSpool) update(meta zk.SpoolMeta) {
+	this.mu.Lock()
+	this.meta = meta
+	replay := meta.ReplayAt.After(this.replayAt)
+	if replay {
+		this.replayAt = meta.ReplayAt
+	}
+	this.mu.Unlock()
+
+	if !replay {
+		return
+	}
+
+	rewound, err := this.spool.Replay(meta.ReplaySince)
+	if err != nil {
+		log.Error("spool[%s] replay since %s: %v", this.key(), meta.ReplaySince, err)
+		return
+	}
+
+	log.Info("spool[%s] replay since %s requested by %s, rewound: %v", this.key(), meta.ReplaySince, meta.By, rewound)
+}
+
+func (this *subSpool) stop(remove bool) error {
+	close(this.quit)
+	<-this.done
+
+	if remove {
+		return this.spool.Remove()
+	}
+	return this.spool.Close()
+}
+
+// consume fetches messages from kafka and spools them, offsets are committed only after spooled.
+func (this *subSpool) consume() {
+	defer close(this.done)
+
+	var (
+		key = this.key()
+		// a dedicated client id so that each spool has its own consumer group instance
+		clientId = "spool/" + key
+	)
+	for {
+		fetcher, err := store.DefaultSubStore.Fetch(this.meta.Cluster, this.meta.Topic, this.meta.Group,
+			clientId, "", "", Options.PermitStandbySub)
+		if err != nil {
+			log.Error("spool[%s] fetch: %v", key, err)
+
+			select {
+			case <-this.quit:
+				return
+			case <-time.After(spoolFetchBackoff):
+			}
+			continue
+		}
+
+		if !this.pump(fetcher) {
+			fetcher.Close()
+			return
+		}
+
+		fetcher.Close()
+
+		select {
+		case <-this.quit:
+			return
+		case <-time.After(spoolFetchBackoff):
+		}
+	}
+}
+
+// pump returns false if the spool is stopped, true if the fetcher should be recreated.
+func (this *subSpool) pump(fetcher store.Fetcher) bool {
+	for {
+		select {
+		case <-this.quit:
+			return false
+
+		case msg, ok := <-fetcher.Messages():
+			if !ok {
+				return true
+			}
+
+			if err := this.spool.Append(encodeSpoolKey(msg.Partition, msg.Offset, msg.Key), msg.Value); err != nil {
+				// not committed, will be fetched again
+				log.Error("spool[%s] P:%d O:%d append: %v", this.key(), msg.Partition, msg.Offset, err)
+				return true
+			}
+
+			fetcher.CommitUpto(msg)
+
+		case err, ok := <-fetcher.Errors():
+			if !ok {
+				return true
+			}
+
+			log.Error("spool[%s] %v", this.key(), err)
+		}
+	}
+}
+
+// forward posts a spooled message to the endpoints in order until any of them accepts it.
+// Client errors except 408 and 429 mean the message is rejected and will not be retried.
+func (this *subSpool) forward(key, value []byte) error {
+	partition, offset, msgKey, err := decodeSpoolKey(key)
+	if err != nil {
+		log.Error("spool[%s] bad key %q: %v", this.key(), string(key), err)
+		return hhdisk.ErrDiscard
+	}
+
+	var lastErr error = ErrNoEndpoint
+	for _, ep := range this.endpoints() {
+		req, err := http.NewRequest("POST", ep, bytes.NewReader(value))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		req.Header.Set(HttpHeaderPartition, strconv.FormatInt(int64(partition), 10))
+		req.Header.Set(HttpHeaderOffset, strconv.FormatInt(offset, 10))
+		if len(msgKey) > 0 {
+			req.Header.Set(HttpHeaderMsgKey, string(msgKey))
+		}
+
+		resp, err := spoolHttpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode < 300:
+			return nil
+
+		case resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+			log.Warn("spool[%s] P:%d O:%d rejected by %s: %s", this.key(), partition, offset, ep, resp.Status)
+			return hhdisk.ErrDiscard
+
+		default:
+			lastErr = fmt.Errorf("%s: %s", ep, resp.Status)
+		}
+	}
+
+	return lastErr
+}
+
+// encodeSpoolKey keeps the kafka position of the message in spool so that downstream can
+// dedup replayed messages.
+func encodeSpoolKey(partition int32, offset int64, key []byte) []byte {
+	return append([]byte(fmt.Sprintf("%d:%d:", partition, offset)), key...)
+}
+
+func decodeSpoolKey(b []byte) (partition int32, offset int64, key []byte, err error) {
+	parts := strings.SplitN(string(b), ":", 3)
+	if len(parts) != 3 {
+		err = ErrInvalidSpoolKey
+		return
+	}
+
+	p, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil {
+		return
+	}
+	if offset, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return
+	}
+
+	return int32(p), offset, []byte(parts[2]), nil
+}
@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/funkygao/assert"
+	hhdisk "github.com/funkygao/gafka/cmd/kateway/hh/disk"
+	"github.com/funkygao/gafka/zk"
+)
+
+func TestSpoolKey(t *testing.T) {
+	p, o, k, err := decodeSpoolKey(encodeSpoolKey(3, 1024, []byte("a:b")))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int32(3), p)
+	assert.Equal(t, int64(1024), o)
+	assert.Equal(t, "a:b", string(k))
+
+	_, _, k, err = decodeSpoolKey(encodeSpoolKey(0, 0, nil))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(k))
+
+	_, _, _, err = decodeSpoolKey([]byte("foo"))
+	assert.Equal(t, ErrInvalidSpoolKey, err)
+}
+
+func TestSubSpoolForward(t *testing.T) {
+	var status int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "2", r.Header.Get(HttpHeaderPartition))
+		assert.Equal(t, "10", r.Header.Get(HttpHeaderOffset))
+		assert.Equal(t, "k1", r.Header.Get(HttpHeaderMsgKey))
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	s := &subSpool{meta: zk.SpoolMeta{Cluster: "me", Topic: "app1.foo.v1", Group: "app2.g1", Endpoints: []string{ts.URL}}}
+	key := encodeSpoolKey(2, 10, []byte("k1"))
+
+	status = http.StatusOK
+	assert.Equal(t, nil, s.forward(key, []byte("hello")))
+
+	// rejected by downstream
+	status = http.StatusBadRequest
+	assert.Equal(t, hhdisk.ErrDiscard, s.forward(key, []byte("hello")))
+
+	// downstream unavailable, retry later
+	status = http.StatusTooManyRequests
+	assert.NotEqual(t, nil, s.forward(key, []byte("hello")))
+	status = http.StatusServiceUnavailable
+	assert.NotEqual(t, nil, s.forward(key, []byte("hello")))
+
+	s.meta.Endpoints = nil
+	assert.Equal(t, ErrNoEndpoint, s.forward(key, []byte("hello")))
+}
@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Partition(int32) Offset(int64) MessageSize(int32)
+const messageMetaSize = 4 + 8 + 4
+
+// pending messages of vectored write are flushed upto these limits
+const (
+	maxPendingMessages = 256
+	maxPendingBytes    = 1 << 20
+)
+
+var crlf = []byte("\r\n")
+
+var messageSetWriterPool = sync.Pool{
+	New: func() interface{} {
+		return &messageSetWriter{}
+	},
+}
+
+// messageSetWriter writes batch Sub response in MessageSet format:
+// MessageSet => [Partition(int32) Offset(int64) MessageSize(int32) Message] BigEndian
+//
+// For plain HTTP/1.1 Sub over TCP, messages are pending until Flush, then go straight to the
+// socket as a single http chunk in one writev: chunk size, meta and body of each message,
+// CRLF. The bodies are never copied, they are in the sarama fetch response or prefetch cache.
+// The http.ResponseWriter is flushed before, so that the chunk follows the headers and
+// whatever net/http has buffered, and net/http writes the last chunk when the handler returns.
+//
+// Otherwise, e,g. HTTP/2, TLS or gzip, each message is written to the http.ResponseWriter.
+//
+// sendfile is not applicable because messages are always in memory rather than files.
+type messageSetWriter struct {
+	w    io.Writer
+	conn net.Conn // nil if vectored write not applicable
+
+	meta      [messageMetaSize]byte
+	metas     []byte   // meta of the pending messages
+	bodies    [][]byte // body of the pending messages
+	pending   int      // bytes of the pending messages
+	chunkHead [18]byte // chunk size in hex and CRLF
+	vec       [][]byte
+}
+
+// newMessageSetWriter creates a messageSetWriter, conn is where to write the pending messages
+// directly, nil to write each message to w.
+func newMessageSetWriter(w io.Writer, conn net.Conn) *messageSetWriter {
+	mw := messageSetWriterPool.Get().(*messageSetWriter)
+	mw.w = w
+	if _, ok := w.(http.Flusher); ok {
+		mw.conn = conn
+	}
+	return mw
+}
+
+func putMessageMeta(b []byte, partition int32, offset int64, size int) {
+	binary.BigEndian.PutUint32(b[0:4], uint32(partition))
+	binary.BigEndian.PutUint64(b[4:12], uint64(offset))
+	binary.BigEndian.PutUint32(b[12:16], uint32(size))
+}
+
+func (this *messageSetWriter) WriteMessage(partition int32, offset int64, body []byte) error {
+	if this.conn == nil {
+		putMessageMeta(this.meta[:], partition, offset, len(body))
+		if _, err := this.w.Write(this.meta[:]); err != nil {
+			return err
+		}
+
+		_, err := this.w.Write(body)
+		return err
+	}
+
+	n := len(this.metas)
+	this.metas = append(this.metas, this.meta[:]...)
+	putMessageMeta(this.metas[n:], partition, offset, len(body))
+	this.bodies = append(this.bodies, body)
+	this.pending += messageMetaSize + len(body)
+	if len(this.bodies) >= maxPendingMessages || this.pending >= maxPendingBytes {
+		return this.Flush()
+	}
+
+	return nil
+}
+
+// Flush writes the pending messages as a http chunk in one writev.
+func (this *messageSetWriter) Flush() error {
+	if len(this.bodies) == 0 {
+		return nil
+	}
+
+	this.w.(http.Flusher).Flush()
+
+	this.vec = append(this.vec, append(strconv.AppendInt(this.chunkHead[:0], int64(this.pending), 16), crlf...))
+	for i, body := range this.bodies {
+		this.vec = append(this.vec, this.metas[i*messageMetaSize:(i+1)*messageMetaSize], body)
+	}
+	this.vec = append(this.vec, crlf)
+	err := writeVector(this.conn, this.vec)
+	if ww, ok := this.w.(interface {
+		wroteDirectly(int)
+	}); ok {
+		ww.wroteDirectly(this.pending)
+	}
+
+	this.reset()
+	return err
+}
+
+func (this *messageSetWriter) reset() {
+	for i := range this.bodies {
+		this.bodies[i] = nil // help GC
+	}
+	for i := range this.vec {
+		this.vec[i] = nil
+	}
+	this.bodies = this.bodies[:0]
+	this.vec = this.vec[:0]
+	this.metas = this.metas[:0]
+	this.pending = 0
+}
+
+// Close returns the writer to pool, it must not be used after Close.
+// Messages not flushed yet are discarded.
+func (this *messageSetWriter) Close() {
+	this.reset()
+	this.w, this.conn = nil, nil
+	messageSetWriterPool.Put(this)
+}
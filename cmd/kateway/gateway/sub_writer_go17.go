@@ -0,0 +1,18 @@
+// +build !go1.8
+
+package gateway
+
+import (
+	"net"
+)
+
+// writeVector writes the buffers to conn one by one: writev is not available before go1.8,
+// but the buffers are still written without copying.
+func writeVector(conn net.Conn, vec [][]byte) error {
+	for _, b := range vec {
+		if _, err := conn.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
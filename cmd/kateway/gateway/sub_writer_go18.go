@@ -0,0 +1,14 @@
+// +build go1.8
+
+package gateway
+
+import (
+	"net"
+)
+
+// writeVector writes the buffers to conn, in a single writev syscall for *net.TCPConn.
+func writeVector(conn net.Conn, vec [][]byte) error {
+	bufs := net.Buffers(vec)
+	_, err := bufs.WriteTo(conn)
+	return err
+}
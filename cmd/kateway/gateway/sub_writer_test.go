@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestMessageSetWriter(t *testing.T) {
+	var buf bytes.Buffer
+	msw := newMessageSetWriter(&buf, nil)
+	assert.Equal(t, nil, msw.WriteMessage(1, 9087, []byte("hello world")))
+	assert.Equal(t, nil, msw.WriteMessage(2, 1<<40, []byte("")))
+	assert.Equal(t, nil, msw.WriteMessage(3, 5, []byte("bye")))
+	msw.Close()
+
+	msgSet := DecodeMessageSet(buf.Bytes())
+	assert.Equal(t, 3, len(msgSet))
+	assert.Equal(t, int32(1), msgSet[0].Partition)
+	assert.Equal(t, int64(9087), msgSet[0].Offset)
+	assert.Equal(t, []byte("hello world"), msgSet[0].Value)
+	assert.Equal(t, int64(1<<40), msgSet[1].Offset)
+	assert.Equal(t, 0, len(msgSet[1].Value))
+	assert.Equal(t, []byte("bye"), msgSet[2].Value)
+}
+
+// subBatchServer serves batch Sub of batch messages, flushed after each message.
+// mode is legacy: the per field write path, pooled: messageSetWriter on the ResponseWriter,
+// writev: messageSetWriter writing to the conn.
+func subBatchServer(mode string, batch int, body []byte) (*httptest.Server, *int32) {
+	var (
+		mu       sync.Mutex
+		conns    = make(map[string]net.Conn)
+		newConns int32
+	)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+
+		if mode == "legacy" {
+			metaBuf := make([]byte, 8)
+			for i := 0; i < batch; i++ {
+				writeI32(w, metaBuf, 1)
+				writeI64(w, metaBuf, int64(i))
+				writeI32(w, metaBuf, int32(len(body)))
+				w.Write(body)
+				w.(http.Flusher).Flush()
+			}
+			return
+		}
+
+		var conn net.Conn
+		if mode == "writev" {
+			mu.Lock()
+			conn = conns[r.RemoteAddr]
+			mu.Unlock()
+		}
+		msw := newMessageSetWriter(w, conn)
+		for i := 0; i < batch; i++ {
+			msw.WriteMessage(1, int64(i), body)
+			msw.Flush()
+			w.(http.Flusher).Flush()
+		}
+		msw.Close()
+	}))
+	ts.Config.ConnState = func(c net.Conn, cs http.ConnState) {
+		switch cs {
+		case http.StateNew:
+			atomic.AddInt32(&newConns, 1)
+
+		case http.StateActive:
+			mu.Lock()
+			conns[c.RemoteAddr().String()] = c
+			mu.Unlock()
+		}
+	}
+	ts.Start()
+	return ts, &newConns
+}
+
+func TestMessageSetWriterVectored(t *testing.T) {
+	ts, newConns := subBatchServer("writev", 3, []byte("hello world"))
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(ts.URL)
+		assert.Equal(t, nil, err)
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, nil, err)
+		assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+
+		msgSet := DecodeMessageSet(b)
+		assert.Equal(t, 3, len(msgSet))
+		assert.Equal(t, int64(2), msgSet[2].Offset)
+		assert.Equal(t, []byte("hello world"), msgSet[2].Value)
+	}
+
+	// the conn is kept alive after the chunks written bypassing net/http
+	assert.Equal(t, int32(1), atomic.LoadInt32(newConns))
+}
+
+func benchmarkSubBatch(b *testing.B, mode string, size int) {
+	const batch = 32
+	body := bytes.Repeat([]byte("X"), size)
+	ts, _ := subBatchServer(mode, batch, body)
+	defer ts.Close()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(batch * (size + messageMetaSize)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			b.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if len(data) != batch*(size+messageMetaSize) {
+			b.Fatalf("got %d bytes", len(data))
+		}
+	}
+}
+
+func BenchmarkSubBatchLegacy1K(b *testing.B) { benchmarkSubBatch(b, "legacy", 1<<10) }
+func BenchmarkSubBatchPooled1K(b *testing.B) { benchmarkSubBatch(b, "pooled", 1<<10) }
+func BenchmarkSubBatchWritev1K(b *testing.B) { benchmarkSubBatch(b, "writev", 1<<10) }
+func BenchmarkSubBatchLegacy8K(b *testing.B) { benchmarkSubBatch(b, "legacy", 8<<10) }
+func BenchmarkSubBatchPooled8K(b *testing.B) { benchmarkSubBatch(b, "pooled", 8<<10) }
+func BenchmarkSubBatchWritev8K(b *testing.B) { benchmarkSubBatch(b, "writev", 8<<10) }
@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"path"
+	"time"
+
+	storekfk "github.com/funkygao/gafka/cmd/kateway/store/kafka"
+	"github.com/funkygao/gafka/registry"
+	log "github.com/funkygao/log4go"
+)
+
+// takeoverSubSessions is replaced in tests without zk.
+var takeoverSubSessions = storekfk.TakeoverSubSessions
+
+// watchPartner takes over the Sub sessions of the standby partner once it disappears
+// from the registry, typically crashed or partitioned away from zk.
+func (this *Gateway) watchPartner(partner string) {
+	defer this.wg.Done()
+
+	log.Info("watching standby partner kateway[%s]", partner)
+
+	alive := true // a partner that is already gone on startup is taken over too
+	for {
+		instances, ch, err := registry.Default.WatchInstances()
+		if err != nil {
+			log.Error("partner[%s] watch: %v", partner, err)
+
+			select {
+			case <-this.shutdownCh:
+				return
+			case <-time.After(time.Second * 5):
+			}
+			continue
+		}
+
+		present := false
+		for _, p := range instances {
+			if path.Base(p) == partner {
+				present = true
+				break
+			}
+		}
+
+		if alive && !present {
+			log.Warn("partner kateway[%s] gone, taking over its sub sessions...", partner)
+
+			n, err := takeoverSubSessions(this.zkzone, partner)
+			if err != nil {
+				log.Error("partner[%s] takeover: %v", partner, err)
+			} else {
+				log.Info("partner kateway[%s] taken over, %d partitions moved forward", partner, n)
+			}
+		}
+		alive = present
+
+		select {
+		case <-this.shutdownCh:
+			return
+		case <-ch:
+		}
+	}
+}
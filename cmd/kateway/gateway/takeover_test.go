@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/registry"
+	gzk "github.com/funkygao/gafka/zk"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// fakeRegistry returns the next snapshot on each watch, whose event fires at once.
+type fakeRegistry struct {
+	snapshots chan []string
+}
+
+func (this *fakeRegistry) Register(id string, data []byte)         {}
+func (this *fakeRegistry) Deregister(id string, data []byte) error { return nil }
+func (this *fakeRegistry) Name() string                            { return "fake" }
+
+func (this *fakeRegistry) WatchInstances() ([]string, <-chan zk.Event, error) {
+	instances, ok := <-this.snapshots
+	if !ok {
+		return nil, nil, errors.New("registry closed")
+	}
+
+	ch := make(chan zk.Event, 1)
+	ch <- zk.Event{Type: zk.EventNodeChildrenChanged}
+	return instances, ch, nil
+}
+
+func TestWatchPartner(t *testing.T) {
+	reg := &fakeRegistry{snapshots: make(chan []string)}
+	defaultRegistry, defaultTakeover := registry.Default, takeoverSubSessions
+	defer func() {
+		registry.Default, takeoverSubSessions = defaultRegistry, defaultTakeover
+	}()
+
+	var takenOver []string
+	registry.Default = reg
+	takeoverSubSessions = func(zkzone *gzk.ZkZone, peerId string) (int, error) {
+		takenOver = append(takenOver, peerId)
+		return 1, nil
+	}
+
+	gw := &Gateway{shutdownCh: make(chan struct{})}
+	gw.wg.Add(1)
+	go gw.watchPartner("kw2")
+
+	reg.snapshots <- []string{"/kateway/ids/kw1"} // gone on startup
+	reg.snapshots <- []string{"/kateway/ids/kw1"}
+	reg.snapshots <- []string{"/kateway/ids/kw1", "/kateway/ids/kw2"} // back
+	reg.snapshots <- []string{"/kateway/ids/kw1", "/kateway/ids/kw2"}
+	reg.snapshots <- []string{"/kateway/ids/kw1"} // gone again
+	reg.snapshots <- []string{"/kateway/ids/kw21"}
+	close(reg.snapshots)
+	close(gw.shutdownCh)
+	gw.wg.Wait()
+
+	assert.Equal(t, []string{"kw2", "kw2"}, takenOver)
+}
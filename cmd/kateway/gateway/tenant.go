@@ -0,0 +1,45 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/golib/ratelimiter"
+)
+
+// tenantQuotas is the pub quota pool shared by all apps of a tenant on this kateway.
+type tenantQuotas struct {
+	mu     sync.Mutex
+	quotas map[string]*tenantQuota // tenant name:quota
+}
+
+type tenantQuota struct {
+	limit   int64
+	buckets *ratelimiter.LeakyBuckets
+}
+
+func newTenantQuotas() *tenantQuotas {
+	return &tenantQuotas{quotas: make(map[string]*tenantQuota)}
+}
+
+// allow checks if the tenant has quota left for another Pub.
+func (this *tenantQuotas) allow(t *manager.Tenant) bool {
+	if t == nil || t.PubQpsLimit <= 0 {
+		return true
+	}
+
+	this.mu.Lock()
+	q, present := this.quotas[t.Name]
+	if !present || q.limit != t.PubQpsLimit {
+		// limit changed in manager, reset the pool
+		q = &tenantQuota{
+			limit:   t.PubQpsLimit,
+			buckets: ratelimiter.NewLeakyBuckets(t.PubQpsLimit, time.Minute),
+		}
+		this.quotas[t.Name] = q
+	}
+	this.mu.Unlock()
+
+	return q.buckets.Pour(t.Name, 1)
+}
@@ -0,0 +1,92 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	zipkin "github.com/openzipkin/zipkin-go-opentracing"
+)
+
+// setupTracer installs zipkin as the global opentracing tracer.
+// Spans are propagated across services with B3 http headers.
+func setupTracer(hostPort string) (zipkin.Collector, error) {
+	collector, err := zipkin.NewHTTPCollector(Options.ZipkinCollector)
+	if err != nil {
+		return nil, err
+	}
+
+	tracer, err := zipkin.NewTracer(zipkin.NewRecorder(collector, Options.Debug, hostPort, "kateway"),
+		zipkin.ClientServerSameSpan(true),
+		zipkin.TraceID128Bit(false),
+		zipkin.WithSampler(zipkin.NewBoundarySampler(Options.TraceSampleRate, time.Now().UnixNano())))
+	if err != nil {
+		collector.Close()
+		return nil, err
+	}
+
+	opentracing.SetGlobalTracer(tracer)
+	return collector, nil
+}
+
+func tracingEnabled() bool {
+	return Options.ZipkinCollector != ""
+}
+
+// traceRequest starts a server span of the request, joined to the upstream trace
+// if B3 headers present. The returned request carries the span in its context.
+func traceRequest(r *http.Request) (opentracing.Span, *http.Request) {
+	tracer := opentracing.GlobalTracer()
+	upstream, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+	span := tracer.StartSpan(spanName(r), ext.RPCServerOption(upstream))
+	ext.HTTPMethod.Set(span, r.Method)
+	ext.HTTPUrl.Set(span, r.URL.Path)
+	if appid := r.Header.Get(HttpHeaderAppid); appid != "" {
+		span.SetTag("appid", appid)
+	}
+
+	return span, r.WithContext(opentracing.ContextWithSpan(r.Context(), span))
+}
+
+// traceStore starts a client span of a backend store call as child of the request span.
+func traceStore(r *http.Request, operation, cluster, topic string) opentracing.Span {
+	span, _ := opentracing.StartSpanFromContext(r.Context(), operation)
+	ext.SpanKindRPCClient.Set(span)
+	ext.PeerService.Set(span, "kafka")
+	span.SetTag("cluster", cluster)
+	span.SetTag("topic", topic)
+	return span
+}
+
+type pubFunc func(cluster, topic string, key, msg []byte) (int32, int64, error)
+
+// tracedPub wraps a store pub method with a client span.
+func tracedPub(r *http.Request, operation string, pub pubFunc) pubFunc {
+	return func(cluster, topic string, key, msg []byte) (partition int32, offset int64, err error) {
+		span := traceStore(r, operation, cluster, topic)
+		partition, offset, err = pub(cluster, topic, key, msg)
+		span.SetTag("partition", partition)
+		finishSpan(span, err)
+		return
+	}
+}
+
+func finishSpan(span opentracing.Span, err error) {
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogKV("error", err.Error())
+	}
+	span.Finish()
+}
+
+// spanName is http method with the leading 2 path segments, e,g. 'POST /v1/msgs'.
+// Topic, ver and group are excluded from span name to keep its cardinality low.
+func spanName(r *http.Request) string {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	return r.Method + " /" + strings.Join(parts, "/")
+}
@@ -0,0 +1,19 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestSpanName(t *testing.T) {
+	r, _ := http.NewRequest("POST", "http://localhost:9191/v1/msgs/foobar/v1", nil)
+	assert.Equal(t, "POST /v1/msgs", spanName(r))
+
+	r, _ = http.NewRequest("GET", "http://localhost:9192/v1/raw/msgs/app1/foobar/v1", nil)
+	assert.Equal(t, "GET /v1/raw", spanName(r))
+
+	r, _ = http.NewRequest("GET", "http://localhost:9193/alive", nil)
+	assert.Equal(t, "GET /alive", spanName(r))
+}
@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/cmd/kateway/transform"
+	"github.com/funkygao/go-metrics"
+)
+
+// transformPipeline applies the transforms of a topic to messages on Pub or Sub.
+type transformPipeline struct {
+	mu           sync.RWMutex
+	transformers map[manager.TransformRule]transform.Transformer // rule:transformer
+	latencies    map[string]metrics.Histogram                    // transform name:latency in us
+	errs         map[string]metrics.Counter                      // transform name:errors
+}
+
+func newTransformPipeline() *transformPipeline {
+	return &transformPipeline{
+		transformers: make(map[manager.TransformRule]transform.Transformer),
+		latencies:    make(map[string]metrics.Histogram),
+		errs:         make(map[string]metrics.Counter),
+	}
+}
+
+// enabled checks if any rule applies.
+func (this *transformPipeline) enabled(rules []manager.TransformRule, onSub bool) bool {
+	if Options.DisableTransform {
+		return false
+	}
+
+	for _, rule := range rules {
+		if rule.OnSub == onSub {
+			return true
+		}
+	}
+	return false
+}
+
+// apply runs the rules in order, msg is never modified in place.
+func (this *transformPipeline) apply(rules []manager.TransformRule, onSub bool, msg []byte) ([]byte, error) {
+	for _, rule := range rules {
+		if rule.OnSub != onSub {
+			continue
+		}
+
+		t, err := this.transformer(rule)
+		if err != nil {
+			return nil, err
+		}
+
+		this.mu.RLock()
+		latency, errs := this.latencies[rule.Name], this.errs[rule.Name]
+		this.mu.RUnlock()
+
+		t0 := time.Now()
+		msg, err = t.Transform(msg)
+		if !Options.DisableMetrics {
+			latency.Update(time.Since(t0).Nanoseconds() / 1e3)
+		}
+		if err != nil {
+			errs.Inc(1)
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
+
+func (this *transformPipeline) transformer(rule manager.TransformRule) (transform.Transformer, error) {
+	this.mu.RLock()
+	t, present := this.transformers[rule]
+	this.mu.RUnlock()
+	if present {
+		return t, nil
+	}
+
+	t, err := transform.New(rule.Name, rule.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	this.mu.Lock()
+	this.transformers[rule] = t
+	if _, present := this.latencies[rule.Name]; !present {
+		this.latencies[rule.Name] = metrics.NewRegisteredHistogram("transform."+rule.Name+".latency",
+			metrics.DefaultRegistry, metrics.NewExpDecaySample(1028, 0.015))
+		this.errs[rule.Name] = metrics.NewRegisteredCounter("transform."+rule.Name+".err", metrics.DefaultRegistry)
+	}
+	this.mu.Unlock()
+	return t, nil
+}
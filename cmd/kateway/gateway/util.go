@@ -34,6 +34,55 @@ func getHttpQueryInt(query *url.Values, key string, defaultVal int) (int, error)
 }
 
 // getHttpRemoteIp returns ip only, without remote port.
+// parseQueueReadAheads parses cluster/topic:size,... into cluster/topic:size.
+func parseQueueReadAheads(s string) (map[string]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	r := make(map[string]int)
+	for _, entry := range strings.Split(s, ",") {
+		i := strings.LastIndex(entry, ":")
+		if i < 0 || strings.Count(entry[:i], "/") != 1 {
+			return nil, fmt.Errorf("invalid queue read ahead: %s", entry)
+		}
+
+		size, err := strconv.Atoi(entry[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid queue read ahead: %s", entry)
+		}
+		r[entry[:i]] = size
+	}
+
+	return r, nil
+}
+
+// parseHhPolicy parses cluster/topic:on|off,... into cluster/topic:enabled, topic can be *.
+func parseHhPolicy(s string) (map[string]bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	r := make(map[string]bool)
+	for _, entry := range strings.Split(s, ",") {
+		i := strings.LastIndex(entry, ":")
+		if i < 0 || strings.Count(entry[:i], "/") != 1 {
+			return nil, fmt.Errorf("invalid hh policy: %s", entry)
+		}
+
+		switch entry[i+1:] {
+		case "on":
+			r[entry[:i]] = true
+		case "off":
+			r[entry[:i]] = false
+		default:
+			return nil, fmt.Errorf("invalid hh policy: %s", entry)
+		}
+	}
+
+	return r, nil
+}
+
 func getHttpRemoteIp(r *http.Request) string {
 	forwardFor := r.Header.Get(HttpHeaderXForwardedFor) // client_ip,proxy_ip,proxy_ip,...
 	if forwardFor == "" {
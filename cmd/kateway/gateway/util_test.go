@@ -54,3 +54,35 @@ func BenchmarkGetHttpRemoteIp(b *testing.B) {
 		getHttpRemoteIp(r)
 	}
 }
+
+func TestParseQueueReadAheads(t *testing.T) {
+	r, err := parseQueueReadAheads("")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(r))
+
+	r, err = parseQueueReadAheads("c1/t1:1048576,c2/t2:0")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1048576, r["c1/t1"])
+	assert.Equal(t, 0, r["c2/t2"])
+
+	_, err = parseQueueReadAheads("c1:1024")
+	assert.NotEqual(t, nil, err)
+	_, err = parseQueueReadAheads("c1/t1:1k")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestParseHhPolicy(t *testing.T) {
+	r, err := parseHhPolicy("")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(r))
+
+	r, err = parseHhPolicy("c1/*:off,c1/t1:on")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, r["c1/*"])
+	assert.Equal(t, true, r["c1/t1"])
+
+	_, err = parseHhPolicy("c1:off")
+	assert.NotEqual(t, nil, err)
+	_, err = parseHhPolicy("c1/t1:no")
+	assert.NotEqual(t, nil, err)
+}
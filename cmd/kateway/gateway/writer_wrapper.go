@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"time"
 )
 
 func gzipWriter(w http.ResponseWriter, r *http.Request) (writer http.ResponseWriter, gz *gzip.Writer) {
@@ -50,6 +51,13 @@ type WriterWrapper interface {
 
 	// BytesWritten returns the total number of bytes sent to the client.
 	BytesWritten() int
+
+	// HeaderWrittenAt returns when the HTTP status was sent, or zero time if not yet.
+	HeaderWrittenAt() time.Time
+
+	// tee copies the response body to buf, for debug tracing.
+	tee(buf *cappedBuffer)
+	teed() *cappedBuffer
 }
 
 func SniffWriter(w http.ResponseWriter) WriterWrapper {
@@ -71,8 +79,10 @@ type basicWriter struct {
 	http.ResponseWriter
 
 	wroteHeader bool
+	wroteAt     time.Time
 	code        int
 	bytes       int
+	teeBuf      *cappedBuffer
 }
 
 func (this *basicWriter) CloseNotify() <-chan bool {
@@ -80,7 +90,15 @@ func (this *basicWriter) CloseNotify() <-chan bool {
 }
 
 func (this *basicWriter) Write(buf []byte) (int, error) {
+	if !this.wroteHeader {
+		// implicit 200 OK
+		this.wroteHeader = true
+		this.wroteAt = time.Now()
+	}
 	this.bytes += len(buf)
+	if this.teeBuf != nil {
+		this.teeBuf.Write(buf)
+	}
 	return this.ResponseWriter.Write(buf)
 }
 
@@ -88,6 +106,7 @@ func (this *basicWriter) WriteHeader(code int) {
 	if !this.wroteHeader {
 		this.code = code
 		this.wroteHeader = true
+		this.wroteAt = time.Now()
 		this.ResponseWriter.WriteHeader(code)
 	}
 }
@@ -103,6 +122,28 @@ func (this *basicWriter) BytesWritten() int {
 	return this.bytes
 }
 
+// wroteDirectly accounts the response body written to the conn bypassing the ResponseWriter.
+func (this *basicWriter) wroteDirectly(n int) {
+	if !this.wroteHeader {
+		// implicit 200 OK
+		this.wroteHeader = true
+		this.wroteAt = time.Now()
+	}
+	this.bytes += n
+}
+
+func (this *basicWriter) HeaderWrittenAt() time.Time {
+	return this.wroteAt
+}
+
+func (this *basicWriter) tee(buf *cappedBuffer) {
+	this.teeBuf = buf
+}
+
+func (this *basicWriter) teed() *cappedBuffer {
+	return this.teeBuf
+}
+
 type flushWriter struct {
 	basicWriter
 }
@@ -0,0 +1,89 @@
+package disk
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// audit events of hinted handoff blocks, for post-incident reconciliation
+// of what was appended to disk and what was delivered to kafka.
+const (
+	auditAppend   = "append"   // block appended to tail segment
+	auditDeliver  = "deliver"  // block delivered to kafka
+	auditDrop     = "drop"     // block discarded because of invalid cluster/topic or ErrDiscard
+	auditRollback = "rollback" // block failed to deliver, will retry later
+	auditSkip     = "skip"     // block failed to deliver and rollback failed, lost
+	auditCorrupt  = "corrupt"  // corrupted segment skipped from the position to its end
+	auditPurge    = "purge"    // delivered segment removed from disk
+	auditDiscard  = "discard"  // undelivered blocks from the position skipped by seeking time
+	auditMigrate  = "migrate"  // segment rewritten in the current format version
+)
+
+// auditEvent is a single audit record.
+//
+// Text format is greppable key=value pairs, e,g.
+// hh event=deliver cluster=me topic=app1.foo.v1 seg=3 pos=1024 size=87 P=2 O=13487
+type auditEvent struct {
+	Event     string `json:"event"`
+	Cluster   string `json:"cluster"`
+	Topic     string `json:"topic"`
+	Segment   uint64 `json:"seg"`
+	Position  int64  `json:"pos"`            // offset within segment
+	Size      int64  `json:"size,omitempty"` // block size in bytes
+	Partition int32  `json:"partition"`      // kafka partition, -1 if not delivered
+	Offset    int64  `json:"offset"`         // kafka offset, -1 if not delivered
+	Err       string `json:"err,omitempty"`
+}
+
+func (e auditEvent) String() string {
+	s := fmt.Sprintf("hh event=%s cluster=%s topic=%s seg=%d pos=%d size=%d",
+		e.Event, e.Cluster, e.Topic, e.Segment, e.Position, e.Size)
+	if e.Partition >= 0 {
+		s += fmt.Sprintf(" P=%d O=%d", e.Partition, e.Offset)
+	}
+	if e.Err != "" {
+		s += fmt.Sprintf(" err=%q", e.Err)
+	}
+	return s
+}
+
+// audit records an event of the queue if Auditor is set.
+func (q *queue) audit(event string, seg uint64, pos, size int64, partition int32, offset int64, err error) {
+	if Auditor == nil {
+		return
+	}
+
+	e := auditEvent{
+		Event:     event,
+		Cluster:   q.clusterTopic.cluster,
+		Topic:     q.clusterTopic.topic,
+		Segment:   seg,
+		Position:  pos,
+		Size:      size,
+		Partition: partition,
+		Offset:    offset,
+	}
+	if err != nil {
+		e.Err = err.Error()
+	}
+
+	if AuditJSON {
+		b, _ := json.Marshal(e)
+		Auditor.Trace(string(b))
+	} else {
+		Auditor.Trace(e.String())
+	}
+}
+
+// auditBlock records an event of the block just read by cursor.
+func (q *queue) auditBlock(event string, b *block, partition int32, offset int64, err error) {
+	if Auditor == nil {
+		return
+	}
+
+	c := q.cursor
+	c.rwmux.RLock()
+	pos := c.pos
+	c.rwmux.RUnlock()
+	q.audit(event, pos.SegmentID, pos.Offset-b.size(), b.size(), partition, offset, err)
+}
@@ -0,0 +1,20 @@
+package disk
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestAuditEventString(t *testing.T) {
+	e := auditEvent{Event: auditDeliver, Cluster: "me", Topic: "app1.foo.v1", Segment: 3, Position: 1024, Size: 87, Partition: 2, Offset: 13487}
+	assert.Equal(t, "hh event=deliver cluster=me topic=app1.foo.v1 seg=3 pos=1024 size=87 P=2 O=13487", e.String())
+
+	e = auditEvent{Event: auditRollback, Cluster: "me", Topic: "app1.foo.v1", Segment: 3, Position: 1024, Size: 87, Partition: -1, Offset: -1,
+		Err: "kafka: broker not available"}
+	assert.Equal(t, `hh event=rollback cluster=me topic=app1.foo.v1 seg=3 pos=1024 size=87 err="kafka: broker not available"`, e.String())
+
+	b, _ := json.Marshal(e)
+	assert.Equal(t, `{"event":"rollback","cluster":"me","topic":"app1.foo.v1","seg":3,"pos":1024,"size":87,"partition":-1,"offset":-1,"err":"kafka: broker not available"}`, string(b))
+}
@@ -0,0 +1,171 @@
+// +build linux,hhbatch
+
+package disk
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	batchWriteSupported = true
+
+	maxIovecs = 1024 // IOV_MAX of linux
+)
+
+// batchWriter is the experimental asynchronous write path of segment appends.
+//
+// Blocks are submitted without syscall and a background goroutine writes all the pending
+// blocks by a single writev syscall, so that the blocks appended while the last writev is
+// in progress are committed as a group.
+type batchWriter struct {
+	fd int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*bytes.Buffer
+	free    []*bytes.Buffer // the last written batch, reused as pending
+	writing bool
+	closed  bool
+	err     error // sticky write error
+
+	vec [][]byte // reused by loop
+}
+
+func newBatchWriter(f *os.File) (*batchWriter, error) {
+	w := &batchWriter{fd: int(f.Fd())}
+	w.cond = sync.NewCond(&w.mu)
+	go w.loop()
+	return w, nil
+}
+
+// submit queues an encoded block for write, buf is released by blockBufPut after written
+// and must not be used afterwards. On error, buf is not taken.
+func (w *batchWriter) submit(buf *bytes.Buffer) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	if w.closed {
+		return ErrSegmentNotOpen
+	}
+
+	w.pending = append(w.pending, buf)
+	w.cond.Broadcast()
+	return nil
+}
+
+func (w *batchWriter) loop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for {
+		for len(w.pending) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if len(w.pending) == 0 {
+			// closed and drained
+			return
+		}
+
+		batch := w.pending
+		w.pending, w.free = w.free, nil
+		w.writing = true
+		w.mu.Unlock()
+
+		w.vec = w.vec[:0]
+		for _, buf := range batch {
+			w.vec = append(w.vec, buf.Bytes())
+		}
+		err := writev(w.fd, w.vec)
+		for i, buf := range batch {
+			blockBufPut(buf)
+			batch[i] = nil
+		}
+		for i := range w.vec {
+			w.vec[i] = nil
+		}
+
+		w.mu.Lock()
+		w.free = batch[:0]
+		w.writing = false
+		if err != nil && w.err == nil {
+			w.err = err
+		}
+		w.cond.Broadcast()
+	}
+}
+
+// drain waits till all the submitted blocks are written to the file.
+func (w *batchWriter) drain() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for len(w.pending) > 0 || w.writing {
+		w.cond.Wait()
+	}
+	return w.err
+}
+
+func (w *batchWriter) close() error {
+	err := w.drain()
+
+	w.mu.Lock()
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+
+	return err
+}
+
+// writev writes all bufs to fd, the file is opened with O_APPEND.
+func writev(fd int, bufs [][]byte) error {
+	iovs := make([]syscall.Iovec, 0, maxIovecs)
+	for len(bufs) > 0 {
+		iovs = iovs[:0]
+		for _, b := range bufs {
+			if len(iovs) == maxIovecs {
+				break
+			}
+			if len(b) == 0 {
+				continue
+			}
+
+			iov := syscall.Iovec{Base: &b[0]}
+			iov.SetLen(len(b))
+			iovs = append(iovs, iov)
+		}
+		if len(iovs) == 0 {
+			return nil
+		}
+
+		n, _, errno := syscall.Syscall(syscall.SYS_WRITEV, uintptr(fd),
+			uintptr(unsafe.Pointer(&iovs[0])), uintptr(len(iovs)))
+		if errno == syscall.EINTR {
+			continue
+		} else if errno != 0 {
+			return errno
+		}
+
+		bufs = advanceBufs(bufs, int(n))
+	}
+
+	return nil
+}
+
+// advanceBufs drops the written n bytes from the head of bufs.
+func advanceBufs(bufs [][]byte, n int) [][]byte {
+	for len(bufs) > 0 && n >= len(bufs[0]) {
+		n -= len(bufs[0])
+		bufs = bufs[1:]
+	}
+	if len(bufs) > 0 {
+		bufs[0] = bufs[0][n:]
+	}
+	return bufs
+}
@@ -0,0 +1,29 @@
+// +build !linux !hhbatch
+
+package disk
+
+import (
+	"bytes"
+	"os"
+)
+
+const batchWriteSupported = false
+
+// batchWriter is only available on linux built with tag hhbatch.
+type batchWriter struct{}
+
+func newBatchWriter(f *os.File) (*batchWriter, error) {
+	return nil, ErrBatchWriteNotBuilt
+}
+
+func (w *batchWriter) submit(buf *bytes.Buffer) error {
+	return ErrBatchWriteNotBuilt
+}
+
+func (w *batchWriter) drain() error {
+	return nil
+}
+
+func (w *batchWriter) close() error {
+	return nil
+}
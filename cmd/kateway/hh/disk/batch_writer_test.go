@@ -0,0 +1,76 @@
+// +build linux,hhbatch
+
+package disk
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestAdvanceBufs(t *testing.T) {
+	bufs := advanceBufs([][]byte{[]byte("abc"), []byte("de")}, 4)
+	assert.Equal(t, 1, len(bufs))
+	assert.Equal(t, "e", string(bufs[0]))
+	assert.Equal(t, 0, len(advanceBufs([][]byte{[]byte("abc")}, 3)))
+}
+
+func TestSegmentBatchWrite(t *testing.T) {
+	BatchWrite = true
+	defer func() { BatchWrite = false }()
+
+	path := fmt.Sprintf("%s/segment.hhbatch", os.TempDir())
+	defer os.Remove(path)
+
+	s, err := newSegment(1, path, 2<<20, 0, 0)
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, nil, s.bw)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Append(&block{
+					key:   []byte(fmt.Sprintf("%d", i)),
+					value: []byte(fmt.Sprintf("%d-%d", i, j)),
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, nil, s.sync())
+
+	s.Seek(0)
+	seen := make(map[string]int)
+	for n := 0; n < 1000; n++ {
+		b := new(block)
+		assert.Equal(t, nil, s.ReadOne(b))
+		seen[string(b.key)]++
+	}
+	assert.Equal(t, 10, len(seen))
+	assert.Equal(t, 100, seen["5"])
+	assert.Equal(t, nil, s.Close())
+}
+
+func TestSegmentCloseAfterBatchWriteError(t *testing.T) {
+	BatchWrite = true
+	defer func() { BatchWrite = false }()
+
+	path := fmt.Sprintf("%s/segment.hhbatch.err", os.TempDir())
+	defer os.Remove(path)
+
+	s, err := newSegment(1, path, 2<<20, 0, 0)
+	assert.Equal(t, nil, err)
+
+	// the next writev fails on the bad fd
+	s.bw.fd = -1
+	s.Append(&block{key: []byte("k"), value: []byte("v")})
+	assert.NotEqual(t, nil, s.Close())
+	assert.Equal(t, (*bufferWriter)(nil), s.wfile)
+	assert.Equal(t, (*bufferReader)(nil), s.rfile)
+}
@@ -16,12 +16,11 @@ func init() {
 }
 
 func BenchmarkHintedHandoffAppendWithBufio(b *testing.B) {
-	DisableBufio = false
-
 	valLen := 1 << 10
 	val := []byte(strings.Repeat("X", valLen))
 	cfg := DefaultConfig()
 	cfg.Dirs = []string{"hh"}
+	cfg.WriteBuffer = 4 << 10
 	s := New(cfg)
 	s.Start()
 	defer s.Stop()
@@ -37,8 +36,6 @@ func BenchmarkHintedHandoffAppendWithBufio(b *testing.B) {
 }
 
 func BenchmarkHintedHandoffAppendWithoutBufio(b *testing.B) {
-	DisableBufio = true
-
 	valLen := 1 << 10
 	val := []byte(strings.Repeat("X", valLen))
 	cfg := DefaultConfig()
@@ -58,13 +55,13 @@ func BenchmarkHintedHandoffAppendWithoutBufio(b *testing.B) {
 }
 
 func BenchmarkHintedHandoffAppendWithBufioAndFlushEvery1K(b *testing.B) {
-	DisableBufio = false
 	flushEveryBlocks = 1000
 
 	valLen := 1 << 10
 	val := []byte(strings.Repeat("X", valLen))
 	cfg := DefaultConfig()
 	cfg.Dirs = []string{"hh"}
+	cfg.WriteBuffer = 4 << 10
 	s := New(cfg)
 	s.Start()
 	defer s.Stop()
@@ -78,3 +75,39 @@ func BenchmarkHintedHandoffAppendWithBufioAndFlushEvery1K(b *testing.B) {
 
 	b.SetBytes(int64(valLen))
 }
+
+// drain a segment of 1KB blocks as the pump does
+func benchmarkSegmentReadAhead(b *testing.B, readAhead int) {
+	path := "segment.bench"
+	defer os.Remove(path)
+
+	s, err := newSegment(1, path, 1<<40, readAhead, 1<<20)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Close()
+
+	blk := &block{key: []byte("key"), value: []byte(strings.Repeat("X", 1<<10))}
+	for i := 0; i < b.N; i++ {
+		if err = s.Append(blk); err != nil {
+			b.Fatal(err)
+		}
+	}
+	s.sync()
+	s.Seek(0)
+
+	b.SetBytes(blk.size())
+	b.ResetTimer()
+	var r block
+	for i := 0; i < b.N; i++ {
+		if err = s.ReadOne(&r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSegmentReadAhead0(b *testing.B)    { benchmarkSegmentReadAhead(b, 0) }
+func BenchmarkSegmentReadAhead4K(b *testing.B)   { benchmarkSegmentReadAhead(b, 4<<10) }
+func BenchmarkSegmentReadAhead64K(b *testing.B)  { benchmarkSegmentReadAhead(b, 64<<10) }
+func BenchmarkSegmentReadAhead256K(b *testing.B) { benchmarkSegmentReadAhead(b, 256<<10) }
+func BenchmarkSegmentReadAhead1M(b *testing.B)   { benchmarkSegmentReadAhead(b, 1<<20) }
@@ -3,19 +3,54 @@ package disk
 import (
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 )
 
 type block struct {
-	magic [2]byte // TODO [0]magic [1]attr
+	magic [2]byte // [0]format version [1]attr
+	keyId uint32  // encryption key id, only present on disk if encrypted
 	key   []byte
 	value []byte
 
 	rbuf, wbuf [4]byte
 }
 
+// footerSize is the size of a segment footer block: 8 bytes block count as value.
+const footerSize = 18
+
+// newFooterBlock creates a segment footer block that records the number of data blocks.
+func newFooterBlock(blocks int64) *block {
+	b := &block{magic: footerMagic, value: make([]byte, 8)}
+	binary.BigEndian.PutUint64(b.value, uint64(blocks))
+	return b
+}
+
+func (b *block) isFooter() bool {
+	return b.magic == footerMagic
+}
+
+func (b *block) isEncrypted() bool {
+	return b.magic[1] == encryptedMagic[1]
+}
+
+func (b *block) hasChecksum() bool {
+	return formats[b.magic[0]].checksum
+}
+
+func (b *block) checksum() uint32 {
+	return crc32.Update(crc32.ChecksumIEEE(b.key), crc32.IEEETable, b.value)
+}
+
 func (b *block) size() int64 {
-	return int64(len(b.key) + len(b.value) + 10)
+	n := int64(len(b.key) + len(b.value) + 10)
+	if b.isEncrypted() {
+		n += 4
+	}
+	if b.hasChecksum() {
+		n += 4
+	}
+	return n
 }
 
 func (b *block) keyLen() uint32 {
@@ -31,6 +66,12 @@ func (b *block) writeTo(w io.Writer) (err error) {
 		return
 	}
 
+	if b.isEncrypted() {
+		if err = b.writeUint32(w, b.keyId); err != nil {
+			return
+		}
+	}
+
 	if err = b.writeUint32(w, b.keyLen()); err != nil {
 		return
 	}
@@ -48,6 +89,10 @@ func (b *block) writeTo(w io.Writer) (err error) {
 		return
 	}
 
+	if b.hasChecksum() {
+		err = b.writeUint32(w, b.checksum())
+	}
+
 	return
 }
 
@@ -55,10 +100,18 @@ func (b *block) readFrom(r io.Reader, buf []byte) error {
 	if err := readBytes(r, b.rbuf[:2]); err != nil {
 		return err
 	}
-	for i := 0; i < len(currentMagic); i++ {
-		if b.rbuf[i] != currentMagic[i] {
-			return ErrSegmentCorrupt
+	b.magic[0], b.magic[1] = b.rbuf[0], b.rbuf[1]
+	if err := validateFormat(b.magic); err != nil {
+		return err
+	}
+
+	b.keyId = 0
+	if b.isEncrypted() {
+		keyId, err := b.readUint32(r)
+		if err != nil {
+			return err
 		}
+		b.keyId = keyId
 	}
 
 	keyLen, err := b.readUint32(r)
@@ -82,6 +135,9 @@ func (b *block) readFrom(r io.Reader, buf []byte) error {
 			b.key = b.key[:int(keyLen)]
 		}
 		copy(b.key, buf[:int(keyLen)])
+	} else {
+		// the key of last read block is reused otherwise
+		b.key = b.key[:0]
 	}
 
 	valueLen, err := b.readUint32(r)
@@ -105,6 +161,16 @@ func (b *block) readFrom(r io.Reader, buf []byte) error {
 	}
 	copy(b.value, buf[:int(valueLen)])
 
+	if b.hasChecksum() {
+		crc, err := b.readUint32(r)
+		if err != nil {
+			return err
+		}
+		if crc != b.checksum() {
+			return ErrSegmentCorrupt
+		}
+	}
+
 	return nil
 }
 
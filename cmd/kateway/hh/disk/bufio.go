@@ -5,23 +5,33 @@ import (
 	"os"
 )
 
+// bufferReader reads ahead size bytes of the segment file, so that the pump draining
+// a large backlog does a read syscall per size bytes instead of per block.
+// With size 0, each Read hits the file directly.
 type bufferReader struct {
 	f      *os.File
-	reader *bufio.Reader
+	reader *bufio.Reader // nil if no read ahead
+
+	// logical offset of the next byte to read, the file offset runs ahead of it
+	pos int64
 }
 
-func newBufferReader(f *os.File) *bufferReader {
-	return &bufferReader{
-		f:      f,
-		reader: bufio.NewReader(f),
+func newBufferReader(f *os.File, size int) *bufferReader {
+	r := &bufferReader{f: f}
+	if size > 0 {
+		r.reader = bufio.NewReaderSize(f, size)
 	}
+	return r
 }
 
 func (r *bufferReader) Read(b []byte) (n int, err error) {
-	if DisableBufio {
-		return r.f.Read(b)
+	if r.reader == nil {
+		n, err = r.f.Read(b)
+	} else {
+		n, err = r.reader.Read(b)
 	}
-	return r.reader.Read(b)
+	r.pos += int64(n)
+	return
 }
 
 func (r *bufferReader) Close() error {
@@ -29,16 +39,24 @@ func (r *bufferReader) Close() error {
 }
 
 func (r *bufferReader) Seek(offset int64, whence int) (ret int64, err error) {
-	if ret, err = r.f.Seek(offset, whence); err != nil {
-		return
+	if whence == os.SEEK_CUR {
+		if offset == 0 {
+			// tell: the file offset is meaningless with read ahead
+			return r.pos, nil
+		}
+
+		offset, whence = r.pos+offset, os.SEEK_SET
 	}
 
-	if DisableBufio {
+	if ret, err = r.f.Seek(offset, whence); err != nil {
 		return
 	}
 
-	// bufio sync with file
-	r.reader.Reset(r.f)
+	r.pos = ret
+	if r.reader != nil {
+		// discard the read ahead
+		r.reader.Reset(r.f)
+	}
 	return
 }
 
@@ -46,27 +64,29 @@ func (r *bufferReader) Name() string {
 	return r.f.Name()
 }
 
+// bufferWriter buffers size bytes before writing to the segment file, 0 to write through.
 type bufferWriter struct {
 	f      *os.File
-	writer *bufio.Writer
+	writer *bufio.Writer // nil if write through
 }
 
-func newBufferWriter(f *os.File) *bufferWriter {
-	return &bufferWriter{
-		f:      f,
-		writer: bufio.NewWriter(f),
+func newBufferWriter(f *os.File, size int) *bufferWriter {
+	w := &bufferWriter{f: f}
+	if size > 0 {
+		w.writer = bufio.NewWriterSize(f, size)
 	}
+	return w
 }
 
 func (w *bufferWriter) Write(p []byte) (nn int, err error) {
-	if DisableBufio {
+	if w.writer == nil {
 		return w.f.Write(p)
 	}
 	return w.writer.Write(p)
 }
 
 func (w *bufferWriter) Sync() error {
-	if DisableBufio {
+	if w.writer == nil {
 		return w.f.Sync()
 	}
 
@@ -77,7 +97,7 @@ func (w *bufferWriter) Sync() error {
 }
 
 func (w *bufferWriter) Close() error {
-	if !DisableBufio {
+	if w.writer != nil {
 		if err := w.writer.Flush(); err != nil {
 			return err
 		}
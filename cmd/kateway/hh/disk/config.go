@@ -2,6 +2,8 @@ package disk
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -9,13 +11,48 @@ type Config struct {
 	Dirs          []string
 	PurgeInterval time.Duration
 	MaxAge        time.Duration
+
+	// EncryptKeyId is the id of the key to encrypt block value at rest, 0 to disable.
+	// The key is resolved by ctx secret named SecretName(EncryptKeyId).
+	EncryptKeyId uint32
+
+	// ReadAhead is the read buffer size in bytes of the pump, 0 to read block by block.
+	ReadAhead int
+
+	// QueueReadAhead overrides ReadAhead of specific queues, keyed by cluster/topic.
+	QueueReadAhead map[string]int
+
+	// WriteBuffer is the write buffer size in bytes of Append before group commit, 0 to write through.
+	WriteBuffer int
+
+	// Format is the on-disk format version of new blocks, pinned to the old version while
+	// rolling out a new one so that hosts not yet upgraded can read the restored snapshots.
+	Format uint8
+
+	// MigrateOnRead rewrites sealed segments of other format versions as the pump enters them.
+	MigrateOnRead bool
+
+	// Policy enables or disables queues, keyed by cluster/topic or cluster/* for all topics of
+	// the cluster, the former wins. Queues are enabled by default.
+	Policy map[string]bool
 }
 
 func DefaultConfig() *Config {
 	return &Config{
 		PurgeInterval: defaultPurgeInterval,
 		MaxAge:        defaultMaxAge,
+		ReadAhead:     defaultReadAhead,
+		Format:        formatLatest,
+		MigrateOnRead: true,
+	}
+}
+
+func (this *Config) readAheadOf(ct clusterTopic) int {
+	if n, present := this.QueueReadAhead[ct.cluster+"/"+ct.topic]; present {
+		return n
 	}
+
+	return this.ReadAhead
 }
 
 func (this *Config) Validate() error {
@@ -23,5 +60,38 @@ func (this *Config) Validate() error {
 		return errors.New("hh Dirs must be specified")
 	}
 
+	if this.ReadAhead < 0 || this.ReadAhead > maxReadAhead {
+		return fmt.Errorf("hh ReadAhead must be within [0, %d]", maxReadAhead)
+	}
+	for ct, n := range this.QueueReadAhead {
+		if n < 0 || n > maxReadAhead {
+			return fmt.Errorf("hh ReadAhead of %s must be within [0, %d]", ct, maxReadAhead)
+		}
+	}
+	if this.WriteBuffer < 0 || this.WriteBuffer > maxReadAhead {
+		return fmt.Errorf("hh WriteBuffer must be within [0, %d]", maxReadAhead)
+	}
+
+	if err := checkWritableFormat(this.Format); err != nil {
+		return err
+	}
+
+	if BatchWrite && !batchWriteSupported {
+		return ErrBatchWriteNotBuilt
+	}
+
+	for ct := range this.Policy {
+		if strings.Count(ct, "/") != 1 || strings.HasPrefix(ct, "/") || strings.HasSuffix(ct, "/") {
+			return fmt.Errorf("hh Policy of %s must be keyed by cluster/topic or cluster/*", ct)
+		}
+	}
+
+	if this.EncryptKeyId > 0 {
+		// fail fast on bad key
+		if _, err := keys.aead(this.EncryptKeyId); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,101 @@
+package disk
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/funkygao/gafka/ctx"
+)
+
+// SecretName returns the ctx secret name of an encryption key: hex encoded AES-128/192/256 key.
+func SecretName(keyId uint32) string {
+	return fmt.Sprintf("hh.key.%d", keyId)
+}
+
+// keyring caches the AEAD ciphers by key id.
+//
+// Key id is recorded in each encrypted block, so after key rotation blocks encrypted by
+// the old key can still be delivered as long as the old secret is kept.
+type keyring struct {
+	mu    sync.RWMutex
+	aeads map[uint32]cipher.AEAD
+}
+
+var keys = &keyring{aeads: make(map[uint32]cipher.AEAD)}
+
+func (this *keyring) aead(keyId uint32) (cipher.AEAD, error) {
+	this.mu.RLock()
+	c, present := this.aeads[keyId]
+	this.mu.RUnlock()
+	if present {
+		return c, nil
+	}
+
+	secret, err := ctx.Secret(SecretName(keyId))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", SecretName(keyId), err)
+	}
+
+	key, err := hex.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", SecretName(keyId), err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", SecretName(keyId), err)
+	}
+
+	if c, err = cipher.NewGCM(block); err != nil {
+		return nil, err
+	}
+
+	this.mu.Lock()
+	this.aeads[keyId] = c
+	this.mu.Unlock()
+	return c, nil
+}
+
+// encrypt seals the block value in place with AES-GCM: value = nonce + ciphertext.
+// The block key is authenticated but not encrypted.
+func (b *block) encrypt(keyId uint32) error {
+	c, err := keys.aead(keyId)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, c.NonceSize(), c.NonceSize()+len(b.value)+c.Overhead())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	b.value = c.Seal(nonce, nonce, b.value, b.key)
+	b.magic[1] = encryptedMagic[1]
+	b.keyId = keyId
+	return nil
+}
+
+// payload returns the plain value of the block, the block itself is untouched so that
+// its size still matches the on-disk size.
+func (b *block) payload() ([]byte, error) {
+	if !b.isEncrypted() {
+		return b.value, nil
+	}
+
+	c, err := keys.aead(b.keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b.value) < c.NonceSize() {
+		return nil, ErrSegmentCorrupt
+	}
+
+	nonce, sealed := b.value[:c.NonceSize()], b.value[c.NonceSize():]
+	return c.Open(nil, nonce, sealed, b.key)
+}
@@ -0,0 +1,45 @@
+package disk
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestBlockEncryptRoundTrip(t *testing.T) {
+	aesBlock, _ := aes.NewCipher(bytes.Repeat([]byte{7}, 32))
+	c, _ := cipher.NewGCM(aesBlock)
+	keys.aeads[7] = c
+	defer delete(keys.aeads, 7)
+
+	b := &block{magic: currentMagic, key: []byte("order-1"), value: []byte("card=6222020200112233")}
+	assert.Equal(t, nil, b.encrypt(7))
+	assert.Equal(t, true, b.isEncrypted())
+	assert.Equal(t, false, bytes.Contains(b.value, []byte("6222020200112233")))
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, b.writeTo(&buf))
+	assert.Equal(t, int64(buf.Len()), b.size())
+
+	var r block
+	assert.Equal(t, nil, r.readFrom(&buf, make([]byte, maxBlockSize)))
+	assert.Equal(t, uint32(7), r.keyId)
+	assert.Equal(t, b.size(), r.size())
+	v, err := r.payload()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "card=6222020200112233", string(v))
+
+	// key is authenticated
+	r.key = []byte("order-2")
+	_, err = r.payload()
+	assert.NotEqual(t, nil, err)
+
+	// plain block
+	p := &block{magic: currentMagic, value: []byte("hello")}
+	v, err = p.payload()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "hello", string(v))
+}
@@ -138,3 +138,25 @@ func (c *cursor) advanceSegment() (ok bool) {
 	// tail reached
 	return false
 }
+
+// seek moves the cursor to pos and marks it committed, the blocks in between are never delivered.
+func (c *cursor) seek(pos position) error {
+	c.rwmux.Lock()
+	defer c.rwmux.Unlock()
+
+	for _, seg := range c.ctx.segments {
+		if seg.id == pos.SegmentID {
+			if err := seg.Seek(pos.Offset); err != nil {
+				return err
+			}
+
+			c.seg = seg
+			c.pos = pos
+			c.permPos = pos
+			c.dirty = true
+			return nil
+		}
+	}
+
+	return ErrCursorNotFound
+}
@@ -1,6 +1,7 @@
 package disk
 
 import (
+	"io"
 	"io/ioutil"
 	"math"
 	"os"
@@ -26,17 +27,22 @@ type Service struct {
 	//     ├── topic1
 	//     └── topic2
 	//         ├── 00000000000000000001
+	//         ├── 00000000000000000001.idx
 	//         ├── 00000000000000000002
 	//         ├── 00000000000000000003
 	//         └── cursor.dmp
 	queues map[clusterTopic]*queue
+
+	policy *policy
 }
 
 func New(cfg *Config) hh.Service {
 	timer = timewheel.NewTimeWheel(time.Second, 120)
+	writeFormat = cfg.Format
 	return &Service{
 		cfg:    cfg,
 		queues: make(map[clusterTopic]*queue),
+		policy: newPolicy(cfg.Policy),
 		closed: true,
 	}
 }
@@ -122,7 +128,16 @@ func (this *Service) Append(cluster, topic string, key, value []byte) error {
 		return ErrNotOpen
 	}
 
-	b := &block{magic: currentMagic, key: key, value: value}
+	if !this.policy.enabled(cluster, topic) {
+		return ErrDisabled
+	}
+
+	b := &block{magic: newMagic(), key: key, value: value}
+	if this.cfg.EncryptKeyId > 0 {
+		if err := b.encrypt(this.cfg.EncryptKeyId); err != nil {
+			return err
+		}
+	}
 	ct := clusterTopic{cluster: cluster, topic: topic}
 
 	log.Debug("hh[%s] append %s/%s", this.Name(), cluster, topic)
@@ -239,7 +254,7 @@ func (this *Service) createAndOpenQueue(baseDir string, ct clusterTopic, start b
 		return err
 	}
 
-	this.queues[ct] = newQueue(baseDir, ct, defaultMaxQueueSize, this.cfg.PurgeInterval, this.cfg.MaxAge)
+	this.queues[ct] = this.newQueue(baseDir, ct)
 	if err := this.queues[ct].Open(); err != nil {
 		return err
 	}
@@ -250,6 +265,14 @@ func (this *Service) createAndOpenQueue(baseDir string, ct clusterTopic, start b
 	return nil
 }
 
+func (this *Service) newQueue(baseDir string, ct clusterTopic) *queue {
+	q := newQueue(baseDir, ct, defaultMaxQueueSize, this.cfg.PurgeInterval, this.cfg.MaxAge)
+	q.readAhead = this.cfg.readAheadOf(ct)
+	q.writeBuffer = this.cfg.WriteBuffer
+	q.migrateOnRead = this.cfg.MigrateOnRead
+	return q
+}
+
 // nextDir choose the next directory in which to create a queue.
 // Currently this is done by calculating the number of clusters in
 // each directory and then choosing the dir with fewest clusters.
@@ -281,3 +304,47 @@ func (this *Service) nextBaseDir() string {
 
 	return dirChosen
 }
+
+// Snapshot writes a portable archive of the cluster/topic queue for debugging and migration.
+func (this *Service) Snapshot(cluster, topic string, w io.Writer) error {
+	if this.closed {
+		return ErrNotOpen
+	}
+
+	this.rwmux.RLock()
+	q, present := this.queues[clusterTopic{cluster: cluster, topic: topic}]
+	this.rwmux.RUnlock()
+	if !present {
+		return ErrQueueNotFound
+	}
+
+	return q.Snapshot(w)
+}
+
+// Restore creates the cluster/topic queue from a Snapshot archive and starts flushing it.
+func (this *Service) Restore(cluster, topic string, r io.Reader) error {
+	if this.closed {
+		return ErrNotOpen
+	}
+
+	this.rwmux.Lock()
+	defer this.rwmux.Unlock()
+
+	ct := clusterTopic{cluster: cluster, topic: topic}
+	if _, present := this.queues[ct]; present {
+		return ErrQueueExists
+	}
+
+	baseDir := this.nextBaseDir()
+	if err := os.MkdirAll(ct.ClusterDir(baseDir), 0700); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	q := this.newQueue(baseDir, ct)
+	if err := q.RestoreSnapshot(r); err != nil {
+		return err
+	}
+
+	log.Info("hh[%s] %s/%s restored from snapshot", this.Name(), cluster, topic)
+	return this.createAndOpenQueue(baseDir, ct, true)
+}
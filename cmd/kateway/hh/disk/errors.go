@@ -9,6 +9,9 @@ var (
 	ErrQueueNotOpen     = fmt.Errorf("queue not open")
 	ErrQueueOpen        = fmt.Errorf("queue is open")
 	ErrQueueFull        = fmt.Errorf("queue is full")
+	ErrQueueNotEmpty    = fmt.Errorf("queue is not empty")
+	ErrQueueNotFound    = fmt.Errorf("queue not found")
+	ErrQueueExists      = fmt.Errorf("queue already exists")
 	ErrSegmentNotOpen   = fmt.Errorf("segment not open")
 	ErrSegmentCorrupt   = fmt.Errorf("segment file corrupted")
 	ErrSegmentFull      = fmt.Errorf("segment is full")
@@ -16,4 +19,10 @@ var (
 	ErrCursorNotFound   = fmt.Errorf("cursor not found")
 	ErrCursorOutOfRange = fmt.Errorf("cursor out of range")
 	ErrHeadIsTail       = fmt.Errorf("head is tail")
+	ErrDiscard          = fmt.Errorf("discard without retry")
+	ErrDisabled         = fmt.Errorf("hinted handoff disabled by policy")
+
+	ErrFormatUnsupported = fmt.Errorf("segment format unsupported, upgrade required")
+
+	ErrBatchWriteNotBuilt = fmt.Errorf("batch write requires linux and build tag hhbatch")
 )
@@ -16,6 +16,7 @@ func (q *queue) FlushInflights(errCh chan<- error, wg *sync.WaitGroup) {
 
 	var (
 		b         block
+		value     []byte
 		err       error
 		partition int32
 		offset    int64
@@ -28,11 +29,11 @@ func (q *queue) FlushInflights(errCh chan<- error, wg *sync.WaitGroup) {
 		switch err {
 		case nil:
 			for retries := 0; retries < flusherMaxRetries; retries++ {
-				partition, offset, err = store.DefaultPubStore.SyncPub(q.clusterTopic.cluster, q.clusterTopic.topic, b.key, b.value)
+				if value, err = b.payload(); err == nil {
+					partition, offset, err = store.DefaultPubStore.SyncPub(q.clusterTopic.cluster, q.clusterTopic.topic, b.key, value)
+				}
 				if err == nil {
-					if Auditor != nil {
-						Auditor.Trace("queue[%s] {P:%d O:%d}", q.ident(), partition, offset)
-					}
+					q.auditBlock(auditDeliver, &b, partition, offset, nil)
 
 					q.cursor.commitPosition()
 					okN++
@@ -44,6 +45,7 @@ func (q *queue) FlushInflights(errCh chan<- error, wg *sync.WaitGroup) {
 					}
 					break
 				} else if err == store.ErrInvalidTopic || err == store.ErrInvalidCluster {
+					q.auditBlock(auditDrop, &b, -1, -1, err)
 					q.cursor.commitPosition()
 					q.inflights.Add(-1)
 					log.Warn("queue[%s] {k:%s v:%s}: %s", q.ident(), string(b.key), string(b.value), err)
@@ -67,9 +69,11 @@ func (q *queue) FlushInflights(errCh chan<- error, wg *sync.WaitGroup) {
 
 			errCh <- err
 
+			q.auditBlock(auditRollback, &b, -1, -1, err)
 			if err = q.Rollback(&b); err != nil {
 				// should never happen
 				log.Error("queue[%s] {k:%s v:%s}: %s", q.ident(), string(b.key), string(b.value), err)
+				q.auditBlock(auditSkip, &b, -1, -1, err)
 				errCh <- err
 			}
 			return
@@ -0,0 +1,72 @@
+package disk
+
+import (
+	"fmt"
+)
+
+// On-disk block format versions, the 1st magic byte of each block, the 2nd is attr.
+//
+// Each block carries its own version, so a segment may mix versions, e,g. the tail segment
+// appended before and after an upgrade. Segment footers are always v0 so that they can be
+// located by fixed size.
+const (
+	formatV0 byte = 0 // [magic][key id if encrypted][key len][key][value len][value]
+	formatV1 byte = 1 // v0 + 4 bytes crc32(IEEE) of key and value
+
+	formatLatest = formatV1
+
+	// versions above this are never written by any build, treated as garbage instead of
+	// a newer format.
+	formatReserved byte = 15
+)
+
+// formatSpec describes what a format version has on top of v0.
+type formatSpec struct {
+	checksum bool
+	attrs    []byte // valid magic attrs
+}
+
+// formats is the compatibility matrix of the versions this build reads and writes.
+//
+// Blocks of a version newer than this build fail with ErrFormatUnsupported instead of being
+// skipped as corruption, and the queue stops delivering until upgraded. To roll out a new
+// version, upgrade all hosts with the version readable but Config.Format pinned to the old one,
+// then unpin; segments of the old version are migrated lazily by the pump, see migrateSegment.
+var formats = map[byte]formatSpec{
+	formatV0: {attrs: []byte{currentMagic[1], footerMagic[1], encryptedMagic[1]}},
+	formatV1: {checksum: true, attrs: []byte{currentMagic[1], encryptedMagic[1]}},
+}
+
+// writeFormat is the version of newly written blocks.
+var writeFormat = formatLatest
+
+// validateFormat checks the magic of a block just read.
+func validateFormat(magic [2]byte) error {
+	spec, present := formats[magic[0]]
+	if !present {
+		if magic[0] <= formatReserved {
+			return ErrFormatUnsupported
+		}
+		return ErrSegmentCorrupt
+	}
+
+	for _, attr := range spec.attrs {
+		if attr == magic[1] {
+			return nil
+		}
+	}
+	return ErrSegmentCorrupt
+}
+
+// checkWritableFormat validates the configured format version.
+func checkWritableFormat(v byte) error {
+	if _, present := formats[v]; !present {
+		return fmt.Errorf("hh Format %d unsupported, latest %d", v, formatLatest)
+	}
+	return nil
+}
+
+// newMagic returns the magic of a data block in the write format.
+func newMagic() [2]byte {
+	return [2]byte{writeFormat, currentMagic[1]}
+}
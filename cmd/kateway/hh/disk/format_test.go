@@ -0,0 +1,89 @@
+package disk
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestValidateFormat(t *testing.T) {
+	assert.Equal(t, nil, validateFormat(currentMagic))
+	assert.Equal(t, nil, validateFormat(footerMagic))
+	assert.Equal(t, nil, validateFormat([2]byte{formatV1, encryptedMagic[1]}))
+	assert.Equal(t, ErrSegmentCorrupt, validateFormat([2]byte{formatV1, footerMagic[1]}))
+	assert.Equal(t, ErrFormatUnsupported, validateFormat([2]byte{formatLatest + 1, 0}))
+	assert.Equal(t, ErrSegmentCorrupt, validateFormat([2]byte{0xff, 0}))
+}
+
+func TestBlockChecksum(t *testing.T) {
+	b := &block{magic: [2]byte{formatV1, 0}, key: []byte("k1"), value: []byte("hello")}
+	var w bytes.Buffer
+	assert.Equal(t, nil, b.writeTo(&w))
+	assert.Equal(t, b.size(), int64(w.Len()))
+
+	var r block
+	buf := make([]byte, maxBlockSize)
+	assert.Equal(t, nil, r.readFrom(bytes.NewReader(w.Bytes()), buf))
+	assert.Equal(t, "hello", string(r.value))
+
+	corrupted := w.Bytes()
+	corrupted[len(corrupted)-5] ^= 0xff // last byte of value
+	assert.Equal(t, ErrSegmentCorrupt, r.readFrom(bytes.NewReader(corrupted), buf))
+}
+
+func TestQueueMigrateOnRead(t *testing.T) {
+	os.RemoveAll("hh")
+	defer os.RemoveAll("hh")
+	defer func() { writeFormat = formatLatest }()
+
+	// 3 segments of v0
+	writeFormat = formatV0
+	ct := clusterTopic{cluster: "me", topic: "foobar"}
+	q := newQueue("hh", ct, 0, time.Second, time.Hour)
+	q.maxSegmentSize = 50
+	assert.Equal(t, nil, q.Open())
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, nil, q.Append(&block{magic: newMagic(), key: []byte(fmt.Sprintf("key%d", i)), value: []byte(fmt.Sprintf("value%d", i))}))
+	}
+	assert.Equal(t, nil, q.Close())
+
+	writeFormat = formatV1
+	q = newQueue("hh", ct, 0, time.Second, time.Hour)
+	q.maxSegmentSize = 50
+	q.migrateOnRead = true
+	assert.Equal(t, nil, q.Open())
+	assert.Equal(t, 3, len(q.segments))
+
+	var b block
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, nil, q.Next(&b))
+		assert.Equal(t, fmt.Sprintf("key%d", i), string(b.key))
+		q.cursor.commitPosition()
+	}
+	assert.Equal(t, ErrEOQ, q.Next(&b))
+
+	// the head is read before migration, the tail is still appended
+	v, _, _ := firstBlockFormat(q.segments[0].wfile.Name())
+	assert.Equal(t, formatV0, v)
+	v, _, _ = firstBlockFormat(q.segments[1].wfile.Name())
+	assert.Equal(t, formatV1, v)
+	v, _, _ = firstBlockFormat(q.segments[2].wfile.Name())
+	assert.Equal(t, formatV0, v)
+
+	n, found := q.segments[1].footerBlocks()
+	assert.Equal(t, true, found)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, int64(0), q.index.entriesOf(q.segments[1].id)[0].offset)
+	assert.Equal(t, nil, q.Close())
+
+	// migrated segment survives restart
+	q = newQueue("hh", ct, 0, time.Second, time.Hour)
+	q.maxSegmentSize = 50
+	assert.Equal(t, nil, q.Open())
+	assert.Equal(t, int64(0), q.Inflights())
+	assert.Equal(t, nil, q.Close())
+}
@@ -22,13 +22,23 @@ const (
 	flusherMaxRetries    = 3
 	pollSleep            = time.Second
 	dumpPerBlocks        = 100
+
+	// BenchmarkSegmentReadAhead* of 1KB blocks: 0 350MB/s, 4KB 1.2GB/s, 256KB 1.5GB/s, 1MB 1.2GB/s
+	defaultReadAhead = 256 << 10
+	maxReadAhead     = 16 << 20
 )
 
 var (
-	DisableBufio = true
-	Auditor      *log.Logger
+	Auditor   *log.Logger
+	AuditJSON = false // audit events in json instead of key=value text
+
+	// BatchWrite enables the experimental batched asynchronous segment append path.
+	BatchWrite = false
 
-	currentMagic = [2]byte{0, 0}
+	// [0] is format version, see format.go
+	currentMagic   = [2]byte{0, 0}
+	footerMagic    = [2]byte{0, 1} // [1] is attr: segment footer
+	encryptedMagic = [2]byte{0, 2} // [1] is attr: AES-GCM encrypted value
 
 	timer *timewheel.TimeWheel
 
@@ -1,10 +1,326 @@
 package disk
 
-// index is a memory only heap struct which is rebuilt on boot.
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	indexFileSuffix = ".idx"
+
+	// unix nano + offset
+	indexEntrySize = 16
+
+	// a 100MB segment has about 1600 entries
+	indexIntervalBytes = 64 << 10
+)
+
+// index is a sparse time/offset index of the segments: the first block of each segment and
+// then a block every indexIntervalBytes are indexed with their append time, so that the
+// position of blocks appended after a given time is found by binary search instead of
+// scanning the segments.
+//
+// Blocks carry no timestamp, the index time is when the block was appended to the queue
+// and it never goes backward within the queue even if the clock does.
+//
+// Each segment index is persisted alongside the segment as <segment>.idx of 16 bytes entries.
+// A segment without index file(legacy or partially restored) is indexed on boot by a single
+// entry at offset 0 with the segment mtime, which errs on the side of treating its blocks newer.
 type index struct {
 	ctx *queue
+
+	mu       sync.RWMutex
+	segments []*segmentIndex // ordered by segment id, each has at least 1 entry
+}
+
+type indexEntry struct {
+	ts     int64 // unix nano of the append
+	offset int64
+}
+
+type segmentIndex struct {
+	id      uint64
+	path    string
+	f       *os.File
+	entries []indexEntry
 }
 
 func newIndex(ctx *queue) *index {
 	return &index{ctx: ctx}
 }
+
+func isIndexFile(name string) bool {
+	return strings.HasSuffix(name, indexFileSuffix)
+}
+
+// load reads the index file of a segment, entries beyond the segment size(not synced before
+// crash) and the partially written trailing entry are truncated.
+// caller is responsible for loading segments in order.
+func (idx *index) load(s *segment) error {
+	path := s.wfile.Name() + indexFileSuffix
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	var (
+		size    = s.DiskUsage()
+		entries = make([]indexEntry, 0, len(buf)/indexEntrySize)
+	)
+	for i := 0; i+indexEntrySize <= len(buf); i += indexEntrySize {
+		e := indexEntry{
+			ts:     int64(binary.BigEndian.Uint64(buf[i:])),
+			offset: int64(binary.BigEndian.Uint64(buf[i+8:])),
+		}
+		if e.offset >= size || (len(entries) > 0 && e.offset <= entries[len(entries)-1].offset) {
+			break
+		}
+		entries = append(entries, e)
+	}
+	if len(entries)*indexEntrySize != len(buf) {
+		log.Warn("queue[%s] segment[%d] index truncated to %d entries", idx.ctx.ident(), s.id, len(entries))
+		if err = f.Truncate(int64(len(entries) * indexEntrySize)); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	si := &segmentIndex{id: s.id, path: path, f: f, entries: entries}
+	if len(entries) == 0 {
+		if size == 0 {
+			// will be indexed on 1st append
+			return f.Close()
+		}
+
+		if err = si.add(indexEntry{ts: s.LastModified().UnixNano(), offset: 0}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	idx.mu.Lock()
+	idx.segments = append(idx.segments, si)
+	idx.mu.Unlock()
+	return nil
+}
+
+// append indexes the block just appended to the segment at offset if it is due.
+func (idx *index) append(s *segment, offset int64, t time.Time) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	ts := t.UnixNano()
+	var si *segmentIndex
+	if n := len(idx.segments); n > 0 {
+		last := idx.segments[n-1]
+		if lastTs := last.entries[len(last.entries)-1].ts; ts < lastTs {
+			ts = lastTs
+		}
+		if last.id == s.id {
+			si = last
+		}
+	}
+
+	if si == nil {
+		path := s.wfile.Name() + indexFileSuffix
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+
+		si = &segmentIndex{id: s.id, path: path, f: f}
+		if err = si.add(indexEntry{ts: ts, offset: offset}); err != nil {
+			f.Close()
+			return err
+		}
+		idx.segments = append(idx.segments, si)
+		return nil
+	}
+
+	if offset-si.entries[len(si.entries)-1].offset < indexIntervalBytes {
+		return nil
+	}
+	return si.add(indexEntry{ts: ts, offset: offset})
+}
+
+// seek returns the last indexed position appended not after t, so that every block
+// appended after t is at or behind the position. If all blocks are appended after t,
+// the position of the 1st indexed block is returned.
+// ok is false if nothing is indexed.
+func (idx *index) seek(t time.Time) (pos position, ok bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if len(idx.segments) == 0 {
+		return
+	}
+
+	ts := t.UnixNano()
+	i := sort.Search(len(idx.segments), func(i int) bool {
+		return idx.segments[i].entries[0].ts > ts
+	})
+	if i == 0 {
+		return position{SegmentID: idx.segments[0].id, Offset: idx.segments[0].entries[0].offset}, true
+	}
+
+	si := idx.segments[i-1]
+	j := sort.Search(len(si.entries), func(j int) bool {
+		return si.entries[j].ts > ts
+	})
+	return position{SegmentID: si.id, Offset: si.entries[j-1].offset}, true
+}
+
+// remove removes the index of a segment from memory and disk.
+func (idx *index) remove(id uint64) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for i, si := range idx.segments {
+		if si.id != id {
+			continue
+		}
+
+		idx.segments = append(idx.segments[:i], idx.segments[i+1:]...)
+		si.f.Close()
+		return os.Remove(si.path)
+	}
+
+	return nil
+}
+
+// entriesOf returns a copy of the index entries of a segment, nil if not indexed.
+func (idx *index) entriesOf(id uint64) []indexEntry {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	for _, si := range idx.segments {
+		if si.id == id {
+			return append([]indexEntry(nil), si.entries...)
+		}
+	}
+
+	return nil
+}
+
+// replace swaps the segment file by swap and then its index by the entries of the new file.
+// The old index file is removed before swap, the segment is left unindexed if swap fails.
+func (idx *index) replace(id uint64, entries []indexEntry, swap func() error) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var (
+		i  int
+		si *segmentIndex
+	)
+	for i = range idx.segments {
+		if idx.segments[i].id == id {
+			si = idx.segments[i]
+			break
+		}
+	}
+	if si == nil {
+		return swap()
+	}
+
+	si.f.Close()
+	if err := os.Remove(si.path); err != nil {
+		return err
+	}
+
+	if err := swap(); err != nil || len(entries) == 0 {
+		idx.segments = append(idx.segments[:i], idx.segments[i+1:]...)
+		return err
+	}
+
+	buf := make([]byte, 0, len(entries)*indexEntrySize)
+	for _, e := range entries {
+		buf = e.appendTo(buf)
+	}
+	tmp := si.path + migratingSuffix
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		idx.segments = append(idx.segments[:i], idx.segments[i+1:]...)
+		return err
+	}
+	if err := os.Rename(tmp, si.path); err != nil {
+		idx.segments = append(idx.segments[:i], idx.segments[i+1:]...)
+		return err
+	}
+
+	f, err := os.OpenFile(si.path, os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		idx.segments = append(idx.segments[:i], idx.segments[i+1:]...)
+		return err
+	}
+
+	si.f = f
+	si.entries = entries
+	return nil
+}
+
+// snapshot returns the encoded index file of a segment, nil if not indexed.
+func (idx *index) snapshot(id uint64) []byte {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	for _, si := range idx.segments {
+		if si.id == id {
+			buf := make([]byte, 0, len(si.entries)*indexEntrySize)
+			for _, e := range si.entries {
+				buf = e.appendTo(buf)
+			}
+			return buf
+		}
+	}
+
+	return nil
+}
+
+func (idx *index) close() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var err error
+	for _, si := range idx.segments {
+		if e := si.f.Close(); e != nil {
+			err = e
+		}
+	}
+	idx.segments = nil
+	return err
+}
+
+// add persists the entry without fsync: index is rebuilt if lost.
+func (si *segmentIndex) add(e indexEntry) error {
+	if _, err := si.f.Write(e.appendTo(nil)); err != nil {
+		return err
+	}
+
+	si.entries = append(si.entries, e)
+	return nil
+}
+
+func (e indexEntry) appendTo(buf []byte) []byte {
+	var b [indexEntrySize]byte
+	binary.BigEndian.PutUint64(b[:], uint64(e.ts))
+	binary.BigEndian.PutUint64(b[8:], uint64(e.offset))
+	return append(buf, b[:]...)
+}
+
+// segmentIdOfIndexFile returns the segment id of an index file name.
+func segmentIdOfIndexFile(name string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimSuffix(name, indexFileSuffix), 10, 64)
+}
@@ -0,0 +1,78 @@
+package disk
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestIndexSeek(t *testing.T) {
+	idx := newIndex(nil)
+	_, ok := idx.seek(time.Now())
+	assert.Equal(t, false, ok)
+
+	idx.segments = []*segmentIndex{
+		{id: 1, entries: []indexEntry{{ts: 10, offset: 0}, {ts: 20, offset: 100}, {ts: 30, offset: 200}}},
+		{id: 2, entries: []indexEntry{{ts: 40, offset: 0}, {ts: 50, offset: 100}}},
+	}
+	for _, c := range []struct {
+		ts  int64
+		pos position
+	}{
+		{5, position{SegmentID: 1, Offset: 0}},
+		{10, position{SegmentID: 1, Offset: 0}},
+		{25, position{SegmentID: 1, Offset: 100}},
+		{30, position{SegmentID: 1, Offset: 200}},
+		{45, position{SegmentID: 2, Offset: 0}},
+		{60, position{SegmentID: 2, Offset: 100}},
+	} {
+		pos, ok := idx.seek(time.Unix(0, c.ts))
+		assert.Equal(t, true, ok)
+		assert.Equal(t, c.pos, pos)
+	}
+}
+
+func TestQueueSeekTime(t *testing.T) {
+	os.RemoveAll("hh")
+	defer os.RemoveAll("hh")
+
+	var b block
+	q := newQueue("hh", clusterTopic{cluster: "me", topic: "foobar"}, 0, time.Second, time.Hour)
+	q.maxSegmentSize = 40 // 2 blocks per segment, each segment 1st block indexed
+	assert.Equal(t, nil, q.Open())
+	for i := 0; i < 5; i++ {
+		b.key = []byte(fmt.Sprintf("key%d", i))
+		b.value = []byte(fmt.Sprintf("value%d", i))
+		assert.Equal(t, nil, q.Append(&b))
+	}
+
+	time.Sleep(time.Millisecond)
+	since := time.Now()
+	time.Sleep(time.Millisecond)
+	for i := 5; i < 10; i++ {
+		b.key = []byte(fmt.Sprintf("key%d", i))
+		b.value = []byte(fmt.Sprintf("value%d", i))
+		assert.Equal(t, nil, q.Append(&b))
+	}
+	assert.Equal(t, nil, q.Close())
+
+	// index survives reopen
+	assert.Equal(t, nil, q.Open())
+	defer q.Close()
+	assert.Equal(t, 5, len(q.index.segments))
+
+	discarded, err := q.SeekTime(since)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, discarded)
+	assert.Equal(t, nil, q.Next(&b))
+	assert.Equal(t, "key4", string(b.key)) // sparse: the older block sharing segment with key5 is kept
+	assert.Equal(t, int64(6), q.Inflights())
+
+	// never move backward
+	discarded, err = q.SeekTime(since.Add(-time.Hour))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, discarded)
+}
@@ -0,0 +1,164 @@
+package disk
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+
+	log "github.com/funkygao/log4go"
+)
+
+// suffix of the files being written by migration, removed on boot if left by crash.
+const migratingSuffix = ".migrating"
+
+func isMigratingFile(name string) bool {
+	return strings.HasSuffix(name, migratingSuffix)
+}
+
+// enterSegment is called once the cursor advanced to the beginning of a segment.
+func (q *queue) enterSegment(s *segment) {
+	if !q.migrateOnRead {
+		return
+	}
+
+	migrated, err := q.migrateSegment(s)
+	if err != nil {
+		// the segment is still readable in its old format
+		log.Warn("queue[%s] segment[%d] migrate: %s", q.ident(), s.id, err)
+	} else if migrated {
+		log.Info("queue[%s] segment[%d] migrated to format v%d", q.ident(), s.id, writeFormat)
+	}
+}
+
+// migrateSegment rewrites a sealed segment in writeFormat if its blocks are of another format,
+// so that old segments are upgraded lazily as the pump reads them instead of draining all the
+// queues before a format change. It must be called before any block of the segment is read.
+//
+// Index entries are remapped to the new offsets and the footer is kept as is.
+// The old index is removed before swapping in the new segment, a crash in between leaves
+// a segment without index, which is indexed on boot as if legacy.
+func (q *queue) migrateSegment(s *segment) (migrated bool, err error) {
+	q.mu.RLock()
+	isTail := s == q.tail
+	q.mu.RUnlock()
+	if isTail {
+		// still being appended
+		return false, nil
+	}
+
+	s.mu.RLock()
+	if s.wfile == nil {
+		s.mu.RUnlock()
+		return false, ErrSegmentNotOpen
+	}
+	path := s.wfile.Name()
+	s.mu.RUnlock()
+
+	// a segment starts with the version of its 1st block, only the tail at upgrade mixes versions
+	v, found, err := firstBlockFormat(path)
+	if err != nil || !found || v == writeFormat {
+		return false, err
+	}
+
+	entries, size, err := rewriteSegment(path, path+migratingSuffix, q.index.entriesOf(s.id))
+	if err != nil {
+		os.Remove(path + migratingSuffix)
+		return false, err
+	}
+
+	err = q.index.replace(s.id, entries, func() error {
+		if err := os.Rename(path+migratingSuffix, path); err != nil {
+			return err
+		}
+
+		return s.reopen(q.readAhead, q.writeBuffer)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	q.audit(auditMigrate, s.id, 0, size, -1, -1, nil)
+	return true, nil
+}
+
+// firstBlockFormat returns the format version of the 1st data block of a segment file.
+func firstBlockFormat(path string) (v byte, found bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var magic [2]byte
+	if _, err = io.ReadFull(f, magic[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		return
+	}
+
+	if magic == footerMagic {
+		// sealed without data block
+		return
+	}
+
+	return magic[0], true, nil
+}
+
+// rewriteSegment copies the segment file to dst with data blocks converted to writeFormat,
+// returns the remapped index entries and the new segment size.
+func rewriteSegment(src, dst string, entries []indexEntry) ([]indexEntry, int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer out.Close()
+
+	var (
+		b              block
+		buf            = make([]byte, maxBlockSize)
+		r              = bufio.NewReaderSize(in, defaultReadAhead)
+		w              = bufio.NewWriterSize(out, defaultReadAhead)
+		oldOff, newOff int64
+		i              int
+	)
+	for {
+		if err = b.readFrom(r, buf); err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			// corrupted or partially written segment is left to the pump
+			return nil, 0, err
+		}
+
+		for ; i < len(entries) && entries[i].offset <= oldOff; i++ {
+			entries[i].offset = newOff
+		}
+
+		oldOff += b.size()
+		if !b.isFooter() {
+			b.magic[0] = writeFormat
+		}
+		if err = b.writeTo(w); err != nil {
+			return nil, 0, err
+		}
+		newOff += b.size()
+	}
+
+	if err = w.Flush(); err != nil {
+		return nil, 0, err
+	}
+	if err = out.Sync(); err != nil {
+		return nil, 0, err
+	}
+
+	return entries[:i], newOff, nil
+}
@@ -0,0 +1,78 @@
+package disk
+
+import (
+	"sync"
+)
+
+const policyAllTopics = "*"
+
+// policy enables or disables hinted handoff of the queues.
+type policy struct {
+	mu    sync.RWMutex
+	rules map[string]bool // cluster/topic or cluster/*: enabled
+}
+
+func newPolicy(rules map[string]bool) *policy {
+	this := &policy{rules: make(map[string]bool, len(rules))}
+	for ct, enabled := range rules {
+		this.rules[ct] = enabled
+	}
+	return this
+}
+
+func (this *policy) enabled(cluster, topic string) bool {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	if enabled, present := this.rules[cluster+"/"+topic]; present {
+		return enabled
+	}
+	if enabled, present := this.rules[cluster+"/"+policyAllTopics]; present {
+		return enabled
+	}
+	return true
+}
+
+func (this *policy) set(cluster, topic string, enabled bool) {
+	this.mu.Lock()
+	this.rules[cluster+"/"+topic] = enabled
+	this.mu.Unlock()
+}
+
+func (this *policy) reset(cluster, topic string) {
+	this.mu.Lock()
+	delete(this.rules, cluster+"/"+topic)
+	this.mu.Unlock()
+}
+
+func (this *policy) dump() map[string]bool {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	r := make(map[string]bool, len(this.rules))
+	for ct, enabled := range this.rules {
+		r[ct] = enabled
+	}
+	return r
+}
+
+// Enabled returns whether Pub of cluster/topic may be appended.
+// The queue of a disabled cluster/topic still flushes its inflights.
+func (this *Service) Enabled(cluster, topic string) bool {
+	return this.policy.enabled(cluster, topic)
+}
+
+// SetPolicy enables or disables cluster/topic, topic * for all topics of the cluster.
+func (this *Service) SetPolicy(cluster, topic string, enabled bool) {
+	this.policy.set(cluster, topic, enabled)
+}
+
+// ResetPolicy removes the policy of cluster/topic.
+func (this *Service) ResetPolicy(cluster, topic string) {
+	this.policy.reset(cluster, topic)
+}
+
+// Policy returns the policies keyed by cluster/topic or cluster/*.
+func (this *Service) Policy() map[string]bool {
+	return this.policy.dump()
+}
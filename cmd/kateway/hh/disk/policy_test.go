@@ -0,0 +1,35 @@
+package disk
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	p := newPolicy(map[string]bool{"c1/*": false, "c1/orders": true, "c2/logs": false})
+	assert.Equal(t, true, p.enabled("c1", "orders"))
+	assert.Equal(t, false, p.enabled("c1", "logs"))
+	assert.Equal(t, false, p.enabled("c2", "logs"))
+	assert.Equal(t, true, p.enabled("c2", "orders"))
+	assert.Equal(t, true, p.enabled("c3", "logs"))
+
+	p.set("c2", "*", false)
+	assert.Equal(t, false, p.enabled("c2", "orders"))
+	p.reset("c1", "orders")
+	assert.Equal(t, false, p.enabled("c1", "orders"))
+	p.reset("c1", "*")
+	assert.Equal(t, true, p.enabled("c1", "orders"))
+
+	assert.Equal(t, 2, len(p.dump()))
+}
+
+func TestConfigValidatePolicy(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Dirs = []string{"hh"}
+	cfg.Policy = map[string]bool{"c1/*": false}
+	assert.Equal(t, nil, cfg.Validate())
+
+	cfg.Policy = map[string]bool{"c1": false}
+	assert.NotEqual(t, nil, cfg.Validate())
+}
@@ -17,6 +17,7 @@ func (q *queue) pump() {
 
 	var (
 		b          block
+		value      []byte
 		err        error
 		partition  int32
 		offset     int64
@@ -39,11 +40,11 @@ func (q *queue) pump() {
 		case nil:
 			for retries = 0; retries < defaultMaxRetries; retries++ {
 				// TODO we might use AsyncPub
-				partition, offset, err = store.DefaultPubStore.SyncPub(q.clusterTopic.cluster, q.clusterTopic.topic, b.key, b.value)
+				if value, err = b.payload(); err == nil {
+					partition, offset, err = q.deliverBlock(b.key, value)
+				}
 				if err == nil {
-					if Auditor != nil {
-						Auditor.Trace("queue[%s] {P:%d O:%d}", q.ident(), partition, offset)
-					}
+					q.auditBlock(auditDeliver, &b, partition, offset, nil)
 
 					q.cursor.commitPosition()
 					okN++
@@ -55,7 +56,8 @@ func (q *queue) pump() {
 						}
 					}
 					break
-				} else if err == store.ErrInvalidTopic || err == store.ErrInvalidCluster {
+				} else if err == store.ErrInvalidTopic || err == store.ErrInvalidCluster || err == ErrDiscard {
+					q.auditBlock(auditDrop, &b, -1, -1, err)
 					q.cursor.commitPosition()
 					failN++
 					q.deliverN.Add(1)
@@ -85,9 +87,11 @@ func (q *queue) pump() {
 			}
 
 			// failed to deliver
+			q.auditBlock(auditRollback, &b, -1, -1, err)
 			if err = q.Rollback(&b); err != nil {
 				// should never happen
 				log.Warn("queue[%s] skipped block <%s/%s>", q.ident(), string(b.key), string(b.value))
+				q.auditBlock(auditSkip, &b, -1, -1, err)
 
 				failN++
 			}
@@ -98,6 +102,16 @@ func (q *queue) pump() {
 		case ErrCursorOutOfRange:
 			log.Error(err.Error()) // TODO
 
+		case ErrFormatUnsupported:
+			// written by a newer build, wait for upgrade instead of skipping it as corruption
+			log.Error("queue[%s] pump: %s +%v", q.ident(), err, q.cursor.pos)
+			select {
+			case <-q.quit:
+				log.Trace("queue[%s] pump done, delivered: %d/%d", q.ident(), okN, failN)
+				return
+			case <-timer.After(maxBackoff):
+			}
+
 		case ErrEOQ:
 			select {
 			case <-q.quit:
@@ -111,3 +125,12 @@ func (q *queue) pump() {
 		}
 	}
 }
+
+// deliverBlock pubs the block to kafka unless the queue has its own deliver func.
+func (q *queue) deliverBlock(key, value []byte) (partition int32, offset int64, err error) {
+	if q.deliver != nil {
+		return -1, -1, q.deliver(key, value)
+	}
+
+	return store.DefaultPubStore.SyncPub(q.clusterTopic.cluster, q.clusterTopic.topic, key, value)
+}
@@ -58,12 +58,24 @@ type queue struct {
 	// -1 means unlimited
 	maxSize int64
 
+	// buffer sizes of segment files, 0 to disable
+	readAhead, writeBuffer int
+
 	inflights         sync2.AtomicInt64
 	appendN, deliverN sync2.AtomicInt64
 
 	purgeInterval time.Duration
 	maxAge        time.Duration
 
+	// deliver overrides Pub to kafka of each block, used by Spool
+	deliver DeliverFunc
+
+	// replayable keeps the delivered segments loaded across restart until maxAge
+	replayable bool
+
+	// migrateOnRead rewrites segments of old format version as the pump enters them
+	migrateOnRead bool
+
 	cursor     *cursor
 	index      *index
 	head, tail *segment
@@ -111,7 +123,7 @@ func (q *queue) Open() error {
 		// cursor file might not exist or json file corrupts
 		log.Warn("queue[%s] cursor: %s, advance to head", q.ident(), err)
 		moveCursorToHead = true
-	} else {
+	} else if !q.replayable {
 		// load segments from cursor checkpoint
 		minId = q.cursor.pos.SegmentID
 	}
@@ -121,6 +133,12 @@ func (q *queue) Open() error {
 		return err
 	}
 	q.segments = segments
+	for _, s := range q.segments {
+		if err = q.index.load(s); err != nil {
+			// index is only an optimization for seeking by time, go ahead
+			log.Warn("queue[%s] segment[%d] index: %s", q.ident(), s.id, err)
+		}
+	}
 
 	if len(q.segments) == 0 {
 		// create the 1st segment
@@ -137,6 +155,8 @@ func (q *queue) Open() error {
 		return err
 	}
 
+	q.inflights.Set(q.loadInflights())
+
 	if q.cursor.seg != q.tail || q.cursor.pos.Offset != q.tail.DiskUsage() {
 		q.emptyInflight.Set(0)
 	}
@@ -171,6 +191,10 @@ func (q *queue) Close() error {
 	q.tail = nil
 	q.segments = nil
 
+	if err := q.index.close(); err != nil {
+		return err
+	}
+
 	log.Trace("queue[%s] dumping cursor", q.ident())
 	if err := q.cursor.dump(); err != nil {
 		return err
@@ -225,6 +249,7 @@ func (q *queue) Purge() error {
 	for {
 		if q.cursor.pos.SegmentID > q.head.id &&
 			q.head.LastModified().Add(q.maxAge).Unix() < time.Now().Unix() {
+			q.audit(auditPurge, q.head.id, 0, q.head.DiskUsage(), -1, -1, nil)
 			q.trimHead()
 		} else {
 			return nil
@@ -257,6 +282,11 @@ func (q *queue) Append(b *block) error {
 	// Append the entry to the tail, if the segment is full,
 	// try to create new segment and retry the append
 	if err := q.tail.Append(b); err == ErrSegmentFull {
+		if e := q.tail.seal(); e != nil {
+			// footer is only an optimization for startup, go ahead
+			log.Warn("queue[%s] seal segment[%d]: %s", q.ident(), q.tail.id, e)
+		}
+
 		segment, err := q.addSegment()
 		if err != nil {
 			return err
@@ -265,21 +295,98 @@ func (q *queue) Append(b *block) error {
 		q.tail = segment
 		err = q.tail.Append(b)
 		if err == nil {
+			q.indexAppended(b)
 			q.emptyInflight.Set(0)
 			q.inflights.Add(1)
 			q.appendN.Add(1)
+			q.audit(auditAppend, q.tail.id, q.tail.DiskUsage()-b.size(), b.size(), -1, -1, nil)
 		}
 		return err
 	} else if err != nil {
 		return err
 	}
 
+	q.indexAppended(b)
 	q.emptyInflight.Set(0)
 	q.appendN.Add(1)
 	q.inflights.Add(1)
+	q.audit(auditAppend, q.tail.id, q.tail.DiskUsage()-b.size(), b.size(), -1, -1, nil)
 	return nil
 }
 
+// indexAppended indexes the block just appended to tail.
+// caller is responsible for the lock
+func (q *queue) indexAppended(b *block) {
+	if err := q.index.append(q.tail, q.tail.DiskUsage()-b.size(), time.Now()); err != nil {
+		log.Warn("queue[%s] segment[%d] index: %s", q.ident(), q.tail.id, err)
+	}
+}
+
+// SeekTime advances the cursor to the indexed position from which blocks are possibly
+// appended after t, discarding the older undelivered blocks. The cursor never moves backward.
+// As the index is sparse, a few blocks not after t might be kept.
+// It must not be called while the queue is pumping.
+func (q *queue) SeekTime(t time.Time) (discarded bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.tail == nil {
+		return false, ErrQueueNotOpen
+	}
+
+	pos, ok := q.index.seek(t)
+	if !ok {
+		return false, nil
+	}
+
+	c := q.cursor
+	from := c.pos
+	if pos.SegmentID < from.SegmentID || (pos.SegmentID == from.SegmentID && pos.Offset <= from.Offset) {
+		return false, nil
+	}
+
+	if err = c.seek(pos); err != nil {
+		return false, err
+	}
+
+	q.audit(auditDiscard, from.SegmentID, from.Offset, 0, -1, -1, nil)
+	q.inflights.Set(q.loadInflights())
+	q.emptyInflight.Set(0)
+	return true, nil
+}
+
+// rewindTime moves the cursor backward to the indexed position from which blocks are possibly
+// appended after t, so that the delivered blocks since then are delivered again.
+// The cursor never moves forward.
+// It must not be called while the queue is pumping.
+func (q *queue) rewindTime(t time.Time) (rewound bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.tail == nil {
+		return false, ErrQueueNotOpen
+	}
+
+	pos, ok := q.index.seek(t)
+	if !ok {
+		return false, nil
+	}
+
+	c := q.cursor
+	from := c.pos
+	if pos.SegmentID > from.SegmentID || (pos.SegmentID == from.SegmentID && pos.Offset >= from.Offset) {
+		return false, nil
+	}
+
+	if err = c.seek(pos); err != nil {
+		return false, err
+	}
+
+	q.inflights.Set(q.loadInflights())
+	q.emptyInflight.Set(0)
+	return true, nil
+}
+
 func (q *queue) Rollback(b *block) (err error) {
 	c := q.cursor
 	if err = c.advanceOffset(-b.size()); err != nil {
@@ -304,12 +411,21 @@ func (q *queue) Next(b *block) (err error) {
 		err = c.seg.ReadOne(b)
 		switch err {
 		case nil:
+			if b.isFooter() {
+				// segment footer carries no payload, skip it
+				if err = c.advanceOffset(b.size()); err != nil {
+					return err
+				}
+				continue
+			}
+
 			// bingo!
 			q.emptyInflight.Set(0)
 			return c.advanceOffset(b.size())
 
 		case ErrSegmentCorrupt:
 			log.Error("queue[%s] segment[%d/%d] corrupted, advance to %d/0", q.ident(), c.pos.SegmentID, c.pos.Offset, c.pos.SegmentID+1)
+			q.audit(auditCorrupt, c.pos.SegmentID, c.pos.Offset, c.seg.DiskUsage()-c.pos.Offset, -1, -1, err)
 
 			q.mu.Lock()
 			if c.seg.id == q.tail.id {
@@ -329,6 +445,7 @@ func (q *queue) Next(b *block) (err error) {
 				q.emptyInflight.Set(1)
 				return ErrEOQ
 			}
+			q.enterSegment(c.seg)
 
 		case io.EOF:
 			// cursor might have:
@@ -338,6 +455,7 @@ func (q *queue) Next(b *block) (err error) {
 				q.emptyInflight.Set(1)
 				return ErrEOQ
 			}
+			q.enterSegment(c.seg)
 
 		default:
 			// unexpected err
@@ -360,8 +478,51 @@ func (q *queue) diskUsage() int64 {
 	return size
 }
 
+// loadInflights counts the undelivered blocks from cursor to tail.
+// Sealed segments have their block count in footer, others have to be scanned.
+// caller is responsible for the lock
+func (q *queue) loadInflights() (n int64) {
+	for _, s := range q.segments {
+		if s.id < q.cursor.pos.SegmentID {
+			continue
+		}
+
+		var (
+			blocks int64
+			found  bool
+			err    error
+		)
+		switch {
+		case s == q.tail:
+			// tail total blocks is required to seal it when full
+			if s.blocks, err = s.scanBlocks(0); err == nil {
+				blocks = s.blocks
+				if s == q.cursor.seg {
+					blocks, err = s.scanBlocks(q.cursor.pos.Offset)
+				}
+			}
+
+		case s == q.cursor.seg:
+			blocks, err = s.scanBlocks(q.cursor.pos.Offset)
+
+		default:
+			if blocks, found = s.footerBlocks(); !found {
+				blocks, err = s.scanBlocks(0)
+			}
+		}
+
+		if err != nil {
+			log.Warn("queue[%s] segment[%d] count blocks: %s", q.ident(), s.id, err)
+		}
+
+		n += blocks
+	}
+
+	log.Trace("queue[%s] loaded inflights: %d", q.ident(), n)
+	return
+}
+
 // loadSegments loads all in-range segments on disk
-// FIXME manage q.inflights counter while loading segments
 func (q *queue) loadSegments(minId uint64) (segments, error) {
 	segments := []*segment{}
 
@@ -371,7 +532,13 @@ func (q *queue) loadSegments(minId uint64) (segments, error) {
 	}
 
 	for _, segment := range files {
-		if segment.IsDir() || segment.Name() == cursorFile {
+		if segment.IsDir() || segment.Name() == cursorFile || isIndexFile(segment.Name()) {
+			continue
+		}
+		if isMigratingFile(segment.Name()) {
+			// left by crash during migration
+			log.Warn("queue[%s] remove partially migrated %s", q.ident(), segment.Name())
+			os.Remove(filepath.Join(q.dir, segment.Name()))
 			continue
 		}
 
@@ -386,7 +553,7 @@ func (q *queue) loadSegments(minId uint64) (segments, error) {
 			continue
 		}
 
-		segment, err := newSegment(id, filepath.Join(q.dir, segment.Name()), q.maxSegmentSize)
+		segment, err := newSegment(id, filepath.Join(q.dir, segment.Name()), q.maxSegmentSize, q.readAhead, q.writeBuffer)
 		if err != nil {
 			return segments, err
 		}
@@ -405,7 +572,7 @@ func (q *queue) addSegment() (*segment, error) {
 	}
 
 	path := filepath.Join(q.dir, fmt.Sprintf("%020d", nextID))
-	segment, err := newSegment(nextID, path, q.maxSegmentSize)
+	segment, err := newSegment(nextID, path, q.maxSegmentSize, q.readAhead, q.writeBuffer)
 	if err != nil {
 		return nil, err
 	}
@@ -423,7 +590,7 @@ func (q *queue) nextSegmentID() (uint64, error) {
 
 	var maxID uint64
 	for _, segment := range segments {
-		if segment.IsDir() || segment.Name() == cursorFile {
+		if segment.IsDir() || segment.Name() == cursorFile || isIndexFile(segment.Name()) || isMigratingFile(segment.Name()) {
 			continue
 		}
 
@@ -456,6 +623,9 @@ func (q *queue) trimHead() (err error) {
 	if err = q.head.Remove(); err != nil {
 		return
 	}
+	if err = q.index.remove(q.head.id); err != nil {
+		log.Warn("queue[%s] segment[%d] remove index: %s", q.ident(), q.head.id, err)
+	}
 
 	q.head = q.segments[0]
 	return
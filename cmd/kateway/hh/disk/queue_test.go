@@ -78,3 +78,51 @@ func TestQueueCorrupt(t *testing.T) {
 		}
 	}
 }
+
+func TestQueueInflightsReload(t *testing.T) {
+	os.RemoveAll("hh")
+	defer os.RemoveAll("hh")
+
+	var b block
+	q := newQueue("hh", clusterTopic{cluster: "me", topic: "foobar"}, 0, time.Second, time.Hour)
+	q.maxSegmentSize = 50 // each block is 20 bytes, 2 blocks per segment
+	err := q.Open()
+	assert.Equal(t, nil, err)
+	for i := 0; i < 10; i++ {
+		b.key = []byte(fmt.Sprintf("key%d", i))
+		b.value = []byte(fmt.Sprintf("value%d", i))
+		err = q.Append(&b)
+		assert.Equal(t, nil, err)
+	}
+	assert.Equal(t, int64(10), q.Inflights())
+	assert.Equal(t, true, len(q.segments) > 1)
+
+	// consume 3 blocks across segment boundary
+	for i := 0; i < 3; i++ {
+		err = q.Next(&b)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, fmt.Sprintf("key%d", i), string(b.key))
+		q.cursor.commitPosition()
+		q.inflights.Add(-1)
+	}
+	assert.Equal(t, nil, q.Close())
+
+	// sealed segments have block count in footer
+	q = newQueue("hh", clusterTopic{cluster: "me", topic: "foobar"}, 0, time.Second, time.Hour)
+	q.maxSegmentSize = 50
+	err = q.Open()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(7), q.Inflights())
+	n, found := q.segments[len(q.segments)-2].footerBlocks()
+	assert.Equal(t, true, found)
+	assert.Equal(t, int64(2), n)
+
+	// footers are transparent to readers
+	for i := 3; i < 10; i++ {
+		err = q.Next(&b)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, fmt.Sprintf("key%d", i), string(b.key))
+	}
+	assert.Equal(t, ErrEOQ, q.Next(&b))
+	assert.Equal(t, nil, q.Close())
+}
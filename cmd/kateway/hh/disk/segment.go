@@ -1,7 +1,11 @@
 package disk
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 	"sync"
 	"time"
@@ -22,15 +26,27 @@ import (
 //
 // Segments store arbitrary byte slices and leave the serialization to the caller.  Segments
 // are created with a max size and will block writes when the segment is full.
+//
+// When a segment is full, it is sealed with a footer block whose value is the number of
+// data blocks in the segment, so that the inflights can be reconstructed on startup
+// without reading every byte of the segment.
+//
+// If encryption at rest is enabled, the block magic attr marks it encrypted and a 4 bytes key id
+// follows the magic, the value is AES-GCM nonce + ciphertext.
+//
+// The 1st magic byte is the format version of the block, since v1 a 4 bytes crc32 of key and
+// value follows the value, see format.go.
 type segment struct {
 	mu sync.RWMutex
 
 	id      uint64
 	size    int64
 	maxSize int64
+	blocks  int64 // number of data blocks, footer excluded
 
 	rfile *bufferReader
 	wfile *bufferWriter
+	bw    *batchWriter // nil unless BatchWrite
 
 	lastFlush      time.Time
 	flushInflights int
@@ -40,7 +56,31 @@ type segment struct {
 
 type segments []*segment
 
-func newSegment(id uint64, path string, maxSize int64) (*segment, error) {
+// blocks larger than this are not pooled after batch write
+const maxPooledBlockBuf = 1 << 20
+
+var blockBufPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func blockBufGet() *bytes.Buffer {
+	return blockBufPool.Get().(*bytes.Buffer)
+}
+
+func blockBufPut(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBlockBuf {
+		return
+	}
+
+	buf.Reset()
+	blockBufPool.Put(buf)
+}
+
+// newSegment opens the segment file with readAhead bytes of read buffer and writeBuffer bytes of
+// write buffer, 0 to disable each.
+func newSegment(id uint64, path string, maxSize int64, readAhead, writeBuffer int) (*segment, error) {
 	// TODO should explicitly open files: too many open files?
 	wf, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0600)
 	if err != nil {
@@ -57,13 +97,22 @@ func newSegment(id uint64, path string, maxSize int64) (*segment, error) {
 		return nil, err
 	}
 
-	return &segment{
+	s := &segment{
 		id:      id,
-		wfile:   newBufferWriter(wf),
-		rfile:   newBufferReader(rf),
+		wfile:   newBufferWriter(wf, writeBuffer),
+		rfile:   newBufferReader(rf, readAhead),
 		size:    stats.Size(),
 		maxSize: maxSize,
-	}, nil
+	}
+	if BatchWrite {
+		if s.bw, err = newBatchWriter(wf); err != nil {
+			wf.Close()
+			rf.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
 }
 
 func (s *segment) Append(b *block) (err error) {
@@ -78,7 +127,19 @@ func (s *segment) Append(b *block) (err error) {
 		return ErrSegmentFull
 	}
 
-	if err = b.writeTo(s.wfile); err != nil {
+	if s.bw != nil {
+		// the whole block in 1 buffer, written with other blocks in a single syscall
+		buf := blockBufGet()
+		buf.Grow(int(b.size()))
+		if err = b.writeTo(buf); err != nil {
+			blockBufPut(buf)
+			return
+		}
+		if err = s.bw.submit(buf); err != nil {
+			blockBufPut(buf)
+			return
+		}
+	} else if err = b.writeTo(s.wfile); err != nil {
 		return
 	}
 
@@ -87,10 +148,108 @@ func (s *segment) Append(b *block) (err error) {
 	}
 
 	s.size += b.size()
+	s.blocks++
+
+	return nil
+}
+
+// seal appends a footer block to the segment that records its data block count.
+func (s *segment) seal() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wfile == nil {
+		return ErrSegmentNotOpen
+	}
+
+	if s.bw != nil {
+		// footer must be the last block
+		if err := s.bw.drain(); err != nil {
+			return err
+		}
+	}
+
+	b := newFooterBlock(s.blocks)
+	if err := b.writeTo(s.wfile); err != nil {
+		return err
+	}
+	if err := s.wfile.Sync(); err != nil {
+		return err
+	}
 
+	s.size += b.size()
 	return nil
 }
 
+// footerBlocks returns the data block count recorded in segment footer.
+// found is false if the segment is not sealed.
+func (s *segment) footerBlocks() (n int64, found bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.wfile == nil || s.size < footerSize {
+		return
+	}
+
+	f, err := os.Open(s.wfile.Name())
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	buf := make([]byte, footerSize)
+	if _, err = f.ReadAt(buf, s.size-footerSize); err != nil {
+		return
+	}
+
+	if buf[0] != footerMagic[0] || buf[1] != footerMagic[1] ||
+		binary.BigEndian.Uint32(buf[2:6]) != 0 || binary.BigEndian.Uint32(buf[6:10]) != 8 {
+		return
+	}
+
+	return int64(binary.BigEndian.Uint64(buf[10:])), true
+}
+
+// scanBlocks counts the data blocks from offset to the end of segment by reading
+// through the segment file. The counted blocks are returned even if err occurs.
+func (s *segment) scanBlocks(offset int64) (n int64, err error) {
+	s.mu.RLock()
+	if s.wfile == nil {
+		s.mu.RUnlock()
+		return 0, ErrSegmentNotOpen
+	}
+	path := s.wfile.Name()
+	s.mu.RUnlock()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	if _, err = f.Seek(offset, os.SEEK_SET); err != nil {
+		return
+	}
+
+	var (
+		b   block
+		buf = make([]byte, maxBlockSize)
+		r   = bufio.NewReader(f)
+	)
+	for {
+		if err = b.readFrom(r, buf); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+
+		if !b.isFooter() {
+			n++
+		}
+	}
+}
+
 func (s *segment) ReadOne(b *block) error {
 	if s.rfile == nil {
 		return ErrSegmentNotOpen
@@ -100,8 +259,19 @@ func (s *segment) ReadOne(b *block) error {
 		s.buf = make([]byte, maxBlockSize)
 	}
 
+	start := s.rfile.pos
 	if err := b.readFrom(s.rfile, s.buf); err != nil {
-		return err
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		if s.rfile.pos != start {
+			// the tail block might be partially written yet, rewind to read it whole next time
+			if _, e := s.rfile.Seek(start, os.SEEK_SET); e != nil {
+				return e
+			}
+		}
+		return io.EOF
 	}
 
 	return nil
@@ -114,7 +284,7 @@ func (s *segment) flush() (err error) {
 
 	if s.lastFlush.IsZero() {
 		// the 1st flush always do real IO
-		if err = s.wfile.Sync(); err == nil {
+		if err = s.sync(); err == nil {
 			s.lastFlush = time.Now()
 		}
 		return
@@ -123,7 +293,7 @@ func (s *segment) flush() (err error) {
 	now := time.Now()
 	if s.flushInflights >= flushEveryBlocks || now.Sub(s.lastFlush) >= flushInterval {
 		// time to flush the batch, group commit
-		if err = s.wfile.Sync(); err == nil {
+		if err = s.sync(); err == nil {
 			s.flushInflights = 0
 			s.lastFlush = now
 		}
@@ -135,6 +305,16 @@ func (s *segment) flush() (err error) {
 	return
 }
 
+func (s *segment) sync() error {
+	if s.bw != nil {
+		if err := s.bw.drain(); err != nil {
+			return err
+		}
+	}
+
+	return s.wfile.Sync()
+}
+
 func (s *segment) Current() int64 {
 	if s.rfile == nil {
 		return -1
@@ -162,19 +342,71 @@ func (s *segment) Remove() (err error) {
 	return
 }
 
-func (s *segment) Close() error {
+// reopen reopens the segment file replaced on disk, e,g. migrated.
+func (s *segment) reopen(readAhead, writeBuffer int) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if err := s.wfile.Close(); err != nil {
+	if s.wfile == nil {
+		return ErrSegmentNotOpen
+	}
+
+	path := s.wfile.Name()
+	if s.bw != nil {
+		if err := s.bw.close(); err != nil {
+			return err
+		}
+		s.bw = nil
+	}
+	s.wfile.Close()
+	s.rfile.Close()
+
+	wf, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
 		return err
 	}
-	if err := s.rfile.Close(); err != nil {
+	rf, err := os.OpenFile(path, os.O_RDONLY, 0600)
+	if err != nil {
+		wf.Close()
 		return err
 	}
+	stats, err := rf.Stat()
+	if err != nil {
+		wf.Close()
+		rf.Close()
+		return err
+	}
+
+	s.wfile = newBufferWriter(wf, writeBuffer)
+	s.rfile = newBufferReader(rf, readAhead)
+	s.size = stats.Size()
+	if BatchWrite {
+		if s.bw, err = newBatchWriter(wf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the segment files even if the pending batch write fails, and returns the
+// first error.
+func (s *segment) Close() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.bw != nil {
+		err = s.bw.close()
+		s.bw = nil
+	}
+	if e := s.wfile.Close(); e != nil && err == nil {
+		err = e
+	}
+	if e := s.rfile.Close(); e != nil && err == nil {
+		err = e
+	}
 	s.wfile = nil
 	s.rfile = nil
-	return nil
+	return
 }
 
 func (s *segment) LastModified() time.Time {
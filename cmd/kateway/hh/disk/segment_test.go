@@ -1,6 +1,8 @@
 package disk
 
 import (
+	"bytes"
+	"io"
 	"os"
 	"testing"
 
@@ -11,7 +13,7 @@ func TestSegment(t *testing.T) {
 	path := "/Users/funky/gopkg/src/github.com/funkygao/gafka/cmd/kateway/hh/disk/segment.001"
 	defer os.Remove(path)
 
-	s, err := newSegment(1, path, 2<<20)
+	s, err := newSegment(1, path, 2<<20, 0, 0)
 	assert.Equal(t, nil, err)
 	b := &block{
 		key:   []byte("hello"),
@@ -29,3 +31,35 @@ func TestSegment(t *testing.T) {
 	assert.Equal(t, "world", string(b1.value))
 
 }
+
+func TestSegmentReadAheadPartialTail(t *testing.T) {
+	path := "segment.partial"
+	defer os.Remove(path)
+
+	s, err := newSegment(1, path, 2<<20, 4<<10, 0)
+	assert.Equal(t, nil, err)
+	defer s.Close()
+
+	var buf bytes.Buffer
+	b := &block{key: []byte("hello"), value: []byte("world")}
+	assert.Equal(t, nil, b.writeTo(&buf))
+	s.Append(b)
+
+	// the next block is half written
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	defer f.Close()
+	f.Write(buf.Bytes()[:5])
+
+	s.Seek(0)
+	b1 := new(block)
+	assert.Equal(t, nil, s.ReadOne(b1))
+	assert.Equal(t, "world", string(b1.value))
+	assert.Equal(t, io.EOF, s.ReadOne(b1))
+	assert.Equal(t, b.size(), s.Current())
+
+	// rest of the block written
+	f.Write(buf.Bytes()[5:])
+	assert.Equal(t, nil, s.ReadOne(b1))
+	assert.Equal(t, "hello", string(b1.key))
+	assert.Equal(t, 2*b.size(), s.Current())
+}
@@ -0,0 +1,210 @@
+package disk
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+type segmentSnapshot struct {
+	name  string
+	f     *os.File
+	size  int64
+	mtime time.Time
+	index []byte // encoded index file, nil if not indexed
+}
+
+// Snapshot writes a portable tar archive of the queue to w: the committed cursor and the
+// segments with their index from the cursor on, which can be restored on another host by RestoreSnapshot.
+//
+// Appends are blocked only while the segment sizes are taken, segments are append-only and
+// the opened files survive purge, so the archive is consistent.
+func (q *queue) Snapshot(w io.Writer) error {
+	q.mu.RLock()
+	if q.tail == nil {
+		q.mu.RUnlock()
+		return ErrQueueNotOpen
+	}
+
+	q.cursor.rwmux.RLock()
+	pos := q.cursor.permPos
+	q.cursor.rwmux.RUnlock()
+
+	var snapshots []segmentSnapshot
+	defer func() {
+		for _, ss := range snapshots {
+			ss.f.Close()
+		}
+	}()
+	for _, s := range q.segments {
+		if s.id < pos.SegmentID {
+			continue
+		}
+
+		ss, err := s.snapshot()
+		if err != nil {
+			q.mu.RUnlock()
+			return err
+		}
+		ss.index = q.index.snapshot(s.id)
+		snapshots = append(snapshots, ss)
+	}
+	q.mu.RUnlock()
+
+	tw := tar.NewWriter(w)
+	cursor, _ := json.Marshal(&pos)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    cursorFile,
+		Mode:    0600,
+		Size:    int64(len(cursor)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(cursor); err != nil {
+		return err
+	}
+
+	for _, ss := range snapshots {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    ss.name,
+			Mode:    0600,
+			Size:    ss.size,
+			ModTime: ss.mtime,
+		}); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(tw, ss.f, ss.size); err != nil {
+			return err
+		}
+
+		if ss.index == nil {
+			continue
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    ss.name + indexFileSuffix,
+			Mode:    0600,
+			Size:    int64(len(ss.index)),
+			ModTime: ss.mtime,
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(ss.index); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// snapshot flushes the segment and opens it for archiving up to current size.
+func (s *segment) snapshot() (ss segmentSnapshot, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wfile == nil {
+		return ss, ErrSegmentNotOpen
+	}
+
+	if err = s.wfile.Sync(); err != nil {
+		return
+	}
+
+	path := s.wfile.Name()
+	stats, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	ss.f, err = os.Open(path)
+	ss.name = filepath.Base(path)
+	ss.size = s.size
+	ss.mtime = stats.ModTime()
+	return
+}
+
+// RestoreSnapshot extracts a Snapshot archive into the queue dir, after which the queue
+// can be opened. The queue must be closed and empty.
+func (q *queue) RestoreSnapshot(r io.Reader) (err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.head != nil || q.tail != nil || len(q.segments) > 0 {
+		return ErrQueueOpen
+	}
+
+	if err = mkdirIfNotExist(q.dir); err != nil {
+		return
+	}
+	if files, _ := ioutil.ReadDir(q.dir); len(files) > 0 {
+		return ErrQueueNotEmpty
+	}
+
+	defer func() {
+		if err != nil {
+			// never leave a partial queue behind
+			os.RemoveAll(q.dir)
+		}
+	}()
+
+	var (
+		tr  = tar.NewReader(r)
+		hdr *tar.Header
+	)
+	for {
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if !validSnapshotEntry(hdr.Name) {
+			return fmt.Errorf("invalid snapshot entry: %s", hdr.Name)
+		}
+
+		if err = restoreSnapshotFile(filepath.Join(q.dir, hdr.Name), tr); err != nil {
+			return err
+		}
+	}
+}
+
+// validSnapshotEntry guards against archive entries escaping the queue dir.
+func validSnapshotEntry(name string) bool {
+	if name == cursorFile {
+		return true
+	}
+
+	if isIndexFile(name) {
+		_, err := segmentIdOfIndexFile(name)
+		return err == nil
+	}
+
+	// segment file names are all numeric
+	_, err := strconv.ParseUint(name, 10, 64)
+	return err == nil
+}
+
+func restoreSnapshotFile(path string, r io.Reader) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
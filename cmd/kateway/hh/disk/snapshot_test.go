@@ -0,0 +1,63 @@
+package disk
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestQueueSnapshotAndRestore(t *testing.T) {
+	os.RemoveAll("hh")
+	os.RemoveAll("hh2")
+	defer func() {
+		os.RemoveAll("hh")
+		os.RemoveAll("hh2")
+	}()
+
+	var b block
+	q := newQueue("hh", clusterTopic{cluster: "me", topic: "foobar"}, 0, time.Second, time.Hour)
+	q.maxSegmentSize = 100 // a few blocks per segment
+	assert.Equal(t, nil, q.Open())
+	for i := 0; i < 10; i++ {
+		b.key = []byte(fmt.Sprintf("key%d", i))
+		b.value = []byte(fmt.Sprintf("value%d", i))
+		assert.Equal(t, nil, q.Append(&b))
+	}
+
+	// the first 3 blocks delivered
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, nil, q.Next(&b))
+	}
+	q.cursor.commitPosition()
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, q.Snapshot(&buf))
+	assert.Equal(t, nil, q.Close())
+
+	r := newQueue("hh2", clusterTopic{cluster: "me", topic: "foobar"}, 0, time.Second, time.Hour)
+	assert.Equal(t, nil, r.RestoreSnapshot(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, ErrQueueNotEmpty, r.RestoreSnapshot(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, nil, r.Open())
+	defer r.Close()
+
+	assert.Equal(t, int64(7), r.Inflights())
+	for i := 3; i < 10; i++ {
+		assert.Equal(t, nil, r.Next(&b))
+		assert.Equal(t, fmt.Sprintf("key%d", i), string(b.key))
+		assert.Equal(t, fmt.Sprintf("value%d", i), string(b.value))
+	}
+	assert.Equal(t, ErrEOQ, r.Next(&b))
+}
+
+func TestValidSnapshotEntry(t *testing.T) {
+	assert.Equal(t, true, validSnapshotEntry(cursorFile))
+	assert.Equal(t, true, validSnapshotEntry("00000000000000000001"))
+	assert.Equal(t, true, validSnapshotEntry("00000000000000000001.idx"))
+	assert.Equal(t, false, validSnapshotEntry("../00000000000000000001.idx"))
+	assert.Equal(t, false, validSnapshotEntry("../00000000000000000001"))
+	assert.Equal(t, false, validSnapshotEntry("/etc/passwd"))
+}
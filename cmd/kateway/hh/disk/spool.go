@@ -0,0 +1,111 @@
+package disk
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/funkygao/golib/timewheel"
+)
+
+// DeliverFunc delivers a spooled message downstream, returns ErrDiscard to drop it without retry.
+type DeliverFunc func(key, value []byte) error
+
+// Spool is a standalone disk queue whose blocks are delivered by a DeliverFunc instead of
+// Pub to kafka, e,g. store-and-forward of Sub messages to a downstream frequently offline.
+//
+// Unlike hh queues, delivered blocks are kept on disk until maxAge so that they can be replayed.
+type Spool struct {
+	mu sync.Mutex
+	q  *queue
+}
+
+var timerMu sync.Mutex
+
+// initTimer creates the backoff timer if hh Service is not created.
+func initTimer() {
+	timerMu.Lock()
+	if timer == nil {
+		timer = timewheel.NewTimeWheel(time.Second, 120)
+	}
+	timerMu.Unlock()
+}
+
+// OpenSpool opens or creates the spool under baseDir/cluster/name and starts delivering.
+func OpenSpool(baseDir, cluster, name string, maxAge time.Duration, deliver DeliverFunc) (*Spool, error) {
+	initTimer()
+
+	ct := clusterTopic{cluster: cluster, topic: name}
+	if err := os.MkdirAll(ct.ClusterDir(baseDir), 0700); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+
+	q := newQueue(baseDir, ct, defaultMaxQueueSize, defaultPurgeInterval, maxAge)
+	q.readAhead = defaultReadAhead
+	q.deliver = deliver
+	q.replayable = true
+	q.migrateOnRead = true
+	if err := q.Open(); err != nil {
+		return nil, err
+	}
+
+	q.Start()
+	return &Spool{q: q}, nil
+}
+
+// Append spools a message.
+func (s *Spool) Append(key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.q.Append(&block{magic: newMagic(), key: key, value: value})
+}
+
+// Replay delivers again the messages spooled since t that are still on disk.
+// As the index is sparse, a few messages before t might be delivered again too.
+func (s *Spool) Replay(since time.Time) (rewound bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the cursor must not move while pumping
+	if err = s.q.Close(); err != nil {
+		return
+	}
+	if err = s.q.Open(); err != nil {
+		return
+	}
+
+	rewound, err = s.q.rewindTime(since)
+	s.q.Start()
+	return
+}
+
+// Inflights returns the number of messages not yet delivered.
+func (s *Spool) Inflights() int64 {
+	return s.q.Inflights()
+}
+
+func (s *Spool) AppendN() int64 {
+	return s.q.AppendN()
+}
+
+func (s *Spool) DeliverN() int64 {
+	return s.q.DeliverN()
+}
+
+// Close stops delivering and checkpoints the spool, undelivered messages are kept on disk.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.q.Close()
+}
+
+// Remove closes the spool and removes it from disk, undelivered messages are lost.
+func (s *Spool) Remove() error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+
+	return s.q.Remove()
+}
@@ -0,0 +1,66 @@
+package disk
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestSpoolDeliverAndReplay(t *testing.T) {
+	os.RemoveAll("spool")
+	defer os.RemoveAll("spool")
+
+	var (
+		mu        sync.Mutex
+		delivered []string
+	)
+	deliver := func(key, value []byte) error {
+		if string(key) == "poison" {
+			return ErrDiscard
+		}
+
+		mu.Lock()
+		delivered = append(delivered, string(value))
+		mu.Unlock()
+		return nil
+	}
+	deliveredN := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(delivered)
+	}
+	waitDelivered := func(s *Spool, n int) {
+		for i := 0; i < 50 && (deliveredN() < n || s.Inflights() > 0); i++ {
+			time.Sleep(time.Millisecond * 100)
+		}
+	}
+
+	t0 := time.Now().Add(-time.Second)
+	s, err := OpenSpool("spool", "me", "app1.foo.v1.g1", time.Hour, deliver)
+	assert.Equal(t, nil, err)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, nil, s.Append([]byte("key"), []byte(fmt.Sprintf("value%d", i))))
+	}
+	assert.Equal(t, nil, s.Append([]byte("poison"), []byte("bad")))
+
+	waitDelivered(s, 3)
+	assert.Equal(t, []string{"value0", "value1", "value2"}, delivered)
+	assert.Equal(t, int64(4), s.DeliverN())
+	assert.Equal(t, nil, s.Close())
+
+	// delivered messages survive restart and can be replayed
+	s, err = OpenSpool("spool", "me", "app1.foo.v1.g1", time.Hour, deliver)
+	assert.Equal(t, nil, err)
+	rewound, err := s.Replay(t0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, rewound)
+
+	waitDelivered(s, 6)
+	assert.Equal(t, []string{"value0", "value1", "value2", "value0", "value1", "value2"}, delivered)
+	assert.Equal(t, int64(0), s.Inflights())
+	assert.Equal(t, nil, s.Remove())
+}
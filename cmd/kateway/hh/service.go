@@ -4,6 +4,10 @@
 // server restarts or rebalancing.
 package hh
 
+import (
+	"io"
+)
+
 type Service interface {
 
 	// Start the hinted handoff service.
@@ -37,4 +41,32 @@ type Service interface {
 	ResetCounters()
 }
 
+// Snapshotter is implemented by Service that is able to archive a queue, so that flush
+// problems can be reproduced offline and queues migrated between hosts.
+type Snapshotter interface {
+
+	// Snapshot writes a portable archive of the queue of cluster/topic.
+	Snapshot(cluster, topic string, w io.Writer) error
+
+	// Restore creates the queue of cluster/topic from a Snapshot archive.
+	Restore(cluster, topic string, r io.Reader) error
+}
+
+// Policer is implemented by Service that is able to enable or disable hinted handoff of
+// each cluster/topic: some topics prefer fast failure of Pub over delayed delivery.
+type Policer interface {
+
+	// Enabled returns whether Pub of cluster/topic may be appended.
+	Enabled(cluster, topic string) bool
+
+	// SetPolicy enables or disables cluster/topic, topic * for all topics of the cluster.
+	SetPolicy(cluster, topic string, enabled bool)
+
+	// ResetPolicy removes the policy of cluster/topic.
+	ResetPolicy(cluster, topic string)
+
+	// Policy returns the policies keyed by cluster/topic or cluster/*.
+	Policy() map[string]bool
+}
+
 var Default Service
@@ -10,7 +10,7 @@ func New() job.JobStore {
 	return &dummy{}
 }
 
-func (this *dummy) Add(appid, topic string, payload []byte, due int64) (jobId string, err error) {
+func (this *dummy) Add(appid, topic string, payload []byte, due int64, priority int) (jobId string, err error) {
 	return
 }
 
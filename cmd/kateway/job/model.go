@@ -5,11 +5,17 @@ import (
 	"fmt"
 )
 
+const (
+	MinPriority = 0 // the default
+	MaxPriority = 9
+)
+
 type JobItem struct {
-	JobId   int64
-	Payload []byte
-	Ctime   int64
-	DueTime int64
+	JobId    int64
+	Payload  []byte
+	Ctime    int64
+	DueTime  int64
+	Priority int
 }
 
 func (this JobItem) String() string {
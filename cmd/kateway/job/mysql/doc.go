@@ -1,2 +1,6 @@
 // Package mysql implements a job store with mysql as backend.
+//
+// Job tables created before job priority was introduced need migration:
+//
+//	ALTER TABLE <job table> ADD COLUMN priority tinyint unsigned NOT NULL DEFAULT 0;
 package mysql
@@ -64,6 +64,7 @@ CREATE TABLE %s (
     ctime int NOT NULL DEFAULT 0,
     mtime int NOT NULL DEFAULT 0,
     due_time int NOT NULL,
+    priority tinyint unsigned NOT NULL DEFAULT 0,
     PRIMARY KEY (job_id),
     KEY(due_time)
 ) ENGINE = INNODB DEFAULT CHARSET utf8
@@ -90,12 +91,12 @@ CREATE TABLE %s (
 	return
 }
 
-func (this *mysqlStore) Add(appid, topic string, payload []byte, due int64) (jobId string, err error) {
+func (this *mysqlStore) Add(appid, topic string, payload []byte, due int64, priority int) (jobId string, err error) {
 	jid := this.nextId()
 	table, aid := JobTable(topic), App_id(appid)
-	sql := fmt.Sprintf("INSERT INTO %s(job_id, payload, ctime, due_time) VALUES(?,?,?,?)", table)
+	sql := fmt.Sprintf("INSERT INTO %s(job_id, payload, ctime, due_time, priority) VALUES(?,?,?,?,?)", table)
 	_, _, err = this.mc.Exec(AppPool, table, aid, sql,
-		jid, payload, time.Now().Unix(), due)
+		jid, payload, time.Now().Unix(), due, priority)
 	jobId = strconv.FormatInt(jid, 10)
 	return
 }
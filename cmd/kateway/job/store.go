@@ -14,7 +14,8 @@ type JobStore interface {
 	CreateJobQueue(shardId int, appid, topic string) (err error)
 
 	// Add pubs a schedulable message(job) synchronously.
-	Add(appid, topic string, payload []byte, due int64) (jobId string, err error)
+	// Jobs of higher priority due at the same time fire first.
+	Add(appid, topic string, payload []byte, due int64, priority int) (jobId string, err error)
 
 	// Delete removes a job by jobId.
 	Delete(appid, topic, jobId string) (err error)
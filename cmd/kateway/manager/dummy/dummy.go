@@ -3,6 +3,7 @@ package dummy
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/mpool"
@@ -130,6 +131,39 @@ func (this *dummyStore) IsShadowedTopic(hisAppid, topic, ver, myAppid, group str
 	return true
 }
 
+func (this *dummyStore) AuthRaw(appid, cluster string) error {
+	return nil
+}
+
+func (this *dummyStore) LookupTenant(appid string) (*manager.Tenant, bool) {
+	return nil, false
+}
+
+func (this *dummyStore) AppPriority(appid string) manager.Priority {
+	return manager.PriorityNormal
+}
+
+func (this *dummyStore) RouteRules(appid, topic, ver string) []manager.RouteRule {
+	return nil
+}
+
+func (this *dummyStore) TransformRules(appid, topic, ver string) []manager.TransformRule {
+	return nil
+}
+
+func (this *dummyStore) DedupWindow(appid, topic, ver string) time.Duration {
+	return 0
+}
+
+func (this *dummyStore) SubJsonSchema(appid, topic, ver string) string {
+	return ""
+}
+
+// RefreshedAt returns now: dummy data is always fresh.
+func (this *dummyStore) RefreshedAt() time.Time {
+	return time.Now()
+}
+
 func (this *dummyStore) Dump() map[string]interface{} {
 	r := make(map[string]interface{})
 	return r
@@ -11,4 +11,5 @@ var (
 	ErrAuthorizationFail  = errors.New("authorization fails")
 	ErrInvalidGroup       = errors.New("group must be registered before usage")
 	ErrSchemaNotFound     = errors.New("schema not found")
+	ErrCrossTenant        = errors.New("access across tenants not allowed")
 )
@@ -2,6 +2,7 @@ package manager
 
 import (
 	"net/http"
+	"time"
 )
 
 // Manager is the interface that integrates with pubsub manager UI.
@@ -38,17 +39,48 @@ type Manager interface {
 	ShadowTopic(shadow, myAppid, hisAppid, topic, ver, group string) string
 
 	// AuthSub checks if an appid is able to consume message from hisAppid.hisTopic.
+	// Sub across tenants is denied.
 	AuthSub(appid, subkey, hisAppid, hisTopic, group string) error
 
+	// AuthRaw checks if an appid can Pub/Sub the topics of a kafka cluster directly by the
+	// raw endpoints, which bypass topic ownership. Apps of a tenant are denied, and so are
+	// the dedicated clusters of tenants.
+	AuthRaw(appid, cluster string) error
+
 	// LookupCluster locate the cluster name of an appid.
+	// If the app belongs to a tenant with dedicated cluster, it is the tenant's cluster.
 	LookupCluster(appid string) (cluster string, found bool)
 
+	// LookupTenant returns the tenant of an appid, not found if the app belongs to default tenant.
+	LookupTenant(appid string) (tenant *Tenant, found bool)
+
+	// AppPriority returns the Pub admission priority of an appid, PriorityNormal if not classified.
+	AppPriority(appid string) Priority
+
 	// ForceRefresh will force manager to refresh the management data at once.
 	ForceRefresh()
 
+	// RefreshedAt returns when the management data was last refreshed from the source,
+	// zero if never, e,g. started from the local snapshot.
+	RefreshedAt() time.Time
+
 	// IsShadowedTopic checks if a topic has retry/dead sub/shadow topics.
 	IsShadowedTopic(hisAppid, topic, ver, myAppid, group string) bool
 
+	// RouteRules returns the ordered routing rules of a virtual topic, nil if not virtual.
+	RouteRules(appid, topic, ver string) []RouteRule
+
+	// TransformRules returns the ordered message transforms of a topic, nil if none.
+	TransformRules(appid, topic, ver string) []TransformRule
+
+	// DedupWindow returns the time window in which duplicated Pub messages of a topic
+	// are dropped, 0 if dedup is off.
+	DedupWindow(appid, topic, ver string) time.Duration
+
+	// SubJsonSchema returns the avro schema of a topic whose Sub clients are allowed to
+	// consume messages decoded as json, empty if not allowed.
+	SubJsonSchema(appid, topic, ver string) string
+
 	ValidateTopicName(topic string) bool
 	ValidateGroupName(header http.Header, group string) bool
 
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/ctx"
 )
 
@@ -117,3 +118,42 @@ func TestValidateGroupName(t *testing.T) {
 	h.Set("X-Origin", "smoketest")
 	assert.Equal(t, true, m.ValidateGroupName(h, "__smoketest__"))
 }
+
+func TestTenantIsolation(t *testing.T) {
+	m := &mysqlStore{}
+	m.appClusterMap = map[string]string{"app1": "c1", "app2": "c1", "app3": "c1"}
+	m.tenantMap = map[string]*manager.Tenant{
+		"t1": {Name: "t1", Cluster: "dedicated"},
+	}
+	m.appTenantMap = map[string]string{"app1": "t1"}
+
+	cluster, found := m.LookupCluster("app1")
+	assert.Equal(t, true, found)
+	assert.Equal(t, "dedicated", cluster)
+	cluster, _ = m.LookupCluster("app2")
+	assert.Equal(t, "c1", cluster)
+
+	tenant, found := m.LookupTenant("app1")
+	assert.Equal(t, true, found)
+	assert.Equal(t, "t1", tenant.Name)
+	_, found = m.LookupTenant("app2")
+	assert.Equal(t, false, found)
+
+	assert.Equal(t, false, manager.SameTenant(m.appTenantMap, "app1", "app2"))
+	assert.Equal(t, true, manager.SameTenant(m.appTenantMap, "app2", "app3"))
+
+	// raw endpoints bypass topic ownership
+	assert.Equal(t, manager.ErrCrossTenant, m.AuthRaw("app1", "dedicated"))
+	assert.Equal(t, manager.ErrCrossTenant, m.AuthRaw("app1", "c1"))
+	assert.Equal(t, manager.ErrCrossTenant, m.AuthRaw("app2", "dedicated"))
+	assert.Equal(t, nil, m.AuthRaw("app2", "c1"))
+}
+
+func TestAppPriority(t *testing.T) {
+	m := &mysqlStore{}
+	m.appPriorityMap = map[string]manager.Priority{"app1": manager.PriorityCritical, "app2": manager.PriorityBulk}
+	assert.Equal(t, manager.PriorityCritical, m.AppPriority("app1"))
+	assert.Equal(t, manager.PriorityBulk, m.AppPriority("app2"))
+	assert.Equal(t, manager.PriorityNormal, m.AppPriority("app3"))
+	assert.Equal(t, "bulk", m.AppPriority("app2").String())
+}
@@ -7,6 +7,10 @@ import (
 type config struct {
 	Zone    string
 	Refresh time.Duration
+
+	// SnapshotFile is the local copy of the management data for degraded start when
+	// mysql is down, empty means no snapshot.
+	SnapshotFile string
 }
 
 func DefaultConfig(zone string) *config {
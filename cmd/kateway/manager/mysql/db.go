@@ -3,8 +3,10 @@ package mysql
 import (
 	"database/sql"
 	"fmt"
+	"sync/atomic"
 	"time"
 
+	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/ctx"
 	"github.com/funkygao/gafka/mpool"
 	"github.com/funkygao/gafka/zk"
@@ -20,6 +22,8 @@ type mysqlStore struct {
 	shutdownCh chan struct{}
 
 	allowUnregisteredGroup bool
+	degraded               int32 // 1 if running on the local snapshot because mysql is down
+	refreshedAt            int64 // atomic, unix nano of the last successful refresh
 
 	adminUser, adminPass string
 
@@ -33,6 +37,13 @@ type mysqlStore struct {
 	shadowQueueMap      map[string]string                       // hisappid.topic.ver.myappid:group
 	deadPartitionMap    map[string]map[int32]struct{}           // topic:partitionId
 	topicSchemaMap      map[string]map[string]map[string]string // appid:topic:ver:schema
+	routeRuleMap        map[string][]manager.RouteRule          // appid.topic.ver:rules
+	transformRuleMap    map[string][]manager.TransformRule      // appid.topic.ver:rules
+	dedupWindowMap      map[string]time.Duration                // appid.topic.ver:window
+	subJsonSchemaMap    map[string]string                       // appid.topic.ver:avro schema
+	tenantMap           map[string]*manager.Tenant              // tenant name:tenant
+	appTenantMap        map[string]string                       // appid:tenant name
+	appPriorityMap      map[string]manager.Priority             // appid:pub admission priority
 
 	topicNames *mpool.Intern
 }
@@ -49,7 +60,7 @@ func New(cf *config) *mysqlStore {
 	zone := ctx.Zone(cf.Zone)
 	my := &mysqlStore{
 		cf:                     cf,
-		zkzone:                 zk.NewZkZone(zk.DefaultConfig(cf.Zone, zkAddrs)), // TODO session timeout
+		zkzone:                 zk.NewSharedZkZone(zk.DefaultConfig(cf.Zone, zkAddrs)), // TODO session timeout
 		shutdownCh:             make(chan struct{}),
 		refreshCh:              make(chan struct{}),
 		allowUnregisteredGroup: false,
@@ -69,8 +80,19 @@ func (this *mysqlStore) Name() string {
 
 func (this *mysqlStore) Start() error {
 	if err := this.refreshFromMysql(); err != nil {
-		// refuse to start if mysql conn fails
-		return fmt.Errorf("manager[%s]: %v", this.Name(), err)
+		if this.cf.SnapshotFile == "" {
+			// refuse to start if mysql conn fails
+			return fmt.Errorf("manager[%s]: %v", this.Name(), err)
+		}
+
+		savedAt, e := this.loadSnapshot()
+		if e != nil {
+			return fmt.Errorf("manager[%s]: %v, snapshot: %v", this.Name(), err, e)
+		}
+
+		// stale auth/topic data is better than refusing all the traffic
+		atomic.StoreInt32(&this.degraded, 1)
+		log.Warn("manager[%s]: %v, degraded to snapshot of %s", this.Name(), err, savedAt)
 	}
 
 	go func() {
@@ -94,6 +116,8 @@ func (this *mysqlStore) Start() error {
 				}
 
 			case <-this.shutdownCh:
+				// release the zk session shared with kateway
+				this.zkzone.Close()
 				log.Info("mysql manager stopped")
 				return
 			}
@@ -140,6 +164,30 @@ func (this *mysqlStore) refreshFromMysql() error {
 		return err
 	}
 
+	if err = this.fetchRouteRules(db); err != nil {
+		return err
+	}
+
+	if err = this.fetchTransformRules(db); err != nil {
+		return err
+	}
+
+	if err = this.fetchDedupWindows(db); err != nil {
+		return err
+	}
+
+	if err = this.fetchSubJsonSchemas(db); err != nil {
+		return err
+	}
+
+	if err = this.fetchTenants(db); err != nil {
+		return err
+	}
+
+	if err = this.fetchAppPriorities(db); err != nil {
+		return err
+	}
+
 	if false {
 		if err = this.fetchSchemas(db); err != nil {
 			return err
@@ -151,13 +199,233 @@ func (this *mysqlStore) refreshFromMysql() error {
 
 	}
 
+	atomic.StoreInt64(&this.refreshedAt, time.Now().UnixNano())
+	if atomic.CompareAndSwapInt32(&this.degraded, 1, 0) {
+		log.Info("manager[%s] recovered from degraded mode", this.Name())
+	}
+
+	if this.cf.SnapshotFile != "" {
+		if err = this.saveSnapshot(); err != nil {
+			// not fatal
+			log.Error("manager[%s] snapshot: %v", this.Name(), err)
+		}
+	}
+
 	return nil
 }
 
+// Degraded returns true if the management data comes from the local snapshot instead of mysql.
+func (this *mysqlStore) Degraded() bool {
+	return atomic.LoadInt32(&this.degraded) == 1
+}
+
+func (this *mysqlStore) RefreshedAt() time.Time {
+	if ns := atomic.LoadInt64(&this.refreshedAt); ns > 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
 func (this *mysqlStore) shadowKey(hisAppid, topic, ver, myAppid string) string {
 	return hisAppid + "." + topic + "." + ver + "." + myAppid
 }
 
+func (this *mysqlStore) routeKey(appid, topic, ver string) string {
+	return appid + "." + topic + "." + ver
+}
+
+func (this *mysqlStore) fetchRouteRules(db *sql.DB) error {
+	rows, err := db.Query("SELECT AppId,TopicName,Ver,Header,JsonPath,Value,TargetTopic,TargetVer FROM topic_route WHERE Status=1 ORDER BY Priority")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	m := make(map[string][]manager.RouteRule)
+	var route topicRouteRecord
+	for rows.Next() {
+		err = rows.Scan(&route.AppId, &route.TopicName, &route.Ver, &route.Header, &route.JsonPath,
+			&route.Value, &route.TargetTopic, &route.TargetVer)
+		if err != nil {
+			log.Error("mysql manager store: %v", err)
+			continue
+		}
+
+		key := this.routeKey(route.AppId, route.TopicName, route.Ver)
+		m[key] = append(m[key], manager.RouteRule{
+			Header:   route.Header,
+			JsonPath: route.JsonPath,
+			Value:    route.Value,
+			Topic:    route.TargetTopic,
+			Ver:      route.TargetVer,
+		})
+	}
+
+	this.routeRuleMap = m
+	return nil
+}
+
+func (this *mysqlStore) fetchTransformRules(db *sql.DB) error {
+	rows, err := db.Query("SELECT AppId,TopicName,Ver,Name,Params,OnSub FROM topic_transform WHERE Status=1 ORDER BY Priority")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	m := make(map[string][]manager.TransformRule)
+	var transform topicTransformRecord
+	for rows.Next() {
+		err = rows.Scan(&transform.AppId, &transform.TopicName, &transform.Ver, &transform.Name,
+			&transform.Params, &transform.OnSub)
+		if err != nil {
+			log.Error("mysql manager store: %v", err)
+			continue
+		}
+
+		key := this.routeKey(transform.AppId, transform.TopicName, transform.Ver)
+		m[key] = append(m[key], manager.TransformRule{
+			Name:   transform.Name,
+			Params: transform.Params,
+			OnSub:  transform.OnSub == 1,
+		})
+	}
+
+	this.transformRuleMap = m
+	return nil
+}
+
+func (this *mysqlStore) fetchDedupWindows(db *sql.DB) error {
+	rows, err := db.Query("SELECT AppId,TopicName,Ver,WindowSeconds FROM topic_dedup WHERE Status=1")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	m := make(map[string]time.Duration)
+	var dedup topicDedupRecord
+	for rows.Next() {
+		err = rows.Scan(&dedup.AppId, &dedup.TopicName, &dedup.Ver, &dedup.WindowSeconds)
+		if err != nil {
+			log.Error("mysql manager store: %v", err)
+			continue
+		}
+
+		if dedup.WindowSeconds > 0 {
+			m[this.routeKey(dedup.AppId, dedup.TopicName, dedup.Ver)] = time.Duration(dedup.WindowSeconds) * time.Second
+		}
+	}
+
+	this.dedupWindowMap = m
+	return nil
+}
+
+// fetchSubJsonSchemas loads the schemas of topics whose avro messages can be decoded to json on Sub.
+func (this *mysqlStore) fetchSubJsonSchemas(db *sql.DB) error {
+	rows, err := db.Query("SELECT AppId,TopicName,Ver,Schema FROM topic_schema WHERE Status=1 AND SubJson=1")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	m := make(map[string]string)
+	var schema topicSchemaRecord
+	for rows.Next() {
+		err = rows.Scan(&schema.AppId, &schema.TopicName, &schema.Ver, &schema.Schema)
+		if err != nil {
+			log.Error("mysql manager store: %v", err)
+			continue
+		}
+
+		if schema.Schema != "" {
+			m[this.routeKey(schema.AppId, schema.TopicName, schema.Ver)] = schema.Schema
+		}
+	}
+
+	this.subJsonSchemaMap = m
+	return nil
+}
+
+func (this *mysqlStore) fetchTenants(db *sql.DB) error {
+	rows, err := db.Query("SELECT TenantName,Cluster,PubQpsLimit FROM tenant WHERE Status=1")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tenants := make(map[string]*manager.Tenant)
+	var tenant tenantRecord
+	for rows.Next() {
+		err = rows.Scan(&tenant.TenantName, &tenant.Cluster, &tenant.PubQpsLimit)
+		if err != nil {
+			log.Error("mysql manager store: %v", err)
+			continue
+		}
+
+		tenants[tenant.TenantName] = &manager.Tenant{
+			Name:        tenant.TenantName,
+			Cluster:     tenant.Cluster,
+			PubQpsLimit: tenant.PubQpsLimit,
+		}
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT TenantName,AppId FROM tenant_app")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	appTenants := make(map[string]string)
+	var app tenantAppRecord
+	for rows.Next() {
+		err = rows.Scan(&app.TenantName, &app.AppId)
+		if err != nil {
+			log.Error("mysql manager store: %v", err)
+			continue
+		}
+
+		if _, present := tenants[app.TenantName]; !present {
+			// disabled tenant: its apps fall back to default tenant
+			continue
+		}
+
+		appTenants[app.AppId] = app.TenantName
+	}
+
+	this.tenantMap = tenants
+	this.appTenantMap = appTenants
+	return nil
+}
+
+// fetchAppPriorities loads the apps classified for Pub admission control, the others are normal.
+func (this *mysqlStore) fetchAppPriorities(db *sql.DB) error {
+	rows, err := db.Query("SELECT AppId,Priority FROM app_priority")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	m := make(map[string]manager.Priority)
+	var app appPriorityRecord
+	for rows.Next() {
+		err = rows.Scan(&app.AppId, &app.Priority)
+		if err != nil {
+			log.Error("mysql manager store: %v", err)
+			continue
+		}
+
+		if !manager.ValidPriority(app.Priority) {
+			log.Warn("mysql manager store: app[%s] invalid priority %d", app.AppId, app.Priority)
+			continue
+		}
+
+		m[app.AppId] = manager.Priority(app.Priority)
+	}
+
+	this.appPriorityMap = m
+	return nil
+}
+
 func (this *mysqlStore) fetchSchemas(db *sql.DB) error {
 	rows, err := db.Query("SELECT AppId,TopicName,Ver,Schema FROM topic_schema")
 	if err != nil {
@@ -139,5 +139,79 @@ CREATE TABLE `topic_schema` (
   `Schema` text,
   `CreateTime` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
   `Status` tinyint(2) NOT NULL COMMENT '状态：1正常|-2废弃',
+  `SubJson` tinyint(2) NOT NULL DEFAULT '0' COMMENT 'Sub时avro解码为json：1允许|0禁止',
   PRIMARY KEY (`AppId`, `TopicName`, `Ver`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `topic_route` (
+  `AppId` bigint(20) NOT NULL,
+  `TopicName` varchar(64) NOT NULL COMMENT '虚拟主题名称',
+  `Ver` varchar(50) NOT NULL,
+  `Priority` int(11) NOT NULL DEFAULT '0' COMMENT '匹配顺序，小的优先',
+  `Header` varchar(64) NOT NULL DEFAULT '' COMMENT '按http header匹配',
+  `JsonPath` varchar(255) NOT NULL DEFAULT '' COMMENT '按消息json字段匹配',
+  `Value` varchar(255) NOT NULL DEFAULT '',
+  `TargetTopic` varchar(64) NOT NULL COMMENT '目标物理主题',
+  `TargetVer` varchar(50) NOT NULL,
+  `Status` tinyint(2) NOT NULL COMMENT '状态：1正常|-2废弃',
+  KEY `AppTopic` (`AppId`, `TopicName`, `Ver`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `topic_transform` (
+  `AppId` bigint(20) NOT NULL,
+  `TopicName` varchar(64) NOT NULL,
+  `Ver` varchar(50) NOT NULL,
+  `Priority` int(11) NOT NULL DEFAULT '0' COMMENT '执行顺序，小的优先',
+  `Name` varchar(64) NOT NULL COMMENT '注册的转换器名称，如mask',
+  `Params` varchar(1024) NOT NULL DEFAULT '' COMMENT '转换器参数',
+  `OnSub` tinyint(2) NOT NULL DEFAULT '0' COMMENT '1消费时转换|0发布时转换',
+  `Status` tinyint(2) NOT NULL COMMENT '状态：1正常|-2废弃',
+  KEY `AppTopic` (`AppId`, `TopicName`, `Ver`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `topic_dedup` (
+  `AppId` bigint(20) NOT NULL,
+  `TopicName` varchar(64) NOT NULL,
+  `Ver` varchar(50) NOT NULL,
+  `WindowSeconds` int(11) NOT NULL COMMENT '去重时间窗口，秒',
+  `Status` tinyint(2) NOT NULL COMMENT '状态：1正常|-2废弃',
+  PRIMARY KEY (`AppId`, `TopicName`, `Ver`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `tenant` (
+  `TenantName` varchar(64) NOT NULL COMMENT '租户名称',
+  `Cluster` varchar(64) NOT NULL DEFAULT '' COMMENT '专属kafka集群，空则使用应用自己的集群',
+  `PubQpsLimit` bigint(20) NOT NULL DEFAULT '0' COMMENT '单台kateway每分钟Pub配额，0不限',
+  `Status` tinyint(2) NOT NULL COMMENT '状态：1正常|-2废弃',
+  PRIMARY KEY (`TenantName`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `tenant_app` (
+  `TenantName` varchar(64) NOT NULL,
+  `AppId` bigint(20) NOT NULL,
+  PRIMARY KEY (`AppId`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `app_priority` (
+  `AppId` bigint(20) NOT NULL,
+  `Priority` tinyint(2) NOT NULL DEFAULT '1' COMMENT 'Pub降级时的优先级：0批量|1普通|2关键，低优先级先被限流',
+  PRIMARY KEY (`AppId`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `app_quota` (
+  `AppId` bigint(20) NOT NULL,
+  `PubMsgsLimit` bigint(20) NOT NULL DEFAULT '0' COMMENT '每秒Pub消息数，0不限',
+  `PubBytesLimit` bigint(20) NOT NULL DEFAULT '0' COMMENT '每秒Pub字节数，0不限',
+  `MaxTopics` int(11) NOT NULL DEFAULT '0' COMMENT '最大主题数，0不限',
+  PRIMARY KEY (`AppId`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `app_quota_audit` (
+  `AppId` bigint(20) NOT NULL,
+  `Item` varchar(32) NOT NULL COMMENT '配额项：msgs|bytes|topics',
+  `OldValue` bigint(20) NOT NULL,
+  `NewValue` bigint(20) NOT NULL,
+  `By` varchar(64) NOT NULL COMMENT '操作人',
+  `CreateTime` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  KEY `AppId` (`AppId`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -30,3 +30,35 @@ type topicSchemaRecord struct {
 	AppId, TopicName, Ver string
 	Schema                string
 }
+
+type topicTransformRecord struct {
+	AppId, TopicName, Ver string
+	Name, Params          string
+	OnSub                 int
+}
+
+type topicDedupRecord struct {
+	AppId, TopicName, Ver string
+	WindowSeconds         int
+}
+
+type tenantRecord struct {
+	TenantName, Cluster string
+	PubQpsLimit         int64
+}
+
+type tenantAppRecord struct {
+	TenantName, AppId string
+}
+
+type appPriorityRecord struct {
+	AppId    string
+	Priority int
+}
+
+type topicRouteRecord struct {
+	AppId, TopicName, Ver  string
+	Header, JsonPath       string
+	Value                  string
+	TargetTopic, TargetVer string
+}
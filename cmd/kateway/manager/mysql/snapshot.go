@@ -0,0 +1,98 @@
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+)
+
+// snapshot is the management data persisted locally after each successful refresh, so
+// that kateway can still start in degraded mode with the last known data if mysql is down.
+type snapshot struct {
+	SavedAt time.Time `json:"saved_at"`
+
+	AppCluster       map[string]string                       `json:"app_cluster"`
+	AppSecret        map[string]string                       `json:"app_secret"`
+	AppSub           map[string]map[string]struct{}          `json:"app_sub"`
+	AppTopics        map[string]map[string]bool              `json:"app_topics"`
+	AppConsumerGroup map[string]map[string]struct{}          `json:"app_groups"`
+	ShadowQueue      map[string]string                       `json:"shadows"`
+	DeadPartition    map[string]map[int32]struct{}           `json:"dead_partitions"`
+	TopicSchema      map[string]map[string]map[string]string `json:"schemas"`
+	RouteRule        map[string][]manager.RouteRule          `json:"routes"`
+	TransformRule    map[string][]manager.TransformRule      `json:"transforms"`
+	DedupWindow      map[string]time.Duration                `json:"dedup"`
+	SubJsonSchema    map[string]string                       `json:"sub_json"`
+	Tenant           map[string]*manager.Tenant              `json:"tenants"`
+	AppTenant        map[string]string                       `json:"app_tenant"`
+	AppPriority      map[string]manager.Priority             `json:"app_priority"`
+}
+
+func (this *mysqlStore) saveSnapshot() error {
+	b, err := json.Marshal(snapshot{
+		SavedAt:          time.Now(),
+		AppCluster:       this.appClusterMap,
+		AppSecret:        this.appSecretMap,
+		AppSub:           this.appSubMap,
+		AppTopics:        this.appTopicsMap,
+		AppConsumerGroup: this.appConsumerGroupMap,
+		ShadowQueue:      this.shadowQueueMap,
+		DeadPartition:    this.deadPartitionMap,
+		TopicSchema:      this.topicSchemaMap,
+		RouteRule:        this.routeRuleMap,
+		TransformRule:    this.transformRuleMap,
+		DedupWindow:      this.dedupWindowMap,
+		SubJsonSchema:    this.subJsonSchemaMap,
+		Tenant:           this.tenantMap,
+		AppTenant:        this.appTenantMap,
+		AppPriority:      this.appPriorityMap,
+	})
+	if err != nil {
+		return err
+	}
+
+	// app secrets inside
+	tmpFile := this.cf.SnapshotFile + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, this.cf.SnapshotFile)
+}
+
+func (this *mysqlStore) loadSnapshot() (savedAt time.Time, err error) {
+	b, err := ioutil.ReadFile(this.cf.SnapshotFile)
+	if err != nil {
+		return
+	}
+
+	var s snapshot
+	if err = json.Unmarshal(b, &s); err != nil {
+		return
+	}
+	if len(s.AppSecret) == 0 {
+		err = fmt.Errorf("empty snapshot: %s", this.cf.SnapshotFile)
+		return
+	}
+
+	this.appClusterMap = s.AppCluster
+	this.appSecretMap = s.AppSecret
+	this.appSubMap = s.AppSub
+	this.appTopicsMap = s.AppTopics
+	this.appConsumerGroupMap = s.AppConsumerGroup
+	this.shadowQueueMap = s.ShadowQueue
+	this.deadPartitionMap = s.DeadPartition
+	this.topicSchemaMap = s.TopicSchema
+	this.routeRuleMap = s.RouteRule
+	this.transformRuleMap = s.TransformRule
+	this.dedupWindowMap = s.DedupWindow
+	this.subJsonSchemaMap = s.SubJsonSchema
+	this.tenantMap = s.Tenant
+	this.appTenantMap = s.AppTenant
+	this.appPriorityMap = s.AppPriority
+	return s.SavedAt, nil
+}
@@ -0,0 +1,40 @@
+package mysql
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mansnapshot")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	cf := &config{SnapshotFile: filepath.Join(dir, "manager.snapshot")}
+	m := &mysqlStore{cf: cf}
+	_, err = m.loadSnapshot()
+	assert.NotEqual(t, nil, err)
+
+	m.appSecretMap = map[string]string{"app1": "secret"}
+	m.appClusterMap = map[string]string{"app1": "me"}
+	m.deadPartitionMap = map[string]map[int32]struct{}{"app1.foo.v1": {2: struct{}{}}}
+	m.dedupWindowMap = map[string]time.Duration{"app1.foo.v1": time.Minute}
+	m.tenantMap = map[string]*manager.Tenant{"t1": {Name: "t1", PubQpsLimit: 10}}
+	assert.Equal(t, nil, m.saveSnapshot())
+
+	m1 := &mysqlStore{cf: cf}
+	_, err = m1.loadSnapshot()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "secret", m1.appSecretMap["app1"])
+	assert.Equal(t, "me", m1.appClusterMap["app1"])
+	_, present := m1.deadPartitionMap["app1.foo.v1"][2]
+	assert.Equal(t, true, present)
+	assert.Equal(t, time.Minute, m1.dedupWindowMap["app1.foo.v1"])
+	assert.Equal(t, int64(10), m1.tenantMap["t1"].PubQpsLimit)
+}
@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/mpool"
@@ -83,6 +84,14 @@ func (this *mysqlStore) Dump() map[string]interface{} {
 	r["app_topic"] = this.appTopicsMap
 	r["groups"] = this.appConsumerGroupMap
 	r["shadows"] = this.shadowQueueMap
+	r["routes"] = this.routeRuleMap
+	r["transforms"] = this.transformRuleMap
+	r["dedup"] = this.dedupWindowMap
+	r["sub_json"] = this.subJsonSchemaMap
+	r["tenants"] = this.tenantMap
+	r["app_tenant"] = this.appTenantMap
+	r["app_priority"] = this.appPriorityMap
+	r["refreshed_at"] = this.RefreshedAt()
 	return r
 }
 
@@ -184,6 +193,10 @@ func (this *mysqlStore) AuthSub(appid, subkey, hisAppid, hisTopic, group string)
 		}
 	}
 
+	if !manager.SameTenant(this.appTenantMap, appid, hisAppid) {
+		return manager.ErrCrossTenant
+	}
+
 	if appid == hisAppid {
 		// sub my own topic is always authorized FIXME what if the topic is disabled?
 		return nil
@@ -199,16 +212,49 @@ func (this *mysqlStore) AuthSub(appid, subkey, hisAppid, hisTopic, group string)
 	return manager.ErrAuthorizationFail
 }
 
+func (this *mysqlStore) AuthRaw(appid, cluster string) error {
+	return manager.AuthRaw(this.tenantMap, this.appTenantMap, appid, cluster)
+}
+
 func (this *mysqlStore) LookupCluster(appid string) (string, bool) {
 	appid = this.dev2app(appid)
 
 	if cluster, present := this.appClusterMap[appid]; present {
+		if tenant, found := this.lookupTenant(appid); found && tenant.Cluster != "" {
+			// tenant has dedicated kafka cluster
+			return tenant.Cluster, true
+		}
+
 		return cluster, present
 	}
 
 	return "", false
 }
 
+func (this *mysqlStore) LookupTenant(appid string) (*manager.Tenant, bool) {
+	appid = this.dev2app(appid)
+
+	return this.lookupTenant(appid)
+}
+
+func (this *mysqlStore) lookupTenant(appid string) (*manager.Tenant, bool) {
+	if name, present := this.appTenantMap[appid]; present {
+		tenant, found := this.tenantMap[name]
+		return tenant, found
+	}
+
+	return nil, false
+}
+
+func (this *mysqlStore) AppPriority(appid string) manager.Priority {
+	appid = this.dev2app(appid)
+
+	if p, present := this.appPriorityMap[appid]; present {
+		return p
+	}
+	return manager.PriorityNormal
+}
+
 func (this *mysqlStore) IsShadowedTopic(hisAppid, topic, ver, myAppid, group string) bool {
 	if _, present := this.shadowQueueMap[this.shadowKey(hisAppid, topic, ver, myAppid)]; present {
 		return true
@@ -216,3 +262,19 @@ func (this *mysqlStore) IsShadowedTopic(hisAppid, topic, ver, myAppid, group str
 
 	return false
 }
+
+func (this *mysqlStore) RouteRules(appid, topic, ver string) []manager.RouteRule {
+	return this.routeRuleMap[this.routeKey(appid, topic, ver)]
+}
+
+func (this *mysqlStore) TransformRules(appid, topic, ver string) []manager.TransformRule {
+	return this.transformRuleMap[this.routeKey(appid, topic, ver)]
+}
+
+func (this *mysqlStore) DedupWindow(appid, topic, ver string) time.Duration {
+	return this.dedupWindowMap[this.routeKey(appid, topic, ver)]
+}
+
+func (this *mysqlStore) SubJsonSchema(appid, topic, ver string) string {
+	return this.subJsonSchemaMap[this.routeKey(appid, topic, ver)]
+}
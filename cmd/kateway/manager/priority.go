@@ -0,0 +1,25 @@
+package manager
+
+// Priority is the class of an app in Pub admission control: when the brokers degrade,
+// Pub of lower priority apps is shed first so that the critical ones keep going.
+type Priority int
+
+const (
+	PriorityBulk     Priority = iota // best effort, e,g. logs and tracking
+	PriorityNormal                   // apps not classified
+	PriorityCritical                 // never shed, e,g. orders and payments
+)
+
+var priorityNames = [...]string{"bulk", "normal", "critical"}
+
+func (this Priority) String() string {
+	if this < PriorityBulk || this > PriorityCritical {
+		return "unknown"
+	}
+	return priorityNames[this]
+}
+
+// ValidPriority checks if a priority value from the manager db is known.
+func ValidPriority(p int) bool {
+	return p >= int(PriorityBulk) && p <= int(PriorityCritical)
+}
@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RouteRule routes messages published to a virtual topic to a physical topic.
+//
+// A rule matches on either a http request header or a json field of the
+// message body, a rule with neither Header nor JsonPath is a catch-all rule.
+type RouteRule struct {
+	Header   string `json:"header,omitempty"`   // e.g. X-Region
+	JsonPath string `json:"jsonpath,omitempty"` // dot separated json field path, e.g. order.city
+	Value    string `json:"value"`
+
+	// the target topic must belong to the same appid as the virtual topic
+	Topic string `json:"topic"`
+	Ver   string `json:"ver"`
+}
+
+// Match checks if the rule applies to a message with given header and body.
+func (this *RouteRule) Match(header http.Header, body []byte) bool {
+	switch {
+	case this.Header != "":
+		return header.Get(this.Header) == this.Value
+
+	case this.JsonPath != "":
+		v, found := jsonPathValue(body, this.JsonPath)
+		return found && v == this.Value
+
+	default:
+		return true
+	}
+}
+
+// MatchRoute returns the 1st matched rule of the rules, rules are evaluated in order.
+func MatchRoute(rules []RouteRule, header http.Header, body []byte) (*RouteRule, bool) {
+	for i := range rules {
+		if rules[i].Match(header, body) {
+			return &rules[i], true
+		}
+	}
+
+	return nil, false
+}
+
+func jsonPathValue(body []byte, path string) (string, bool) {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "", false
+	}
+
+	for _, field := range strings.Split(strings.TrimPrefix(path, "$."), ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+
+		if v, ok = m[field]; !ok {
+			return "", false
+		}
+	}
+
+	switch t := v.(type) {
+	case string:
+		return t, true
+
+	case float64:
+		return fmt.Sprintf("%v", t), true
+
+	case bool:
+		return fmt.Sprintf("%v", t), true
+
+	default:
+		return "", false
+	}
+}
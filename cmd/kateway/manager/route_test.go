@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestRouteRuleMatch(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Region", "bj")
+	body := []byte(`{"order":{"city":"sh","amount":12}}`)
+
+	r := RouteRule{Header: "X-Region", Value: "bj"}
+	assert.Equal(t, true, r.Match(header, body))
+	r = RouteRule{Header: "X-Region", Value: "sh"}
+	assert.Equal(t, false, r.Match(header, body))
+
+	r = RouteRule{JsonPath: "order.city", Value: "sh"}
+	assert.Equal(t, true, r.Match(header, body))
+	r = RouteRule{JsonPath: "$.order.amount", Value: "12"}
+	assert.Equal(t, true, r.Match(header, body))
+	r = RouteRule{JsonPath: "order.city.name", Value: "sh"}
+	assert.Equal(t, false, r.Match(header, body))
+	r = RouteRule{JsonPath: "order.city", Value: "sh"}
+	assert.Equal(t, false, r.Match(header, []byte("not json")))
+
+	r = RouteRule{}
+	assert.Equal(t, true, r.Match(header, body))
+}
+
+func TestMatchRoute(t *testing.T) {
+	rules := []RouteRule{
+		{Header: "X-Region", Value: "bj", Topic: "order_bj", Ver: "v1"},
+		{JsonPath: "order.city", Value: "sh", Topic: "order_sh", Ver: "v1"},
+		{Topic: "order_other", Ver: "v1"},
+	}
+
+	header := http.Header{}
+	rule, found := MatchRoute(rules, header, []byte(`{"order":{"city":"sh"}}`))
+	assert.Equal(t, true, found)
+	assert.Equal(t, "order_sh", rule.Topic)
+
+	header.Set("X-Region", "bj")
+	rule, found = MatchRoute(rules, header, []byte(`{"order":{"city":"sh"}}`))
+	assert.Equal(t, true, found)
+	assert.Equal(t, "order_bj", rule.Topic)
+
+	_, found = MatchRoute(rules[:2], http.Header{}, []byte(`{}`))
+	assert.Equal(t, false, found)
+}
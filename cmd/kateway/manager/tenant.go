@@ -0,0 +1,35 @@
+package manager
+
+// Tenant is an isolated namespace above appid, e.g. an external business unit.
+//
+// Apps of a tenant are served by the tenant's dedicated kafka cluster and share
+// the tenant's quota pool. Apps not assigned to any tenant belong to the default
+// tenant, which is the shared pubsub platform as it was.
+type Tenant struct {
+	Name    string `json:"name"`
+	Cluster string `json:"cluster"` // dedicated kafka cluster, empty to use the app's own cluster
+
+	// PubQpsLimit is max Pub per minute of all apps of the tenant on a single kateway, 0 means unlimited.
+	PubQpsLimit int64 `json:"pub_qps"`
+}
+
+// AuthRaw is the tenant isolation of the raw endpoints shared by Manager implementations.
+func AuthRaw(tenants map[string]*Tenant, appTenants map[string]string, appid, cluster string) error {
+	if _, present := appTenants[appid]; present {
+		return ErrCrossTenant
+	}
+
+	for _, tenant := range tenants {
+		if tenant.Cluster == cluster {
+			return ErrCrossTenant
+		}
+	}
+
+	return nil
+}
+
+// SameTenant checks if 2 apps belong to the same tenant, apps of the default tenant
+// are regarded as the same tenant.
+func SameTenant(appTenants map[string]string, appid, hisAppid string) bool {
+	return appTenants[appid] == appTenants[hisAppid]
+}
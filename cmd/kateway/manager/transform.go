@@ -0,0 +1,10 @@
+package manager
+
+// TransformRule applies a registered message transform to a topic, e,g. PII masking.
+//
+// Rules of a topic are applied in order, the output of a rule is the input of the next.
+type TransformRule struct {
+	Name   string `json:"name"`             // registered transform name, e.g. mask
+	Params string `json:"params,omitempty"` // transform specific params, e.g. fields to mask
+	OnSub  bool   `json:"onsub,omitempty"`  // applied when consumed instead of when published
+}
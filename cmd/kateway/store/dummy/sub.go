@@ -47,3 +47,7 @@ func (this *subStore) Fetch(cluster, topic, group, remoteAddr, realIp,
 	reset string, permitStandby bool) (store.Fetcher, error) {
 	return this.fetcher, nil
 }
+
+func (this *subStore) FetchPartitions(cluster, topic string, offsets map[int32]int64) (store.Fetcher, error) {
+	return this.fetcher, nil
+}
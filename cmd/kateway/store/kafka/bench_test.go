@@ -16,8 +16,9 @@ func init() {
 }
 
 func BenchmarkPubPool(b *testing.B) {
-	s := NewPubStore(100, 0, false, false, true)
-	p := newPubPool(s, "me", []string{"localhost:9092"}, 100)
+	cf := PoolConfig{Producers: 100, Clients: 2, MetaRefresh: time.Minute}
+	s := NewPubStore(PoolConfigs{Default: cf}, 0, false, false, true)
+	p := newPubPool(s, "me", []string{"localhost:9092"}, cf)
 	for i := 0; i < b.N; i++ {
 		c, err := p.GetSyncProducer()
 		if err != nil {
@@ -0,0 +1,215 @@
+package kafka
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+	"github.com/funkygao/golib/set"
+	log "github.com/funkygao/log4go"
+)
+
+// PoolConfig tunes the kafka connections of a cluster.
+type PoolConfig struct {
+	Producers   int           // pooled producers of each ack kind
+	Clients     int           // sarama clients shared by the producers of each ack kind
+	MetaRefresh time.Duration // metadata refresh interval of each client
+}
+
+// PoolConfigs is the default PoolConfig with per cluster overrides, zero fields of an
+// override fall back to the default.
+type PoolConfigs struct {
+	Default  PoolConfig
+	Clusters map[string]PoolConfig
+}
+
+// Of returns the effective PoolConfig of a cluster.
+func (this PoolConfigs) Of(cluster string) PoolConfig {
+	cf := this.Default
+	o, present := this.Clusters[cluster]
+	if !present {
+		return cf
+	}
+
+	if o.Producers > 0 {
+		cf.Producers = o.Producers
+	}
+	if o.Clients > 0 {
+		cf.Clients = o.Clients
+	}
+	if o.MetaRefresh > 0 {
+		cf.MetaRefresh = o.MetaRefresh
+	}
+	return cf
+}
+
+// ParsePoolOverrides parses per cluster PoolConfig overrides, e,g.
+// me:producers=200,clients=4;big:meta=5m
+func ParsePoolOverrides(s string) (map[string]PoolConfig, error) {
+	r := make(map[string]PoolConfig)
+	for _, spec := range strings.Split(s, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		tuples := strings.SplitN(spec, ":", 2)
+		if len(tuples) != 2 || tuples[0] == "" {
+			return nil, fmt.Errorf("invalid pool override: %s", spec)
+		}
+
+		var cf PoolConfig
+		for _, kv := range strings.Split(tuples[1], ",") {
+			p := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+			if len(p) != 2 {
+				return nil, fmt.Errorf("invalid pool override: %s", spec)
+			}
+
+			var err error
+			switch p[0] {
+			case "producers":
+				cf.Producers, err = strconv.Atoi(p[1])
+				if err == nil && cf.Producers <= 0 {
+					err = fmt.Errorf("must be positive")
+				}
+
+			case "clients":
+				cf.Clients, err = strconv.Atoi(p[1])
+				if err == nil && cf.Clients <= 0 {
+					err = fmt.Errorf("must be positive")
+				}
+
+			case "meta":
+				cf.MetaRefresh, err = time.ParseDuration(p[1])
+				if err == nil && cf.MetaRefresh <= 0 {
+					err = fmt.Errorf("must be positive")
+				}
+
+			default:
+				err = fmt.Errorf("unknown key")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("pool override %s %s: %v", tuples[0], p[0], err)
+			}
+		}
+
+		r[tuples[0]] = cf
+	}
+
+	return r, nil
+}
+
+// clientPool is a fixed number of sarama clients of a cluster shared by producers, or by
+// partition fetchers of Sub.
+//
+// Each producer used to create its own sarama client, that is a conn to every broker
+// and a metadata refresher per producer. Producers from a shared client multiplex the
+// broker conns of the client, so the fds of a cluster are bounded by clients*brokers.
+type clientPool struct {
+	cluster string
+	config  func() *sarama.Config // all producers of a client share the config of client
+
+	mu         sync.Mutex
+	brokerList []string
+	clients    []sarama.Client // lazily connected
+	next       uint64
+	closed     bool
+}
+
+func newClientPool(cluster string, brokerList []string, size int, config func() *sarama.Config) *clientPool {
+	if size < 1 {
+		size = 1
+	}
+
+	return &clientPool{
+		cluster:    cluster,
+		brokerList: brokerList,
+		config:     config,
+		clients:    make([]sarama.Client, size),
+	}
+}
+
+// Get returns the next client round robin, (re)connecting it if necessary.
+func (this *clientPool) Get() (sarama.Client, error) {
+	i := int(atomic.AddUint64(&this.next, 1) % uint64(len(this.clients)))
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closed {
+		return nil, sarama.ErrClosedClient
+	}
+	if len(this.brokerList) == 0 {
+		return nil, store.ErrEmptyBrokers
+	}
+
+	if c := this.clients[i]; c != nil && !c.Closed() {
+		return c, nil
+	}
+
+	t1 := time.Now()
+	brokers := spreadBrokers(this.brokerList, i)
+	c, err := sarama.NewClient(brokers, this.config())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Trace("cluster[%s] kafka client[%d] connected: %+v %s", this.cluster, i, brokers, time.Since(t1))
+	this.clients[i] = c
+	return c, nil
+}
+
+// SetBrokerList changes the brokers that clients bootstrap from when (re)connected, empty
+// list is ignored. Connected clients are kept since they refresh the brokers from metadata,
+// and closing them would break all their users.
+func (this *clientPool) SetBrokerList(brokerList []string) {
+	if len(brokerList) == 0 {
+		return
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	setOld, setNew := set.NewSet(), set.NewSet()
+	for _, b := range this.brokerList {
+		setOld.Add(b)
+	}
+	for _, b := range brokerList {
+		setNew.Add(b)
+	}
+	if !setOld.Equal(setNew) {
+		log.Info("cluster[%s] kafka client pool broker list from %+v to %+v", this.cluster, this.brokerList, brokerList)
+		this.brokerList = brokerList
+	}
+}
+
+func (this *clientPool) Close() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.closed = true
+	for i, c := range this.clients {
+		if c != nil && !c.Closed() {
+			if err := c.Close(); err != nil {
+				log.Warn("cluster[%s] kafka client[%d] close: %v", this.cluster, i, err)
+			}
+		}
+		this.clients[i] = nil
+	}
+}
+
+// spreadBrokers rotates the broker list by i, so that clients bootstrap and fetch metadata
+// from different brokers instead of all hitting the 1st one.
+func spreadBrokers(brokerList []string, i int) []string {
+	n := len(brokerList)
+	r := make([]string, 0, n)
+	for j := 0; j < n; j++ {
+		r = append(r, brokerList[(i+j)%n])
+	}
+	return r
+}
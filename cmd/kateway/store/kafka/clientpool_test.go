@@ -0,0 +1,63 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+)
+
+func TestParsePoolOverrides(t *testing.T) {
+	r, err := ParsePoolOverrides("")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(r))
+
+	r, err = ParsePoolOverrides("me:producers=200,clients=4; big:meta=5m")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, PoolConfig{Producers: 200, Clients: 4}, r["me"])
+	assert.Equal(t, PoolConfig{MetaRefresh: time.Minute * 5}, r["big"])
+
+	for _, s := range []string{"me", ":clients=1", "me:clients", "me:clients=0", "me:foo=1", "me:meta=x"} {
+		_, err = ParsePoolOverrides(s)
+		assert.NotEqual(t, nil, err)
+	}
+}
+
+func TestPoolConfigsOf(t *testing.T) {
+	cf := PoolConfigs{
+		Default: PoolConfig{Producers: 100, Clients: 2, MetaRefresh: time.Minute},
+		Clusters: map[string]PoolConfig{
+			"big": {Clients: 8},
+		},
+	}
+	assert.Equal(t, cf.Default, cf.Of("me"))
+	assert.Equal(t, PoolConfig{Producers: 100, Clients: 8, MetaRefresh: time.Minute}, cf.Of("big"))
+}
+
+func TestSpreadBrokers(t *testing.T) {
+	brokers := []string{"b1", "b2", "b3"}
+	assert.Equal(t, []string{"b1", "b2", "b3"}, spreadBrokers(brokers, 0))
+	assert.Equal(t, []string{"b2", "b3", "b1"}, spreadBrokers(brokers, 1))
+	assert.Equal(t, []string{"b1", "b2", "b3"}, spreadBrokers(brokers, 3))
+}
+
+func TestClientPoolSetBrokerList(t *testing.T) {
+	p := newClientPool("me", nil, 2, nil)
+	_, err := p.Get()
+	assert.Equal(t, store.ErrEmptyBrokers, err)
+
+	p.SetBrokerList(nil)
+	assert.Equal(t, 0, len(p.brokerList))
+	p.SetBrokerList([]string{"b1", "b2"})
+	assert.Equal(t, []string{"b1", "b2"}, p.brokerList)
+	p.SetBrokerList([]string{"b2", "b1"}) // same brokers
+	assert.Equal(t, []string{"b1", "b2"}, p.brokerList)
+	p.SetBrokerList([]string{"b3"})
+	assert.Equal(t, []string{"b3"}, p.brokerList)
+
+	p.Close()
+	_, err = p.Get()
+	assert.Equal(t, sarama.ErrClosedClient, err)
+}
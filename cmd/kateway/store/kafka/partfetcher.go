@@ -0,0 +1,152 @@
+package kafka
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/cmd/kateway/meta"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+	log "github.com/funkygao/log4go"
+)
+
+// partitionFetcher consumes an explicit set of partitions of a topic outside of any
+// consumer group, for clients doing their own partition assignment and offset management.
+type partitionFetcher struct {
+	consumer   sarama.Consumer
+	partitions []sarama.PartitionConsumer
+
+	messages chan *sarama.ConsumerMessage
+	errors   chan *sarama.ConsumerError
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+}
+
+func (this *partitionFetcher) Messages() <-chan *sarama.ConsumerMessage {
+	return this.messages
+}
+
+func (this *partitionFetcher) Errors() <-chan *sarama.ConsumerError {
+	return this.errors
+}
+
+// CommitUpto is a no-op: offsets are managed by the client.
+func (this *partitionFetcher) CommitUpto(*sarama.ConsumerMessage) error {
+	return nil
+}
+
+func (this *partitionFetcher) Close() (err error) {
+	this.closeOnce.Do(func() {
+		close(this.closeCh)
+		for _, pc := range this.partitions {
+			pc.AsyncClose()
+		}
+		this.wg.Wait()
+
+		err = this.consumer.Close()
+	})
+	return
+}
+
+// pipe fans in a partition consumer until it is closed.
+func (this *partitionFetcher) pipe(pc sarama.PartitionConsumer) {
+	defer this.wg.Done()
+
+	msgs, errs := pc.Messages(), pc.Errors()
+	for msgs != nil || errs != nil {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				msgs = nil
+				continue
+			}
+
+			select {
+			case this.messages <- msg:
+			case <-this.closeCh:
+			}
+
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			select {
+			case this.errors <- err:
+			case <-this.closeCh:
+			}
+		}
+	}
+}
+
+// partitionClientOf returns the shared sarama client of a cluster for partition fetchers,
+// which (re)connects to the latest broker list of meta.
+func (this *subStore) partitionClientOf(cluster string) (sarama.Client, error) {
+	brokerList := meta.Default.BrokerList(cluster)
+
+	this.partitionClientsLock.Lock()
+	pool, present := this.partitionClients[cluster]
+	if !present {
+		pool = newClientPool(cluster, brokerList, 1, partitionFetcherConfig)
+		this.partitionClients[cluster] = pool
+	}
+	this.partitionClientsLock.Unlock()
+
+	pool.SetBrokerList(brokerList)
+	return pool.Get()
+}
+
+func partitionFetcherConfig() *sarama.Config {
+	cf := sarama.NewConfig()
+	cf.Net.DialTimeout = time.Second * 10
+	cf.Net.WriteTimeout = time.Second * 10
+	cf.Net.ReadTimeout = time.Second * 10
+	cf.ChannelBufferSize = 0
+	cf.Consumer.Return.Errors = true
+	cf.Consumer.MaxProcessingTime = time.Second * 2
+	return cf
+}
+
+func (this *subStore) FetchPartitions(cluster, topic string, offsets map[int32]int64) (store.Fetcher, error) {
+	if len(meta.Default.TopicPartitions(cluster, topic)) == 0 {
+		return nil, store.ErrInvalidTopic
+	}
+
+	client, err := this.partitionClientOf(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &partitionFetcher{
+		consumer: consumer,
+		messages: make(chan *sarama.ConsumerMessage),
+		errors:   make(chan *sarama.ConsumerError, len(offsets)),
+		closeCh:  make(chan struct{}),
+	}
+	for partition, offset := range offsets {
+		pc, err := consumer.ConsumePartition(topic, partition, offset)
+		if err == sarama.ErrOffsetOutOfRange {
+			// e,g. the committed offset has been deleted by retention
+			log.Warn("cluster[%s] %s#%d offset %d out of range, reset to oldest", cluster, topic, partition, offset)
+			pc, err = consumer.ConsumePartition(topic, partition, sarama.OffsetOldest)
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		f.partitions = append(f.partitions, pc)
+		f.wg.Add(1)
+		go f.pipe(pc)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,273 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// prefetcher keeps pulling messages of a consumer group into per partition in-memory
+// cache, so that the next long polling Sub of a steady consumer is served from memory
+// without waiting for a broker fetch round trip.
+//
+// Cached messages are never committed before being delivered, so dropping the cache of a
+// partition is safe once its fetch restarts from the last committed offset, which is what
+// the consumer group does on rebalance for each partition it claims, whoever the owner is.
+//
+// On rebalance, only partitions whose fetch already restarted are served. When it completes,
+// the partitions not refetched are dropped: they are rebalanced away, or will be refetched.
+type prefetcher struct {
+	source   <-chan *sarama.ConsumerMessage
+	capacity int // max cached messages per partition
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	cache      map[int32][]*sarama.ConsumerMessage
+	partitions []int32 // partitions with cached messages, in round robin order
+	next       int
+	closed     bool
+
+	lastOffsets map[int32]int64 // last offset put of each partition
+	refetched   map[int32]bool  // partitions whose fetch restarted since last rebalance
+	rebalancing bool
+	generation  int // bumped on each rebalance completion
+
+	messages chan *sarama.ConsumerMessage
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newPrefetcher(source <-chan *sarama.ConsumerMessage, capacity int) *prefetcher {
+	this := &prefetcher{
+		source:      source,
+		capacity:    capacity,
+		cache:       make(map[int32][]*sarama.ConsumerMessage),
+		lastOffsets: make(map[int32]int64),
+		refetched:   make(map[int32]bool),
+		messages:    make(chan *sarama.ConsumerMessage),
+		quit:        make(chan struct{}),
+	}
+	this.cond = sync.NewCond(&this.mu)
+
+	this.wg.Add(2)
+	go this.fill()
+	go this.dispatch()
+	return this
+}
+
+func (this *prefetcher) Messages() <-chan *sarama.ConsumerMessage {
+	return this.messages
+}
+
+// fill pulls messages from the consumer group into cache.
+func (this *prefetcher) fill() {
+	defer this.wg.Done()
+
+	for {
+		select {
+		case <-this.quit:
+			return
+
+		case msg, ok := <-this.source:
+			if !ok {
+				this.Close()
+				return
+			}
+
+			this.put(msg)
+		}
+	}
+}
+
+func (this *prefetcher) put(msg *sarama.ConsumerMessage) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if last, present := this.lastOffsets[msg.Partition]; present && msg.Offset <= last {
+		// fetch restarted from the committed offset, e,g. the partition is claimed again
+		// after rebalance: the cached messages from the offset on are being refetched
+		this.dropFrom(msg.Partition, msg.Offset)
+		this.refetched[msg.Partition] = true
+	}
+	this.lastOffsets[msg.Partition] = msg.Offset
+
+	generation := this.generation
+	for len(this.cache[msg.Partition]) >= this.capacity && !this.closed {
+		this.cond.Wait()
+	}
+	if this.closed {
+		return
+	}
+	if generation != this.generation && !this.refetched[msg.Partition] {
+		// the cache of the partition was dropped on rebalance while we were waiting
+		return
+	}
+
+	if len(this.cache[msg.Partition]) == 0 {
+		this.partitions = append(this.partitions, msg.Partition)
+	}
+	this.cache[msg.Partition] = append(this.cache[msg.Partition], msg)
+	this.cond.Broadcast()
+}
+
+// dispatch feeds cached messages to the consumer round robin across partitions.
+func (this *prefetcher) dispatch() {
+	defer this.wg.Done()
+	defer close(this.messages)
+
+	for {
+		msg := this.take()
+		if msg == nil {
+			// closed
+			return
+		}
+
+		// if the partition is invalidated while we are blocking here, the message might
+		// be delivered to a consumer that no longer owns the partition: a duplicate at worst
+		select {
+		case this.messages <- msg:
+		case <-this.quit:
+			return
+		}
+	}
+}
+
+func (this *prefetcher) take() *sarama.ConsumerMessage {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	var partition int32
+	for {
+		if this.closed {
+			return nil
+		}
+
+		var ok bool
+		if partition, ok = this.pick(); ok {
+			break
+		}
+		this.cond.Wait()
+	}
+
+	queue := this.cache[partition]
+	msg := queue[0]
+	queue[0] = nil // help GC
+	if len(queue) == 1 {
+		this.removePartition(partition)
+	} else {
+		this.cache[partition] = queue[1:]
+		this.next++
+	}
+
+	this.cond.Broadcast()
+	return msg
+}
+
+// pick returns the next partition to serve round robin, skipping partitions not refetched
+// yet during rebalance.
+func (this *prefetcher) pick() (int32, bool) {
+	for i := 0; i < len(this.partitions); i++ {
+		if this.next >= len(this.partitions) {
+			this.next = 0
+		}
+
+		partition := this.partitions[this.next]
+		if !this.rebalancing || this.refetched[partition] {
+			return partition, true
+		}
+		this.next++
+	}
+
+	return 0, false
+}
+
+// invalidate drops cached messages of a partition, e,g. after it is rebalanced away.
+func (this *prefetcher) invalidate(partition int32) {
+	this.mu.Lock()
+	delete(this.lastOffsets, partition)
+	if _, present := this.cache[partition]; present {
+		this.removePartition(partition)
+		this.cond.Broadcast()
+	}
+	this.mu.Unlock()
+}
+
+// rebalance is called when the consumer group starts to rebalance: the partitions might
+// be rebalanced away, stop serving them from cache until their fetch restarts.
+func (this *prefetcher) rebalance() {
+	this.mu.Lock()
+	this.rebalancing = true
+	this.mu.Unlock()
+}
+
+// rebalanced is called when the consumer group finishes rebalance, cached partitions whose
+// fetch has not restarted are dropped.
+func (this *prefetcher) rebalanced() {
+	this.mu.Lock()
+	for partition := range this.lastOffsets {
+		if !this.refetched[partition] {
+			delete(this.lastOffsets, partition)
+			if _, present := this.cache[partition]; present {
+				this.removePartition(partition)
+			}
+		}
+	}
+
+	this.refetched = make(map[int32]bool)
+	this.rebalancing = false
+	this.generation++
+	this.cond.Broadcast()
+	this.mu.Unlock()
+}
+
+// dropFrom drops cached messages of a partition from the offset on.
+func (this *prefetcher) dropFrom(partition int32, offset int64) {
+	queue := this.cache[partition]
+	for i, msg := range queue {
+		if msg.Offset >= offset {
+			for j := i; j < len(queue); j++ {
+				queue[j] = nil // help GC
+			}
+			if i == 0 {
+				this.removePartition(partition)
+			} else {
+				this.cache[partition] = queue[:i]
+			}
+			this.cond.Broadcast()
+			return
+		}
+	}
+}
+
+func (this *prefetcher) removePartition(partition int32) {
+	delete(this.cache, partition)
+	for i, p := range this.partitions {
+		if p == partition {
+			this.partitions = append(this.partitions[:i], this.partitions[i+1:]...)
+			if this.next > i {
+				this.next--
+			}
+			return
+		}
+	}
+}
+
+// Close stops prefetching and drops all cached messages.
+func (this *prefetcher) Close() {
+	this.mu.Lock()
+	if this.closed {
+		this.mu.Unlock()
+		return
+	}
+
+	this.closed = true
+	this.cache = nil
+	this.partitions = nil
+	close(this.quit)
+	this.cond.Broadcast()
+	this.mu.Unlock()
+}
+
+func (this *prefetcher) wait() {
+	this.wg.Wait()
+}
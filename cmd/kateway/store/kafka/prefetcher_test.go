@@ -0,0 +1,108 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/assert"
+)
+
+func TestPrefetcherRoundRobin(t *testing.T) {
+	source := make(chan *sarama.ConsumerMessage, 10)
+	for i := 0; i < 3; i++ {
+		source <- &sarama.ConsumerMessage{Partition: 0, Offset: int64(i)}
+	}
+	source <- &sarama.ConsumerMessage{Partition: 1, Offset: 0}
+
+	pf := newPrefetcher(source, 10)
+	defer pf.Close()
+
+	// wait for the cache filled
+	for len(source) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(time.Millisecond * 10)
+
+	var got []int32
+	for i := 0; i < 4; i++ {
+		got = append(got, (<-pf.Messages()).Partition)
+	}
+	assert.Equal(t, []int32{0, 1, 0, 0}, got)
+}
+
+func TestPrefetcherInvalidate(t *testing.T) {
+	source := make(chan *sarama.ConsumerMessage, 10)
+	pf := newPrefetcher(source, 2)
+	defer pf.Close()
+
+	// partition 0 cache is full: 1 taken by dispatcher, 2 cached, 1 blocking put
+	for i := 0; i < 4; i++ {
+		source <- &sarama.ConsumerMessage{Partition: 0, Offset: int64(i)}
+	}
+	for len(source) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(time.Millisecond * 10)
+
+	pf.invalidate(0)
+
+	// the message held by dispatcher and the blocked one survive
+	assert.Equal(t, int64(0), (<-pf.Messages()).Offset)
+	assert.Equal(t, int64(3), (<-pf.Messages()).Offset)
+}
+
+func TestPrefetcherClose(t *testing.T) {
+	source := make(chan *sarama.ConsumerMessage)
+	pf := newPrefetcher(source, 2)
+	close(source)
+	pf.wait()
+
+	_, ok := <-pf.Messages()
+	assert.Equal(t, false, ok)
+}
+
+func TestPrefetcherRebalance(t *testing.T) {
+	source := make(chan *sarama.ConsumerMessage, 10)
+	pf := newPrefetcher(source, 10)
+	defer pf.Close()
+
+	// the dispatcher holds partition 0 offset 0, partition 1 offset 0/1 and partition 0 offset 1 cached
+	source <- &sarama.ConsumerMessage{Partition: 0, Offset: 0}
+	for len(source) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(time.Millisecond * 10)
+	for _, m := range []*sarama.ConsumerMessage{{Partition: 1, Offset: 0}, {Partition: 1, Offset: 1}, {Partition: 0, Offset: 1}} {
+		source <- m
+	}
+	for len(source) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(time.Millisecond * 10)
+
+	pf.rebalance()
+	assert.Equal(t, int64(0), (<-pf.Messages()).Offset) // held before rebalance
+
+	// partition 1 claimed again and refetched from committed offset 1: served during rebalance
+	source <- &sarama.ConsumerMessage{Partition: 1, Offset: 1}
+	msg := <-pf.Messages()
+	assert.Equal(t, int32(1), msg.Partition)
+	assert.Equal(t, int64(0), msg.Offset)
+	msg = <-pf.Messages()
+	assert.Equal(t, int32(1), msg.Partition)
+	assert.Equal(t, int64(1), msg.Offset)
+
+	// partition 0 is rebalanced away: never served
+	select {
+	case msg = <-pf.Messages():
+		t.Fatalf("unexpected %d/%d during rebalance", msg.Partition, msg.Offset)
+	case <-time.After(time.Millisecond * 20):
+	}
+
+	pf.rebalanced()
+	source <- &sarama.ConsumerMessage{Partition: 1, Offset: 2}
+	msg = <-pf.Messages()
+	assert.Equal(t, int32(1), msg.Partition)
+	assert.Equal(t, int64(2), msg.Offset)
+}
@@ -23,7 +23,7 @@ func (this *syncProducerClient) Id() uint64 {
 func (this *syncProducerClient) Close() {
 	log.Trace("cluster[%s] closing kafka sync client: %d", this.cluster, this.id)
 
-	// will close the producer and the kafka tcp conn
+	// the kafka tcp conns are owned by the shared client
 	this.SyncProducer.Close()
 	this.closed = true
 }
@@ -49,11 +49,14 @@ type asyncProducerClient struct {
 	sarama.AsyncProducer
 }
 
+// Close flushes the buffered messages before return, so that the shared client can be
+// closed right after.
 func (this *asyncProducerClient) Close() {
 	log.Trace("cluster[%s] closing kafka async client: %d", this.cluster, this.id)
 
-	// will flush any buffered message
-	this.AsyncProducer.AsyncClose()
+	if err := this.AsyncProducer.Close(); err != nil {
+		log.Error("cluster[%s] kafka async client[%d] close: %v", this.cluster, this.id, err)
+	}
 }
 
 func (this *asyncProducerClient) Id() uint64 {
@@ -6,39 +6,17 @@ import (
 	"time"
 
 	"github.com/Shopify/sarama"
-	"github.com/funkygao/gafka/cmd/kateway/store"
 	pool "github.com/funkygao/golib/vitesspool"
 	log "github.com/funkygao/log4go"
 )
 
-func (this *pubPool) newSyncProducer(requiredAcks sarama.RequiredAcks) (pool.Resource, error) {
-	if len(this.brokerList) == 0 {
-		return nil, store.ErrEmptyBrokers
-	}
-
-	spc := &syncProducerClient{
-		cluster: this.cluster,
-		id:      atomic.AddUint64(&this.nextId, 1),
-	}
-	switch requiredAcks {
-	case sarama.WaitForAll:
-		spc.rp = this.syncAllPool
-
-	case sarama.WaitForLocal:
-		spc.rp = this.syncPool
-
-	default:
-		return nil, errors.New("illegal ack type")
-	}
-
-	var err error
-	t1 := time.Now()
+func (this *pubPool) syncConfig(requiredAcks sarama.RequiredAcks) *sarama.Config {
 	cf := sarama.NewConfig()
 	cf.Net.DialTimeout = time.Second * 4
 	cf.Net.ReadTimeout = time.Second * 4
 	cf.Net.WriteTimeout = time.Second * 4
 
-	cf.Metadata.RefreshFrequency = time.Minute * 10
+	cf.Metadata.RefreshFrequency = this.cf.MetaRefresh
 	cf.Metadata.Retry.Max = 3
 	cf.Metadata.Retry.Backoff = time.Millisecond * 10
 
@@ -60,15 +38,68 @@ func (this *pubPool) newSyncProducer(requiredAcks sarama.RequiredAcks) (pool.Res
 	cf.ClientID = this.store.hostname
 
 	cf.ChannelBufferSize = 256 // TODO
+	return cf
+}
+
+func (this *pubPool) asyncConfig() *sarama.Config {
+	cf := sarama.NewConfig()
+	cf.Net.DialTimeout = time.Second * 4
+	cf.Net.ReadTimeout = time.Second * 4
+	cf.Net.WriteTimeout = time.Second * 4
+
+	cf.Metadata.RefreshFrequency = this.cf.MetaRefresh
+	cf.Metadata.Retry.Max = 3
+	cf.Metadata.Retry.Backoff = time.Millisecond * 10
+
+	cf.Producer.Flush.Frequency = time.Second * 10 // TODO
+	cf.Producer.Flush.Messages = 1000
+	cf.Producer.Flush.MaxMessages = 0 // unlimited
+
+	cf.Producer.RequiredAcks = sarama.NoResponse
+	cf.Producer.Partitioner = NewExclusivePartitioner
+	cf.Producer.Retry.Backoff = time.Millisecond * 10 // gk migrate will trigger this backoff
+	cf.Producer.Retry.Max = 3
+	if this.store.compress {
+		cf.Producer.Compression = sarama.CompressionSnappy
+	}
+
+	cf.ClientID = this.store.hostname
+	return cf
+}
+
+func (this *pubPool) newSyncProducer(requiredAcks sarama.RequiredAcks) (pool.Resource, error) {
+	spc := &syncProducerClient{
+		cluster: this.cluster,
+		id:      atomic.AddUint64(&this.nextId, 1),
+	}
+	var clients *clientPool
+	switch requiredAcks {
+	case sarama.WaitForAll:
+		spc.rp = this.syncAllPool
+		clients = this.syncAllClients
+
+	case sarama.WaitForLocal:
+		spc.rp = this.syncPool
+		clients = this.syncClients
 
-	// will fetch meta from broker list
-	spc.SyncProducer, err = sarama.NewSyncProducer(this.brokerList, cf)
+	default:
+		return nil, errors.New("illegal ack type")
+	}
+
+	t1 := time.Now()
+	client, err := clients.Get()
 	if err != nil {
 		return nil, err
 	}
 
-	log.Trace("cluster[%s] kafka sync producer ack:%+v connected[%d]: %+v %s",
-		this.cluster, requiredAcks, spc.id, this.brokerList, time.Since(t1))
+	// producer shares the conns and meta of the client
+	spc.SyncProducer, err = sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Trace("cluster[%s] kafka sync producer ack:%+v created[%d]: %s",
+		this.cluster, requiredAcks, spc.id, time.Since(t1))
 
 	return spc, err
 }
@@ -82,48 +113,25 @@ func (this *pubPool) syncProducerFactory() (pool.Resource, error) {
 }
 
 func (this *pubPool) asyncProducerFactory() (pool.Resource, error) {
-	if len(this.brokerList) == 0 {
-		return nil, store.ErrEmptyBrokers
-	}
-
 	apc := &asyncProducerClient{
 		rp:      this.asyncPool,
 		cluster: this.cluster,
 		id:      atomic.AddUint64(&this.nextId, 1),
 	}
 
-	var err error
 	t1 := time.Now()
-	cf := sarama.NewConfig()
-	cf.Net.DialTimeout = time.Second * 4
-	cf.Net.ReadTimeout = time.Second * 4
-	cf.Net.WriteTimeout = time.Second * 4
-
-	cf.Metadata.RefreshFrequency = time.Minute * 10
-	cf.Metadata.Retry.Max = 3
-	cf.Metadata.Retry.Backoff = time.Millisecond * 10
-
-	cf.Producer.Flush.Frequency = time.Second * 10 // TODO
-	cf.Producer.Flush.Messages = 1000
-	cf.Producer.Flush.MaxMessages = 0 // unlimited
-
-	cf.Producer.RequiredAcks = sarama.NoResponse
-	cf.Producer.Partitioner = NewExclusivePartitioner
-	cf.Producer.Retry.Backoff = time.Millisecond * 10 // gk migrate will trigger this backoff
-	cf.Producer.Retry.Max = 3
-	if this.store.compress {
-		cf.Producer.Compression = sarama.CompressionSnappy
+	client, err := this.asyncClients.Get()
+	if err != nil {
+		return nil, err
 	}
 
-	cf.ClientID = this.store.hostname
-
-	apc.AsyncProducer, err = sarama.NewAsyncProducer(this.brokerList, cf)
+	apc.AsyncProducer, err = sarama.NewAsyncProducerFromClient(client)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Trace("cluster[%s] kafka async producer connected[%d]: %+v %s",
-		this.cluster, apc.id, this.brokerList, time.Since(t1))
+	log.Trace("cluster[%s] kafka async producer created[%d]: %s",
+		this.cluster, apc.id, time.Since(t1))
 
 	// TODO
 	go func() {
@@ -3,6 +3,7 @@ package kafka
 import (
 	"time"
 
+	"github.com/Shopify/sarama"
 	"github.com/funkygao/golib/breaker"
 	"github.com/funkygao/golib/set"
 	pool "github.com/funkygao/golib/vitesspool"
@@ -14,22 +15,25 @@ type pubPool struct {
 	store *pubStore
 
 	cluster    string
-	size       int
+	cf         PoolConfig
 	nextId     uint64
 	brokerList []string
 
 	breaker *breaker.Consecutive
 
+	// producers of the same ack kind share clients of the kind
+	syncClients, syncAllClients, asyncClients *clientPool
+
 	syncPool    *pool.ResourcePool
 	syncAllPool *pool.ResourcePool
 	asyncPool   *pool.ResourcePool
 }
 
-func newPubPool(store *pubStore, cluster string, brokerList []string, size int) *pubPool {
+func newPubPool(store *pubStore, cluster string, brokerList []string, cf PoolConfig) *pubPool {
 	this := &pubPool{
 		store:      store,
 		cluster:    cluster,
-		size:       size,
+		cf:         cf,
 		brokerList: brokerList,
 		breaker: &breaker.Consecutive{
 			FailureAllowance: 5,
@@ -42,13 +46,33 @@ func newPubPool(store *pubStore, cluster string, brokerList []string, size int)
 }
 
 func (this *pubPool) buildPools() {
+	this.syncClients = newClientPool(this.cluster, this.brokerList, this.cf.Clients,
+		func() *sarama.Config { return this.syncConfig(sarama.WaitForLocal) })
+	this.syncAllClients = newClientPool(this.cluster, this.brokerList, this.cf.Clients,
+		func() *sarama.Config { return this.syncConfig(sarama.WaitForAll) })
+	this.asyncClients = newClientPool(this.cluster, this.brokerList, this.cf.Clients,
+		this.asyncConfig)
+
 	// idleTimeout=0 means each kafka conn will last forever
 	this.syncPool = pool.NewResourcePool(this.syncProducerFactory,
-		this.size, this.size, 0)
+		this.cf.Producers, this.cf.Producers, 0)
 	this.syncAllPool = pool.NewResourcePool(this.syncAllProducerFactory,
 		30, 30, 0) // should be enough TODO
 	this.asyncPool = pool.NewResourcePool(this.asyncProducerFactory,
-		this.size, this.size, 0)
+		this.cf.Producers, this.cf.Producers, 0)
+}
+
+// Reconfigure rebuilds the conn pools if the config changes.
+func (this *pubPool) Reconfigure(cf PoolConfig) {
+	if cf == this.cf {
+		return
+	}
+
+	log.Info("%s pool config from %+v to %+v", this.cluster, this.cf, cf)
+
+	this.cf = cf
+	this.Close()
+	this.buildPools()
 }
 
 // TODO from live meta or zk?
@@ -87,6 +111,11 @@ func (this *pubPool) Close() {
 
 	this.asyncPool.Close()
 	this.asyncPool = nil
+
+	// producers are closed and async ones flushed before their clients
+	this.syncClients.Close()
+	this.syncAllClients.Close()
+	this.asyncClients.Close()
 }
 
 func (this *pubPool) GetSyncAllProducer() (*syncProducerClient, error) {
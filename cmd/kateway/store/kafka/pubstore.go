@@ -24,30 +24,30 @@ type pubStore struct {
 	dryRun   bool
 	compress bool
 
-	pubPools        map[string]*pubPool // key is cluster, each cluster maintains a conn pool
-	pubPoolsCapcity int
-	pubPoolsLock    sync.RWMutex
-	idleTimeout     time.Duration
+	pubPools     map[string]*pubPool // key is cluster, each cluster maintains a conn pool
+	poolConfigs  PoolConfigs
+	pubPoolsLock sync.RWMutex
+	idleTimeout  time.Duration
 
 	// to avoid too frequent refresh
 	// TODO refresh by cluster: current implementation will refresh zone
 	lastRefreshedAt time.Time
 }
 
-func NewPubStore(poolCapcity int, idleTimeout time.Duration, compress bool,
+func NewPubStore(poolConfigs PoolConfigs, idleTimeout time.Duration, compress bool,
 	debug bool, dryRun bool) *pubStore {
 	if debug {
 		sarama.Logger = l.New(os.Stdout, color.Green("[Sarama]"), l.LstdFlags|l.Lshortfile)
 	}
 
 	return &pubStore{
-		hostname:        ctx.Hostname(),
-		compress:        compress,
-		idleTimeout:     idleTimeout,
-		pubPoolsCapcity: poolCapcity,
-		pubPools:        make(map[string]*pubPool),
-		dryRun:          dryRun,
-		shutdownCh:      make(chan struct{}),
+		hostname:    ctx.Hostname(),
+		compress:    compress,
+		idleTimeout: idleTimeout,
+		poolConfigs: poolConfigs,
+		pubPools:    make(map[string]*pubPool),
+		dryRun:      dryRun,
+		shutdownCh:  make(chan struct{}),
 	}
 }
 
@@ -66,7 +66,7 @@ func (this *pubStore) Start() (err error) {
 	// warmup: create pools according the current kafka topology
 	for _, cluster := range meta.Default.ClusterNames() {
 		this.pubPools[cluster] = newPubPool(this, cluster,
-			meta.Default.BrokerList(cluster), this.pubPoolsCapcity)
+			meta.Default.BrokerList(cluster), this.poolConfigs.Of(cluster))
 	}
 
 	this.wg.Add(1)
@@ -117,7 +117,7 @@ func (this *pubStore) doRefresh() {
 		if _, present := this.pubPools[cluster]; !present {
 			// found a new cluster
 			this.pubPools[cluster] = newPubPool(this, cluster,
-				meta.Default.BrokerList(cluster), this.pubPoolsCapcity)
+				meta.Default.BrokerList(cluster), this.poolConfigs.Of(cluster))
 		} else {
 			this.pubPools[cluster].RefreshBrokerList(meta.Default.BrokerList(cluster))
 		}
@@ -135,6 +135,17 @@ func (this *pubStore) doRefresh() {
 	this.lastRefreshedAt = time.Now()
 }
 
+// Reconfigure applies new pool configs, the conn pools of changed clusters are rebuilt.
+func (this *pubStore) Reconfigure(poolConfigs PoolConfigs) {
+	this.pubPoolsLock.Lock()
+	defer this.pubPoolsLock.Unlock()
+
+	this.poolConfigs = poolConfigs
+	for cluster, pool := range this.pubPools {
+		pool.Reconfigure(poolConfigs.Of(cluster))
+	}
+}
+
 func (this *pubStore) markPartitionsDead(topic string, deadPartitionIds map[int32]struct{}) {
 	excludedPartitionsLock.Lock()
 	if deadPartitionIds == nil {
@@ -0,0 +1,181 @@
+package kafka
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/meta"
+	"github.com/funkygao/gafka/zk"
+	log "github.com/funkygao/log4go"
+)
+
+// sessionIdleTTL is how long an idle partition stays in the checkpoint: kafka-cg commits
+// offsets every minute and on close, so after that the checkpoint brings nothing new.
+const sessionIdleTTL = time.Minute * 10
+
+// SubCheckpoint is the acked position of a partition consumed by a Sub session.
+type SubCheckpoint struct {
+	Cluster   string `json:"cluster"`
+	Topic     string `json:"topic"`
+	Group     string `json:"group"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"` // next offset to consume
+}
+
+type sessionKey struct {
+	cluster, topic, group string
+	partition             int32
+}
+
+type sessionOffset struct {
+	offset int64
+	mtime  time.Time
+}
+
+// subSessions checkpoints the acked offsets of all Sub sessions of a kateway to zk much
+// more frequently than kafka-cg commits, so that after a crash the standby partner can
+// move the group offsets forward before the group rebalances, avoiding the redelivery
+// of everything acked since the last offset commit.
+//
+// Inflight messages that are not acked yet are not checkpointed and will be redelivered.
+type subSessions struct {
+	id       string // kateway id
+	zkzone   *zk.ZkZone
+	interval time.Duration
+
+	mu      sync.Mutex
+	offsets map[sessionKey]sessionOffset
+	dirty   bool
+}
+
+func newSubSessions(id string, zkzone *zk.ZkZone, interval time.Duration) *subSessions {
+	return &subSessions{
+		id:       id,
+		zkzone:   zkzone,
+		interval: interval,
+		offsets:  make(map[sessionKey]sessionOffset, 100),
+	}
+}
+
+func (this *subSessions) ack(cluster, topic, group string, partition int32, offset int64) {
+	k := sessionKey{cluster: cluster, topic: topic, group: group, partition: partition}
+
+	this.mu.Lock()
+	if offset+1 > this.offsets[k].offset {
+		this.offsets[k] = sessionOffset{offset: offset + 1, mtime: time.Now()}
+		this.dirty = true
+	}
+	this.mu.Unlock()
+}
+
+// checkpoints returns the checkpoints and evicts the idle ones.
+func (this *subSessions) checkpoints(now time.Time) []SubCheckpoint {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	r := make([]SubCheckpoint, 0, len(this.offsets))
+	for k, o := range this.offsets {
+		if now.Sub(o.mtime) > sessionIdleTTL {
+			delete(this.offsets, k)
+			continue
+		}
+
+		r = append(r, SubCheckpoint{
+			Cluster:   k.cluster,
+			Topic:     k.topic,
+			Group:     k.group,
+			Partition: k.partition,
+			Offset:    o.offset,
+		})
+	}
+	this.dirty = false
+	return r
+}
+
+func (this *subSessions) flush() {
+	this.mu.Lock()
+	dirty := this.dirty
+	this.mu.Unlock()
+	if !dirty {
+		return
+	}
+
+	data, _ := json.Marshal(this.checkpoints(time.Now()))
+	if err := this.zkzone.FlushKatewaySubSession(this.id, data); err != nil {
+		log.Error("sub session[%s] checkpoint: %v", this.id, err)
+	}
+}
+
+func (this *subSessions) run(shutdownCh <-chan struct{}) {
+	ticker := time.NewTicker(this.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-shutdownCh:
+			// kafka-cg commits all offsets on graceful shutdown, nothing to take over
+			if err := this.zkzone.DeleteKatewaySubSession(this.id); err != nil {
+				log.Error("sub session[%s] cleanup: %v", this.id, err)
+			}
+			return
+
+		case <-ticker.C:
+			this.flush()
+		}
+	}
+}
+
+// TakeoverSubSessions moves the group offsets forward to the checkpoints of a dead kateway
+// peer and removes its checkpoint, returns number of partitions moved forward.
+//
+// It is best effort: if a new owner of the partition has already fetched from the stale
+// offset before the takeover, part of the messages are still redelivered.
+func TakeoverSubSessions(zkzone *zk.ZkZone, peerId string) (int, error) {
+	data, err := zkzone.LoadKatewaySubSession(peerId)
+	if err != nil || data == nil {
+		return 0, err
+	}
+
+	var checkpoints []SubCheckpoint
+	if err = json.Unmarshal(data, &checkpoints); err != nil {
+		return 0, err
+	}
+
+	n := MoveOffsetsForward(checkpoints)
+	return n, zkzone.DeleteKatewaySubSession(peerId)
+}
+
+// MoveOffsetsForward moves the group offsets forward to the checkpoints, offsets already
+// committed beyond the checkpoints are kept. Returns number of partitions moved forward.
+func MoveOffsetsForward(checkpoints []SubCheckpoint) int {
+	n := 0
+	committed := make(map[string]map[string]map[string]int64) // cluster/group:topic:partition:offset
+	for _, cp := range checkpoints {
+		zkcluster := meta.Default.ZkCluster(cp.Cluster)
+		if zkcluster == nil {
+			continue
+		}
+
+		cg := cp.Cluster + "/" + cp.Group
+		if _, present := committed[cg]; !present {
+			committed[cg] = zkcluster.ConsumerOffsetsOfGroup(cp.Group)
+		}
+
+		partition := strconv.Itoa(int(cp.Partition))
+		if offset, present := committed[cg][cp.Topic][partition]; present && offset >= cp.Offset {
+			continue
+		}
+
+		if err := zkcluster.SetConsumerGroupOffset(cp.Topic, cp.Group, partition, cp.Offset); err != nil {
+			log.Error("move forward %s %s/%s#%s: %v", cp.Cluster, cp.Topic, cp.Group, partition, err)
+			continue
+		}
+
+		log.Trace("move forward %s %s/%s#%s -> %d", cp.Cluster, cp.Topic, cp.Group, partition, cp.Offset)
+		n++
+	}
+
+	return n
+}
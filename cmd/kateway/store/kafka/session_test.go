@@ -0,0 +1,56 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestSubSessionsAckForwardOnly(t *testing.T) {
+	s := newSubSessions("1", nil, time.Second)
+	s.ack("c1", "t1", "g1", 0, 10)
+	s.ack("c1", "t1", "g1", 0, 5) // redelivered message acked late
+	s.ack("c1", "t1", "g1", 1, 3)
+
+	cps := s.checkpoints(time.Now())
+	assert.Equal(t, 2, len(cps))
+	for _, cp := range cps {
+		switch cp.Partition {
+		case 0:
+			assert.Equal(t, int64(11), cp.Offset) // next offset to consume
+		case 1:
+			assert.Equal(t, int64(4), cp.Offset)
+		}
+	}
+	assert.Equal(t, false, s.dirty)
+
+	// moving backward dirties nothing
+	s.ack("c1", "t1", "g1", 0, 9)
+	assert.Equal(t, false, s.dirty)
+	s.ack("c1", "t1", "g1", 0, 11)
+	assert.Equal(t, true, s.dirty)
+}
+
+func TestSubSessionsCheckpointEviction(t *testing.T) {
+	s := newSubSessions("1", nil, time.Second)
+	s.ack("c1", "t1", "g1", 0, 10)
+	s.ack("c1", "t1", "g2", 0, 20)
+
+	// g2 keeps acking
+	idle := s.offsets[sessionKey{cluster: "c1", topic: "t1", group: "g1", partition: 0}]
+	idle.mtime = idle.mtime.Add(-sessionIdleTTL - time.Second)
+	s.offsets[sessionKey{cluster: "c1", topic: "t1", group: "g1", partition: 0}] = idle
+
+	cps := s.checkpoints(time.Now())
+	assert.Equal(t, 1, len(cps))
+	assert.Equal(t, "g2", cps[0].Group)
+	assert.Equal(t, int64(21), cps[0].Offset)
+	assert.Equal(t, 1, len(s.offsets)) // evicted, not just skipped
+
+	// acked again after eviction
+	s.ack("c1", "t1", "g1", 0, 5)
+	assert.Equal(t, 2, len(s.checkpoints(time.Now())))
+
+	assert.Equal(t, 0, len(s.checkpoints(time.Now().Add(sessionIdleTTL+time.Second))))
+}
@@ -1,13 +1,38 @@
 package kafka
 
 import (
+	"github.com/Shopify/sarama"
 	"github.com/funkygao/kafka-cg/consumergroup"
 )
 
 type consumerFetcher struct {
 	*consumergroup.ConsumerGroup
+	prefetcher *prefetcher // nil if prefetch disabled
 	remoteAddr string
 	store      *subStore
+
+	cluster, topic, group string
+}
+
+func (this *consumerFetcher) Messages() <-chan *sarama.ConsumerMessage {
+	if this.prefetcher != nil {
+		return this.prefetcher.Messages()
+	}
+
+	return this.ConsumerGroup.Messages()
+}
+
+func (this *consumerFetcher) CommitUpto(msg *sarama.ConsumerMessage) error {
+	err := this.ConsumerGroup.CommitUpto(msg)
+	if err != nil && this.prefetcher != nil {
+		// the partition might have been rebalanced to another consumer, drop the stale cache
+		this.prefetcher.invalidate(msg.Partition)
+	}
+	if err == nil && this.store.sessions != nil {
+		this.store.sessions.ack(this.cluster, this.topic, this.group, msg.Partition, msg.Offset)
+	}
+
+	return err
 }
 
 func (this *consumerFetcher) Close() error {
@@ -1,6 +1,7 @@
 package kafka
 
 import (
+	"strings"
 	"sync"
 	"time"
 
@@ -12,14 +13,22 @@ import (
 	log "github.com/funkygao/log4go"
 )
 
+// rebalanceTimeout is the max wait for all partitions to be claimed again after rebalance starts.
+const rebalanceTimeout = time.Second * 30
+
 type subManager struct {
 	clientMap     map[string]*consumergroup.ConsumerGroup // key is client remote addr, a client can only sub 1 topic
+	prefetchers   map[string]*prefetcher                  // key is client remote addr
 	clientMapLock sync.RWMutex                            // TODO the lock is too big
+
+	prefetch int // max prefetched messages per partition, 0 means disabled
 }
 
-func newSubManager() *subManager {
+func newSubManager(prefetch int) *subManager {
 	return &subManager{
-		clientMap: make(map[string]*consumergroup.ConsumerGroup, 500),
+		clientMap:   make(map[string]*consumergroup.ConsumerGroup, 500),
+		prefetchers: make(map[string]*prefetcher, 500),
+		prefetch:    prefetch,
 	}
 }
 
@@ -98,22 +107,107 @@ func (this *subManager) PickConsumerGroup(cluster, topic, group, remoteAddr, rea
 		meta.Default.ZkAddrs(), cf)
 	if err == nil {
 		this.clientMap[remoteAddr] = cg
+
+		if this.prefetch > 0 {
+			pf := newPrefetcher(cg.Messages(), this.prefetch)
+			this.prefetchers[remoteAddr] = pf
+			go watchRebalance(cluster, topic, group, pf)
+		}
 	}
 
 	return
 }
 
+// prefetcherOf returns the prefetcher of a consumer client, nil if prefetch disabled.
+func (this *subManager) prefetcherOf(remoteAddr string) *prefetcher {
+	this.clientMapLock.RLock()
+	pf := this.prefetchers[remoteAddr]
+	this.clientMapLock.RUnlock()
+	return pf
+}
+
+// watchRebalance notifies the prefetcher of the rebalances of the consumer group until the
+// prefetcher is closed: a rebalance starts when any claim is released and completes when all
+// partitions are claimed again.
+func watchRebalance(cluster, topic, group string, pf *prefetcher) {
+	var (
+		zkcluster   = meta.Default.ZkCluster(cluster)
+		rebalancing bool
+		timeout     <-chan time.Time
+	)
+	for {
+		claimed, ch, err := zkcluster.WatchClaimedPartitions(group, topic)
+		if err != nil {
+			log.Error("cg[%s] %s.%s watch rebalance: %v", group, cluster, topic, err)
+
+			select {
+			case <-pf.quit:
+				return
+			case <-time.After(time.Second * 5):
+			}
+			continue
+		}
+
+		if rebalancing && len(claimed) >= len(meta.Default.TopicPartitions(cluster, topic)) {
+			rebalancing = false
+			pf.rebalanced()
+		}
+
+		select {
+		case <-pf.quit:
+			return
+
+		case <-ch:
+			if !rebalancing {
+				rebalancing = true
+				timeout = time.After(rebalanceTimeout)
+				pf.rebalance()
+			}
+
+		case <-timeout:
+			if rebalancing {
+				// some partitions left unclaimed, e,g. fewer consumers than partitions
+				rebalancing = false
+				pf.rebalanced()
+			}
+		}
+	}
+}
+
 // For a given consumer client, it might be killed twice:
 // 1. on socket level, the socket is closed
 // 2. websocket/sub handler, conn closed or error occurs, explicitly kill the client
+// clientsOfConn returns the clients over a connection: the connection itself for HTTP/1.x
+// and each of the multiplexed clients keyed by remoteAddr/xxx for HTTP/2.
+func (this *subManager) clientsOfConn(remoteAddr string) []string {
+	prefix := remoteAddr + "/"
+	r := []string{remoteAddr}
+	this.clientMapLock.RLock()
+	for id := range this.clientMap {
+		if strings.HasPrefix(id, prefix) {
+			r = append(r, id)
+		}
+	}
+	this.clientMapLock.RUnlock()
+	return r
+}
+
 func (this *subManager) killClient(remoteAddr string) (err error) {
 	this.clientMapLock.Lock()
 	cg, present := this.clientMap[remoteAddr]
 	if present {
 		delete(this.clientMap, remoteAddr)
 	}
+	pf := this.prefetchers[remoteAddr]
+	delete(this.prefetchers, remoteAddr)
 	this.clientMapLock.Unlock()
 
+	if pf != nil {
+		// prefetched but undelivered messages are not committed, they will be redelivered
+		pf.Close()
+		pf.wait()
+	}
+
 	if !present {
 		// e,g. client connects to Sub port but not Sub request(404), will lead to this case
 		// e,g. Sub a non-exist topic
@@ -132,6 +226,10 @@ func (this *subManager) Stop() {
 	this.clientMapLock.Lock()
 	defer this.clientMapLock.Unlock()
 
+	for _, pf := range this.prefetchers {
+		pf.Close()
+	}
+
 	var wg sync.WaitGroup
 	for _, cg := range this.clientMap {
 		wg.Add(1)
@@ -4,10 +4,12 @@ import (
 	l "log"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/funkygao/gafka/cmd/kateway/store"
 	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/golib/color"
 	"github.com/funkygao/kafka-cg/consumergroup"
 	log "github.com/funkygao/log4go"
@@ -18,29 +20,53 @@ type subStore struct {
 	closedConnCh <-chan string // remote addr
 	wg           sync.WaitGroup
 	hostname     string // load on startup, cached
+	prefetch     int
 
 	subManager *subManager
+	sessions   *subSessions // nil if session checkpoint disabled
+
+	partitionClients     map[string]*clientPool // cluster: client shared by partition fetchers
+	partitionClientsLock sync.Mutex
 }
 
-func NewSubStore(closedConnCh <-chan string, debug bool) *subStore {
+// NewSubStore creates a kafka sub store. If prefetch is positive, messages of each
+// consumer group are prefetched and cached upto prefetch messages per partition.
+func NewSubStore(closedConnCh <-chan string, prefetch int, debug bool) *subStore {
 	if debug {
 		sarama.Logger = l.New(os.Stdout, color.Blue("[Sarama]"),
 			l.LstdFlags|l.Lshortfile)
 	}
 
 	return &subStore{
-		hostname:     ctx.Hostname(),
-		shutdownCh:   make(chan struct{}),
-		closedConnCh: closedConnCh,
+		hostname:         ctx.Hostname(),
+		shutdownCh:       make(chan struct{}),
+		closedConnCh:     closedConnCh,
+		prefetch:         prefetch,
+		partitionClients: make(map[string]*clientPool),
 	}
 }
 
+// CheckpointSessions enables checkpointing acked offsets of the Sub sessions to zk at the
+// interval so that the standby partner of kateway id can take over on failure.
+// It must be called before Start.
+func (this *subStore) CheckpointSessions(id string, zkzone *zk.ZkZone, interval time.Duration) {
+	this.sessions = newSubSessions(id, zkzone, interval)
+}
+
 func (this *subStore) Name() string {
 	return "kafka"
 }
 
 func (this *subStore) Start() (err error) {
-	this.subManager = newSubManager()
+	this.subManager = newSubManager(this.prefetch)
+
+	if this.sessions != nil {
+		this.wg.Add(1)
+		go func() {
+			defer this.wg.Done()
+			this.sessions.run(this.shutdownCh)
+		}()
+	}
 
 	this.wg.Add(1)
 	go func() {
@@ -54,11 +80,13 @@ func (this *subStore) Start() (err error) {
 				return
 
 			case remoteAddr = <-this.closedConnCh:
-				this.wg.Add(1)
-				go func(id string) {
-					this.subManager.killClient(id)
-					this.wg.Done()
-				}(remoteAddr)
+				for _, id := range this.subManager.clientsOfConn(remoteAddr) {
+					this.wg.Add(1)
+					go func(id string) {
+						this.subManager.killClient(id)
+						this.wg.Done()
+					}(id)
+				}
 			}
 		}
 	}()
@@ -68,6 +96,13 @@ func (this *subStore) Start() (err error) {
 
 func (this *subStore) Stop() {
 	this.subManager.Stop()
+
+	this.partitionClientsLock.Lock()
+	for _, pool := range this.partitionClients {
+		pool.Close()
+	}
+	this.partitionClientsLock.Unlock()
+
 	close(this.shutdownCh)
 	this.wg.Wait()
 }
@@ -81,7 +116,11 @@ func (this *subStore) Fetch(cluster, topic, group, remoteAddr, realIp,
 
 	return &consumerFetcher{
 		ConsumerGroup: cg,
+		prefetcher:    this.subManager.prefetcherOf(remoteAddr),
 		remoteAddr:    remoteAddr,
+		cluster:       cluster,
+		topic:         topic,
+		group:         group,
 		store:         this,
 	}, nil
 }
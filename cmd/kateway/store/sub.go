@@ -30,6 +30,11 @@ type SubStore interface {
 	// Fetch returns a Fetcher.
 	Fetch(cluster, topic, group, remoteAddr, realIp, resetOffset string, permitStandby bool) (Fetcher, error)
 
+	// FetchPartitions returns a Fetcher of the partitions of topic starting from the offsets,
+	// which can be sarama.OffsetOldest or sarama.OffsetNewest.
+	// It never joins any consumer group: no rebalance, and CommitUpto is a no-op.
+	FetchPartitions(cluster, topic string, offsets map[int32]int64) (Fetcher, error)
+
 	IsSystemError(error) bool
 }
 
@@ -0,0 +1,6 @@
+// Package transform provides pluggable message transforms applied by kateway on Pub
+// or Sub, e,g. field masking, PII scrubbing and format migration.
+//
+// A transform is registered by name, either built in or by a Go plugin whose init()
+// calls Register. Topics are bound to transforms with manager.TransformRule.
+package transform
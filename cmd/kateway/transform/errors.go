@@ -0,0 +1,10 @@
+package transform
+
+import (
+	"errors"
+)
+
+var (
+	ErrNotJson          = errors.New("message is not json object")
+	ErrPluginNotSupport = errors.New("transform plugin requires go1.8+ on linux")
+)
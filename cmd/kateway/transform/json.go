@@ -0,0 +1,42 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+func decodeJsonObject(msg []byte) (map[string]interface{}, error) {
+	var v map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(msg))
+	d.UseNumber() // keep numbers as they were
+	if err := d.Decode(&v); err != nil || v == nil {
+		return nil, ErrNotJson
+	}
+
+	return v, nil
+}
+
+// parentOf walks a dot separated path, e,g. user.phone, and returns the object
+// holding the last field.
+func parentOf(v map[string]interface{}, path []string) (map[string]interface{}, bool) {
+	for _, field := range path[:len(path)-1] {
+		child, ok := v[field].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		v = child
+	}
+
+	return v, true
+}
+
+func splitList(params string) []string {
+	var r []string
+	for _, p := range strings.Split(params, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			r = append(r, p)
+		}
+	}
+	return r
+}
@@ -0,0 +1,100 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const maskedValue = "***"
+
+func init() {
+	Register("mask", newMask)
+	Register("rename", newRename)
+}
+
+// mask replaces the values of json fields with ***.
+//
+// params: comma separated dot paths, e,g. user.phone,card
+type mask struct {
+	paths [][]string
+}
+
+func newMask(params string) (Transformer, error) {
+	fields := splitList(params)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("mask: empty fields")
+	}
+
+	this := &mask{}
+	for _, field := range fields {
+		this.paths = append(this.paths, strings.Split(strings.TrimPrefix(field, "$."), "."))
+	}
+	return this, nil
+}
+
+func (this *mask) Transform(msg []byte) ([]byte, error) {
+	v, err := decodeJsonObject(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range this.paths {
+		if parent, found := parentOf(v, path); found {
+			if _, present := parent[path[len(path)-1]]; present {
+				parent[path[len(path)-1]] = maskedValue
+			}
+		}
+	}
+
+	return json.Marshal(v)
+}
+
+// rename renames json fields for format migration.
+//
+// params: comma separated old:new pairs, old is a dot path and new is a field name
+// in the same object, e,g. user.mobile:phone
+type rename struct {
+	paths [][]string
+	names []string
+}
+
+func newRename(params string) (Transformer, error) {
+	pairs := splitList(params)
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("rename: empty fields")
+	}
+
+	this := &rename{}
+	for _, pair := range pairs {
+		tuple := strings.SplitN(pair, ":", 2)
+		if len(tuple) != 2 || tuple[0] == "" || tuple[1] == "" {
+			return nil, fmt.Errorf("rename: invalid %s", pair)
+		}
+
+		this.paths = append(this.paths, strings.Split(strings.TrimPrefix(tuple[0], "$."), "."))
+		this.names = append(this.names, tuple[1])
+	}
+	return this, nil
+}
+
+func (this *rename) Transform(msg []byte) ([]byte, error) {
+	v, err := decodeJsonObject(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, path := range this.paths {
+		parent, found := parentOf(v, path)
+		if !found {
+			continue
+		}
+
+		if val, present := parent[path[len(path)-1]]; present {
+			delete(parent, path[len(path)-1])
+			parent[this.names[i]] = val
+		}
+	}
+
+	return json.Marshal(v)
+}
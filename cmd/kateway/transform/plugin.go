@@ -0,0 +1,29 @@
+// +build go1.8,linux
+
+package transform
+
+import (
+	"path/filepath"
+	"plugin"
+
+	log "github.com/funkygao/log4go"
+)
+
+// LoadPlugins opens all the Go plugins(*.so) in dir, each plugin registers its
+// transforms with Register in its init().
+func LoadPlugins(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if _, err = plugin.Open(file); err != nil {
+			return err
+		}
+
+		log.Info("transform plugin %s loaded", file)
+	}
+
+	return nil
+}
@@ -0,0 +1,8 @@
+// +build !go1.8 !linux
+
+package transform
+
+// LoadPlugins is not supported before go1.8 or on non-linux.
+func LoadPlugins(dir string) error {
+	return ErrPluginNotSupport
+}
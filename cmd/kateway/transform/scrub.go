@@ -0,0 +1,55 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+)
+
+func init() {
+	Register("scrub", newScrub)
+}
+
+// PII patterns, applied in this order.
+var piiPatterns = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"email", regexp.MustCompile(`[\w.+-]+@[\w-]+(\.[\w-]+)+`)},
+	{"idcard", regexp.MustCompile(`\b\d{17}[\dXx]\b`)},
+	{"bankcard", regexp.MustCompile(`\b\d{16,19}\b`)},
+	{"mobile", regexp.MustCompile(`\b1[3-9]\d{9}\b`)},
+}
+
+// scrub replaces PII in the message with ***, the message needs not be json.
+//
+// params: comma separated PII kinds of email,idcard,bankcard,mobile, empty for all
+type scrub struct {
+	patterns []*regexp.Regexp
+}
+
+func newScrub(params string) (Transformer, error) {
+	kinds := make(map[string]bool)
+	for _, kind := range splitList(params) {
+		kinds[kind] = true
+	}
+
+	this := &scrub{}
+	for _, p := range piiPatterns {
+		if len(kinds) == 0 || kinds[p.name] {
+			this.patterns = append(this.patterns, p.re)
+			delete(kinds, p.name)
+		}
+	}
+	for kind := range kinds {
+		return nil, fmt.Errorf("scrub: unknown PII kind %s", kind)
+	}
+
+	return this, nil
+}
+
+func (this *scrub) Transform(msg []byte) ([]byte, error) {
+	for _, re := range this.patterns {
+		msg = re.ReplaceAllLiteral(msg, []byte(maskedValue))
+	}
+	return msg, nil
+}
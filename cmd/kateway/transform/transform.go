@@ -0,0 +1,63 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Transformer transforms a message.
+//
+// Transform must not modify msg in place: it might be pooled by the caller.
+type Transformer interface {
+	Transform(msg []byte) ([]byte, error)
+}
+
+// Factory creates a Transformer with its params.
+type Factory func(params string) (Transformer, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a transform available by the provided name.
+// If Register is called twice with the same name, it panics.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("transform: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("transform: Register called twice for " + name)
+	}
+
+	factories[name] = factory
+}
+
+// New creates a Transformer of a registered transform.
+func New(name, params string) (Transformer, error) {
+	factoriesMu.RLock()
+	factory, present := factories[name]
+	factoriesMu.RUnlock()
+	if !present {
+		return nil, fmt.Errorf("transform[%s] not registered", name)
+	}
+
+	return factory(params)
+}
+
+// Transforms returns sorted names of registered transforms.
+func Transforms() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	r := make([]string, 0, len(factories))
+	for name := range factories {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
@@ -0,0 +1,55 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestMask(t *testing.T) {
+	m, err := New("mask", "user.phone, card,user.none")
+	assert.Equal(t, nil, err)
+	b, err := m.Transform([]byte(`{"user":{"phone":"13800138000","age":12},"card":123456}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `{"card":"***","user":{"age":12,"phone":"***"}}`, string(b))
+
+	_, err = m.Transform([]byte("not json"))
+	assert.Equal(t, ErrNotJson, err)
+
+	_, err = New("mask", "")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestRename(t *testing.T) {
+	m, err := New("rename", "user.mobile:phone")
+	assert.Equal(t, nil, err)
+	b, err := m.Transform([]byte(`{"user":{"mobile":"138"}}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `{"user":{"phone":"138"}}`, string(b))
+
+	_, err = New("rename", "user.mobile")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestScrub(t *testing.T) {
+	m, err := New("scrub", "")
+	assert.Equal(t, nil, err)
+	msg := []byte("mail foo.bar@x.com or call 13800138000, id 11010519491231002X")
+	b, err := m.Transform(msg)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "mail *** or call ***, id ***", string(b))
+	assert.Equal(t, "mail foo.bar@x.com or call 13800138000, id 11010519491231002X", string(msg))
+
+	m, _ = New("scrub", "mobile")
+	b, _ = m.Transform([]byte("foo@x.com 13800138000"))
+	assert.Equal(t, "foo@x.com ***", string(b))
+
+	_, err = New("scrub", "passport")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestNotRegistered(t *testing.T) {
+	_, err := New("lua", "")
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, []string{"mask", "rename", "scrub"}, Transforms())
+}
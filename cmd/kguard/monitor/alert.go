@@ -1,14 +1,62 @@
 package monitor
 
 import (
+	"encoding/json"
 	"net/http"
+	"strings"
+	"time"
 
+	log "github.com/funkygao/log4go"
 	"github.com/julienschmidt/httprouter"
 )
 
+// alertEvent is posted by zabbix to /alertHook on alert state change.
+type alertEvent struct {
+	Name     string    `json:"name"`
+	Status   string    `json:"status"` // PROBLEM|OK
+	Severity string    `json:"severity"`
+	Message  string    `json:"message"`
+	Since    time.Time `json:"since"`
+
+	Acked     bool   `json:"acked"`
+	AckedBy   string `json:"acked_by,omitempty"`
+	Escalated int    `json:"escalated"` // escalation steps notified
+
+	posted string // severity posted by zabbix
+	level  severity
+}
+
+func (this alertEvent) resolved() bool {
+	s := strings.ToUpper(this.Status)
+	return s == "OK" || s == "RESOLVED"
+}
+
 // POST /alertHook
-// so that we can auto-fix
+// zabbix action posts {"name":"brokers.dead", "status":"PROBLEM|OK", "severity":"", "message":""}
+// the firing alerts are shown on dashboard, TODO auto-fix
 func (this *Monitor) alertHookHandler(w http.ResponseWriter, r *http.Request,
 	params httprouter.Params) {
+	var evt alertEvent
+	if err := json.NewDecoder(r.Body).Decode(&evt); err != nil || evt.Name == "" {
+		log.Warn("%s alert hook: invalid event %+v: %v", r.RemoteAddr, evt, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	log.Info("%s alert hook: %+v", r.RemoteAddr, evt)
+	this.dashboard.onAlert(evt)
+}
+
+// POST /alertAck?name=xx&by=xx
+// on-call acks a firing alert to stop its escalation
+func (this *Monitor) alertAckHandler(w http.ResponseWriter, r *http.Request,
+	params httprouter.Params) {
+	name, by := r.URL.Query().Get("name"), r.URL.Query().Get("by")
+	if !this.dashboard.ackAlert(name, by) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 
+	log.Info("%s alert[%s] acked by %s", r.RemoteAddr, name, by)
+	w.Write([]byte("acked"))
 }
@@ -19,6 +19,9 @@ func (this *Monitor) setupRoutes() {
 	this.router.GET("/metrics", this.metricsHandler)
 	this.router.PUT("/set", this.configHandler)
 	this.router.POST("/alertHook", this.alertHookHandler) // zabbix will call me on alert event
+	this.router.POST("/alertAck", this.alertAckHandler)
+	this.router.GET("/dashboard", this.dashboardHandler)
+	this.router.GET("/dashboard.json", this.dashboardJsonHandler)
 }
 
 // PUT /set?key=xx
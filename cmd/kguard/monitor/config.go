@@ -0,0 +1,229 @@
+package monitor
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/funkygao/jsconf"
+	log "github.com/funkygao/log4go"
+)
+
+// watcherConfig tunes a registered watcher.
+type watcherConfig struct {
+	name     string
+	zones    []string // empty means all zones
+	disabled bool
+	tick     time.Duration // 0 means the watcher default
+	sets     []string      // keys applied through Setter, e,g. pubrate-k:4
+}
+
+func (this watcherConfig) appliesTo(zone string) bool {
+	return zoneMatched(this.zones, zone)
+}
+
+// zoneMatched checks if an entry of the zones applies to the zone, empty zones means all.
+func zoneMatched(zones []string, zone string) bool {
+	if len(zones) == 0 {
+		return true
+	}
+
+	for _, z := range zones {
+		if z == zone {
+			return true
+		}
+	}
+	return false
+}
+
+// config decides which registered watchers to run in a zone and how to tune them, e,g.
+//
+//	{
+//	    default_enabled: true
+//	    watchers: [
+//	        {
+//	            name: "anomaly.pubrate"
+//	            zones: ["prod"]
+//	            tick: "30s"
+//	            set: ["pubrate-k:4", "pubrate-samples:20"]
+//	        }
+//	        {
+//	            name: "zone.loadavg"
+//	            disabled: true
+//	        }
+//	    ]
+//	    alerts: [
+//	        {
+//	            name: "brokers.dead"
+//	            severity: "critical"
+//	        }
+//	    ]
+//	    escalations: [
+//	        {
+//	            severity: "critical"
+//	            after: "10m"
+//	            sink: "exec:/opt/bin/phonecall"
+//	            zones: ["prod"]
+//	        }
+//	    ]
+//	}
+//
+// Watchers not listed run with their defaults if default_enabled.
+// An entry with zones takes precedence over the one without.
+// Escalation steps of a severity applying to the zone form its escalation chain.
+type config struct {
+	defaultEnabled bool
+	watchers       map[string]watcherConfig // resolved for the zone
+	alerts         *alertPolicy             // resolved for the zone
+}
+
+// defaultConfig runs every registered watcher with its defaults.
+func defaultConfig() *config {
+	return &config{
+		defaultEnabled: true,
+		watchers:       make(map[string]watcherConfig),
+		alerts:         defaultAlertPolicy(),
+	}
+}
+
+func loadConfig(fn string, zone string) (*config, error) {
+	cf, err := jsconf.Load(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	this := defaultConfig()
+	this.defaultEnabled = cf.Bool("default_enabled", true)
+	for i := 0; i < len(cf.List("watchers", nil)); i++ {
+		section, err := cf.Section(fmt.Sprintf("watchers[%d]", i))
+		if err != nil {
+			return nil, err
+		}
+
+		wc := watcherConfig{
+			name:     section.String("name", ""),
+			zones:    section.StringList("zones", nil),
+			disabled: section.Bool("disabled", false),
+			tick:     section.Duration("tick", 0),
+			sets:     section.StringList("set", nil),
+		}
+		if _, present := registeredWatchers[wc.name]; !present {
+			return nil, fmt.Errorf("watchers[%d]: unknown watcher %q", i, wc.name)
+		}
+		if wc.tick < 0 {
+			return nil, fmt.Errorf("watchers[%d]: negative tick", i)
+		}
+		if !wc.appliesTo(zone) {
+			continue
+		}
+
+		if old, present := this.watchers[wc.name]; present && len(old.zones) > 0 && len(wc.zones) == 0 {
+			// zone specific entry wins
+			continue
+		}
+		this.watchers[wc.name] = wc
+	}
+
+	if err = this.loadAlertPolicy(cf, zone); err != nil {
+		return nil, err
+	}
+
+	return this, nil
+}
+
+func (this *config) loadAlertPolicy(cf *jsconf.Conf, zone string) error {
+	zoned := make(map[string]bool) // alert name:severity is zone specific
+	for i := 0; i < len(cf.List("alerts", nil)); i++ {
+		section, err := cf.Section(fmt.Sprintf("alerts[%d]", i))
+		if err != nil {
+			return err
+		}
+
+		name := section.String("name", "")
+		if name == "" {
+			return fmt.Errorf("alerts[%d]: empty name", i)
+		}
+		s, err := parseSeverity(section.String("severity", ""))
+		if err != nil {
+			return fmt.Errorf("alerts[%d]: %v", i, err)
+		}
+		zones := section.StringList("zones", nil)
+		if !zoneMatched(zones, zone) || (zoned[name] && len(zones) == 0) {
+			continue
+		}
+
+		this.alerts.severities[name] = s
+		zoned[name] = len(zones) > 0
+	}
+
+	for i := 0; i < len(cf.List("escalations", nil)); i++ {
+		section, err := cf.Section(fmt.Sprintf("escalations[%d]", i))
+		if err != nil {
+			return err
+		}
+
+		s, err := parseSeverity(section.String("severity", ""))
+		if err != nil {
+			return fmt.Errorf("escalations[%d]: %v", i, err)
+		}
+		after := section.Duration("after", 0)
+		if after < 0 {
+			return fmt.Errorf("escalations[%d]: negative after", i)
+		}
+		sink, err := newAlertSink(section.String("sink", ""))
+		if err != nil {
+			return fmt.Errorf("escalations[%d]: %v", i, err)
+		}
+		if !zoneMatched(section.StringList("zones", nil), zone) {
+			continue
+		}
+
+		this.alerts.addEscalation(s, escalationStep{after: after, sink: sink})
+	}
+
+	return nil
+}
+
+func (this *config) enabled(name string) bool {
+	wc, present := this.watchers[name]
+	if !present {
+		return this.defaultEnabled
+	}
+
+	return !wc.disabled
+}
+
+// tune applies the tick and keys of the config to a created watcher before its Init.
+func (this *config) tune(name string, w Watcher) {
+	wc, present := this.watchers[name]
+	if !present {
+		return
+	}
+
+	if wc.tick > 0 {
+		// all ticking watchers expose Tick field
+		v := reflect.ValueOf(w)
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		f := v.FieldByName("Tick")
+		if v.Kind() == reflect.Struct && f.IsValid() && f.CanSet() && f.Type() == reflect.TypeOf(wc.tick) {
+			f.Set(reflect.ValueOf(wc.tick))
+			log.Info("watcher[%s] tick set to %s", name, wc.tick)
+		} else {
+			log.Warn("watcher[%s] tick not tunable, ignored", name)
+		}
+	}
+
+	if len(wc.sets) > 0 {
+		s, ok := w.(Setter)
+		if !ok {
+			log.Warn("watcher[%s] not tunable, set %v ignored", name, wc.sets)
+			return
+		}
+
+		for _, key := range wc.sets {
+			s.Set(key)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+// noopWatcher exits at once, registered for the config tests only.
+type noopWatcher struct {
+	wg *sync.WaitGroup
+}
+
+func (this *noopWatcher) Init(ctx Context) { this.wg = ctx.Inflight() }
+func (this *noopWatcher) Run()             { this.wg.Done() }
+
+type tunableWatcher struct {
+	noopWatcher
+	Tick time.Duration
+	keys []string
+}
+
+func (this *tunableWatcher) Set(key string) { this.keys = append(this.keys, key) }
+
+func init() {
+	RegisterWatcher("config.tunable", func() Watcher { return &tunableWatcher{Tick: time.Minute} })
+	RegisterWatcher("config.untunable", func() Watcher { return &noopWatcher{} })
+}
+
+func writeConfig(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "kguard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err = f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestLoadConfig(t *testing.T) {
+	fn := writeConfig(t, `
+{
+    default_enabled: false
+    watchers: [
+        {
+            name: "config.tunable"
+            tick: "30s"
+            set: ["k:1"]
+        }
+        {
+            name: "config.tunable"
+            zones: ["prod"]
+            tick: "10s"
+            set: ["k:2", "n:3"]
+        }
+        {
+            name: "config.untunable"
+            zones: ["test"]
+            disabled: false
+        }
+    ]
+    alerts: [
+        {
+            name: "brokers.dead"
+            severity: "critical"
+            zones: ["prod"]
+        }
+        {
+            name: "brokers.dead"
+            severity: "warn"
+        }
+        {
+            name: "lag"
+            severity: "high"
+        }
+    ]
+    escalations: [
+        {
+            severity: "critical"
+            after: "10m"
+            sink: "exec:/opt/bin/phonecall"
+            zones: ["prod"]
+        }
+        {
+            severity: "critical"
+            sink: "log"
+        }
+        {
+            severity: "warn"
+            after: "1h"
+            sink: "http://im.foo.com/hook"
+            zones: ["test"]
+        }
+    ]
+}
+`)
+	defer os.Remove(fn)
+
+	conf, err := loadConfig(fn, "prod")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, conf.defaultEnabled)
+	assert.Equal(t, true, conf.enabled("config.tunable"))
+	assert.Equal(t, false, conf.enabled("config.untunable"))              // default disabled
+	assert.Equal(t, time.Second*10, conf.watchers["config.tunable"].tick) // zone specific wins
+	assert.Equal(t, []string{"k:2", "n:3"}, conf.watchers["config.tunable"].sets)
+	assert.Equal(t, severityCritical, conf.alerts.severityOf("brokers.dead", "info"))
+	assert.Equal(t, severityCritical, conf.alerts.severityOf("lag", "info"))
+	steps := conf.alerts.escalations[severityCritical]
+	assert.Equal(t, 2, len(steps))
+	assert.Equal(t, logSink{}, steps[0].sink) // sorted by after
+	assert.Equal(t, time.Minute*10, steps[1].after)
+	assert.Equal(t, 0, len(conf.alerts.escalations[severityWarn]))
+
+	conf, err = loadConfig(fn, "test")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, time.Second*30, conf.watchers["config.tunable"].tick)
+	assert.Equal(t, true, conf.enabled("config.untunable"))
+	assert.Equal(t, severityWarn, conf.alerts.severityOf("brokers.dead", "info"))
+	assert.Equal(t, 1, len(conf.alerts.escalations[severityCritical]))
+	assert.Equal(t, 1, len(conf.alerts.escalations[severityWarn]))
+
+	// without config file every watcher runs with its defaults
+	conf = defaultConfig()
+	assert.Equal(t, true, conf.enabled("config.untunable"))
+	assert.Equal(t, severityInfo, conf.alerts.severityOf("lag", "info"))
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	cases := []string{
+		`{watchers: [{name: "config.unknown"}]}`,
+		`{watchers: [{name: "config.tunable", tick: "-1s"}]}`,
+		`{alerts: [{severity: "critical"}]}`,
+		`{alerts: [{name: "lag", severity: "fatal"}]}`,
+		`{escalations: [{severity: "fatal", sink: "log"}]}`,
+		`{escalations: [{severity: "warn", after: "-1m", sink: "log"}]}`,
+		`{escalations: [{severity: "warn", sink: "phonecall"}]}`,
+		`{escalations: [{severity: "warn", sink: "phonecall", zones: ["other"]}]}`, // validated in any zone
+	}
+	for _, c := range cases {
+		fn := writeConfig(t, c)
+		_, err := loadConfig(fn, "prod")
+		os.Remove(fn)
+		assert.NotEqual(t, nil, err)
+	}
+
+	_, err := loadConfig("/non-exist/kguard.cf", "prod")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestConfigTune(t *testing.T) {
+	conf := defaultConfig()
+	conf.watchers["config.tunable"] = watcherConfig{name: "config.tunable", tick: time.Second, sets: []string{"k:1"}}
+	conf.watchers["config.untunable"] = watcherConfig{name: "config.untunable", tick: time.Second, sets: []string{"k:1"}}
+
+	w := &tunableWatcher{Tick: time.Minute}
+	conf.tune("config.tunable", w)
+	assert.Equal(t, time.Second, w.Tick)
+	assert.Equal(t, []string{"k:1"}, w.keys)
+
+	// not listed, defaults kept
+	w = &tunableWatcher{Tick: time.Minute}
+	conf.tune("config.other", w)
+	assert.Equal(t, time.Minute, w.Tick)
+	assert.Equal(t, 0, len(w.keys))
+
+	// ignored without panic
+	conf.tune("config.untunable", &noopWatcher{})
+}
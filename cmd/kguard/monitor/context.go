@@ -9,9 +9,12 @@ import (
 // Context is the context container that will be passed to plugin watchers.
 type Context interface {
 	ZkZone() *zk.ZkZone
+	Zone() Zone
 	StopChan() <-chan struct{}
 	Inflight() *sync.WaitGroup
 	InfluxAddr() string
 	InfluxDB() string
 	ExternalDir() string
+	ExpectedKateways() int
+	CleanupLeaks() bool
 }
@@ -0,0 +1,317 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka"
+	"github.com/funkygao/go-metrics"
+	"github.com/julienschmidt/httprouter"
+)
+
+const dashboardSampleInterval = time.Second * 10
+
+type gaugeSample struct {
+	Name      string      `json:"name"`
+	Value     interface{} `json:"value"`
+	ChangedAt time.Time   `json:"changed_at"` // sampled, accurate to dashboardSampleInterval
+}
+
+type watcherGauges struct {
+	Watcher string        `json:"watcher"`
+	Gauges  []gaugeSample `json:"gauges"`
+}
+
+// dashboard keeps the recent values of all gauges and the firing alerts for on-call
+// to check the zone health without Grafana.
+type dashboard struct {
+	registry *watcherRegistry
+
+	mu        sync.RWMutex
+	samples   map[string]gaugeSample
+	alerts    map[string]alertEvent
+	policy    *alertPolicy
+	sampledAt time.Time
+}
+
+func newDashboard(registry *watcherRegistry) *dashboard {
+	return &dashboard{
+		registry: registry,
+		samples:  make(map[string]gaugeSample),
+		alerts:   make(map[string]alertEvent),
+		policy:   defaultAlertPolicy(),
+	}
+}
+
+func (this *dashboard) run(quit <-chan struct{}) {
+	ticker := time.NewTicker(dashboardSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+
+		case now := <-ticker.C:
+			this.sample(now)
+			this.escalate(now)
+		}
+	}
+}
+
+func (this *dashboard) sample(now time.Time) {
+	values := make(map[string]interface{})
+	this.registry.Each(func(name string, i interface{}) {
+		if strings.HasPrefix(name, "{") {
+			// tag'ed metrics are too many to show
+			return
+		}
+
+		switch metric := i.(type) {
+		case metrics.Gauge:
+			values[name] = metric.Value()
+		case metrics.GaugeFloat64:
+			values[name] = metric.Value()
+		case metrics.Counter:
+			values[name] = metric.Count()
+		}
+	})
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for name, v := range values {
+		if s, present := this.samples[name]; present && s.Value == v {
+			continue
+		}
+
+		this.samples[name] = gaugeSample{Name: name, Value: v, ChangedAt: now}
+	}
+	for name := range this.samples {
+		if _, present := values[name]; !present {
+			// unregistered on watchers restart
+			delete(this.samples, name)
+		}
+	}
+	this.sampledAt = now
+}
+
+func (this *dashboard) onAlert(evt alertEvent) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if evt.resolved() {
+		delete(this.alerts, evt.Name)
+		return
+	}
+
+	evt.posted = evt.Severity
+	evt.level = this.policy.severityOf(evt.Name, evt.posted)
+	evt.Severity = evt.level.String()
+	if old, present := this.alerts[evt.Name]; present {
+		evt.Since = old.Since
+		evt.Acked, evt.AckedBy = old.Acked, old.AckedBy
+		evt.Escalated = old.Escalated
+	} else {
+		evt.Since = time.Now()
+	}
+	this.alerts[evt.Name] = evt
+}
+
+// ackAlert returns false if the alert is not firing.
+func (this *dashboard) ackAlert(name, by string) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	evt, present := this.alerts[name]
+	if !present {
+		return false
+	}
+
+	evt.Acked, evt.AckedBy = true, by
+	this.alerts[name] = evt
+	return true
+}
+
+func (this *dashboard) setAlertPolicy(policy *alertPolicy) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.policy = policy
+	for name, evt := range this.alerts {
+		// escalation continues with the new chain of the severity
+		evt.level = policy.severityOf(evt.Name, evt.posted)
+		evt.Severity = evt.level.String()
+		this.alerts[name] = evt
+	}
+}
+
+// watcherGauges returns gauges grouped by watcher sorted by name, those not registered
+// by any watcher are grouped under empty watcher name.
+func (this *dashboard) watcherGauges() []watcherGauges {
+	this.mu.RLock()
+	groups := make(map[string][]gaugeSample)
+	for name, s := range this.samples {
+		w := this.registry.owner(name)
+		groups[w] = append(groups[w], s)
+	}
+	this.mu.RUnlock()
+
+	var watchers []string
+	for w := range groups {
+		watchers = append(watchers, w)
+	}
+	sort.Strings(watchers)
+
+	r := make([]watcherGauges, 0, len(watchers))
+	for _, w := range watchers {
+		gauges := groups[w]
+		sort.Sort(gaugeSamplesByName(gauges))
+		r = append(r, watcherGauges{Watcher: w, Gauges: gauges})
+	}
+	return r
+}
+
+func (this *dashboard) firingAlerts() []alertEvent {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	r := make([]alertEvent, 0, len(this.alerts))
+	for _, a := range this.alerts {
+		r = append(r, a)
+	}
+	sort.Sort(alertsBySince(r))
+	return r
+}
+
+type gaugeSamplesByName []gaugeSample
+
+func (s gaugeSamplesByName) Len() int           { return len(s) }
+func (s gaugeSamplesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s gaugeSamplesByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+type alertsBySince []alertEvent
+
+func (s alertsBySince) Len() int           { return len(s) }
+func (s alertsBySince) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s alertsBySince) Less(i, j int) bool { return s[i].Since.Before(s[j].Since) }
+
+// GET /dashboard.json
+func (this *Monitor) dashboardJsonHandler(w http.ResponseWriter, r *http.Request,
+	params httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json; charset=utf8")
+
+	this.dashboard.mu.RLock()
+	sampledAt := this.dashboard.sampledAt
+	this.dashboard.mu.RUnlock()
+
+	b, err := json.Marshal(map[string]interface{}{
+		"zone":       this.zone,
+		"version":    gafka.BuildId,
+		"leader":     this.leader,
+		"uptime":     this.startedAt,
+		"lead":       this.leadAt,
+		"sampled_at": sampledAt,
+		"watchers":   this.dashboard.watcherGauges(),
+		"alerts":     this.dashboard.firingAlerts(),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Write(b)
+}
+
+// GET /dashboard
+func (this *Monitor) dashboardHandler(w http.ResponseWriter, r *http.Request,
+	params httprouter.Params) {
+	w.Header().Set("Content-Type", "text/html; charset=utf8")
+	w.Write([]byte(dashboardHtml))
+}
+
+// dashboardHtml renders /dashboard.json in browser and refreshes periodically.
+const dashboardHtml = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>kguard</title>
+<style>
+body { font-family: monospace; margin: 20px; }
+table { border-collapse: collapse; margin-bottom: 16px; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+th { background: #eee; }
+.alert { color: #c00; }
+.stale { color: #999; }
+</style>
+</head>
+<body>
+<h2 id="title">kguard</h2>
+<div id="summary"></div>
+<h3>Firing alerts</h3>
+<div id="alerts"></div>
+<h3>Gauges</h3>
+<div id="watchers"></div>
+<script>
+function esc(s) {
+  return String(s).replace(/[&<>"]/g, function(c) {
+    return {'&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;'}[c];
+  });
+}
+
+function ago(t) {
+  var s = Math.round((Date.now() - new Date(t).getTime()) / 1000);
+  if (s < 120) return s + 's ago';
+  if (s < 7200) return Math.round(s / 60) + 'm ago';
+  return Math.round(s / 3600) + 'h ago';
+}
+
+function render(d) {
+  document.getElementById('title').textContent = 'kguard ' + d.zone;
+  document.getElementById('summary').innerHTML = 'leader: ' + d.leader + ', version: ' + esc(d.version) +
+    ', sampled: ' + (d.sampled_at.indexOf('0001') == 0 ? 'never' : ago(d.sampled_at));
+
+  var h = '';
+  if (d.alerts.length == 0) {
+    h = 'none';
+  } else {
+    h = '<table><tr><th>Name</th><th>Severity</th><th>Since</th><th>Acked</th><th>Message</th></tr>';
+    d.alerts.forEach(function(a) {
+      h += '<tr class="alert"><td>' + esc(a.name) + '</td><td>' + esc(a.severity) + '</td><td>' +
+        ago(a.since) + '</td><td>' + (a.acked ? esc(a.acked_by || 'yes') : 'no') + '</td><td>' +
+        esc(a.message) + '</td></tr>';
+    });
+    h += '</table>';
+  }
+  document.getElementById('alerts').innerHTML = h;
+
+  h = '';
+  d.watchers.forEach(function(w) {
+    h += '<table><tr><th colspan="3">' + esc(w.watcher || 'others') + '</th></tr>';
+    w.gauges.forEach(function(g) {
+      h += '<tr><td>' + esc(g.name) + '</td><td>' + esc(g.value) + '</td><td class="stale">changed ' +
+        ago(g.changed_at) + '</td></tr>';
+    });
+    h += '</table>';
+  });
+  document.getElementById('watchers').innerHTML = h || 'no gauges, standby kguard runs no watchers';
+}
+
+function refresh() {
+  var xhr = new XMLHttpRequest();
+  xhr.onload = function() { render(JSON.parse(xhr.responseText)); };
+  xhr.open('GET', 'dashboard.json');
+  xhr.send();
+}
+
+refresh();
+setInterval(refresh, 10000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,165 @@
+package monitor
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/telemetry"
+	"github.com/funkygao/go-metrics"
+)
+
+// downsampler is the aggregation stage between the watchers and the telemetry reporter.
+//
+// A zone has thousands of topic level gauges, most of which barely change, and each of them
+// used to be persisted on every flush. The downsampler samples the gauges into a short
+// in-memory history, and the reporter gets a telemetry.Aggregate of min/max/avg of the
+// samples of each flush interval instead of the gauge. An aggregate unchanged since last
+// emitted is suppressed, but still emitted every heartbeat flushes so that the series
+// does not look dead.
+//
+// Metrics other than gauges pass through.
+type downsampler struct {
+	metrics.Registry
+
+	maxSamples int // history of a gauge within a flush interval
+	heartbeat  int
+
+	mu     sync.Mutex
+	series map[string]*gaugeSeries
+}
+
+type gaugeSeries struct {
+	samples []float64 // since last flush, the latest maxSamples
+	integer bool
+
+	emitted *telemetry.Aggregate // nil if never emitted
+	skipped int                  // flushes suppressed since last emitted
+}
+
+func newDownsampler(r metrics.Registry, maxSamples, heartbeat int) *downsampler {
+	return &downsampler{
+		Registry:   r,
+		maxSamples: maxSamples,
+		heartbeat:  heartbeat,
+		series:     make(map[string]*gaugeSeries),
+	}
+}
+
+func gaugeValue(i interface{}) (v float64, integer bool, ok bool) {
+	switch m := i.(type) {
+	case metrics.Gauge:
+		return float64(m.Value()), true, true
+
+	case metrics.GaugeFloat64:
+		return m.Value(), false, true
+	}
+
+	return 0, false, false
+}
+
+func (this *downsampler) seriesOf(name string) *gaugeSeries {
+	s, present := this.series[name]
+	if !present {
+		s = &gaugeSeries{samples: make([]float64, 0, this.maxSamples)}
+		this.series[name] = s
+	}
+	return s
+}
+
+// sample records the current value of each gauge.
+func (this *downsampler) sample() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.Registry.Each(func(name string, i interface{}) {
+		v, _, ok := gaugeValue(i)
+		if !ok || strings.HasPrefix(name, "_") {
+			return
+		}
+
+		s := this.seriesOf(name)
+		if len(s.samples) >= this.maxSamples {
+			copy(s.samples, s.samples[1:])
+			s.samples = s.samples[:len(s.samples)-1]
+		}
+		s.samples = append(s.samples, v)
+	})
+}
+
+func (this *downsampler) run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+
+		case <-ticker.C:
+			this.sample()
+		}
+	}
+}
+
+// Each is called by the reporter on each flush, the gauges are replaced with the aggregate
+// of the flush interval.
+func (this *downsampler) Each(f func(string, interface{})) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	seen := make(map[string]struct{}, len(this.series))
+	this.Registry.Each(func(name string, i interface{}) {
+		v, integer, ok := gaugeValue(i)
+		if !ok || strings.HasPrefix(name, "_") {
+			f(name, i)
+			return
+		}
+
+		seen[name] = struct{}{}
+		s := this.seriesOf(name)
+		s.integer = integer
+		a := s.aggregate(v)
+		if s.emitted != nil && s.emitted.Min == a.Min && s.emitted.Max == a.Max && s.emitted.Avg == a.Avg &&
+			s.skipped+1 < this.heartbeat {
+			s.skipped++
+			return
+		}
+
+		s.emitted, s.skipped = a, 0
+		f(name, a)
+	})
+
+	// forget the unregistered gauges
+	for name := range this.series {
+		if _, present := seen[name]; !present {
+			delete(this.series, name)
+		}
+	}
+}
+
+// aggregate returns the aggregate of the samples and the current value, and resets the samples.
+func (this *gaugeSeries) aggregate(current float64) *telemetry.Aggregate {
+	this.samples = append(this.samples, current)
+	a := &telemetry.Aggregate{
+		Min:     current,
+		Max:     current,
+		Samples: len(this.samples),
+		Integer: this.integer,
+	}
+
+	var sum float64
+	for _, v := range this.samples {
+		if v < a.Min {
+			a.Min = v
+		}
+		if v > a.Max {
+			a.Max = v
+		}
+		sum += v
+	}
+	a.Avg = sum / float64(len(this.samples))
+
+	this.samples = this.samples[:0]
+	return a
+}
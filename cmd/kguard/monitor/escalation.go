@@ -0,0 +1,194 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/funkygao/log4go"
+)
+
+type severity int
+
+const (
+	severityInfo severity = iota
+	severityWarn
+	severityCritical
+)
+
+var severityNames = []string{"info", "warn", "critical"}
+
+func (s severity) String() string {
+	return severityNames[s]
+}
+
+// parseSeverity accepts the kguard severity names as well as those of zabbix.
+func parseSeverity(s string) (severity, error) {
+	switch strings.ToLower(s) {
+	case "info", "information", "not classified":
+		return severityInfo, nil
+
+	case "warn", "warning", "average":
+		return severityWarn, nil
+
+	case "critical", "high", "disaster":
+		return severityCritical, nil
+	}
+
+	return severityInfo, fmt.Errorf("invalid severity: %s", s)
+}
+
+// escalationStep notifies the sink if an alert stays firing and unacked for the duration.
+type escalationStep struct {
+	after time.Duration
+	sink  alertSink
+}
+
+type escalationSteps []escalationStep
+
+func (s escalationSteps) Len() int           { return len(s) }
+func (s escalationSteps) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s escalationSteps) Less(i, j int) bool { return s[i].after < s[j].after }
+
+// alertPolicy decides the severity of each alert and the escalation chain of each severity.
+type alertPolicy struct {
+	severities  map[string]severity // alert name:severity, overrides the posted one
+	escalations map[severity]escalationSteps
+}
+
+func defaultAlertPolicy() *alertPolicy {
+	return &alertPolicy{
+		severities:  make(map[string]severity),
+		escalations: make(map[severity]escalationSteps),
+	}
+}
+
+// severityOf returns the configured severity of the alert, the posted one if not configured.
+// Posted alerts of unknown severity are treated as warn.
+func (this *alertPolicy) severityOf(name, posted string) severity {
+	if s, present := this.severities[name]; present {
+		return s
+	}
+
+	s, err := parseSeverity(posted)
+	if err != nil {
+		return severityWarn
+	}
+	return s
+}
+
+func (this *alertPolicy) addEscalation(s severity, step escalationStep) {
+	this.escalations[s] = append(this.escalations[s], step)
+	sort.Sort(this.escalations[s])
+}
+
+// alertSink is where escalated alerts go, e,g. IM group or phone call.
+type alertSink interface {
+	notify(evt alertEvent) error
+}
+
+// newAlertSink creates sink from spec: log | exec:<script> | http(s)://<webhook>
+func newAlertSink(spec string) (alertSink, error) {
+	switch {
+	case spec == "log":
+		return logSink{}, nil
+
+	case strings.HasPrefix(spec, "exec:") && len(spec) > len("exec:"):
+		return execSink{script: strings.TrimPrefix(spec, "exec:")}, nil
+
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return httpSink{url: spec}, nil
+	}
+
+	return nil, fmt.Errorf("invalid sink: %s", spec)
+}
+
+type logSink struct{}
+
+func (logSink) notify(evt alertEvent) error {
+	switch evt.level {
+	case severityCritical:
+		log.Critical("alert[%s] firing since %s: %s", evt.Name, evt.Since, evt.Message)
+	case severityWarn:
+		log.Warn("alert[%s] firing since %s: %s", evt.Name, evt.Since, evt.Message)
+	default:
+		log.Info("alert[%s] firing since %s: %s", evt.Name, evt.Since, evt.Message)
+	}
+	return nil
+}
+
+// execSink runs the script with alert name, severity and message as arguments.
+type execSink struct {
+	script string
+}
+
+func (this execSink) notify(evt alertEvent) error {
+	out, err := exec.Command(this.script, evt.Name, evt.Severity, evt.Message).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v %s", this.script, err, string(out))
+	}
+	return nil
+}
+
+// httpSink posts the alert event json to the webhook.
+type httpSink struct {
+	url string
+}
+
+var alertSinkClient = &http.Client{Timeout: time.Second * 10}
+
+func (this httpSink) notify(evt alertEvent) error {
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+
+	resp, err := alertSinkClient.Post(this.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", this.url, resp.Status)
+	}
+	return nil
+}
+
+// escalate notifies the sinks of the due escalation steps of firing alerts not yet acked.
+func (this *dashboard) escalate(now time.Time) {
+	type notification struct {
+		evt  alertEvent
+		sink alertSink
+	}
+
+	var due []notification
+	this.mu.Lock()
+	for name, evt := range this.alerts {
+		if evt.Acked {
+			continue
+		}
+
+		steps := this.policy.escalations[evt.level]
+		for evt.Escalated < len(steps) && now.Sub(evt.Since) >= steps[evt.Escalated].after {
+			due = append(due, notification{evt: evt, sink: steps[evt.Escalated].sink})
+			evt.Escalated++
+		}
+		this.alerts[name] = evt
+	}
+	this.mu.Unlock()
+
+	for _, n := range due {
+		// a slow sink must not block the others
+		go func(n notification) {
+			if err := n.sink.notify(n.evt); err != nil {
+				log.Error("alert[%s] escalation: %v", n.evt.Name, err)
+			}
+		}(n)
+	}
+}
@@ -0,0 +1,153 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestParseSeverity(t *testing.T) {
+	cases := []struct {
+		s        string
+		expected severity
+		valid    bool
+	}{
+		{"info", severityInfo, true},
+		{"Information", severityInfo, true},
+		{"not classified", severityInfo, true},
+		{"warn", severityWarn, true},
+		{"WARNING", severityWarn, true},
+		{"average", severityWarn, true},
+		{"critical", severityCritical, true},
+		{"high", severityCritical, true},
+		{"Disaster", severityCritical, true},
+		{"", severityInfo, false},
+		{"fatal", severityInfo, false},
+	}
+	for _, c := range cases {
+		s, err := parseSeverity(c.s)
+		assert.Equal(t, c.expected, s)
+		assert.Equal(t, c.valid, err == nil)
+	}
+}
+
+func TestAlertPolicySeverityOf(t *testing.T) {
+	policy := defaultAlertPolicy()
+	policy.severities["brokers.dead"] = severityCritical
+
+	assert.Equal(t, severityCritical, policy.severityOf("brokers.dead", "info")) // overridden
+	assert.Equal(t, severityCritical, policy.severityOf("brokers.dead", ""))
+	assert.Equal(t, severityInfo, policy.severityOf("lag", "information"))
+	assert.Equal(t, severityWarn, policy.severityOf("lag", "bogus")) // unknown posted
+}
+
+func TestNewAlertSink(t *testing.T) {
+	cases := []struct {
+		spec     string
+		expected alertSink
+	}{
+		{"log", logSink{}},
+		{"exec:/opt/bin/phonecall", execSink{script: "/opt/bin/phonecall"}},
+		{"http://im.foo.com/hook", httpSink{url: "http://im.foo.com/hook"}},
+		{"https://im.foo.com/hook", httpSink{url: "https://im.foo.com/hook"}},
+		{"", nil},
+		{"exec:", nil},
+		{"phonecall", nil},
+		{"ftp://foo.com", nil},
+	}
+	for _, c := range cases {
+		sink, err := newAlertSink(c.spec)
+		assert.Equal(t, c.expected, sink)
+		assert.Equal(t, c.expected != nil, err == nil)
+	}
+}
+
+// fakeSink records the notified alerts of an escalation step.
+type fakeSink struct {
+	step     string
+	notified chan string
+}
+
+func (this fakeSink) notify(evt alertEvent) error {
+	this.notified <- this.step + ":" + evt.Name
+	return nil
+}
+
+func TestDashboardEscalate(t *testing.T) {
+	notified := make(chan string, 10)
+	policy := defaultAlertPolicy()
+	policy.addEscalation(severityCritical, escalationStep{after: time.Minute * 10, sink: fakeSink{"phone", notified}})
+	policy.addEscalation(severityCritical, escalationStep{after: 0, sink: fakeSink{"im", notified}})
+	policy.severities["brokers.dead"] = severityCritical
+
+	d := newDashboard(nil)
+	d.setAlertPolicy(policy)
+
+	// notifications are sent asynchronously, in no particular order within a round
+	expect := func(expected ...string) {
+		got := make(map[string]bool)
+		for range expected {
+			select {
+			case n := <-notified:
+				got[n] = true
+			case <-time.After(time.Second):
+				t.Fatalf("expected %v, got %v", expected, got)
+			}
+		}
+		for _, n := range expected {
+			assert.Equal(t, true, got[n])
+		}
+
+		select {
+		case n := <-notified:
+			t.Fatalf("unexpected %s", n)
+		case <-time.After(time.Millisecond * 20):
+		}
+	}
+	sinceOf := func(name string) time.Time {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+		return d.alerts[name].Since
+	}
+
+	d.onAlert(alertEvent{Name: "brokers.dead", Status: "PROBLEM", Severity: "info"})
+	d.onAlert(alertEvent{Name: "lag", Status: "PROBLEM", Severity: "warn"}) // no chain of warn
+	since := sinceOf("brokers.dead")
+
+	d.escalate(since)
+	expect("im:brokers.dead")
+	d.escalate(since.Add(time.Minute))
+	expect() // each step notified once
+
+	// still firing, Since and escalation progress kept
+	d.onAlert(alertEvent{Name: "brokers.dead", Status: "PROBLEM"})
+	assert.Equal(t, since, sinceOf("brokers.dead"))
+	d.escalate(since.Add(time.Minute * 10))
+	expect("phone:brokers.dead")
+	d.escalate(since.Add(time.Hour))
+	expect() // chain exhausted
+
+	// acked alert escalates no more
+	d.onAlert(alertEvent{Name: "brokers.dead", Status: "OK"})
+	d.onAlert(alertEvent{Name: "brokers.dead", Status: "PROBLEM"})
+	since = sinceOf("brokers.dead")
+	assert.Equal(t, true, d.ackAlert("brokers.dead", "oncall"))
+	assert.Equal(t, false, d.ackAlert("not.firing", "oncall"))
+	d.escalate(since.Add(time.Hour))
+	expect()
+
+	// re-fire after resolved starts over the chain, the ack is gone
+	d.onAlert(alertEvent{Name: "brokers.dead", Status: "RESOLVED"})
+	d.onAlert(alertEvent{Name: "brokers.dead", Status: "PROBLEM"})
+	since = sinceOf("brokers.dead")
+	d.escalate(since.Add(time.Hour))
+	expect("im:brokers.dead", "phone:brokers.dead")
+	for _, a := range d.firingAlerts() {
+		if a.Name == "brokers.dead" {
+			assert.Equal(t, false, a.Acked)
+			assert.Equal(t, 2, a.Escalated)
+			assert.Equal(t, "critical", a.Severity)
+		}
+	}
+}
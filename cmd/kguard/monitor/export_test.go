@@ -0,0 +1,45 @@
+package monitor
+
+import (
+	"github.com/funkygao/go-metrics"
+)
+
+// NewTestMonitor creates a Monitor configured by the config file whose watchers run
+// against the zone, e,g. the fake zone of monitortest, without zookeeper and telemetry.
+func NewTestMonitor(zone Zone, configFile string) (*Monitor, error) {
+	this := &Monitor{
+		zone:       zone.Name(),
+		configFile: configFile,
+		zoneView:   zone,
+		registry:   newWatcherRegistry(metrics.NewRegistry()),
+		reloadCh:   make(chan struct{}, 1),
+	}
+	this.dashboard = newDashboard(this.registry)
+
+	conf, err := this.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	this.conf = conf
+	this.dashboard.setAlertPolicy(conf.alerts)
+	return this, nil
+}
+
+func (this *Monitor) StartWatchers() {
+	this.startWatchers()
+}
+
+func (this *Monitor) StopWatchers() {
+	this.stopWatchers()
+}
+
+// Reload is what SIGHUP triggers on the leader.
+func (this *Monitor) Reload() {
+	this.reload()
+}
+
+func (this *Monitor) FiringSeverity(name, posted string) string {
+	this.dashboard.mu.RLock()
+	defer this.dashboard.mu.RUnlock()
+	return this.dashboard.policy.severityOf(name, posted).String()
+}
@@ -17,7 +17,9 @@ import (
 	"github.com/funkygao/gafka"
 	"github.com/funkygao/gafka/ctx"
 	"github.com/funkygao/gafka/telemetry"
+	"github.com/funkygao/gafka/telemetry/graphite"
 	"github.com/funkygao/gafka/telemetry/influxdb"
+	"github.com/funkygao/gafka/telemetry/opentsdb"
 	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/go-metrics"
 	"github.com/funkygao/golib/signal"
@@ -30,44 +32,102 @@ import (
 type Monitor struct {
 	influxdbAddr   string
 	influxdbDbName string
+	reporter       string
+	graphiteAddr   string
+	opentsdbAddr   string
+	metricsPrefix  string
+	flushInterval  time.Duration
+	sampleInterval time.Duration
+	heartbeat      int
 	apiAddr        string
 	externalDir    string
+	zone           string
+	configFile     string
+
+	expectedKateways int
+	cleanupLeaks     bool
 
 	startedAt time.Time
 	leadAt    time.Time
 
-	router *httprouter.Router
-	zkzone *zk.ZkZone
+	router    *httprouter.Router
+	zkzone    *zk.ZkZone
+	zoneView  Zone // the zone as seen by watchers
+	registry  *watcherRegistry
+	dashboard *dashboard
+
+	downsampler *downsampler // nil if downsampling disabled
 
 	candidate *leadership.Candidate
 
+	conf     *config
 	watchers []Watcher
 
-	inflight *sync.WaitGroup
-	stop     chan struct{} // broadcast to all watchers to stop, but might restart again
-	quit     chan struct{}
-	quitOnce sync.Once
-	leader   bool
+	inflight    *sync.WaitGroup
+	stop        chan struct{} // leadership lost, but might restart again
+	watcherStop chan struct{} // broadcast to all watchers to stop
+	reloadCh    chan struct{}
+	baseMetrics map[string]struct{} // metrics registered before watchers start
+	quit        chan struct{}
+	quitOnce    sync.Once
+	leader      bool
 }
 
 func (this *Monitor) Init() {
-	var logFile, zone string
+	var logFile string
 	flag.StringVar(&logFile, "log", "stdout", "log filename")
-	flag.StringVar(&zone, "z", "", "zone, required")
+	flag.StringVar(&this.zone, "z", "", "zone, required")
+	flag.StringVar(&this.configFile, "conf", "", "watchers config file, run all watchers with defaults if empty")
 	flag.StringVar(&this.apiAddr, "http", ":10025", "api http server addr")
-	flag.StringVar(&this.influxdbAddr, "influxAddr", "", "influxdb addr, required")
-	flag.StringVar(&this.influxdbDbName, "db", "", "influxdb db name, required")
+	flag.StringVar(&this.influxdbAddr, "influxAddr", "", "influxdb addr, defaults to influxdb of the zone in ctx")
+	flag.StringVar(&this.influxdbDbName, "db", "", "influxdb db name, defaults to influxdb_name of the zone in ctx")
+	flag.StringVar(&this.reporter, "reporter", "influxdb", "metrics reporter: influxdb|graphite|opentsdb")
+	flag.StringVar(&this.graphiteAddr, "graphiteAddr", "", "graphite carbon plaintext addr, required if reporter is graphite")
+	flag.StringVar(&this.opentsdbAddr, "opentsdbAddr", "", "opentsdb http addr, required if reporter is opentsdb")
+	flag.StringVar(&this.metricsPrefix, "prefix", "kguard", "metrics name prefix for graphite|opentsdb")
+	flag.DurationVar(&this.flushInterval, "flush", time.Minute, "metrics flush interval of the reporter")
+	flag.DurationVar(&this.sampleInterval, "sample", 0, "sample gauges at the interval and flush min/max/avg of each flush interval, 0 to disable downsampling")
+	flag.IntVar(&this.heartbeat, "heartbeat", 10, "with downsampling, unchanged gauges are still flushed every n flushes")
 	flag.StringVar(&this.externalDir, "confd", "", "external script config dir")
+	flag.IntVar(&this.expectedKateways, "kateways", 0, "expected kateway instances deployed in the zone, 0 to skip the check")
+	flag.BoolVar(&this.cleanupLeaks, "cleanup", false, "delete registration znodes of confirmed dead kateway instances")
 	flag.Parse()
 
-	if zone == "" || this.influxdbDbName == "" || this.influxdbAddr == "" {
-		panic("zone or influxdb empty, run help ")
+	if this.zone == "" {
+		panic("zone empty, run help ")
 	}
 
 	ctx.LoadFromHome()
-	this.zkzone = zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
+
+	// influxdb of the zone in ctx is the default
+	influxAddr, influxDB := ctx.ZoneInfluxDB(this.zone)
+	if this.influxdbAddr == "" {
+		this.influxdbAddr = influxAddr
+	}
+	if this.influxdbDbName == "" {
+		this.influxdbDbName = influxDB
+	}
+	if this.reporter == "influxdb" && (this.influxdbDbName == "" || this.influxdbAddr == "") {
+		panic("influxdb empty, run help ")
+	}
+	this.registry = newWatcherRegistry(metrics.DefaultRegistry)
+	metrics.DefaultRegistry = this.registry
+	this.dashboard = newDashboard(this.registry)
+	this.zkzone = zk.NewSharedZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	this.zoneView = ZoneOf(this.zkzone)
 	this.watchers = make([]Watcher, 0, 10)
 	this.quit = make(chan struct{})
+	this.reloadCh = make(chan struct{}, 1)
+
+	this.conf = defaultConfig()
+	if this.configFile != "" {
+		conf, err := loadConfig(this.configFile, this.zone)
+		if err != nil {
+			panic(err)
+		}
+		this.conf = conf
+	}
+	this.dashboard.setAlertPolicy(this.conf.alerts)
 
 	// export RESTful api
 	this.setupRoutes()
@@ -83,11 +143,54 @@ func (this *Monitor) Init() {
 		log.AddFilter("file", log.TRACE, filer)
 	}
 
-	rc, err := influxdb.NewConfig(this.influxdbAddr, this.influxdbDbName, "", "", time.Minute)
+	reporter, err := this.createReporter()
 	if err != nil {
 		panic(err)
 	}
-	telemetry.Default = influxdb.New(metrics.DefaultRegistry, rc)
+	telemetry.Default = reporter
+}
+
+// createReporter creates the telemetry reporter to which all metrics are flushed, through
+// the downsampler if -sample is given.
+// influxquery watchers still query influxdb if -influxAddr is given.
+func (this *Monitor) createReporter() (telemetry.Reporter, error) {
+	var reg metrics.Registry = metrics.DefaultRegistry
+	if this.sampleInterval > 0 {
+		if this.sampleInterval >= this.flushInterval {
+			return nil, fmt.Errorf("sample interval %s must be shorter than flush interval %s",
+				this.sampleInterval, this.flushInterval)
+		}
+
+		this.downsampler = newDownsampler(metrics.DefaultRegistry,
+			int(this.flushInterval/this.sampleInterval), this.heartbeat)
+		reg = this.downsampler
+	}
+
+	switch this.reporter {
+	case "influxdb":
+		rc, err := influxdb.NewConfig(this.influxdbAddr, this.influxdbDbName, "", "", this.flushInterval)
+		if err != nil {
+			return nil, err
+		}
+		return influxdb.New(reg, rc), nil
+
+	case "graphite":
+		rc, err := graphite.NewConfig(this.graphiteAddr, this.metricsPrefix, this.flushInterval)
+		if err != nil {
+			return nil, err
+		}
+		return graphite.New(reg, rc), nil
+
+	case "opentsdb":
+		rc, err := opentsdb.NewConfig(this.opentsdbAddr, this.metricsPrefix, this.flushInterval)
+		if err != nil {
+			return nil, err
+		}
+		return opentsdb.New(reg, rc), nil
+
+	default:
+		return nil, fmt.Errorf("unknown reporter: %s", this.reporter)
+	}
 }
 
 func (this *Monitor) Stop() {
@@ -127,11 +230,80 @@ func (this *Monitor) Start() {
 		}
 	}()
 
+	if this.downsampler != nil {
+		go this.downsampler.run(this.sampleInterval, this.stop)
+	}
+
+	this.startWatchers()
+	for {
+		select {
+		case <-this.stop:
+			this.stopWatchers()
+			return
+
+		case <-this.reloadCh:
+			this.reload()
+		}
+	}
+}
+
+// reload restarts all watchers with the reloaded config, keeps them running as is if
+// the config is invalid.
+func (this *Monitor) reload() {
+	conf, err := this.loadConfig()
+	if err != nil {
+		log.Error("reload %s: %v, watchers unchanged", this.configFile, err)
+		return
+	}
+
+	log.Info("config reloaded, restarting all watchers...")
+	this.stopWatchers()
+	this.conf = conf
+	this.dashboard.setAlertPolicy(conf.alerts)
+	this.startWatchers()
+}
+
+func (this *Monitor) loadConfig() (*config, error) {
+	if this.configFile == "" {
+		return defaultConfig(), nil
+	}
+
+	return loadConfig(this.configFile, this.zone)
+}
+
+func (this *Monitor) startWatchers() {
+	if this.baseMetrics == nil {
+		this.baseMetrics = make(map[string]struct{})
+		metrics.DefaultRegistry.Each(func(name string, _ interface{}) {
+			this.baseMetrics[name] = struct{}{}
+		})
+	} else {
+		// watchers register metrics on Run, unregister those of the previous run
+		// so that the restarted watchers can register them again
+		var names []string
+		metrics.DefaultRegistry.Each(func(name string, _ interface{}) {
+			if _, present := this.baseMetrics[name]; !present {
+				names = append(names, name)
+			}
+		})
+		for _, name := range names {
+			metrics.DefaultRegistry.Unregister(name)
+		}
+	}
+
 	this.inflight = new(sync.WaitGroup)
+	this.watcherStop = make(chan struct{})
 	this.watchers = this.watchers[:0]
 	for name, watcherFactory := range registeredWatchers {
+		if !this.conf.enabled(name) {
+			log.Info("watcher[%s] disabled", name)
+			continue
+		}
+
 		watcher := watcherFactory()
+		this.conf.tune(name, watcher)
 		this.watchers = append(this.watchers, watcher)
+		this.registry.addWatcher(name, watcher)
 
 		watcher.Init(this)
 
@@ -142,8 +314,10 @@ func (this *Monitor) Start() {
 	}
 
 	log.Info("all watchers ready!")
+}
 
-	<-this.stop
+func (this *Monitor) stopWatchers() {
+	close(this.watcherStop)
 	this.inflight.Wait()
 
 	log.Info("all watchers stopped")
@@ -164,6 +338,19 @@ func (this *Monitor) ServeForever() {
 		})
 	}, syscall.SIGINT, syscall.SIGTERM)
 
+	signal.RegisterHandler(func(sig os.Signal) {
+		log.Info("kguard[%s@%s] received signal: %s, reloading %s", gafka.BuildId, gafka.BuiltAt,
+			strings.ToUpper(sig.String()), this.configFile)
+
+		select {
+		case this.reloadCh <- struct{}{}:
+		default:
+			// a reload is pending
+		}
+	}, syscall.SIGHUP)
+
+	go this.dashboard.run(this.quit)
+
 	// start the api server
 	apiServer := &http.Server{
 		Addr:    this.apiAddr,
@@ -221,8 +408,12 @@ func (this *Monitor) ZkZone() *zk.ZkZone {
 	return this.zkzone
 }
 
+func (this *Monitor) Zone() Zone {
+	return this.zoneView
+}
+
 func (this *Monitor) StopChan() <-chan struct{} {
-	return this.stop
+	return this.watcherStop
 }
 
 func (this *Monitor) Inflight() *sync.WaitGroup {
@@ -240,3 +431,11 @@ func (this *Monitor) InfluxDB() string {
 func (this *Monitor) ExternalDir() string {
 	return this.externalDir
 }
+
+func (this *Monitor) ExpectedKateways() int {
+	return this.expectedKateways
+}
+
+func (this *Monitor) CleanupLeaks() bool {
+	return this.cleanupLeaks
+}
@@ -0,0 +1,75 @@
+// Package monitortest provides a fake monitor.Context backed by an in-memory zone,
+// so that watchers can be covered by deterministic tests without zookeeper and kafka.
+package monitortest
+
+import (
+	"sync"
+
+	"github.com/funkygao/gafka/cmd/kguard/monitor"
+	"github.com/funkygao/gafka/zk"
+)
+
+// Context is a monitor.Context for tests.
+//
+// Watchers under test must use Zone() instead of ZkZone(), which is nil.
+type Context struct {
+	FakeZone *Zone
+
+	Influx, InfluxDbName string
+	External             string
+	Kateways             int
+	Cleanup              bool
+
+	stop     chan struct{}
+	inflight sync.WaitGroup
+}
+
+// NewContext creates a Context with an empty zone.
+func NewContext(zone string) *Context {
+	return &Context{
+		FakeZone: NewZone(zone),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Stop closes StopChan and waits for the running watchers to exit.
+func (this *Context) Stop() {
+	close(this.stop)
+	this.inflight.Wait()
+}
+
+func (this *Context) ZkZone() *zk.ZkZone {
+	return nil
+}
+
+func (this *Context) Zone() monitor.Zone {
+	return this.FakeZone
+}
+
+func (this *Context) StopChan() <-chan struct{} {
+	return this.stop
+}
+
+func (this *Context) Inflight() *sync.WaitGroup {
+	return &this.inflight
+}
+
+func (this *Context) InfluxAddr() string {
+	return this.Influx
+}
+
+func (this *Context) InfluxDB() string {
+	return this.InfluxDbName
+}
+
+func (this *Context) ExternalDir() string {
+	return this.External
+}
+
+func (this *Context) ExpectedKateways() int {
+	return this.Kateways
+}
+
+func (this *Context) CleanupLeaks() bool {
+	return this.Cleanup
+}
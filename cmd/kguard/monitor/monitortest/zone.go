@@ -0,0 +1,361 @@
+package monitortest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kguard/monitor"
+	"github.com/funkygao/gafka/zk"
+)
+
+// Zone is an in-memory monitor.Zone whose clusters are programmed by tests.
+type Zone struct {
+	name string
+
+	mu       sync.RWMutex
+	clusters map[string]*Cluster
+}
+
+func NewZone(name string) *Zone {
+	return &Zone{
+		name:     name,
+		clusters: make(map[string]*Cluster),
+	}
+}
+
+// AddCluster adds an empty kafka cluster to the zone, or returns the existing one.
+func (this *Zone) AddCluster(name string, public bool) *Cluster {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if c, present := this.clusters[name]; present {
+		return c
+	}
+
+	c := &Cluster{
+		name:            name,
+		public:          public,
+		brokers:         make(map[string]*zk.BrokerZnode),
+		groups:          make(map[string]*group),
+		topics:          make(map[string]int),
+		producerOffsets: make(map[string]map[string]int64),
+	}
+	this.clusters[name] = c
+	return c
+}
+
+func (this *Zone) Name() string {
+	return this.name
+}
+
+func (this *Zone) sortedClusters() []*Cluster {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	names := make([]string, 0, len(this.clusters))
+	for name := range this.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	r := make([]*Cluster, 0, len(names))
+	for _, name := range names {
+		r = append(r, this.clusters[name])
+	}
+	return r
+}
+
+func (this *Zone) ForSortedClusters(fn func(zkcluster monitor.Cluster)) {
+	for _, c := range this.sortedClusters() {
+		fn(c)
+	}
+}
+
+func (this *Zone) PublicClusters() []monitor.Cluster {
+	r := make([]monitor.Cluster, 0)
+	for _, c := range this.sortedClusters() {
+		if c.public {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+type committedOffset struct {
+	offset int64
+	mtime  time.Time
+}
+
+type group struct {
+	consumers map[string]*zk.ConsumerZnode          // consumerId:consumer
+	owners    map[string]map[string]string          // topic:partitionId:consumerId
+	offsets   map[string]map[string]committedOffset // topic:partitionId:offset
+}
+
+// Cluster is an in-memory monitor.Cluster.
+type Cluster struct {
+	name   string
+	public bool
+
+	mu              sync.RWMutex
+	roster          []zk.BrokerInfo
+	brokers         map[string]*zk.BrokerZnode // live brokers
+	groups          map[string]*group
+	topics          map[string]int              // topic:partitions
+	producerOffsets map[string]map[string]int64 // topic:partitionId:newest offset
+}
+
+// RegisterBroker adds a broker to the roster of the cluster.
+func (this *Cluster) RegisterBroker(id int, host string, port int) {
+	this.mu.Lock()
+	this.roster = append(this.roster, zk.BrokerInfo{Id: id, Host: host, Port: port})
+	this.mu.Unlock()
+}
+
+// StartBroker makes a broker live.
+func (this *Cluster) StartBroker(id int, host string, port int) {
+	bid := strconv.Itoa(id)
+	this.mu.Lock()
+	this.brokers[bid] = &zk.BrokerZnode{Id: bid, Host: host, Port: port}
+	this.mu.Unlock()
+}
+
+// StopBroker makes a live broker dead.
+func (this *Cluster) StopBroker(id int) {
+	this.mu.Lock()
+	delete(this.brokers, strconv.Itoa(id))
+	this.mu.Unlock()
+}
+
+func (this *Cluster) group(name string) *group {
+	g, present := this.groups[name]
+	if !present {
+		g = &group{
+			consumers: make(map[string]*zk.ConsumerZnode),
+			owners:    make(map[string]map[string]string),
+			offsets:   make(map[string]map[string]committedOffset),
+		}
+		this.groups[name] = g
+	}
+	return g
+}
+
+// AddGroup adds a consumer group without consumers.
+func (this *Cluster) AddGroup(name string) {
+	this.mu.Lock()
+	this.group(name)
+	this.mu.Unlock()
+}
+
+// StartConsumer adds an online consumer instance to the group, subscribing the topics.
+func (this *Cluster) StartConsumer(groupName, consumerId string, uptime time.Time, topics ...string) *zk.ConsumerZnode {
+	c := &zk.ConsumerZnode{
+		Id:           consumerId,
+		Version:      1,
+		Subscription: make(map[string]int),
+		Pattern:      "static",
+		Timestamp:    strconv.FormatInt(uptime.UnixNano()/int64(time.Millisecond), 10),
+	}
+	for _, topic := range topics {
+		c.Subscription[topic] = 1
+	}
+
+	this.mu.Lock()
+	this.group(groupName).consumers[consumerId] = c
+	this.mu.Unlock()
+	return c
+}
+
+// StopConsumer removes the consumer instance from the group along with its partition ownership.
+func (this *Cluster) StopConsumer(groupName, consumerId string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	g := this.group(groupName)
+	delete(g.consumers, consumerId)
+	for _, owners := range g.owners {
+		for partitionId, owner := range owners {
+			if owner == consumerId {
+				delete(owners, partitionId)
+			}
+		}
+	}
+}
+
+// Own assigns a partition of the topic to a consumer instance of the group.
+func (this *Cluster) Own(groupName, topic, partitionId, consumerId string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	g := this.group(groupName)
+	if _, present := g.owners[topic]; !present {
+		g.owners[topic] = make(map[string]string)
+	}
+	g.owners[topic][partitionId] = consumerId
+}
+
+// CommitOffset commits the consumer offset of the group at mtime.
+func (this *Cluster) CommitOffset(groupName, topic, partitionId string, offset int64, mtime time.Time) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	g := this.group(groupName)
+	if _, present := g.offsets[topic]; !present {
+		g.offsets[topic] = make(map[string]committedOffset)
+	}
+	g.offsets[topic][partitionId] = committedOffset{offset: offset, mtime: mtime}
+}
+
+// AddTopic registers a topic with partitions, or resets the partitions of an existing one.
+func (this *Cluster) AddTopic(topic string, partitions int) {
+	this.mu.Lock()
+	this.topics[topic] = partitions
+	this.mu.Unlock()
+}
+
+// DeleteTopic removes a topic.
+func (this *Cluster) DeleteTopic(topic string) {
+	this.mu.Lock()
+	delete(this.topics, topic)
+	this.mu.Unlock()
+}
+
+// SetProducerOffset sets the newest offset of the topic partition.
+func (this *Cluster) SetProducerOffset(topic, partitionId string, offset int64) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if _, present := this.producerOffsets[topic]; !present {
+		this.producerOffsets[topic] = make(map[string]int64)
+	}
+	this.producerOffsets[topic][partitionId] = offset
+}
+
+func (this *Cluster) Name() string {
+	return this.name
+}
+
+func (this *Cluster) ConsumerGroups() map[string]map[string]*zk.ConsumerZnode {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	r := make(map[string]map[string]*zk.ConsumerZnode, len(this.groups))
+	for name, g := range this.groups {
+		r[name] = make(map[string]*zk.ConsumerZnode, len(g.consumers))
+		for id, c := range g.consumers {
+			r[name][id] = c
+		}
+	}
+	return r
+}
+
+// ConsumersByGroup behaves the same as zk.ZkCluster: only partitions with an owner are returned,
+// and nothing if no broker is live.
+func (this *Cluster) ConsumersByGroup(groupPattern string) map[string][]zk.ConsumerMeta {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	r := make(map[string][]zk.ConsumerMeta)
+	if len(this.brokers) == 0 {
+		return r
+	}
+
+	for name, g := range this.groups {
+		if groupPattern != "" && !strings.Contains(name, groupPattern) {
+			continue
+		}
+
+		for topic, offsets := range g.offsets {
+			owners := g.owners[topic]
+			for partitionId, committed := range offsets {
+				owner, present := owners[partitionId]
+				if !present {
+					continue
+				}
+
+				producerOffset, present := this.producerOffsets[topic][partitionId]
+				if !present {
+					// unknown topic or partition
+					continue
+				}
+
+				r[name] = append(r[name], zk.ConsumerMeta{
+					Group:          name,
+					Online:         len(g.consumers) > 0,
+					Topic:          topic,
+					PartitionId:    partitionId,
+					Mtime:          zk.ZkTimestamp(committed.mtime.UnixNano() / int64(time.Millisecond)),
+					ConsumerZnode:  g.consumers[owner],
+					ConsumerOffset: committed.offset,
+					ProducerOffset: producerOffset,
+					Lag:            producerOffset - committed.offset,
+				})
+			}
+		}
+	}
+
+	return r
+}
+
+func (this *Cluster) ConsumerOffsetsOfGroup(groupName string) map[string]map[string]int64 {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	r := make(map[string]map[string]int64)
+	g, present := this.groups[groupName]
+	if !present {
+		return r
+	}
+
+	for topic, offsets := range g.offsets {
+		r[topic] = make(map[string]int64, len(offsets))
+		for partitionId, committed := range offsets {
+			r[topic][partitionId] = committed.offset
+		}
+	}
+	return r
+}
+
+func (this *Cluster) Brokers() map[string]*zk.BrokerZnode {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	r := make(map[string]*zk.BrokerZnode, len(this.brokers))
+	for id, b := range this.brokers {
+		r[id] = b
+	}
+	return r
+}
+
+func (this *Cluster) Roster() []zk.BrokerInfo {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	return append([]zk.BrokerInfo(nil), this.roster...)
+}
+
+func (this *Cluster) Topics() ([]string, error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	r := make([]string, 0, len(this.topics))
+	for topic := range this.topics {
+		r = append(r, topic)
+	}
+	sort.Strings(r)
+	return r, nil
+}
+
+func (this *Cluster) Partitions(topic string) []int32 {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	r := make([]int32, 0, this.topics[topic])
+	for i := 0; i < this.topics[topic]; i++ {
+		r = append(r, int32(i))
+	}
+	return r
+}
@@ -0,0 +1,114 @@
+package monitor
+
+import (
+	"encoding/json"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/funkygao/go-metrics"
+)
+
+// watcherRegistry wraps metrics.DefaultRegistry to remember which watcher registered
+// each metric, so that the dashboard can group metrics by watcher.
+//
+// Watchers register metrics with nil registry on Run, the owner is found by
+// looking up the watcher methods on the call stack.
+type watcherRegistry struct {
+	metrics.Registry
+
+	mu       sync.RWMutex
+	watchers map[string]string // method name prefix of watcher type: watcher name
+	owners   map[string]string // metric name: watcher name
+}
+
+func newWatcherRegistry(r metrics.Registry) *watcherRegistry {
+	return &watcherRegistry{
+		Registry: r,
+		watchers: make(map[string]string),
+		owners:   make(map[string]string),
+	}
+}
+
+// addWatcher must be called before the watcher runs.
+func (this *watcherRegistry) addWatcher(name string, w Watcher) {
+	t := reflect.TypeOf(w)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	this.mu.Lock()
+	this.watchers[t.PkgPath()+".(*"+t.Name()+")."] = name
+	this.watchers[t.PkgPath()+"."+t.Name()+"."] = name
+	this.mu.Unlock()
+}
+
+func (this *watcherRegistry) owner(metricName string) string {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.owners[metricName]
+}
+
+func (this *watcherRegistry) caller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	for {
+		frame, more := frames.Next()
+		for prefix, name := range this.watchers {
+			if strings.HasPrefix(frame.Function, prefix) {
+				return name
+			}
+		}
+
+		if !more {
+			return ""
+		}
+	}
+}
+
+func (this *watcherRegistry) setOwner(metricName, watcher string) {
+	if watcher == "" {
+		return
+	}
+
+	this.mu.Lock()
+	this.owners[metricName] = watcher
+	this.mu.Unlock()
+}
+
+func (this *watcherRegistry) Register(name string, i interface{}) error {
+	if err := this.Registry.Register(name, i); err != nil {
+		return err
+	}
+
+	this.setOwner(name, this.caller())
+	return nil
+}
+
+func (this *watcherRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	if m := this.Registry.Get(name); m != nil {
+		return m
+	}
+
+	this.setOwner(name, this.caller())
+	return this.Registry.GetOrRegister(name, i)
+}
+
+func (this *watcherRegistry) Unregister(name string) {
+	this.Registry.Unregister(name)
+
+	this.mu.Lock()
+	delete(this.owners, name)
+	this.mu.Unlock()
+}
+
+// MarshalJSON is not promoted from the embedded interface.
+func (this *watcherRegistry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(this.Registry)
+}
@@ -0,0 +1,200 @@
+package monitor_test
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kguard/monitor"
+	"github.com/funkygao/gafka/cmd/kguard/monitor/monitortest"
+)
+
+// watcherRun is what a started fakeWatcher saw.
+type watcherRun struct {
+	name     string
+	tick     time.Duration
+	keys     []string
+	clusters int
+}
+
+var (
+	runsMu  sync.Mutex
+	runs    []watcherRun
+	running = make(map[string]int)
+)
+
+// fakeWatcher records each start and stop.
+type fakeWatcher struct {
+	name string
+	Tick time.Duration
+	keys []string
+
+	stop <-chan struct{}
+	wg   *sync.WaitGroup
+}
+
+func (this *fakeWatcher) Set(key string) {
+	this.keys = append(this.keys, key)
+}
+
+func (this *fakeWatcher) Init(ctx monitor.Context) {
+	this.stop = ctx.StopChan()
+	this.wg = ctx.Inflight()
+
+	runsMu.Lock()
+	runs = append(runs, watcherRun{
+		name:     this.name,
+		tick:     this.Tick,
+		keys:     this.keys,
+		clusters: len(ctx.Zone().PublicClusters()),
+	})
+	runsMu.Unlock()
+}
+
+func (this *fakeWatcher) Run() {
+	defer this.wg.Done()
+
+	runsMu.Lock()
+	running[this.name]++
+	runsMu.Unlock()
+
+	<-this.stop
+
+	runsMu.Lock()
+	running[this.name]--
+	runsMu.Unlock()
+}
+
+func init() {
+	for _, name := range []string{"reload.a", "reload.b"} {
+		name := name
+		monitor.RegisterWatcher(name, func() monitor.Watcher {
+			return &fakeWatcher{name: name, Tick: time.Minute}
+		})
+	}
+}
+
+// takeRuns returns the watchers started since last call sorted by name.
+func takeRuns() []watcherRun {
+	runsMu.Lock()
+	defer runsMu.Unlock()
+
+	r := runs
+	runs = nil
+	sort.Sort(watcherRunsByName(r))
+	return r
+}
+
+type watcherRunsByName []watcherRun
+
+func (s watcherRunsByName) Len() int           { return len(s) }
+func (s watcherRunsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s watcherRunsByName) Less(i, j int) bool { return s[i].name < s[j].name }
+
+func runningWatchers() map[string]int {
+	runsMu.Lock()
+	defer runsMu.Unlock()
+
+	r := make(map[string]int)
+	for name, n := range running {
+		if n > 0 {
+			r[name] = n
+		}
+	}
+	return r
+}
+
+// waitRunning waits for the started watchers to Run.
+func waitRunning(t *testing.T, expected map[string]int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if len(runningWatchers()) == len(expected) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, expected, runningWatchers())
+}
+
+func TestMonitorReload(t *testing.T) {
+	ctx := monitortest.NewContext("test")
+	ctx.FakeZone.AddCluster("me", true)
+	ctx.FakeZone.AddCluster("internal", false)
+
+	f, err := ioutil.TempFile("", "kguard")
+	assert.Equal(t, nil, err)
+	f.Close()
+	defer os.Remove(f.Name())
+	writeConfig := func(content string) {
+		assert.Equal(t, nil, ioutil.WriteFile(f.Name(), []byte(content), 0644))
+	}
+
+	writeConfig(`
+{
+    watchers: [
+        {
+            name: "reload.a"
+            tick: "30s"
+            set: ["k:1"]
+        }
+        {
+            name: "reload.b"
+            zones: ["test"]
+            disabled: true
+        }
+    ]
+}
+`)
+	m, err := monitor.NewTestMonitor(ctx.FakeZone, f.Name())
+	assert.Equal(t, nil, err)
+	m.StartWatchers()
+	waitRunning(t, map[string]int{"reload.a": 1})
+	assert.Equal(t, []watcherRun{{name: "reload.a", tick: time.Second * 30, keys: []string{"k:1"}, clusters: 1}},
+		takeRuns())
+
+	// tick and keys changed, b enabled, alert severity added
+	writeConfig(`
+{
+    watchers: [
+        {
+            name: "reload.a"
+            tick: "10s"
+            set: ["k:2"]
+        }
+    ]
+    alerts: [
+        {
+            name: "brokers.dead"
+            severity: "critical"
+        }
+    ]
+}
+`)
+	m.Reload()
+	waitRunning(t, map[string]int{"reload.a": 1, "reload.b": 1})
+	assert.Equal(t, []watcherRun{
+		{name: "reload.a", tick: time.Second * 10, keys: []string{"k:2"}, clusters: 1},
+		{name: "reload.b", tick: time.Minute, clusters: 1},
+	}, takeRuns())
+	assert.Equal(t, "critical", m.FiringSeverity("brokers.dead", "info"))
+
+	// invalid config keeps the watchers running as is
+	writeConfig(`{watchers: [{name: "reload.a", tick: "-1s"}]}`)
+	m.Reload()
+	assert.Equal(t, 0, len(takeRuns()))
+	assert.Equal(t, map[string]int{"reload.a": 1, "reload.b": 1}, runningWatchers())
+	assert.Equal(t, "critical", m.FiringSeverity("brokers.dead", "info"))
+
+	// all disabled
+	writeConfig(`{default_enabled: false}`)
+	m.Reload()
+	waitRunning(t, map[string]int{})
+	assert.Equal(t, 0, len(takeRuns()))
+	assert.Equal(t, "info", m.FiringSeverity("brokers.dead", "info"))
+
+	m.StopWatchers()
+}
@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"github.com/funkygao/gafka/zk"
+)
+
+// Zone is the zookeeper zone as seen by watchers.
+// It is an interface so that watchers can be covered by tests against the in-memory
+// fake of package monitortest instead of a live zookeeper.
+type Zone interface {
+	Name() string
+
+	// ForSortedClusters iterates all the kafka clusters of the zone sorted by name.
+	ForSortedClusters(fn func(zkcluster Cluster))
+
+	// PublicClusters returns the kafka clusters open to kateway.
+	PublicClusters() []Cluster
+}
+
+// Cluster is a kafka cluster as seen by watchers.
+type Cluster interface {
+	Name() string
+
+	// ConsumerGroups returns {group: {consumerId: consumer}}, offline groups have no consumer.
+	ConsumerGroups() map[string]map[string]*zk.ConsumerZnode
+
+	// ConsumersByGroup returns the partitions with an owner of each group, along with offsets and lag.
+	ConsumersByGroup(groupPattern string) map[string][]zk.ConsumerMeta
+
+	// ConsumerOffsetsOfGroup returns {topic: {partitionId: offset}}.
+	ConsumerOffsetsOfGroup(group string) map[string]map[string]int64
+
+	// Brokers returns live {brokerId: broker}.
+	Brokers() map[string]*zk.BrokerZnode
+
+	// Roster returns the manually registered brokers.
+	Roster() []zk.BrokerInfo
+
+	// Topics returns the registered topics.
+	Topics() ([]string, error)
+
+	// Partitions returns the partition ids of a topic.
+	Partitions(topic string) []int32
+}
+
+// ZoneOf adapts a live zookeeper zone to Zone.
+func ZoneOf(zkzone *zk.ZkZone) Zone {
+	return zkZone{zkzone}
+}
+
+type zkZone struct {
+	*zk.ZkZone
+}
+
+func (this zkZone) ForSortedClusters(fn func(zkcluster Cluster)) {
+	this.ZkZone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+		fn(zkCluster{zkcluster})
+	})
+}
+
+func (this zkZone) PublicClusters() []Cluster {
+	clusters := this.ZkZone.PublicClusters()
+	r := make([]Cluster, 0, len(clusters))
+	for _, c := range clusters {
+		r = append(r, zkCluster{c})
+	}
+	return r
+}
+
+type zkCluster struct {
+	*zk.ZkCluster
+}
+
+func (this zkCluster) Roster() []zk.BrokerInfo {
+	return this.RegisteredInfo().Roster
+}
@@ -0,0 +1,294 @@
+package anomaly
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/cmd/kguard/monitor"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/go-metrics"
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	hoursPerWeek = 24 * 7
+	secondsWeek  = hoursPerWeek * 3600
+)
+
+func init() {
+	monitor.RegisterWatcher("anomaly.pubrate", func() monitor.Watcher {
+		return &WatchPubRate{
+			Tick:       time.Minute,
+			K:          3,
+			MinRate:    1,
+			MinSamples: 10,
+		}
+	})
+}
+
+// WatchPubRate watches per topic message-in rate and flags topics whose rate
+// drops to zero or deviates by more than K·σ from the same hour last week.
+//
+// It catches upstream producer outages that no lag based alert would ever see.
+type WatchPubRate struct {
+	Zkzone *zk.ZkZone
+	Stop   <-chan struct{}
+	Tick   time.Duration
+	Wg     *sync.WaitGroup
+
+	K          float64 // deviation threshold in σ
+	MinRate    float64 // topics with last week rate below this are regarded idle and never flagged
+	MinSamples int     // min samples of the same hour last week to evaluate deviation
+
+	lastOffsets map[string]int64      // cluster/topic:offset
+	rates       map[string]*topicRate // cluster/topic:rate history
+}
+
+func (this *WatchPubRate) Init(ctx monitor.Context) {
+	this.Zkzone = ctx.ZkZone()
+	this.Stop = ctx.StopChan()
+	this.Wg = ctx.Inflight()
+}
+
+// set?key=pubrate-k:4
+func (this *WatchPubRate) Set(key string) {
+	tuples := strings.SplitN(key, ":", 2)
+	if len(tuples) != 2 {
+		return
+	}
+
+	switch tuples[0] {
+	case "pubrate-k":
+		if f, err := strconv.ParseFloat(tuples[1], 64); err == nil && f > 0 {
+			this.K = f
+			log.Info("anomaly.pubrate K set to %f", f)
+		}
+
+	case "pubrate-min":
+		if f, err := strconv.ParseFloat(tuples[1], 64); err == nil && f >= 0 {
+			this.MinRate = f
+			log.Info("anomaly.pubrate MinRate set to %f", f)
+		}
+
+	case "pubrate-samples":
+		if n, err := strconv.Atoi(tuples[1]); err == nil && n > 0 {
+			this.MinSamples = n
+			log.Info("anomaly.pubrate MinSamples set to %d", n)
+		}
+	}
+}
+
+func (this *WatchPubRate) Run() {
+	defer this.Wg.Done()
+
+	ticker := time.NewTicker(this.Tick)
+	defer ticker.Stop()
+
+	this.lastOffsets = make(map[string]int64, 100)
+	this.rates = make(map[string]*topicRate, 100)
+
+	zeroRate := metrics.NewRegisteredGauge("pubrate.zero", nil)
+	deviated := metrics.NewRegisteredGauge("pubrate.deviated", nil)
+	for {
+		select {
+		case <-this.Stop:
+			log.Info("anomaly.pubrate stopped")
+			return
+
+		case now := <-ticker.C:
+			z, d := this.check(now)
+			zeroRate.Update(z)
+			deviated.Update(d)
+		}
+	}
+}
+
+func (this *WatchPubRate) check(now time.Time) (zeroN, deviatedN int64) {
+	for key, offset := range this.topicOffsets() {
+		lastOffset, present := this.lastOffsets[key]
+		this.lastOffsets[key] = offset
+		if !present {
+			// first run
+			continue
+		}
+
+		delta := offset - lastOffset
+		if delta < 0 {
+			log.Warn("anomaly.pubrate %s offset backwards, skipped: %d <- %d", key, offset, lastOffset)
+			continue
+		}
+
+		tr, present := this.rates[key]
+		if !present {
+			tr = &topicRate{}
+			this.rates[key] = tr
+		}
+
+		rate := float64(delta) / this.Tick.Seconds()
+		switch tr.eval(now, rate, this.K, this.MinRate, this.MinSamples) {
+		case rateZero:
+			zeroN++
+			log.Warn("anomaly.pubrate %s rate dropped to zero, last week %.1f/s", key, tr.baseline(now).mean())
+
+		case rateDeviated:
+			deviatedN++
+			b := tr.baseline(now)
+			log.Warn("anomaly.pubrate %s rate %.1f/s deviates from last week %.1f±%.1f/s",
+				key, rate, b.mean(), b.stddev())
+		}
+
+		tr.record(now, rate)
+	}
+
+	return
+}
+
+// topicOffsets returns the sum of latest offsets of each topic in the zone.
+func (this *WatchPubRate) topicOffsets() map[string]int64 {
+	r := make(map[string]int64, len(this.lastOffsets))
+	this.Zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+		kfk, err := sarama.NewClient(zkcluster.BrokerList(), sarama.NewConfig())
+		if err != nil {
+			log.Error("cluster[%s] %v", zkcluster.Name(), err)
+			return
+		}
+		defer kfk.Close()
+
+		topics, err := kfk.Topics()
+		if err != nil {
+			log.Error("cluster[%s] %v", zkcluster.Name(), err)
+			return
+		}
+
+		for _, topic := range topics {
+			partitions, err := kfk.Partitions(topic)
+			if err != nil {
+				log.Error("cluster[%s] topic:%s %v", zkcluster.Name(), topic, err)
+				continue
+			}
+
+			var total int64
+			for _, partitionID := range partitions {
+				latestOffset, err := kfk.GetOffset(topic, partitionID, sarama.OffsetNewest)
+				if err != nil {
+					log.Error("cluster[%s] topic[%s/%d]: %v", zkcluster.Name(), topic, partitionID, err)
+					continue
+				}
+
+				total += latestOffset
+			}
+
+			r[zkcluster.Name()+"/"+topic] = total
+		}
+	})
+
+	return r
+}
+
+type rateVerdict int
+
+const (
+	rateNormal rateVerdict = iota
+	rateZero
+	rateDeviated
+)
+
+// rateStat accumulates rate samples to calculate mean and standard deviation.
+type rateStat struct {
+	n          int
+	sum, sumSq float64
+}
+
+func (s *rateStat) add(v float64) {
+	s.n++
+	s.sum += v
+	s.sumSq += v * v
+}
+
+func (s rateStat) mean() float64 {
+	if s.n == 0 {
+		return 0
+	}
+	return s.sum / float64(s.n)
+}
+
+func (s rateStat) stddev() float64 {
+	if s.n < 2 {
+		return 0
+	}
+
+	mean := s.mean()
+	variance := s.sumSq/float64(s.n) - mean*mean
+	if variance < 0 {
+		// float rounding
+		return 0
+	}
+	return math.Sqrt(variance)
+}
+
+// hourBucket holds rate samples of an hour of week for this week and last week.
+type hourBucket struct {
+	week          int64
+	current, prev rateStat
+}
+
+// topicRate is the rate history of a topic bucketed by hour of week.
+type topicRate struct {
+	buckets [hoursPerWeek]hourBucket
+}
+
+func weekOf(t time.Time) (week int64, hour int) {
+	sec := t.Unix()
+	return sec / secondsWeek, int(sec%secondsWeek) / 3600
+}
+
+// bucket returns the bucket of t with this week/last week rotated.
+func (this *topicRate) bucket(t time.Time) *hourBucket {
+	week, hour := weekOf(t)
+	b := &this.buckets[hour]
+	if b.week != week {
+		if b.week == week-1 {
+			b.prev = b.current
+		} else {
+			b.prev = rateStat{}
+		}
+		b.current = rateStat{}
+		b.week = week
+	}
+
+	return b
+}
+
+func (this *topicRate) baseline(t time.Time) rateStat {
+	return this.bucket(t).prev
+}
+
+func (this *topicRate) record(t time.Time, rate float64) {
+	this.bucket(t).current.add(rate)
+}
+
+func (this *topicRate) eval(t time.Time, rate, k, minRate float64, minSamples int) rateVerdict {
+	last := this.baseline(t)
+	if last.n == 0 || last.mean() < minRate {
+		// no history or idle topic
+		return rateNormal
+	}
+
+	if rate == 0 {
+		return rateZero
+	}
+
+	if last.n < minSamples {
+		return rateNormal
+	}
+
+	if sigma := last.stddev(); sigma > 0 && math.Abs(rate-last.mean()) > k*sigma {
+		return rateDeviated
+	}
+
+	return rateNormal
+}
@@ -0,0 +1,42 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestRateStat(t *testing.T) {
+	var s rateStat
+	for _, v := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		s.add(v)
+	}
+	assert.Equal(t, 5., s.mean())
+	assert.Equal(t, 2., s.stddev())
+}
+
+func TestTopicRateEval(t *testing.T) {
+	var tr topicRate
+	lastWeek := time.Date(2016, 10, 10, 14, 0, 0, 0, time.UTC)
+	for i := 0; i < 30; i++ {
+		rate := 100.
+		if i%2 == 0 {
+			rate = 110.
+		}
+		tr.record(lastWeek.Add(time.Minute*time.Duration(i)), rate)
+	}
+
+	now := lastWeek.Add(time.Hour * 24 * 7)
+	assert.Equal(t, 30, tr.baseline(now).n)
+	assert.Equal(t, rateNormal, tr.eval(now, 104, 3, 1, 10))
+	assert.Equal(t, rateZero, tr.eval(now, 0, 3, 1, 10))
+	assert.Equal(t, rateDeviated, tr.eval(now, 200, 3, 1, 10))
+	assert.Equal(t, rateDeviated, tr.eval(now, 50, 3, 1, 10))
+
+	// idle topic is never flagged
+	assert.Equal(t, rateNormal, tr.eval(now, 0, 3, 1000, 10))
+
+	// no history 2 weeks later
+	assert.Equal(t, rateNormal, tr.eval(now.Add(time.Hour*24*7), 0, 3, 1, 10))
+}
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/funkygao/gafka/cmd/kguard/monitor"
-	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/go-metrics"
 	log "github.com/funkygao/log4go"
 )
@@ -21,14 +20,14 @@ func init() {
 
 // WatchBrokers monitors aliveness of kafka brokers.
 type WatchBrokers struct {
-	Zkzone *zk.ZkZone
-	Stop   <-chan struct{}
-	Tick   time.Duration
-	Wg     *sync.WaitGroup
+	Zone monitor.Zone
+	Stop <-chan struct{}
+	Tick time.Duration
+	Wg   *sync.WaitGroup
 }
 
 func (this *WatchBrokers) Init(ctx monitor.Context) {
-	this.Zkzone = ctx.ZkZone()
+	this.Zone = ctx.Zone()
 	this.Stop = ctx.StopChan()
 	this.Wg = ctx.Inflight()
 }
@@ -56,9 +55,14 @@ func (this *WatchBrokers) Run() {
 }
 
 func (this *WatchBrokers) report() (dead, unregistered int64) {
-	this.Zkzone.ForSortedBrokers(func(cluster string, liveBrokers map[string]*zk.BrokerZnode) {
-		zkcluster := this.Zkzone.NewCluster(cluster)
-		registeredBrokers := zkcluster.RegisteredInfo().Roster
+	this.Zone.ForSortedClusters(func(zkcluster monitor.Cluster) {
+		liveBrokers := zkcluster.Brokers()
+		if len(liveBrokers) == 0 {
+			// the whole cluster is not started yet
+			return
+		}
+
+		registeredBrokers := zkcluster.Roster()
 
 		// find diff between registeredBrokers and liveBrokers
 		// loop1 find liveBrokers>registeredBrokers
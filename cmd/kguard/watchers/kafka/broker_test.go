@@ -0,0 +1,35 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kguard/monitor/monitortest"
+)
+
+func TestWatchBrokersReport(t *testing.T) {
+	ctx := monitortest.NewContext("test")
+	c := ctx.FakeZone.AddCluster("me", true)
+	c.RegisterBroker(0, "10.0.0.1", 9092)
+	c.RegisterBroker(1, "10.0.0.2", 9092)
+
+	w := &WatchBrokers{}
+	w.Init(ctx)
+
+	// cluster not started yet
+	dead, unregistered := w.report()
+	assert.Equal(t, int64(0), dead)
+	assert.Equal(t, int64(0), unregistered)
+
+	c.StartBroker(0, "10.0.0.1", 9092)
+	c.StartBroker(1, "10.0.0.2", 9092)
+	dead, unregistered = w.report()
+	assert.Equal(t, int64(0), dead)
+	assert.Equal(t, int64(0), unregistered)
+
+	c.StopBroker(1)
+	c.StartBroker(2, "10.0.0.3", 9092)
+	dead, unregistered = w.report()
+	assert.Equal(t, int64(1), dead)
+	assert.Equal(t, int64(1), unregistered)
+}
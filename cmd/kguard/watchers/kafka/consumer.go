@@ -8,7 +8,6 @@ import (
 	"github.com/funkygao/gafka/cmd/kateway/structs"
 	"github.com/funkygao/gafka/cmd/kguard/monitor"
 	"github.com/funkygao/gafka/telemetry"
-	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/go-metrics"
 	log "github.com/funkygao/log4go"
 )
@@ -23,10 +22,10 @@ func init() {
 
 // WatchConsumers monitors num of kafka online consumer groups over the time.
 type WatchConsumers struct {
-	Zkzone *zk.ZkZone
-	Stop   <-chan struct{}
-	Tick   time.Duration
-	Wg     *sync.WaitGroup
+	Zone monitor.Zone
+	Stop <-chan struct{}
+	Tick time.Duration
+	Wg   *sync.WaitGroup
 
 	logFrequentConsumer bool
 
@@ -37,7 +36,7 @@ type WatchConsumers struct {
 }
 
 func (this *WatchConsumers) Init(ctx monitor.Context) {
-	this.Zkzone = ctx.ZkZone()
+	this.Zone = ctx.Zone()
 	this.Stop = ctx.StopChan()
 	this.Wg = ctx.Inflight()
 	this.logFrequentConsumer = false
@@ -89,7 +88,7 @@ func (this *WatchConsumers) Run() {
 }
 
 func (this *WatchConsumers) report() (online, offline int64) {
-	this.Zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+	this.Zone.ForSortedClusters(func(zkcluster monitor.Cluster) {
 		for _, cgInfo := range zkcluster.ConsumerGroups() {
 			if len(cgInfo) > 0 {
 				online++
@@ -105,7 +104,7 @@ func (this *WatchConsumers) report() (online, offline int64) {
 func (this *WatchConsumers) frequentOffsetCommit() (n int64) {
 	const frequentThreshold = time.Second * 10
 
-	this.Zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+	this.Zone.ForSortedClusters(func(zkcluster monitor.Cluster) {
 		for group, consumers := range zkcluster.ConsumersByGroup("") {
 			for _, c := range consumers {
 				if !c.Online {
@@ -138,7 +137,7 @@ func (this *WatchConsumers) frequentOffsetCommit() (n int64) {
 }
 
 func (this *WatchConsumers) runSubQpsTimer() {
-	this.Zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+	this.Zone.ForSortedClusters(func(zkcluster monitor.Cluster) {
 		consumerGroups := zkcluster.ConsumerGroups()
 		for group, _ := range consumerGroups {
 			offsetMap := zkcluster.ConsumerOffsetsOfGroup(group)
@@ -0,0 +1,46 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kguard/monitor/monitortest"
+)
+
+func TestWatchConsumersReport(t *testing.T) {
+	ctx := monitortest.NewContext("test")
+	c := ctx.FakeZone.AddCluster("me", true)
+	c.AddGroup("g1")
+	c.StartConsumer("g2", "c1", time.Now(), "orders")
+	ctx.FakeZone.AddCluster("empty", false)
+
+	w := &WatchConsumers{}
+	w.Init(ctx)
+	online, offline := w.report()
+	assert.Equal(t, int64(1), online)
+	assert.Equal(t, int64(1), offline)
+}
+
+func TestWatchConsumersFrequentOffsetCommit(t *testing.T) {
+	ctx := monitortest.NewContext("test")
+	c := ctx.FakeZone.AddCluster("me", true)
+	c.StartBroker(0, "localhost", 9092)
+	c.SetProducerOffset("orders", "0", 100)
+	c.SetProducerOffset("orders", "1", 100)
+	c.StartConsumer("g1", "c1", time.Now(), "orders")
+	c.Own("g1", "orders", "0", "c1")
+	c.Own("g1", "orders", "1", "c1")
+
+	w := &WatchConsumers{}
+	w.Init(ctx)
+
+	t0 := time.Now().Add(-time.Minute)
+	c.CommitOffset("g1", "orders", "0", 1, t0)
+	c.CommitOffset("g1", "orders", "1", 1, t0)
+	assert.Equal(t, int64(0), w.frequentOffsetCommit())
+
+	c.CommitOffset("g1", "orders", "0", 2, t0.Add(time.Second))
+	c.CommitOffset("g1", "orders", "1", 2, t0.Add(time.Minute))
+	assert.Equal(t, int64(1), w.frequentOffsetCommit())
+}
@@ -0,0 +1,138 @@
+package kafka
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kguard/monitor"
+	"github.com/funkygao/go-metrics"
+	log "github.com/funkygao/log4go"
+)
+
+func init() {
+	monitor.RegisterWatcher("kafka.drop", func() monitor.Watcher {
+		return &WatchDrops{
+			Tick:       time.Minute,
+			MaxDropPct: 10,
+		}
+	})
+}
+
+// WatchDrops alarms on sudden drop of live brokers or registered partitions of a cluster
+// within a tick, which catches mass failure such as a rack power outage or mistaken topic
+// deletion faster than the per symptom watchers.
+type WatchDrops struct {
+	Zone monitor.Zone
+	Stop <-chan struct{}
+	Tick time.Duration
+	Wg   *sync.WaitGroup
+
+	MaxDropPct int // a drop of more than this percentage since last tick alarms
+
+	lastBrokers    map[string]int // cluster:live brokers
+	lastPartitions map[string]int // cluster:partitions
+}
+
+func (this *WatchDrops) Init(ctx monitor.Context) {
+	this.Zone = ctx.Zone()
+	this.Stop = ctx.StopChan()
+	this.Wg = ctx.Inflight()
+}
+
+// set?key=drop-pct:20
+func (this *WatchDrops) Set(key string) {
+	tuples := strings.SplitN(key, ":", 2)
+	if len(tuples) != 2 {
+		return
+	}
+
+	switch tuples[0] {
+	case "drop-pct":
+		if n, err := strconv.Atoi(tuples[1]); err == nil && n > 0 && n < 100 {
+			this.MaxDropPct = n
+			log.Info("kafka.drop MaxDropPct set to %d", n)
+		}
+	}
+}
+
+func (this *WatchDrops) Run() {
+	defer this.Wg.Done()
+
+	ticker := time.NewTicker(this.Tick)
+	defer ticker.Stop()
+
+	brokersDrop := metrics.NewRegisteredGauge("brokers.drop", nil)
+	partitionsDrop := metrics.NewRegisteredGauge("partitions.drop", nil)
+	for {
+		select {
+		case <-this.Stop:
+			log.Info("kafka.drop stopped")
+			return
+
+		case <-ticker.C:
+			b, p := this.report()
+			brokersDrop.Update(b)
+			partitionsDrop.Update(p)
+		}
+	}
+}
+
+// report returns the number of clusters whose live brokers and registered partitions
+// dropped more than MaxDropPct since last tick.
+func (this *WatchDrops) report() (brokerDrops, partitionDrops int64) {
+	if this.lastBrokers == nil {
+		this.lastBrokers = make(map[string]int)
+		this.lastPartitions = make(map[string]int)
+	}
+
+	seen := make(map[string]struct{})
+	this.Zone.ForSortedClusters(func(zkcluster monitor.Cluster) {
+		cluster := zkcluster.Name()
+		seen[cluster] = struct{}{}
+
+		brokers := len(zkcluster.Brokers())
+		if this.dropped(this.lastBrokers, cluster, brokers) {
+			log.Warn("cluster[%s] live brokers dropped %d -> %d", cluster, this.lastBrokers[cluster], brokers)
+			brokerDrops++
+		}
+		this.lastBrokers[cluster] = brokers
+
+		topics, err := zkcluster.Topics()
+		if err != nil {
+			// keep last count for the next tick
+			log.Error("cluster[%s] topics: %v", cluster, err)
+			return
+		}
+
+		var partitions int
+		for _, topic := range topics {
+			partitions += len(zkcluster.Partitions(topic))
+		}
+		if this.dropped(this.lastPartitions, cluster, partitions) {
+			log.Warn("cluster[%s] partitions dropped %d -> %d", cluster, this.lastPartitions[cluster], partitions)
+			partitionDrops++
+		}
+		this.lastPartitions[cluster] = partitions
+	})
+
+	// removed clusters are not drops
+	for cluster := range this.lastBrokers {
+		if _, present := seen[cluster]; !present {
+			delete(this.lastBrokers, cluster)
+			delete(this.lastPartitions, cluster)
+		}
+	}
+
+	return
+}
+
+func (this *WatchDrops) dropped(last map[string]int, cluster string, n int) bool {
+	lastN, present := last[cluster]
+	if !present || lastN == 0 || n >= lastN {
+		return false
+	}
+
+	return (lastN-n)*100 > lastN*this.MaxDropPct
+}
@@ -0,0 +1,51 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kguard/monitor/monitortest"
+)
+
+func TestWatchDropsReport(t *testing.T) {
+	ctx := monitortest.NewContext("test")
+	c := ctx.FakeZone.AddCluster("me", true)
+	for i := 0; i < 10; i++ {
+		c.StartBroker(i, "10.0.0.1", 9092+i)
+	}
+	c.AddTopic("foo", 8)
+	c.AddTopic("bar", 2)
+
+	w := &WatchDrops{MaxDropPct: 10}
+	w.Init(ctx)
+
+	// first tick has nothing to compare with
+	b, p := w.report()
+	assert.Equal(t, int64(0), b)
+	assert.Equal(t, int64(0), p)
+
+	// within threshold
+	c.StopBroker(9)
+	b, p = w.report()
+	assert.Equal(t, int64(0), b)
+	assert.Equal(t, int64(0), p)
+
+	// a rack down and a topic deleted
+	c.StopBroker(8)
+	c.StopBroker(7)
+	c.DeleteTopic("bar")
+	b, p = w.report()
+	assert.Equal(t, int64(1), b)
+	assert.Equal(t, int64(1), p)
+
+	// stable after the drop, growth never alarms
+	c.AddTopic("bar", 4)
+	b, p = w.report()
+	assert.Equal(t, int64(0), b)
+	assert.Equal(t, int64(0), p)
+
+	w.Set("drop-pct:50")
+	assert.Equal(t, 50, w.MaxDropPct)
+	w.Set("drop-pct:100")
+	assert.Equal(t, 50, w.MaxDropPct)
+}
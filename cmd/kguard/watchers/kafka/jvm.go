@@ -0,0 +1,319 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kguard/monitor"
+	"github.com/funkygao/go-metrics"
+	log "github.com/funkygao/log4go"
+)
+
+func init() {
+	monitor.RegisterWatcher("kafka.jvm", func() monitor.Watcher {
+		return &WatchJvm{
+			Tick:           time.Second * 30,
+			JolokiaPort:    8778,
+			MaxGcPct:       20,
+			SustainedTicks: 3,
+			MaxHeapPct:     90,
+			MinIdlePct:     20,
+		}
+	})
+}
+
+// jolokiaRequest reads in one bulk request the MBeans that reveal a soft failing broker:
+// alive in zk, but stalled by GC or with its request handlers/network processors saturated.
+var jolokiaRequest = []byte(`[
+{"type":"read","mbean":"java.lang:type=GarbageCollector,name=*","attribute":"CollectionTime"},
+{"type":"read","mbean":"java.lang:type=Memory","attribute":"HeapMemoryUsage"},
+{"type":"read","mbean":"kafka.server:type=KafkaRequestHandlerPool,name=RequestHandlerAvgIdlePercent","attribute":"OneMinuteRate"},
+{"type":"read","mbean":"kafka.network:type=SocketServer,name=NetworkProcessorAvgIdlePercent","attribute":"Value"}
+]`)
+
+// jvmStats is a sample of a broker process, idle ratio is -1 if the broker does not expose it.
+type jvmStats struct {
+	gcTime      int64 // cumulative ms of all collectors
+	heapUsed    int64
+	heapMax     int64
+	handlerIdle float64 // 0-1
+	networkIdle float64 // 0-1
+}
+
+func (this jvmStats) heapPct() int64 {
+	if this.heapMax <= 0 {
+		return 0
+	}
+	return this.heapUsed * 100 / this.heapMax
+}
+
+type brokerJvm struct {
+	gcTime   int64
+	sampled  time.Time
+	gcTicks  int // consecutive ticks spending more than MaxGcPct in GC
+	lastSeen time.Time
+}
+
+// WatchJvm polls the Jolokia agent of each live broker for GC time, heap usage and the idle
+// ratio of request handlers and network processors.
+//
+// Sustained GC pauses are the leading indicator of soft failure: the broker keeps its zk
+// session while clients time out, so the zk based watchers see nothing.
+type WatchJvm struct {
+	Zone monitor.Zone
+	Stop <-chan struct{}
+	Tick time.Duration
+	Wg   *sync.WaitGroup
+
+	JolokiaPort    int
+	MaxGcPct       int // percentage of wall time spent in GC within a tick
+	SustainedTicks int // GC over MaxGcPct for this many consecutive ticks alarms
+	MaxHeapPct     int
+	MinIdlePct     int // request handler or network processor idle below this is busy
+
+	fetch   func(host string, port int) (jvmStats, error)
+	brokers map[string]*brokerJvm // cluster/brokerId:state
+}
+
+func (this *WatchJvm) Init(ctx monitor.Context) {
+	this.Zone = ctx.Zone()
+	this.Stop = ctx.StopChan()
+	this.Wg = ctx.Inflight()
+	this.fetch = jolokiaFetcher(this.Tick / 2)
+}
+
+// set?key=gc-pct:20
+func (this *WatchJvm) Set(key string) {
+	tuples := strings.SplitN(key, ":", 2)
+	if len(tuples) != 2 {
+		return
+	}
+
+	n, err := strconv.Atoi(tuples[1])
+	if err != nil || n <= 0 {
+		return
+	}
+
+	switch tuples[0] {
+	case "jolokia-port":
+		this.JolokiaPort = n
+		log.Info("kafka.jvm JolokiaPort set to %d", n)
+
+	case "gc-pct":
+		if n < 100 {
+			this.MaxGcPct = n
+			log.Info("kafka.jvm MaxGcPct set to %d", n)
+		}
+
+	case "gc-ticks":
+		this.SustainedTicks = n
+		log.Info("kafka.jvm SustainedTicks set to %d", n)
+
+	case "heap-pct":
+		if n <= 100 {
+			this.MaxHeapPct = n
+			log.Info("kafka.jvm MaxHeapPct set to %d", n)
+		}
+
+	case "idle-pct":
+		if n < 100 {
+			this.MinIdlePct = n
+			log.Info("kafka.jvm MinIdlePct set to %d", n)
+		}
+	}
+}
+
+func (this *WatchJvm) Run() {
+	defer this.Wg.Done()
+
+	ticker := time.NewTicker(this.Tick)
+	defer ticker.Stop()
+
+	gcSustained := metrics.NewRegisteredGauge("jvm.gc.sustained", nil)
+	gcPctMax := metrics.NewRegisteredGauge("jvm.gc.pct.max", nil)
+	heapHigh := metrics.NewRegisteredGauge("jvm.heap.high", nil)
+	handlerBusy := metrics.NewRegisteredGauge("brokers.handler.busy", nil)
+	networkBusy := metrics.NewRegisteredGauge("brokers.network.busy", nil)
+	unreachable := metrics.NewRegisteredGauge("jvm.unreachable", nil)
+	for {
+		select {
+		case <-this.Stop:
+			log.Info("kafka.jvm stopped")
+			return
+
+		case <-ticker.C:
+			r := this.report(time.Now())
+			gcSustained.Update(r.gcSustained)
+			gcPctMax.Update(r.gcPctMax)
+			heapHigh.Update(r.heapHigh)
+			handlerBusy.Update(r.handlerBusy)
+			networkBusy.Update(r.networkBusy)
+			unreachable.Update(r.unreachable)
+		}
+	}
+}
+
+type jvmReport struct {
+	gcSustained int64 // brokers in sustained GC
+	gcPctMax    int64 // max GC percentage of all brokers within the tick
+	heapHigh    int64
+	handlerBusy int64
+	networkBusy int64
+	unreachable int64
+}
+
+func (this *WatchJvm) report(now time.Time) (r jvmReport) {
+	if this.brokers == nil {
+		this.brokers = make(map[string]*brokerJvm)
+	}
+
+	this.Zone.ForSortedClusters(func(zkcluster monitor.Cluster) {
+		for id, b := range zkcluster.Brokers() {
+			key := zkcluster.Name() + "/" + id
+			stats, err := this.fetch(b.Host, this.JolokiaPort)
+			if err != nil {
+				log.Error("cluster[%s] broker[%s] %s:%d jolokia: %v", zkcluster.Name(), id, b.Host, this.JolokiaPort, err)
+				r.unreachable++
+				continue
+			}
+
+			last, present := this.brokers[key]
+			if !present {
+				last = &brokerJvm{}
+				this.brokers[key] = last
+			}
+			last.lastSeen = now
+
+			elapsed := int64(now.Sub(last.sampled) / time.Millisecond)
+			if present && stats.gcTime >= last.gcTime && elapsed > 0 {
+				// collector time grows monotonically, a decrease means the broker restarted
+				gcPct := (stats.gcTime - last.gcTime) * 100 / elapsed
+				if gcPct > r.gcPctMax {
+					r.gcPctMax = gcPct
+				}
+
+				if gcPct > int64(this.MaxGcPct) {
+					last.gcTicks++
+				} else {
+					last.gcTicks = 0
+				}
+				if last.gcTicks >= this.SustainedTicks {
+					log.Warn("cluster[%s] broker[%s] %s spent %d%% in GC for %d ticks",
+						zkcluster.Name(), id, b.Addr(), gcPct, last.gcTicks)
+					r.gcSustained++
+				}
+			} else {
+				last.gcTicks = 0
+			}
+			last.gcTime = stats.gcTime
+			last.sampled = now
+
+			if pct := stats.heapPct(); pct >= int64(this.MaxHeapPct) {
+				log.Warn("cluster[%s] broker[%s] %s heap used %d%%", zkcluster.Name(), id, b.Addr(), pct)
+				r.heapHigh++
+			}
+
+			minIdle := float64(this.MinIdlePct) / 100
+			if stats.handlerIdle >= 0 && stats.handlerIdle < minIdle {
+				log.Warn("cluster[%s] broker[%s] %s request handler idle %.2f", zkcluster.Name(), id, b.Addr(), stats.handlerIdle)
+				r.handlerBusy++
+			}
+			if stats.networkIdle >= 0 && stats.networkIdle < minIdle {
+				log.Warn("cluster[%s] broker[%s] %s network processor idle %.2f", zkcluster.Name(), id, b.Addr(), stats.networkIdle)
+				r.networkBusy++
+			}
+		}
+	})
+
+	// forget brokers gone or unreachable so that a restarted one starts clean
+	for key, b := range this.brokers {
+		if b.lastSeen.Before(now) {
+			delete(this.brokers, key)
+		}
+	}
+
+	return
+}
+
+func jolokiaFetcher(timeout time.Duration) func(host string, port int) (jvmStats, error) {
+	client := &http.Client{Timeout: timeout}
+	return func(host string, port int) (jvmStats, error) {
+		resp, err := client.Post(fmt.Sprintf("http://%s:%d/jolokia/", host, port),
+			"application/json", bytes.NewReader(jolokiaRequest))
+		if err != nil {
+			return jvmStats{}, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return jvmStats{}, fmt.Errorf("http %s", resp.Status)
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return jvmStats{}, err
+		}
+
+		return parseJolokia(body)
+	}
+}
+
+// parseJolokia parses the bulk response of jolokiaRequest in the same order.
+func parseJolokia(body []byte) (jvmStats, error) {
+	var resps []struct {
+		Status int             `json:"status"`
+		Error  string          `json:"error"`
+		Value  json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(body, &resps); err != nil {
+		return jvmStats{}, err
+	}
+	if len(resps) != 4 {
+		return jvmStats{}, fmt.Errorf("expected 4 responses, got %d", len(resps))
+	}
+
+	// GC and heap are exposed by every jvm
+	for i := 0; i < 2; i++ {
+		if resps[i].Status != http.StatusOK {
+			return jvmStats{}, fmt.Errorf("status %d: %s", resps[i].Status, resps[i].Error)
+		}
+	}
+
+	stats := jvmStats{handlerIdle: -1, networkIdle: -1}
+
+	var collectors map[string]struct {
+		CollectionTime int64 `json:"CollectionTime"`
+	}
+	if err := json.Unmarshal(resps[0].Value, &collectors); err != nil {
+		return jvmStats{}, err
+	}
+	for _, c := range collectors {
+		stats.gcTime += c.CollectionTime
+	}
+
+	var heap struct {
+		Used int64 `json:"used"`
+		Max  int64 `json:"max"`
+	}
+	if err := json.Unmarshal(resps[1].Value, &heap); err != nil {
+		return jvmStats{}, err
+	}
+	stats.heapUsed, stats.heapMax = heap.Used, heap.Max
+
+	// older kafka lacks these MBeans
+	if resps[2].Status == http.StatusOK {
+		json.Unmarshal(resps[2].Value, &stats.handlerIdle)
+	}
+	if resps[3].Status == http.StatusOK {
+		json.Unmarshal(resps[3].Value, &stats.networkIdle)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,103 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kguard/monitor/monitortest"
+)
+
+func TestParseJolokia(t *testing.T) {
+	body := []byte(`[
+{"status":200,"value":{"java.lang:name=G1 Young Generation,type=GarbageCollector":{"CollectionTime":1200},
+  "java.lang:name=G1 Old Generation,type=GarbageCollector":{"CollectionTime":300}}},
+{"status":200,"value":{"init":0,"committed":4096,"max":8192,"used":6144}},
+{"status":200,"value":0.85},
+{"status":404,"error":"javax.management.InstanceNotFoundException"}
+]`)
+	stats, err := parseJolokia(body)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(1500), stats.gcTime)
+	assert.Equal(t, int64(75), stats.heapPct())
+	assert.Equal(t, 0.85, stats.handlerIdle)
+	assert.Equal(t, float64(-1), stats.networkIdle)
+
+	_, err = parseJolokia([]byte(`[{"status":404},{"status":200},{"status":200},{"status":200}]`))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestWatchJvmReport(t *testing.T) {
+	ctx := monitortest.NewContext("test")
+	c := ctx.FakeZone.AddCluster("me", true)
+	c.StartBroker(0, "10.0.0.1", 9092)
+	c.StartBroker(1, "10.0.0.2", 9092)
+
+	samples := map[string]jvmStats{
+		"10.0.0.1": {handlerIdle: 0.9, networkIdle: 0.9},
+		"10.0.0.2": {handlerIdle: 0.9, networkIdle: 0.9},
+	}
+	w := &WatchJvm{JolokiaPort: 8778, MaxGcPct: 20, SustainedTicks: 2, MaxHeapPct: 90, MinIdlePct: 20}
+	w.Init(ctx)
+	w.fetch = func(host string, port int) (jvmStats, error) {
+		s, present := samples[host]
+		if !present {
+			return s, errors.New("connection refused")
+		}
+		return s, nil
+	}
+
+	now := time.Now()
+	tick := func(gc0, gc1 int64) jvmReport {
+		now = now.Add(time.Second * 10)
+		for host, gc := range map[string]int64{"10.0.0.1": gc0, "10.0.0.2": gc1} {
+			if s, present := samples[host]; present {
+				s.gcTime += gc
+				samples[host] = s
+			}
+		}
+		return w.report(now)
+	}
+
+	// baseline
+	r := tick(0, 0)
+	assert.Equal(t, int64(0), r.gcSustained)
+
+	// broker 0 in GC 50% of the time, not sustained yet
+	r = tick(5000, 100)
+	assert.Equal(t, int64(50), r.gcPctMax)
+	assert.Equal(t, int64(0), r.gcSustained)
+	r = tick(5000, 100)
+	assert.Equal(t, int64(1), r.gcSustained)
+
+	// recovered
+	r = tick(100, 100)
+	assert.Equal(t, int64(0), r.gcSustained)
+	assert.Equal(t, int64(1), r.gcPctMax)
+
+	// broker restarted: collector time resets
+	s := samples["10.0.0.1"]
+	s.gcTime = 0
+	samples["10.0.0.1"] = s
+	r = tick(0, 0)
+	assert.Equal(t, int64(0), r.gcPctMax)
+
+	// saturated and heap nearly full
+	samples["10.0.0.2"] = jvmStats{heapUsed: 95, heapMax: 100, handlerIdle: 0.1, networkIdle: 0.5}
+	r = tick(0, 0)
+	assert.Equal(t, int64(1), r.heapHigh)
+	assert.Equal(t, int64(1), r.handlerBusy)
+	assert.Equal(t, int64(0), r.networkBusy)
+
+	// agent down
+	delete(samples, "10.0.0.2")
+	r = tick(0, 0)
+	assert.Equal(t, int64(1), r.unreachable)
+	assert.Equal(t, 1, len(w.brokers))
+
+	w.Set("gc-pct:30")
+	assert.Equal(t, 30, w.MaxGcPct)
+	w.Set("gc-pct:100")
+	assert.Equal(t, 30, w.MaxGcPct)
+}
@@ -0,0 +1,185 @@
+package kafka
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/cmd/kguard/monitor"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/go-metrics"
+	log "github.com/funkygao/log4go"
+)
+
+const offsetsTopic = "__consumer_offsets"
+
+func init() {
+	monitor.RegisterWatcher("kafka.offsets", func() monitor.Watcher {
+		return &WatchOffsets{
+			Tick:           time.Minute,
+			StallThreshold: time.Minute * 5,
+		}
+	})
+}
+
+// WatchOffsets monitors health of the consumer offsets storage: zk offset znodes and
+// kafka __consumer_offsets topic.
+//
+// If offset commits stop being written cluster-wide, all groups seem lagging behind
+// while the real outage is the offsets storage.
+type WatchOffsets struct {
+	Zkzone         *zk.ZkZone
+	Stop           <-chan struct{}
+	Tick           time.Duration
+	Wg             *sync.WaitGroup
+	StallThreshold time.Duration
+
+	lastKafkaOffsets map[string]int64 // cluster: sum of __consumer_offsets newest offsets
+	kafkaCommitEver  map[string]bool  // cluster: ever committed to __consumer_offsets
+}
+
+func (this *WatchOffsets) Init(ctx monitor.Context) {
+	this.Zkzone = ctx.ZkZone()
+	this.Stop = ctx.StopChan()
+	this.Wg = ctx.Inflight()
+}
+
+func (this *WatchOffsets) Set(key string) {
+	tuples := strings.SplitN(key, ":", 2)
+	if len(tuples) != 2 {
+		return
+	}
+
+	switch tuples[0] {
+	case "offsets-stall":
+		if d, err := time.ParseDuration(tuples[1]); err == nil && d > 0 {
+			this.StallThreshold = d
+			log.Info("kafka.offsets StallThreshold set to %s", d)
+		}
+	}
+}
+
+func (this *WatchOffsets) Run() {
+	defer this.Wg.Done()
+
+	ticker := time.NewTicker(this.Tick)
+	defer ticker.Stop()
+
+	this.lastKafkaOffsets = make(map[string]int64)
+	this.kafkaCommitEver = make(map[string]bool)
+
+	znodes := metrics.NewRegisteredGauge("offsets.zk.znodes", nil)
+	zkStalled := metrics.NewRegisteredGauge("offsets.zk.stalled", nil)
+	kafkaCommits := metrics.NewRegisteredGauge("offsets.kafka.commits", nil)
+	kafkaOutOfSync := metrics.NewRegisteredGauge("offsets.kafka.outofsync", nil)
+	kafkaStalled := metrics.NewRegisteredGauge("offsets.kafka.stalled", nil)
+
+	for {
+		select {
+		case <-this.Stop:
+			log.Info("kafka.offsets stopped")
+			return
+
+		case <-ticker.C:
+			n, stalled := this.reportZk()
+			znodes.Update(n)
+			zkStalled.Update(stalled)
+
+			commits, outOfSync, stalled := this.reportKafka()
+			kafkaCommits.Update(commits)
+			kafkaOutOfSync.Update(outOfSync)
+			kafkaStalled.Update(stalled)
+		}
+	}
+}
+
+// reportZk returns num of offset znodes and num of clusters with online consumer groups
+// but no offset committed to zk for long.
+func (this *WatchOffsets) reportZk() (znodes, stalledClusters int64) {
+	this.Zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+		n, lastCommit := zkcluster.ConsumerOffsetZnodes()
+		znodes += int64(n)
+
+		online := 0
+		for _, consumers := range zkcluster.ConsumerGroups() {
+			if len(consumers) > 0 {
+				online++
+			}
+		}
+
+		if online > 0 && n > 0 && time.Since(lastCommit) > this.StallThreshold {
+			log.Warn("cluster[%s] %d online groups, but no offset committed to zk since %s",
+				zkcluster.Name(), online, lastCommit)
+			stalledClusters++
+		}
+	})
+
+	return
+}
+
+// reportKafka returns num of offset commits since last tick, num of out of sync partitions
+// of __consumer_offsets and num of clusters whose __consumer_offsets stops growing.
+func (this *WatchOffsets) reportKafka() (commits, outOfSyncPartitions, stalledClusters int64) {
+	this.Zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+		brokerList := zkcluster.BrokerList()
+		if len(brokerList) == 0 {
+			return
+		}
+
+		kfk, err := sarama.NewClient(brokerList, sarama.NewConfig())
+		if err != nil {
+			log.Error("cluster[%s] %v", zkcluster.Name(), err)
+			return
+		}
+		defer kfk.Close()
+
+		partitions, err := kfk.Partitions(offsetsTopic)
+		if err != nil {
+			// e,g. old kafka or nobody ever commits offset to kafka
+			return
+		}
+
+		var total int64
+		states := zkcluster.PartitionStates(offsetsTopic)
+		for _, partitionId := range partitions {
+			replicas, err := kfk.Replicas(offsetsTopic, partitionId)
+			if err != nil {
+				log.Error("cluster[%s] %s/%d %v", zkcluster.Name(), offsetsTopic, partitionId, err)
+				outOfSyncPartitions++
+				continue
+			}
+
+			if isr := states[partitionId].Isr; len(isr) != len(replicas) {
+				log.Warn("cluster[%s] %s/%d isr %+v replicas %+v", zkcluster.Name(), offsetsTopic, partitionId, isr, replicas)
+				outOfSyncPartitions++
+			}
+
+			latestOffset, err := kfk.GetOffset(offsetsTopic, partitionId, sarama.OffsetNewest)
+			if err != nil {
+				log.Error("cluster[%s] %s/%d %v", zkcluster.Name(), offsetsTopic, partitionId, err)
+				return // partial sum makes no sense
+			}
+
+			total += latestOffset
+		}
+
+		cluster := zkcluster.Name()
+		lastTotal, present := this.lastKafkaOffsets[cluster]
+		this.lastKafkaOffsets[cluster] = total
+		if !present {
+			// first run
+			return
+		}
+
+		if delta := total - lastTotal; delta > 0 {
+			commits += delta
+			this.kafkaCommitEver[cluster] = true
+		} else if this.kafkaCommitEver[cluster] {
+			log.Warn("cluster[%s] %s stops growing", cluster, offsetsTopic)
+			stalledClusters++
+		}
+	})
+
+	return
+}
@@ -97,6 +97,7 @@ func (this *WatchReplicas) report() (deadPartitions, outOfSyncPartitions, failRe
 				deadPartitions++
 			}
 
+			states := zkcluster.PartitionStates(topic)
 			for _, partitionID := range alivePartitions {
 				replicas, err := kfk.Replicas(topic, partitionID)
 				if err != nil {
@@ -105,8 +106,7 @@ func (this *WatchReplicas) report() (deadPartitions, outOfSyncPartitions, failRe
 					continue
 				}
 
-				isr, _, _ := zkcluster.Isr(topic, partitionID)
-				if len(isr) != len(replicas) {
+				if len(states[partitionID].Isr) != len(replicas) {
 					outOfSyncPartitions++
 				}
 			}
@@ -0,0 +1,312 @@
+package kafka
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/cmd/kguard/monitor"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/go-metrics"
+	"github.com/funkygao/golib/gofmt"
+	log "github.com/funkygao/log4go"
+)
+
+func init() {
+	monitor.RegisterWatcher("kafka.unconsumed", func() monitor.Watcher {
+		return &WatchUnconsumed{
+			Tick:     time.Hour,
+			IdleDays: 7,
+			Recent:   time.Hour * 24,
+			MsgSize:  1024,
+		}
+	})
+}
+
+// WatchUnconsumed reports topics that keep receiving messages but have no consumer offset
+// committed by any group for IdleDays: their retention wastes disk, and they are candidates
+// for deletion to be confirmed with the owners by planners.
+//
+// Only offsets committed to zk are seen, groups committing to kafka __consumer_offsets
+// look unconsumed.
+type WatchUnconsumed struct {
+	Zkzone *zk.ZkZone
+	Stop   <-chan struct{}
+	Tick   time.Duration
+	Wg     *sync.WaitGroup
+
+	IdleDays   int           // no offset commit within this many days
+	Recent     time.Duration // received messages within this
+	MsgSize    int64         // avg message size in bytes to estimate the disk held
+	ReportFile string        // the candidates are written to as json each tick if not empty
+
+	lastNewest map[string]int64     // cluster/topic:sum of newest offsets
+	lastPubAt  map[string]time.Time // cluster/topic:when newest offsets last grew
+}
+
+// topicStock is the messages in stock of a topic.
+type topicStock struct {
+	newest   int64 // sum of newest offsets of all partitions
+	msgs     int64 // sum of newest-oldest of all partitions
+	replicas int
+}
+
+// unconsumedTopic is a candidate for deletion.
+type unconsumedTopic struct {
+	Cluster    string    `json:"cluster"`
+	Topic      string    `json:"topic"`
+	LastPub    time.Time `json:"last_pub"`
+	LastCommit time.Time `json:"last_commit"` // zero if never committed
+	Msgs       int64     `json:"msgs"`
+	Replicas   int       `json:"replicas"`
+	DiskBytes  int64     `json:"disk_bytes"` // estimated, replicas included
+}
+
+type unconsumedReport struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	IdleDays    int               `json:"idle_days"`
+	Topics      []unconsumedTopic `json:"topics"`
+}
+
+type unconsumedTopics []unconsumedTopic
+
+func (this unconsumedTopics) Len() int      { return len(this) }
+func (this unconsumedTopics) Swap(i, j int) { this[i], this[j] = this[j], this[i] }
+func (this unconsumedTopics) Less(i, j int) bool {
+	if this[i].DiskBytes != this[j].DiskBytes {
+		return this[i].DiskBytes > this[j].DiskBytes
+	}
+	return this[i].Cluster+"/"+this[i].Topic < this[j].Cluster+"/"+this[j].Topic
+}
+
+func (this *WatchUnconsumed) Init(ctx monitor.Context) {
+	this.Zkzone = ctx.ZkZone()
+	this.Stop = ctx.StopChan()
+	this.Wg = ctx.Inflight()
+}
+
+// set?key=unconsumed-days:14
+func (this *WatchUnconsumed) Set(key string) {
+	tuples := strings.SplitN(key, ":", 2)
+	if len(tuples) != 2 {
+		return
+	}
+
+	switch tuples[0] {
+	case "unconsumed-days":
+		if n, err := strconv.Atoi(tuples[1]); err == nil && n > 0 {
+			this.IdleDays = n
+			log.Info("kafka.unconsumed IdleDays set to %d", n)
+		}
+
+	case "unconsumed-recent":
+		if d, err := time.ParseDuration(tuples[1]); err == nil && d > 0 {
+			this.Recent = d
+			log.Info("kafka.unconsumed Recent set to %s", d)
+		}
+
+	case "unconsumed-msgsize":
+		if n, err := strconv.ParseInt(tuples[1], 10, 64); err == nil && n > 0 {
+			this.MsgSize = n
+			log.Info("kafka.unconsumed MsgSize set to %d", n)
+		}
+
+	case "unconsumed-report":
+		this.ReportFile = tuples[1]
+		log.Info("kafka.unconsumed ReportFile set to %s", this.ReportFile)
+	}
+}
+
+func (this *WatchUnconsumed) Run() {
+	defer this.Wg.Done()
+
+	ticker := time.NewTicker(this.Tick)
+	defer ticker.Stop()
+
+	this.lastNewest = make(map[string]int64)
+	this.lastPubAt = make(map[string]time.Time)
+
+	topics := metrics.NewRegisteredGauge("topics.unconsumed", nil)
+	disk := metrics.NewRegisteredGauge("topics.unconsumed.disk", nil)
+	for {
+		select {
+		case <-this.Stop:
+			log.Info("kafka.unconsumed stopped")
+			return
+
+		case now := <-ticker.C:
+			candidates := this.report(now)
+
+			var diskBytes int64
+			for _, t := range candidates {
+				diskBytes += t.DiskBytes
+			}
+			topics.Update(int64(len(candidates)))
+			disk.Update(diskBytes)
+
+			if this.ReportFile != "" {
+				if err := this.writeReport(now, candidates); err != nil {
+					log.Error("kafka.unconsumed %s: %v", this.ReportFile, err)
+				}
+			}
+		}
+	}
+}
+
+func (this *WatchUnconsumed) report(now time.Time) []unconsumedTopic {
+	var r []unconsumedTopic
+	this.Zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+		stocks, err := this.topicStocks(zkcluster)
+		if err != nil {
+			log.Error("cluster[%s] %v", zkcluster.Name(), err)
+			return
+		}
+
+		r = append(r, this.candidates(zkcluster.Name(), stocks, zkcluster.TopicsCtime(),
+			zkcluster.TopicsLastCommit(), now)...)
+	})
+
+	sort.Sort(unconsumedTopics(r))
+	for _, t := range r {
+		since := "ever"
+		if !t.LastCommit.IsZero() {
+			since = t.LastCommit.Format(time.RFC3339)
+		}
+		log.Warn("cluster[%s] topic[%s] unconsumed since %s, holding %s",
+			t.Cluster, t.Topic, since, gofmt.ByteSize(t.DiskBytes))
+	}
+
+	return r
+}
+
+func (this *WatchUnconsumed) topicStocks(zkcluster *zk.ZkCluster) (map[string]topicStock, error) {
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), sarama.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer kfk.Close()
+
+	topics, err := kfk.Topics()
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[string]topicStock, len(topics))
+nextTopic:
+	for _, topic := range topics {
+		if topic == offsetsTopic {
+			continue
+		}
+
+		partitions, err := kfk.Partitions(topic)
+		if err != nil {
+			log.Error("cluster[%s] topic:%s %v", zkcluster.Name(), topic, err)
+			continue
+		}
+
+		var stock topicStock
+		for _, partitionId := range partitions {
+			newest, err := kfk.GetOffset(topic, partitionId, sarama.OffsetNewest)
+			if err != nil {
+				log.Error("cluster[%s] topic[%s/%d]: %v", zkcluster.Name(), topic, partitionId, err)
+				continue nextTopic // partial sum makes no sense
+			}
+			oldest, err := kfk.GetOffset(topic, partitionId, sarama.OffsetOldest)
+			if err != nil {
+				log.Error("cluster[%s] topic[%s/%d]: %v", zkcluster.Name(), topic, partitionId, err)
+				continue nextTopic // partial sum makes no sense
+			}
+
+			stock.newest += newest
+			stock.msgs += newest - oldest
+			if replicas, err := kfk.Replicas(topic, partitionId); err == nil && len(replicas) > stock.replicas {
+				stock.replicas = len(replicas)
+			}
+		}
+
+		r[topic] = stock
+	}
+
+	return r, nil
+}
+
+// candidates returns the topics of a cluster that received messages within Recent but
+// no offset committed for IdleDays. Topics younger than IdleDays are not candidates.
+func (this *WatchUnconsumed) candidates(cluster string, stocks map[string]topicStock,
+	ctimes, lastCommits map[string]time.Time, now time.Time) []unconsumedTopic {
+	idle := time.Duration(this.IdleDays) * time.Hour * 24
+	var r []unconsumedTopic
+	for topic, stock := range stocks {
+		key := cluster + "/" + topic
+		lastNewest, present := this.lastNewest[key]
+		this.lastNewest[key] = stock.newest
+		if present && stock.newest > lastNewest {
+			this.lastPubAt[key] = now
+		}
+
+		lastPub, pubbed := this.lastPubAt[key]
+		if !pubbed || now.Sub(lastPub) > this.Recent {
+			// first seen or not receiving messages: nothing wasted by producers
+			continue
+		}
+
+		if ctime, present := ctimes[topic]; !present || now.Sub(ctime) < idle {
+			continue
+		}
+
+		lastCommit := lastCommits[topic]
+		if now.Sub(lastCommit) < idle {
+			continue
+		}
+
+		r = append(r, unconsumedTopic{
+			Cluster:    cluster,
+			Topic:      topic,
+			LastPub:    lastPub,
+			LastCommit: lastCommit,
+			Msgs:       stock.msgs,
+			Replicas:   stock.replicas,
+			DiskBytes:  stock.msgs * this.MsgSize * int64(stock.replicas),
+		})
+	}
+
+	// forget deleted topics
+	prefix := cluster + "/"
+	for key := range this.lastNewest {
+		if strings.HasPrefix(key, prefix) {
+			if _, present := stocks[key[len(prefix):]]; !present {
+				delete(this.lastNewest, key)
+				delete(this.lastPubAt, key)
+			}
+		}
+	}
+
+	return r
+}
+
+func (this *WatchUnconsumed) writeReport(now time.Time, candidates []unconsumedTopic) error {
+	if candidates == nil {
+		candidates = []unconsumedTopic{}
+	}
+	b, err := json.MarshalIndent(unconsumedReport{
+		GeneratedAt: now,
+		IdleDays:    this.IdleDays,
+		Topics:      candidates,
+	}, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	tmpFile := this.ReportFile + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, this.ReportFile)
+}
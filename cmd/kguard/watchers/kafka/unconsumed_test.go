@@ -0,0 +1,65 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestWatchUnconsumedCandidates(t *testing.T) {
+	w := &WatchUnconsumed{
+		IdleDays:   7,
+		Recent:     time.Hour * 24,
+		MsgSize:    100,
+		lastNewest: make(map[string]int64),
+		lastPubAt:  make(map[string]time.Time),
+	}
+
+	now := time.Now()
+	old := now.Add(-time.Hour * 24 * 30)
+	ctimes := map[string]time.Time{"orders": old, "logs": old, "idle": old, "fresh": now.Add(-time.Hour)}
+	lastCommits := map[string]time.Time{
+		"orders": now.Add(-time.Minute),
+		"logs":   now.Add(-time.Hour * 24 * 10),
+	}
+	stocks := map[string]topicStock{
+		"orders": {newest: 100, msgs: 100, replicas: 2},
+		"logs":   {newest: 100, msgs: 100, replicas: 2},
+		"idle":   {newest: 100, msgs: 100, replicas: 2},
+		"fresh":  {newest: 100, msgs: 100, replicas: 2},
+	}
+
+	// first seen: unknown whether receiving messages
+	assert.Equal(t, 0, len(w.candidates("c1", stocks, ctimes, lastCommits, now)))
+
+	now = now.Add(time.Hour)
+	stocks = map[string]topicStock{
+		"orders": {newest: 200, msgs: 200, replicas: 2},
+		"logs":   {newest: 200, msgs: 200, replicas: 2},
+		"idle":   {newest: 100, msgs: 100, replicas: 2},
+		"fresh":  {newest: 200, msgs: 200, replicas: 2},
+	}
+	r := w.candidates("c1", stocks, ctimes, lastCommits, now)
+	assert.Equal(t, 1, len(r))
+	assert.Equal(t, "logs", r[0].Topic)
+	assert.Equal(t, int64(200*100*2), r[0].DiskBytes)
+	assert.Equal(t, now, r[0].LastPub)
+
+	// stops receiving messages for long
+	now = now.Add(time.Hour * 25)
+	assert.Equal(t, 0, len(w.candidates("c1", stocks, ctimes, lastCommits, now)))
+
+	// never consumed
+	now = now.Add(time.Hour)
+	stocks["idle"] = topicStock{newest: 101, msgs: 101, replicas: 3}
+	r = w.candidates("c1", stocks, ctimes, lastCommits, now)
+	assert.Equal(t, 1, len(r))
+	assert.Equal(t, "idle", r[0].Topic)
+	assert.Equal(t, true, r[0].LastCommit.IsZero())
+
+	// deleted topics are forgotten
+	w.candidates("c1", map[string]topicStock{}, ctimes, lastCommits, now)
+	assert.Equal(t, 0, len(w.lastNewest))
+	assert.Equal(t, 0, len(w.lastPubAt))
+}
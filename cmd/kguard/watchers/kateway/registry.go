@@ -0,0 +1,176 @@
+package kateway
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kguard/monitor"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/go-metrics"
+	log "github.com/funkygao/log4go"
+)
+
+func init() {
+	monitor.RegisterWatcher("kateway.registry", func() monitor.Watcher {
+		return &WatchRegistry{
+			Tick:         time.Minute,
+			ProbeTimeout: time.Second * 5,
+			DeadProbes:   3,
+		}
+	})
+}
+
+// WatchRegistry detects leaked kateway registration znodes.
+//
+// ehaproxy builds its backends from the registration znodes, so an ephemeral znode
+// that outlives its kateway instance(session expire bug, zk partition) routes traffic
+// to a dead backend.
+type WatchRegistry struct {
+	Zkzone       *zk.ZkZone
+	Stop         <-chan struct{}
+	Tick         time.Duration
+	Wg           *sync.WaitGroup
+	ProbeTimeout time.Duration
+	DeadProbes   int // consecutive failed probes to confirm an instance dead
+
+	expected int
+	cleanup  bool
+
+	failures map[string]int // kateway id:consecutive failed probes
+}
+
+func (this *WatchRegistry) Init(ctx monitor.Context) {
+	this.Zkzone = ctx.ZkZone()
+	this.Stop = ctx.StopChan()
+	this.Wg = ctx.Inflight()
+	this.expected = ctx.ExpectedKateways()
+	this.cleanup = ctx.CleanupLeaks()
+	this.failures = make(map[string]int)
+}
+
+func (this *WatchRegistry) Run() {
+	defer this.Wg.Done()
+
+	ticker := time.NewTicker(this.Tick)
+	defer ticker.Stop()
+
+	staleInstances := metrics.NewRegisteredGauge("kateway.registry.stale", nil)
+	deadInstances := metrics.NewRegisteredGauge("kateway.registry.dead", nil)
+	mismatch := metrics.NewRegisteredGauge("kateway.registry.mismatch", nil)
+
+	for {
+		select {
+		case <-this.Stop:
+			log.Info("kateway.registry stopped")
+			return
+
+		case <-ticker.C:
+			kws, err := this.Zkzone.KatewayInfos()
+			if err != nil {
+				log.Error("kateway.registry: %v", err)
+				continue
+			}
+
+			stale, dead := this.probe(kws)
+			staleInstances.Update(int64(stale))
+			deadInstances.Update(int64(dead))
+
+			if this.expected > 0 {
+				// registered but dead instances are not serving
+				delta := len(kws) - dead - this.expected
+				mismatch.Update(int64(delta))
+				if delta != 0 {
+					log.Warn("kateway.registry %d registered, %d dead, expected %d", len(kws), dead, this.expected)
+				}
+			}
+		}
+	}
+}
+
+// probe checks aliveness of each registered instance and returns the number of
+// unreachable and confirmed dead instances.
+func (this *WatchRegistry) probe(kws []*zk.KatewayMeta) (stale, dead int) {
+	registered := make(map[string]struct{}, len(kws))
+	for _, kw := range kws {
+		registered[kw.Id] = struct{}{}
+
+		if this.alive(kw) {
+			delete(this.failures, kw.Id)
+			continue
+		}
+
+		stale++
+		this.failures[kw.Id]++
+		if this.failures[kw.Id] < this.DeadProbes {
+			log.Warn("kateway.registry[%s] %s unreachable #%d", kw.Id, kw.Host, this.failures[kw.Id])
+			continue
+		}
+
+		dead++
+		log.Error("kateway.registry[%s] %s dead, registered since %s", kw.Id, kw.Host, kw.Ctime)
+
+		if this.cleanup {
+			if err := this.deregister(kw); err != nil {
+				log.Error("kateway.registry[%s] cleanup: %v", kw.Id, err)
+			} else {
+				log.Warn("kateway.registry[%s] %s leaked znode deleted", kw.Id, kw.Host)
+				delete(this.failures, kw.Id)
+			}
+		}
+	}
+
+	// forget instances that are gone
+	for id := range this.failures {
+		if _, present := registered[id]; !present {
+			delete(this.failures, id)
+		}
+	}
+
+	return
+}
+
+func (this *WatchRegistry) alive(kw *zk.KatewayMeta) bool {
+	addr := kw.ManAddr
+	if addr == "" {
+		addr = kw.PubAddr
+	}
+	if addr == "" {
+		// nothing to probe
+		return true
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return true
+	}
+	if host == "" {
+		// kateway listens on all interfaces
+		host = kw.Ip
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), this.ProbeTimeout)
+	if err != nil {
+		return false
+	}
+
+	conn.Close()
+	return true
+}
+
+// deregister deletes the registration znode of a dead instance, unless it has been
+// registered again in the meantime.
+func (this *WatchRegistry) deregister(kw *zk.KatewayMeta) error {
+	path := fmt.Sprintf("%s/%s/%s", zk.KatewayIdsRoot, this.Zkzone.Name(), kw.Id)
+	_, stat, err := this.Zkzone.Conn().Get(path)
+	if err != nil {
+		return err
+	}
+
+	if !zk.ZkTimestamp(stat.Ctime).Time().Equal(kw.Ctime) {
+		return fmt.Errorf("%s re-registered", path)
+	}
+
+	return this.Zkzone.DeleteZnode(path, stat.Version)
+}
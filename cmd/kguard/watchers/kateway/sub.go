@@ -8,7 +8,7 @@ import (
 
 	"github.com/funkygao/gafka/cmd/kateway/structs"
 	"github.com/funkygao/gafka/cmd/kguard/monitor"
-	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/gafka/telemetry"
 	"github.com/funkygao/go-metrics"
 	log "github.com/funkygao/log4go"
 )
@@ -21,34 +21,31 @@ func init() {
 	})
 }
 
-type subStatus struct {
-	ProducedOffset, ConsumedOffset int64
-	Time                           time.Time
-}
-
 // WatchSub monitors Sub status of kateway cluster.
 type WatchSub struct {
-	Zkzone *zk.ZkZone
-	Stop   <-chan struct{}
-	Tick   time.Duration
-	Wg     *sync.WaitGroup
+	Zone monitor.Zone
+	Stop <-chan struct{}
+	Tick time.Duration
+	Wg   *sync.WaitGroup
 
-	zkclusters []*zk.ZkCluster
+	zkclusters []monitor.Cluster
 
-	suspects map[structs.GroupTopicPartition]subStatus
+	windows  map[string]map[structs.GroupTopicPartition]*partitionWindow // cluster:partition:window
+	statuses map[string]metrics.Gauge                                    // tagged cluster group topic:status
 }
 
 func (this *WatchSub) Init(ctx monitor.Context) {
-	this.Zkzone = ctx.ZkZone()
+	this.Zone = ctx.Zone()
 	this.Stop = ctx.StopChan()
 	this.Wg = ctx.Inflight()
-	this.suspects = make(map[structs.GroupTopicPartition]subStatus)
+	this.windows = make(map[string]map[structs.GroupTopicPartition]*partitionWindow)
+	this.statuses = make(map[string]metrics.Gauge)
 }
 
 func (this *WatchSub) Run() {
 	defer this.Wg.Done()
 
-	this.zkclusters = this.Zkzone.PublicClusters() // TODO sync with clusters change
+	this.zkclusters = this.Zone.PublicClusters() // TODO sync with clusters change
 
 	ticker := time.NewTicker(this.Tick)
 	defer ticker.Stop()
@@ -62,8 +59,8 @@ func (this *WatchSub) Run() {
 			return
 
 		case <-ticker.C:
-			//lags := this.subLags() // DISABLED
-			subLagGroups.Update(int64(0))
+			lags := this.subLags()
+			subLagGroups.Update(int64(lags))
 
 			conflictGroups := this.subConflicts()
 			subConflictGroup.Update(int64(conflictGroups))
@@ -72,47 +69,21 @@ func (this *WatchSub) Run() {
 	}
 }
 
-func (this *WatchSub) isSuspect(group, topic string, partitionID string) bool {
-	if _, present := this.suspects[structs.GroupTopicPartition{Group: group, Topic: topic, PartitionID: partitionID}]; present {
-		return true
-	}
-
-	return false
-}
-
-func (this *WatchSub) suspect(group, topic string, partitionID string, producedOffset, consumedOffset int64, t time.Time) {
-	this.suspects[structs.GroupTopicPartition{Group: group, Topic: topic, PartitionID: partitionID}] = subStatus{
-		ProducedOffset: producedOffset,
-		ConsumedOffset: consumedOffset,
-		Time:           t,
-	}
-}
-
-func (this *WatchSub) unsuspect(group, topic string, partitionID string) {
-	delete(this.suspects, structs.GroupTopicPartition{Group: group, Topic: topic, PartitionID: partitionID})
-}
-
-func (this *WatchSub) isCriminal(group, topic string, partitionID string, producedOffset, consumedOffset int64, t time.Time) bool {
-	lastStat, ok := this.suspects[structs.GroupTopicPartition{Group: group, Topic: topic, PartitionID: partitionID}]
-	if !ok {
-		// should never happen
-		log.Error("group[%s] topic[%s/%s] should never happen!", group, topic, partitionID)
-		return false
-	}
-
-	if lastStat.ProducedOffset < producedOffset && lastStat.ConsumedOffset >= consumedOffset {
-		// new messages produced during this period but the consumer didn't move ahead
-		return true
-	}
-
-	return false
-}
-
+// subLags evaluates the status of each online consumer group within the recent offset
+// commits window and returns the number of STALLED or STOPPED groups.
 func (this *WatchSub) subLags() (lags int) {
 	now := time.Now()
-	// find sub lags
+	seen := make(map[string]struct{})
 	for _, zkcluster := range this.zkclusters {
+		windows, present := this.windows[zkcluster.Name()]
+		if !present {
+			windows = make(map[structs.GroupTopicPartition]*partitionWindow)
+			this.windows[zkcluster.Name()] = windows
+		}
+
+		alive := make(map[structs.GroupTopicPartition]struct{})
 		for group, consumers := range zkcluster.ConsumersByGroup("") {
+			groupStatus := make(map[string]consumerStatus) // topic:worst status of its partitions
 			for _, c := range consumers {
 				if !c.Online {
 					continue
@@ -124,45 +95,63 @@ func (this *WatchSub) subLags() (lags int) {
 					continue
 				}
 
+				gtp := structs.GroupTopicPartition{Group: group, Topic: c.Topic, PartitionID: c.PartitionId}
+				alive[gtp] = struct{}{}
+				w, present := windows[gtp]
+				if !present {
+					w = &partitionWindow{}
+					windows[gtp] = w
+				}
+
 				if time.Since(c.ConsumerZnode.Uptime()) < time.Minute*2 {
+					// rebalanced or restarted, history is meaningless
 					log.Info("cluster[%s] group[%s] just started, topic[%s/%s]", zkcluster.Name(), group, c.Topic, c.PartitionId)
 
-					this.unsuspect(group, c.Topic, c.PartitionId)
+					w.reset()
 					continue
 				}
 
-				// offset commit every 1m, sublag runs every 1m, so the gap might be 2m
-				// TODO lag too much, even if it's still alive, emit alarm
-				elapsed := time.Since(c.Mtime.Time())
-				if c.Lag == 0 || elapsed < time.Minute*3 {
-					this.unsuspect(group, c.Topic, c.PartitionId)
-					continue
+				w.record(c.ConsumerOffset, c.Lag, c.Mtime.Time())
+				status := w.evaluate(now)
+				if status != statusOK {
+					log.Warn("cluster[%s] group[%s] %s topic[%s/%s] %d - %d = %d, offset commit elapsed: %s",
+						zkcluster.Name(), group, status, c.Topic, c.PartitionId, c.ProducerOffset, c.ConsumerOffset, c.Lag,
+						time.Since(c.Mtime.Time()))
 				}
-
-				// it might be lagging, but need confirm with last round
-				if !this.isSuspect(group, c.Topic, c.PartitionId) {
-					// suspect it, next round if it is still lagging, put on trial
-					log.Warn("cluster[%s] group[%s] suspected topic[%s/%s] %d - %d = %d, offset commit elapsed: %s",
-						zkcluster.Name(), group, c.Topic, c.PartitionId, c.ProducerOffset, c.ConsumerOffset, c.Lag, elapsed.String())
-
-					this.suspect(group, c.Topic, c.PartitionId, c.ProducerOffset, c.ConsumerOffset, now)
-					continue
+				if status > groupStatus[c.Topic] {
+					groupStatus[c.Topic] = status
 				}
+			}
 
-				if this.isCriminal(group, c.Topic, c.PartitionId, c.ProducerOffset, c.ConsumerOffset, now) {
-					// bingo! consumer is lagging and seems to be DEAD
-					log.Error("cluster[%s] group[%s] confirmed topic[%s/%s] %d - %d = %d, offset commit elapsed: %s",
-						zkcluster.Name(), group, c.Topic, c.PartitionId, c.ProducerOffset, c.ConsumerOffset, c.Lag, elapsed.String())
+			for topic, status := range groupStatus {
+				if status >= statusStalled {
+					log.Error("cluster[%s] group[%s] topic[%s] %s", zkcluster.Name(), group, topic, status)
 
 					lags++
-				} else {
-					log.Warn("cluster[%s] group[%s] lagging but still alive topic[%s/%s] %d - %d = %d, offset commit elapsed: %s",
-						zkcluster.Name(), group, c.Topic, c.PartitionId, c.ProducerOffset, c.ConsumerOffset, c.Lag, elapsed.String())
 				}
 
+				tag := telemetry.Tag(zkcluster.Name(), strings.Replace(group, ".", "_", -1), strings.Replace(topic, ".", "_", -1))
+				seen[tag] = struct{}{}
+				if _, present := this.statuses[tag]; !present {
+					this.statuses[tag] = metrics.NewRegisteredGauge(tag+"sub.status", nil)
+				}
+				this.statuses[tag].Update(int64(status))
+			}
+		}
+
+		for gtp := range windows {
+			if _, present := alive[gtp]; !present {
+				delete(windows, gtp)
 			}
 		}
+	}
 
+	// the group is gone or offline
+	for tag := range this.statuses {
+		if _, present := seen[tag]; !present {
+			metrics.Unregister(tag + "sub.status")
+			delete(this.statuses, tag)
+		}
 	}
 
 	return
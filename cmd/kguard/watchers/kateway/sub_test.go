@@ -0,0 +1,73 @@
+package kateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kguard/monitor/monitortest"
+)
+
+func TestWatchSubLags(t *testing.T) {
+	ctx := monitortest.NewContext("test")
+	c := ctx.FakeZone.AddCluster("pub", true)
+	private := ctx.FakeZone.AddCluster("private", false)
+	for _, zkcluster := range []*monitortest.Cluster{c, private} {
+		zkcluster.StartBroker(0, "localhost", 9092)
+		zkcluster.SetProducerOffset("orders", "0", 100)
+	}
+
+	uptime := time.Now().Add(-time.Hour)
+	c.StartConsumer("stalled", "c1", uptime, "orders")
+	c.Own("stalled", "orders", "0", "c1")
+	c.StartConsumer("healthy", "c2", uptime, "orders")
+	c.Own("healthy", "orders", "0", "c2")
+	private.StartConsumer("stalled", "c1", uptime, "orders")
+	private.Own("stalled", "orders", "0", "c1")
+
+	w := &WatchSub{}
+	w.Init(ctx)
+	w.zkclusters = w.Zone.PublicClusters()
+	assert.Equal(t, 1, len(w.zkclusters))
+
+	t0 := time.Now().Add(-time.Minute * subStatusWindow)
+	for i := 0; i < subStatusWindow; i++ {
+		mtime := t0.Add(time.Minute * time.Duration(i+1))
+		c.CommitOffset("stalled", "orders", "0", 5, mtime)
+		c.CommitOffset("healthy", "orders", "0", 100, mtime)
+		private.CommitOffset("stalled", "orders", "0", 5, mtime)
+		if i < subStatusWindow-1 {
+			assert.Equal(t, 0, w.subLags())
+		}
+	}
+	assert.Equal(t, 1, w.subLags())
+	assert.Equal(t, 1, len(w.statuses)) // OK group has no status gauge
+
+	// restarted consumer has no history
+	c.StopConsumer("stalled", "c1")
+	c.StartConsumer("stalled", "c3", time.Now(), "orders")
+	c.Own("stalled", "orders", "0", "c3")
+	assert.Equal(t, 0, w.subLags())
+	assert.Equal(t, 0, len(w.statuses))
+	assert.Equal(t, 2, len(w.windows["pub"]))
+
+	c.StopConsumer("stalled", "c3")
+	assert.Equal(t, 0, w.subLags())
+	assert.Equal(t, 1, len(w.windows["pub"]))
+}
+
+func TestWatchSubConflicts(t *testing.T) {
+	ctx := monitortest.NewContext("test")
+	c := ctx.FakeZone.AddCluster("pub", true)
+	c.AddGroup("offline")
+	c.StartConsumer("g1", "c1", time.Now(), "orders")
+	c.StartConsumer("g1", "c2", time.Now(), "orders")
+
+	w := &WatchSub{}
+	w.Init(ctx)
+	w.zkclusters = w.Zone.PublicClusters()
+	assert.Equal(t, 0, w.subConflicts())
+
+	c.StartConsumer("g1", "c3", time.Now(), "payments")
+	assert.Equal(t, 1, w.subConflicts())
+}
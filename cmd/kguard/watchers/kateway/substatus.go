@@ -0,0 +1,100 @@
+package kateway
+
+import (
+	"time"
+)
+
+// subStatusWindow is the number of recent offset commits evaluated per partition.
+const subStatusWindow = 10
+
+// consumerStatus is the burrow style status of a consumer group or partition.
+// Bigger value means more severe.
+type consumerStatus int
+
+const (
+	statusOK      consumerStatus = iota // consuming normally or lag not evaluated yet
+	statusWarn                          // lag keeps growing, consumer can't keep up
+	statusStalled                       // still committing offset but offset not moving
+	statusStopped                       // stopped committing offset for long
+)
+
+func (s consumerStatus) String() string {
+	switch s {
+	case statusOK:
+		return "OK"
+	case statusWarn:
+		return "WARN"
+	case statusStalled:
+		return "STALLED"
+	case statusStopped:
+		return "STOPPED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+type offsetCommit struct {
+	Offset, Lag int64
+	Timestamp   time.Time // when the offset is committed
+}
+
+// partitionWindow is a sliding window of the recent offset commits of a partition.
+type partitionWindow struct {
+	commits []offsetCommit // oldest first
+}
+
+// record appends a commit to the window if it is a new commit.
+func (this *partitionWindow) record(offset, lag int64, t time.Time) {
+	if n := len(this.commits); n > 0 && !t.After(this.commits[n-1].Timestamp) {
+		// no new commit since last round
+		return
+	}
+
+	if len(this.commits) == subStatusWindow {
+		this.commits = append(this.commits[:0], this.commits[1:]...)
+	}
+	this.commits = append(this.commits, offsetCommit{Offset: offset, Lag: lag, Timestamp: t})
+}
+
+func (this *partitionWindow) reset() {
+	this.commits = this.commits[:0]
+}
+
+// evaluate classifies the partition consumer with the rules:
+// 1. window not full yet: OK
+// 2. any commit has zero lag: OK
+// 3. time since last commit exceeds the window span: STOPPED
+// 4. offset unchanged across the window: STALLED
+// 5. lag never decreases and grows across the window: WARN
+// 6. else OK
+func (this *partitionWindow) evaluate(now time.Time) consumerStatus {
+	if len(this.commits) < subStatusWindow {
+		return statusOK
+	}
+
+	for _, c := range this.commits {
+		if c.Lag == 0 {
+			return statusOK
+		}
+	}
+
+	first, last := this.commits[0], this.commits[len(this.commits)-1]
+	if now.Sub(last.Timestamp) > last.Timestamp.Sub(first.Timestamp) {
+		return statusStopped
+	}
+
+	if first.Offset == last.Offset {
+		return statusStalled
+	}
+
+	for i := 1; i < len(this.commits); i++ {
+		if this.commits[i].Lag < this.commits[i-1].Lag {
+			return statusOK
+		}
+	}
+	if last.Lag > first.Lag {
+		return statusWarn
+	}
+
+	return statusOK
+}
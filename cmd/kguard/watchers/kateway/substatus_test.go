@@ -0,0 +1,62 @@
+package kateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func fillWindow(offsets, lags []int64, t0 time.Time) *partitionWindow {
+	w := &partitionWindow{}
+	for i := range offsets {
+		w.record(offsets[i], lags[i], t0.Add(time.Minute*time.Duration(i)))
+	}
+	return w
+}
+
+func TestPartitionWindowRecord(t *testing.T) {
+	w := &partitionWindow{}
+	t0 := time.Now()
+	w.record(1, 1, t0)
+	w.record(2, 1, t0) // same commit
+	assert.Equal(t, 1, len(w.commits))
+
+	for i := 0; i < subStatusWindow*2; i++ {
+		w.record(int64(i), 1, t0.Add(time.Second*time.Duration(i+1)))
+	}
+	assert.Equal(t, subStatusWindow, len(w.commits))
+	assert.Equal(t, int64(subStatusWindow*2-1), w.commits[subStatusWindow-1].Offset)
+
+	w.reset()
+	assert.Equal(t, 0, len(w.commits))
+}
+
+func TestPartitionWindowEvaluate(t *testing.T) {
+	t0 := time.Now().Add(-time.Minute * subStatusWindow)
+	now := t0.Add(time.Minute * subStatusWindow)
+
+	// not enough commits
+	w := fillWindow([]int64{1, 1, 1}, []int64{5, 6, 7}, t0)
+	assert.Equal(t, statusOK, w.evaluate(now))
+
+	// caught up once
+	w = fillWindow([]int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, []int64{5, 6, 7, 0, 1, 2, 3, 4, 5, 6}, t0)
+	assert.Equal(t, statusOK, w.evaluate(now))
+
+	// lag growing
+	w = fillWindow([]int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, t0)
+	assert.Equal(t, statusWarn, w.evaluate(now))
+
+	// lag sometimes drops
+	w = fillWindow([]int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, []int64{1, 2, 3, 4, 3, 6, 7, 8, 9, 10}, t0)
+	assert.Equal(t, statusOK, w.evaluate(now))
+
+	// committing without progress
+	w = fillWindow([]int64{5, 5, 5, 5, 5, 5, 5, 5, 5, 5}, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, t0)
+	assert.Equal(t, statusStalled, w.evaluate(now))
+
+	// no commit for longer than the window span
+	assert.Equal(t, statusStopped, w.evaluate(now.Add(time.Hour)))
+	assert.Equal(t, "STOPPED", statusStopped.String())
+}
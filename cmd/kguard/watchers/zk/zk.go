@@ -2,7 +2,6 @@ package zk
 
 import (
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
@@ -49,6 +48,8 @@ func (this *WatchZk) Run() {
 	deadNodes := metrics.NewRegisteredGauge("zk.dead", nil)
 	reelect := metrics.NewRegisteredGauge("zk.reelect", nil)
 	watchers := metrics.NewRegisteredGauge("zk.watchers", nil)
+	latency := metrics.NewRegisteredGauge("zk.latency", nil)
+	outstanding := metrics.NewRegisteredGauge("zk.outstanding", nil)
 	lastLeader := ""
 	for {
 		select {
@@ -57,9 +58,13 @@ func (this *WatchZk) Run() {
 			return
 
 		case <-ticker.C:
-			watchers.Update(int64(this.collectWatchers()))
+			ensemble := this.Zkzone.EnsembleStats()
+			watchers.Update(this.collectWatchers(ensemble))
+			lat, o := this.collectLoad(ensemble)
+			latency.Update(lat)
+			outstanding.Update(o)
 
-			r, c, z, d, l := this.collectMetrics()
+			r, c, z, d, l := this.collectMetrics(ensemble)
 			if this.lastReceived > 0 {
 				qps.Update((r - this.lastReceived) / int64(this.Tick.Seconds()))
 			}
@@ -78,38 +83,42 @@ func (this *WatchZk) Run() {
 	}
 }
 
-func (this *WatchZk) collectMetrics() (received, conns, znodes, dead int64, leader string) {
-	for host, statOutput := range this.Zkzone.RunZkFourLetterCommand("stat") {
-		stat := zk.ParseStatResult(statOutput)
-		if stat.Mode == "L" {
-			leader = host
+func (this *WatchZk) collectMetrics(ensemble []zk.ZkServerStats) (received, conns, znodes, dead int64, leader string) {
+	for _, stats := range ensemble {
+		if stats.Err != nil || stats.Srvr.Mode == "" {
+			dead++
+			continue
+		}
+
+		if stats.Leader() {
+			leader = stats.Server
 		}
-		n, _ := strconv.Atoi(stat.Received)
+		n, _ := strconv.Atoi(stats.Srvr.Received)
 		received += int64(n)
-		n, _ = strconv.Atoi(stat.Connections)
-		conns += int64(n)                // sum up the total connections
-		n, _ = strconv.Atoi(stat.Znodes) // each node in zk should the same amount of znode
+		n, _ = strconv.Atoi(stats.Srvr.Connections)
+		conns += int64(n)                      // sum up the total connections
+		n, _ = strconv.Atoi(stats.Srvr.Znodes) // each node in zk should the same amount of znode
 		znodes = int64(n)
-		if stat.Mode == "" {
-			dead++
-		}
 	}
 
 	return
 }
 
-func (this *WatchZk) collectWatchers() (n int) {
-	for _, s := range this.Zkzone.RunZkFourLetterCommand("wchs") {
-		for _, line := range strings.Split(s, "\n") {
-			line = strings.TrimSpace(line)
-			tuples := strings.Split(line, "Total watches:")
-			if len(tuples) != 2 {
-				continue
-			}
+func (this *WatchZk) collectWatchers(ensemble []zk.ZkServerStats) (n int64) {
+	for _, stats := range ensemble {
+		n += stats.MntrInt("zk_watch_count")
+	}
+
+	return
+}
 
-			watchers, _ := strconv.Atoi(tuples[1])
-			n += watchers
+// collectLoad returns the max avg latency(ms) and total outstanding requests of the ensemble.
+func (this *WatchZk) collectLoad(ensemble []zk.ZkServerStats) (latency, outstanding int64) {
+	for _, stats := range ensemble {
+		if lat := stats.MntrInt("zk_avg_latency"); lat > latency {
+			latency = lat
 		}
+		outstanding += stats.MntrInt("zk_outstanding_requests")
 	}
 
 	return
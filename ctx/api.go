@@ -60,6 +60,56 @@ func Zone(z string) *zone {
 	return conf.zones[z]
 }
 
+// ZoneKatewayEndpoints returns the kateway load balancer addrs of the zone, empty if not configured.
+func ZoneKatewayEndpoints(zone string) (pub, sub, man string) {
+	ensureLogLoaded()
+
+	if z, present := conf.zones[zone]; present {
+		return z.PubEndpoint, z.SubEndpoint, z.ManEndpoint
+	}
+	return
+}
+
+// ZoneTopicNaming returns the topic naming templates of the zone, empty if any name is allowed.
+func ZoneTopicNaming(zone string) []string {
+	ensureLogLoaded()
+
+	if z, present := conf.zones[zone]; present {
+		return z.TopicNaming
+	}
+	return nil
+}
+
+// ZoneKguardAddr returns the kguard api addr of the zone, empty if not configured.
+func ZoneKguardAddr(zone string) string {
+	ensureLogLoaded()
+
+	if z, present := conf.zones[zone]; present {
+		return z.KguardAddr
+	}
+	return ""
+}
+
+// ZoneTunnel returns the ssh jump host to the hosts of the zone, empty if directly reachable.
+func ZoneTunnel(zone string) string {
+	ensureLogLoaded()
+
+	if z, present := conf.zones[zone]; present {
+		return z.Tunnel
+	}
+	return ""
+}
+
+// ZoneInfluxDB returns the influxdb addr and db name of the zone, falling back to the global ones.
+func ZoneInfluxDB(zone string) (addr, db string) {
+	ensureLogLoaded()
+
+	if z, present := conf.zones[zone]; present {
+		return z.InfluxAddr, z.InfluxDB
+	}
+	return conf.influxAddr, conf.influxDB
+}
+
 func ZkDefaultZone() string {
 	ensureLogLoaded()
 	return conf.zkDefaultZone
@@ -155,11 +205,53 @@ func ReverseDnsLookup(ip string, port int) (string, bool) {
 	return "", false
 }
 
+// RackOfIp returns the rack(or availability zone) of an ip by the ip ranges of racks.
+func RackOfIp(ip string) (string, bool) {
+	ensureLogLoaded()
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return "", false
+	}
+
+	for _, r := range conf.racks {
+		if r.ipnet.Contains(addr) {
+			return r.rack, true
+		}
+	}
+
+	return "", false
+}
+
 func KafkaHome() string {
 	ensureLogLoaded()
 	return conf.kafkaHome
 }
 
+// ZkAudit returns the audit spec of mutating zk operations, e,g. file:/var/log/zk_audit.log.
+func ZkAudit() string {
+	ensureLogLoaded()
+	return conf.zkAudit
+}
+
+// GkHistory returns where to send the gk history besides the local ledger,
+// e,g. kafka:host1:9092,host2:9092/gk_history.
+func GkHistory() string {
+	ensureLogLoaded()
+	return conf.gkHistory
+}
+
+// GkPluginDir returns the dir where gk loads Go plugins(*.so) from, empty means disabled.
+func GkPluginDir() string {
+	ensureLogLoaded()
+	return conf.gkPluginDir
+}
+
+// Notify returns the owner notification config.
+func Notify() NotifyConfig {
+	ensureLogLoaded()
+	return conf.notify
+}
+
 func SortedZones() []string {
 	ensureLogLoaded()
 	return conf.sortedZones()
@@ -206,6 +298,20 @@ func NumCPUStr() string {
 	return strconv.Itoa(NumCPU())
 }
 
+// CurrentUser returns the login name of the operator, the sudo invoker if under sudo.
+func CurrentUser() string {
+	if u := os.Getenv("SUDO_USER"); u != "" {
+		return u
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return "unknown"
+	}
+
+	return u.Username
+}
+
 func CurrentUserIsRoot() bool {
 	user, err := user.Current()
 	if err != nil {
@@ -2,11 +2,13 @@ package ctx
 
 import (
 	"errors"
+	"net"
 	"sort"
 )
 
 var (
-	ErrInvalidZone = errors.New("Invalid zone")
+	ErrInvalidZone    = errors.New("Invalid zone")
+	ErrSecretNotFound = errors.New("Secret not found")
 
 	conf *config
 )
@@ -18,9 +20,35 @@ type config struct {
 	logLevel      string
 	zkDefaultZone string // zk command default zone name
 	upgradeCenter string
+	zkAudit       string           // audit spec of mutating zk operations, empty means disabled
+	gkHistory     string           // central kafka topic of gk history, empty means local ledger only
+	gkPluginDir   string           // dir of gk Go plugins
+	influxAddr    string           // default influxdb of zones
+	influxDB      string           // default influxdb db name of zones
 	zones         map[string]*zone // name:zone
 	aliases       map[string]string
+	secrets       map[string]string   // name:value reference
 	reverseDns    map[string][]string // ip: domain names
+	racks         []rackRange
+	notify        NotifyConfig
+
+	files   []string          // loaded config files, later ones layered over the former
+	origins map[string]string // key, e,g. zones.prod aliases.xx: file where it comes from
+}
+
+// NotifyConfig is how gk notifies owners of topics and consumer groups.
+type NotifyConfig struct {
+	SmtpAddr   string // host:port of the smtp relay, empty disables email
+	From       string // sender address of email
+	MailDomain string // appended to owners without mail domain
+	DingTalk   string // name of the secret holding DingTalk robot webhook url, empty disables DingTalk
+}
+
+// rackRange is the ip range of a rack or availability zone.
+type rackRange struct {
+	rack   string
+	ipnet  *net.IPNet
+	origin string // file where it comes from
 }
 
 func (c *config) sortedZones() []string {
@@ -1,6 +1,8 @@
 package ctx
 
 import (
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/funkygao/assert"
@@ -9,7 +11,7 @@ import (
 func TestLoadConfig(t *testing.T) {
 	LoadConfig("gafka.cf")
 	t.Logf("%+v", conf)
-	assert.Equal(t, 1, len(conf.zones))
+	assert.Equal(t, 2, len(conf.zones))
 	assert.Equal(t, "info", conf.logLevel)
 	alias, present := Alias("localtopics")
 	assert.Equal(t, true, present)
@@ -22,4 +24,86 @@ func TestLoadConfig(t *testing.T) {
 	assert.Equal(t, true, present)
 	assert.Equal(t, "k10121a.demo.com", host)
 
+	rack, present := RackOfIp("10.1.2.9")
+	assert.Equal(t, true, present)
+	assert.Equal(t, "az2", rack)
+	_, present = RackOfIp("127.0.0.1")
+	assert.Equal(t, false, present)
+}
+
+func TestZoneEndpoints(t *testing.T) {
+	LoadConfig("gafka.cf")
+
+	pub, sub, man := ZoneKatewayEndpoints("local")
+	assert.Equal(t, "localhost:9191", pub)
+	assert.Equal(t, "localhost:9192", sub)
+	assert.Equal(t, "localhost:9193", man)
+	assert.Equal(t, "localhost:10025", ZoneKguardAddr("local"))
+	assert.Equal(t, "", ZoneKguardAddr("test"))
+	assert.Equal(t, "", ZoneTunnel("local"))
+	assert.Equal(t, "ops@jump.test.com", ZoneTunnel("test"))
+
+	// zone influxdb falls back to the global one
+	addr, db := ZoneInfluxDB("local")
+	assert.Equal(t, "localhost:8086", addr)
+	assert.Equal(t, "pubsub", db)
+	addr, db = ZoneInfluxDB("test")
+	assert.Equal(t, "localhost:8087", addr)
+	assert.Equal(t, "test", db)
+
+	assert.Equal(t, 0, len(ZoneTopicNaming("local")))
+	assert.Equal(t, []string{"{appid}.{domain}_{event}.v{n}"}, ZoneTopicNaming("test"))
+}
+
+func TestSecret(t *testing.T) {
+	LoadConfig("gafka.cf")
+
+	v, err := Secret("demo")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "s3cret", v)
+
+	_, err = Secret("non-existent")
+	assert.Equal(t, ErrSecretNotFound, err)
+
+	os.Setenv("GAFKA_DEMO_SECRET", "")
+	_, err = Secret("demo.env")
+	assert.Equal(t, ErrSecretNotFound, err)
+	os.Setenv("GAFKA_DEMO_SECRET", "xyz")
+	v, err = Secret("demo.env")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "xyz", v)
+}
+
+func TestLoadConfigLayered(t *testing.T) {
+	loadConfigs("gafka.cf", "gafka.local.cf")
+
+	assert.Equal(t, 3, len(conf.zones))
+	assert.Equal(t, "mine", DefaultZone())
+	assert.Equal(t, "/opt/kafka_2.10-0.8.2.2", KafkaHome())
+
+	// zone replaced wholesale, influxdb falls back to the global one again
+	assert.Equal(t, "10.1.3.1:2181", conf.zones["test"].Zk)
+	addr, db := ZoneInfluxDB("test")
+	assert.Equal(t, "localhost:8086", addr)
+	assert.Equal(t, "pubsub", db)
+	assert.Equal(t, "localhost:9191", conf.zones["local"].PubEndpoint)
+
+	alias, _ := Alias("localtopics")
+	assert.Equal(t, "topics -z local", alias)
+	alias, _ = Alias("minetopics")
+	assert.Equal(t, "topics -z mine", alias)
+	assert.Equal(t, "env:GAFKA_MY_DEMO_SECRET", conf.secrets["demo"])
+
+	rack, _ := RackOfIp("10.1.2.9")
+	assert.Equal(t, "az9", rack)
+	rack, _ = RackOfIp("10.1.2.200")
+	assert.Equal(t, "az2", rack)
+
+	dump := DumpEffectiveConfig()
+	t.Log(dump)
+	assert.Equal(t, true, strings.Contains(dump, `zk_default_zone: "mine" // gafka.local.cf`))
+	assert.Equal(t, true, strings.Contains(dump, `kafka_home: "/opt/kafka_2.10-0.8.2.2"`+"\n"))
+	assert.Equal(t, true, strings.Contains(dump, `{cmd: "minetopics" alias: "topics -z mine"} // gafka.local.cf`))
+	assert.Equal(t, true, strings.Contains(dump, `{name: "demo.env" value: "env:GAFKA_DEMO_SECRET"}`+"\n"))
+	assert.Equal(t, false, strings.Contains(dump, "s3cret"))
 }
@@ -9,6 +9,10 @@ const (
             "zk": "localhost:2181"
             "influxdb": "localhost:8086"
             "swf": "http://localhost:9195/v1"
+            "pub_entry": "localhost:9191"
+            "sub_entry": "localhost:9192"
+            "man_entry": "localhost:9193"
+            "kguard": "localhost:10025"
         }
         
     ]
@@ -28,6 +32,10 @@ const (
     reverse_dns: [
         
     ]    
+
+    racks: [
+        
+    ]
 }
 `
 )
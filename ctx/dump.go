@@ -0,0 +1,154 @@
+package ctx
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const maskedSecret = "******"
+
+// DumpEffectiveConfig renders the config merged from all the loaded files in the config file
+// syntax. Entries not from the base config file are annotated with the file they come from,
+// and literal secrets are masked.
+func DumpEffectiveConfig() string {
+	ensureLogLoaded()
+
+	var (
+		buf  bytes.Buffer
+		base string
+	)
+	if len(conf.files) > 0 {
+		base = conf.files[0]
+	}
+	from := func(key string) string {
+		if origin := conf.origins[key]; origin != "" && origin != base {
+			return " // " + origin
+		}
+		return ""
+	}
+
+	fmt.Fprintf(&buf, "// merged from: %s\n{\n", strings.Join(conf.files, ", "))
+
+	buf.WriteString("    zones: [\n")
+	for _, name := range conf.sortedZones() {
+		z := conf.zones[name]
+		fmt.Fprintf(&buf, "        {%s\n", from("zones."+name))
+		for _, kv := range [][2]string{
+			{"name", z.Name},
+			{"zk", z.Zk},
+			{"zk_helix", z.ZkHelix},
+			{"influxdb", z.InfluxAddr},
+			{"influxdb_name", z.InfluxDB},
+			{"swf", z.SwfEndpoint},
+			{"kguard", z.KguardAddr},
+			{"tunnel", z.Tunnel},
+			{"pub_entry", z.PubEndpoint},
+			{"sub_entry", z.SubEndpoint},
+			{"man_entry", z.ManEndpoint},
+			{"smoke_app", z.SmokeApp},
+			{"smoke_app_his", z.SmokeHisApp},
+			{"smoke_topic", z.SmokeTopic},
+			{"smoke_topic_ver", z.SmokeTopicVersion},
+			{"smoke_group", z.SmokeGroup},
+			{"admin_user", z.AdminUser},
+		} {
+			if kv[1] != "" {
+				fmt.Fprintf(&buf, "            %s: %q\n", kv[0], kv[1])
+			}
+		}
+		if z.SmokeSecret != "" {
+			fmt.Fprintf(&buf, "            smoke_secret: %q\n", maskedSecret)
+		}
+		if z.AdminPass != "" {
+			fmt.Fprintf(&buf, "            admin_pass: %q\n", maskedSecret)
+		}
+		if len(z.HaProxyStatsUri) > 0 {
+			fmt.Fprintf(&buf, "            haproxy_stats: %s\n", quoteList(z.HaProxyStatsUri))
+		}
+		if len(z.TopicNaming) > 0 {
+			fmt.Fprintf(&buf, "            topic_naming: %s\n", quoteList(z.TopicNaming))
+		}
+		buf.WriteString("        }\n")
+	}
+	buf.WriteString("    ]\n\n")
+
+	for _, kv := range [][2]string{
+		{"zk_default_zone", conf.zkDefaultZone},
+		{"kafka_home", conf.kafkaHome},
+		{"loglevel", conf.logLevel},
+		{"upgrade_center", conf.upgradeCenter},
+		{"zk_audit", conf.zkAudit},
+		{"gk_history", conf.gkHistory},
+		{"gk_plugin_dir", conf.gkPluginDir},
+		{"influxdb", conf.influxAddr},
+		{"influxdb_name", conf.influxDB},
+		{"notify_smtp", conf.notify.SmtpAddr},
+		{"notify_from", conf.notify.From},
+		{"notify_mail_domain", conf.notify.MailDomain},
+		{"notify_dingtalk", conf.notify.DingTalk},
+	} {
+		if kv[1] != "" {
+			fmt.Fprintf(&buf, "    %s: %q%s\n", kv[0], kv[1], from(kv[0]))
+		}
+	}
+
+	buf.WriteString("\n    aliases: [\n")
+	for _, cmd := range sortedKeys(conf.aliases) {
+		fmt.Fprintf(&buf, "        {cmd: %q alias: %q}%s\n", cmd, conf.aliases[cmd], from("aliases."+cmd))
+	}
+	buf.WriteString("    ]\n")
+
+	buf.WriteString("\n    secrets: [\n")
+	for _, name := range sortedKeys(conf.secrets) {
+		ref := conf.secrets[name]
+		if !strings.HasPrefix(ref, secretEnvPrefix) && !strings.HasPrefix(ref, secretFilePrefix) {
+			ref = maskedSecret
+		}
+		fmt.Fprintf(&buf, "        {name: %q value: %q}%s\n", name, ref, from("secrets."+name))
+	}
+	buf.WriteString("    ]\n")
+
+	buf.WriteString("\n    reverse_dns: [\n")
+	ips := make([]string, 0, len(conf.reverseDns))
+	for ip := range conf.reverseDns {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	for _, ip := range ips {
+		for _, host := range conf.reverseDns[ip] {
+			fmt.Fprintf(&buf, "        \"%s:%s\"\n", host, ip)
+		}
+	}
+	buf.WriteString("    ]\n")
+
+	buf.WriteString("\n    racks: [\n")
+	for _, r := range conf.racks {
+		var origin string
+		if r.origin != base {
+			origin = " // " + r.origin
+		}
+		fmt.Fprintf(&buf, "        \"%s:%s\"%s\n", r.rack, r.ipnet, origin)
+	}
+	buf.WriteString("    ]\n}\n")
+
+	return buf.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func quoteList(l []string) string {
+	quoted := make([]string, len(l))
+	for i, s := range l {
+		quoted[i] = fmt.Sprintf("%q", s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
@@ -3,6 +3,7 @@ package ctx
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -11,30 +12,102 @@ import (
 	jsconf "github.com/funkygao/jsconf"
 )
 
+const (
+	homeConfigFile  = ".gafka.cf"
+	localConfigFile = ".gafka.local.cf" // machine local overrides of the team distributed config
+)
+
+// LoadConfig loads the config file.
 func LoadConfig(fn string) {
+	loadConfigs(fn)
+}
+
+// loadConfigs loads the config files in order, each later file layered over the former ones:
+//
+//	scalars      replaced if present
+//	zones        replaced wholesale by zone name, others added
+//	aliases      merged by cmd
+//	secrets      merged by name
+//	reverse_dns  appended
+//	racks        prepended, so that the later ip ranges win
+func loadConfigs(files ...string) {
+	c := new(config)
+	c.hostname, _ = os.Hostname()
+	c.logLevel = "info"
+	c.zones = make(map[string]*zone)
+	c.aliases = make(map[string]string)
+	c.secrets = make(map[string]string)
+	c.reverseDns = make(map[string][]string)
+	c.racks = make([]rackRange, 0)
+	c.origins = make(map[string]string)
+
+	for _, fn := range files {
+		c.load(fn)
+	}
+
+	for _, z := range c.zones {
+		if z.InfluxAddr == "" {
+			z.InfluxAddr = c.influxAddr
+		}
+		if z.InfluxDB == "" {
+			z.InfluxDB = c.influxDB
+		}
+	}
+
+	conf = c
+}
+
+func (c *config) load(fn string) {
 	cf, err := jsconf.Load(fn)
 	if err != nil {
 		panic(err)
 	}
 
-	conf = new(config)
-	conf.hostname, _ = os.Hostname()
-	conf.kafkaHome = cf.String("kafka_home", "")
-	conf.logLevel = cf.String("loglevel", "info")
-	conf.zkDefaultZone = cf.String("zk_default_zone", "")
-	conf.upgradeCenter = cf.String("upgrade_center", "")
+	c.files = append(c.files, fn)
+
+	// the current value is the default, so that a key absent in the file keeps the former value
+	scalar := func(key string, v *string) {
+		if nv := cf.String(key, *v); nv != *v || c.origins[key] == "" {
+			*v = nv
+			c.origins[key] = fn
+		}
+	}
+	scalar("kafka_home", &c.kafkaHome)
+	scalar("loglevel", &c.logLevel)
+	scalar("zk_default_zone", &c.zkDefaultZone)
+	scalar("upgrade_center", &c.upgradeCenter)
+	scalar("zk_audit", &c.zkAudit)
+	scalar("gk_history", &c.gkHistory)
+	scalar("gk_plugin_dir", &c.gkPluginDir)
+	scalar("influxdb", &c.influxAddr)
+	scalar("influxdb_name", &c.influxDB)
+	scalar("notify_smtp", &c.notify.SmtpAddr)
+	scalar("notify_from", &c.notify.From)
+	scalar("notify_mail_domain", &c.notify.MailDomain)
+	scalar("notify_dingtalk", &c.notify.DingTalk)
 
-	conf.aliases = make(map[string]string)
 	for i := 0; i < len(cf.List("aliases", nil)); i++ {
 		section, err := cf.Section(fmt.Sprintf("aliases[%d]", i))
 		if err != nil {
 			panic(err)
 		}
 
-		conf.aliases[section.String("cmd", "")] = section.String("alias", "")
+		cmd := section.String("cmd", "")
+		c.aliases[cmd] = section.String("alias", "")
+		c.origins["aliases."+cmd] = fn
+	}
+
+	for i := 0; i < len(cf.List("secrets", nil)); i++ {
+		section, err := cf.Section(fmt.Sprintf("secrets[%d]", i))
+		if err != nil {
+			panic(err)
+		}
+
+		name := section.String("name", "")
+		c.secrets[name] = section.String("value", "")
+		c.origins["secrets."+name] = fn
 	}
 
-	conf.zones = make(map[string]*zone)
 	for i := 0; i < len(cf.List("zones", nil)); i++ {
 		section, err := cf.Section(fmt.Sprintf("zones[%d]", i))
 		if err != nil {
@@ -43,10 +116,29 @@ func LoadConfig(fn string) {
 
 		z := new(zone)
 		z.loadConfig(section)
-		conf.zones[z.Name] = z
+		c.zones[z.Name] = z
+		c.origins["zones."+z.Name] = fn
 	}
 
-	conf.reverseDns = make(map[string][]string)
+	racks := make([]rackRange, 0)
+	for _, entry := range cf.StringList("racks", nil) {
+		if entry != "" {
+			// entry e,g. az1:10.10.1.0/24
+			parts := strings.SplitN(entry, ":", 2)
+			if len(parts) != 2 {
+				panic("invalid racks record")
+			}
+
+			_, ipnet, err := net.ParseCIDR(strings.TrimSpace(parts[1]))
+			if err != nil {
+				panic(fmt.Sprintf("invalid racks record: %s", entry))
+			}
+
+			racks = append(racks, rackRange{rack: strings.TrimSpace(parts[0]), ipnet: ipnet, origin: fn})
+		}
+	}
+	c.racks = append(racks, c.racks...)
+
 	for _, entry := range cf.StringList("reverse_dns", nil) {
 		if entry != "" {
 			// entry e,g. k11000b.sit.mycorp.kfk.com:10.10.1.1
@@ -56,24 +148,28 @@ func LoadConfig(fn string) {
 			}
 
 			ip, host := strings.TrimSpace(parts[1]), strings.TrimSpace(parts[0])
-			if _, present := conf.reverseDns[ip]; !present {
-				conf.reverseDns[ip] = make([]string, 0)
+			if _, present := c.reverseDns[ip]; !present {
+				c.reverseDns[ip] = make([]string, 0)
 			}
 
-			conf.reverseDns[ip] = append(conf.reverseDns[ip], host)
+			c.reverseDns[ip] = append(c.reverseDns[ip], host)
 		}
 	}
 
 }
 
+// LoadFromHome loads $HOME/.gafka.cf, with the optional machine local $HOME/.gafka.local.cf
+// layered over it, where an operator puts personal zones and aliases without touching the
+// team distributed config.
 func LoadFromHome() {
-	var configFile string
+	var home string
 	if usr, err := user.Current(); err == nil {
-		configFile = filepath.Join(usr.HomeDir, ".gafka.cf")
+		home = usr.HomeDir
 	} else {
 		panic(err)
 	}
 
+	configFile := filepath.Join(home, homeConfigFile)
 	_, err := os.Stat(configFile)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -87,5 +183,13 @@ func LoadFromHome() {
 		}
 	}
 
-	LoadConfig(configFile)
+	localFile := filepath.Join(home, localConfigFile)
+	if _, err = os.Stat(localFile); err == nil {
+		loadConfigs(configFile, localFile)
+		return
+	} else if !os.IsNotExist(err) {
+		panic(err)
+	}
+
+	loadConfigs(configFile)
 }
@@ -0,0 +1,46 @@
+package ctx
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	secretEnvPrefix  = "env:"
+	secretFilePrefix = "file:"
+)
+
+// Secret resolves the named secret of the secrets section, so that sensitive values
+// need not be put in config file in plain text. The value reference can be:
+//
+//	env:VAR      read from environment variable VAR
+//	file:/path   read from file, surrounding whitespaces trimmed
+//	others       the literal value itself
+func Secret(name string) (string, error) {
+	ensureLogLoaded()
+
+	ref, present := conf.secrets[name]
+	if !present {
+		return "", ErrSecretNotFound
+	}
+
+	switch {
+	case strings.HasPrefix(ref, secretEnvPrefix):
+		v := os.Getenv(strings.TrimPrefix(ref, secretEnvPrefix))
+		if v == "" {
+			return "", ErrSecretNotFound
+		}
+		return v, nil
+
+	case strings.HasPrefix(ref, secretFilePrefix):
+		b, err := ioutil.ReadFile(strings.TrimPrefix(ref, secretFilePrefix))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+
+	default:
+		return ref, nil
+	}
+}
@@ -7,13 +7,17 @@ import (
 type zone struct {
 	Name        string // prod
 	Zk          string // localhost:2181,localhost:2182
-	InfluxAddr  string // localhost:8086
+	InfluxAddr  string // localhost:8086, defaults to the global influxdb
+	InfluxDB    string // influxdb db name, defaults to the global influxdb_name
 	SwfEndpoint string // http://192.168.10.134:9195/v1
+	KguardAddr  string // kguard api addr, e,g. the VIP of kguard candidates
+	Tunnel      string // ssh jump host to the hosts of the zone, e,g. ops@jump.prod.com:2222
 
 	ZkHelix string // localhost:2181/helix
 
 	// smoke test related
 	PubEndpoint, SubEndpoint string // the load balancer addr
+	ManEndpoint              string // the load balancer addr of kateway management api
 	SmokeApp                 string
 	SmokeHisApp              string
 	SmokeSecret              string
@@ -22,6 +26,8 @@ type zone struct {
 	SmokeGroup               string
 	HaProxyStatsUri          []string
 
+	TopicNaming []string // topic naming templates, see package naming
+
 	AdminUser, AdminPass string
 }
 
@@ -32,9 +38,13 @@ func (this *zone) loadConfig(section *ljconf.Conf) {
 	this.AdminUser = section.String("admin_user", "_psubAdmin_")
 	this.AdminPass = section.String("admin_pass", "_wandafFan_")
 	this.InfluxAddr = section.String("influxdb", "")
+	this.InfluxDB = section.String("influxdb_name", "")
 	this.SwfEndpoint = section.String("swf", "")
+	this.KguardAddr = section.String("kguard", "")
+	this.Tunnel = section.String("tunnel", "")
 	this.PubEndpoint = section.String("pub_entry", "")
 	this.SubEndpoint = section.String("sub_entry", "")
+	this.ManEndpoint = section.String("man_entry", "")
 	this.SmokeApp = section.String("smoke_app", "")
 	this.SmokeSecret = section.String("smoke_secret", "")
 	this.SmokeTopic = section.String("smoke_topic", "smoketestonly")
@@ -42,6 +52,7 @@ func (this *zone) loadConfig(section *ljconf.Conf) {
 	this.SmokeHisApp = section.String("smoke_app_his", this.SmokeApp)
 	this.SmokeGroup = section.String("smoke_group", "__smoketestonly__")
 	this.HaProxyStatsUri = section.StringList("haproxy_stats", nil)
+	this.TopicNaming = section.StringList("topic_naming", nil)
 	if this.Name == "" {
 		panic("empty zone name not allowed")
 	}
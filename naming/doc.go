@@ -0,0 +1,9 @@
+// Package naming enforces the standardized topic naming policy of a zone.
+//
+// A policy is a list of templates, a topic name is valid if it matches any of them:
+// {appid}.{domain}_{event}.v{n}
+// ^app[0-9]+\.[a-z]+\.v[0-9]+$
+//
+// In templates, {n} matches digits and any other {placeholder} matches letters and digits,
+// the rest matches literally. An entry beginning with ^ is a regex.
+package naming
@@ -0,0 +1,16 @@
+package naming
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidName is returned when a topic name violates the naming policy.
+type ErrInvalidName struct {
+	Topic     string
+	Templates []string
+}
+
+func (this ErrInvalidName) Error() string {
+	return fmt.Sprintf("topic %s violates naming policy: %s", this.Topic, strings.Join(this.Templates, " | "))
+}
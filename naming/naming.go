@@ -0,0 +1,78 @@
+package naming
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var placeholderRegex = regexp.MustCompile(`\{[a-zA-Z_]+\}`)
+
+// Policy validates topic names against the templates, empty policy allows any name.
+type Policy struct {
+	templates []string
+	regexes   []*regexp.Regexp
+}
+
+// New compiles the templates into a Policy.
+func New(templates []string) (*Policy, error) {
+	this := &Policy{}
+	for _, t := range templates {
+		if t == "" {
+			continue
+		}
+
+		r, err := compile(t)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %v", t, err)
+		}
+
+		this.templates = append(this.templates, t)
+		this.regexes = append(this.regexes, r)
+	}
+
+	return this, nil
+}
+
+func compile(template string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(template, "^") {
+		return regexp.Compile(template)
+	}
+
+	var (
+		expr = "^"
+		last = 0
+	)
+	for _, loc := range placeholderRegex.FindAllStringIndex(template, -1) {
+		expr += regexp.QuoteMeta(template[last:loc[0]])
+		if template[loc[0]:loc[1]] == "{n}" {
+			expr += "[0-9]+"
+		} else {
+			expr += "[a-zA-Z0-9]+"
+		}
+		last = loc[1]
+	}
+	expr += regexp.QuoteMeta(template[last:]) + "$"
+
+	return regexp.Compile(expr)
+}
+
+// Templates returns the templates of the policy.
+func (this *Policy) Templates() []string {
+	return this.templates
+}
+
+// Validate returns ErrInvalidName if the topic matches none of the templates.
+func (this *Policy) Validate(topic string) error {
+	if len(this.regexes) == 0 {
+		return nil
+	}
+
+	for _, r := range this.regexes {
+		if r.MatchString(topic) {
+			return nil
+		}
+	}
+
+	return ErrInvalidName{Topic: topic, Templates: this.templates}
+}
@@ -0,0 +1,34 @@
+package naming
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	p, err := New([]string{"{appid}.{domain}_{event}.v{n}", `^__[a-z]+__$`})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(p.Templates()))
+
+	for _, topic := range []string{"app1.order_created.v1", "app1.order_created.v12", "__consumer__"} {
+		assert.Equal(t, nil, p.Validate(topic))
+	}
+	for _, topic := range []string{"app1.order.v1", "app1.order_created.vx", "app1.order_created.v1.x", "test", "__Consumer__"} {
+		assert.NotEqual(t, nil, p.Validate(topic))
+	}
+
+	// literal parts are not regex
+	p, _ = New([]string{"{appid}.log"})
+	assert.Equal(t, nil, p.Validate("app1.log"))
+	assert.NotEqual(t, nil, p.Validate("app1xlog"))
+}
+
+func TestEmptyPolicy(t *testing.T) {
+	p, err := New(nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, p.Validate("anything.goes"))
+
+	_, err = New([]string{"^app(["})
+	assert.NotEqual(t, nil, err)
+}
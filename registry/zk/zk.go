@@ -103,7 +103,7 @@ func (this *zkreg) Deregister(id string, oldData []byte) error {
 		return fmt.Errorf("registry[%s] exp %, got %s", id, string(oldData), string(data))
 	}
 
-	return this.zkzone.Conn().Delete(this.mypath(id), -1)
+	return this.zkzone.DeleteZnode(this.mypath(id), -1)
 }
 
 func (this *zkreg) WatchInstances() ([]string, <-chan zklib.Event, error) {
@@ -1,7 +1,7 @@
 package sla
 
 func ValidateShadowName(name string) bool {
-	if name != SlaKeyRetryTopic && name != SlaKeyDeadLetterTopic {
+	if name != SlaKeyRetryTopic && name != SlaKeyDeadLetterTopic && !IsRetryStageShadow(name) {
 		return false
 	}
 
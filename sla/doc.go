@@ -3,4 +3,7 @@
 // Warded topic has 2 extra topics:
 // {appid}.{topic}.retry.{ver}
 // {appid}.{topic}.dead.{ver}
+//
+// and optionally the retry stage topics of a RetryChain, e,g.
+// {appid}.{topic}.{ver}.{myappid}.{group}.retry.5s
 package sla
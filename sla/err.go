@@ -9,4 +9,7 @@ var (
 	ErrEmptyArg         = errors.New("empty argument")
 	ErrNotNumber        = errors.New("not number")
 	ErrTooBigPartitions = errors.New("too big partitions")
+
+	ErrInvalidRetryChain = errors.New("retry chain must be increasing delays in seconds between 1s and 7d, e,g. 5s,1m,10m")
+	ErrTooManyRetries    = errors.New("too many retry stages")
 )
@@ -0,0 +1,116 @@
+package sla
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	maxRetryStages   = 8
+	minRetryDelay    = time.Second // job due time is in seconds
+	maxRetryDelay    = 7 * 24 * time.Hour
+	retryStagePrefix = SlaKeyRetryTopic + "."
+)
+
+// RetryChain is the increasing delays of the retry topics a failed message hops through
+// before landing in the dead letter topic.
+//
+// For topic t with chain 5s,1m: a message failed in t is fired into t.retry.5s after 5s,
+// failed again into t.retry.1m after 1m, failed again into t.dead.
+type RetryChain []time.Duration
+
+// ParseRetryChain parses delays seperated by comma, e,g. 5s,1m,10m.
+func ParseRetryChain(s string) (RetryChain, error) {
+	if s == "" {
+		return nil, ErrEmptyArg
+	}
+
+	var c RetryChain
+	for _, p := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(p))
+		if err != nil || d < minRetryDelay || d > maxRetryDelay || d%time.Second != 0 {
+			return nil, ErrInvalidRetryChain
+		}
+		if len(c) > 0 && d <= c[len(c)-1] {
+			return nil, ErrInvalidRetryChain
+		}
+
+		c = append(c, d)
+	}
+
+	if len(c) > maxRetryStages {
+		return nil, ErrTooManyRetries
+	}
+
+	return c, nil
+}
+
+func (c RetryChain) String() string {
+	r := make([]string, 0, len(c))
+	for _, d := range c {
+		r = append(r, compactDuration(d))
+	}
+	return strings.Join(r, ",")
+}
+
+// Shadow returns the shadow name of a retry stage, stage is 1 based.
+func (c RetryChain) Shadow(stage int) string {
+	return retryStagePrefix + compactDuration(c[stage-1])
+}
+
+// Topics returns the retry topics of a topic in stage order.
+func (c RetryChain) Topics(topic string) []string {
+	r := make([]string, 0, len(c))
+	for stage := 1; stage <= len(c); stage++ {
+		r = append(r, topic+"."+c.Shadow(stage))
+	}
+	return r
+}
+
+// Stage returns the stage of a shadow name: 0 for the original topic(empty shadow),
+// -1 if the shadow is not a stage of this chain.
+func (c RetryChain) Stage(shadow string) int {
+	if shadow == "" {
+		return 0
+	}
+
+	for stage := 1; stage <= len(c); stage++ {
+		if c.Shadow(stage) == shadow {
+			return stage
+		}
+	}
+	return -1
+}
+
+// Next returns where a message failed at the stage goes: the shadow of the next stage
+// and the delay before it fires there, or dead if the chain is exhausted.
+func (c RetryChain) Next(stage int) (shadow string, delay time.Duration, dead bool) {
+	if stage >= len(c) {
+		return SlaKeyDeadLetterTopic, 0, true
+	}
+
+	return c.Shadow(stage + 1), c[stage], false
+}
+
+// IsRetryStageShadow checks if a shadow name is a retry stage, e,g. retry.5s.
+func IsRetryStageShadow(name string) bool {
+	if !strings.HasPrefix(name, retryStagePrefix) {
+		return false
+	}
+
+	d, err := time.ParseDuration(name[len(retryStagePrefix):])
+	return err == nil && d >= minRetryDelay && compactDuration(d) == name[len(retryStagePrefix):]
+}
+
+// compactDuration formats a duration in the largest unit dividing it, e,g. 5s, 90s, 1m, 2h.
+func compactDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
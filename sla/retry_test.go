@@ -0,0 +1,54 @@
+package sla
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestParseRetryChain(t *testing.T) {
+	c, err := ParseRetryChain("5s,1x")
+	assert.Equal(t, ErrInvalidRetryChain, err) // not a duration
+
+	c, err = ParseRetryChain("5s,90s,10m,2h")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, len(c))
+	assert.Equal(t, 90*time.Second, c[1])
+	assert.Equal(t, "5s,90s,10m,2h", c.String())
+
+	for _, s := range []string{"1m,5s", "5s,5s", "500ms", "1500ms", "0s", "8d", "-1s"} {
+		_, err = ParseRetryChain(s)
+		assert.Equal(t, ErrInvalidRetryChain, err)
+	}
+	_, err = ParseRetryChain("")
+	assert.Equal(t, ErrEmptyArg, err)
+	_, err = ParseRetryChain("1s,2s,3s,4s,5s,6s,7s,8s,9s")
+	assert.Equal(t, ErrTooManyRetries, err)
+}
+
+func TestRetryChainStages(t *testing.T) {
+	c, _ := ParseRetryChain("5s,1m")
+	assert.Equal(t, []string{"t.retry.5s", "t.retry.1m"}, c.Topics("t"))
+	assert.Equal(t, 0, c.Stage(""))
+	assert.Equal(t, 2, c.Stage("retry.1m"))
+	assert.Equal(t, -1, c.Stage("retry.60s"))
+	assert.Equal(t, -1, c.Stage("retry"))
+
+	shadow, delay, dead := c.Next(0)
+	assert.Equal(t, "retry.5s", shadow)
+	assert.Equal(t, 5*time.Second, delay)
+	assert.Equal(t, false, dead)
+	shadow, delay, dead = c.Next(1)
+	assert.Equal(t, "retry.1m", shadow)
+	assert.Equal(t, time.Minute, delay)
+	shadow, _, dead = c.Next(2)
+	assert.Equal(t, SlaKeyDeadLetterTopic, shadow)
+	assert.Equal(t, true, dead)
+
+	assert.Equal(t, true, IsRetryStageShadow("retry.5s"))
+	assert.Equal(t, true, ValidateShadowName("retry.1m"))
+	assert.Equal(t, false, IsRetryStageShadow("retry.60s"))
+	assert.Equal(t, false, IsRetryStageShadow("retry.0s"))
+	assert.Equal(t, false, ValidateShadowName("retry.foo"))
+}
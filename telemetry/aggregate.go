@@ -0,0 +1,9 @@
+package telemetry
+
+// Aggregate is a gauge downsampled over a flush interval, put into the registry scanned
+// by a Reporter in place of the gauge itself.
+type Aggregate struct {
+	Min, Max, Avg float64
+	Samples       int
+	Integer       bool // downsampled from metrics.Gauge, persisted as integer to keep the type of the series
+}
@@ -0,0 +1,93 @@
+package telemetry
+
+import (
+	"strings"
+
+	"github.com/funkygao/go-metrics"
+)
+
+// Point is a single scalar value flattened from a go-metrics metric.
+type Point struct {
+	Name              string // e,g. pub.qps.meter.m1
+	Appid, Topic, Ver string // empty if the metric is not tagged
+	Value             float64
+}
+
+// Flatten expands each metric of the registry into scalar points, for TSDBs
+// that store 1 value per series such as Graphite and OpenTSDB.
+// The naming is the same as influxdb measurement plus field.
+func Flatten(r metrics.Registry, fn func(Point)) {
+	r.Each(func(name string, i interface{}) {
+		if strings.HasPrefix(name, "_") {
+			// in-mem only private metrics, will not be persisted
+			return
+		}
+
+		var p Point
+		p.Appid, p.Topic, p.Ver, name = Untag(name)
+		emit := func(suffix string, v float64) {
+			p.Name, p.Value = name+suffix, v
+			fn(p)
+		}
+
+		switch m := i.(type) {
+		case metrics.Counter:
+			emit(".count", float64(m.Count()))
+
+		case metrics.Gauge:
+			emit(".gauge", float64(m.Value()))
+
+		case metrics.GaugeFloat64:
+			emit(".gauge", m.Value())
+
+		case *Aggregate:
+			emit(".gauge", m.Avg)
+			emit(".gauge.min", m.Min)
+			emit(".gauge.max", m.Max)
+
+		case metrics.Histogram:
+			h := m.Snapshot()
+			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			emit(".histogram.count", float64(h.Count()))
+			emit(".histogram.min", float64(h.Min()))
+			emit(".histogram.max", float64(h.Max()))
+			emit(".histogram.mean", h.Mean())
+			emit(".histogram.stddev", h.StdDev())
+			emit(".histogram.p50", ps[0])
+			emit(".histogram.p75", ps[1])
+			emit(".histogram.p95", ps[2])
+			emit(".histogram.p99", ps[3])
+			emit(".histogram.p999", ps[4])
+
+		case metrics.Timer:
+			t := m.Snapshot()
+			ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			emit(".timer.count", float64(t.Count()))
+			emit(".timer.min", float64(t.Min()))
+			emit(".timer.max", float64(t.Max()))
+			emit(".timer.mean", t.Mean())
+			emit(".timer.stddev", t.StdDev())
+			emit(".timer.p50", ps[0])
+			emit(".timer.p75", ps[1])
+			emit(".timer.p95", ps[2])
+			emit(".timer.p99", ps[3])
+			emit(".timer.p999", ps[4])
+			emit(".timer.m1", t.Rate1())
+			emit(".timer.m5", t.Rate5())
+			emit(".timer.m15", t.Rate15())
+			emit(".timer.meanrate", t.RateMean())
+
+		case metrics.Meter:
+			s := m.Snapshot()
+			emit(".meter.count", float64(s.Count()))
+			emit(".meter.m1", s.Rate1())
+			emit(".meter.m5", s.Rate5())
+			emit(".meter.m15", s.Rate15())
+			emit(".meter.mean", s.RateMean())
+
+		case metrics.Healthcheck:
+			// ignored
+
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package telemetry
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/go-metrics"
+)
+
+func TestFlatten(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter(Tag("app1", "mytopic", "v1")+"pub.ok", r).Inc(5)
+	metrics.NewRegisteredGauge("lag", r).Update(10)
+	metrics.NewRegisteredGauge("_private", r).Update(1)
+
+	points := make(map[string]Point)
+	Flatten(r, func(p Point) {
+		points[p.Name] = p
+	})
+
+	assert.Equal(t, 2, len(points))
+	p := points["pub.ok.count"]
+	assert.Equal(t, "app1", p.Appid)
+	assert.Equal(t, "mytopic", p.Topic)
+	assert.Equal(t, "v1", p.Ver)
+	assert.Equal(t, float64(5), p.Value)
+	p = points["lag.gauge"]
+	assert.Equal(t, "", p.Appid)
+	assert.Equal(t, float64(10), p.Value)
+}
+
+// aggregateRegistry puts aggregates in place of the gauges as the kguard downsampler.
+type aggregateRegistry struct {
+	metrics.Registry
+	aggregates map[string]*Aggregate
+}
+
+func (this aggregateRegistry) Each(f func(string, interface{})) {
+	for name, a := range this.aggregates {
+		f(name, a)
+	}
+}
+
+func TestFlattenAggregate(t *testing.T) {
+	r := aggregateRegistry{
+		Registry:   metrics.NewRegistry(),
+		aggregates: map[string]*Aggregate{"lag": {Min: 1, Max: 9, Avg: 4, Samples: 3}},
+	}
+
+	points := make(map[string]float64)
+	Flatten(r, func(p Point) {
+		points[p.Name] = p.Value
+	})
+
+	assert.Equal(t, map[string]float64{"lag.gauge": 4, "lag.gauge.min": 1, "lag.gauge.max": 9}, points)
+}
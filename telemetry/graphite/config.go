@@ -0,0 +1,32 @@
+package graphite
+
+import (
+	"errors"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+)
+
+type config struct {
+	interval time.Duration
+	hostname string // local host name
+
+	addr   string // carbon plaintext listener host:port
+	prefix string // prefix of all metric paths
+}
+
+func NewConfig(addr, prefix string, interval time.Duration) (*config, error) {
+	if interval == 0 {
+		return nil, errors.New("illegal interval")
+	}
+	if addr == "" {
+		return nil, errors.New("empty graphite addr")
+	}
+
+	return &config{
+		hostname: ctx.Hostname(),
+		addr:     addr,
+		prefix:   prefix,
+		interval: interval,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package graphite
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/funkygao/gafka/telemetry"
+	"github.com/funkygao/go-metrics"
+	log "github.com/funkygao/log4go"
+)
+
+var _ telemetry.Reporter = &runner{}
+
+type runner struct {
+	cf  *config
+	reg metrics.Registry
+
+	quiting, quit chan struct{}
+}
+
+// New creates a Graphite reporter which will write the metrics from the given registry
+// to carbon with plaintext protocol at each interval.
+// Tags are encoded into metric path: {prefix}.{host}[.{appid}.{topic}.{ver}].{name}
+func New(r metrics.Registry, cf *config) telemetry.Reporter {
+	this := &runner{
+		reg:     r,
+		cf:      cf,
+		quiting: make(chan struct{}),
+		quit:    make(chan struct{}),
+	}
+
+	return this
+}
+
+func (*runner) Name() string {
+	return "graphite"
+}
+
+func (this *runner) Stop() {
+	close(this.quiting)
+	<-this.quit
+}
+
+func (this *runner) Start() error {
+	defer func() {
+		if err := recover(); err != nil {
+			fmt.Println(err)
+			debug.PrintStack()
+		}
+	}()
+
+	intervalTicker := time.Tick(this.cf.interval)
+	for {
+		select {
+		case <-this.quiting:
+			// drain
+			this.dump(this.export())
+
+			close(this.quit)
+			return nil
+
+		case <-intervalTicker:
+			this.dump(this.export())
+		}
+	}
+
+	return nil
+}
+
+func (this *runner) export() []string {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	lines := make([]string, 0, 1<<8)
+	telemetry.Flatten(this.reg, func(p telemetry.Point) {
+		lines = append(lines, fmt.Sprintf("%s %s %s\n", this.path(p),
+			strconv.FormatFloat(p.Value, 'f', -1, 64), now))
+	})
+	return lines
+}
+
+func (this *runner) path(p telemetry.Point) string {
+	parts := make([]string, 0, 6)
+	if this.cf.prefix != "" {
+		parts = append(parts, this.cf.prefix)
+	}
+	parts = append(parts, sanitize(this.cf.hostname))
+	if p.Appid != "" {
+		parts = append(parts, sanitize(p.Appid), sanitize(p.Topic), sanitize(p.Ver))
+	}
+	parts = append(parts, p.Name)
+	return strings.Join(parts, ".")
+}
+
+func (this *runner) dump(lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+
+	conn, err := net.DialTimeout("tcp", this.cf.addr, time.Second*4)
+	if err != nil {
+		log.Error("graphite quit this tick: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	log.Trace("graphite writing %d points", len(lines))
+
+	conn.SetWriteDeadline(time.Now().Add(time.Second * 10))
+	w := bufio.NewWriter(conn)
+	for _, line := range lines {
+		if _, err = w.WriteString(line); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Error("graphite: %v", err)
+	}
+}
+
+// sanitize makes a tag value a single graphite path node.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ' ', '/', ':':
+			return '_'
+		}
+		return r
+	}, s)
+}
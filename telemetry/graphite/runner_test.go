@@ -0,0 +1,18 @@
+package graphite
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/telemetry"
+)
+
+func TestPath(t *testing.T) {
+	r := &runner{cf: &config{hostname: "k10.foo.com", prefix: "gafka"}}
+	assert.Equal(t, "gafka.k10_foo_com.pub.qps.meter.m1", r.path(telemetry.Point{Name: "pub.qps.meter.m1"}))
+	assert.Equal(t, "gafka.k10_foo_com.app1.a_b.v1.pub.ok.count",
+		r.path(telemetry.Point{Name: "pub.ok.count", Appid: "app1", Topic: "a.b", Ver: "v1"}))
+
+	r.cf.prefix = ""
+	assert.Equal(t, "k10_foo_com.lag.gauge", r.path(telemetry.Point{Name: "lag.gauge"}))
+}
@@ -2,6 +2,7 @@ package influxdb
 
 import (
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -93,6 +94,24 @@ func (this *runner) export(pts *[]client.Point) {
 				Time: now,
 			})
 
+		case *telemetry.Aggregate:
+			fields := map[string]interface{}{
+				"value": m.Avg,
+				"min":   m.Min,
+				"max":   m.Max,
+			}
+			if m.Integer {
+				fields["value"] = int64(math.Floor(m.Avg + 0.5))
+				fields["min"] = int64(m.Min)
+				fields["max"] = int64(m.Max)
+			}
+			*pts = append(*pts, client.Point{
+				Measurement: fmt.Sprintf("%s.gauge", name),
+				Fields:      fields,
+				Tags:        tags,
+				Time:        now,
+			})
+
 		case metrics.Histogram:
 			ps := m.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999, 0.9999})
 			*pts = append(*pts, client.Point{
@@ -0,0 +1,39 @@
+package opentsdb
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/funkygao/gafka/ctx"
+)
+
+type config struct {
+	interval time.Duration
+	hostname string // local host name
+
+	url    url.URL // http api endpoint of any tsd
+	prefix string  // prefix of all metric names
+}
+
+func NewConfig(uri, prefix string, interval time.Duration) (*config, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if interval == 0 {
+		return nil, errors.New("illegal interval")
+	}
+	if uri == "" {
+		return nil, errors.New("empty opentsdb uri")
+	}
+
+	u.Path = "/api/put"
+	return &config{
+		hostname: ctx.Hostname(),
+		url:      *u,
+		prefix:   prefix,
+		interval: interval,
+	}, nil
+}
@@ -0,0 +1,164 @@
+package opentsdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/funkygao/gafka/telemetry"
+	"github.com/funkygao/go-metrics"
+	log "github.com/funkygao/log4go"
+)
+
+var _ telemetry.Reporter = &runner{}
+
+// maxBatch keeps each put request below tsd.http.request.max_chunk.
+const maxBatch = 500
+
+type dataPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     float64           `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+type runner struct {
+	cf     *config
+	reg    metrics.Registry
+	client *http.Client
+
+	quiting, quit chan struct{}
+}
+
+// New creates a OpenTSDB reporter which will put the metrics from the given registry
+// through http api at each interval.
+func New(r metrics.Registry, cf *config) telemetry.Reporter {
+	this := &runner{
+		reg:     r,
+		cf:      cf,
+		client:  &http.Client{Timeout: time.Second * 10},
+		quiting: make(chan struct{}),
+		quit:    make(chan struct{}),
+	}
+
+	return this
+}
+
+func (*runner) Name() string {
+	return "opentsdb"
+}
+
+func (this *runner) Stop() {
+	close(this.quiting)
+	<-this.quit
+}
+
+func (this *runner) Start() error {
+	defer func() {
+		if err := recover(); err != nil {
+			fmt.Println(err)
+			debug.PrintStack()
+		}
+	}()
+
+	intervalTicker := time.Tick(this.cf.interval)
+	for {
+		select {
+		case <-this.quiting:
+			// drain
+			this.dump(this.export())
+
+			close(this.quit)
+			return nil
+
+		case <-intervalTicker:
+			this.dump(this.export())
+		}
+	}
+
+	return nil
+}
+
+func (this *runner) export() []dataPoint {
+	now := time.Now().Unix()
+	pts := make([]dataPoint, 0, 1<<8)
+	telemetry.Flatten(this.reg, func(p telemetry.Point) {
+		tags := map[string]string{
+			"host": this.cf.hostname,
+		}
+		if p.Appid != "" {
+			tags["appid"] = sanitize(p.Appid)
+			tags["topic"] = sanitize(p.Topic)
+			tags["ver"] = sanitize(p.Ver)
+		}
+
+		name := p.Name
+		if this.cf.prefix != "" {
+			name = this.cf.prefix + "." + name
+		}
+
+		pts = append(pts, dataPoint{
+			Metric:    sanitize(name),
+			Timestamp: now,
+			Value:     p.Value,
+			Tags:      tags,
+		})
+	})
+	return pts
+}
+
+func (this *runner) dump(pts []dataPoint) {
+	log.Trace("opentsdb writing %d points", len(pts))
+
+	for len(pts) > 0 {
+		n := maxBatch
+		if n > len(pts) {
+			n = len(pts)
+		}
+
+		if err := this.put(pts[:n]); err != nil {
+			log.Error("opentsdb quit this tick: %v", err)
+			return
+		}
+
+		pts = pts[n:]
+	}
+}
+
+func (this *runner) put(pts []dataPoint) error {
+	body, err := json.Marshal(pts)
+	if err != nil {
+		return err
+	}
+
+	res, err := this.client.Post(this.cf.url.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("%s %s", res.Status, string(msg))
+	}
+
+	return nil
+}
+
+// sanitize replaces chars not allowed by opentsdb in metric names and tag values.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '-', r == '_', r == '.', r == '/':
+			return r
+		}
+		return '_'
+	}, s)
+}
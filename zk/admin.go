@@ -0,0 +1,94 @@
+package zk
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// AdminPartition is a partition of a pending admin request, replicas is the target of
+// reassignment and empty for preferred replica election.
+type AdminPartition struct {
+	Topic     string  `json:"topic"`
+	Partition int32   `json:"partition"`
+	Replicas  []int32 `json:"replicas,omitempty"`
+}
+
+// PendingAdmin is the pending /admin/reassign_partitions or /admin/preferred_replica_election
+// of a cluster, which the controller removes once all the partitions are done.
+type PendingAdmin struct {
+	Path       string
+	Partitions []AdminPartition
+	Ctime      time.Time
+	Version    int32 // znode version, to clear exactly what was inspected
+}
+
+// Age returns how long the admin request has been pending.
+func (this *PendingAdmin) Age() time.Duration {
+	return time.Since(this.Ctime)
+}
+
+// PendingReassignment returns the partition reassignment in progress, nil if none.
+func (this *ZkCluster) PendingReassignment() (*PendingAdmin, error) {
+	return this.pendingAdmin(this.reassignPartitionsPath())
+}
+
+// PendingPreferredReplicaElection returns the preferred replica election in progress, nil if none.
+func (this *ZkCluster) PendingPreferredReplicaElection() (*PendingAdmin, error) {
+	return this.pendingAdmin(this.preferredReplicaPath())
+}
+
+func (this *ZkCluster) pendingAdmin(path string) (*PendingAdmin, error) {
+	this.zone.connectIfNeccessary()
+
+	data, stat, err := this.zone.conn.Get(path)
+	if err == zk.ErrNoNode {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	partitions, err := parseAdminPartitions(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PendingAdmin{
+		Path:       path,
+		Partitions: partitions,
+		Ctime:      ZkTimestamp(stat.Ctime).Time(),
+		Version:    stat.Version,
+	}, nil
+}
+
+// parseAdminPartitions parses the admin znode data
+// {"version":1,"partitions":[{"topic":"foo","partition":1,"replicas":[1,2]}]}.
+func parseAdminPartitions(data []byte) ([]AdminPartition, error) {
+	var v struct {
+		Partitions []AdminPartition `json:"partitions"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	return v.Partitions, nil
+}
+
+// ClearPendingAdmin force deletes a stuck admin request of exactly the inspected version, so
+// that a request submitted meanwhile is never lost. zk.ErrBadVersion is returned in that case.
+//
+// The controller still has the request in memory, call ResignController afterwards so that the
+// new controller starts clean.
+func (this *ZkCluster) ClearPendingAdmin(pending *PendingAdmin) error {
+	this.zone.connectIfNeccessary()
+
+	return this.zone.deleteZnode(pending.Path, pending.Version)
+}
+
+// ResignController deletes the controller znode to trigger a controller re-election.
+func (this *ZkCluster) ResignController() error {
+	this.zone.connectIfNeccessary()
+
+	return this.zone.deleteZnode(this.controllerPath(), -1)
+}
@@ -0,0 +1,22 @@
+package zk
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestParseAdminPartitions(t *testing.T) {
+	partitions, err := parseAdminPartitions([]byte(`{"version":1,"partitions":[{"topic":"foo","partition":1,"replicas":[1,2]},{"topic":"bar","partition":0,"replicas":[3]}]}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(partitions))
+	assert.Equal(t, AdminPartition{Topic: "foo", Partition: 1, Replicas: []int32{1, 2}}, partitions[0])
+
+	// preferred replica election has no replicas
+	partitions, err = parseAdminPartitions([]byte(`{"version":1,"partitions":[{"topic":"foo","partition":3}]}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(partitions[0].Replicas))
+
+	_, err = parseAdminPartitions([]byte(`{"version":1`))
+	assert.NotEqual(t, nil, err)
+}
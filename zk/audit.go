@@ -0,0 +1,211 @@
+package zk
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	AuditCreate = "create"
+	AuditSet    = "set"
+	AuditDelete = "delete"
+)
+
+// AuditEvent is a successful mutating zookeeper operation.
+type AuditEvent struct {
+	Time time.Time `json:"time"`
+	Zone string    `json:"zone"`
+	Op   string    `json:"op"`
+	Path string    `json:"path"`
+	Old  string    `json:"old,omitempty"` // digest of the value before the operation
+	New  string    `json:"new,omitempty"` // digest of the value after the operation
+	Cmd  string    `json:"cmd"`           // invoking command line
+	User string    `json:"user"`
+}
+
+// Auditor records the audit events.
+type Auditor interface {
+	Audit(AuditEvent) error
+	Close() error
+}
+
+var (
+	auditor   Auditor // nil if audit disabled
+	auditCmd  string
+	auditUser string
+	mutations int32 // num of mutating operations of this process
+)
+
+// Mutated returns whether this process has ever created/set/deleted any znode.
+func Mutated() bool {
+	return atomic.LoadInt32(&mutations) > 0
+}
+
+// EnableAudit records all successful create/set/delete operations of this process to the
+// auditor specified by spec:
+//
+//	file:/var/log/gafka/zk_audit.log        append json lines to a local file
+//	kafka:host1:9092,host2:9092/zk_audit    produce json messages to a kafka topic
+func EnableAudit(spec, cmd, user string) error {
+	tuples := strings.SplitN(spec, ":", 2)
+	if len(tuples) != 2 || tuples[1] == "" {
+		return fmt.Errorf("invalid audit spec: %s", spec)
+	}
+
+	var (
+		a   Auditor
+		err error
+	)
+	switch tuples[0] {
+	case "file":
+		a, err = newFileAuditor(tuples[1])
+
+	case "kafka":
+		p := strings.LastIndex(tuples[1], "/")
+		if p <= 0 || p == len(tuples[1])-1 {
+			return fmt.Errorf("invalid audit spec: %s", spec)
+		}
+		a, err = newKafkaAuditor(strings.Split(tuples[1][:p], ","), tuples[1][p+1:])
+
+	default:
+		return fmt.Errorf("invalid audit spec: %s", spec)
+	}
+	if err != nil {
+		return err
+	}
+
+	auditor, auditCmd, auditUser = a, cmd, user
+	return nil
+}
+
+// DisableAudit flushes and closes the auditor.
+func DisableAudit() error {
+	if auditor == nil {
+		return nil
+	}
+
+	err := auditor.Close()
+	auditor = nil
+	return err
+}
+
+func valueDigest(data []byte) string {
+	if data == nil {
+		return ""
+	}
+
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// auditValue returns the current value of a znode for the audit before mutating it.
+func (this *ZkZone) auditValue(path string) []byte {
+	if auditor == nil {
+		return nil
+	}
+
+	data, _, err := this.conn.Get(path)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func (this *ZkZone) audit(op, path string, old, new []byte) {
+	atomic.AddInt32(&mutations, 1)
+
+	if auditor == nil {
+		return
+	}
+
+	evt := AuditEvent{
+		Time: time.Now(),
+		Zone: this.Name(),
+		Op:   op,
+		Path: path,
+		Old:  valueDigest(old),
+		New:  valueDigest(new),
+		Cmd:  auditCmd,
+		User: auditUser,
+	}
+	if err := auditor.Audit(evt); err != nil {
+		log.Error("audit %+v: %v", evt, err)
+	}
+}
+
+type fileAuditor struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func newFileAuditor(fn string) (*fileAuditor, error) {
+	f, err := os.OpenFile(fn, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileAuditor{f: f}, nil
+}
+
+func (this *fileAuditor) Audit(evt AuditEvent) error {
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+
+	this.mu.Lock()
+	_, err = this.f.Write(append(b, '\n'))
+	this.mu.Unlock()
+	return err
+}
+
+func (this *fileAuditor) Close() error {
+	return this.f.Close()
+}
+
+type kafkaAuditor struct {
+	topic    string
+	producer sarama.SyncProducer
+}
+
+func newKafkaAuditor(brokers []string, topic string) (*kafkaAuditor, error) {
+	cf := sarama.NewConfig()
+	cf.Net.DialTimeout = time.Second * 4
+	cf.Producer.RequiredAcks = sarama.WaitForAll
+	cf.Producer.Return.Successes = true
+	cf.Producer.Timeout = time.Second * 4
+	p, err := sarama.NewSyncProducer(brokers, cf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafkaAuditor{topic: topic, producer: p}, nil
+}
+
+func (this *kafkaAuditor) Audit(evt AuditEvent) error {
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = this.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: this.topic,
+		Key:   sarama.StringEncoder(evt.Path), // events of a znode are ordered
+		Value: sarama.ByteEncoder(b),
+	})
+	return err
+}
+
+func (this *kafkaAuditor) Close() error {
+	return this.producer.Close()
+}
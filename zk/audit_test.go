@@ -0,0 +1,47 @@
+package zk
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestEnableAuditInvalidSpec(t *testing.T) {
+	for _, spec := range []string{"", "file:", "kafka:localhost:9092", "kafka:localhost:9092/", "mysql:x"} {
+		assert.NotEqual(t, nil, EnableAudit(spec, "gk topics", "bob"))
+	}
+	assert.Equal(t, nil, auditor)
+}
+
+func TestFileAuditor(t *testing.T) {
+	f, err := ioutil.TempFile("", "zk_audit")
+	assert.Equal(t, nil, err)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	assert.Equal(t, nil, EnableAudit("file:"+f.Name(), "gk topics -add foo", "bob"))
+	zone := NewZkZone(DefaultConfig("test", "localhost:2181"))
+	zone.audit(AuditSet, "/brokers/topics/foo", []byte("old"), []byte("new"))
+	zone.audit(AuditDelete, "/brokers/topics/foo", []byte("new"), nil)
+	assert.Equal(t, nil, DisableAudit())
+
+	b, _ := ioutil.ReadFile(f.Name())
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assert.Equal(t, 2, len(lines))
+
+	var evt AuditEvent
+	assert.Equal(t, nil, json.Unmarshal([]byte(lines[0]), &evt))
+	assert.Equal(t, "test", evt.Zone)
+	assert.Equal(t, AuditSet, evt.Op)
+	assert.Equal(t, valueDigest([]byte("old")), evt.Old)
+	assert.Equal(t, valueDigest([]byte("new")), evt.New)
+	assert.Equal(t, "gk topics -add foo", evt.Cmd)
+	assert.Equal(t, "bob", evt.User)
+
+	assert.Equal(t, nil, json.Unmarshal([]byte(lines[1]), &evt))
+	assert.Equal(t, "", evt.New)
+}
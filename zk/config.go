@@ -10,14 +10,18 @@ type Config struct {
 	ZkAddrs        string
 	SessionTimeout time.Duration
 	PanicOnError   bool
+
+	// ReadConcurrency is max inflight znode reads of a bulk fetch, pipelined over the zk session.
+	ReadConcurrency int
 }
 
 func DefaultConfig(name, addrs string) *Config {
 	return &Config{
-		Name:           name,
-		ZkAddrs:        addrs,
-		SessionTimeout: DefaultZkSessionTimeout(),
-		PanicOnError:   false,
+		Name:            name,
+		ZkAddrs:         addrs,
+		SessionTimeout:  DefaultZkSessionTimeout(),
+		PanicOnError:    false,
+		ReadConcurrency: DefaultReadConcurrency,
 	}
 }
 
@@ -25,6 +29,10 @@ func (this *Config) ZkServers() []string {
 	return strings.Split(this.ZkAddrs, ",")
 }
 
+// DefaultReadConcurrency is large enough to hide the round trip of sequential zk reads
+// while not flooding the zk server.
+const DefaultReadConcurrency = 16
+
 func DefaultZkSessionTimeout() time.Duration {
 	// online zk tickTime=2000, valid timeout: 4s ~ 40s
 	// io timeout: 13s  ping interval: 6.5s
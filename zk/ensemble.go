@@ -0,0 +1,148 @@
+package zk
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ZkServerStats is the stats of a zookeeper server collected by four letter words
+// srvr, mntr and cons.
+type ZkServerStats struct {
+	Server string
+	Err    error // the server is unreachable if not nil
+
+	Srvr  ZkStat
+	Mntr  map[string]string // e,g. zk_avg_latency:0, empty if mntr not supported(before 3.4)
+	Conns []ZkConnection
+}
+
+// ZkConnection is a client connection of a zookeeper server.
+type ZkConnection struct {
+	Addr       string // client ip:port
+	SessionId  string
+	LastOp     string
+	Queued     int64
+	Received   int64
+	Sent       int64
+	Timeout    int64 // session timeout in ms
+	AvgLatency int64
+	MaxLatency int64
+}
+
+// Leader checks if the server is the ensemble leader.
+func (this *ZkServerStats) Leader() bool {
+	return this.Srvr.Mode == "L" || this.Mntr["zk_server_state"] == "leader"
+}
+
+// MntrInt returns the integer value of a mntr key, 0 if absent.
+func (this *ZkServerStats) MntrInt(key string) int64 {
+	n, _ := strconv.ParseInt(this.Mntr[key], 10, 64)
+	return n
+}
+
+// EnsembleStats talks to each zookeeper server of the zone concurrently and returns
+// their stats sorted by server.
+func (this *ZkZone) EnsembleStats() []ZkServerStats {
+	servers := this.conf.ZkServers()
+	r := make([]ZkServerStats, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+
+			r[i] = collectServerStats(server, time.Second*10)
+		}(i, server)
+	}
+	wg.Wait()
+
+	sort.Sort(zkServerStatsList(r))
+	return r
+}
+
+func collectServerStats(server string, timeout time.Duration) ZkServerStats {
+	stats := ZkServerStats{Server: server}
+
+	b, err := zkFourLetterWord(server, "srvr", timeout)
+	if err != nil {
+		stats.Err = err
+		return stats
+	}
+	stats.Srvr = ParseStatResult(string(b))
+
+	if b, err = zkFourLetterWord(server, "mntr", timeout); err == nil {
+		stats.Mntr = ParseMntrResult(string(b))
+	}
+	if b, err = zkFourLetterWord(server, "cons", timeout); err == nil {
+		stats.Conns = ParseConsResult(string(b))
+	}
+
+	return stats
+}
+
+// ParseMntrResult parses `zk mntr` output of tab separated key value lines.
+func ParseMntrResult(s string) map[string]string {
+	r := make(map[string]string)
+	for _, l := range strings.Split(s, "\n") {
+		fields := strings.Fields(l)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "zk_") {
+			// e,g. This ZooKeeper instance is not currently serving requests
+			continue
+		}
+
+		r[fields[0]] = strings.Join(fields[1:], " ")
+	}
+	return r
+}
+
+// ParseConsResult parses `zk cons` output, each line is a connection like:
+// /10.1.1.1:54276[1](queued=0,recved=1,sent=1,sid=0x1,lop=PING,est=1,to=30000,...)
+func ParseConsResult(s string) []ZkConnection {
+	var r []ZkConnection
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.TrimSpace(l)
+		addrEnd, propsStart := strings.IndexByte(l, '['), strings.IndexByte(l, '(')
+		if !strings.HasPrefix(l, "/") || addrEnd == -1 || propsStart == -1 || !strings.HasSuffix(l, ")") {
+			continue
+		}
+
+		c := ZkConnection{Addr: l[1:addrEnd]}
+		for _, prop := range strings.Split(l[propsStart+1:len(l)-1], ",") {
+			kv := strings.SplitN(prop, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+
+			n, _ := strconv.ParseInt(kv[1], 10, 64)
+			switch kv[0] {
+			case "queued":
+				c.Queued = n
+			case "recved":
+				c.Received = n
+			case "sent":
+				c.Sent = n
+			case "sid":
+				c.SessionId = kv[1]
+			case "lop":
+				c.LastOp = kv[1]
+			case "to":
+				c.Timeout = n
+			case "avglat":
+				c.AvgLatency = n
+			case "maxlat":
+				c.MaxLatency = n
+			}
+		}
+		r = append(r, c)
+	}
+	return r
+}
+
+type zkServerStatsList []ZkServerStats
+
+func (l zkServerStatsList) Len() int           { return len(l) }
+func (l zkServerStatsList) Less(i, j int) bool { return l[i].Server < l[j].Server }
+func (l zkServerStatsList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
@@ -0,0 +1,415 @@
+package zk
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/funkygao/log4go"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// Kinds of ClusterEvent.
+const (
+	EventBroker     = "broker"
+	EventController = "controller"
+	EventTopic      = "topic"
+	EventLeader     = "leader"
+	EventIsr        = "isr"
+)
+
+// ClusterEvent is a change of the kafka cluster state registered in zk, e,g. broker down,
+// partition leader moved or topic created.
+type ClusterEvent struct {
+	Time    time.Time
+	Cluster string
+	Kind    string
+	Message string
+}
+
+func (e ClusterEvent) String() string {
+	return fmt.Sprintf("%s %s %s: %s", e.Time.Format("2006-01-02 15:04:05"), e.Cluster, e.Kind, e.Message)
+}
+
+// RecentEvents reconstructs the events since the given time from znode ctime/mtime.
+// As zk keeps no history, only the latest change of each znode is known, and brokers
+// gone are not known at all.
+func (this *ZkCluster) RecentEvents(since time.Time) []ClusterEvent {
+	var r []ClusterEvent
+	add := func(t time.Time, kind, msg string) {
+		if !t.Before(since) {
+			r = append(r, ClusterEvent{Time: t, Cluster: this.name, Kind: kind, Message: msg})
+		}
+	}
+
+	for id, data := range this.zone.ChildrenWithData(this.brokerIdsRoot()) {
+		b := newBrokerZnode(id)
+		b.from(data.data)
+		add(data.Ctime(), EventBroker, fmt.Sprintf("broker %s up %s", id, b.Addr()))
+	}
+
+	if data, stat, err := this.zone.Conn().Get(this.controllerPath()); err == nil {
+		add(ZkTimestamp(stat.Ctime).Time(), EventController, fmt.Sprintf("controller elected %d", controllerIdOf(data)))
+	}
+
+	for topic, ctime := range this.TopicsCtime() {
+		add(ctime, EventTopic, fmt.Sprintf("topic %s created", topic))
+
+		for partitionId, state := range this.PartitionStates(topic) {
+			add(state.IsrMtime, EventIsr, fmt.Sprintf("state of %s changed: leader %d isr %s",
+				topicPartitionKey(topic, partitionId), state.Leader, intsString(state.Isr)))
+		}
+	}
+
+	sort.Sort(ClusterEventsByTime(r))
+	return r
+}
+
+// ClusterEventsByTime sorts events in time order.
+type ClusterEventsByTime []ClusterEvent
+
+func (s ClusterEventsByTime) Len() int           { return len(s) }
+func (s ClusterEventsByTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s ClusterEventsByTime) Less(i, j int) bool { return s[i].Time.Before(s[j].Time) }
+
+// WatchEvents streams the changes of brokers, controller, topics and partition leader/isr
+// by zk watches until stopper is closed. The current state is the baseline, no event emitted for it.
+//
+// Each partition state is watched, so a cluster of N partitions has N+3 watches.
+func (this *ZkCluster) WatchEvents(stopper <-chan struct{}) <-chan ClusterEvent {
+	w := &clusterWatcher{
+		c:          this,
+		events:     make(chan ClusterEvent, 100),
+		fired:      make(chan watchTarget, 100),
+		stopper:    stopper,
+		brokers:    make(map[string]string),
+		controller: -1,
+		topics:     make(map[string]int),
+		partitions: make(map[string]map[int32]bool),
+		states:     make(map[string]partitionStateZnode),
+	}
+	go w.run()
+	return w.events
+}
+
+// watchTarget is a watched znode, gen is the generation of the topic so that watches of a
+// deleted topic stop re-arming even if the topic is created again.
+type watchTarget struct {
+	kind      string
+	topic     string
+	partition int32
+	gen       int
+}
+
+type clusterWatcher struct {
+	c       *ZkCluster
+	events  chan ClusterEvent
+	fired   chan watchTarget
+	stopper <-chan struct{}
+	gen     int
+	initial bool // loading the baseline
+
+	brokers    map[string]string // id:addr
+	controller int               // -1 if none
+	topics     map[string]int    // topic:gen
+	partitions map[string]map[int32]bool
+	states     map[string]partitionStateZnode // topic-partition:state
+}
+
+func (this *clusterWatcher) run() {
+	defer close(this.events)
+
+	this.initial = true
+	this.arm(watchTarget{kind: EventBroker})
+	this.arm(watchTarget{kind: EventController})
+	this.arm(watchTarget{kind: EventTopic})
+	this.initial = false
+
+	for {
+		select {
+		case <-this.stopper:
+			return
+
+		case t := <-this.fired:
+			this.arm(t)
+		}
+	}
+}
+
+// arm reads the znode of the target with a watch set, emits the changes since last read
+// and waits for the watch to fire in background.
+func (this *clusterWatcher) arm(t watchTarget) {
+	var (
+		ch  <-chan zk.Event
+		err error
+	)
+	switch t.kind {
+	case EventBroker:
+		ch, err = this.armBrokers()
+
+	case EventController:
+		ch, err = this.armController()
+
+	case EventTopic:
+		ch, err = this.armTopics()
+
+	case EventLeader:
+		if gen, present := this.topics[t.topic]; !present || gen != t.gen {
+			return
+		}
+		ch, err = this.armPartitions(t)
+
+	case EventIsr:
+		if gen, present := this.topics[t.topic]; !present || gen != t.gen {
+			return
+		}
+		ch, err = this.armState(t)
+	}
+
+	if err != nil {
+		log.Error("cluster[%s] watch %+v: %v", this.c.name, t, err)
+
+		// retry later, e,g. zk connection lost
+		go func() {
+			select {
+			case <-this.stopper:
+			case <-time.After(time.Second * 5):
+				this.refire(t)
+			}
+		}()
+		return
+	}
+
+	go func() {
+		select {
+		case <-this.stopper:
+		case <-ch:
+			this.refire(t)
+		}
+	}()
+}
+
+func (this *clusterWatcher) refire(t watchTarget) {
+	select {
+	case <-this.stopper:
+	case this.fired <- t:
+	}
+}
+
+func (this *clusterWatcher) emit(kind, format string, args ...interface{}) {
+	if this.initial {
+		return
+	}
+
+	evt := ClusterEvent{Time: time.Now(), Cluster: this.c.name, Kind: kind, Message: fmt.Sprintf(format, args...)}
+	select {
+	case <-this.stopper:
+	case this.events <- evt:
+	}
+}
+
+func (this *clusterWatcher) armBrokers() (<-chan zk.Event, error) {
+	ids, _, ch, err := this.c.zone.Conn().ChildrenW(this.c.brokerIdsRoot())
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]string, len(ids))
+	for _, id := range ids {
+		if addr, present := this.brokers[id]; present {
+			current[id] = addr
+			continue
+		}
+
+		b := newBrokerZnode(id)
+		if data, _, err := this.c.zone.Conn().Get(this.c.brokerIdsRoot() + "/" + id); err == nil {
+			b.from(data)
+		}
+		current[id] = b.Addr()
+		this.emit(EventBroker, "broker %s up %s", id, b.Addr())
+	}
+	for id, addr := range this.brokers {
+		if _, present := current[id]; !present {
+			this.emit(EventBroker, "broker %s down %s", id, addr)
+		}
+	}
+
+	this.brokers = current
+	return ch, nil
+}
+
+func (this *clusterWatcher) armController() (<-chan zk.Event, error) {
+	path := this.c.controllerPath()
+	data, _, ch, err := this.c.zone.Conn().GetW(path)
+	id := -1
+	switch err {
+	case nil:
+		id = controllerIdOf(data)
+
+	case zk.ErrNoNode:
+		// watch its creation
+		if _, _, ch, err = this.c.zone.Conn().ExistsW(path); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, err
+	}
+
+	if msg := controllerChange(this.controller, id); msg != "" {
+		this.emit(EventController, "%s", msg)
+	}
+	this.controller = id
+	return ch, nil
+}
+
+func (this *clusterWatcher) armTopics() (<-chan zk.Event, error) {
+	topics, _, ch, err := this.c.zone.Conn().ChildrenW(this.c.topicsRoot())
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		current[topic] = true
+		if _, present := this.topics[topic]; present {
+			continue
+		}
+
+		this.gen++
+		this.topics[topic] = this.gen
+		this.partitions[topic] = make(map[int32]bool)
+		this.emit(EventTopic, "topic %s created", topic)
+		this.arm(watchTarget{kind: EventLeader, topic: topic, gen: this.gen})
+	}
+	for topic := range this.topics {
+		if current[topic] {
+			continue
+		}
+
+		delete(this.topics, topic)
+		for partitionId := range this.partitions[topic] {
+			delete(this.states, topicPartitionKey(topic, partitionId))
+		}
+		delete(this.partitions, topic)
+		this.emit(EventTopic, "topic %s deleted", topic)
+	}
+
+	return ch, nil
+}
+
+// armPartitions watches the partitions of a topic so that the state of new partitions is watched.
+func (this *clusterWatcher) armPartitions(t watchTarget) (<-chan zk.Event, error) {
+	path := this.c.partitionsPath(t.topic)
+	partitions, _, ch, err := this.c.zone.Conn().ChildrenW(path)
+	if err == zk.ErrNoNode {
+		// topic just created, partitions not assigned yet
+		_, _, ch, err = this.c.zone.Conn().ExistsW(path)
+		return ch, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, p := range partitions {
+		partitionId, err := strconv.Atoi(p)
+		if err != nil || this.partitions[t.topic][int32(partitionId)] {
+			continue
+		}
+
+		this.partitions[t.topic][int32(partitionId)] = true
+		this.arm(watchTarget{kind: EventIsr, topic: t.topic, partition: int32(partitionId), gen: t.gen})
+	}
+
+	return ch, nil
+}
+
+func (this *clusterWatcher) armState(t watchTarget) (<-chan zk.Event, error) {
+	path := this.c.partitionStatePath(t.topic, t.partition)
+	data, _, ch, err := this.c.zone.Conn().GetW(path)
+	if err == zk.ErrNoNode {
+		_, _, ch, err = this.c.zone.Conn().ExistsW(path)
+		return ch, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	var state partitionStateZnode
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	sort.Ints(state.Isr)
+
+	key := topicPartitionKey(t.topic, t.partition)
+	if old, present := this.states[key]; present {
+		for _, e := range partitionStateChanges(key, old, state) {
+			this.emit(e.Kind, "%s", e.Message)
+		}
+	}
+	this.states[key] = state
+	return ch, nil
+}
+
+func topicPartitionKey(topic string, partitionId int32) string {
+	return fmt.Sprintf("%s-%d", topic, partitionId)
+}
+
+func controllerIdOf(data []byte) int {
+	var c struct {
+		BrokerId int `json:"brokerid"`
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return -1
+	}
+	return c.BrokerId
+}
+
+// controllerChange describes the controller change, empty if unchanged.
+func controllerChange(from, to int) string {
+	switch {
+	case from == to:
+		return ""
+	case to == -1:
+		return fmt.Sprintf("controller %d gone", from)
+	case from == -1:
+		return fmt.Sprintf("controller elected %d", to)
+	default:
+		return fmt.Sprintf("controller moved %d→%d", from, to)
+	}
+}
+
+// partitionStateChanges describes the leader and isr changes of a partition, isr is sorted.
+func partitionStateChanges(key string, from, to partitionStateZnode) []ClusterEvent {
+	var r []ClusterEvent
+	if from.Leader != to.Leader {
+		msg := fmt.Sprintf("leader of %s moved %d→%d", key, from.Leader, to.Leader)
+		if to.Leader == -1 {
+			msg = fmt.Sprintf("leader of %s %d gone, partition offline", key, from.Leader)
+		}
+		r = append(r, ClusterEvent{Kind: EventLeader, Message: msg})
+	}
+
+	if !intsEqual(from.Isr, to.Isr) {
+		verb := "changed"
+		switch {
+		case len(to.Isr) < len(from.Isr):
+			verb = "shrunk"
+		case len(to.Isr) > len(from.Isr):
+			verb = "expanded"
+		}
+		r = append(r, ClusterEvent{Kind: EventIsr, Message: fmt.Sprintf("isr of %s %s %s→%s",
+			key, verb, intsString(from.Isr), intsString(to.Isr))})
+	}
+
+	return r
+}
+
+func intsString(a []int) string {
+	s := make([]string, 0, len(a))
+	for _, i := range a {
+		s = append(s, strconv.Itoa(i))
+	}
+	return "[" + strings.Join(s, ",") + "]"
+}
@@ -0,0 +1,35 @@
+package zk
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestControllerChange(t *testing.T) {
+	assert.Equal(t, "", controllerChange(1, 1))
+	assert.Equal(t, "controller elected 3", controllerChange(-1, 3))
+	assert.Equal(t, "controller 3 gone", controllerChange(3, -1))
+	assert.Equal(t, "controller moved 1→3", controllerChange(1, 3))
+	assert.Equal(t, 2, controllerIdOf([]byte(`{"version":1,"brokerid":2,"timestamp":"1466130417538"}`)))
+	assert.Equal(t, -1, controllerIdOf([]byte("bad")))
+}
+
+func TestPartitionStateChanges(t *testing.T) {
+	from := partitionStateZnode{Leader: 2, Isr: []int{2, 5, 7}}
+	assert.Equal(t, 0, len(partitionStateChanges("trade-3", from, from)))
+
+	evts := partitionStateChanges("trade-3", from, partitionStateZnode{Leader: 7, Isr: []int{5, 7}})
+	assert.Equal(t, 2, len(evts))
+	assert.Equal(t, EventLeader, evts[0].Kind)
+	assert.Equal(t, "leader of trade-3 moved 2→7", evts[0].Message)
+	assert.Equal(t, EventIsr, evts[1].Kind)
+	assert.Equal(t, "isr of trade-3 shrunk [2,5,7]→[5,7]", evts[1].Message)
+
+	evts = partitionStateChanges("trade-3", from, partitionStateZnode{Leader: 2, Isr: []int{1, 2, 5, 7}})
+	assert.Equal(t, 1, len(evts))
+	assert.Equal(t, "isr of trade-3 expanded [2,5,7]→[1,2,5,7]", evts[0].Message)
+
+	evts = partitionStateChanges("trade-3", from, partitionStateZnode{Leader: -1, Isr: []int{}})
+	assert.Equal(t, "leader of trade-3 2 gone, partition offline", evts[0].Message)
+}
@@ -0,0 +1,270 @@
+package zk
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ZoneMeta is a structured snapshot of kafka metadata of all clusters in a zone.
+type ZoneMeta struct {
+	Zone     string                  `json:"zone"`
+	Ctime    time.Time               `json:"ctime"`
+	Clusters map[string]*ClusterMeta `json:"clusters"`
+}
+
+type ClusterMeta struct {
+	Path    string                `json:"path"`
+	Brokers map[string]string     `json:"brokers"` // {brokerId: host:port}
+	Topics  map[string]*TopicMeta `json:"topics"`
+}
+
+type TopicMeta struct {
+	Config     string                    `json:"config,omitempty"` // non-default config only
+	Partitions map[string]*PartitionMeta `json:"partitions"`
+}
+
+type PartitionMeta struct {
+	Replicas []int `json:"replicas"`
+	Leader   int   `json:"leader"`
+	Isr      []int `json:"isr"`
+}
+
+type partitionStateZnode struct {
+	Leader int   `json:"leader"`
+	Isr    []int `json:"isr"`
+}
+
+// ExportMeta returns a full snapshot of clusters/brokers/topics/partitions/replicas
+// of the zone.
+func (this *ZkZone) ExportMeta() (*ZoneMeta, error) {
+	zm := &ZoneMeta{
+		Zone:     this.Name(),
+		Ctime:    time.Now(),
+		Clusters: make(map[string]*ClusterMeta),
+	}
+
+	var err error
+	this.ForSortedClusters(func(zkcluster *ZkCluster) {
+		if err != nil {
+			return
+		}
+
+		var cm *ClusterMeta
+		if cm, err = zkcluster.exportMeta(); err == nil {
+			zm.Clusters[zkcluster.Name()] = cm
+		}
+	})
+
+	return zm, err
+}
+
+func (this *ZkCluster) exportMeta() (*ClusterMeta, error) {
+	cm := &ClusterMeta{
+		Path:    this.path,
+		Brokers: make(map[string]string),
+		Topics:  make(map[string]*TopicMeta),
+	}
+
+	for id, broker := range this.Brokers() {
+		cm.Brokers[id] = broker.Addr()
+	}
+
+	configs := this.ConfiggedTopics()
+	for topic, data := range this.zone.ChildrenWithData(this.topicsRoot()) {
+		var tz TopicZnode
+		if err := json.Unmarshal(data.data, &tz); err != nil {
+			return nil, fmt.Errorf("cluster[%s] topic[%s]: %v", this.name, topic, err)
+		}
+
+		tm := &TopicMeta{
+			Config:     configs[topic].Config,
+			Partitions: make(map[string]*PartitionMeta, len(tz.Partitions)),
+		}
+		states := this.PartitionStates(topic)
+		for partitionId, replicas := range tz.Partitions {
+			pm := &PartitionMeta{Replicas: replicas, Leader: -1}
+			id, _ := strconv.Atoi(partitionId)
+			if state, present := states[int32(id)]; present {
+				pm.Leader = state.Leader
+				pm.Isr = state.Isr
+			}
+
+			tm.Partitions[partitionId] = pm
+		}
+
+		cm.Topics[topic] = tm
+	}
+
+	return cm, nil
+}
+
+const (
+	MetaAdded   = "+"
+	MetaRemoved = "-"
+	MetaChanged = "~"
+)
+
+// MetaChange is a single difference between 2 zone meta snapshots.
+type MetaChange struct {
+	Op        string `json:"op"`   // MetaAdded | MetaRemoved | MetaChanged
+	Item      string `json:"item"` // cluster | broker | topic | config | partition | replicas | leader | isr
+	Cluster   string `json:"cluster"`
+	Topic     string `json:"topic,omitempty"`
+	Partition string `json:"partition,omitempty"`
+	Old       string `json:"old,omitempty"`
+	New       string `json:"new,omitempty"`
+}
+
+func (this MetaChange) String() string {
+	s := fmt.Sprintf("%s %-9s %s", this.Op, this.Item, this.Cluster)
+	if this.Topic != "" {
+		s += " " + this.Topic
+	}
+	if this.Partition != "" {
+		s += "#" + this.Partition
+	}
+	if this.Op == MetaChanged {
+		s += fmt.Sprintf(" %s -> %s", this.Old, this.New)
+	} else if this.New != "" {
+		s += " " + this.New
+	} else if this.Old != "" {
+		s += " " + this.Old
+	}
+	return s
+}
+
+// DiffMeta returns what changed from old to new snapshot, sorted by cluster, topic and partition.
+func DiffMeta(old, new *ZoneMeta) []MetaChange {
+	var r []MetaChange
+	for _, cluster := range sortedKeys(old.Clusters, new.Clusters) {
+		oc, nc := old.Clusters[cluster], new.Clusters[cluster]
+		switch {
+		case oc == nil:
+			r = append(r, MetaChange{Op: MetaAdded, Item: "cluster", Cluster: cluster, New: nc.Path})
+			continue
+
+		case nc == nil:
+			r = append(r, MetaChange{Op: MetaRemoved, Item: "cluster", Cluster: cluster, Old: oc.Path})
+			continue
+		}
+
+		r = append(r, diffCluster(cluster, oc, nc)...)
+	}
+
+	return r
+}
+
+func diffCluster(cluster string, oc, nc *ClusterMeta) []MetaChange {
+	var r []MetaChange
+	for _, id := range sortedKeys(oc.Brokers, nc.Brokers) {
+		oaddr, opresent := oc.Brokers[id]
+		naddr, npresent := nc.Brokers[id]
+		switch {
+		case !opresent:
+			r = append(r, MetaChange{Op: MetaAdded, Item: "broker", Cluster: cluster, New: id + "/" + naddr})
+		case !npresent:
+			r = append(r, MetaChange{Op: MetaRemoved, Item: "broker", Cluster: cluster, Old: id + "/" + oaddr})
+		case oaddr != naddr:
+			r = append(r, MetaChange{Op: MetaChanged, Item: "broker", Cluster: cluster, Old: id + "/" + oaddr, New: id + "/" + naddr})
+		}
+	}
+
+	for _, topic := range sortedKeys(oc.Topics, nc.Topics) {
+		ot, nt := oc.Topics[topic], nc.Topics[topic]
+		switch {
+		case ot == nil:
+			r = append(r, MetaChange{Op: MetaAdded, Item: "topic", Cluster: cluster, Topic: topic,
+				New: fmt.Sprintf("partitions:%d", len(nt.Partitions))})
+			continue
+
+		case nt == nil:
+			r = append(r, MetaChange{Op: MetaRemoved, Item: "topic", Cluster: cluster, Topic: topic,
+				Old: fmt.Sprintf("partitions:%d", len(ot.Partitions))})
+			continue
+		}
+
+		if ot.Config != nt.Config {
+			r = append(r, MetaChange{Op: MetaChanged, Item: "config", Cluster: cluster, Topic: topic,
+				Old: ot.Config, New: nt.Config})
+		}
+
+		for _, partition := range sortedKeys(ot.Partitions, nt.Partitions) {
+			op, np := ot.Partitions[partition], nt.Partitions[partition]
+			c := MetaChange{Cluster: cluster, Topic: topic, Partition: partition}
+			switch {
+			case op == nil:
+				c.Op, c.Item, c.New = MetaAdded, "partition", fmt.Sprint(np.Replicas)
+				r = append(r, c)
+				continue
+
+			case np == nil:
+				c.Op, c.Item, c.Old = MetaRemoved, "partition", fmt.Sprint(op.Replicas)
+				r = append(r, c)
+				continue
+			}
+
+			c.Op = MetaChanged
+			if !intsEqual(op.Replicas, np.Replicas) {
+				c.Item, c.Old, c.New = "replicas", fmt.Sprint(op.Replicas), fmt.Sprint(np.Replicas)
+				r = append(r, c)
+			}
+			if op.Leader != np.Leader {
+				c.Item, c.Old, c.New = "leader", strconv.Itoa(op.Leader), strconv.Itoa(np.Leader)
+				r = append(r, c)
+			}
+			if !intsEqual(op.Isr, np.Isr) {
+				c.Item, c.Old, c.New = "isr", fmt.Sprint(op.Isr), fmt.Sprint(np.Isr)
+				r = append(r, c)
+			}
+		}
+	}
+
+	return r
+}
+
+// sortedKeys returns the sorted union of keys of 2 maps with string keys.
+func sortedKeys(a, b interface{}) []string {
+	keys := make(map[string]struct{})
+	for _, m := range []interface{}{a, b} {
+		switch m := m.(type) {
+		case map[string]*ClusterMeta:
+			for k := range m {
+				keys[k] = struct{}{}
+			}
+		case map[string]*TopicMeta:
+			for k := range m {
+				keys[k] = struct{}{}
+			}
+		case map[string]*PartitionMeta:
+			for k := range m {
+				keys[k] = struct{}{}
+			}
+		case map[string]string:
+			for k := range m {
+				keys[k] = struct{}{}
+			}
+		}
+	}
+
+	r := make([]string, 0, len(keys))
+	for k := range keys {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func intsEqual(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package zk
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestDiffMeta(t *testing.T) {
+	old := &ZoneMeta{Clusters: map[string]*ClusterMeta{
+		"c1": {
+			Brokers: map[string]string{"1": "h1:9092", "2": "h2:9092"},
+			Topics: map[string]*TopicMeta{
+				"t1": {Partitions: map[string]*PartitionMeta{
+					"0": {Replicas: []int{1, 2}, Leader: 1, Isr: []int{1, 2}},
+				}},
+				"t2": {Partitions: map[string]*PartitionMeta{}},
+			},
+		},
+		"c2": {Path: "/c2"},
+	}}
+	new := &ZoneMeta{Clusters: map[string]*ClusterMeta{
+		"c1": {
+			Brokers: map[string]string{"1": "h1:9092", "3": "h3:9092"},
+			Topics: map[string]*TopicMeta{
+				"t1": {Config: "retention.ms=1", Partitions: map[string]*PartitionMeta{
+					"0": {Replicas: []int{1, 3}, Leader: 3, Isr: []int{1, 3}},
+					"1": {Replicas: []int{3, 1}, Leader: 3, Isr: []int{1, 3}},
+				}},
+				"t3": {Partitions: map[string]*PartitionMeta{}},
+			},
+		},
+	}}
+
+	assert.Equal(t, 0, len(DiffMeta(old, old)))
+
+	changes := DiffMeta(old, new)
+	var r []string
+	for _, c := range changes {
+		r = append(r, c.Op+c.Item)
+	}
+	assert.Equal(t, []string{"-broker", "+broker", "~config", "~replicas", "~leader", "~isr",
+		"+partition", "-topic", "+topic", "-cluster"}, r)
+	assert.Equal(t, "c1", changes[3].Cluster)
+	assert.Equal(t, "t1", changes[3].Topic)
+	assert.Equal(t, "0", changes[3].Partition)
+	assert.Equal(t, "[1 2]", changes[3].Old)
+	assert.Equal(t, "[1 3]", changes[3].New)
+}
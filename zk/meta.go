@@ -51,6 +51,9 @@ type ConsumerMeta struct {
 type WebhookMeta struct {
 	Cluster   string   `json:"cluster"`
 	Endpoints []string `json:"endpoints"`
+
+	// failed pushes hop through the retry topics of this chain before the dead topic, e,g. 5s,1m,10m
+	RetryChain string `json:"retry_chain,omitempty"`
 }
 
 func (this *WebhookMeta) From(b []byte) error {
@@ -62,6 +65,67 @@ func (this *WebhookMeta) Bytes() []byte {
 	return b
 }
 
+// DisabledTopicMeta is a topic pending deletion whose Pub is revoked.
+type DisabledTopicMeta struct {
+	Cluster  string    `json:"cluster"`
+	Topic    string    `json:"topic"`
+	Since    time.Time `json:"since"`
+	Deadline time.Time `json:"deadline"` // end of the grace period
+	By       string    `json:"by"`
+}
+
+func (this *DisabledTopicMeta) From(b []byte) error {
+	return json.Unmarshal(b, this)
+}
+
+func (this *DisabledTopicMeta) Bytes() []byte {
+	b, _ := json.Marshal(this)
+	return b
+}
+
+// SpoolMeta is a consumer group that kateway consumes on behalf of a downstream,
+// spooling messages to local disk before forwarding them to the endpoints.
+type SpoolMeta struct {
+	Cluster   string    `json:"cluster"`
+	Topic     string    `json:"topic"` // raw kafka topic
+	Group     string    `json:"group"` // appid.group
+	Endpoints []string  `json:"endpoints"`
+	Ctime     time.Time `json:"ctime"`
+	By        string    `json:"by"`
+
+	// each kateway replays its spooled messages since ReplaySince once ReplayAt changes
+	ReplayAt    time.Time `json:"replay_at,omitempty"`
+	ReplaySince time.Time `json:"replay_since,omitempty"`
+}
+
+func (this *SpoolMeta) From(b []byte) error {
+	return json.Unmarshal(b, this)
+}
+
+func (this *SpoolMeta) Bytes() []byte {
+	b, _ := json.Marshal(this)
+	return b
+}
+
+// RetryChainMeta is the retry chain of an explicit ack consumer group, see sla.RetryChain.
+type RetryChainMeta struct {
+	Cluster string    `json:"cluster"`
+	Topic   string    `json:"topic"` // raw kafka topic
+	Group   string    `json:"group"` // appid.group
+	Chain   string    `json:"chain"` // e,g. 5s,1m,10m
+	Ctime   time.Time `json:"ctime"`
+	By      string    `json:"by"`
+}
+
+func (this *RetryChainMeta) From(b []byte) error {
+	return json.Unmarshal(b, this)
+}
+
+func (this *RetryChainMeta) Bytes() []byte {
+	b, _ := json.Marshal(this)
+	return b
+}
+
 type ControllerMeta struct {
 	Broker *BrokerZnode
 	Mtime  ZkTimestamp
@@ -151,6 +215,7 @@ type BrokerZnode struct {
 	Host      string   `json:"host"`
 	Port      int      `json:"port"`
 	Version   int      `json:"version"`
+	Rack      string   `json:"rack"` // broker.rack since kafka 0.10
 }
 
 func newBrokerZnode(id string) *BrokerZnode {
@@ -50,3 +50,11 @@ func TestWebhook(t *testing.T) {
 	hook.Endpoints = []string{"http://localhost:9876"}
 	t.Logf("%s", string(hook.Bytes()))
 }
+
+func TestSpoolMeta(t *testing.T) {
+	meta := SpoolMeta{Cluster: "trade", Topic: "app1.foo.v1", Group: "app2.g1", Endpoints: []string{"http://localhost:9876"}}
+	var m SpoolMeta
+	assert.Equal(t, nil, m.From(meta.Bytes()))
+	assert.Equal(t, "app2.g1", m.Group)
+	assert.Equal(t, true, m.ReplayAt.IsZero())
+}
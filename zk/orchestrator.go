@@ -29,7 +29,7 @@ func (this *Orchestrator) RegisterActor(id string, val []byte) error {
 
 func (this *Orchestrator) ResignActor(id string) error {
 	path := fmt.Sprintf("%s/%s", PubsubActors, id)
-	return this.conn.Delete(path, -1)
+	return this.deleteZnode(path, -1)
 }
 
 func (this *Orchestrator) WatchActors() (ActorList, <-chan zk.Event, error) {
@@ -93,7 +93,7 @@ func (this *Orchestrator) ReleaseResource(actorId, root, resource string) error
 		return ErrNotClaimed
 	}
 
-	return this.conn.Delete(path, -1)
+	return this.deleteZnode(path, -1)
 }
 
 type ActorList []string
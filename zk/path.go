@@ -8,9 +8,13 @@ const (
 	clusterRoot     = "/_kafka_clusters"
 	clusterInfoRoot = "/_kafa_clusters_info"
 
-	KatewayIdsRoot     = "/_kateway/ids"
-	katewayMetricsRoot = "/_kateway/metrics"
-	KatewayMysqlPath   = "/_kateway/mysql"
+	KatewayIdsRoot      = "/_kateway/ids"
+	katewayMetricsRoot  = "/_kateway/metrics"
+	katewaySessionRoot  = "/_kateway/sub_sessions"
+	katewayDisabledRoot = "/_kateway/disabled_topics"
+	katewaySpoolRoot    = "/_kateway/sub_spools"
+	katewayRetryRoot    = "/_kateway/retry_chains"
+	KatewayMysqlPath    = "/_kateway/mysql"
 
 	PubsubJobConfig      = "/_kateway/orchestrator/jobconfig"
 	PubsubJobQueues      = "/_kateway/orchestrator/jobs"
@@ -33,6 +37,8 @@ const (
 	TopicConfigPath         = "/config/topics"
 	EntityConfigPath        = "/config"
 	DeleteTopicsPath        = "/admin/delete_topics"
+	ReassignPartitionsPath  = "/admin/reassign_partitions"
+	PreferredReplicaPath    = "/admin/preferred_replica_election"
 
 	RedisMonPath = "/redis"
 )
@@ -41,6 +47,22 @@ func katewayMetricsRootByKey(id, key string) string {
 	return fmt.Sprintf("%s/%s/%s", katewayMetricsRoot, id, key)
 }
 
+func katewaySubSessionPath(id string) string {
+	return fmt.Sprintf("%s/%s", katewaySessionRoot, id)
+}
+
+func katewayDisabledTopicPath(cluster, topic string) string {
+	return fmt.Sprintf("%s/%s/%s", katewayDisabledRoot, cluster, topic)
+}
+
+func katewaySpoolPath(cluster, topic, group string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", katewaySpoolRoot, cluster, topic, group)
+}
+
+func katewayRetryChainPath(cluster, topic, group string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", katewayRetryRoot, cluster, topic, group)
+}
+
 func ClusterPath(cluster string) string {
 	return fmt.Sprintf("%s/%s", clusterRoot, cluster)
 }
@@ -49,6 +71,14 @@ func (this *ZkCluster) controllerPath() string {
 	return this.path + ControllerPath
 }
 
+func (this *ZkCluster) reassignPartitionsPath() string {
+	return this.path + ReassignPartitionsPath
+}
+
+func (this *ZkCluster) preferredReplicaPath() string {
+	return this.path + PreferredReplicaPath
+}
+
 func (this *ZkCluster) TopicConfigRoot() string {
 	return fmt.Sprintf("%s%s", this.path, TopicConfigPath)
 }
@@ -18,6 +18,8 @@ func TestZkClusterPath(t *testing.T) {
 	assert.Equal(t, "/test/brokers/ids", c.brokerIdsRoot())
 	assert.Equal(t, "/test/controller", c.controllerPath())
 	assert.Equal(t, "/test/controller_epoch", c.controllerEpochPath())
+	assert.Equal(t, "/test/admin/reassign_partitions", c.reassignPartitionsPath())
+	assert.Equal(t, "/test/admin/preferred_replica_election", c.preferredReplicaPath())
 	assert.Equal(t, "/test/brokers/topics/t1/partitions",
 		c.partitionsPath("t1"))
 	assert.Equal(t, "/test/brokers/topics/t1/partitions/2/state",
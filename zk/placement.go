@@ -0,0 +1,260 @@
+package zk
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PlanReplicas returns the new replicas of partitions whose replication factor is not n.
+// current is the replicas of each partition with the preferred leader first, racks is
+// the rack of each candidate broker as returned by ZkCluster.BrokerRacks.
+//
+// Existing replicas are kept as is when raising and the preferred leader is always kept,
+// so that only the delta data is copied. Replicas are placed across as many racks as
+// possible, then on the brokers with fewest replicas of the topic.
+func PlanReplicas(current map[int32][]int32, racks map[int32]string, n int) (map[int32][]int32, error) {
+	if n > len(racks) {
+		return nil, fmt.Errorf("replicas %d more than brokers %d", n, len(racks))
+	}
+
+	brokerIds := make([]int, 0, len(racks))
+	for id := range racks {
+		brokerIds = append(brokerIds, int(id))
+	}
+	sort.Ints(brokerIds)
+
+	rackOf := func(id int32) string {
+		if rack, present := racks[id]; present {
+			return rack
+		}
+		return fmt.Sprintf("broker%d", id) // offline broker
+	}
+
+	load := make(map[int32]int, len(racks))
+	for _, replicas := range current {
+		for _, id := range replicas {
+			load[id]++
+		}
+	}
+
+	partitionIds := make([]int, 0, len(current))
+	for partitionId := range current {
+		partitionIds = append(partitionIds, int(partitionId))
+	}
+	sort.Ints(partitionIds)
+
+	plan := make(map[int32][]int32)
+	for _, pid := range partitionIds {
+		partitionId := int32(pid)
+		replicas := current[partitionId]
+		if len(replicas) == n {
+			continue
+		}
+
+		usedRacks := make(map[string]int)
+		var target []int32
+		if len(replicas) > n {
+			// keep the leader, then replicas of distinct racks first
+			target = append(target, replicas[0])
+			usedRacks[rackOf(replicas[0])]++
+			for _, distinctFirst := range []bool{true, false} {
+				for _, id := range replicas[1:] {
+					if len(target) == n {
+						break
+					}
+					if int32sContain(target, id) || (distinctFirst && usedRacks[rackOf(id)] > 0) {
+						continue
+					}
+
+					target = append(target, id)
+					usedRacks[rackOf(id)]++
+				}
+			}
+
+			for _, id := range replicas {
+				if !int32sContain(target, id) {
+					load[id]--
+				}
+			}
+		} else {
+			target = append(target, replicas...)
+			for _, id := range target {
+				usedRacks[rackOf(id)]++
+			}
+
+			for len(target) < n {
+				best := int32(-1)
+				for _, bid := range brokerIds {
+					id := int32(bid)
+					if int32sContain(target, id) {
+						continue
+					}
+
+					if best == -1 ||
+						usedRacks[racks[id]] < usedRacks[racks[best]] ||
+						(usedRacks[racks[id]] == usedRacks[racks[best]] && load[id] < load[best]) {
+						best = id
+					}
+				}
+
+				target = append(target, best)
+				usedRacks[racks[best]]++
+				load[best]++
+			}
+		}
+
+		plan[partitionId] = target
+	}
+
+	return plan, nil
+}
+
+// PlanSpread returns the new replicas of partitions to move so that replicas of a topic are
+// spread evenly across all the brokers of racks, e,g. after the cluster grows. current and
+// racks are the same as PlanReplicas.
+//
+// Each move relocates a single replica from the most loaded broker to the least loaded one,
+// and stops once replicas per broker differ by at most 1, so the data moved is minimal.
+// Moves that keep the rack diversity of the partition are preferred, and the moved replica
+// keeps its position so that a moved preferred leader is still the preferred leader.
+func PlanSpread(current map[int32][]int32, racks map[int32]string) map[int32][]int32 {
+	brokerIds := make([]int, 0, len(racks))
+	load := make(map[int32]int, len(racks))
+	for id := range racks {
+		brokerIds = append(brokerIds, int(id))
+		load[id] = 0
+	}
+	sort.Ints(brokerIds)
+
+	partitionIds := make([]int, 0, len(current))
+	for partitionId := range current {
+		partitionIds = append(partitionIds, int(partitionId))
+	}
+	sort.Ints(partitionIds)
+
+	assignment := make(map[int32][]int32, len(current))
+	for partitionId, replicas := range current {
+		assignment[partitionId] = append([]int32(nil), replicas...)
+		for _, id := range replicas {
+			if _, present := load[id]; present {
+				load[id]++
+			}
+		}
+	}
+
+	// move a replica from src to dst, partitions not moved yet first so that the data copy
+	// spreads across partitions
+	move := func(src, dst int32, keepRacks bool) bool {
+		for _, untouched := range []bool{true, false} {
+			for _, pid := range partitionIds {
+				partitionId := int32(pid)
+				replicas := assignment[partitionId]
+				if untouched != int32sEqual(replicas, current[partitionId]) ||
+					!int32sContain(replicas, src) || int32sContain(replicas, dst) {
+					continue
+				}
+
+				moved := make([]int32, len(replicas))
+				for i, id := range replicas {
+					if id == src {
+						id = dst
+					}
+					moved[i] = id
+				}
+				if keepRacks && DistinctRacks(moved, racks) < DistinctRacks(replicas, racks) {
+					continue
+				}
+
+				assignment[partitionId] = moved
+				return true
+			}
+		}
+		return false
+	}
+
+	for {
+		// brokers by load desc, ties broken by id for a stable plan
+		byLoad := make([]int32, 0, len(brokerIds))
+		for _, id := range brokerIds {
+			byLoad = append(byLoad, int32(id))
+		}
+		sort.Stable(brokersByLoad{ids: byLoad, load: load})
+
+		moved := false
+		for _, keepRacks := range []bool{true, false} {
+			for i := 0; i < len(byLoad) && !moved; i++ {
+				for j := len(byLoad) - 1; j > i && !moved; j-- {
+					src, dst := byLoad[i], byLoad[j]
+					if load[src]-load[dst] <= 1 {
+						break
+					}
+
+					if move(src, dst, keepRacks) {
+						load[src]--
+						load[dst]++
+						moved = true
+					}
+				}
+			}
+			if moved {
+				break
+			}
+		}
+
+		if !moved {
+			break
+		}
+	}
+
+	plan := make(map[int32][]int32)
+	for partitionId, replicas := range assignment {
+		if !int32sEqual(replicas, current[partitionId]) {
+			plan[partitionId] = replicas
+		}
+	}
+
+	return plan
+}
+
+type brokersByLoad struct {
+	ids  []int32
+	load map[int32]int
+}
+
+func (this brokersByLoad) Len() int           { return len(this.ids) }
+func (this brokersByLoad) Swap(i, j int)      { this.ids[i], this.ids[j] = this.ids[j], this.ids[i] }
+func (this brokersByLoad) Less(i, j int) bool { return this.load[this.ids[i]] > this.load[this.ids[j]] }
+
+// DistinctRacks returns how many racks the replicas span.
+func DistinctRacks(replicas []int32, racks map[int32]string) int {
+	r := make(map[string]struct{}, len(replicas))
+	for _, id := range replicas {
+		if rack, present := racks[id]; present {
+			r[rack] = struct{}{}
+		} else {
+			r[fmt.Sprintf("broker%d", id)] = struct{}{}
+		}
+	}
+	return len(r)
+}
+
+func int32sContain(s []int32, v int32) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func int32sEqual(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package zk
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestPlanReplicasRaise(t *testing.T) {
+	racks := map[int32]string{1: "a", 2: "a", 3: "b", 4: "b"}
+	current := map[int32][]int32{
+		0: {1},
+		1: {2},
+		2: {3, 4}, // already 2 replicas
+	}
+
+	plan, err := PlanReplicas(current, racks, 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(plan))
+	assert.Equal(t, []int32{1, 3}, plan[0]) // another rack with fewest replicas
+	assert.Equal(t, []int32{2, 4}, plan[1])
+	_, present := plan[2]
+	assert.Equal(t, false, present)
+
+	_, err = PlanReplicas(current, racks, 5)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestPlanReplicasLower(t *testing.T) {
+	racks := map[int32]string{1: "a", 2: "a", 3: "b"}
+	current := map[int32][]int32{
+		0: {2, 1, 3},
+	}
+
+	plan, err := PlanReplicas(current, racks, 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []int32{2, 3}, plan[0]) // leader kept, rack diversity kept
+}
+
+func TestPlanReplicasLowerKeepsLeader(t *testing.T) {
+	racks := map[int32]string{1: "a", 2: "a", 3: "b", 4: "c"}
+	cases := []struct {
+		current  []int32
+		n        int
+		expected []int32
+	}{
+		{[]int32{1, 2, 3}, 1, []int32{1}},
+		{[]int32{1, 2, 3}, 2, []int32{1, 3}},       // leader kept though sharing rack with 2
+		{[]int32{2, 1, 3, 4}, 2, []int32{2, 3}},    // distinct rack of the leader first
+		{[]int32{2, 1, 3, 4}, 3, []int32{2, 3, 4}}, // 1 dropped for sharing rack with the leader
+		{[]int32{9, 1, 2}, 2, []int32{9, 1}},       // offline leader kept
+		{[]int32{1, 2, 9}, 2, []int32{1, 9}},       // offline broker is a rack of its own
+	}
+	for _, c := range cases {
+		plan, err := PlanReplicas(map[int32][]int32{0: c.current}, racks, c.n)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, c.expected, plan[0])
+		assert.Equal(t, c.current[0], plan[0][0])
+	}
+}
+
+func TestDistinctRacks(t *testing.T) {
+	racks := map[int32]string{1: "a", 2: "a", 3: "b"}
+	assert.Equal(t, 1, DistinctRacks([]int32{1, 2}, racks))
+	assert.Equal(t, 2, DistinctRacks([]int32{1, 3}, racks))
+	assert.Equal(t, 2, DistinctRacks([]int32{1, 9}, racks)) // offline broker
+}
+
+func TestPlanSpread(t *testing.T) {
+	// broker 3,4 newly added
+	racks := map[int32]string{1: "a", 2: "b", 3: "a", 4: "b"}
+	current := map[int32][]int32{
+		0: {1, 2},
+		1: {2, 1},
+		2: {1, 2},
+		3: {2, 1},
+	}
+
+	plan := PlanSpread(current, racks)
+	load := make(map[int32]int)
+	for partitionId, replicas := range current {
+		if moved, present := plan[partitionId]; present {
+			replicas = moved
+		}
+		assert.Equal(t, 2, DistinctRacks(replicas, racks))
+		for _, id := range replicas {
+			load[id]++
+		}
+	}
+	assert.Equal(t, map[int32]int{1: 2, 2: 2, 3: 2, 4: 2}, load)
+	assert.Equal(t, []int32{3, 2}, plan[0]) // moved preferred leader keeps position
+	assert.Equal(t, 4, len(plan))           // a single replica moved per partition
+
+	// already even
+	assert.Equal(t, 0, len(PlanSpread(map[int32][]int32{0: {1, 2}, 1: {3, 4}}, racks)))
+}
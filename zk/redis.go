@@ -17,7 +17,7 @@ func (this *ZkZone) AddRedis(host string, port int) {
 func (this *ZkZone) DelRedis(host string, port int) {
 	this.connectIfNeccessary()
 
-	this.conn.Delete(this.redisZpath(host, port), -1)
+	this.deleteZnode(this.redisZpath(host, port), -1)
 }
 
 func (this *ZkZone) AllRedis() []string {
@@ -0,0 +1,115 @@
+package zk
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/funkygao/log4go"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// sharedSession is a zookeeper session shared by all the shared ZkZone's of a zone in the
+// process, closed when the last of them is closed.
+type sharedSession struct {
+	key  string
+	conn *zk.Conn
+	refs int
+
+	mu          sync.Mutex
+	subscribers map[chan zk.Event]struct{}
+}
+
+var sessions = struct {
+	sync.Mutex
+	m map[string]*sharedSession // zone/zk addrs:session
+}{m: make(map[string]*sharedSession)}
+
+func sessionKey(conf *Config) string {
+	return conf.Name + "/" + conf.ZkAddrs
+}
+
+// acquireSession returns the shared session of the zone, dialing it if not present yet.
+func acquireSession(conf *Config, timeout time.Duration) (*sharedSession, error) {
+	key := sessionKey(conf)
+
+	sessions.Lock()
+	defer sessions.Unlock()
+
+	if s, present := sessions.m[key]; present {
+		s.refs++
+		return s, nil
+	}
+
+	log.Debug("zk connecting shared session %s", conf.ZkAddrs)
+	conn, evt, err := zk.Connect(conf.ZkServers(), timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sharedSession{
+		key:         key,
+		conn:        conn,
+		refs:        1,
+		subscribers: make(map[chan zk.Event]struct{}),
+	}
+	sessions.m[key] = s
+	go s.broadcast(evt)
+	return s, nil
+}
+
+// release closes the session if nobody else references it.
+func (s *sharedSession) release() {
+	sessions.Lock()
+	defer sessions.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return
+	}
+
+	delete(sessions.m, s.key)
+	s.conn.Close()
+}
+
+// subscribe returns a channel receiving the session events: unlike a dedicated session,
+// events of a shared session are broadcasted to each ZkZone.
+func (s *sharedSession) subscribe() chan zk.Event {
+	ch := make(chan zk.Event, 6) // the same buffer as the zk lib
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *sharedSession) unsubscribe(ch chan zk.Event) {
+	s.mu.Lock()
+	delete(s.subscribers, ch)
+	s.mu.Unlock()
+}
+
+func (s *sharedSession) broadcast(evt <-chan zk.Event) {
+	for e := range evt {
+		s.mu.Lock()
+		for ch := range s.subscribers {
+			select {
+			case ch <- e:
+			default:
+				// the same as zk lib: events are dropped if not consumed
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// SharedSessions returns the number of shared sessions and their total references of the
+// process, for diagnostics.
+func SharedSessions() (n, refs int) {
+	sessions.Lock()
+	defer sessions.Unlock()
+
+	for _, s := range sessions.m {
+		n++
+		refs += s.refs
+	}
+	return
+}
@@ -0,0 +1,43 @@
+package zk
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestSharedZkZoneSession(t *testing.T) {
+	// zk.Connect dials in background, no zk server needed
+	cf := DefaultConfig("test", "127.0.0.1:1")
+	z1 := NewSharedZkZone(cf)
+	z2 := NewSharedZkZone(cf)
+	z3 := NewSharedZkZone(DefaultConfig("test2", "127.0.0.1:1"))
+
+	// lazy connect
+	n, refs := SharedSessions()
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 0, refs)
+
+	assert.Equal(t, true, z1.Conn() == z2.Conn())
+	assert.Equal(t, false, z1.Conn() == z3.Conn())
+	n, refs = SharedSessions()
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 3, refs)
+
+	_, ok1 := z1.SessionEvents()
+	_, ok2 := z2.SessionEvents()
+	assert.Equal(t, true, ok1)
+	assert.Equal(t, true, ok2)
+
+	z1.Close()
+	z1.Close() // idempotent
+	n, refs = SharedSessions()
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, refs)
+
+	z2.Close()
+	z3.Close()
+	n, refs = SharedSessions()
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 0, refs)
+}
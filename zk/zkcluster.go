@@ -27,12 +27,13 @@ type ZkCluster struct {
 	name string // cluster name
 	path string // cluster's kafka chroot path in zk cluster
 
-	Nickname  string       `json:"nickname"`
-	Roster    []BrokerInfo `json:"roster"` // manually registered brokers
-	Replicas  int          `json:"replicas"`
-	Priority  int          `json:"priority"`
-	Public    bool         `json:"public"`
-	Retention int          `json:"retention"` // in hours
+	Nickname  string         `json:"nickname"`
+	Roster    []BrokerInfo   `json:"roster"` // manually registered brokers
+	Replicas  int            `json:"replicas"`
+	Priority  int            `json:"priority"`
+	Public    bool           `json:"public"`
+	Retention int            `json:"retention"`       // in hours
+	Racks     map[int]string `json:"racks,omitempty"` // brokerId:rack tagged manually
 }
 
 func (this *ZkCluster) Name() string {
@@ -114,7 +115,7 @@ func (this *ZkCluster) writeInfo(zc ZkCluster) error {
 		return err
 	}
 
-	_, err = this.zone.conn.Set(this.ClusterInfoPath(), data, -1)
+	err = this.zone.setZnode(this.ClusterInfoPath(), data)
 	if err == zk.ErrNoNode {
 		// create the node
 		return this.zone.createZnode(this.ClusterInfoPath(), data)
@@ -181,6 +182,48 @@ func (this *ZkCluster) SetPublic(public bool) {
 	this.zone.swallow(this.ClusterInfoPath(), this.zone.setZnode(this.ClusterInfoPath(), data))
 }
 
+// SetBrokerRack tags the rack of a broker, empty rack removes the tag.
+func (this *ZkCluster) SetBrokerRack(id int, rack string) error {
+	c := this.RegisteredInfo()
+	if c.Racks == nil {
+		c.Racks = make(map[int]string)
+	}
+	if rack == "" {
+		delete(c.Racks, id)
+	} else {
+		c.Racks[id] = rack
+	}
+
+	data, _ := json.Marshal(c)
+	return this.zone.setZnode(this.ClusterInfoPath(), data)
+}
+
+// BrokerRacks returns rack of each online broker, the rack is decided in order by:
+// rack tagged in zk, broker.rack of kafka, ip ranges of racks in ctx, and broker host
+// at last since brokers on the same host fail together.
+func (this *ZkCluster) BrokerRacks() map[int32]string {
+	tags := this.RegisteredInfo().Racks
+	r := make(map[int32]string)
+	for id, broker := range this.Brokers() {
+		brokerId, err := strconv.Atoi(id)
+		if err != nil {
+			continue
+		}
+
+		if rack, present := tags[brokerId]; present {
+			r[int32(brokerId)] = rack
+		} else if broker.Rack != "" {
+			r[int32(brokerId)] = broker.Rack
+		} else if rack, present := ctx.RackOfIp(broker.Host); present {
+			r[int32(brokerId)] = rack
+		} else {
+			r[int32(brokerId)] = broker.Host
+		}
+	}
+
+	return r
+}
+
 func (this *ZkCluster) RegisterBroker(id int, host string, port int) error {
 	c := this.RegisteredInfo()
 	for _, info := range c.Roster {
@@ -249,6 +292,20 @@ func (this *ZkCluster) OwnersOfGroupByTopic(group, topic string) map[string]stri
 	return r
 }
 
+// WatchClaimedPartitions returns the partitions of a topic claimed by the consumers of a group,
+// and a watch fired on the next claim or release, e,g. rebalance.
+func (this *ZkCluster) WatchClaimedPartitions(group, topic string) ([]string, <-chan zk.Event, error) {
+	path := this.consumerGroupOwnerOfTopicPath(group, topic)
+	partitions, _, ch, err := this.zone.Conn().ChildrenW(path)
+	if err == zk.ErrNoNode {
+		// no consumer ever claimed
+		_, _, ch, err = this.zone.Conn().ExistsW(path)
+		return nil, ch, err
+	}
+
+	return partitions, ch, err
+}
+
 // Returns {topic: {partitionId: offset}}
 func (this *ZkCluster) ConsumerOffsetsOfGroup(group string) map[string]map[string]int64 {
 	r := make(map[string]map[string]int64)
@@ -328,6 +385,73 @@ func (this *ZkCluster) ConsumerGroupsOfTopic(topic string) (map[string][]Consume
 }
 
 // returns {consumerGroup: consumerInfo}
+// AllConsumerGroups returns the committed offsets and lag of every consumer group on every
+// topic of the cluster, including offline groups, in a single pass: oldest/newest offsets of
+// each partition are fetched only once however many groups consume it.
+// Offsets of non-exist topics or partitions are skipped.
+func (this *ZkCluster) AllConsumerGroups() ([]ConsumerMeta, error) {
+	kfk, err := sarama.NewClient(this.BrokerList(), sarama.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer kfk.Close()
+
+	type partitionOffsets struct {
+		oldest, newest int64
+		err            error
+	}
+	offsets := make(map[string]partitionOffsets) // topic/partitionId:offsets
+	offsetsOf := func(topic string, pid int32) partitionOffsets {
+		key := fmt.Sprintf("%s/%d", topic, pid)
+		if o, present := offsets[key]; present {
+			return o
+		}
+
+		var o partitionOffsets
+		if o.newest, o.err = kfk.GetOffset(topic, pid, sarama.OffsetNewest); o.err == nil {
+			o.oldest, o.err = kfk.GetOffset(topic, pid, sarama.OffsetOldest)
+		}
+		offsets[key] = o
+		return o
+	}
+
+	var r []ConsumerMeta
+	consumerGroups := this.ConsumerGroups()
+	for _, group := range this.zone.children(this.consumerGroupsRoot()) {
+		consumers := consumerGroups[group]
+		for topic, committed := range this.ConsumerOffsetsOfGroup(group) {
+			consumerInstances := this.OwnersOfGroupByTopic(group, topic)
+			for partitionId, consumerOffset := range committed {
+				pid, err := strconv.Atoi(partitionId)
+				if err != nil {
+					continue
+				}
+
+				o := offsetsOf(topic, int32(pid))
+				if o.err != nil {
+					log.Warn("cluster[%s] topic[%s] partition:%s group[%s]: %v",
+						this.name, topic, partitionId, group, o.err)
+					continue
+				}
+
+				r = append(r, ConsumerMeta{
+					Group:          group,
+					Topic:          topic,
+					Online:         len(consumers) > 0,
+					PartitionId:    partitionId,
+					ConsumerOffset: consumerOffset,
+					OldestOffset:   o.oldest,
+					ProducerOffset: o.newest,
+					Lag:            o.newest - consumerOffset,
+					ConsumerZnode:  consumers[consumerInstances[partitionId]],
+				})
+			}
+		}
+	}
+
+	return r, nil
+}
+
 func (this *ZkCluster) ConsumersByGroup(groupPattern string) map[string][]ConsumerMeta {
 	r := make(map[string][]ConsumerMeta)
 	brokerList := this.BrokerList()
@@ -494,6 +618,49 @@ func (this *ZkCluster) Isr(topic string, partitionId int32) ([]int, time.Time, t
 	return r, ZkTimestamp(stat.Mtime).Time(), ZkTimestamp(stat.Ctime).Time()
 }
 
+// PartitionState is the leader and isr of a partition registered in zk.
+type PartitionState struct {
+	Leader   int
+	Isr      []int // sorted
+	IsrMtime time.Time
+	Ctime    time.Time
+}
+
+// PartitionStates returns {partitionId: state} of a topic, with the partition state znodes
+// fetched concurrently.
+func (this *ZkCluster) PartitionStates(topic string) map[int32]PartitionState {
+	partitions := this.Partitions(topic)
+	paths := make([]string, 0, len(partitions))
+	for _, partitionId := range partitions {
+		paths = append(paths, this.partitionStatePath(topic, partitionId))
+	}
+
+	znodes := this.zone.getMany(paths)
+	r := make(map[int32]PartitionState, len(znodes))
+	for _, partitionId := range partitions {
+		zdata, present := znodes[this.partitionStatePath(topic, partitionId)]
+		if !present {
+			continue
+		}
+
+		var state partitionStateZnode
+		if err := json.Unmarshal(zdata.data, &state); err != nil {
+			log.Error("cluster[%s] %s/%d state: %v", this.name, topic, partitionId, err)
+			continue
+		}
+
+		sort.Ints(state.Isr)
+		r[partitionId] = PartitionState{
+			Leader:   state.Leader,
+			Isr:      state.Isr,
+			IsrMtime: zdata.Mtime(),
+			Ctime:    zdata.Ctime(),
+		}
+	}
+
+	return r
+}
+
 func (this *ZkCluster) Broker(id int) (b *BrokerZnode) {
 	zkData, _, _ := this.zone.conn.Get(this.brokerPath(id))
 	b = newBrokerZnode(strconv.Itoa(id))
@@ -593,6 +760,47 @@ func (this *ZkCluster) AlterTopic(topic string, ts *sla.TopicSla) (output []stri
 	return
 }
 
+// ConfigTopic overrides the topic level configs and removes the deleted config keys.
+func (this *ZkCluster) ConfigTopic(topic string, configs map[string]string, deletes []string) (output []string, err error) {
+	if len(configs) == 0 && len(deletes) == 0 {
+		err = errors.New("no alter topic configs")
+		return
+	}
+
+	zkAddrs := this.ZkConnectAddr()
+	args := []string{
+		fmt.Sprintf("--zookeeper %s", zkAddrs),
+		fmt.Sprintf("--alter"),
+		fmt.Sprintf("--topic %s", topic),
+	}
+	for k, v := range configs {
+		args = append(args, fmt.Sprintf("--config %s=%s", k, v))
+	}
+	for _, k := range deletes {
+		args = append(args, fmt.Sprintf("--deleteConfig %s", k))
+	}
+
+	cmd := pipestream.New(fmt.Sprintf("%s/bin/kafka-topics.sh", ctx.KafkaHome()),
+		args...)
+	if err = cmd.Open(); err != nil {
+		return
+	}
+	defer cmd.Close()
+
+	scanner := bufio.NewScanner(cmd.Reader())
+	scanner.Split(bufio.ScanLines)
+
+	output = make([]string, 0)
+	for scanner.Scan() {
+		output = append(output, scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+
+	return
+}
+
 func (this *ZkCluster) TotalConsumerOffsets(topicPattern string) (total int64) {
 	// /$cluster/consumers/$group/offsets/$topic/0
 	root := this.consumerGroupsRoot()
@@ -616,12 +824,99 @@ func (this *ZkCluster) TotalConsumerOffsets(topicPattern string) (total int64) {
 	return
 }
 
+// ConsumerOffsetZnodes returns num of the consumer offset znodes and when the latest
+// offset was committed to zk.
+func (this *ZkCluster) ConsumerOffsetZnodes() (n int, lastCommit time.Time) {
+	for _, group := range this.zone.children(this.consumerGroupsRoot()) {
+		for _, topic := range this.zone.children(this.ConsumerGroupOffsetPath(group)) {
+			for _, zdata := range this.zone.ChildrenWithData(this.consumerGroupOffsetOfTopicPath(group, topic)) {
+				n++
+				if mtime := zdata.Mtime(); mtime.After(lastCommit) {
+					lastCommit = mtime
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// TopicsLastCommit returns {topic: when the latest offset of any group was committed to zk}.
+// Topics never committed by any group are absent.
+func (this *ZkCluster) TopicsLastCommit() map[string]time.Time {
+	r := make(map[string]time.Time)
+	for _, group := range this.zone.children(this.consumerGroupsRoot()) {
+		for _, topic := range this.zone.children(this.ConsumerGroupOffsetPath(group)) {
+			for _, zdata := range this.zone.ChildrenWithData(this.consumerGroupOffsetOfTopicPath(group, topic)) {
+				if mtime := zdata.Mtime(); mtime.After(r[topic]) {
+					r[topic] = mtime
+				}
+			}
+		}
+	}
+
+	return r
+}
+
 func (this *ZkCluster) ResetConsumerGroupOffset(topic, group, partition string, offset int64) error {
 	path := this.consumerGroupOffsetOfTopicPartitionPath(group, topic, partition)
 	data := fmt.Sprintf("%d", offset)
 	return this.zone.setZnode(path, []byte(data))
 }
 
+// SetConsumerGroupOffset is like ResetConsumerGroupOffset except that it creates the
+// offset znode if the group has not committed on the partition yet.
+func (this *ZkCluster) SetConsumerGroupOffset(topic, group, partition string, offset int64) error {
+	this.zone.connectIfNeccessary()
+
+	path := this.consumerGroupOffsetOfTopicPartitionPath(group, topic, partition)
+	data := []byte(strconv.FormatInt(offset, 10))
+	if err := this.zone.ensureParentDirExists(path); err != nil {
+		return err
+	}
+
+	err := this.zone.createZnode(path, data)
+	if err == zk.ErrNodeExists {
+		err = this.zone.setZnode(path, data)
+	}
+	return err
+}
+
+// SetConsumerGroupOffsets sets offsets{topic: {partitionId: offset}} of the group in a single
+// zk transaction: either all of them are written or none. The offset znodes must exist.
+func (this *ZkCluster) SetConsumerGroupOffsets(group string, offsets map[string]map[string]int64) error {
+	this.zone.connectIfNeccessary()
+
+	var (
+		ops  = make([]interface{}, 0)
+		olds = make([][]byte, 0)
+	)
+	for topic, partitions := range offsets {
+		for partition, offset := range partitions {
+			path := this.consumerGroupOffsetOfTopicPartitionPath(group, topic, partition)
+			ops = append(ops, &zk.SetDataRequest{
+				Path:    path,
+				Data:    []byte(strconv.FormatInt(offset, 10)),
+				Version: -1,
+			})
+			olds = append(olds, this.zone.auditValue(path))
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+
+	if _, err := this.zone.conn.Multi(ops...); err != nil {
+		return err
+	}
+
+	for i, op := range ops {
+		req := op.(*zk.SetDataRequest)
+		this.zone.audit(AuditSet, req.Path, olds[i], req.Data)
+	}
+	return nil
+}
+
 func (this *ZkCluster) ListChildren(recursive bool) ([]string, error) {
 	excludedPaths := map[string]struct{}{
 		"/zookeeper": struct{}{},
@@ -33,3 +33,34 @@ Node count: 48
 	assert.Equal(t, "S", stat.Mode)
 	assert.Equal(t, "48", stat.Znodes)
 }
+
+func TestParseMntrResult(t *testing.T) {
+	s := "zk_version\t3.4.6-1569965, built on 02/20/2014 09:09 GMT\nzk_avg_latency\t0\nzk_server_state\tleader\nzk_watch_count\t12\n"
+	m := ParseMntrResult(s)
+	assert.Equal(t, "3.4.6-1569965, built on 02/20/2014 09:09 GMT", m["zk_version"])
+	assert.Equal(t, "leader", m["zk_server_state"])
+
+	stats := ZkServerStats{Mntr: m}
+	assert.Equal(t, true, stats.Leader())
+	assert.Equal(t, int64(12), stats.MntrInt("zk_watch_count"))
+	assert.Equal(t, int64(0), stats.MntrInt("zk_followers"))
+
+	assert.Equal(t, 0, len(ParseMntrResult("This ZooKeeper instance is not currently serving requests")))
+}
+
+func TestParseConsResult(t *testing.T) {
+	s := `
+ /10.1.1.1:54276[1](queued=0,recved=12,sent=13,sid=0x15a,lop=PING,est=1489,to=30000,lcxid=0x1,lzxid=0x2,lresp=1489,llat=0,minlat=0,avglat=1,maxlat=9)
+ /0:0:0:0:0:0:0:1%0:53888[0](queued=0,recved=1,sent=0)
+
+`
+	conns := ParseConsResult(s)
+	assert.Equal(t, 2, len(conns))
+	assert.Equal(t, "10.1.1.1:54276", conns[0].Addr)
+	assert.Equal(t, "0x15a", conns[0].SessionId)
+	assert.Equal(t, "PING", conns[0].LastOp)
+	assert.Equal(t, int64(12), conns[0].Received)
+	assert.Equal(t, int64(30000), conns[0].Timeout)
+	assert.Equal(t, int64(9), conns[0].MaxLatency)
+	assert.Equal(t, "0:0:0:0:0:0:0:1%0:53888", conns[1].Addr)
+}
@@ -32,6 +32,10 @@ type ZkZone struct {
 	errs     []error
 
 	zkclusters map[string]*ZkCluster
+
+	shared     bool
+	session    *sharedSession // nil if not shared or not connected yet
+	sessionEvt chan zk.Event
 }
 
 // NewZkZone creates a new ZkZone instance.
@@ -46,6 +50,17 @@ func NewZkZone(config *Config) *ZkZone {
 	}
 }
 
+// NewSharedZkZone creates a new ZkZone instance that shares a single zookeeper session with
+// all other shared ZkZone's of the same zone in the process.
+// The session is dialed lazily on first use and closed when the last of them is closed, so
+// each of them must be closed explicitly. Ephemeral znodes created through it live until
+// the shared session is closed.
+func NewSharedZkZone(config *Config) *ZkZone {
+	zone := NewZkZone(config)
+	zone.shared = true
+	return zone
+}
+
 // SessionEvents returns zk connection events.
 func (this *ZkZone) SessionEvents() (<-chan zk.Event, bool) {
 	this.connectIfNeccessary()
@@ -85,7 +100,12 @@ func (this *ZkZone) Ping() error {
 func (this *ZkZone) Close() {
 	this.once.Do(func() {
 		this.mu.Lock()
-		if this.conn != nil {
+		if this.session != nil {
+			this.session.unsubscribe(this.sessionEvt)
+			this.session.release()
+			this.session = nil
+			this.conn = nil
+		} else if this.conn != nil {
 			this.conn.Close()
 			this.conn = nil
 		}
@@ -271,6 +291,202 @@ func (this *ZkZone) LoadKatewayMetrics(katewayId string, key string) ([]byte, er
 	return data, err
 }
 
+// FlushKatewaySubSession checkpoints the Sub sessions of a kateway instance so that its
+// standby partner can take them over once it dies.
+func (this *ZkZone) FlushKatewaySubSession(katewayId string, data []byte) error {
+	this.connectIfNeccessary()
+
+	path := katewaySubSessionPath(katewayId)
+	this.ensureParentDirExists(path)
+
+	err := this.createZnode(path, data)
+	if err == zk.ErrNodeExists {
+		return this.setZnode(path, data)
+	}
+
+	return err
+}
+
+// LoadKatewaySubSession returns nil data if the kateway has no Sub session checkpoint.
+func (this *ZkZone) LoadKatewaySubSession(katewayId string) ([]byte, error) {
+	this.connectIfNeccessary()
+
+	data, _, err := this.conn.Get(katewaySubSessionPath(katewayId))
+	if err == zk.ErrNoNode {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (this *ZkZone) DeleteKatewaySubSession(katewayId string) error {
+	this.connectIfNeccessary()
+
+	err := this.deleteZnode(katewaySubSessionPath(katewayId), -1)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	return err
+}
+
+// DisableTopic marks a topic as disabled, zk.ErrNodeExists if already marked.
+func (this *ZkZone) DisableTopic(meta DisabledTopicMeta) error {
+	this.connectIfNeccessary()
+
+	path := katewayDisabledTopicPath(meta.Cluster, meta.Topic)
+	this.ensureParentDirExists(path)
+
+	return this.createZnode(path, meta.Bytes())
+}
+
+// DisabledTopic returns nil if the topic is not disabled.
+func (this *ZkZone) DisabledTopic(cluster, topic string) (*DisabledTopicMeta, error) {
+	this.connectIfNeccessary()
+
+	data, _, err := this.conn.Get(katewayDisabledTopicPath(cluster, topic))
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	meta := &DisabledTopicMeta{}
+	err = meta.From(data)
+	return meta, err
+}
+
+func (this *ZkZone) DisabledTopics() []DisabledTopicMeta {
+	var r []DisabledTopicMeta
+	for _, cluster := range this.children(katewayDisabledRoot) {
+		for topic, data := range this.ChildrenWithData(katewayDisabledRoot + "/" + cluster) {
+			var meta DisabledTopicMeta
+			if err := meta.From(data.data); err != nil {
+				log.Error("disabled topic %s/%s: %v", cluster, topic, err)
+				continue
+			}
+
+			r = append(r, meta)
+		}
+	}
+
+	return r
+}
+
+// EnableTopic removes the disabled mark of a topic.
+func (this *ZkZone) EnableTopic(cluster, topic string) error {
+	this.connectIfNeccessary()
+
+	err := this.deleteZnode(katewayDisabledTopicPath(cluster, topic), -1)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	return err
+}
+
+func (this *ZkZone) CreateOrUpdateSpool(meta SpoolMeta) error {
+	this.connectIfNeccessary()
+
+	path := katewaySpoolPath(meta.Cluster, meta.Topic, meta.Group)
+	this.ensureParentDirExists(path)
+
+	data := meta.Bytes()
+	err := this.createZnode(path, data)
+	if err == zk.ErrNodeExists {
+		return this.setZnode(path, data)
+	}
+	return err
+}
+
+// Spool returns nil if the consumer group is not spooled.
+func (this *ZkZone) Spool(cluster, topic, group string) (*SpoolMeta, error) {
+	this.connectIfNeccessary()
+
+	data, _, err := this.conn.Get(katewaySpoolPath(cluster, topic, group))
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	meta := &SpoolMeta{}
+	err = meta.From(data)
+	return meta, err
+}
+
+func (this *ZkZone) Spools() []SpoolMeta {
+	var r []SpoolMeta
+	for _, cluster := range this.children(katewaySpoolRoot) {
+		for _, topic := range this.children(katewaySpoolRoot + "/" + cluster) {
+			for group, data := range this.ChildrenWithData(katewaySpoolRoot + "/" + cluster + "/" + topic) {
+				var meta SpoolMeta
+				if err := meta.From(data.data); err != nil {
+					log.Error("spool %s/%s/%s: %v", cluster, topic, group, err)
+					continue
+				}
+
+				r = append(r, meta)
+			}
+		}
+	}
+
+	return r
+}
+
+func (this *ZkZone) DeleteSpool(cluster, topic, group string) error {
+	this.connectIfNeccessary()
+
+	err := this.deleteZnode(katewaySpoolPath(cluster, topic, group), -1)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	return err
+}
+
+func (this *ZkZone) CreateOrUpdateRetryChain(meta RetryChainMeta) error {
+	this.connectIfNeccessary()
+
+	path := katewayRetryChainPath(meta.Cluster, meta.Topic, meta.Group)
+	this.ensureParentDirExists(path)
+
+	data := meta.Bytes()
+	err := this.createZnode(path, data)
+	if err == zk.ErrNodeExists {
+		return this.setZnode(path, data)
+	}
+	return err
+}
+
+// RetryChain returns nil if the consumer group has no retry chain.
+func (this *ZkZone) RetryChain(cluster, topic, group string) (*RetryChainMeta, error) {
+	this.connectIfNeccessary()
+
+	data, _, err := this.conn.Get(katewayRetryChainPath(cluster, topic, group))
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	meta := &RetryChainMeta{}
+	err = meta.From(data)
+	return meta, err
+}
+
+func (this *ZkZone) DeleteRetryChain(cluster, topic, group string) error {
+	this.connectIfNeccessary()
+
+	err := this.deleteZnode(katewayRetryChainPath(cluster, topic, group), -1)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	return err
+}
+
 func (this *ZkZone) NewclusterWithPath(cluster, path string) *ZkCluster {
 	if c, present := this.zkclusters[cluster]; present {
 		return c
@@ -330,6 +546,18 @@ func (this *ZkZone) Connect() (err error) {
 		return nil
 	}
 
+	if this.shared {
+		s, err := acquireSession(this.conf, this.conf.SessionTimeout)
+		if err != nil {
+			return err
+		}
+
+		this.session, this.conn = s, s.conn
+		this.sessionEvt = s.subscribe()
+		this.evt = this.sessionEvt
+		return nil
+	}
+
 	log.Debug("zk connecting %s", this.conf.ZkAddrs)
 	// zk.Connect will not do real tcp connect, needn't retry here
 	this.conn, this.evt, err = zk.Connect(this.ZkAddrList(), this.conf.SessionTimeout)
@@ -363,6 +591,9 @@ func (this *ZkZone) createZnode(path string, data []byte) error {
 	acl := zk.WorldACL(zk.PermAll)
 	flags := int32(0)
 	_, err := this.conn.Create(path, data, flags, acl)
+	if err == nil {
+		this.audit(AuditCreate, path, nil, data)
+	}
 	return err
 }
 
@@ -376,14 +607,60 @@ func (this *ZkZone) CreateEphemeralZnode(path string, data []byte) error {
 	acl := zk.WorldACL(zk.PermAll)
 	flags := int32(zk.FlagEphemeral)
 	_, err := this.conn.Create(path, data, flags, acl)
+	if err == nil {
+		this.audit(AuditCreate, path, nil, data)
+	}
+	return err
+}
+
+// CreateZnode creates a persistent znode along with its parents.
+func (this *ZkZone) CreateZnode(path string, data []byte) error {
+	this.connectIfNeccessary()
+
+	if err := this.ensureParentDirExists(path); err != nil {
+		return err
+	}
+
+	return this.createZnode(path, data)
+}
+
+// SetZnode sets data of a znode of the version, -1 means any version.
+func (this *ZkZone) SetZnode(path string, data []byte, version int32) error {
+	this.connectIfNeccessary()
+
+	old := this.auditValue(path)
+	_, err := this.conn.Set(path, data, version)
+	if err == nil {
+		this.audit(AuditSet, path, old, data)
+	}
 	return err
 }
 
 func (this *ZkZone) setZnode(path string, data []byte) error {
+	old := this.auditValue(path)
 	_, err := this.conn.Set(path, data, -1)
+	if err == nil {
+		this.audit(AuditSet, path, old, data)
+	}
+	return err
+}
+
+func (this *ZkZone) deleteZnode(path string, version int32) error {
+	old := this.auditValue(path)
+	err := this.conn.Delete(path, version)
+	if err == nil {
+		this.audit(AuditDelete, path, old, nil)
+	}
 	return err
 }
 
+// DeleteZnode deletes a znode of the version, -1 means any version.
+func (this *ZkZone) DeleteZnode(path string, version int32) error {
+	this.connectIfNeccessary()
+
+	return this.deleteZnode(path, version)
+}
+
 func (this *ZkZone) children(path string) []string {
 	this.connectIfNeccessary()
 
@@ -403,27 +680,78 @@ func (this *ZkZone) children(path string) []string {
 func (this *ZkZone) ChildrenWithData(path string) map[string]zkData {
 	children := this.children(path)
 
-	r := make(map[string]zkData, len(children))
 	if path == "/" {
 		path = ""
 	}
+	paths := make([]string, 0, len(children))
 	for _, name := range children {
-		data, stat, err := this.conn.Get(path + "/" + name)
-		if err != nil {
-			// e,g. /consumers/group/owners/topic/3 zk: node does not exist
-			log.Error("%s: %v", path+"/"+name, err)
-			continue
-		}
+		paths = append(paths, path+"/"+name)
+	}
 
-		r[name] = zkData{
-			data:  data,
-			mtime: ZkTimestamp(stat.Mtime),
-			ctime: ZkTimestamp(stat.Ctime),
+	znodes := this.getMany(paths)
+	r := make(map[string]zkData, len(znodes))
+	for _, name := range children {
+		if zdata, present := znodes[path+"/"+name]; present {
+			r[name] = zdata
 		}
 	}
 	return r
 }
 
+// getMany reads the znodes concurrently with a bounded worker pool, and returns {path: zkData}.
+// The zk client pipelines requests over the session, so on big clusters it is much faster
+// than thousands of sequential round trips.
+// Znodes failed to read are logged and absent from the result.
+func (this *ZkZone) getMany(paths []string) map[string]zkData {
+	this.connectIfNeccessary()
+
+	workers := this.conf.ReadConcurrency
+	if workers <= 0 {
+		workers = DefaultReadConcurrency
+	}
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+
+	var (
+		r    = make(map[string]zkData, len(paths))
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		jobs = make(chan string, len(paths))
+	)
+	for _, path := range paths {
+		jobs <- path
+	}
+	close(jobs)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for path := range jobs {
+				data, stat, err := this.conn.Get(path)
+				if err != nil {
+					// e,g. /consumers/group/owners/topic/3 zk: node does not exist
+					log.Error("%s: %v", path, err)
+					continue
+				}
+
+				mu.Lock()
+				r[path] = zkData{
+					data:  data,
+					mtime: ZkTimestamp(stat.Mtime),
+					ctime: ZkTimestamp(stat.Ctime),
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return r
+}
+
 // returns {clusterName: clusterZkPath}
 func (this *ZkZone) Clusters() map[string]string {
 	r := make(map[string]string)
@@ -483,6 +811,8 @@ func (this *ZkZone) mkdirRecursive(node string) (err error) {
 	_, err = this.conn.Create(node, nil, 0, zk.WorldACL(zk.PermAll))
 	if err == zk.ErrNodeExists {
 		err = nil
+	} else if err == nil {
+		this.audit(AuditCreate, node, nil, nil)
 	}
 	return
 }
@@ -503,7 +833,7 @@ func (this *ZkZone) DeleteRecursive(node string) (err error) {
 		}
 	}
 
-	return this.conn.Delete(node, stat.Version)
+	return this.deleteZnode(node, stat.Version)
 }
 
 // unused yet